@@ -37,6 +37,37 @@ case "${1:-}" in
     ./bin/syncer-attio 2>&1 | sed 's/^/[Syncer] /'
     echo "Syncer for Attio finished."
     ;;
+  syncer-clickhouse)
+    : "${SOURCE_CLICKHOUSE_URL:?Environment variable SOURCE_CLICKHOUSE_URL must be set}"
+    : "${SOURCE_CLICKHOUSE_QUERIES:?Environment variable SOURCE_CLICKHOUSE_QUERIES must be set}"
+    : "${DESTINATION_SCHEMA_NAME:?Environment variable DESTINATION_SCHEMA_NAME must be set}"
+
+    psql $CATALOG_DATABASE_URL -f /app/scripts/catalog.sql
+
+    echo "Starting Syncer for ClickHouse..."
+    ./bin/syncer-clickhouse 2>&1 | sed 's/^/[Syncer] /'
+    echo "Syncer for ClickHouse finished."
+    ;;
+  syncer-connector)
+    : "${SOURCE_CONNECTOR_NAME:?Environment variable SOURCE_CONNECTOR_NAME must be set}"
+    : "${DESTINATION_SCHEMA_NAME:?Environment variable DESTINATION_SCHEMA_NAME must be set}"
+
+    psql $CATALOG_DATABASE_URL -f /app/scripts/catalog.sql
+
+    echo "Starting Syncer for connector $SOURCE_CONNECTOR_NAME..."
+    ./bin/syncer-connector 2>&1 | sed 's/^/[Syncer] /'
+    echo "Syncer for connector $SOURCE_CONNECTOR_NAME finished."
+    ;;
+  syncer-singer)
+    : "${SOURCE_SINGER_COMMAND:?Environment variable SOURCE_SINGER_COMMAND must be set}"
+    : "${DESTINATION_SCHEMA_NAME:?Environment variable DESTINATION_SCHEMA_NAME must be set}"
+
+    psql $CATALOG_DATABASE_URL -f /app/scripts/catalog.sql
+
+    echo "Starting Syncer for Singer/Airbyte..."
+    ./bin/syncer-singer 2>&1 | sed 's/^/[Syncer] /'
+    echo "Syncer for Singer/Airbyte finished."
+    ;;
   server)
     : "${AWS_REGION:?Environment variable AWS_REGION must be set}"
     : "${AWS_S3_BUCKET:?Environment variable AWS_S3_BUCKET must be set}"
@@ -47,6 +78,19 @@ case "${1:-}" in
     echo "Starting server..."
     ./bin/server
     ;;
+  backup-catalog|restore-catalog)
+    : "${2:?Usage: $1 <file>}"
+    : "${CATALOG_DATABASE_URL:?Environment variable CATALOG_DATABASE_URL must be set}"
+
+    psql $CATALOG_DATABASE_URL -f /app/scripts/catalog.sql
+
+    ./bin/server "$1" "$2"
+    ;;
+  compare)
+    : "${4:?Usage: $1 <queries file> <database URL> <other database URL>}"
+
+    ./bin/server "$1" "$2" "$3" "$4"
+    ;;
   *)
     echo "Unknown argument: ${1:-}"
     echo "Available options: syncer-postgres, bash"
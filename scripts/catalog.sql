@@ -14,3 +14,51 @@ CREATE TABLE IF NOT EXISTS iceberg_materialized_views (
 );
 
 CREATE UNIQUE INDEX IF NOT EXISTS idx_materialized_views ON iceberg_materialized_views (schema_name, table_name);
+
+CREATE TABLE IF NOT EXISTS iceberg_views (
+  schema_name VARCHAR(255) NOT NULL,
+  table_name VARCHAR(255) NOT NULL,
+  definition TEXT NOT NULL
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_views ON iceberg_views (schema_name, table_name);
+
+CREATE TABLE IF NOT EXISTS iceberg_table_partitions (
+  schema_name VARCHAR(255) NOT NULL,
+  table_name VARCHAR(255) NOT NULL,
+  partition_table_name VARCHAR(255) NOT NULL
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_table_partitions ON iceberg_table_partitions (schema_name, partition_table_name);
+
+CREATE TABLE IF NOT EXISTS iceberg_schemas (
+  schema_name VARCHAR(255) NOT NULL
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_schemas ON iceberg_schemas (schema_name);
+
+CREATE TABLE IF NOT EXISTS iceberg_created_tables (
+  schema_name VARCHAR(255) NOT NULL,
+  table_name VARCHAR(255) NOT NULL
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_created_tables ON iceberg_created_tables (schema_name, table_name);
+
+CREATE TABLE IF NOT EXISTS syncer_states (
+  schema_name VARCHAR(255) NOT NULL,
+  name VARCHAR(255) NOT NULL,
+  state JSONB NOT NULL,
+  updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_syncer_states ON syncer_states (schema_name, name);
+
+CREATE TABLE IF NOT EXISTS sync_runs (
+  schema_name VARCHAR(255) NOT NULL,
+  table_name VARCHAR(255) NOT NULL,
+  row_count BIGINT NOT NULL,
+  rejected_row_count BIGINT NOT NULL,
+  finished_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_sync_runs ON sync_runs (schema_name, table_name, finished_at);
@@ -0,0 +1,82 @@
+package common
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// Limits the total throughput of all readers and writers sharing the limiter
+type BandwidthLimiter struct {
+	BytesPerSecond  int64
+	mutex           sync.Mutex
+	nextAvailableAt time.Time
+}
+
+func NewBandwidthLimiter(bytesPerSecond int64) *BandwidthLimiter {
+	return &BandwidthLimiter{BytesPerSecond: bytesPerSecond}
+}
+
+// Blocks until the limiter has capacity for transferring byteCount bytes
+func (limiter *BandwidthLimiter) Wait(byteCount int) {
+	limiter.mutex.Lock()
+	now := time.Now()
+	if limiter.nextAvailableAt.Before(now) {
+		limiter.nextAvailableAt = now
+	}
+	waitUntil := limiter.nextAvailableAt
+	limiter.nextAvailableAt = limiter.nextAvailableAt.Add(time.Duration(int64(byteCount) * int64(time.Second) / limiter.BytesPerSecond))
+	limiter.mutex.Unlock()
+
+	time.Sleep(time.Until(waitUntil))
+}
+
+func (limiter *BandwidthLimiter) maxChunkSize(size int) int {
+	if int64(size) > limiter.BytesPerSecond {
+		return int(limiter.BytesPerSecond)
+	}
+	return size
+}
+
+// -------------------------------------------------------------------------------------------------
+
+type ThrottledReader struct {
+	Reader  io.Reader
+	Limiter *BandwidthLimiter
+}
+
+func NewThrottledReader(reader io.Reader, limiter *BandwidthLimiter) *ThrottledReader {
+	return &ThrottledReader{Reader: reader, Limiter: limiter}
+}
+
+func (r *ThrottledReader) Read(payload []byte) (int, error) {
+	readBytes, err := r.Reader.Read(payload[:r.Limiter.maxChunkSize(len(payload))])
+	r.Limiter.Wait(readBytes)
+	return readBytes, err
+}
+
+// -------------------------------------------------------------------------------------------------
+
+type ThrottledWriter struct {
+	Writer  io.Writer
+	Limiter *BandwidthLimiter
+}
+
+func NewThrottledWriter(writer io.Writer, limiter *BandwidthLimiter) *ThrottledWriter {
+	return &ThrottledWriter{Writer: writer, Limiter: limiter}
+}
+
+func (w *ThrottledWriter) Write(payload []byte) (writtenBytes int, err error) {
+	for len(payload) > 0 {
+		chunk := payload[:w.Limiter.maxChunkSize(len(payload))]
+		w.Limiter.Wait(len(chunk))
+
+		chunkWrittenBytes, err := w.Writer.Write(chunk)
+		writtenBytes += chunkWrittenBytes
+		if err != nil {
+			return writtenBytes, err
+		}
+		payload = payload[len(chunk):]
+	}
+	return writtenBytes, nil
+}
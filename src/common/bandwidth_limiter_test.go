@@ -0,0 +1,47 @@
+package common
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestBandwidthLimiter(t *testing.T) {
+	t.Run("Throttles reads", func(t *testing.T) {
+		limiter := NewBandwidthLimiter(1000)
+		reader := NewThrottledReader(bytes.NewReader(make([]byte, 1500)), limiter)
+
+		startedAt := time.Now()
+		readBytes, err := io.ReadAll(reader)
+		if err != nil {
+			t.Fatalf("ReadAll failed: %v", err)
+		}
+
+		if len(readBytes) != 1500 {
+			t.Errorf("Expected 1500 bytes, got %d", len(readBytes))
+		}
+		if time.Since(startedAt) < 900*time.Millisecond {
+			t.Errorf("Expected reading to take at least 1s, took %v", time.Since(startedAt))
+		}
+	})
+
+	t.Run("Throttles writes", func(t *testing.T) {
+		limiter := NewBandwidthLimiter(1000)
+		var buffer bytes.Buffer
+		writer := NewThrottledWriter(&buffer, limiter)
+
+		startedAt := time.Now()
+		writtenBytes, err := writer.Write(make([]byte, 2500))
+		if err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+
+		if writtenBytes != 2500 || buffer.Len() != 2500 {
+			t.Errorf("Expected 2500 bytes, got %d", writtenBytes)
+		}
+		if time.Since(startedAt) < 1900*time.Millisecond {
+			t.Errorf("Expected writing to take at least 2s, took %v", time.Since(startedAt))
+		}
+	})
+}
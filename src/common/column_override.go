@@ -0,0 +1,56 @@
+package common
+
+import (
+	"sort"
+	"strings"
+)
+
+// Per-column transformation applied while loading rows into DuckDB, before writing Parquet files
+type ColumnOverride struct {
+	Rename     string `json:"rename"`     // Destination column name
+	Type       string `json:"type"`       // DuckDB type to cast to, e.g. "VARCHAR" or "DECIMAL(10,2)"
+	Expression string `json:"expression"` // DuckDB expression over the source columns, e.g. "lower(email)"
+}
+
+func (override ColumnOverride) IsTransformation() bool {
+	return override.Type != "" || override.Expression != ""
+}
+
+// SELECT list that turns source columns into destination columns
+func columnOverridesProjection(sourceSchemaColumns []*IcebergSchemaColumn, columnOverrides map[string]ColumnOverride) string {
+	selectItems := make([]string, len(sourceSchemaColumns))
+	for i, sourceSchemaColumn := range sourceSchemaColumns {
+		override := columnOverrides[sourceSchemaColumn.ColumnName]
+
+		expression := sourceSchemaColumn.QuotedColumnName()
+		if override.Expression != "" {
+			expression = "(" + override.Expression + ")"
+		}
+		if override.Type != "" {
+			expression = "CAST(" + expression + " AS " + override.Type + ")"
+		}
+
+		columnName := sourceSchemaColumn.ColumnName
+		if override.Rename != "" {
+			columnName = override.Rename
+		}
+		selectItems[i] = expression + ` AS "` + strings.ReplaceAll(columnName, `"`, `""`) + `"`
+	}
+	return strings.Join(selectItems, ", ")
+}
+
+func columnOverridesUnknownColumnNames(sourceSchemaColumns []*IcebergSchemaColumn, columnOverrides map[string]ColumnOverride) []string {
+	sourceColumnNames := NewSet[string]()
+	for _, sourceSchemaColumn := range sourceSchemaColumns {
+		sourceColumnNames.Add(sourceSchemaColumn.ColumnName)
+	}
+
+	unknownColumnNames := []string{}
+	for columnName := range columnOverrides {
+		if !sourceColumnNames.Contains(columnName) {
+			unknownColumnNames = append(unknownColumnNames, columnName)
+		}
+	}
+	sort.Strings(unknownColumnNames)
+	return unknownColumnNames
+}
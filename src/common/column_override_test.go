@@ -0,0 +1,40 @@
+package common
+
+import (
+	"testing"
+)
+
+func TestColumnOverridesProjection(t *testing.T) {
+	sourceSchemaColumns := []*IcebergSchemaColumn{
+		{ColumnName: "id", ColumnType: IcebergColumnTypeInteger},
+		{ColumnName: "email", ColumnType: IcebergColumnTypeString},
+		{ColumnName: "amount", ColumnType: IcebergColumnTypeString},
+	}
+	columnOverrides := map[string]ColumnOverride{
+		"email":  {Rename: "normalized_email", Expression: "lower(email)"},
+		"amount": {Type: "DECIMAL(10,2)"},
+	}
+
+	projection := columnOverridesProjection(sourceSchemaColumns, columnOverrides)
+
+	expected := `"id" AS "id", (lower(email)) AS "normalized_email", CAST("amount" AS DECIMAL(10,2)) AS "amount"`
+	if projection != expected {
+		t.Errorf("Expected projection %s, got %s", expected, projection)
+	}
+}
+
+func TestColumnOverridesUnknownColumnNames(t *testing.T) {
+	sourceSchemaColumns := []*IcebergSchemaColumn{
+		{ColumnName: "id", ColumnType: IcebergColumnTypeInteger},
+	}
+	columnOverrides := map[string]ColumnOverride{
+		"id":      {Rename: "user_id"},
+		"missing": {Type: "VARCHAR"},
+	}
+
+	unknownColumnNames := columnOverridesUnknownColumnNames(sourceSchemaColumns, columnOverrides)
+
+	if len(unknownColumnNames) != 1 || unknownColumnNames[0] != "missing" {
+		t.Errorf("Expected unknown column names [missing], got %v", unknownColumnNames)
+	}
+}
@@ -1,5 +1,10 @@
 package common
 
+import (
+	"flag"
+	"os"
+)
+
 const (
 	VERSION = "1.7.0"
 
@@ -14,6 +19,14 @@ const (
 	ENV_AWS_ACCESS_KEY_ID     = "AWS_ACCESS_KEY_ID"
 	ENV_AWS_SECRET_ACCESS_KEY = "AWS_SECRET_ACCESS_KEY"
 
+	ENV_AWS_S3_MAX_UPLOAD_BYTES_PER_SECOND = "AWS_S3_MAX_UPLOAD_BYTES_PER_SECOND"
+
+	ENV_AWS_S3_SERVER_SIDE_ENCRYPTION = "AWS_S3_SERVER_SIDE_ENCRYPTION"
+	ENV_AWS_S3_KMS_KEY_ID             = "AWS_S3_KMS_KEY_ID"
+
+	AWS_S3_SSE_S3  = "AES256"
+	AWS_S3_SSE_KMS = "aws:kms"
+
 	DEFAULT_LOG_LEVEL       = "INFO"
 	DEFAULT_AWS_S3_ENDPOINT = "s3.amazonaws.com"
 )
@@ -24,6 +37,11 @@ type AwsConfig struct {
 	S3Bucket        string
 	AccessKeyId     string
 	SecretAccessKey string
+
+	S3MaxUploadBytesPerSecond int64 // optional, 0 means unlimited
+
+	ServerSideEncryption string // optional, "AES256" (SSE-S3) or "aws:kms" (SSE-KMS) for written objects
+	KmsKeyId             string // optional, KMS key ID or ARN, required for SSE-KMS
 }
 
 type CommonConfig struct {
@@ -32,3 +50,17 @@ type CommonConfig struct {
 	CatalogDatabaseUrl        string
 	DisableAnonymousAnalytics bool
 }
+
+// Registers the S3 upload bandwidth cap shared by all syncers writing through the S3 client
+func RegisterAwsS3MaxUploadFlag(awsConfig *AwsConfig) {
+	flag.Int64Var(&awsConfig.S3MaxUploadBytesPerSecond, "aws-s3-max-upload-bytes-per-second", 0, "Maximum S3 upload bandwidth in bytes per second. Default: 0 (unlimited)")
+	if s3MaxUploadBytesPerSecond := os.Getenv(ENV_AWS_S3_MAX_UPLOAD_BYTES_PER_SECOND); s3MaxUploadBytesPerSecond != "" {
+		awsConfig.S3MaxUploadBytesPerSecond = StringToInt64(s3MaxUploadBytesPerSecond)
+	}
+}
+
+func ValidateAwsS3MaxUpload(awsConfig AwsConfig) {
+	if awsConfig.S3MaxUploadBytesPerSecond < 0 {
+		panic("AWS S3 max upload bytes per second must be greater than or equal to 0")
+	}
+}
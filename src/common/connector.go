@@ -0,0 +1,84 @@
+package common
+
+import (
+	"sort"
+)
+
+// Connector is the interface implemented by syncers to extract data from a source.
+// It can be implemented in Go and registered with RegisterConnector, or shipped as an external plugin (see ConnectorPlugin).
+type Connector interface {
+	// Discover returns the streams (tables) that can be read from the source
+	Discover() ([]ConnectorStream, error)
+
+	// Read writes stream records to jsonQueueWriter, starting after cursorValue if the stream has a cursor column
+	Read(stream ConnectorStream, cursorValue CursorValue, jsonQueueWriter *JsonQueueWriter) error
+}
+
+// StreamingConnector is an optional extension for connectors that can continuously stream new records
+type StreamingConnector interface {
+	Connector
+
+	Stream(stream ConnectorStream, cursorValue CursorValue, jsonQueueWriter *JsonQueueWriter) error
+}
+
+type ConnectorStream struct {
+	Name             string                  `json:"name"`
+	Columns          []ConnectorStreamColumn `json:"columns"`
+	CursorColumnName string                  `json:"cursor_column_name,omitempty"` // Full-refresh sync if empty, incremental sync otherwise
+}
+
+type ConnectorStreamColumn struct {
+	Name              string                   `json:"name"`
+	Type              IcebergColumnType        `json:"type"`
+	LogicalType       IcebergLogicalColumnType `json:"logical_type,omitempty"`
+	List              bool                     `json:"list,omitempty"`
+	Required          bool                     `json:"required,omitempty"`
+	NumericPrecision  int                      `json:"numeric_precision,omitempty"`
+	NumericScale      int                      `json:"numeric_scale,omitempty"`
+	DatetimePrecision int                      `json:"datetime_precision,omitempty"`
+}
+
+func (stream ConnectorStream) IcebergSchemaColumns(config *CommonConfig) []*IcebergSchemaColumn {
+	icebergSchemaColumns := make([]*IcebergSchemaColumn, len(stream.Columns))
+	for i, column := range stream.Columns {
+		icebergSchemaColumns[i] = &IcebergSchemaColumn{
+			Config:            config,
+			ColumnName:        column.Name,
+			ColumnType:        column.Type,
+			LogicalColumnType: column.LogicalType,
+			Position:          i + 1,
+			NumericPrecision:  column.NumericPrecision,
+			NumericScale:      column.NumericScale,
+			DatetimePrecision: column.DatetimePrecision,
+			IsList:            column.List,
+			IsRequired:        column.Required,
+		}
+	}
+	return icebergSchemaColumns
+}
+
+// ---------------------------------------------------------------------------------------------------------------------
+
+var _connectorFactoryByName = make(map[string]func(config *CommonConfig) Connector)
+
+func RegisterConnector(name string, connectorFactory func(config *CommonConfig) Connector) {
+	_connectorFactoryByName[name] = connectorFactory
+}
+
+// LoadConnector returns a registered Go connector by name, falling back to an external plugin executable
+func LoadConnector(config *CommonConfig, name string) (Connector, error) {
+	if connectorFactory, ok := _connectorFactoryByName[name]; ok {
+		return connectorFactory(config), nil
+	}
+
+	return NewConnectorPlugin(config, name)
+}
+
+func RegisteredConnectorNames() []string {
+	names := make([]string, 0, len(_connectorFactoryByName))
+	for name := range _connectorFactoryByName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,156 @@
+package common
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+)
+
+// External connectors are executables named "bemidb-connector-[NAME]" found in PATH.
+// They communicate with BemiDB over stdout using newline-delimited JSON:
+//
+//	bemidb-connector-[NAME] discover
+//	  -> {"streams": [{"name": "users", "columns": [{"name": "id", "type": "long", "required": true}], "cursor_column_name": "id"}]}
+//	bemidb-connector-[NAME] read --stream users [--cursor 123]
+//	  -> {"id": 124, ...}\n{"id": 125, ...}\n
+//	bemidb-connector-[NAME] stream --stream users [--cursor 123] (optional, runs until stopped)
+//	  -> {"id": 124, ...}\n...
+//
+// Logs written to stderr are forwarded to the BemiDB logs. A non-zero exit code is treated as a failure.
+const (
+	CONNECTOR_PLUGIN_EXECUTABLE_PREFIX = "bemidb-connector-"
+
+	CONNECTOR_PLUGIN_COMMAND_DISCOVER = "discover"
+	CONNECTOR_PLUGIN_COMMAND_READ     = "read"
+	CONNECTOR_PLUGIN_COMMAND_STREAM   = "stream"
+
+	CONNECTOR_PLUGIN_MAX_RECORD_SIZE = 64 * 1024 * 1024 // 64 MB
+)
+
+type ConnectorPlugin struct {
+	Config         *CommonConfig
+	Name           string
+	ExecutablePath string
+}
+
+type ConnectorPluginDiscoverResponse struct {
+	Streams []ConnectorStream `json:"streams"`
+}
+
+func NewConnectorPlugin(config *CommonConfig, name string) (*ConnectorPlugin, error) {
+	executablePath, err := exec.LookPath(CONNECTOR_PLUGIN_EXECUTABLE_PREFIX + name)
+	if err != nil {
+		return nil, fmt.Errorf("connector %s is not registered and plugin executable %s is not found in PATH", name, CONNECTOR_PLUGIN_EXECUTABLE_PREFIX+name)
+	}
+
+	return &ConnectorPlugin{
+		Config:         config,
+		Name:           name,
+		ExecutablePath: executablePath,
+	}, nil
+}
+
+func (plugin *ConnectorPlugin) Discover() ([]ConnectorStream, error) {
+	var response ConnectorPluginDiscoverResponse
+
+	err := plugin.run([]string{CONNECTOR_PLUGIN_COMMAND_DISCOVER}, func(stdout io.Reader) error {
+		return json.NewDecoder(stdout).Decode(&response)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return response.Streams, nil
+}
+
+func (plugin *ConnectorPlugin) Read(stream ConnectorStream, cursorValue CursorValue, jsonQueueWriter *JsonQueueWriter) error {
+	return plugin.run(plugin.streamArgs(CONNECTOR_PLUGIN_COMMAND_READ, stream, cursorValue), func(stdout io.Reader) error {
+		return plugin.copyRecords(stdout, jsonQueueWriter)
+	})
+}
+
+func (plugin *ConnectorPlugin) Stream(stream ConnectorStream, cursorValue CursorValue, jsonQueueWriter *JsonQueueWriter) error {
+	return plugin.run(plugin.streamArgs(CONNECTOR_PLUGIN_COMMAND_STREAM, stream, cursorValue), func(stdout io.Reader) error {
+		return plugin.copyRecords(stdout, jsonQueueWriter)
+	})
+}
+
+func (plugin *ConnectorPlugin) streamArgs(command string, stream ConnectorStream, cursorValue CursorValue) []string {
+	args := []string{command, "--stream", stream.Name}
+	if cursorValue.StringValue != "" {
+		args = append(args, "--cursor", cursorValue.StringValue)
+	}
+	return args
+}
+
+func (plugin *ConnectorPlugin) copyRecords(stdout io.Reader, jsonQueueWriter *JsonQueueWriter) error {
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 0, 1024*1024), CONNECTOR_PLUGIN_MAX_RECORD_SIZE)
+
+	recordCount := 0
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(strings.TrimSpace(string(line))) == 0 {
+			continue
+		}
+
+		var record map[string]interface{}
+		err := json.Unmarshal(line, &record)
+		if err != nil {
+			return fmt.Errorf("invalid record from connector %s: %w", plugin.Name, err)
+		}
+
+		err = jsonQueueWriter.Write(record)
+		if err != nil {
+			return err
+		}
+		recordCount++
+	}
+
+	LogInfo(plugin.Config, "Read", recordCount, "records from connector", plugin.Name)
+	return scanner.Err()
+}
+
+func (plugin *ConnectorPlugin) run(args []string, readStdoutFunc func(stdout io.Reader) error) error {
+	LogDebug(plugin.Config, "Running connector:", plugin.ExecutablePath, strings.Join(args, " "))
+	cmd := exec.Command(plugin.ExecutablePath, args...)
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+
+	err = cmd.Start()
+	if err != nil {
+		return err
+	}
+
+	stderrDone := make(chan struct{})
+	go func() {
+		scanner := bufio.NewScanner(stderr)
+		for scanner.Scan() {
+			LogInfo(plugin.Config, "["+plugin.Name+"]", scanner.Text())
+		}
+		close(stderrDone)
+	}()
+
+	readErr := readStdoutFunc(stdout)
+	io.Copy(io.Discard, stdout) // Unblock the process before waiting for it
+	<-stderrDone
+
+	err = cmd.Wait()
+	if readErr != nil {
+		return readErr
+	}
+	if err != nil {
+		return fmt.Errorf("connector %s failed: %w", plugin.Name, err)
+	}
+	return nil
+}
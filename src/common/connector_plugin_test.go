@@ -0,0 +1,88 @@
+package common
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const TEST_CONNECTOR_PLUGIN_SCRIPT = `#!/bin/sh
+case "$1" in
+  discover)
+    echo '{"streams": [{"name": "users", "columns": [{"name": "id", "type": "long", "required": true}], "cursor_column_name": "id"}]}'
+    ;;
+  read)
+    echo "reading $3 after $5" >&2
+    echo '{"id": 2}'
+    echo '{"id": 3}'
+    ;;
+  *)
+    exit 1
+    ;;
+esac
+`
+
+func TestConnectorPlugin(t *testing.T) {
+	pluginDir := t.TempDir()
+	err := os.WriteFile(filepath.Join(pluginDir, CONNECTOR_PLUGIN_EXECUTABLE_PREFIX+"test"), []byte(TEST_CONNECTOR_PLUGIN_SCRIPT), 0755)
+	if err != nil {
+		t.Fatalf("Failed to write plugin: %v", err)
+	}
+	t.Setenv("PATH", pluginDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	t.Run("Loads a plugin by name", func(t *testing.T) {
+		_, err := LoadConnector(initTestConfig(), "test")
+
+		if err != nil {
+			t.Fatalf("Failed to load connector: %v", err)
+		}
+	})
+
+	t.Run("Returns an error for a missing plugin", func(t *testing.T) {
+		_, err := LoadConnector(initTestConfig(), "missing")
+
+		if err == nil {
+			t.Fatalf("Expected an error for a missing connector")
+		}
+	})
+
+	t.Run("Discovers streams", func(t *testing.T) {
+		connector, _ := LoadConnector(initTestConfig(), "test")
+
+		streams, err := connector.Discover()
+
+		if err != nil {
+			t.Fatalf("Discover failed: %v", err)
+		}
+		if len(streams) != 1 || streams[0].Name != "users" || streams[0].CursorColumnName != "id" {
+			t.Fatalf("Unexpected streams: %v", streams)
+		}
+		if streams[0].Columns[0].Type != IcebergColumnTypeLong || !streams[0].Columns[0].Required {
+			t.Errorf("Unexpected columns: %v", streams[0].Columns)
+		}
+	})
+
+	t.Run("Reads records", func(t *testing.T) {
+		connector, _ := LoadConnector(initTestConfig(), "test")
+		buffer := &bytes.Buffer{}
+		writer := NewJsonQueueWriter(buffer)
+		reader := NewJsonQueueReader(buffer)
+
+		err := connector.Read(ConnectorStream{Name: "users"}, CursorValue{ColumnName: "id", StringValue: "1"}, writer)
+
+		if err != nil {
+			t.Fatalf("Read failed: %v", err)
+		}
+		for _, expectedId := range []float64{2, 3} {
+			var record map[string]interface{}
+			_, err = reader.Read(&record)
+			if err != nil {
+				t.Fatalf("Failed to read record: %v", err)
+			}
+			if record["id"] != expectedId {
+				t.Errorf("Expected id %v, got %v", expectedId, record["id"])
+			}
+		}
+	})
+}
@@ -33,7 +33,8 @@ func NewDuckdbClient(config *CommonConfig, bootQueries ...[]string) *DuckdbClien
 	}
 
 	queries := []string{
-		"SET timezone='UTC'",
+		"LOAD icu",                  // Named time zones and their DST rules
+		"SET GLOBAL TimeZone='UTC'", // For all pooled connections, sessions change it with SET timezone
 	}
 	if bootQueries != nil {
 		queries = append(queries, bootQueries[0]...)
@@ -132,13 +133,19 @@ func (client *DuckdbClient) Close() {
 
 func (client *DuckdbClient) setExplicitAwsCredentials(ctx context.Context) {
 	config := client.Config
-	query := "CREATE OR REPLACE SECRET aws_s3_secret (TYPE S3, KEY_ID '$accessKeyId', SECRET '$secretAccessKey', REGION '$region', ENDPOINT '$endpoint', SCOPE '$s3Bucket')"
+	query := "CREATE OR REPLACE SECRET aws_s3_secret (TYPE S3, KEY_ID '$accessKeyId', SECRET '$secretAccessKey', REGION '$region', ENDPOINT '$endpoint', SCOPE '$s3Bucket'"
+	if config.Aws.KmsKeyId != "" {
+		// Parquet files written with COPY ... TO 's3://...' are encrypted with the KMS key
+		query += ", KMS_KEY_ID '$kmsKeyId'"
+	}
+	query += ")"
 	_, err := client.ExecContext(ctx, query, map[string]string{
 		"accessKeyId":     config.Aws.AccessKeyId,
 		"secretAccessKey": config.Aws.SecretAccessKey,
 		"region":          config.Aws.Region,
 		"endpoint":        config.Aws.S3Endpoint,
 		"s3Bucket":        "s3://" + config.Aws.S3Bucket,
+		"kmsKeyId":        config.Aws.KmsKeyId,
 	})
 	PanicIfError(config, err)
 }
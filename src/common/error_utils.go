@@ -12,8 +12,15 @@ import (
 	"time"
 )
 
+// Set by the server to panic instead of exiting on errors, so it can recover from a failing query and keep serving other sessions.
+// Goroutines must then recover themselves, e.g. with a deferred HandleUnexpectedPanic
+var PanicInsteadOfExit bool
+
 func PanicIfError(config *CommonConfig, err error) {
 	if err != nil {
+		if PanicInsteadOfExit {
+			panic(err)
+		}
 		sendAnonymousErrorReport(config, err)
 		printUnexpectedError(config, err)
 		os.Exit(1)
@@ -30,15 +37,22 @@ func PrintErrorAndExit(config *CommonConfig, message string) {
 	os.Exit(1)
 }
 
+// Must be deferred directly to recover
 func HandleUnexpectedPanic(config *CommonConfig) {
-	func() {
-		if r := recover(); r != nil {
-			err, _ := r.(error)
-			sendAnonymousErrorReport(config, err)
-			printUnexpectedError(config, err)
-			os.Exit(1)
+	if r := recover(); r != nil {
+		err, ok := r.(error)
+		if !ok {
+			err = fmt.Errorf("%v", r)
 		}
-	}()
+		sendAnonymousErrorReport(config, err)
+		printUnexpectedError(config, err)
+		os.Exit(1)
+	}
+}
+
+// Reports an error recovered without terminating the process
+func ReportRecoveredError(config *CommonConfig, err error) {
+	sendAnonymousErrorReport(config, err)
 }
 
 func printUnexpectedError(config *CommonConfig, err error) {
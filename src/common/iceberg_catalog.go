@@ -1,17 +1,33 @@
 package common
 
 import (
+	"cmp"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
 )
 
 const (
 	TEMP_TABLE_SUFFIX_SYNCING  = "-bemidb-syncing"
 	TEMP_TABLE_SUFFIX_DELETING = "-bemidb-deleting"
+
+	CATALOG_BACKUP_VERSION = 2
 )
 
+// Wrapped by errors for schemas, materialized views, and views that already exist
+var ErrAlreadyExists = errors.New("already exists")
+
+// Catalog tables in backups of each version, so restoring an older backup keeps the tables it doesn't contain
+var CATALOG_BACKUP_TABLES_BY_VERSION = map[int][]string{
+	1: {"iceberg_tables", "iceberg_materialized_views", "syncer_states"},
+	2: {"iceberg_tables", "iceberg_materialized_views", "iceberg_views", "iceberg_table_partitions", "iceberg_schemas", "iceberg_created_tables", "syncer_states"},
+}
+
 // ---------------------------------------------------------------------------------------------------------------------
 
 type IcebergSchemaTable struct {
@@ -27,6 +43,11 @@ func (schemaTable IcebergSchemaTable) String() string {
 	return fmt.Sprintf(`"%s"."%s"`, schemaTable.Schema, schemaTable.Table)
 }
 
+// Orders tables by schema and name, e.g. to create them in DuckDB in the same order on every start
+func CompareIcebergSchemaTables(a IcebergSchemaTable, b IcebergSchemaTable) int {
+	return cmp.Or(strings.Compare(a.Schema, b.Schema), strings.Compare(a.Table, b.Table))
+}
+
 // ---------------------------------------------------------------------------------------------------------------------
 
 type IcebergMaterializedView struct {
@@ -44,6 +65,46 @@ func (view IcebergMaterializedView) ToIcebergSchemaTable() IcebergSchemaTable {
 
 // ---------------------------------------------------------------------------------------------------------------------
 
+// Created with CREATE VIEW, the definition is run each time the view is queried
+type IcebergView struct {
+	Schema     string
+	Table      string
+	Definition string
+}
+
+func (view IcebergView) ToIcebergSchemaTable() IcebergSchemaTable {
+	return IcebergSchemaTable{
+		Schema: view.Schema,
+		Table:  view.Table,
+	}
+}
+
+// ---------------------------------------------------------------------------------------------------------------------
+
+// Partition of a partitioned source table, synced as a separate Iceberg table and read together with the other partitions
+type IcebergTablePartition struct {
+	Schema         string
+	Table          string // Partitioned table
+	PartitionTable string
+	Columns        []CatalogTableColumn // Of the partition table
+}
+
+func (partition IcebergTablePartition) ToIcebergSchemaTable() IcebergSchemaTable {
+	return IcebergSchemaTable{
+		Schema: partition.Schema,
+		Table:  partition.Table,
+	}
+}
+
+func (partition IcebergTablePartition) ToPartitionIcebergSchemaTable() IcebergSchemaTable {
+	return IcebergSchemaTable{
+		Schema: partition.Schema,
+		Table:  partition.PartitionTable,
+	}
+}
+
+// ---------------------------------------------------------------------------------------------------------------------
+
 type IcebergCatalog struct {
 	Config *CommonConfig
 }
@@ -81,13 +142,36 @@ func (catalog *IcebergCatalog) SchemaTables() (Set[IcebergSchemaTable], error) {
 	return schemaTables, nil
 }
 
+// Schemas created with CREATE SCHEMA, the schemas of tables and materialized views aren't included
+func (catalog *IcebergCatalog) Schemas() (Set[string], error) {
+	pgClient := catalog.newPostgresClient()
+	defer pgClient.Close()
+
+	rows, err := pgClient.Query(context.Background(), "SELECT schema_name FROM iceberg_schemas")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	schemas := make(Set[string])
+	for rows.Next() {
+		var schema string
+		err := rows.Scan(&schema)
+		if err != nil {
+			return nil, err
+		}
+		schemas.Add(schema)
+	}
+	return schemas, nil
+}
+
 func (catalog *IcebergCatalog) MaterializedViews() ([]IcebergMaterializedView, error) {
 	pgClient := catalog.newPostgresClient()
 	defer pgClient.Close()
 
 	rows, err := pgClient.Query(
 		context.Background(),
-		"SELECT schema_name, table_name, definition FROM iceberg_materialized_views WHERE table_name NOT LIKE '%"+TEMP_TABLE_SUFFIX_SYNCING+"' AND table_name NOT LIKE '%"+TEMP_TABLE_SUFFIX_DELETING+"'",
+		"SELECT schema_name, table_name, definition FROM iceberg_materialized_views WHERE table_name NOT LIKE '%"+TEMP_TABLE_SUFFIX_SYNCING+"' AND table_name NOT LIKE '%"+TEMP_TABLE_SUFFIX_DELETING+"' ORDER BY schema_name, table_name",
 	)
 	if err != nil {
 		return nil, err
@@ -110,6 +194,64 @@ func (catalog *IcebergCatalog) MaterializedViews() ([]IcebergMaterializedView, e
 	return materializedViews, nil
 }
 
+func (catalog *IcebergCatalog) Views() ([]IcebergView, error) {
+	pgClient := catalog.newPostgresClient()
+	defer pgClient.Close()
+
+	rows, err := pgClient.Query(context.Background(), "SELECT schema_name, table_name, definition FROM iceberg_views ORDER BY schema_name, table_name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	views := []IcebergView{}
+	for rows.Next() {
+		var view IcebergView
+		err := rows.Scan(&view.Schema, &view.Table, &view.Definition)
+		if err != nil {
+			return nil, err
+		}
+		views = append(views, view)
+	}
+	return views, nil
+}
+
+// Partitions of synced tables, skipping partitions that are being synced or deleted
+func (catalog *IcebergCatalog) TablePartitions() ([]IcebergTablePartition, error) {
+	pgClient := catalog.newPostgresClient()
+	defer pgClient.Close()
+
+	rows, err := pgClient.Query(
+		context.Background(),
+		`SELECT iceberg_table_partitions.schema_name, iceberg_table_partitions.table_name, iceberg_table_partitions.partition_table_name, iceberg_tables.columns
+		FROM iceberg_table_partitions
+		JOIN iceberg_tables ON iceberg_tables.table_namespace = iceberg_table_partitions.schema_name AND iceberg_tables.table_name = iceberg_table_partitions.partition_table_name
+		ORDER BY iceberg_table_partitions.schema_name, iceberg_table_partitions.table_name, iceberg_table_partitions.partition_table_name`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	partitions := []IcebergTablePartition{}
+	for rows.Next() {
+		var partition IcebergTablePartition
+		var columnsJson []byte
+		err := rows.Scan(&partition.Schema, &partition.Table, &partition.PartitionTable, &columnsJson)
+		if err != nil {
+			return nil, err
+		}
+		if len(columnsJson) > 0 {
+			err = json.Unmarshal(columnsJson, &partition.Columns)
+			if err != nil {
+				return nil, err
+			}
+		}
+		partitions = append(partitions, partition)
+	}
+	return partitions, nil
+}
+
 func (catalog *IcebergCatalog) MaterializedView(icebergSchemaTable IcebergSchemaTable) (IcebergMaterializedView, error) {
 	pgClient := catalog.newPostgresClient()
 	defer pgClient.Close()
@@ -207,8 +349,40 @@ func (catalog *IcebergCatalog) TableS3Path(icebergTableName IcebergSchemaTable)
 	return strings.Split(metadataFileS3Path, "/metadata/")[0]
 }
 
+// Returns the last saved syncer state (e.g., Singer/Airbyte state) or nil if there is none
+func (catalog *IcebergCatalog) SyncerState(schemaName string, name string) []byte {
+	pgClient := catalog.newPostgresClient()
+	defer pgClient.Close()
+
+	var state []byte
+	err := pgClient.QueryRow(
+		context.Background(),
+		"SELECT state FROM syncer_states WHERE schema_name=$1 AND name=$2",
+		schemaName, name,
+	).Scan(&state)
+	if err != nil && err.Error() == "no rows in result set" {
+		return nil
+	}
+	PanicIfError(catalog.Config, err)
+
+	return state
+}
+
 // Write ---------------------------------------------------------------------------------------------------------------
 
+func (catalog *IcebergCatalog) UpsertSyncerState(schemaName string, name string, state []byte) {
+	pgClient := catalog.newPostgresClient()
+	defer pgClient.Close()
+
+	_, err := pgClient.Exec(
+		context.Background(),
+		`INSERT INTO syncer_states (schema_name, name, state, updated_at) VALUES ($1, $2, $3, NOW())
+		ON CONFLICT (schema_name, name) DO UPDATE SET state=EXCLUDED.state, updated_at=EXCLUDED.updated_at`,
+		schemaName, name, state,
+	)
+	PanicIfError(catalog.Config, err)
+}
+
 func (catalog *IcebergCatalog) CreateTable(icebergSchemaTable IcebergSchemaTable, metadataLocation string, icebergSchemaColumns []*IcebergSchemaColumn) {
 	pgClient := catalog.newPostgresClient()
 	defer pgClient.Close()
@@ -258,6 +432,118 @@ func (catalog *IcebergCatalog) DropTable(icebergSchemaTable IcebergSchemaTable)
 	PanicIfError(catalog.Config, err)
 }
 
+func (catalog *IcebergCatalog) DeleteSyncerState(schemaName string, name string) {
+	pgClient := catalog.newPostgresClient()
+	defer pgClient.Close()
+
+	_, err := pgClient.Exec(
+		context.Background(),
+		"DELETE FROM syncer_states WHERE schema_name=$1 AND name=$2",
+		schemaName, name,
+	)
+	PanicIfError(catalog.Config, err)
+}
+
+func (catalog *IcebergCatalog) CreateSchema(schema string, ifNotExists bool) error {
+	pgClient := catalog.newPostgresClient()
+	defer pgClient.Close()
+
+	var exists bool
+	err := pgClient.QueryRow(
+		context.Background(),
+		"SELECT EXISTS (SELECT 1 FROM iceberg_schemas WHERE schema_name=$1) OR EXISTS (SELECT 1 FROM iceberg_tables WHERE table_namespace=$1) OR EXISTS (SELECT 1 FROM iceberg_materialized_views WHERE schema_name=$1) OR EXISTS (SELECT 1 FROM iceberg_views WHERE schema_name=$1)",
+		schema,
+	).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("error checking schema existence: %w", err)
+	}
+	if exists {
+		if ifNotExists {
+			return nil
+		} else {
+			return fmt.Errorf("schema %s %w", schema, ErrAlreadyExists)
+		}
+	}
+
+	_, err = pgClient.Exec(
+		context.Background(),
+		"INSERT INTO iceberg_schemas (schema_name) VALUES ($1) ON CONFLICT DO NOTHING",
+		schema,
+	)
+	return err
+}
+
+// Rows written and rejected by a sync of the table, e.g. to alert on rejected rows
+func (catalog *IcebergCatalog) AddSyncRun(icebergSchemaTable IcebergSchemaTable, rowCount int64, rejectedRowCount int64) error {
+	pgClient := catalog.newPostgresClient()
+	defer pgClient.Close()
+
+	_, err := pgClient.Exec(
+		context.Background(),
+		"INSERT INTO sync_runs (schema_name, table_name, row_count, rejected_row_count) VALUES ($1, $2, $3, $4)",
+		icebergSchemaTable.Schema,
+		icebergSchemaTable.Table,
+		rowCount,
+		rejectedRowCount,
+	)
+	return err
+}
+
+// Tables created with CREATE TABLE ... AS, which can be renamed and dropped unlike synced tables
+func (catalog *IcebergCatalog) IsCreatedTable(icebergSchemaTable IcebergSchemaTable) (bool, error) {
+	pgClient := catalog.newPostgresClient()
+	defer pgClient.Close()
+
+	var exists bool
+	err := pgClient.QueryRow(
+		context.Background(),
+		"SELECT EXISTS (SELECT 1 FROM iceberg_created_tables WHERE schema_name=$1 AND table_name=$2)",
+		icebergSchemaTable.Schema,
+		icebergSchemaTable.Table,
+	).Scan(&exists)
+	return exists, err
+}
+
+func (catalog *IcebergCatalog) AddCreatedTable(icebergSchemaTable IcebergSchemaTable) error {
+	pgClient := catalog.newPostgresClient()
+	defer pgClient.Close()
+
+	_, err := pgClient.Exec(
+		context.Background(),
+		"INSERT INTO iceberg_created_tables (schema_name, table_name) VALUES ($1, $2) ON CONFLICT DO NOTHING",
+		icebergSchemaTable.Schema,
+		icebergSchemaTable.Table,
+	)
+	return err
+}
+
+func (catalog *IcebergCatalog) RenameCreatedTable(icebergSchemaTable IcebergSchemaTable, newName string) error {
+	pgClient := catalog.newPostgresClient()
+	defer pgClient.Close()
+
+	_, err := pgClient.Exec(
+		context.Background(),
+		"UPDATE iceberg_created_tables SET table_name=$1 WHERE schema_name=$2 AND table_name=$3",
+		newName,
+		icebergSchemaTable.Schema,
+		icebergSchemaTable.Table,
+	)
+	return err
+}
+
+func (catalog *IcebergCatalog) DropCreatedTable(icebergSchemaTable IcebergSchemaTable) error {
+	pgClient := catalog.newPostgresClient()
+	defer pgClient.Close()
+
+	_, err := pgClient.Exec(
+		context.Background(),
+		"DELETE FROM iceberg_created_tables WHERE schema_name=$1 AND table_name=$2",
+		icebergSchemaTable.Schema,
+		icebergSchemaTable.Table,
+	)
+	return err
+}
+
 func (catalog *IcebergCatalog) CreateMaterializedView(icebergSchemaTable IcebergSchemaTable, definition string, ifNotExists bool) error {
 	pgClient := catalog.newPostgresClient()
 	defer pgClient.Close()
@@ -270,7 +556,7 @@ func (catalog *IcebergCatalog) CreateMaterializedView(icebergSchemaTable Iceberg
 		if ifNotExists {
 			return nil
 		} else {
-			return fmt.Errorf("materialized view %s already exists", icebergSchemaTable.String())
+			return fmt.Errorf("materialized view %s %w", icebergSchemaTable.String(), ErrAlreadyExists)
 		}
 	}
 
@@ -337,6 +623,70 @@ func (catalog *IcebergCatalog) DropMaterializedView(icebergSchemaTable IcebergSc
 	return err
 }
 
+// CREATE OR REPLACE VIEW replaces the definition of an existing view
+func (catalog *IcebergCatalog) CreateView(icebergSchemaTable IcebergSchemaTable, definition string, orReplace bool) error {
+	pgClient := catalog.newPostgresClient()
+	defer pgClient.Close()
+
+	query := "INSERT INTO iceberg_views (schema_name, table_name, definition) VALUES ($1, $2, $3)"
+	if orReplace {
+		query += " ON CONFLICT (schema_name, table_name) DO UPDATE SET definition=EXCLUDED.definition"
+	}
+	_, err := pgClient.Exec(context.Background(), query, icebergSchemaTable.Schema, icebergSchemaTable.Table, definition)
+	if err != nil && strings.Contains(err.Error(), "duplicate key value violates unique constraint") {
+		return fmt.Errorf("view %s %w", icebergSchemaTable.String(), ErrAlreadyExists)
+	}
+	return err
+}
+
+func (catalog *IcebergCatalog) DropView(icebergSchemaTable IcebergSchemaTable, missingOk bool) error {
+	pgClient := catalog.newPostgresClient()
+	defer pgClient.Close()
+
+	result, err := pgClient.Exec(
+		context.Background(),
+		"DELETE FROM iceberg_views WHERE schema_name=$1 AND table_name=$2",
+		icebergSchemaTable.Schema, icebergSchemaTable.Table,
+	)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 && !missingOk {
+		return fmt.Errorf("view %s does not exist", icebergSchemaTable.String())
+	}
+	return nil
+}
+
+// Replaces the partitions of the synced tables in the schema, partition table name -> partitioned table name
+func (catalog *IcebergCatalog) ReplaceTablePartitions(schema string, partitionedTableNames map[string]string) error {
+	ctx := context.Background()
+	pgClient := catalog.newPostgresClient()
+	defer pgClient.Close()
+
+	tx, err := pgClient.Conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, "DELETE FROM iceberg_table_partitions WHERE schema_name=$1", schema)
+	if err != nil {
+		return err
+	}
+	for partitionTableName, tableName := range partitionedTableNames {
+		_, err = tx.Exec(
+			ctx,
+			"INSERT INTO iceberg_table_partitions (schema_name, table_name, partition_table_name) VALUES ($1, $2, $3)",
+			schema, tableName, partitionTableName,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
 func (catalog *IcebergCatalog) doesMaterializedViewExist(pgClient *PostgresClient, icebergSchemaTable IcebergSchemaTable) (bool, error) {
 	var exists bool
 	err := pgClient.QueryRow(
@@ -355,6 +705,267 @@ func (catalog *IcebergCatalog) doesMaterializedViewExist(pgClient *PostgresClien
 	return exists, nil
 }
 
+// Backup --------------------------------------------------------------------------------------------------------------
+
+// Everything BemiDB keeps in the catalog database. The table data and metadata files stay in S3 and are referenced by location
+type CatalogBackup struct {
+	Version           int                             `json:"version"`
+	CreatedAt         time.Time                       `json:"createdAt"`
+	Tables            []CatalogBackupTable            `json:"tables"`
+	MaterializedViews []CatalogBackupMaterializedView `json:"materializedViews"`
+	SyncerStates      []CatalogBackupSyncerState      `json:"syncerStates"`
+	Schemas           []string                        `json:"schemas,omitempty"`         // Since version 2
+	Views             []CatalogBackupView             `json:"views,omitempty"`           // Since version 2
+	TablePartitions   []CatalogBackupTablePartition   `json:"tablePartitions,omitempty"` // Since version 2
+	CreatedTables     []CatalogBackupCreatedTable     `json:"createdTables,omitempty"`   // Since version 2
+}
+
+type CatalogBackupTable struct {
+	Schema           string          `json:"schema"`
+	Table            string          `json:"table"`
+	MetadataLocation *string         `json:"metadataLocation"`
+	Columns          json.RawMessage `json:"columns"`
+}
+
+type CatalogBackupMaterializedView struct {
+	Schema     string `json:"schema"`
+	Table      string `json:"table"`
+	Definition string `json:"definition"`
+}
+
+type CatalogBackupView struct {
+	Schema     string `json:"schema"`
+	Table      string `json:"table"`
+	Definition string `json:"definition"`
+}
+
+type CatalogBackupTablePartition struct {
+	Schema         string `json:"schema"`
+	Table          string `json:"table"`
+	PartitionTable string `json:"partitionTable"`
+}
+
+type CatalogBackupCreatedTable struct {
+	Schema string `json:"schema"`
+	Table  string `json:"table"`
+}
+
+type CatalogBackupSyncerState struct {
+	Schema    string          `json:"schema"`
+	Name      string          `json:"name"`
+	State     json.RawMessage `json:"state"`
+	UpdatedAt time.Time       `json:"updatedAt"`
+}
+
+// Reads the catalog in a single snapshot, skipping tables that are being synced or deleted
+func (catalog *IcebergCatalog) Backup() (CatalogBackup, error) {
+	ctx := context.Background()
+	pgClient := catalog.newPostgresClient()
+	defer pgClient.Close()
+
+	tx, err := pgClient.Conn.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return CatalogBackup{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	backup := CatalogBackup{Version: CATALOG_BACKUP_VERSION, CreatedAt: time.Now().UTC()}
+
+	rows, err := tx.Query(
+		ctx,
+		"SELECT table_namespace, table_name, metadata_location, columns FROM iceberg_tables WHERE table_name NOT LIKE '%"+TEMP_TABLE_SUFFIX_SYNCING+"' AND table_name NOT LIKE '%"+TEMP_TABLE_SUFFIX_DELETING+"' ORDER BY table_namespace, table_name",
+	)
+	if err != nil {
+		return CatalogBackup{}, err
+	}
+	backup.Tables, err = pgx.CollectRows(rows, func(row pgx.CollectableRow) (CatalogBackupTable, error) {
+		var table CatalogBackupTable
+		err := row.Scan(&table.Schema, &table.Table, &table.MetadataLocation, &table.Columns)
+		return table, err
+	})
+	if err != nil {
+		return CatalogBackup{}, err
+	}
+
+	rows, err = tx.Query(
+		ctx,
+		"SELECT schema_name, table_name, definition FROM iceberg_materialized_views WHERE table_name NOT LIKE '%"+TEMP_TABLE_SUFFIX_SYNCING+"' AND table_name NOT LIKE '%"+TEMP_TABLE_SUFFIX_DELETING+"' ORDER BY schema_name, table_name",
+	)
+	if err != nil {
+		return CatalogBackup{}, err
+	}
+	backup.MaterializedViews, err = pgx.CollectRows(rows, func(row pgx.CollectableRow) (CatalogBackupMaterializedView, error) {
+		var materializedView CatalogBackupMaterializedView
+		err := row.Scan(&materializedView.Schema, &materializedView.Table, &materializedView.Definition)
+		return materializedView, err
+	})
+	if err != nil {
+		return CatalogBackup{}, err
+	}
+
+	rows, err = tx.Query(ctx, "SELECT schema_name, table_name, definition FROM iceberg_views ORDER BY schema_name, table_name")
+	if err != nil {
+		return CatalogBackup{}, err
+	}
+	backup.Views, err = pgx.CollectRows(rows, func(row pgx.CollectableRow) (CatalogBackupView, error) {
+		var view CatalogBackupView
+		err := row.Scan(&view.Schema, &view.Table, &view.Definition)
+		return view, err
+	})
+	if err != nil {
+		return CatalogBackup{}, err
+	}
+
+	rows, err = tx.Query(ctx, "SELECT schema_name, table_name, partition_table_name FROM iceberg_table_partitions ORDER BY schema_name, table_name, partition_table_name")
+	if err != nil {
+		return CatalogBackup{}, err
+	}
+	backup.TablePartitions, err = pgx.CollectRows(rows, func(row pgx.CollectableRow) (CatalogBackupTablePartition, error) {
+		var tablePartition CatalogBackupTablePartition
+		err := row.Scan(&tablePartition.Schema, &tablePartition.Table, &tablePartition.PartitionTable)
+		return tablePartition, err
+	})
+	if err != nil {
+		return CatalogBackup{}, err
+	}
+
+	rows, err = tx.Query(ctx, "SELECT schema_name FROM iceberg_schemas ORDER BY schema_name")
+	if err != nil {
+		return CatalogBackup{}, err
+	}
+	backup.Schemas, err = pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return CatalogBackup{}, err
+	}
+
+	rows, err = tx.Query(ctx, "SELECT schema_name, table_name FROM iceberg_created_tables ORDER BY schema_name, table_name")
+	if err != nil {
+		return CatalogBackup{}, err
+	}
+	backup.CreatedTables, err = pgx.CollectRows(rows, func(row pgx.CollectableRow) (CatalogBackupCreatedTable, error) {
+		var createdTable CatalogBackupCreatedTable
+		err := row.Scan(&createdTable.Schema, &createdTable.Table)
+		return createdTable, err
+	})
+	if err != nil {
+		return CatalogBackup{}, err
+	}
+
+	rows, err = tx.Query(ctx, "SELECT schema_name, name, state, updated_at FROM syncer_states ORDER BY schema_name, name")
+	if err != nil {
+		return CatalogBackup{}, err
+	}
+	backup.SyncerStates, err = pgx.CollectRows(rows, func(row pgx.CollectableRow) (CatalogBackupSyncerState, error) {
+		var syncerState CatalogBackupSyncerState
+		err := row.Scan(&syncerState.Schema, &syncerState.Name, &syncerState.State, &syncerState.UpdatedAt)
+		return syncerState, err
+	})
+	if err != nil {
+		return CatalogBackup{}, err
+	}
+
+	return backup, nil
+}
+
+// Replaces the catalog tables contained in the backup in a single transaction
+func (catalog *IcebergCatalog) Restore(backup CatalogBackup) error {
+	backupTables, ok := CATALOG_BACKUP_TABLES_BY_VERSION[backup.Version]
+	if !ok {
+		return fmt.Errorf("unsupported catalog backup version %d, expected %d or lower", backup.Version, CATALOG_BACKUP_VERSION)
+	}
+
+	ctx := context.Background()
+	pgClient := catalog.newPostgresClient()
+	defer pgClient.Close()
+
+	tx, err := pgClient.Conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	for _, table := range backupTables {
+		_, err = tx.Exec(ctx, "DELETE FROM "+table)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, table := range backup.Tables {
+		_, err = tx.Exec(
+			ctx,
+			"INSERT INTO iceberg_tables (table_namespace, table_name, metadata_location, columns) VALUES ($1, $2, $3, $4)",
+			table.Schema, table.Table, table.MetadataLocation, nullableJson(table.Columns),
+		)
+		if err != nil {
+			return err
+		}
+	}
+	for _, materializedView := range backup.MaterializedViews {
+		_, err = tx.Exec(
+			ctx,
+			"INSERT INTO iceberg_materialized_views (schema_name, table_name, definition) VALUES ($1, $2, $3)",
+			materializedView.Schema, materializedView.Table, materializedView.Definition,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	for _, view := range backup.Views {
+		_, err = tx.Exec(
+			ctx,
+			"INSERT INTO iceberg_views (schema_name, table_name, definition) VALUES ($1, $2, $3)",
+			view.Schema, view.Table, view.Definition,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	for _, tablePartition := range backup.TablePartitions {
+		_, err = tx.Exec(
+			ctx,
+			"INSERT INTO iceberg_table_partitions (schema_name, table_name, partition_table_name) VALUES ($1, $2, $3)",
+			tablePartition.Schema, tablePartition.Table, tablePartition.PartitionTable,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	for _, schema := range backup.Schemas {
+		_, err = tx.Exec(ctx, "INSERT INTO iceberg_schemas (schema_name) VALUES ($1)", schema)
+		if err != nil {
+			return err
+		}
+	}
+	for _, createdTable := range backup.CreatedTables {
+		_, err = tx.Exec(ctx, "INSERT INTO iceberg_created_tables (schema_name, table_name) VALUES ($1, $2)", createdTable.Schema, createdTable.Table)
+		if err != nil {
+			return err
+		}
+	}
+	for _, syncerState := range backup.SyncerStates {
+		_, err = tx.Exec(
+			ctx,
+			"INSERT INTO syncer_states (schema_name, name, state, updated_at) VALUES ($1, $2, $3, $4)",
+			syncerState.Schema, syncerState.Name, syncerState.State, syncerState.UpdatedAt,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+// JSON null or a missing value -> SQL NULL. A string instead of bytes, which are sent as bytea with the simple protocol, e.g. through PgBouncer
+func nullableJson(value json.RawMessage) *string {
+	if len(value) == 0 || string(value) == "null" {
+		return nil
+	}
+	jsonString := string(value)
+	return &jsonString
+}
+
 // ---------------------------------------------------------------------------------------------------------------------
 
 func (catalog *IcebergCatalog) newPostgresClient() *PostgresClient {
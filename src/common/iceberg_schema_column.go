@@ -3,10 +3,12 @@ package common
 import (
 	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"math"
 	"math/big"
 	"reflect"
+	"strconv"
 	"strings"
 	"time"
 
@@ -45,11 +47,16 @@ const (
 )
 
 type CatalogTableColumn struct {
-	Name     string `json:"name"`
-	Type     string `json:"type"`
-	Position int    `json:"position"`
-	List     bool   `json:"list"`
-	Required bool   `json:"required"`
+	Name                 string `json:"name"`
+	Type                 string `json:"type"`
+	Position             int    `json:"position"`
+	List                 bool   `json:"list"`
+	Required             bool   `json:"required"`
+	Default              string `json:"default,omitempty"`               // Source default expression
+	GenerationExpression string `json:"generation_expression,omitempty"` // Source generated column expression
+	TypeModifier         int    `json:"type_modifier,omitempty"`         // Source atttypmod (e.g., numeric precision and scale), -1 if unconstrained
+	ReferencedTable      string `json:"referenced_table,omitempty"`      // Source single-column foreign key table in the same schema
+	ReferencedColumn     string `json:"referenced_column,omitempty"`     // Source single-column foreign key column
 }
 
 func (tableColumn CatalogTableColumn) ToSql() string {
@@ -94,17 +101,22 @@ func (tableColumn CatalogTableColumn) ToMetadataFieldMap() map[string]interface{
 // ---------------------------------------------------------------------------------------------------------------------
 
 type IcebergSchemaColumn struct {
-	Config              *CommonConfig
-	ColumnName          string
-	ColumnType          IcebergColumnType
-	LogicalColumnType   IcebergLogicalColumnType
-	Position            int
-	NumericPrecision    int
-	NumericScale        int
-	DatetimePrecision   int
-	IsList              bool
-	IsRequired          bool
-	IsPartOfUniqueIndex bool
+	Config               *CommonConfig
+	ColumnName           string
+	ColumnType           IcebergColumnType
+	LogicalColumnType    IcebergLogicalColumnType
+	Position             int
+	NumericPrecision     int
+	NumericScale         int
+	DatetimePrecision    int
+	IsList               bool
+	IsRequired           bool
+	IsPartOfUniqueIndex  bool
+	DefaultValue         string // optional
+	GenerationExpression string // optional
+	TypeModifier         int    // optional
+	ReferencedTable      string // optional
+	ReferencedColumn     string // optional
 }
 
 func (col *IcebergSchemaColumn) NormalizedColumnName() string {
@@ -131,10 +143,15 @@ func (col *IcebergSchemaColumn) NormalizedScale() int {
 
 func (col *IcebergSchemaColumn) CatalogTableColumn() CatalogTableColumn {
 	catalogTableColumn := CatalogTableColumn{
-		Name:     col.NormalizedColumnName(),
-		Position: col.Position,
-		Required: col.IsRequired,
-		List:     col.IsList,
+		Name:                 col.NormalizedColumnName(),
+		Position:             col.Position,
+		Required:             col.IsRequired,
+		List:                 col.IsList,
+		Default:              col.DefaultValue,
+		GenerationExpression: col.GenerationExpression,
+		TypeModifier:         col.TypeModifier,
+		ReferencedTable:      col.ReferencedTable,
+		ReferencedColumn:     col.ReferencedColumn,
 	}
 
 	switch col.ColumnType {
@@ -207,9 +224,10 @@ func (col *IcebergSchemaColumn) DuckdbType() string {
 	return duckdbType
 }
 
-func (col *IcebergSchemaColumn) DuckdbValueFromCsv(value string) interface{} {
+// Returns an error if the value can't be converted to the column type, e.g. an invalid date
+func (col *IcebergSchemaColumn) DuckdbValueFromCsv(value string) (interface{}, error) {
 	if value == BEMIDB_NULL_STRING {
-		return nil
+		return nil, nil
 	}
 
 	if col.IsList {
@@ -218,123 +236,185 @@ func (col *IcebergSchemaColumn) DuckdbValueFromCsv(value string) interface{} {
 		csvString := strings.TrimPrefix(value, "{")
 		csvString = strings.TrimSuffix(csvString, "}")
 		if csvString == "" {
-			return values
+			return values, nil
 		}
 
 		csvString = strings.ReplaceAll(csvString, "\\\"", "\"\"") // Replace escaped double quotes with double quotes according to CSV format rules
 		csvReader := csv.NewReader(strings.NewReader(csvString))
 		stringValues, err := csvReader.Read()
-		PanicIfError(col.Config, err)
+		if err != nil {
+			return nil, fmt.Errorf("invalid array value %s in column %s: %w", value, col.ColumnName, err)
+		}
 
 		for _, stringValue := range stringValues {
-			primitiveValue := col.duckdbPrimitiveValueFromCsv(stringValue)
+			primitiveValue, err := col.duckdbPrimitiveValueFromCsv(stringValue)
+			if err != nil {
+				return nil, err
+			}
 			values = append(values, primitiveValue)
 		}
-		return values
+		return values, nil
 	}
 
 	return col.duckdbPrimitiveValueFromCsv(value)
 }
 
-func (col *IcebergSchemaColumn) DuckdbValueFromJson(value any) interface{} {
+// Returns an error if the value can't be converted to the column type, e.g. an invalid date
+func (col *IcebergSchemaColumn) DuckdbValueFromJson(value any) (interface{}, error) {
 	if value == nil {
-		return nil
+		return nil, nil
 	}
 
 	if col.IsList {
+		itemValues, ok := value.([]any)
+		if !ok {
+			return nil, col.unsupportedValueError(value)
+		}
+
 		var values []interface{}
-		for _, itemValue := range value.([]any) {
-			primitiveValue := col.duckdbPrimitiveValueFromJson(itemValue)
+		for _, itemValue := range itemValues {
+			primitiveValue, err := col.duckdbPrimitiveValueFromJson(itemValue)
+			if err != nil {
+				return nil, err
+			}
 			values = append(values, primitiveValue)
 		}
-		return values
+		return values, nil
 	}
 
 	return col.duckdbPrimitiveValueFromJson(value)
 }
 
-func (col *IcebergSchemaColumn) duckdbPrimitiveValueFromCsv(value string) interface{} {
+func (col *IcebergSchemaColumn) duckdbPrimitiveValueFromCsv(value string) (interface{}, error) {
 	switch col.ColumnType {
 	case IcebergColumnTypeBoolean:
-		return value == "t"
+		return value == "t", nil
 	case IcebergColumnTypeString:
-		return value
+		return value, nil
 	case IcebergColumnTypeBinary:
-		return []byte(value)
+		return []byte(value), nil
 	case IcebergColumnTypeInteger:
-		return int32(StringToInt(value))
+		intValue, err := strconv.ParseInt(value, 10, 32)
+		if err != nil {
+			return nil, col.invalidValueError(value, err)
+		}
+		return int32(intValue), nil
 	case IcebergColumnTypeLong:
-		return StringToInt64(value)
+		int64Value, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, col.invalidValueError(value, err)
+		}
+		return int64Value, nil
 	case IcebergColumnTypeFloat:
-		valueFloat := StringToFloat64(value)
+		valueFloat, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, col.invalidValueError(value, err)
+		}
 		if math.IsNaN(valueFloat) {
-			return PARQUET_NAN
+			return PARQUET_NAN, nil
 		}
-		return float32(valueFloat)
+		return float32(valueFloat), nil
 	case IcebergColumnTypeDouble:
-		valueFloat := StringToFloat64(value)
+		valueFloat, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, col.invalidValueError(value, err)
+		}
 		if math.IsNaN(valueFloat) {
-			return PARQUET_NAN
+			return PARQUET_NAN, nil
 		}
-		return valueFloat
+		return valueFloat, nil
 	case IcebergColumnTypeDecimal:
 		switch col.LogicalColumnType {
 		case IcebergLogicalColumnTypeInterval:
-			microseconds := 0
-
-			parts := strings.Split(value, " ")
-			for i, part := range parts {
-				if strings.HasPrefix(part, "year") {
-					Panic(col.Config, "Year intervals are not supported yet")
-				} else if strings.HasPrefix(part, "mon") {
-					months := StringToInt(parts[i-1])
-					microseconds += months * 30_437_500 * 24 * 60 * 60 // Approximation: 30.4375 days per month
-				} else if strings.HasPrefix(part, "day") {
-					days := StringToInt(parts[i-1])
-					microseconds += days * 24 * 60 * 60 * 1_000_000
-				} else if strings.Contains(part, ":") {
-					timeParts := strings.Split(part, ":")
-					hours := StringToInt(timeParts[0])
-					minutes := StringToInt(timeParts[1])
-					secondsParts := strings.Split(timeParts[2], ".")
-					seconds := StringToInt(secondsParts[0])
-					microseconds += (hours * 60 * 60 * 1_000_000) + (minutes * 60 * 1_000_000) + (seconds * 1_000_000)
-					if len(secondsParts) > 1 && len(secondsParts[1]) == 6 {
-						microseconds += StringToInt(secondsParts[1])
-					}
-				}
+			microseconds, err := col.intervalMicroseconds(value)
+			if err != nil {
+				return nil, err
 			}
-			valueMicrosecondsString := IntToString(microseconds)
-			return col.duckdbDecimal(valueMicrosecondsString)
+			return col.duckdbDecimal(Int64ToString(microseconds))
 		default:
 			return col.duckdbDecimal(value)
 		}
 	case IcebergColumnTypeDate:
-		return StringDateToTime(value)
+		parsedTime, err := StringDateToTime(value)
+		if err != nil {
+			return nil, col.invalidValueError(value, err)
+		}
+		return parsedTime, nil
 	case IcebergColumnTypeTime:
 		parsedTime, err := time.Parse("15:04:05.999999", value)
-		PanicIfError(col.Config, err)
-		return parsedTime
+		if err != nil {
+			return nil, col.invalidValueError(value, err)
+		}
+		return parsedTime, nil
 	case IcebergColumnTypeTimeTz:
 		parsedTime, err := time.Parse("15:04:05.999999-07", value)
-		PanicIfError(col.Config, err)
-		return parsedTime
+		if err != nil {
+			return nil, col.invalidValueError(value, err)
+		}
+		return parsedTime, nil
 	case IcebergColumnTypeTimestamp:
 		parsedTimestamp, err := time.Parse("2006-01-02 15:04:05.999999", value)
 		if err != nil {
 			parsedTimestamp, err = time.Parse("2006-01-02 15:04:05.999999-07:00", value)
 			if err != nil {
 				parsedTimestamp, err = time.Parse("2006-01-02 15:04:05.999999-07", value)
-				PanicIfError(col.Config, err)
+				if err != nil {
+					return nil, col.invalidValueError(value, err)
+				}
 			}
 		}
-		return parsedTimestamp
+		return parsedTimestamp, nil
 	}
 
-	panic("Unsupported value: " + value + " for column type: " + string(col.ColumnType))
+	return nil, col.unsupportedValueError(value)
 }
 
-func (col *IcebergSchemaColumn) duckdbPrimitiveValueFromJson(value any) interface{} {
+// "1 mon 2 days 03:04:05.000006" -> microseconds, with 30.4375 days per month
+func (col *IcebergSchemaColumn) intervalMicroseconds(value string) (int64, error) {
+	var microseconds int64
+
+	parts := strings.Split(value, " ")
+	for i, part := range parts {
+		if strings.HasPrefix(part, "year") {
+			return 0, fmt.Errorf("year intervals are not supported yet: %s in column %s", value, col.ColumnName)
+		} else if strings.HasPrefix(part, "mon") && i > 0 {
+			months, err := strconv.ParseInt(parts[i-1], 10, 64)
+			if err != nil {
+				return 0, col.invalidValueError(value, err)
+			}
+			microseconds += months * 30_437_500 * 24 * 60 * 60 // Approximation: 30.4375 days per month
+		} else if strings.HasPrefix(part, "day") && i > 0 {
+			days, err := strconv.ParseInt(parts[i-1], 10, 64)
+			if err != nil {
+				return 0, col.invalidValueError(value, err)
+			}
+			microseconds += days * 24 * 60 * 60 * 1_000_000
+		} else if strings.Contains(part, ":") {
+			timeParts := strings.Split(part, ":")
+			if len(timeParts) != 3 {
+				return 0, fmt.Errorf("invalid interval value %s in column %s", value, col.ColumnName)
+			}
+			secondsParts := strings.Split(timeParts[2], ".")
+			hours, hoursErr := strconv.ParseInt(timeParts[0], 10, 64)
+			minutes, minutesErr := strconv.ParseInt(timeParts[1], 10, 64)
+			seconds, secondsErr := strconv.ParseInt(secondsParts[0], 10, 64)
+			if err := errors.Join(hoursErr, minutesErr, secondsErr); err != nil {
+				return 0, col.invalidValueError(value, err)
+			}
+			microseconds += (hours * 60 * 60 * 1_000_000) + (minutes * 60 * 1_000_000) + (seconds * 1_000_000)
+			if len(secondsParts) > 1 && len(secondsParts[1]) == 6 {
+				fraction, err := strconv.ParseInt(secondsParts[1], 10, 64)
+				if err != nil {
+					return 0, col.invalidValueError(value, err)
+				}
+				microseconds += fraction
+			}
+		}
+	}
+	return microseconds, nil
+}
+
+func (col *IcebergSchemaColumn) duckdbPrimitiveValueFromJson(value any) (interface{}, error) {
 	kind := reflect.TypeOf(value).Kind()
 
 	switch col.ColumnType {
@@ -345,96 +425,124 @@ func (col *IcebergSchemaColumn) duckdbPrimitiveValueFromJson(value any) interfac
 		switch kind {
 		case reflect.Bool:
 			if value.(bool) {
-				return 1
+				return 1, nil
 			} else {
-				return 0
+				return 0, nil
 			}
 		case reflect.String:
 			if value.(string) == "NaN" {
-				return PARQUET_NAN
+				return PARQUET_NAN, nil
 			}
 		default:
-			return value
+			return value, nil
 		}
 	case IcebergColumnTypeDecimal:
-		valueString := Float64ToString(value.(float64))
-		return col.duckdbDecimal(valueString)
+		valueFloat, ok := value.(float64)
+		if !ok {
+			return nil, col.unsupportedValueError(value)
+		}
+		return col.duckdbDecimal(Float64ToString(valueFloat))
 	case IcebergColumnTypeBinary:
-		return []byte("\\x" + value.(string))
+		valueString, ok := value.(string)
+		if !ok {
+			return nil, col.unsupportedValueError(value)
+		}
+		return []byte("\\x" + valueString), nil
 	case IcebergColumnTypeBoolean:
 		switch kind {
 		case reflect.String:
-			return value.(string) == "true"
+			return value.(string) == "true", nil
 		default:
-			return value
+			return value, nil
 		}
 	case IcebergColumnTypeString:
 		switch col.LogicalColumnType {
 		case IcebergLogicalColumnTypeBpchar:
-			return strings.TrimRight(value.(string), " ")
+			if valueString, ok := value.(string); ok {
+				return strings.TrimRight(valueString, " "), nil
+			}
 		case IcebergLogicalColumnTypePoint:
-			valueMap := value.(map[string]interface{})
-			return "(" + Float64ToString(valueMap["x"].(float64)) + "," + Float64ToString(valueMap["y"].(float64)) + ")"
+			valueMap, _ := value.(map[string]interface{})
+			x, xOk := valueMap["x"].(float64)
+			y, yOk := valueMap["y"].(float64)
+			if !xOk || !yOk {
+				return nil, col.unsupportedValueError(value)
+			}
+			return "(" + Float64ToString(x) + "," + Float64ToString(y) + ")", nil
 		case IcebergLogicalColumnTypeUserDefined:
-			valueString := value.(string)
-			valueDecodedHex, err := HexToString(valueString)
-			if err == nil {
-				return valueDecodedHex
-			} else {
-				return valueString
+			if valueString, ok := value.(string); ok {
+				valueDecodedHex, err := HexToString(valueString)
+				if err == nil {
+					return valueDecodedHex, nil
+				} else {
+					return valueString, nil
+				}
 			}
 		}
 
 		switch kind {
 		case reflect.Map:
 			jsonBytes, err := json.Marshal(value)
-			PanicIfError(col.Config, err)
-			return string(jsonBytes)
+			if err != nil {
+				return nil, col.invalidValueError(fmt.Sprint(value), err)
+			}
+			return string(jsonBytes), nil
 		case reflect.Float64:
-			return Float64ToString(value.(float64))
+			return Float64ToString(value.(float64)), nil
 		default:
-			return value
+			return value, nil
 		}
 	case IcebergColumnTypeDate:
 		switch kind {
 		case reflect.String:
 			valueString := value.(string)
 			if valueString == "" {
-				return nil
+				return nil, nil
+			}
+			parsedTime, err := StringDateToTime(valueString)
+			if err != nil {
+				return nil, col.invalidValueError(valueString, err)
 			}
-			return StringDateToTime(valueString)
+			return parsedTime, nil
 		case reflect.Float64:
 			days := value.(float64)
-			return time.Unix(0, 0).UTC().AddDate(0, 0, int(days))
-		default:
-			Panic(col.Config, fmt.Sprintf("Unsupported value: %v for column type: %s", value, col.ColumnType))
+			return time.Unix(0, 0).UTC().AddDate(0, 0, int(days)), nil
 		}
 	case IcebergColumnTypeTime:
+		valueFloat, ok := value.(float64)
+		if !ok {
+			return nil, col.unsupportedValueError(value)
+		}
 		var nanoseconds int64
 		if col.DatetimePrecision == 6 {
-			nanoseconds = int64(value.(float64)) * 1_000
+			nanoseconds = int64(valueFloat) * 1_000
 		} else {
-			nanoseconds = int64(value.(float64)) * 1_000_000
+			nanoseconds = int64(valueFloat) * 1_000_000
 		}
 		valueTime := time.Unix(0, nanoseconds).UTC()
-		return valueTime
+		return valueTime, nil
 	case IcebergColumnTypeTimeTz:
-		valueString := value.(string)
+		valueString, ok := value.(string)
+		if !ok {
+			return nil, col.unsupportedValueError(value)
+		}
 		if valueString == "" {
-			return nil
+			return nil, nil
 		}
 		if strings.HasSuffix(valueString, "Z") {
 			valueString = strings.TrimSuffix(valueString, "Z") + "-00"
 		}
 		parsedTime, err := time.Parse("15:04:05.999999-07", valueString)
-		PanicIfError(col.Config, err)
-		return parsedTime
+		if err != nil {
+			return nil, col.invalidValueError(valueString, err)
+		}
+		return parsedTime, nil
 	case IcebergColumnTypeTimestamp:
 		switch kind {
 		case reflect.String:
 			valueString := value.(string)
 			if valueString == "" {
-				return nil
+				return nil, nil
 			}
 			valueString = strings.Replace(valueString, " ", "T", 1) // Amplitude
 			valueString = strings.TrimSuffix(valueString, "Z")
@@ -443,28 +551,28 @@ func (col *IcebergSchemaColumn) duckdbPrimitiveValueFromJson(value any) interfac
 				parsedTimestamp, err = time.Parse("2006-01-02T15:04:05.999999-07:00", valueString)
 				if err != nil {
 					parsedTimestamp, err = time.Parse("2006-01-02T15:04:05.999999-07", valueString)
-					PanicIfError(col.Config, err)
+					if err != nil {
+						return nil, col.invalidValueError(valueString, err)
+					}
 				}
 			}
-			return parsedTimestamp
+			return parsedTimestamp, nil
 		case reflect.Float64:
 			valueFloat := value.(float64)
 			epoch := time.Unix(0, 0).UTC()
 			if col.DatetimePrecision == 6 {
 				microseconds := int64(valueFloat)
-				return epoch.Add(time.Duration(microseconds) * time.Microsecond)
+				return epoch.Add(time.Duration(microseconds) * time.Microsecond), nil
 			}
 			milliseconds := int64(valueFloat)
-			return epoch.Add(time.Duration(milliseconds) * time.Millisecond)
-		default:
-			Panic(col.Config, fmt.Sprintf("Unsupported value: %v for column type: %s", value, col.ColumnType))
+			return epoch.Add(time.Duration(milliseconds) * time.Millisecond), nil
 		}
 	}
 
-	panic(fmt.Sprintf("Unsupported value: %v for column type: %s", value, col.ColumnType))
+	return nil, col.unsupportedValueError(value)
 }
 
-func (col *IcebergSchemaColumn) duckdbDecimal(value string) duckdb.Decimal {
+func (col *IcebergSchemaColumn) duckdbDecimal(value string) (duckdb.Decimal, error) {
 	scale := col.NormalizedScale()
 	parts := strings.Split(value, ".")
 	integerPart := parts[0]
@@ -482,15 +590,25 @@ func (col *IcebergSchemaColumn) duckdbDecimal(value string) duckdb.Decimal {
 	decimalValue := new(big.Int)
 
 	if len(integerPart)+len(fractionalPart) > PARQUET_MAX_DECIMAL_PRECISION {
-		integerPart = strings.Repeat("9", PARQUET_MAX_DECIMAL_PRECISION-len(fractionalPart))
-		LogWarn(col.Config, "Truncating decimal value", value, "to", integerPart+"."+fractionalPart, "in column", col.ColumnName, "to fit precision", IntToString(PARQUET_MAX_DECIMAL_PRECISION))
+		return duckdb.Decimal{}, fmt.Errorf("decimal value %s in column %s exceeds precision %d", value, col.ColumnName, PARQUET_MAX_DECIMAL_PRECISION)
 	}
 
-	decimalValue.SetString(integerPart+fractionalPart, 10)
+	_, ok := decimalValue.SetString(integerPart+fractionalPart, 10)
+	if !ok {
+		return duckdb.Decimal{}, fmt.Errorf("invalid decimal value %s in column %s", value, col.ColumnName)
+	}
 
 	return duckdb.Decimal{
 		Width: uint8(col.NormalizedPrecision()),
 		Scale: uint8(scale),
 		Value: decimalValue,
-	}
+	}, nil
+}
+
+func (col *IcebergSchemaColumn) invalidValueError(value string, err error) error {
+	return fmt.Errorf("invalid %s value %s in column %s: %w", col.ColumnType, value, col.ColumnName, err)
+}
+
+func (col *IcebergSchemaColumn) unsupportedValueError(value any) error {
+	return fmt.Errorf("unsupported value: %v for column type: %s", value, col.ColumnType)
 }
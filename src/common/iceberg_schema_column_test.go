@@ -0,0 +1,88 @@
+package common
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/marcboeker/go-duckdb/v2"
+)
+
+func TestDuckdbValueFromCsv(t *testing.T) {
+	t.Run("Converts values to column types", func(t *testing.T) {
+		dateColumn := &IcebergSchemaColumn{ColumnName: "day", ColumnType: IcebergColumnTypeDate}
+		intervalColumn := &IcebergSchemaColumn{ColumnName: "duration", ColumnType: IcebergColumnTypeDecimal, LogicalColumnType: IcebergLogicalColumnTypeInterval, NumericPrecision: 38}
+
+		value, err := dateColumn.DuckdbValueFromCsv("12345-01-02")
+
+		if err != nil || value.(time.Time).Year() != 12345 || value.(time.Time).YearDay() != 2 {
+			t.Errorf("Expected the date 12345-01-02, got %v, %v", value, err)
+		}
+
+		value, err = intervalColumn.DuckdbValueFromCsv("1 day 00:00:01.000002")
+
+		expectedMicroseconds := int64(24*60*60*1_000_000 + 1_000_002)
+		if err != nil || value.(duckdb.Decimal).Value.Int64() != expectedMicroseconds {
+			t.Errorf("Expected %d microseconds, got %v, %v", expectedMicroseconds, value, err)
+		}
+	})
+
+	t.Run("Returns an error for values that can't be converted", func(t *testing.T) {
+		for _, testCase := range []struct {
+			column        *IcebergSchemaColumn
+			value         string
+			expectedError string
+		}{
+			{&IcebergSchemaColumn{ColumnName: "day", ColumnType: IcebergColumnTypeDate}, "2024-13-01", "invalid date value 2024-13-01 in column day"},
+			{&IcebergSchemaColumn{ColumnName: "days", ColumnType: IcebergColumnTypeDate, IsList: true}, "{2024-01-01,not-a-date}", "invalid date value not-a-date in column days"},
+			{&IcebergSchemaColumn{ColumnName: "id", ColumnType: IcebergColumnTypeInteger}, "2147483648", "invalid int value 2147483648 in column id"},
+			{&IcebergSchemaColumn{ColumnName: "amount", ColumnType: IcebergColumnTypeDecimal}, strings.Repeat("9", 40), "decimal value " + strings.Repeat("9", 40) + " in column amount exceeds precision 38"},
+			{&IcebergSchemaColumn{ColumnName: "duration", ColumnType: IcebergColumnTypeDecimal, LogicalColumnType: IcebergLogicalColumnTypeInterval}, "1 year", "year intervals are not supported yet: 1 year in column duration"},
+		} {
+			_, err := testCase.column.DuckdbValueFromCsv(testCase.value)
+
+			if err == nil || !strings.HasPrefix(err.Error(), testCase.expectedError) {
+				t.Errorf("Expected the error to start with %q, got %v", testCase.expectedError, err)
+			}
+		}
+	})
+}
+
+func TestDuckdbValueFromJson(t *testing.T) {
+	t.Run("Returns an error for values that can't be converted", func(t *testing.T) {
+		for _, testCase := range []struct {
+			column        *IcebergSchemaColumn
+			value         any
+			expectedError string
+		}{
+			{&IcebergSchemaColumn{ColumnName: "day", ColumnType: IcebergColumnTypeDate}, "2024-02-30", "invalid date value 2024-02-30 in column day"},
+			{&IcebergSchemaColumn{ColumnName: "day", ColumnType: IcebergColumnTypeDate}, true, "unsupported value: true for column type: date"},
+			{&IcebergSchemaColumn{ColumnName: "amount", ColumnType: IcebergColumnTypeDecimal}, "1.5", "unsupported value: 1.5 for column type: decimal"},
+			{&IcebergSchemaColumn{ColumnName: "ids", ColumnType: IcebergColumnTypeLong, IsList: true}, "[1]", "unsupported value: [1] for column type: long"},
+		} {
+			_, err := testCase.column.DuckdbValueFromJson(testCase.value)
+
+			if err == nil || !strings.HasPrefix(err.Error(), testCase.expectedError) {
+				t.Errorf("Expected the error to start with %q, got %v", testCase.expectedError, err)
+			}
+		}
+	})
+}
+
+func TestRejectCsvRow(t *testing.T) {
+	t.Run("Keeps up to the maximum number of rejected rows and counts all of them", func(t *testing.T) {
+		writer := &IcebergTableWriter{Config: &CommonConfig{}}
+
+		for i := 0; i <= MAX_REJECTED_ROWS; i++ {
+			writer.rejectCsvRow([]string{IntToString(i), "2024-13-01"}, errors.New("invalid date value"))
+		}
+
+		if len(writer.RejectedRows) != MAX_REJECTED_ROWS || writer.RejectedRowCount != MAX_REJECTED_ROWS+1 {
+			t.Errorf("Expected %d rejected rows out of %d, got %d out of %d", MAX_REJECTED_ROWS, MAX_REJECTED_ROWS+1, len(writer.RejectedRows), writer.RejectedRowCount)
+		}
+		if writer.RejectedRows[0].Payload != "0,2024-13-01" {
+			t.Errorf("Expected the CSV payload of the first row, got %s", writer.RejectedRows[0].Payload)
+		}
+	})
+}
@@ -4,18 +4,38 @@ import (
 	"context"
 	"database/sql/driver"
 	"encoding/csv"
+	"encoding/json"
 	"io"
 	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/marcboeker/go-duckdb/v2"
 )
 
 const (
 	MAX_LOAD_BATCH_SIZE   = 1024 * 1024 * 1024 // 1 GB
 	MAX_PARQUET_FILE_SIZE = 100 * 1024 * 1024  // 100 MB
+
+	// SCD Type 2 history columns
+	HISTORY_COLUMN_VALID_FROM = "valid_from"
+	HISTORY_COLUMN_VALID_TO   = "valid_to"
+	HISTORY_COLUMN_IS_CURRENT = "is_current"
+
+	REJECTS_TABLE_SUFFIX = "_bemidb_rejects"
+	MAX_REJECTED_ROWS    = 1000 // Per write, further rejected rows are only counted
 )
 
+// Row that couldn't be converted to column types, written to the "[TABLE]_bemidb_rejects" table instead of failing the sync
+type RejectedRow struct {
+	Payload string
+	Error   string
+}
+
+var rejectedRowsMutex sync.Mutex
+
 type IcebergTableWriter struct {
 	Config               *CommonConfig
 	StorageS3            *StorageS3
@@ -23,6 +43,11 @@ type IcebergTableWriter struct {
 	IcebergTable         *IcebergTable
 	IcebergSchemaColumns []*IcebergSchemaColumn
 	CompressionFactor    int64
+	SourceSchemaColumns  []*IcebergSchemaColumn    // Set when rows are transformed with column overrides
+	ColumnOverrides      map[string]ColumnOverride // Set when rows are transformed with column overrides
+	RejectedRows         []RejectedRow
+	RejectedRowCount     int64 // Including rejected rows beyond MAX_REJECTED_ROWS
+	LoadedRowCount       int64
 }
 
 func NewIcebergTableWriter(
@@ -45,7 +70,46 @@ func NewIcebergTableWriter(
 
 // Public functions ----------------------------------------------------------------------------------------------------
 
+// Renames, casts, or computes columns while loading rows. IcebergSchemaColumns become the destination columns
+func (writer *IcebergTableWriter) ApplyColumnOverrides(columnOverrides map[string]ColumnOverride) {
+	if len(columnOverrides) == 0 {
+		return
+	}
+	for _, columnName := range columnOverridesUnknownColumnNames(writer.IcebergSchemaColumns, columnOverrides) {
+		LogWarn(writer.Config, "Ignoring override for unknown column:", columnName)
+	}
+
+	writer.SourceSchemaColumns = writer.IcebergSchemaColumns
+	writer.ColumnOverrides = columnOverrides
+
+	// Detect destination column types with an empty table
+	sourceDuckdbTableName := writer.createTempDuckdbTableWithColumns(writer.SourceSchemaColumns)
+	defer writer.deleteTempDuckdbTable(sourceDuckdbTableName)
+	destinationDuckdbTableName := "temp_" + strings.ReplaceAll(uuid.New().String(), "-", "")
+	_, destinationSchemaColumns, err := writer.insertToDuckdbTableFromQuery(destinationDuckdbTableName, "SELECT "+columnOverridesProjection(writer.SourceSchemaColumns, columnOverrides)+" FROM "+sourceDuckdbTableName)
+	defer writer.deleteTempDuckdbTable(destinationDuckdbTableName)
+	PanicIfError(writer.Config, err)
+	sort.Slice(destinationSchemaColumns, func(i, j int) bool {
+		return destinationSchemaColumns[i].Position < destinationSchemaColumns[j].Position
+	})
+
+	icebergSchemaColumns := make([]*IcebergSchemaColumn, len(writer.SourceSchemaColumns))
+	for i, sourceSchemaColumn := range writer.SourceSchemaColumns {
+		if columnOverrides[sourceSchemaColumn.ColumnName].IsTransformation() {
+			icebergSchemaColumns[i] = destinationSchemaColumns[i]
+		} else {
+			renamedSchemaColumn := *sourceSchemaColumn
+			renamedSchemaColumn.ColumnName = destinationSchemaColumns[i].ColumnName
+			icebergSchemaColumns[i] = &renamedSchemaColumn
+		}
+		icebergSchemaColumns[i].Position = sourceSchemaColumn.Position
+	}
+	writer.IcebergSchemaColumns = icebergSchemaColumns
+}
+
 func (writer *IcebergTableWriter) InsertFromCsvCappedBuffer(cappedBuffer *CappedBuffer) {
+	defer writer.finishWrite()
+
 	csvReader := csv.NewReader(cappedBuffer)
 	_, err := csvReader.Read() // Read the header row
 	PanicIfError(writer.Config, err)
@@ -56,6 +120,8 @@ func (writer *IcebergTableWriter) InsertFromCsvCappedBuffer(cappedBuffer *Capped
 }
 
 func (writer *IcebergTableWriter) AppendFromCsvCappedBuffer(cursorValue CursorValue, cappedBuffer *CappedBuffer) {
+	defer writer.finishWrite()
+
 	metadataFileS3Path := writer.IcebergTable.MetadataFileS3Path()
 	if metadataFileS3Path == "" { // If the table does not exist, insert for the first time
 		writer.InsertFromCsvCappedBuffer(cappedBuffer)
@@ -72,6 +138,8 @@ func (writer *IcebergTableWriter) AppendFromCsvCappedBuffer(cursorValue CursorVa
 }
 
 func (writer *IcebergTableWriter) InsertFromJsonCappedBuffer(cappedBuffer *CappedBuffer) {
+	defer writer.finishWrite()
+
 	jsonQueueReader := NewJsonQueueReader(cappedBuffer)
 
 	writer.insertRows(func(duckdbTableName string, loadedSize int64) (int64, bool) {
@@ -80,6 +148,8 @@ func (writer *IcebergTableWriter) InsertFromJsonCappedBuffer(cappedBuffer *Cappe
 }
 
 func (writer *IcebergTableWriter) AppendFromJsonCappedBuffer(cursorValue CursorValue, cappedBuffer *CappedBuffer) {
+	defer writer.finishWrite()
+
 	metadataFileS3Path := writer.IcebergTable.MetadataFileS3Path()
 	if metadataFileS3Path == "" { // If the table does not exist, insert for the first time
 		writer.InsertFromJsonCappedBuffer(cappedBuffer)
@@ -94,6 +164,8 @@ func (writer *IcebergTableWriter) AppendFromJsonCappedBuffer(cursorValue CursorV
 }
 
 func (writer *IcebergTableWriter) UpdateFromJsonCappedBuffer(cappedBuffer *CappedBuffer) {
+	defer writer.finishWrite()
+
 	metadataFileS3Path := writer.IcebergTable.MetadataFileS3Path()
 	if metadataFileS3Path == "" { // If the table does not exist, insert for the first time
 		writer.InsertFromJsonCappedBuffer(cappedBuffer)
@@ -109,6 +181,8 @@ func (writer *IcebergTableWriter) UpdateFromJsonCappedBuffer(cappedBuffer *Cappe
 }
 
 func (writer *IcebergTableWriter) DeleteFromJsonCappedBuffer(cappedBuffer *CappedBuffer) {
+	defer writer.finishWrite()
+
 	metadataFileS3Path := writer.IcebergTable.MetadataFileS3Path()
 	if metadataFileS3Path == "" { // If the table does not exist, do nothing
 		return
@@ -133,10 +207,6 @@ func (writer *IcebergTableWriter) UniqueIndexColumnNames() []string {
 }
 
 func (writer *IcebergTableWriter) InsertFromQuery(query string) error {
-	tableS3Path := writer.IcebergTable.GenerateTableS3Path()
-	dataS3Path := tableS3Path + "/data"
-	metadataS3Path := tableS3Path + "/metadata"
-
 	tempDuckdbTableName := "temp_" + strings.ReplaceAll(uuid.New().String(), "-", "")
 
 	loadedRowCount, icebergSchemaColumns, err := writer.insertToDuckdbTableFromQuery(tempDuckdbTableName, query)
@@ -145,26 +215,253 @@ func (writer *IcebergTableWriter) InsertFromQuery(query string) error {
 		return err
 	}
 
-	// Create parquet
-	parquetFile := writer.StorageS3.CreateParquet(dataS3Path, writer.DuckdbClient, tempDuckdbTableName, icebergSchemaColumns, loadedRowCount)
-	parquetFilesSortedAsc := []ParquetFile{parquetFile}
-	totalDataFileSize := parquetFile.Size
+	writer.createFromDuckdbTable(tempDuckdbTableName, icebergSchemaColumns, loadedRowCount)
+	return nil
+}
+
+// Appends the rows of the query to a new Parquet file of a table created with InsertFromQuery. Returns the number of appended rows
+func (writer *IcebergTableWriter) AppendFromQuery(query string) (int64, error) {
+	tempDuckdbTableName := "temp_" + strings.ReplaceAll(uuid.New().String(), "-", "")
+
+	loadedRowCount, icebergSchemaColumns, err := writer.insertToDuckdbTableFromQuery(tempDuckdbTableName, query)
+	defer writer.deleteTempDuckdbTable(tempDuckdbTableName)
+	if err != nil || loadedRowCount == 0 {
+		return 0, err
+	}
+	writer.IcebergSchemaColumns = icebergSchemaColumns
+
+	metadataFileS3Path := writer.IcebergTable.MetadataFileS3Path()
+	dataS3Path := strings.Split(metadataFileS3Path, "/metadata/")[0] + "/data"
+	existingManifestListFile := writer.StorageS3.LastManifestListFile(metadataFileS3Path)
+	existingManifestListItem := writer.StorageS3.ManifestListItems(existingManifestListFile)[0]
+	existingParquetFilesSortedAsc := writer.StorageS3.ParquetFiles(existingManifestListItem.ManifestFile, writer.IcebergSchemaColumns)
+
+	newParquetFile := writer.StorageS3.CreateParquet(dataS3Path, writer.DuckdbClient, tempDuckdbTableName, writer.IcebergSchemaColumns, loadedRowCount)
+	LogInfo(writer.Config, "Written", newParquetFile.RecordCount, "records in 'appended' Parquet file ("+writer.formattedParquetFileSize(newParquetFile.Size)+")")
+
+	parquetFilesSortedAsc := append(existingParquetFilesSortedAsc, newParquetFile)
+	writer.replaceParquetFiles(metadataFileS3Path, existingManifestListFile, existingManifestListItem, parquetFilesSortedAsc, []string{})
+	return loadedRowCount, nil
+}
+
+// Loads each Parquet file of a table created with InsertFromQuery into a DuckDB table, and rewrites only the files in which changeRows changes rows,
+// e.g. for UPDATE or DELETE. Returns the number of changed rows
+func (writer *IcebergTableWriter) ChangeFromQuery(changeRows func(duckdbTableName string) (int64, error)) (int64, error) {
+	metadataFileS3Path := writer.IcebergTable.MetadataFileS3Path()
+	dataS3Path := strings.Split(metadataFileS3Path, "/metadata/")[0] + "/data"
+
+	// The table's columns as they are read, e.g. to keep the types of values set by UPDATE
+	emptyDuckdbTableName := "temp_" + strings.ReplaceAll(uuid.New().String(), "-", "")
+	_, icebergSchemaColumns, err := writer.insertToDuckdbTableFromQuery(emptyDuckdbTableName, "SELECT * FROM iceberg_scan('"+metadataFileS3Path+"') LIMIT 0")
+	defer writer.deleteTempDuckdbTable(emptyDuckdbTableName)
+	if err != nil {
+		return 0, err
+	}
+	writer.IcebergSchemaColumns = icebergSchemaColumns
+
+	existingManifestListFile := writer.StorageS3.LastManifestListFile(metadataFileS3Path)
+	existingManifestListItem := writer.StorageS3.ManifestListItems(existingManifestListFile)[0]
+	existingParquetFilesSortedAsc := writer.StorageS3.ParquetFiles(existingManifestListItem.ManifestFile, writer.IcebergSchemaColumns)
+
+	var changedRowCount int64
+	objectsToDeleteKeys := []string{}
+	parquetFilesSortedAsc := append([]ParquetFile{}, existingParquetFilesSortedAsc...)
+	for i, parquetFile := range existingParquetFilesSortedAsc {
+		tempDuckdbTableName := "temp_" + strings.ReplaceAll(uuid.New().String(), "-", "")
+		defer writer.deleteTempDuckdbTable(tempDuckdbTableName)
+		_, err := writer.DuckdbClient.ExecContext(context.Background(), "CREATE TABLE "+tempDuckdbTableName+" AS FROM "+emptyDuckdbTableName+" UNION ALL FROM read_parquet('"+parquetFile.Path+"')")
+		if err != nil {
+			return 0, err
+		}
+
+		rowCount, err := changeRows(tempDuckdbTableName)
+		if err != nil {
+			return 0, err
+		}
+		if rowCount == 0 {
+			continue
+		}
+		changedRowCount += rowCount
+
+		var recordCount int64
+		err = writer.DuckdbClient.QueryRowContext(context.Background(), "SELECT COUNT(*) FROM "+tempDuckdbTableName).Scan(&recordCount)
+		if err != nil {
+			return 0, err
+		}
+
+		// Create parquet
+		newParquetFile := writer.StorageS3.CreateParquet(dataS3Path, writer.DuckdbClient, tempDuckdbTableName, writer.IcebergSchemaColumns, recordCount)
+		LogInfo(writer.Config, "Written", newParquetFile.RecordCount, "records in 'changed' Parquet file ("+writer.formattedParquetFileSize(newParquetFile.Size)+")")
+
+		// Replace the old Parquet file with the new one
+		parquetFilesSortedAsc[i] = newParquetFile
+		objectsToDeleteKeys = append(objectsToDeleteKeys, parquetFile.Key)
+	}
+
+	if changedRowCount == 0 {
+		return 0, nil
+	}
+	writer.replaceParquetFiles(metadataFileS3Path, existingManifestListFile, existingManifestListItem, parquetFilesSortedAsc, objectsToDeleteKeys)
+	return changedRowCount, nil
+}
+
+// Returns true if the table already keeps history with the same columns, so it can be merged in place (see MergeHistoryFromCsvCappedBuffer)
+func (writer *IcebergTableWriter) CanMergeHistory() bool {
+	if writer.IcebergTable.MetadataFileS3Path() == "" {
+		return false
+	}
+
+	catalogTableColumns, err := writer.IcebergTable.IcebergCatalog.TableColumns(writer.IcebergTable.IcebergSchemaTable)
+	PanicIfError(writer.Config, err)
+
+	historyIcebergSchemaColumns := writer.historyIcebergSchemaColumns()
+	if len(catalogTableColumns) != len(historyIcebergSchemaColumns) {
+		return false
+	}
+	for i, historyIcebergSchemaColumn := range historyIcebergSchemaColumns {
+		if catalogTableColumns[i] != historyIcebergSchemaColumn.CatalogTableColumn() {
+			return false
+		}
+	}
+	return true
+}
+
+// Keeps previous versions of rows by comparing the new snapshot with the current rows by unique index columns (SCD Type 2).
+// Only Parquet files with changed or deleted current rows are rewritten, and new versions are appended in new Parquet files
+func (writer *IcebergTableWriter) MergeHistoryFromCsvCappedBuffer(syncedAt time.Time, cappedBuffer *CappedBuffer) {
+	defer writer.finishWrite()
+
+	metadataFileS3Path := writer.IcebergTable.MetadataFileS3Path()
+	tableS3Path := strings.Split(metadataFileS3Path, "/metadata/")[0]
+	metadataS3Path := tableS3Path + "/metadata"
+	dataS3Path := tableS3Path + "/data"
+	historyIcebergSchemaColumns := writer.historyIcebergSchemaColumns()
+
+	existingManifestListFile := writer.StorageS3.LastManifestListFile(metadataFileS3Path)
+	existingManifestListItem := writer.StorageS3.ManifestListItems(existingManifestListFile)[0]
+	existingParquetFilesSortedAsc := writer.StorageS3.ParquetFiles(existingManifestListItem.ManifestFile, historyIcebergSchemaColumns)
+
+	parquetFilesSortedAsc, objectsToDeleteKeys := writer.writeHistoryParquetFiles(dataS3Path, writer.IcebergTable, existingParquetFilesSortedAsc, false, syncedAt, cappedBuffer)
+	if len(parquetFilesSortedAsc) == len(existingParquetFilesSortedAsc) && len(objectsToDeleteKeys) == 0 {
+		return // no changed rows
+	}
+
+	// Replace manifest
+	objectsToDeleteKeys = append(objectsToDeleteKeys, existingManifestListItem.ManifestFile.Key)
+	manifestFile := writer.StorageS3.CreateManifest(metadataS3Path, parquetFilesSortedAsc)
+
+	// Replace manifest list
+	objectsToDeleteKeys = append(objectsToDeleteKeys, existingManifestListFile.Key)
+	var totalDataFileSize int64
+	for _, parquetFile := range parquetFilesSortedAsc {
+		totalDataFileSize += parquetFile.Size
+	}
+	manifestListItem := ManifestListItem{SequenceNumber: len(parquetFilesSortedAsc) + 1, ManifestFile: manifestFile}
+	manifestListFile := writer.StorageS3.CreateManifestList(metadataS3Path, totalDataFileSize, []ManifestListItem{manifestListItem})
+
+	// Create metadata
+	writer.StorageS3.CreateMetadata(metadataS3Path, historyIcebergSchemaColumns, []ManifestListFile{manifestListFile})
+
+	// Delete old files
+	for _, key := range objectsToDeleteKeys {
+		writer.deleteObject(key)
+	}
+}
+
+// Creates the table with previous versions of rows in previousIcebergTable and the new snapshot, e.g. when history starts or columns change
+func (writer *IcebergTableWriter) InsertHistoryFromCsvCappedBuffer(previousIcebergTable *IcebergTable, syncedAt time.Time, cappedBuffer *CappedBuffer) {
+	defer writer.finishWrite()
+
+	tableS3Path := writer.IcebergTable.GenerateTableS3Path()
+	metadataS3Path := tableS3Path + "/metadata"
+	dataS3Path := tableS3Path + "/data"
+	historyIcebergSchemaColumns := writer.historyIcebergSchemaColumns()
+
+	previousParquetFilesSortedAsc := []ParquetFile{}
+	if previousMetadataFileS3Path := previousIcebergTable.MetadataFileS3Path(); previousMetadataFileS3Path != "" && writer.keepsHistory(previousIcebergTable) {
+		previousManifestListFile := writer.StorageS3.LastManifestListFile(previousMetadataFileS3Path)
+		previousManifestListItem := writer.StorageS3.ManifestListItems(previousManifestListFile)[0]
+		previousParquetFilesSortedAsc = writer.StorageS3.ParquetFiles(previousManifestListItem.ManifestFile, historyIcebergSchemaColumns)
+	} else {
+		LogInfo(writer.Config, "Starting history for table", previousIcebergTable.String())
+	}
+
+	// Previous Parquet files are deleted with the previous table
+	parquetFilesSortedAsc, _ := writer.writeHistoryParquetFiles(dataS3Path, previousIcebergTable, previousParquetFilesSortedAsc, true, syncedAt, cappedBuffer)
+	if len(parquetFilesSortedAsc) == 0 {
+		emptyDuckdbTableName := writer.createTempDuckdbTableWithColumns(historyIcebergSchemaColumns)
+		defer writer.deleteTempDuckdbTable(emptyDuckdbTableName)
+		parquetFilesSortedAsc = append(parquetFilesSortedAsc, writer.StorageS3.CreateParquet(dataS3Path, writer.DuckdbClient, emptyDuckdbTableName, historyIcebergSchemaColumns, 0))
+	}
 
 	// Create manifest
 	manifestFile := writer.StorageS3.CreateManifest(metadataS3Path, parquetFilesSortedAsc)
 
 	// Create manifest list
+	var totalDataFileSize int64
+	for _, parquetFile := range parquetFilesSortedAsc {
+		totalDataFileSize += parquetFile.Size
+	}
 	manifestListItem := ManifestListItem{SequenceNumber: len(parquetFilesSortedAsc) + 1, ManifestFile: manifestFile}
 	manifestListFile := writer.StorageS3.CreateManifestList(metadataS3Path, totalDataFileSize, []ManifestListItem{manifestListItem})
 
 	// Create metadata
-	writer.StorageS3.CreateMetadata(metadataS3Path, icebergSchemaColumns, []ManifestListFile{manifestListFile})
-	LogInfo(writer.Config, "Written", parquetFile.RecordCount, "records in Parquet file #"+IntToString(len(parquetFilesSortedAsc)), "("+writer.formattedParquetFileSize(parquetFile.Size)+")")
+	writer.StorageS3.CreateMetadata(metadataS3Path, historyIcebergSchemaColumns, []ManifestListFile{manifestListFile})
 
-	// Create as table
-	writer.IcebergTable.Create(tableS3Path, icebergSchemaColumns)
+	// Create table
+	writer.IcebergTable.Create(tableS3Path, historyIcebergSchemaColumns)
+}
 
-	return nil
+// Writes Parquet files to dataS3Path without creating Iceberg metadata (see CreateFromParquetFiles)
+func (writer *IcebergTableWriter) WriteParquetFilesFromCsvCappedBuffer(dataS3Path string, cappedBuffer *CappedBuffer) []ParquetFile {
+	defer writer.finishWrite()
+
+	csvReader := csv.NewReader(cappedBuffer)
+	_, err := csvReader.Read() // Read the header row
+	PanicIfError(writer.Config, err)
+
+	parquetFiles := []ParquetFile{}
+	for {
+		tempDuckdbTableName := writer.createTempDuckdbTable()
+		loadedRowCount, reachedEnd := writer.loadCsvRows(tempDuckdbTableName, csvReader, 0)
+
+		if loadedRowCount > 0 {
+			parquetFile := writer.StorageS3.CreateParquet(dataS3Path, writer.DuckdbClient, tempDuckdbTableName, writer.IcebergSchemaColumns, loadedRowCount)
+			parquetFiles = append(parquetFiles, parquetFile)
+			LogInfo(writer.Config, "Written", parquetFile.RecordCount, "records in Parquet file", "("+writer.formattedParquetFileSize(parquetFile.Size)+")")
+		}
+		writer.deleteTempDuckdbTable(tempDuckdbTableName)
+
+		if reachedEnd {
+			break
+		}
+	}
+
+	return parquetFiles
+}
+
+// Creates Iceberg metadata for Parquet files previously written to tableS3Path and registers the table
+func (writer *IcebergTableWriter) CreateFromParquetFiles(tableS3Path string, parquetFilesSortedAsc []ParquetFile) {
+	metadataS3Path := tableS3Path + "/metadata"
+
+	var totalDataFileSize int64
+	for _, parquetFile := range parquetFilesSortedAsc {
+		totalDataFileSize += parquetFile.Size
+	}
+
+	// Create manifest
+	manifestFile := writer.StorageS3.CreateManifest(metadataS3Path, parquetFilesSortedAsc)
+
+	// Create manifest list
+	manifestListItem := ManifestListItem{SequenceNumber: len(parquetFilesSortedAsc) + 1, ManifestFile: manifestFile}
+	manifestListFile := writer.StorageS3.CreateManifestList(metadataS3Path, totalDataFileSize, []ManifestListItem{manifestListItem})
+
+	// Create metadata
+	writer.StorageS3.CreateMetadata(metadataS3Path, writer.IcebergSchemaColumns, []ManifestListFile{manifestListFile})
+	LogInfo(writer.Config, "Created metadata for", len(parquetFilesSortedAsc), "Parquet files")
+
+	// Create table
+	writer.IcebergTable.Create(tableS3Path, writer.IcebergSchemaColumns)
 }
 
 // Iceberg logic -------------------------------------------------------------------------------------------------------
@@ -228,6 +525,31 @@ func (writer *IcebergTableWriter) insertRows(loadRowsToDuckdbTableFunc func(duck
 	}
 }
 
+func (writer *IcebergTableWriter) createFromDuckdbTable(duckdbTableName string, icebergSchemaColumns []*IcebergSchemaColumn, rowCount int64) {
+	tableS3Path := writer.IcebergTable.GenerateTableS3Path()
+	dataS3Path := tableS3Path + "/data"
+	metadataS3Path := tableS3Path + "/metadata"
+
+	// Create parquet
+	parquetFile := writer.StorageS3.CreateParquet(dataS3Path, writer.DuckdbClient, duckdbTableName, icebergSchemaColumns, rowCount)
+	parquetFilesSortedAsc := []ParquetFile{parquetFile}
+	totalDataFileSize := parquetFile.Size
+
+	// Create manifest
+	manifestFile := writer.StorageS3.CreateManifest(metadataS3Path, parquetFilesSortedAsc)
+
+	// Create manifest list
+	manifestListItem := ManifestListItem{SequenceNumber: len(parquetFilesSortedAsc) + 1, ManifestFile: manifestFile}
+	manifestListFile := writer.StorageS3.CreateManifestList(metadataS3Path, totalDataFileSize, []ManifestListItem{manifestListItem})
+
+	// Create metadata
+	writer.StorageS3.CreateMetadata(metadataS3Path, icebergSchemaColumns, []ManifestListFile{manifestListFile})
+	LogInfo(writer.Config, "Written", parquetFile.RecordCount, "records in Parquet file #"+IntToString(len(parquetFilesSortedAsc)), "("+writer.formattedParquetFileSize(parquetFile.Size)+")")
+
+	// Create as table
+	writer.IcebergTable.Create(tableS3Path, icebergSchemaColumns)
+}
+
 func (writer *IcebergTableWriter) appendRows(metadataFileS3Path string, cursorValue CursorValue, loadRowsToDuckdbTableFunc func(duckdbTableName string, loadedSize int64) (loadedRowCount int64, reachedEnd bool)) {
 	tableS3Path := strings.Split(metadataFileS3Path, "/metadata/")[0]
 	metadataS3Path := tableS3Path + "/metadata"
@@ -451,12 +773,108 @@ func (writer *IcebergTableWriter) deleteRows(metadataFileS3Path string, uniqueIn
 	}
 }
 
+// Rewrites previous Parquet files with changed or deleted current rows closed (all of them with rewritePreviousParquetFiles),
+// and writes new or changed rows as current to a new Parquet file per loaded snapshot batch to keep them under MAX_PARQUET_FILE_SIZE
+func (writer *IcebergTableWriter) writeHistoryParquetFiles(dataS3Path string, previousIcebergTable *IcebergTable, previousParquetFilesSortedAsc []ParquetFile, rewritePreviousParquetFiles bool, syncedAt time.Time, cappedBuffer *CappedBuffer) (parquetFilesSortedAsc []ParquetFile, objectsToDeleteKeys []string) {
+	uniqueIndexColumnNames := writer.UniqueIndexColumnNames()
+	if len(uniqueIndexColumnNames) == 0 {
+		Panic(writer.Config, "Keeping history requires a primary key or unique index for table "+previousIcebergTable.String())
+	}
+	historyIcebergSchemaColumns := writer.historyIcebergSchemaColumns()
+
+	csvReader := csv.NewReader(cappedBuffer)
+	_, err := csvReader.Read() // Read the header row
+	PanicIfError(writer.Config, err)
+
+	// The whole snapshot is needed to find deleted rows
+	snapshotDuckdbTableNames := []string{}
+	for {
+		snapshotDuckdbTableName := writer.createTempDuckdbTable()
+		defer writer.deleteTempDuckdbTable(snapshotDuckdbTableName)
+		snapshotDuckdbTableNames = append(snapshotDuckdbTableNames, snapshotDuckdbTableName)
+
+		_, reachedEnd := writer.loadCsvRows(snapshotDuckdbTableName, csvReader, 0)
+		if reachedEnd {
+			break
+		}
+	}
+	var previousColumnNames Set[string]
+	if len(previousParquetFilesSortedAsc) > 0 {
+		previousColumnNames = writer.catalogColumnNames(previousIcebergTable)
+	}
+	historyComparison := newHistoryComparison(writer.IcebergSchemaColumns, previousColumnNames, previousIcebergTable.MetadataFileS3Path(), snapshotDuckdbTableNames, uniqueIndexColumnNames, syncedAt)
+
+	// Previous versions, with current rows closed if changed or deleted
+	parquetFilesSortedAsc = append([]ParquetFile{}, previousParquetFilesSortedAsc...)
+	for i, parquetFile := range previousParquetFilesSortedAsc {
+		if !rewritePreviousParquetFiles && !writer.hasClosedHistoryRowsInParquet(parquetFile.Path, historyComparison) {
+			continue
+		}
+
+		tempDuckdbTableName := writer.createTempDuckdbTableWithColumns(historyIcebergSchemaColumns)
+		defer writer.deleteTempDuckdbTable(tempDuckdbTableName)
+		rowCount := writer.insertToDuckdbTableFromHistoryParquet(tempDuckdbTableName, parquetFile.Path, historyComparison)
+
+		newParquetFile := writer.StorageS3.CreateParquet(dataS3Path, writer.DuckdbClient, tempDuckdbTableName, historyIcebergSchemaColumns, rowCount)
+		LogInfo(writer.Config, "Written", newParquetFile.RecordCount, "records in 'closed' Parquet file ("+writer.formattedParquetFileSize(newParquetFile.Size)+")")
+
+		parquetFilesSortedAsc[i] = newParquetFile
+		objectsToDeleteKeys = append(objectsToDeleteKeys, parquetFile.Key)
+	}
+
+	// New or changed rows
+	for _, snapshotDuckdbTableName := range snapshotDuckdbTableNames {
+		tempDuckdbTableName := writer.createTempDuckdbTableWithColumns(historyIcebergSchemaColumns)
+		defer writer.deleteTempDuckdbTable(tempDuckdbTableName)
+		rowCount := writer.insertToDuckdbTableFromHistorySnapshot(tempDuckdbTableName, snapshotDuckdbTableName, historyComparison)
+		if rowCount == 0 {
+			continue
+		}
+
+		newParquetFile := writer.StorageS3.CreateParquet(dataS3Path, writer.DuckdbClient, tempDuckdbTableName, historyIcebergSchemaColumns, rowCount)
+		parquetFilesSortedAsc = append(parquetFilesSortedAsc, newParquetFile)
+		LogInfo(writer.Config, "Written", newParquetFile.RecordCount, "records in 'current' Parquet file ("+writer.formattedParquetFileSize(newParquetFile.Size)+")")
+	}
+
+	return parquetFilesSortedAsc, objectsToDeleteKeys
+}
+
+// Replaces the manifest, the manifest list, and the metadata of the table with the Parquet files, and deletes the replaced files
+func (writer *IcebergTableWriter) replaceParquetFiles(metadataFileS3Path string, existingManifestListFile ManifestListFile, existingManifestListItem ManifestListItem, parquetFilesSortedAsc []ParquetFile, objectsToDeleteKeys []string) {
+	metadataS3Path := strings.Split(metadataFileS3Path, "/metadata/")[0] + "/metadata"
+
+	// Replace manifest
+	objectsToDeleteKeys = append(objectsToDeleteKeys, existingManifestListItem.ManifestFile.Key)
+	manifestFile := writer.StorageS3.CreateManifest(metadataS3Path, parquetFilesSortedAsc)
+
+	// Replace manifest list
+	objectsToDeleteKeys = append(objectsToDeleteKeys, existingManifestListFile.Key)
+	var totalDataFileSize int64
+	for _, parquetFile := range parquetFilesSortedAsc {
+		totalDataFileSize += parquetFile.Size
+	}
+	manifestListItem := ManifestListItem{SequenceNumber: len(parquetFilesSortedAsc) + 1, ManifestFile: manifestFile}
+	manifestListFile := writer.StorageS3.CreateManifestList(metadataS3Path, totalDataFileSize, []ManifestListItem{manifestListItem})
+
+	// Create metadata
+	writer.StorageS3.CreateMetadata(metadataS3Path, writer.IcebergSchemaColumns, []ManifestListFile{manifestListFile})
+
+	// Delete old files
+	for _, key := range objectsToDeleteKeys {
+		writer.deleteObject(key)
+	}
+}
+
 // DuckDB --------------------------------------------------------------------------------------------------------------
 
 func (writer *IcebergTableWriter) createTempDuckdbTable() string {
+	return writer.createTempDuckdbTableWithColumns(writer.IcebergSchemaColumns)
+}
+
+func (writer *IcebergTableWriter) createTempDuckdbTableWithColumns(icebergSchemaColumns []*IcebergSchemaColumn) string {
 	tableName := "temp_" + strings.ReplaceAll(uuid.New().String(), "-", "")
-	columnSchemas := make([]string, len(writer.IcebergSchemaColumns))
-	for i, col := range writer.IcebergSchemaColumns {
+	columnSchemas := make([]string, len(icebergSchemaColumns))
+	for i, col := range icebergSchemaColumns {
 		columnSchemas[i] = col.QuotedColumnName() + " " + col.DuckdbType()
 	}
 
@@ -466,6 +884,132 @@ func (writer *IcebergTableWriter) createTempDuckdbTable() string {
 	return tableName
 }
 
+func (writer *IcebergTableWriter) historyIcebergSchemaColumns() []*IcebergSchemaColumn {
+	position := len(writer.IcebergSchemaColumns)
+	historyIcebergSchemaColumns := append([]*IcebergSchemaColumn{}, writer.IcebergSchemaColumns...)
+	historyIcebergSchemaColumns = append(historyIcebergSchemaColumns,
+		&IcebergSchemaColumn{Config: writer.Config, ColumnName: HISTORY_COLUMN_VALID_FROM, ColumnType: IcebergColumnTypeTimestamp, DatetimePrecision: 6, Position: position + 1, IsRequired: true},
+		&IcebergSchemaColumn{Config: writer.Config, ColumnName: HISTORY_COLUMN_VALID_TO, ColumnType: IcebergColumnTypeTimestamp, DatetimePrecision: 6, Position: position + 2},
+		&IcebergSchemaColumn{Config: writer.Config, ColumnName: HISTORY_COLUMN_IS_CURRENT, ColumnType: IcebergColumnTypeBoolean, Position: position + 3, IsRequired: true},
+	)
+	return historyIcebergSchemaColumns
+}
+
+// Returns true if the table has the history columns and the unique index columns to compare versions with
+func (writer *IcebergTableWriter) keepsHistory(icebergTable *IcebergTable) bool {
+	columnNames := writer.catalogColumnNames(icebergTable)
+	for _, columnName := range append([]string{HISTORY_COLUMN_VALID_FROM, HISTORY_COLUMN_VALID_TO, HISTORY_COLUMN_IS_CURRENT}, writer.UniqueIndexColumnNames()...) {
+		if !columnNames.Contains(columnName) {
+			return false
+		}
+	}
+	return true
+}
+
+func (writer *IcebergTableWriter) catalogColumnNames(icebergTable *IcebergTable) Set[string] {
+	catalogTableColumns, err := icebergTable.IcebergCatalog.TableColumns(icebergTable.IcebergSchemaTable)
+	PanicIfError(writer.Config, err)
+
+	columnNames := NewSet[string]()
+	for _, catalogTableColumn := range catalogTableColumns {
+		columnNames.Add(catalogTableColumn.Name)
+	}
+	return columnNames
+}
+
+// SQL comparing rows of a history table ("h") with rows of the new snapshot ("s") by unique index columns
+type historyComparison struct {
+	previousColumnValues   []string // NULL for columns added since the previous sync
+	uniqueIndexConditions  []string
+	isUnchangedSql         string
+	snapshotSql            string
+	previousCurrentRowsSql string // Empty if the previous table doesn't keep history yet
+	syncedAtSql            string
+	snapshotColumnNames    []string
+}
+
+// Without previousColumnNames, all snapshot rows are new
+func newHistoryComparison(icebergSchemaColumns []*IcebergSchemaColumn, previousColumnNames Set[string], previousMetadataFileS3Path string, snapshotDuckdbTableNames []string, uniqueIndexColumnNames []string, syncedAt time.Time) historyComparison {
+	comparison := historyComparison{
+		syncedAtSql:         "TIMESTAMP '" + syncedAt.UTC().Format("2006-01-02 15:04:05.999999") + "'",
+		snapshotColumnNames: make([]string, len(icebergSchemaColumns)),
+	}
+	for i, icebergSchemaColumn := range icebergSchemaColumns {
+		comparison.snapshotColumnNames[i] = "s." + icebergSchemaColumn.QuotedColumnName()
+	}
+
+	snapshotSelects := make([]string, len(snapshotDuckdbTableNames))
+	for i, snapshotDuckdbTableName := range snapshotDuckdbTableNames {
+		snapshotSelects[i] = "SELECT * FROM " + snapshotDuckdbTableName
+	}
+	comparison.snapshotSql = "(" + strings.Join(snapshotSelects, " UNION ALL ") + ")"
+
+	if previousColumnNames == nil {
+		return comparison
+	}
+
+	comparison.previousColumnValues = make([]string, len(icebergSchemaColumns))
+	sameValuesConditions := make([]string, len(icebergSchemaColumns))
+	for i, icebergSchemaColumn := range icebergSchemaColumns {
+		comparison.previousColumnValues[i] = "NULL"
+		if previousColumnNames.Contains(icebergSchemaColumn.NormalizedColumnName()) {
+			comparison.previousColumnValues[i] = "h." + icebergSchemaColumn.QuotedColumnName()
+		}
+		sameValuesConditions[i] = comparison.previousColumnValues[i] + " IS NOT DISTINCT FROM " + comparison.snapshotColumnNames[i]
+	}
+	comparison.uniqueIndexConditions = make([]string, len(uniqueIndexColumnNames))
+	for i, uniqueIndexColumnName := range uniqueIndexColumnNames {
+		comparison.uniqueIndexConditions[i] = `h."` + uniqueIndexColumnName + `" = s."` + uniqueIndexColumnName + `"`
+	}
+	comparison.isUnchangedSql = `(h."` + uniqueIndexColumnNames[0] + `" IS NOT NULL AND s."` + uniqueIndexColumnNames[0] + `" IS NOT NULL AND ` + strings.Join(sameValuesConditions, " AND ") + ")"
+	comparison.previousCurrentRowsSql = "(SELECT * FROM iceberg_scan('" + previousMetadataFileS3Path + `') WHERE "` + HISTORY_COLUMN_IS_CURRENT + `") h`
+
+	return comparison
+}
+
+func (writer *IcebergTableWriter) hasClosedHistoryRowsInParquet(parquetFileS3Path string, comparison historyComparison) bool {
+	existsSql := "SELECT EXISTS (SELECT 1 FROM read_parquet('" + parquetFileS3Path + "') h LEFT JOIN " + comparison.snapshotSql + " s ON " + strings.Join(comparison.uniqueIndexConditions, " AND ") +
+		` WHERE h."` + HISTORY_COLUMN_IS_CURRENT + `" AND NOT ` + comparison.isUnchangedSql + ")"
+
+	var exists bool
+	err := writer.DuckdbClient.QueryRowContext(context.Background(), existsSql).Scan(&exists)
+	PanicIfError(writer.Config, err)
+	return exists
+}
+
+// Previous versions are kept as is, and current rows are closed if changed or deleted
+func (writer *IcebergTableWriter) insertToDuckdbTableFromHistoryParquet(duckdbTableName string, parquetFileS3Path string, comparison historyComparison) int64 {
+	sql := "INSERT INTO " + duckdbTableName +
+		" SELECT " + strings.Join(comparison.previousColumnValues, ", ") + `, h."` + HISTORY_COLUMN_VALID_FROM + `"` +
+		`, CASE WHEN NOT h."` + HISTORY_COLUMN_IS_CURRENT + `" THEN h."` + HISTORY_COLUMN_VALID_TO + `" WHEN ` + comparison.isUnchangedSql + " THEN NULL ELSE " + comparison.syncedAtSql + " END" +
+		`, h."` + HISTORY_COLUMN_IS_CURRENT + `" AND ` + comparison.isUnchangedSql +
+		" FROM read_parquet('" + parquetFileS3Path + "') h LEFT JOIN " + comparison.snapshotSql + ` s ON h."` + HISTORY_COLUMN_IS_CURRENT + `" AND ` + strings.Join(comparison.uniqueIndexConditions, " AND ")
+
+	result, err := writer.DuckdbClient.ExecContext(context.Background(), sql)
+	PanicIfError(writer.Config, err)
+
+	rowsAffected, err := result.RowsAffected()
+	PanicIfError(writer.Config, err)
+
+	return rowsAffected
+}
+
+// New or changed rows are inserted as current
+func (writer *IcebergTableWriter) insertToDuckdbTableFromHistorySnapshot(duckdbTableName string, snapshotDuckdbTableName string, comparison historyComparison) int64 {
+	sql := "INSERT INTO " + duckdbTableName + " SELECT " + strings.Join(comparison.snapshotColumnNames, ", ") + ", " + comparison.syncedAtSql + ", NULL, true FROM " + snapshotDuckdbTableName + " s"
+	if comparison.previousCurrentRowsSql != "" {
+		sql += " LEFT JOIN " + comparison.previousCurrentRowsSql + " ON " + strings.Join(comparison.uniqueIndexConditions, " AND ") + " WHERE NOT " + comparison.isUnchangedSql
+	}
+
+	result, err := writer.DuckdbClient.ExecContext(context.Background(), sql)
+	PanicIfError(writer.Config, err)
+
+	rowsAffected, err := result.RowsAffected()
+	PanicIfError(writer.Config, err)
+
+	return rowsAffected
+}
+
 func (writer *IcebergTableWriter) hasOverlappingRowsInParquet(duckdbTableName string, parquetFileS3Path string, uniqueIndexColumnNames []string) bool {
 	uniqueIndexConditions := make([]string, len(uniqueIndexColumnNames))
 	for i, uniqueIndexColumnName := range uniqueIndexColumnNames {
@@ -599,7 +1143,13 @@ func (writer *IcebergTableWriter) deleteObject(key string) {
 }
 
 func (writer *IcebergTableWriter) loadCsvRows(duckdbTableName string, csvReader *csv.Reader, loadedSize int64) (loadedRowCount int64, reachedEnd bool) {
-	appender, err := writer.DuckdbClient.Appender("", duckdbTableName)
+	appenderDuckdbTableName := duckdbTableName
+	if writer.ColumnOverrides != nil {
+		appenderDuckdbTableName = writer.createTempDuckdbTableWithColumns(writer.SourceSchemaColumns)
+		defer writer.deleteTempDuckdbTable(appenderDuckdbTableName)
+	}
+
+	appender, err := writer.DuckdbClient.Appender("", appenderDuckdbTableName)
 	PanicIfError(writer.Config, err)
 	defer appender.Close()
 
@@ -611,10 +1161,13 @@ func (writer *IcebergTableWriter) loadCsvRows(duckdbTableName string, csvReader
 		}
 		PanicIfError(writer.Config, err)
 
-		duckdbRowValues := make([]driver.Value, len(writer.IcebergSchemaColumns))
-		for i, icebergSchemaColumn := range writer.IcebergSchemaColumns {
-			duckdbRowValues[i] = icebergSchemaColumn.DuckdbValueFromCsv(row[i])
-			loadedSize += int64(len(row[i]))
+		duckdbRowValues, err := writer.csvToDuckdbRowValues(row)
+		if err != nil {
+			writer.rejectCsvRow(row, err)
+			continue
+		}
+		for _, value := range row {
+			loadedSize += int64(len(value))
 		}
 
 		LogTrace(writer.Config, "DuckDB appending row values:", duckdbRowValues)
@@ -628,12 +1181,21 @@ func (writer *IcebergTableWriter) loadCsvRows(duckdbTableName string, csvReader
 		}
 	}
 
+	writer.transformLoadedRows(appender, appenderDuckdbTableName, duckdbTableName)
+
+	writer.LoadedRowCount += loadedRowCount
 	LogInfo(writer.Config, "Loaded", loadedRowCount, "rows")
 	return loadedRowCount, reachedEnd
 }
 
 func (writer *IcebergTableWriter) loadJsonRows(duckdbTableName string, jsonQueueReader *JsonQueueReader, loadedSize int64) (loadedRowCount int64, reachedEnd bool) {
-	appender, err := writer.DuckdbClient.Appender("", duckdbTableName)
+	appenderDuckdbTableName := duckdbTableName
+	if writer.ColumnOverrides != nil {
+		appenderDuckdbTableName = writer.createTempDuckdbTableWithColumns(writer.SourceSchemaColumns)
+		defer writer.deleteTempDuckdbTable(appenderDuckdbTableName)
+	}
+
+	appender, err := writer.DuckdbClient.Appender("", appenderDuckdbTableName)
 	PanicIfError(writer.Config, err)
 	defer appender.Close()
 
@@ -645,9 +1207,13 @@ func (writer *IcebergTableWriter) loadJsonRows(duckdbTableName string, jsonQueue
 			break
 		}
 		PanicIfError(writer.Config, err)
-		loadedSize += int64(valueSize)
 
-		duckdbRowValues := writer.jsonToDuckdbRowValues(rowValues)
+		duckdbRowValues, err := writer.jsonToDuckdbRowValues(rowValues)
+		if err != nil {
+			writer.rejectJsonRow(rowValues, err)
+			continue
+		}
+		loadedSize += int64(valueSize)
 
 		LogTrace(writer.Config, "DuckDB appending row values:", rowValues)
 		err = appender.AppendRow(duckdbRowValues...)
@@ -660,18 +1226,61 @@ func (writer *IcebergTableWriter) loadJsonRows(duckdbTableName string, jsonQueue
 		}
 	}
 
+	writer.transformLoadedRows(appender, appenderDuckdbTableName, duckdbTableName)
+
+	writer.LoadedRowCount += loadedRowCount
 	LogInfo(writer.Config, "Loaded", loadedRowCount, "rows")
 	return loadedRowCount, reachedEnd
 }
 
-func (writer *IcebergTableWriter) jsonToDuckdbRowValues(rowValues map[string]interface{}) []driver.Value {
+// Inserts rows loaded with source columns into the destination table with column overrides
+func (writer *IcebergTableWriter) transformLoadedRows(appender *duckdb.Appender, sourceDuckdbTableName string, duckdbTableName string) {
+	if writer.ColumnOverrides == nil {
+		return
+	}
+
+	err := appender.Flush()
+	PanicIfError(writer.Config, err)
+
+	_, err = writer.DuckdbClient.ExecContext(
+		context.Background(),
+		"INSERT INTO "+duckdbTableName+" SELECT "+columnOverridesProjection(writer.SourceSchemaColumns, writer.ColumnOverrides)+" FROM "+sourceDuckdbTableName,
+	)
+	PanicIfError(writer.Config, err)
+}
+
+func (writer *IcebergTableWriter) sourceSchemaColumns() []*IcebergSchemaColumn {
+	if writer.ColumnOverrides != nil {
+		return writer.SourceSchemaColumns
+	}
+	return writer.IcebergSchemaColumns
+}
+
+// Returns an error if a value can't be converted
+func (writer *IcebergTableWriter) csvToDuckdbRowValues(row []string) ([]driver.Value, error) {
+	sourceSchemaColumns := writer.sourceSchemaColumns()
+	duckdbRowValues := make([]driver.Value, len(sourceSchemaColumns))
+	for i, icebergSchemaColumn := range sourceSchemaColumns {
+		value, err := icebergSchemaColumn.DuckdbValueFromCsv(row[i])
+		if err != nil {
+			return nil, err
+		}
+		duckdbRowValues[i] = value
+	}
+	return duckdbRowValues, nil
+}
+
+// Returns an error if a value can't be converted
+func (writer *IcebergTableWriter) jsonToDuckdbRowValues(rowValues map[string]interface{}) ([]driver.Value, error) {
+	sourceSchemaColumns := writer.sourceSchemaColumns()
+
 	// Detect row column drift
 	rowColumnNames := []string{}
 	for columnName := range rowValues {
 		rowColumnNames = append(rowColumnNames, columnName)
 	}
-	tableColumnNames := make([]string, len(writer.IcebergSchemaColumns))
-	for i, icebergSchemaColumn := range writer.IcebergSchemaColumns {
+	tableColumnNames := make([]string, len(sourceSchemaColumns))
+	for i, icebergSchemaColumn := range sourceSchemaColumns {
 		tableColumnNames[i] = icebergSchemaColumn.ColumnName
 	}
 	if len(rowColumnNames) != len(tableColumnNames) {
@@ -686,13 +1295,103 @@ func (writer *IcebergTableWriter) jsonToDuckdbRowValues(rowValues map[string]int
 	}
 
 	// Convert row values to DuckDB values
-	duckdbRowValues := make([]driver.Value, len(writer.IcebergSchemaColumns))
-	for i, icebergSchemaColumn := range writer.IcebergSchemaColumns {
+	duckdbRowValues := make([]driver.Value, len(sourceSchemaColumns))
+	for i, icebergSchemaColumn := range sourceSchemaColumns {
 		columnName := icebergSchemaColumn.ColumnName
-		value := rowValues[columnName]
-		duckdbRowValues[i] = icebergSchemaColumn.DuckdbValueFromJson(value)
+		value, err := icebergSchemaColumn.DuckdbValueFromJson(rowValues[columnName])
+		if err != nil {
+			return nil, err
+		}
+		duckdbRowValues[i] = value
+	}
+	return duckdbRowValues, nil
+}
+
+func (writer *IcebergTableWriter) rejectCsvRow(row []string, err error) {
+	writer.RejectedRowCount++
+	if len(writer.RejectedRows) >= MAX_REJECTED_ROWS {
+		return
+	}
+
+	var payload strings.Builder
+	csvWriter := csv.NewWriter(&payload)
+	writeErr := csvWriter.Write(row)
+	PanicIfError(writer.Config, writeErr)
+	csvWriter.Flush()
+
+	LogDebug(writer.Config, "Rejecting row:", err)
+	writer.RejectedRows = append(writer.RejectedRows, RejectedRow{Payload: strings.TrimSuffix(payload.String(), "\n"), Error: err.Error()})
+}
+
+func (writer *IcebergTableWriter) rejectJsonRow(rowValues map[string]interface{}, err error) {
+	writer.RejectedRowCount++
+	if len(writer.RejectedRows) >= MAX_REJECTED_ROWS {
+		return
 	}
-	return duckdbRowValues
+
+	payload, marshalErr := json.Marshal(rowValues)
+	PanicIfError(writer.Config, marshalErr)
+
+	LogDebug(writer.Config, "Rejecting row:", err)
+	writer.RejectedRows = append(writer.RejectedRows, RejectedRow{Payload: string(payload), Error: err.Error()})
+}
+
+// Writes the rejected rows and records the sync run with the row counts once the outermost write finishes
+func (writer *IcebergTableWriter) finishWrite() {
+	if writer.LoadedRowCount == 0 && writer.RejectedRowCount == 0 {
+		return
+	}
+	loadedRowCount, rejectedRowCount := writer.LoadedRowCount, writer.RejectedRowCount
+	writer.LoadedRowCount, writer.RejectedRowCount = 0, 0
+
+	tableName := strings.TrimSuffix(writer.IcebergTable.IcebergSchemaTable.Table, TEMP_TABLE_SUFFIX_SYNCING)
+	if strings.HasSuffix(tableName, REJECTS_TABLE_SUFFIX) {
+		return
+	}
+	icebergSchemaTable := IcebergSchemaTable{Schema: writer.IcebergTable.IcebergSchemaTable.Schema, Table: tableName}
+
+	writer.writeRejectedRows(icebergSchemaTable, rejectedRowCount)
+
+	err := writer.IcebergTable.IcebergCatalog.AddSyncRun(icebergSchemaTable, loadedRowCount, rejectedRowCount)
+	if err != nil {
+		LogWarn(writer.Config, "Couldn't record the sync run of", icebergSchemaTable.String()+":", err)
+	}
+}
+
+// Appends rejected rows to the "[TABLE]_bemidb_rejects" table next to the table
+func (writer *IcebergTableWriter) writeRejectedRows(icebergSchemaTable IcebergSchemaTable, rejectedRowCount int64) {
+	if len(writer.RejectedRows) == 0 {
+		return
+	}
+	rejectedRows := writer.RejectedRows
+	writer.RejectedRows = nil
+
+	rejectsIcebergSchemaTable := IcebergSchemaTable{Schema: icebergSchemaTable.Schema, Table: icebergSchemaTable.Table + REJECTS_TABLE_SUFFIX}
+	LogWarn(writer.Config, "Rejected", rejectedRowCount, "rows that couldn't be converted, writing", len(rejectedRows), "of them to", rejectsIcebergSchemaTable.String())
+
+	rejectsIcebergTable := NewIcebergTable(writer.Config, writer.StorageS3, writer.DuckdbClient, rejectsIcebergSchemaTable)
+	rejectsIcebergSchemaColumns := []*IcebergSchemaColumn{
+		{Config: writer.Config, ColumnName: "payload", ColumnType: IcebergColumnTypeString, Position: 1, IsRequired: true},
+		{Config: writer.Config, ColumnName: "error", ColumnType: IcebergColumnTypeString, Position: 2, IsRequired: true},
+		{Config: writer.Config, ColumnName: "rejected_at", ColumnType: IcebergColumnTypeTimestamp, DatetimePrecision: 6, Position: 3, IsRequired: true},
+	}
+	rejectsIcebergTableWriter := NewIcebergTableWriter(writer.Config, writer.StorageS3, writer.DuckdbClient, rejectsIcebergTable, rejectsIcebergSchemaColumns, 1)
+
+	cappedBuffer := NewCappedBuffer(writer.Config, DEFAULT_CAPPED_BUFFER_SIZE)
+	go func() {
+		jsonQueueWriter := NewJsonQueueWriter(cappedBuffer)
+		rejectedAt := time.Now().UTC().Format("2006-01-02T15:04:05.999999")
+		for _, rejectedRow := range rejectedRows {
+			err := jsonQueueWriter.Write(map[string]interface{}{"payload": rejectedRow.Payload, "error": rejectedRow.Error, "rejected_at": rejectedAt})
+			PanicIfError(writer.Config, err)
+		}
+		jsonQueueWriter.Close()
+	}()
+
+	// Chunks of the same table can be written in parallel
+	rejectedRowsMutex.Lock()
+	defer rejectedRowsMutex.Unlock()
+	rejectsIcebergTableWriter.AppendFromJsonCappedBuffer(CursorValue{}, cappedBuffer)
 }
 
 func (writer *IcebergTableWriter) formattedParquetFileSize(parquetFileSize int64) string {
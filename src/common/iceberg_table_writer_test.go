@@ -0,0 +1,158 @@
+package common
+
+import (
+	"context"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestHistoryComparison(t *testing.T) {
+	t.Run("Closes changed and deleted current rows and inserts new versions of changed and new rows", func(t *testing.T) {
+		writer := testHistoryIcebergTableWriter(t)
+		historyParquetFilePath := testHistoryParquetFile(t, writer, `
+			(1, 'unchanged', TIMESTAMP '2024-01-01', NULL, true),
+			(2, 'changed', TIMESTAMP '2024-01-01', NULL, true),
+			(3, 'deleted', TIMESTAMP '2024-01-01', NULL, true),
+			(2, 'previous', TIMESTAMP '2023-01-01', TIMESTAMP '2024-01-01', false)`)
+		snapshotDuckdbTableName := testHistoryDuckdbTable(t, writer, writer.IcebergSchemaColumns, "(1, 'unchanged'), (2, 'changed again'), (4, 'new')")
+		comparison := testHistoryComparison(writer, historyParquetFilePath, snapshotDuckdbTableName)
+
+		if !writer.hasClosedHistoryRowsInParquet(historyParquetFilePath, comparison) {
+			t.Errorf("Expected closed rows in the Parquet file")
+		}
+
+		historyDuckdbTableName := testHistoryDuckdbTable(t, writer, writer.historyIcebergSchemaColumns(), "")
+		writer.insertToDuckdbTableFromHistoryParquet(historyDuckdbTableName, historyParquetFilePath, comparison)
+		writer.insertToDuckdbTableFromHistorySnapshot(historyDuckdbTableName, snapshotDuckdbTableName, comparison)
+
+		expectedRows := []string{
+			"1 unchanged 2024-01-01 00:00:00 <nil> true",
+			"2 changed 2024-01-01 00:00:00 2024-06-01 00:00:00 false",
+			"2 changed again 2024-06-01 00:00:00 <nil> true",
+			"2 previous 2023-01-01 00:00:00 2024-01-01 00:00:00 false",
+			"3 deleted 2024-01-01 00:00:00 2024-06-01 00:00:00 false",
+			"4 new 2024-06-01 00:00:00 <nil> true",
+		}
+		testHistoryRows(t, writer, historyDuckdbTableName, expectedRows)
+	})
+
+	t.Run("Doesn't find closed rows if the snapshot has the same current rows", func(t *testing.T) {
+		writer := testHistoryIcebergTableWriter(t)
+		historyParquetFilePath := testHistoryParquetFile(t, writer, `
+			(1, 'unchanged', TIMESTAMP '2024-01-01', NULL, true),
+			(2, 'previous', TIMESTAMP '2023-01-01', TIMESTAMP '2024-01-01', false)`)
+		snapshotDuckdbTableName := testHistoryDuckdbTable(t, writer, writer.IcebergSchemaColumns, "(1, 'unchanged')")
+		comparison := testHistoryComparison(writer, historyParquetFilePath, snapshotDuckdbTableName)
+
+		if writer.hasClosedHistoryRowsInParquet(historyParquetFilePath, comparison) {
+			t.Errorf("Expected no closed rows in the Parquet file")
+		}
+
+		historyDuckdbTableName := testHistoryDuckdbTable(t, writer, writer.historyIcebergSchemaColumns(), "")
+		if rowCount := writer.insertToDuckdbTableFromHistorySnapshot(historyDuckdbTableName, snapshotDuckdbTableName, comparison); rowCount != 0 {
+			t.Errorf("Expected no new versions, got %d", rowCount)
+		}
+	})
+
+	t.Run("Inserts all snapshot rows as current when history starts", func(t *testing.T) {
+		writer := testHistoryIcebergTableWriter(t)
+		snapshotDuckdbTableName := testHistoryDuckdbTable(t, writer, writer.IcebergSchemaColumns, "(1, 'first'), (2, 'second')")
+		comparison := newHistoryComparison(writer.IcebergSchemaColumns, nil, "", []string{snapshotDuckdbTableName}, writer.UniqueIndexColumnNames(), testHistorySyncedAt())
+
+		historyDuckdbTableName := testHistoryDuckdbTable(t, writer, writer.historyIcebergSchemaColumns(), "")
+		writer.insertToDuckdbTableFromHistorySnapshot(historyDuckdbTableName, snapshotDuckdbTableName, comparison)
+
+		testHistoryRows(t, writer, historyDuckdbTableName, []string{
+			"1 first 2024-06-01 00:00:00 <nil> true",
+			"2 second 2024-06-01 00:00:00 <nil> true",
+		})
+	})
+}
+
+func testHistoryIcebergTableWriter(t *testing.T) *IcebergTableWriter {
+	config := &CommonConfig{}
+	duckdbClient := NewDuckdbClient(config)
+	t.Cleanup(duckdbClient.Close)
+
+	return &IcebergTableWriter{
+		Config:       config,
+		DuckdbClient: duckdbClient,
+		IcebergSchemaColumns: []*IcebergSchemaColumn{
+			{Config: config, ColumnName: "id", ColumnType: IcebergColumnTypeInteger, Position: 1, IsPartOfUniqueIndex: true},
+			{Config: config, ColumnName: "name", ColumnType: IcebergColumnTypeString, Position: 2},
+		},
+	}
+}
+
+func testHistorySyncedAt() time.Time {
+	return time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+}
+
+// Reads the current rows from the Parquet file instead of the Iceberg table
+func testHistoryComparison(writer *IcebergTableWriter, historyParquetFilePath string, snapshotDuckdbTableName string) historyComparison {
+	previousColumnNames := NewSet[string]()
+	for _, icebergSchemaColumn := range writer.historyIcebergSchemaColumns() {
+		previousColumnNames.Add(icebergSchemaColumn.ColumnName)
+	}
+
+	comparison := newHistoryComparison(writer.IcebergSchemaColumns, previousColumnNames, "", []string{snapshotDuckdbTableName}, writer.UniqueIndexColumnNames(), testHistorySyncedAt())
+	comparison.previousCurrentRowsSql = "(SELECT * FROM read_parquet('" + historyParquetFilePath + `') WHERE "` + HISTORY_COLUMN_IS_CURRENT + `") h`
+	return comparison
+}
+
+func testHistoryDuckdbTable(t *testing.T, writer *IcebergTableWriter, icebergSchemaColumns []*IcebergSchemaColumn, values string) string {
+	duckdbTableName := writer.createTempDuckdbTableWithColumns(icebergSchemaColumns)
+	if values != "" {
+		_, err := writer.DuckdbClient.ExecContext(context.Background(), "INSERT INTO "+duckdbTableName+" VALUES "+values)
+		if err != nil {
+			t.Fatalf("Couldn't insert rows: %v", err)
+		}
+	}
+	return duckdbTableName
+}
+
+func testHistoryParquetFile(t *testing.T, writer *IcebergTableWriter, values string) string {
+	historyDuckdbTableName := testHistoryDuckdbTable(t, writer, writer.historyIcebergSchemaColumns(), values)
+	parquetFilePath := filepath.Join(t.TempDir(), "history.parquet")
+	_, err := writer.DuckdbClient.ExecContext(context.Background(), "COPY "+historyDuckdbTableName+" TO '"+parquetFilePath+"' (FORMAT PARQUET)")
+	if err != nil {
+		t.Fatalf("Couldn't write the Parquet file: %v", err)
+	}
+	return parquetFilePath
+}
+
+func testHistoryRows(t *testing.T, writer *IcebergTableWriter, duckdbTableName string, expectedRows []string) {
+	rows, err := writer.DuckdbClient.QueryContext(context.Background(), "SELECT id, name, strftime(valid_from, '%Y-%m-%d %H:%M:%S'), strftime(valid_to, '%Y-%m-%d %H:%M:%S'), is_current FROM "+duckdbTableName+" ORDER BY id, name")
+	if err != nil {
+		t.Fatalf("Couldn't read rows: %v", err)
+	}
+	defer rows.Close()
+
+	var actualRows []string
+	for rows.Next() {
+		var id int
+		var name, validFrom string
+		var validTo *string
+		var isCurrent bool
+		err := rows.Scan(&id, &name, &validFrom, &validTo, &isCurrent)
+		if err != nil {
+			t.Fatalf("Couldn't scan a row: %v", err)
+		}
+		validToString := "<nil>"
+		if validTo != nil {
+			validToString = *validTo
+		}
+		actualRows = append(actualRows, IntToString(id)+" "+name+" "+validFrom+" "+validToString+" "+strconv.FormatBool(isCurrent))
+	}
+
+	if len(actualRows) != len(expectedRows) {
+		t.Fatalf("Expected rows %v, got %v", expectedRows, actualRows)
+	}
+	for i := range expectedRows {
+		if actualRows[i] != expectedRows[i] {
+			t.Errorf("Expected row %s, got %s", expectedRows[i], actualRows[i])
+		}
+	}
+}
@@ -2,6 +2,7 @@ package common
 
 import (
 	"context"
+	"io"
 	"os"
 	"strings"
 
@@ -14,8 +15,9 @@ import (
 )
 
 type S3Client struct {
-	Config *CommonConfig
-	S3     *s3.Client
+	Config        *CommonConfig
+	S3            *s3.Client
+	UploadLimiter *BandwidthLimiter // optional
 }
 
 func NewS3Client(Config *CommonConfig) *S3Client {
@@ -49,10 +51,15 @@ func NewS3Client(Config *CommonConfig) *S3Client {
 		}
 	})
 
-	return &S3Client{
+	s3Client := &S3Client{
 		Config: Config,
 		S3:     s3,
 	}
+	if Config.Aws.S3MaxUploadBytesPerSecond > 0 {
+		s3Client.UploadLimiter = NewBandwidthLimiter(Config.Aws.S3MaxUploadBytesPerSecond)
+	}
+
+	return s3Client
 }
 
 func (s3Client *S3Client) BucketS3Prefix() string {
@@ -92,12 +99,24 @@ func (s3Client *S3Client) GetObject(fileKey string) *s3.GetObjectOutput {
 }
 
 func (s3Client *S3Client) UploadObject(fileKey string, file *os.File) {
+	var body io.Reader = file
+	if s3Client.UploadLimiter != nil {
+		body = NewThrottledReader(file, s3Client.UploadLimiter)
+	}
+
 	uploader := manager.NewUploader(s3Client.S3)
-	_, err := uploader.Upload(context.Background(), &s3.PutObjectInput{
+	putObjectInput := &s3.PutObjectInput{
 		Bucket: aws.String(s3Client.Config.Aws.S3Bucket),
 		Key:    aws.String(fileKey),
-		Body:   file,
-	})
+		Body:   body,
+	}
+	if s3Client.Config.Aws.ServerSideEncryption != "" {
+		putObjectInput.ServerSideEncryption = types.ServerSideEncryption(s3Client.Config.Aws.ServerSideEncryption)
+	}
+	if s3Client.Config.Aws.KmsKeyId != "" {
+		putObjectInput.SSEKMSKeyId = aws.String(s3Client.Config.Aws.KmsKeyId)
+	}
+	_, err := uploader.Upload(context.Background(), putObjectInput)
 	PanicIfError(s3Client.Config, err)
 }
 
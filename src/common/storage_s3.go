@@ -86,7 +86,12 @@ func (storage *StorageS3) CreateParquet(dataS3Path string, duckdbClient *DuckdbC
 	fileS3Path := dataS3Path + "/" + fileName
 	fileS3Key := storage.S3Client.ObjectKey(fileS3Path)
 
-	storage.StorageUtils.WriteParquetFile(fileS3Path, duckdbClient, tempDuckdbTableName, icebergSchemaColumns)
+	if storage.S3Client.UploadLimiter == nil && storage.Config.Aws.ServerSideEncryption != AWS_S3_SSE_S3 {
+		storage.StorageUtils.WriteParquetFile(fileS3Path, duckdbClient, tempDuckdbTableName, icebergSchemaColumns) // SSE-KMS is set in the DuckDB secret
+	} else {
+		// Write locally first to throttle the upload or to send the SSE-S3 header, instead of letting DuckDB write directly to S3
+		storage.uploadTemporaryParquetFile(fileS3Key, duckdbClient, tempDuckdbTableName, icebergSchemaColumns)
+	}
 
 	headObjectOutput := storage.S3Client.HeadObject(fileS3Key)
 	fileSize := *headObjectOutput.ContentLength
@@ -219,6 +224,19 @@ func (storage *StorageS3) uploadTemporaryFile(tempFilePattern string, uploadFile
 	PanicIfError(storage.Config, err)
 }
 
+func (storage *StorageS3) uploadTemporaryParquetFile(uploadFileS3Key string, duckdbClient *DuckdbClient, tempDuckdbTableName string, icebergSchemaColumns []*IcebergSchemaColumn) {
+	tempFilePath := os.TempDir() + "/" + uuid.New().String() + ".parquet"
+	defer os.Remove(tempFilePath)
+
+	storage.StorageUtils.WriteParquetFile(tempFilePath, duckdbClient, tempDuckdbTableName, icebergSchemaColumns)
+
+	tempFile, err := os.Open(tempFilePath)
+	PanicIfError(storage.Config, err)
+	defer tempFile.Close()
+
+	storage.S3Client.UploadObject(uploadFileS3Key, tempFile)
+}
+
 func (storage *StorageS3) readObjectContent(fileS3Path string) []byte {
 	fileS3Key := storage.S3Client.ObjectKey(fileS3Path)
 	getObjectResponse := storage.S3Client.GetObject(fileS3Key)
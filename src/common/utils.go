@@ -55,26 +55,33 @@ func StringToFloat64(s string) float64 {
 	return floatValue
 }
 
-func StringDateToTime(str string) time.Time {
+func StringDateToTime(str string) (time.Time, error) {
 	// Golang's time.Parse() function does not support parsing dates with 5+ digit years
 	// So we need to handle this case manually by parsing the year separately
 	var nonStandardYear int
 	parts := strings.Split(str, "-")
 	if len(parts) == 3 && len(parts[0]) > 4 {
-		nonStandardYear = StringToInt(parts[0])
+		var err error
+		nonStandardYear, err = strconv.Atoi(parts[0])
+		if err != nil {
+			return time.Time{}, err
+		}
 		str = str[len(parts[0])-4:] // Remove the prefix from str leaving only the standard 10 characters (YYYY-MM-DD)
 	}
 
 	// Parse the date string as a standard date
 	parsedTime, err := time.Parse("2006-01-02", str)
+	if err != nil {
+		return time.Time{}, err
+	}
 
 	// If the year is non-standard, add the year difference to the parsed time after parsing
-	if err == nil && nonStandardYear != 0 {
+	if nonStandardYear != 0 {
 		parsedTime = parsedTime.AddDate(nonStandardYear-parsedTime.Year(), 0, 0)
-		return parsedTime
+		return parsedTime, nil
 	}
 
-	return parsedTime
+	return parsedTime, nil
 }
 
 func HexToString(s string) (string, error) {
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgproto3"
+
+	"github.com/BemiHQ/BemiDB/src/common"
+)
+
+const CANARY_WEBHOOK_TIMEOUT = 5 * time.Second
+
+// A query with the expected result shape, configured by operators to catch remapper or catalog regressions
+type CanaryQuery struct {
+	Name            string   `json:"name"`
+	Query           string   `json:"query"`
+	Columns         []string `json:"columns,omitempty"`         // Expected column names in order, not checked if empty
+	RowCount        *int     `json:"rowCount,omitempty"`        // Expected number of rows, not checked if null
+	LatencyBudgetMs int      `json:"latencyBudgetMs,omitempty"` // Not checked if 0
+}
+
+type CanaryAlert struct {
+	Canary  string `json:"canary"`
+	Failing bool   `json:"failing"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Runs the canary queries on a schedule through the query handler like client queries.
+// The server isn't ready while any of them is failing
+type CanaryRunner struct {
+	mutex        sync.Mutex
+	config       *Config
+	queryHandler *QueryHandler
+	failures     map[string]string // Canary name -> error
+}
+
+func NewCanaryRunner(config *Config, queryHandler *QueryHandler) *CanaryRunner {
+	return &CanaryRunner{config: config, queryHandler: queryHandler, failures: make(map[string]string)}
+}
+
+func (runner *CanaryRunner) Run() {
+	if len(runner.config.Canaries) == 0 {
+		return
+	}
+
+	for {
+		for _, canary := range runner.config.Canaries {
+			runner.recordResult(canary, runner.runCanary(canary))
+		}
+		time.Sleep(time.Duration(runner.config.CanaryIntervalSeconds) * time.Second)
+	}
+}
+
+// Canary name -> error of the currently failing canaries
+func (runner *CanaryRunner) Failures() map[string]string {
+	runner.mutex.Lock()
+	defer runner.mutex.Unlock()
+
+	return maps.Clone(runner.failures)
+}
+
+func (runner *CanaryRunner) runCanary(canary CanaryQuery) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("unexpected error: %v", r)
+		}
+	}()
+
+	startedAt := time.Now()
+	messages, err := runner.queryHandler.WithNewSession().HandleSimpleQuery(canary.Query)
+	duration := time.Since(startedAt)
+	if err != nil {
+		return err
+	}
+
+	var columns []string
+	rowCount := 0
+	for _, message := range messages {
+		switch message := message.(type) {
+		case *pgproto3.RowDescription:
+			columns = columns[:0]
+			for _, field := range message.Fields {
+				columns = append(columns, string(field.Name))
+			}
+		case *pgproto3.DataRow:
+			rowCount++
+		}
+	}
+
+	if len(canary.Columns) > 0 && !slices.Equal(columns, canary.Columns) {
+		return fmt.Errorf("expected columns %v, got %v", canary.Columns, columns)
+	}
+	if canary.RowCount != nil && rowCount != *canary.RowCount {
+		return fmt.Errorf("expected %d rows, got %d", *canary.RowCount, rowCount)
+	}
+	if canary.LatencyBudgetMs > 0 && duration > time.Duration(canary.LatencyBudgetMs)*time.Millisecond {
+		return fmt.Errorf("took %s, over the latency budget of %dms", duration.Round(time.Millisecond), canary.LatencyBudgetMs)
+	}
+	return nil
+}
+
+func (runner *CanaryRunner) recordResult(canary CanaryQuery, err error) {
+	runner.mutex.Lock()
+	_, wasFailing := runner.failures[canary.Name]
+	if err != nil {
+		runner.failures[canary.Name] = err.Error()
+	} else {
+		delete(runner.failures, canary.Name)
+	}
+	runner.mutex.Unlock()
+
+	switch {
+	case err != nil && !wasFailing:
+		common.LogError(runner.config.CommonConfig, "Canary query", canary.Name, "started failing:", err)
+		runner.sendAlert(CanaryAlert{Canary: canary.Name, Failing: true, Error: err.Error()})
+	case err != nil:
+		common.LogDebug(runner.config.CommonConfig, "Canary query", canary.Name, "is still failing:", err)
+	case wasFailing:
+		common.LogInfo(runner.config.CommonConfig, "Canary query", canary.Name, "recovered")
+		runner.sendAlert(CanaryAlert{Canary: canary.Name, Failing: false})
+	}
+}
+
+func (runner *CanaryRunner) sendAlert(alert CanaryAlert) {
+	if runner.config.CanaryWebhookUrl == "" {
+		return
+	}
+
+	jsonData, err := json.Marshal(alert)
+	common.PanicIfError(runner.config.CommonConfig, err)
+
+	client := http.Client{Timeout: CANARY_WEBHOOK_TIMEOUT}
+	response, err := client.Post(runner.config.CanaryWebhookUrl, "application/json", bytes.NewBuffer(jsonData))
+	if err != nil {
+		common.LogWarn(runner.config.CommonConfig, "Couldn't send canary alert:", err)
+		return
+	}
+	response.Body.Close()
+}
+
+// GET /healthz -> 200 while the process is running
+// GET /readyz -> 200 if all canary queries pass, otherwise 503 with the failing canaries
+func (runner *CanaryRunner) ServeHealth() {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(writer http.ResponseWriter, request *http.Request) {
+		writer.Write([]byte("ok\n"))
+	})
+	mux.HandleFunc("/readyz", func(writer http.ResponseWriter, request *http.Request) {
+		failures := runner.Failures()
+		if len(failures) == 0 {
+			writer.Write([]byte("ok\n"))
+			return
+		}
+
+		writer.WriteHeader(http.StatusServiceUnavailable)
+		for _, name := range slices.Sorted(maps.Keys(failures)) {
+			fmt.Fprintf(writer, "canary %s: %s\n", name, failures[name])
+		}
+	})
+
+	err := http.ListenAndServe(":"+runner.config.HealthPort, mux)
+	common.LogError(runner.config.CommonConfig, "Health endpoints stopped:", err)
+}
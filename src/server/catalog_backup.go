@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/BemiHQ/BemiDB/src/common"
+)
+
+// bemidb backup-catalog catalog.json -> writes the tables, views, schemas, and syncer states of the catalog to the file
+func BackupCatalog(config *Config, filePath string) {
+	if filePath == "" {
+		panic("Usage: " + COMMAND_BACKUP_CATALOG + " <file>")
+	}
+
+	backup, err := common.NewIcebergCatalog(config.CommonConfig).Backup()
+	common.PanicIfError(config.CommonConfig, err)
+
+	backupJson, err := json.MarshalIndent(backup, "", "  ")
+	common.PanicIfError(config.CommonConfig, err)
+
+	err = os.WriteFile(filePath, append(backupJson, '\n'), 0600)
+	common.PanicIfError(config.CommonConfig, err)
+
+	common.LogInfo(config.CommonConfig, "Backed up", len(backup.Tables), "tables,", len(backup.MaterializedViews), "materialized views,", len(backup.Views), "views,", len(backup.Schemas), "schemas,", len(backup.CreatedTables), "created tables, and", len(backup.SyncerStates), "syncer states to", filePath)
+}
+
+// bemidb restore-catalog catalog.json -> replaces the catalog with the backup file, e.g. to clone an environment.
+// Backups of version 1 don't contain views, schemas, table partitions, and created tables, which are kept as is.
+func RestoreCatalog(config *Config, filePath string) {
+	if filePath == "" {
+		panic("Usage: " + COMMAND_RESTORE_CATALOG + " <file>")
+	}
+
+	backupJson, err := os.ReadFile(filePath)
+	common.PanicIfError(config.CommonConfig, err)
+
+	var backup common.CatalogBackup
+	err = json.Unmarshal(backupJson, &backup)
+	if err != nil {
+		panic("Invalid catalog backup file: " + err.Error())
+	}
+
+	err = common.NewIcebergCatalog(config.CommonConfig).Restore(backup)
+	common.PanicIfError(config.CommonConfig, err)
+
+	common.LogInfo(config.CommonConfig, "Restored", len(backup.Tables), "tables,", len(backup.MaterializedViews), "materialized views,", len(backup.Views), "views,", len(backup.Schemas), "schemas,", len(backup.CreatedTables), "created tables, and", len(backup.SyncerStates), "syncer states from", filePath)
+}
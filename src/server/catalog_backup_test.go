@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/BemiHQ/BemiDB/src/common"
+)
+
+func TestCatalogBackup(t *testing.T) {
+	t.Run("Restores the catalog from a backup", func(t *testing.T) {
+		catalog := testCatalogWithRestoredBackup(t)
+		backup := testCatalogBackup()
+
+		err := catalog.Restore(backup)
+		testNoError(t, err)
+
+		restoredBackup, err := catalog.Backup()
+		testNoError(t, err)
+		testCatalogBackupContents(t, restoredBackup, backup)
+	})
+
+	t.Run("Keeps the catalog tables missing in a version 1 backup", func(t *testing.T) {
+		catalog := testCatalogWithRestoredBackup(t)
+		backup := testCatalogBackup()
+		testNoError(t, catalog.Restore(backup))
+
+		err := catalog.Restore(common.CatalogBackup{Version: 1, SyncerStates: backup.SyncerStates})
+		testNoError(t, err)
+
+		restoredBackup, err := catalog.Backup()
+		testNoError(t, err)
+		expectedBackup := backup
+		expectedBackup.Tables = []common.CatalogBackupTable{}
+		expectedBackup.MaterializedViews = []common.CatalogBackupMaterializedView{}
+		testCatalogBackupContents(t, restoredBackup, expectedBackup)
+	})
+
+	t.Run("Returns an error for a backup of an unsupported version", func(t *testing.T) {
+		catalog := common.NewIcebergCatalog(loadTestConfig().CommonConfig)
+
+		err := catalog.Restore(common.CatalogBackup{Version: common.CATALOG_BACKUP_VERSION + 1})
+
+		if err == nil || err.Error() != "unsupported catalog backup version 3, expected 2 or lower" {
+			t.Errorf("Expected an unsupported version error, got %v", err)
+		}
+	})
+}
+
+// Restores the original catalog after the test
+func testCatalogWithRestoredBackup(t *testing.T) *common.IcebergCatalog {
+	catalog := common.NewIcebergCatalog(loadTestConfig().CommonConfig)
+	originalBackup, err := catalog.Backup()
+	testNoError(t, err)
+	t.Cleanup(func() { testNoError(t, catalog.Restore(originalBackup)) })
+	return catalog
+}
+
+func testCatalogBackup() common.CatalogBackup {
+	metadataLocation := "s3://bucket/iceberg/test_backup/orders/metadata/v1.metadata.json"
+	return common.CatalogBackup{
+		Version: common.CATALOG_BACKUP_VERSION,
+		Tables: []common.CatalogBackupTable{
+			{Schema: "test_backup", Table: "orders", MetadataLocation: &metadataLocation, Columns: json.RawMessage(`[{"name": "id"}]`)},
+			{Schema: "test_backup", Table: "orders_2024", MetadataLocation: &metadataLocation},
+			{Schema: "test_backup", Table: "orders_copy", MetadataLocation: &metadataLocation},
+		},
+		MaterializedViews: []common.CatalogBackupMaterializedView{{Schema: "test_backup", Table: "order_totals", Definition: "SELECT COUNT(*) FROM test_backup.orders"}},
+		Views:             []common.CatalogBackupView{{Schema: "test_backup", Table: "recent_orders", Definition: "SELECT * FROM test_backup.orders"}},
+		TablePartitions:   []common.CatalogBackupTablePartition{{Schema: "test_backup", Table: "orders", PartitionTable: "orders_2024"}},
+		Schemas:           []string{"test_backup_empty"},
+		CreatedTables:     []common.CatalogBackupCreatedTable{{Schema: "test_backup", Table: "orders_copy"}},
+		SyncerStates:      []common.CatalogBackupSyncerState{{Schema: "test_backup", Name: "drift-check", State: json.RawMessage(`{"synced": true}`)}},
+	}
+}
+
+func testCatalogBackupContents(t *testing.T, backup common.CatalogBackup, expectedBackup common.CatalogBackup) {
+	for i := range backup.SyncerStates {
+		backup.SyncerStates[i].UpdatedAt = time.Time{}
+	}
+	backup.Version = expectedBackup.Version
+	backup.CreatedAt = expectedBackup.CreatedAt
+
+	backupJson, _ := json.Marshal(backup)
+	expectedBackupJson, _ := json.Marshal(expectedBackup)
+	var actual, expected map[string]any
+	json.Unmarshal(backupJson, &actual)
+	json.Unmarshal(expectedBackupJson, &expected)
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected the catalog %s, got %s", expectedBackupJson, backupJson)
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BemiHQ/BemiDB/src/common"
+)
+
+const BEMIDB_TABLE_BROKEN_TABLES = "broken_tables"
+
+type BrokenTable struct {
+	IcebergSchemaTable common.IcebergSchemaTable
+	Problem            string
+	CheckedAt          time.Time
+}
+
+// Verifies that the Iceberg metadata and data files of the tables in the catalog can be read from object storage and that their columns match the catalog.
+// Broken tables are listed in bemidb.broken_tables instead of being found by queries failing with DuckDB errors
+type CatalogChecker struct {
+	mutex         sync.Mutex
+	config        *Config
+	icebergReader *IcebergReader
+	duckdbClient  *common.DuckdbClient
+	brokenTables  []BrokenTable // From the last check
+}
+
+func NewCatalogChecker(config *Config, icebergReader *IcebergReader, duckdbClient *common.DuckdbClient) *CatalogChecker {
+	return &CatalogChecker{
+		config:        config,
+		icebergReader: icebergReader,
+		duckdbClient:  duckdbClient,
+	}
+}
+
+// Checks all tables and materialized views, replacing the results of the previous check
+func (checker *CatalogChecker) CheckAll() ([]BrokenTable, error) {
+	icebergSchemaTables, err := checker.icebergReader.SchemaTables()
+	if err != nil {
+		return nil, err
+	}
+
+	sortedSchemaTables := icebergSchemaTables.Values()
+	slices.SortFunc(sortedSchemaTables, common.CompareIcebergSchemaTables)
+
+	brokenTables := []BrokenTable{}
+	for _, icebergSchemaTable := range sortedSchemaTables {
+		err := checker.checkTable(icebergSchemaTable)
+		if err != nil {
+			common.LogWarn(checker.config.CommonConfig, "Catalog check: table", icebergSchemaTable.String(), "is broken:", err)
+			brokenTables = append(brokenTables, BrokenTable{IcebergSchemaTable: icebergSchemaTable, Problem: err.Error(), CheckedAt: time.Now()})
+		}
+	}
+	common.LogInfo(checker.config.CommonConfig, "Catalog check: found", len(brokenTables), "broken tables out of", len(sortedSchemaTables))
+
+	checker.mutex.Lock()
+	defer checker.mutex.Unlock()
+	checker.brokenTables = brokenTables
+	return brokenTables, nil
+}
+
+func (checker *CatalogChecker) BrokenTables() []BrokenTable {
+	checker.mutex.Lock()
+	defer checker.mutex.Unlock()
+
+	return slices.Clone(checker.brokenTables)
+}
+
+// Problem found by the last check if the table is broken
+func (checker *CatalogChecker) BrokenTable(icebergSchemaTable common.IcebergSchemaTable) (BrokenTable, bool) {
+	checker.mutex.Lock()
+	defer checker.mutex.Unlock()
+
+	for _, brokenTable := range checker.brokenTables {
+		if brokenTable.IcebergSchemaTable == icebergSchemaTable {
+			return brokenTable, true
+		}
+	}
+	return BrokenTable{}, false
+}
+
+func (checker *CatalogChecker) checkTable(icebergSchemaTable common.IcebergSchemaTable) error {
+	ctx := context.Background()
+	metadataPath := checker.icebergReader.MetadataFileS3Path(icebergSchemaTable)
+
+	// Metadata file, manifest list, and manifests
+	dataFilePaths, err := checker.queryStrings(ctx, "SELECT file_path FROM iceberg_metadata("+quoteSqlString(metadataPath)+") WHERE status != 'DELETED'")
+	if err != nil {
+		return fmt.Errorf("couldn't read Iceberg metadata %s: %w", metadataPath, err)
+	}
+
+	// Data files, listed once per directory
+	existingFilePaths := common.NewSet[string]()
+	listedDirectories := common.NewSet[string]()
+	for _, dataFilePath := range dataFilePaths {
+		directory := path.Dir(dataFilePath)
+		if listedDirectories.Contains(directory) {
+			continue
+		}
+		listedDirectories.Add(directory)
+
+		filePaths, err := checker.queryStrings(ctx, "SELECT file FROM glob("+quoteSqlString(directory+"/*")+")")
+		if err != nil {
+			return fmt.Errorf("couldn't list data files in %s: %w", directory, err)
+		}
+		existingFilePaths.AddAll(filePaths)
+	}
+	missingFilePaths := []string{}
+	for _, dataFilePath := range dataFilePaths {
+		if !existingFilePaths.Contains(dataFilePath) {
+			missingFilePaths = append(missingFilePaths, dataFilePath)
+		}
+	}
+	if len(missingFilePaths) > 0 {
+		return fmt.Errorf("%d of %d data files are missing, e.g. %s", len(missingFilePaths), len(dataFilePaths), missingFilePaths[0])
+	}
+
+	// Columns of the current Iceberg schema
+	icebergColumnNames, err := checker.queryStrings(ctx, "SELECT column_name FROM (DESCRIBE SELECT * FROM iceberg_scan("+quoteSqlString(metadataPath)+"))")
+	if err != nil {
+		return fmt.Errorf("couldn't read Iceberg schema: %w", err)
+	}
+	catalogTableColumns, err := checker.icebergReader.TableColumns(icebergSchemaTable)
+	if err != nil {
+		return fmt.Errorf("couldn't read catalog columns: %w", err)
+	}
+	catalogColumnNames := make([]string, len(catalogTableColumns))
+	for i, catalogTableColumn := range catalogTableColumns {
+		catalogColumnNames[i] = catalogTableColumn.Name
+	}
+	if len(catalogColumnNames) > 0 && !slices.Equal(icebergColumnNames, catalogColumnNames) {
+		return fmt.Errorf("columns of the Iceberg schema (%s) don't match the catalog columns (%s)", strings.Join(icebergColumnNames, ", "), strings.Join(catalogColumnNames, ", "))
+	}
+
+	return nil
+}
+
+func (checker *CatalogChecker) queryStrings(ctx context.Context, query string) ([]string, error) {
+	rows, err := checker.duckdbClient.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	values := []string{}
+	for rows.Next() {
+		var value string
+		err := rows.Scan(&value)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, rows.Err()
+}
+
+// bemidb check-catalog -> logs broken tables, false if there are any, e.g. to verify a restored catalog backup
+func CheckCatalog(config *Config) bool {
+	duckdbClient := common.NewDuckdbClient(config.CommonConfig, duckdbBootQueris(config))
+	defer duckdbClient.Close()
+
+	icebergReader := NewIcebergReader(config, common.NewIcebergCatalog(config.CommonConfig))
+	brokenTables, err := NewCatalogChecker(config, icebergReader, duckdbClient).CheckAll()
+	common.PanicIfError(config.CommonConfig, err)
+
+	return len(brokenTables) == 0
+}
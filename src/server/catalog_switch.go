@@ -0,0 +1,107 @@
+package main
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/BemiHQ/BemiDB/src/common"
+)
+
+const (
+	CATALOG_PRIMARY   = "primary"
+	CATALOG_CANDIDATE = "candidate"
+)
+
+// Remappers reading tables from one of the catalog databases
+type CatalogRemappers struct {
+	remapperTable    *QueryRemapperTable
+	remapperFunction *QueryRemapperFunction
+	icebergReader    *IcebergReader
+	icebergWriter    *IcebergWriter
+}
+
+// Switches sessions between the primary catalog and a candidate catalog (e.g., with a migrated schema or a large backfill)
+// to validate it before cutting over. Sessions can use a catalog with SET bemidb.catalog, and ALTER SYSTEM SET bemidb.catalog
+// changes the active catalog of all other sessions at once. Only the tables of the active catalog are listed in pg_class,
+// information_schema, etc.
+type CatalogSwitch struct {
+	mutex    sync.Mutex
+	config   *Config
+	active   string
+	catalogs map[string]*CatalogRemappers
+}
+
+func NewCatalogSwitch(config *Config, primaryCatalog *CatalogRemappers) *CatalogSwitch {
+	return &CatalogSwitch{
+		config:   config,
+		active:   CATALOG_PRIMARY,
+		catalogs: map[string]*CatalogRemappers{CATALOG_PRIMARY: primaryCatalog},
+	}
+}
+
+// Reads the tables of the catalog database at BEMIDB_CANDIDATE_CATALOG_DATABASE_URL, from the same bucket
+func (catalogSwitch *CatalogSwitch) AddCandidate(storageS3 *common.StorageS3, lockTracker *LockTracker, connectionLog *ConnectionLog, serverDuckdbClient *common.DuckdbClient) {
+	candidateCommonConfig := *catalogSwitch.config.CommonConfig
+	candidateCommonConfig.CatalogDatabaseUrl = catalogSwitch.config.CandidateCatalogDatabaseUrl
+
+	icebergCatalog := common.NewIcebergCatalog(&candidateCommonConfig)
+	icebergReader := NewIcebergReader(catalogSwitch.config, icebergCatalog)
+
+	catalogSwitch.mutex.Lock()
+	defer catalogSwitch.mutex.Unlock()
+	catalogSwitch.catalogs[CATALOG_CANDIDATE] = &CatalogRemappers{
+		remapperTable:    NewCandidateQueryRemapperTable(catalogSwitch.config, icebergReader, lockTracker, connectionLog, serverDuckdbClient),
+		remapperFunction: NewQueryRemapperFunction(catalogSwitch.config, icebergReader),
+		icebergReader:    icebergReader,
+		icebergWriter:    NewIcebergWriter(catalogSwitch.config, storageS3, serverDuckdbClient, icebergCatalog, lockTracker),
+	}
+	common.LogInfo(catalogSwitch.config.CommonConfig, "Attached the candidate catalog")
+}
+
+// The catalog set for the session with SET bemidb.catalog, or the active one
+func (catalogSwitch *CatalogSwitch) CatalogFor(session *Session) (string, *CatalogRemappers) {
+	catalogSwitch.mutex.Lock()
+	defer catalogSwitch.mutex.Unlock()
+
+	name := session.Catalog
+	if name == "" {
+		name = catalogSwitch.active
+	}
+	return name, catalogSwitch.catalogs[name]
+}
+
+func (catalogSwitch *CatalogSwitch) Has(name string) bool {
+	catalogSwitch.mutex.Lock()
+	defer catalogSwitch.mutex.Unlock()
+
+	_, ok := catalogSwitch.catalogs[name]
+	return ok
+}
+
+// primary, candidate
+func (catalogSwitch *CatalogSwitch) Names() string {
+	catalogSwitch.mutex.Lock()
+	defer catalogSwitch.mutex.Unlock()
+
+	names := []string{CATALOG_PRIMARY}
+	if _, ok := catalogSwitch.catalogs[CATALOG_CANDIDATE]; ok {
+		names = append(names, CATALOG_CANDIDATE)
+	}
+	return strings.Join(names, ", ")
+}
+
+// Switches all sessions without SET bemidb.catalog to the catalog and lists its tables in the system tables instead.
+// Sessions picking their catalog for the next query wait until the switch is done.
+func (catalogSwitch *CatalogSwitch) Activate(name string) {
+	catalogSwitch.mutex.Lock()
+	defer catalogSwitch.mutex.Unlock()
+
+	catalog, ok := catalogSwitch.catalogs[name]
+	if !ok || name == catalogSwitch.active {
+		return
+	}
+
+	catalogSwitch.catalogs[catalogSwitch.active].remapperTable.SwitchSystemTablesTo(catalog.remapperTable)
+	common.LogInfo(catalogSwitch.config.CommonConfig, "Switched the active catalog from", catalogSwitch.active, "to", name)
+	catalogSwitch.active = name
+}
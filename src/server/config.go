@@ -1,11 +1,20 @@
 package main
 
 import (
+	"crypto/tls"
+	"encoding/json"
 	"flag"
+	"maps"
+	"net"
+	"net/netip"
 	"os"
+	"regexp"
 	"slices"
+	"strconv"
 	"strings"
 
+	pgQuery "github.com/pganalyze/pg_query_go/v6"
+
 	"github.com/BemiHQ/BemiDB/src/common"
 )
 
@@ -16,13 +25,98 @@ const (
 	ENV_PASSWORD = "BEMIDB_PASSWORD"
 	ENV_HOST     = "BEMIDB_HOST"
 
+	ENV_DATABASES  = "BEMIDB_DATABASES"
+	ENV_USERS      = "BEMIDB_USERS"
+	ENV_USERS_FILE = "BEMIDB_USERS_FILE"
+
+	ENV_SCRAM_SALT_SECRET = "BEMIDB_SCRAM_SALT_SECRET"
+
+	ENV_PERMISSIONS_FILE = "BEMIDB_PERMISSIONS_FILE"
+	ENV_ROW_FILTERS_FILE = "BEMIDB_ROW_FILTERS_FILE"
+
+	ENV_TCP_KEEPALIVE_SECONDS = "BEMIDB_TCP_KEEPALIVE_SECONDS"
+	ENV_WRITE_TIMEOUT_SECONDS = "BEMIDB_WRITE_TIMEOUT_SECONDS"
+	ENV_IDLE_TIMEOUT_SECONDS  = "BEMIDB_IDLE_TIMEOUT_SECONDS"
+	ENV_MAX_SESSION_AGE       = "BEMIDB_MAX_SESSION_AGE_SECONDS"
+	ENV_UNIX_SOCKET_DIR       = "BEMIDB_UNIX_SOCKET_DIR"
+	ENV_ALLOWED_IPS           = "BEMIDB_ALLOWED_IPS"
+	ENV_DENIED_IPS            = "BEMIDB_DENIED_IPS"
+	ENV_HBA_FILE              = "BEMIDB_HBA_FILE"
+	ENV_UNIX_SOCKET_MODE      = "BEMIDB_UNIX_SOCKET_PERMISSIONS"
+	ENV_DUCKDB_INIT_SQL       = "BEMIDB_DUCKDB_INIT_SQL"
+	ENV_TLS_CERT_FILE         = "BEMIDB_TLS_CERT_FILE"
+	ENV_TLS_KEY_FILE          = "BEMIDB_TLS_KEY_FILE"
+	ENV_TLS_SELF_SIGNED       = "BEMIDB_TLS_SELF_SIGNED"
+	ENV_TLS_REQUIRED          = "BEMIDB_TLS_REQUIRED"
+	ENV_STORAGE_ACCESS_LOG    = "BEMIDB_STORAGE_ACCESS_LOG"
+	ENV_CHECK_CATALOG         = "BEMIDB_CHECK_CATALOG_ON_START"
+	ENV_STORAGE_SOFT_BUDGET   = "BEMIDB_STORAGE_SOFT_BUDGET_BYTES"
+	ENV_STORAGE_HARD_BUDGET   = "BEMIDB_STORAGE_HARD_BUDGET_BYTES"
+	ENV_STORAGE_LATENCY       = "BEMIDB_STORAGE_LATENCY_NOTICE_MS"
+	ENV_PINNED_TABLES         = "BEMIDB_PINNED_TABLES"
+	ENV_SAMPLE_ROWS           = "BEMIDB_SAMPLE_ROWS"
+	ENV_SAMPLE_REFRESH        = "BEMIDB_SAMPLE_REFRESH_SECONDS"
+	ENV_STORAGE_SECRETS_FILE  = "BEMIDB_STORAGE_SECRETS_FILE"
+	ENV_MEMORY_PRESSURE       = "BEMIDB_MEMORY_PRESSURE_PERCENT"
+	ENV_SESSION_CHECKPOINT    = "BEMIDB_SESSION_CHECKPOINT_TTL_SECONDS"
+	ENV_STATEMENT_TIMEOUT     = "BEMIDB_STATEMENT_TIMEOUT_MS"
+	ENV_HEALTH_PORT           = "BEMIDB_HEALTH_PORT"
+	ENV_CANARY_QUERIES_FILE   = "BEMIDB_CANARY_QUERIES_FILE"
+	ENV_CANARY_INTERVAL       = "BEMIDB_CANARY_INTERVAL_SECONDS"
+	ENV_CANARY_WEBHOOK_URL    = "BEMIDB_CANARY_ALERT_WEBHOOK_URL"
+	ENV_QUERY_HOOK_URL        = "BEMIDB_QUERY_HOOK_WEBHOOK_URL"
+	ENV_QUERY_HOOK_ROWS       = "BEMIDB_QUERY_HOOK_ROW_THRESHOLD"
+	ENV_CANDIDATE_CATALOG_URL = "BEMIDB_CANDIDATE_CATALOG_DATABASE_URL"
+	ENV_QUERY_REWRITE_RULES   = "BEMIDB_QUERY_REWRITE_RULES_FILE"
+	ENV_IDENTIFIER_CASE       = "BEMIDB_IDENTIFIER_CASE"
+
+	ENV_MAX_PARALLEL_DOWNLOADS = "BEMIDB_MAX_PARALLEL_DOWNLOADS"
+	ENV_S3_PREFETCH            = "BEMIDB_S3_PREFETCH"
+	ENV_S3_HTTP_RETRIES        = "BEMIDB_S3_HTTP_RETRIES"
+	ENV_S3_HTTP_RETRY_WAIT_MS  = "BEMIDB_S3_HTTP_RETRY_WAIT_MS"
+	ENV_S3_HTTP_TIMEOUT        = "BEMIDB_S3_HTTP_TIMEOUT_SECONDS"
+
 	DEFAULT_LOG_LEVEL       = "INFO"
 	DEFAULT_HOST            = "0.0.0.0"
 	DEFAULT_PORT            = "54321"
 	DEFAULT_DATABASE        = "bemidb"
 	DEFAULT_AWS_S3_ENDPOINT = "s3.amazonaws.com"
+
+	DEFAULT_TCP_KEEPALIVE_SECONDS   = 30
+	DEFAULT_WRITE_TIMEOUT_SECONDS   = 60
+	DEFAULT_UNIX_SOCKET_PERMISSIONS = "0777"
+	DEFAULT_CANARY_INTERVAL_SECONDS = 60
+	DEFAULT_SAMPLE_REFRESH_SECONDS  = 3600
+	DEFAULT_MAX_PARALLEL_DOWNLOADS  = 2
+
+	S3_PREFETCH_AUTO = "auto" // DuckDB prefetches the row groups of remote Parquet files it scans
+	S3_PREFETCH_ALL  = "all"  // Always prefetches whole row groups, e.g. for wide scans over high-latency storage
+	S3_PREFETCH_OFF  = "off"  // Reads only the requested column chunks, e.g. for very selective queries on wide tables
+
+	IDENTIFIER_CASE_DUCKDB   = "duckdb"   // Matches identifiers case-insensitively
+	IDENTIFIER_CASE_POSTGRES = "postgres" // Matches identifiers exactly after folding unquoted identifiers to lowercase
+
+	ROW_FILTER_USER_ATTRIBUTE = "user"
 )
 
+var ROW_FILTER_PLACEHOLDER_REGEXP = regexp.MustCompile(`\{\{\s*(\w+)\s*\}\}`)
+
+// S3 credentials for tables stored outside of the configured bucket, e.g. in another bucket or AWS account
+type StorageSecret struct {
+	Scope           string `json:"scope"` // s3://bucket or s3://bucket/prefix, the longest matching scope is used
+	AccessKeyId     string `json:"accessKeyId"`
+	SecretAccessKey string `json:"secretAccessKey"`
+	SessionToken    string `json:"sessionToken,omitempty"`
+	Region          string `json:"region,omitempty"`   // Default: AWS_REGION
+	Endpoint        string `json:"endpoint,omitempty"` // Default: AWS_S3_ENDPOINT
+}
+
+// Per-table filter expressions injected into every read of the tables by users with attributes
+type RowFilters struct {
+	Tables map[string]string            `json:"tables"` // "schema.table" or "schema.*" -> filter expression with {{attribute}} placeholders, e.g. "tenant_id = {{tenant_id}}"
+	Users  map[string]map[string]string `json:"users"`  // User ("*" for other users) -> attribute -> value, unlisted users are unrestricted
+}
+
 type Config struct {
 	CommonConfig      *common.CommonConfig
 	Host              string
@@ -30,10 +124,83 @@ type Config struct {
 	Database          string
 	User              string
 	EncryptedPassword string
+	Users             map[string]string              // Additional user -> SCRAM-SHA-256 verifier, e.g. for BI service accounts
+	Databases         map[string][]string            // Additional logical database name -> exposed schemas
+	Permissions       map[string]map[string][]string // User ("*" for other users) -> "schema.table" or "schema.*" -> permitted columns ("*" for all), nil if unrestricted
+	RowFilters        RowFilters
+	UnixSocketDir     string         // Directory for the .s.PGSQL.<port> socket next to the TCP listener, empty disables it
+	AllowedNetworks   []netip.Prefix // TCP clients must connect from one of them, all are allowed if empty
+	DeniedNetworks    []netip.Prefix // TCP clients can't connect from them, takes precedence over AllowedNetworks
+	HbaRules          []HbaRule      // First matching rule decides how clients authenticate, nil if all clients use passwords
+	UnixSocketMode    os.FileMode
+
+	TcpKeepaliveSeconds  int // 0 disables TCP keepalive probes
+	WriteTimeoutSeconds  int // 0 disables write deadlines
+	IdleTimeoutSeconds   int // Connections waiting for the next query longer are closed, 0 disables the timeout
+	MaxSessionAgeSeconds int // Connections are closed after their running query once they are older, 0 disables the limit
+	DuckdbInitSql        string
+	TlsConfig            *tls.Config // nil if TLS is disabled
+	TlsRequired          bool        // Reject TCP connections without TLS
+	StorageAccessLog     bool        // Log object storage reads of each query with the session labels
+	CheckCatalogOnStart  bool        // Check the files and columns of all tables in the background for bemidb.broken_tables
+
+	StorageSoftBudgetBytes int64 // Bytes read from object storage per user and day before warnings, 0 disables the budget
+	StorageHardBudgetBytes int64 // Bytes read from object storage per user and day before rejecting queries, 0 disables the budget
+
+	StorageLatencyNoticeMs int // Time a query spends mostly scanning object storage before it returns a notice, 0 disables profiling queries
+
+	PinnedTables                 []common.IcebergSchemaTable // Small tables kept in memory in DuckDB
+	SampleRows                   int                         // Rows of the samples of larger tables kept in DuckDB for SET bemidb.sample_tables = on and bemidb_sample('table'), 0 disables samples
+	SampleRefreshIntervalSeconds int                         // Interval of resampling the tables that changed
+
+	StorageSecrets []StorageSecret // Created as DuckDB secrets scoped to their paths next to the default secret of the bucket
+
+	MemoryPressurePercent int // DuckDB or OS memory usage at which new Iceberg queries are queued, 0 disables queueing
+
+	SessionCheckpointTtlSeconds int // Prepared statements of disconnected sessions with a session token are kept for, 0 disables checkpoints
+
+	StatementTimeoutMs int // Default statement_timeout of sessions, 0 disables the timeout
+
+	HealthPort            string        // Port for the /healthz and /readyz HTTP endpoints, empty disables them
+	Canaries              []CanaryQuery // Queries run on a schedule to check that the server answers them as expected
+	CanaryIntervalSeconds int
+	CanaryWebhookUrl      string // Receives a POST request when a canary query starts failing or recovers
+
+	MaxParallelDownloads int    // DuckDB threads, each scanning a Parquet row group with its own range requests
+	S3Prefetch           string // auto, all, or off
+	S3HttpRetries        int    // Retries of failed S3 requests, 0 uses the DuckDB default
+	S3HttpRetryWaitMs    int    // Wait before the first retry, 0 uses the DuckDB default
+	S3HttpTimeoutSeconds int    // Timeout of S3 requests, 0 uses the DuckDB default
+
+	QueryHookWebhookUrl   string // Receives a POST request before and after each query reading tables, can reject the query
+	QueryHookRowThreshold int64  // Queries returning at least this many rows from tables are logged as anomalous, 0 disables it
+
+	CandidateCatalogDatabaseUrl string // Second catalog to switch to with SET bemidb.catalog = candidate, empty if not attached
+
+	QueryRewriteRules []QueryRewriteRule // First matching rule rewrites a query before it's remapped
+
+	IdentifierCase string // duckdb or postgres
 }
 
 type configParseValues struct {
-	password string
+	password           string
+	scramSaltSecret    string
+	users              string
+	usersFile          string
+	permissionsFile    string
+	rowFiltersFile     string
+	databases          string
+	allowedIps         string
+	deniedIps          string
+	hbaFile            string
+	tlsCertFile        string
+	tlsKeyFile         string
+	tlsSelfSigned      bool
+	pinnedTables       string
+	storageSecretsFile string
+	unixSocketMode     string
+	canaryQueriesFile  string
+	queryRewriteRules  string
 }
 
 var _config Config
@@ -53,13 +220,115 @@ func registerFlags() {
 	flag.StringVar(&_config.CommonConfig.Aws.S3Bucket, "aws-s3-bucket", os.Getenv(common.ENV_AWS_S3_BUCKET), "AWS S3 bucket name")
 	flag.StringVar(&_config.CommonConfig.Aws.AccessKeyId, "aws-access-key-id", os.Getenv(common.ENV_AWS_ACCESS_KEY_ID), "AWS access key ID")
 	flag.StringVar(&_config.CommonConfig.Aws.SecretAccessKey, "aws-secret-access-key", os.Getenv(common.ENV_AWS_SECRET_ACCESS_KEY), "AWS secret access key")
+	flag.StringVar(&_config.CommonConfig.Aws.ServerSideEncryption, "aws-s3-server-side-encryption", os.Getenv(common.ENV_AWS_S3_SERVER_SIDE_ENCRYPTION), `Server-side encryption of written S3 objects: "`+common.AWS_S3_SSE_S3+`" (SSE-S3) or "`+common.AWS_S3_SSE_KMS+`" (SSE-KMS). Default: none`)
+	flag.StringVar(&_config.CommonConfig.Aws.KmsKeyId, "aws-s3-kms-key-id", os.Getenv(common.ENV_AWS_S3_KMS_KEY_ID), "KMS key ID or ARN for SSE-KMS")
 	flag.BoolVar(&_config.CommonConfig.DisableAnonymousAnalytics, "disable-anonymous-analytics", os.Getenv(common.ENV_DISABLE_ANONYMOUS_ANALYTICS) == "true", "Disable anonymous analytics collection")
 
 	flag.StringVar(&_config.Host, "host", os.Getenv(ENV_HOST), "Host for BemiDB to listen on")
 	flag.StringVar(&_config.Port, "port", os.Getenv(ENV_PORT), "Port for BemiDB to listen on")
+	flag.StringVar(&_config.UnixSocketDir, "unix-socket-dir", os.Getenv(ENV_UNIX_SOCKET_DIR), `Directory to also listen on a Unix socket in, e.g. "/tmp" for "/tmp/.s.PGSQL.54321". Default: none`)
+	flag.StringVar(&_configParseValues.allowedIps, "allowed-ips", os.Getenv(ENV_ALLOWED_IPS), `IP addresses and CIDR ranges allowed to connect over TCP, e.g. "10.0.0.0/8,192.168.1.5". Default: all`)
+	flag.StringVar(&_configParseValues.deniedIps, "denied-ips", os.Getenv(ENV_DENIED_IPS), `IP addresses and CIDR ranges denied from connecting over TCP, e.g. "10.0.5.0/24". Default: none`)
+	flag.StringVar(&_configParseValues.hbaFile, "hba-file", os.Getenv(ENV_HBA_FILE), `Path to a pg_hba.conf-style file with rules per connection type, database, user, and address, e.g. "hostssl all all 0.0.0.0/0 password". Default: none`)
+	flag.StringVar(&_configParseValues.unixSocketMode, "unix-socket-permissions", os.Getenv(ENV_UNIX_SOCKET_MODE), "Octal file permissions of the Unix socket. Default: "+DEFAULT_UNIX_SOCKET_PERMISSIONS)
 	flag.StringVar(&_config.Database, "database", os.Getenv(ENV_DATABASE), "Database name")
 	flag.StringVar(&_config.User, "user", os.Getenv(ENV_USER), "Database user")
-	flag.StringVar(&_configParseValues.password, "password", os.Getenv(ENV_PASSWORD), "Database password")
+	flag.StringVar(&_configParseValues.password, "password", os.Getenv(ENV_PASSWORD), "Database password or its SCRAM-SHA-256 verifier")
+	flag.StringVar(&_configParseValues.scramSaltSecret, "scram-salt-secret", os.Getenv(ENV_SCRAM_SALT_SECRET), "Secret to derive the salts of SCRAM-SHA-256 verifiers from, so that servers sharing it expose the same verifiers in pg_shadow. Default: random salts")
+	flag.StringVar(&_configParseValues.users, "users", os.Getenv(ENV_USERS), `Additional database users with their passwords or SCRAM-SHA-256 verifiers, e.g. "looker=secret1,metabase=secret2". Default: none`)
+	flag.StringVar(&_configParseValues.usersFile, "users-file", os.Getenv(ENV_USERS_FILE), `Path to a JSON file with additional database users, e.g. {"looker": "secret1", "metabase": "secret2"}. Default: none`)
+	flag.StringVar(&_configParseValues.permissionsFile, "permissions-file", os.Getenv(ENV_PERMISSIONS_FILE), `Path to a JSON file with tables and columns permitted per user, e.g. {"looker": {"public.users": ["id", "name"], "analytics.*": ["*"]}, "*": {}}. Default: none`)
+	flag.StringVar(&_configParseValues.rowFiltersFile, "row-filters-file", os.Getenv(ENV_ROW_FILTERS_FILE), `Path to a JSON file with row filters per table and user attributes, e.g. {"tables": {"public.orders": "tenant_id = {{tenant_id}}"}, "users": {"acme": {"tenant_id": "1"}}}. Default: none`)
+	flag.StringVar(&_configParseValues.databases, "databases", os.Getenv(ENV_DATABASES), `Additional logical databases exposing subsets of schemas, e.g. "staging=staging,production=public|sales". Default: none`)
+	flag.StringVar(&_config.DuckdbInitSql, "duckdb-init-sql", os.Getenv(ENV_DUCKDB_INIT_SQL), "Additional DuckDB SQL statements separated by semicolons executed after the built-in boot queries. Default: none")
+	flag.StringVar(&_configParseValues.tlsCertFile, "tls-cert-file", os.Getenv(ENV_TLS_CERT_FILE), "Path to a PEM-encoded TLS certificate file for client connections. Default: none")
+	flag.StringVar(&_configParseValues.tlsKeyFile, "tls-key-file", os.Getenv(ENV_TLS_KEY_FILE), "Path to a PEM-encoded TLS private key file for client connections. Default: none")
+	flag.BoolVar(&_configParseValues.tlsSelfSigned, "tls-self-signed", os.Getenv(ENV_TLS_SELF_SIGNED) == "true", "Enable TLS with an auto-generated self-signed certificate if no certificate file is provided (for development)")
+	flag.BoolVar(&_config.TlsRequired, "tls-required", os.Getenv(ENV_TLS_REQUIRED) == "true", "Reject TCP connections without TLS")
+	flag.StringVar(&_configParseValues.pinnedTables, "pinned-tables", os.Getenv(ENV_PINNED_TABLES), `Small tables to keep in memory instead of reading them from object storage in each query, e.g. "public.countries,public.currencies". Default: none`)
+	flag.StringVar(&_configParseValues.storageSecretsFile, "storage-secrets-file", os.Getenv(ENV_STORAGE_SECRETS_FILE), `Path to a JSON file with S3 credentials for other buckets or prefixes, e.g. [{"scope": "s3://other-bucket", "accessKeyId": "...", "secretAccessKey": "...", "region": "us-east-1"}]. Default: none`)
+	flag.BoolVar(&_config.StorageAccessLog, "storage-access-log", os.Getenv(ENV_STORAGE_ACCESS_LOG) == "true", "Log bytes read from object storage by each query with the user, database, and application name of the session for cost allocation")
+	flag.BoolVar(&_config.CheckCatalogOnStart, "check-catalog-on-start", os.Getenv(ENV_CHECK_CATALOG) == "true", "Check in the background after starting that the Iceberg metadata and data files of all tables can be read and their columns match the catalog, listing broken tables in bemidb.broken_tables")
+	flag.IntVar(&_config.TcpKeepaliveSeconds, "tcp-keepalive-seconds", DEFAULT_TCP_KEEPALIVE_SECONDS, "Idle time in seconds before sending TCP keepalive probes to detect half-open connections. 0 disables keepalive")
+	if tcpKeepaliveSeconds := os.Getenv(ENV_TCP_KEEPALIVE_SECONDS); tcpKeepaliveSeconds != "" {
+		_config.TcpKeepaliveSeconds = common.StringToInt(tcpKeepaliveSeconds)
+	}
+	flag.IntVar(&_config.WriteTimeoutSeconds, "write-timeout-seconds", DEFAULT_WRITE_TIMEOUT_SECONDS, "Timeout in seconds for writing a response to a client before closing the connection. 0 disables the timeout")
+	if writeTimeoutSeconds := os.Getenv(ENV_WRITE_TIMEOUT_SECONDS); writeTimeoutSeconds != "" {
+		_config.WriteTimeoutSeconds = common.StringToInt(writeTimeoutSeconds)
+	}
+	flag.IntVar(&_config.IdleTimeoutSeconds, "idle-timeout-seconds", 0, "Timeout in seconds for a connection waiting for the next query before closing it. 0 disables the timeout")
+	if idleTimeoutSeconds := os.Getenv(ENV_IDLE_TIMEOUT_SECONDS); idleTimeoutSeconds != "" {
+		_config.IdleTimeoutSeconds = common.StringToInt(idleTimeoutSeconds)
+	}
+	flag.IntVar(&_config.MaxSessionAgeSeconds, "max-session-age-seconds", 0, "Maximum age in seconds of a connection after which it is closed once its running query completes. 0 disables the limit")
+	if maxSessionAgeSeconds := os.Getenv(ENV_MAX_SESSION_AGE); maxSessionAgeSeconds != "" {
+		_config.MaxSessionAgeSeconds = common.StringToInt(maxSessionAgeSeconds)
+	}
+	flag.Int64Var(&_config.StorageSoftBudgetBytes, "storage-soft-budget-bytes", 0, "Bytes read from object storage per user and UTC day after which queries return a warning. 0 disables the budget")
+	if storageSoftBudget := os.Getenv(ENV_STORAGE_SOFT_BUDGET); storageSoftBudget != "" {
+		_config.StorageSoftBudgetBytes = common.StringToInt64(storageSoftBudget)
+	}
+	flag.Int64Var(&_config.StorageHardBudgetBytes, "storage-hard-budget-bytes", 0, "Bytes read from object storage per user and UTC day after which queries are rejected. 0 disables the budget")
+	if storageHardBudget := os.Getenv(ENV_STORAGE_HARD_BUDGET); storageHardBudget != "" {
+		_config.StorageHardBudgetBytes = common.StringToInt64(storageHardBudget)
+	}
+	flag.IntVar(&_config.StorageLatencyNoticeMs, "storage-latency-notice-ms", 0, "Milliseconds a query can spend mostly waiting on object storage, measured with DuckDB profiling, before it returns a notice suggesting cache warm-up or compaction. 0 disables the notices")
+	if storageLatencyNoticeMs := os.Getenv(ENV_STORAGE_LATENCY); storageLatencyNoticeMs != "" {
+		_config.StorageLatencyNoticeMs = common.StringToInt(storageLatencyNoticeMs)
+	}
+	flag.IntVar(&_config.SampleRows, "sample-rows", 0, "Number of rows sampled from each larger table into memory for instant previews in sessions with SET bemidb.sample_tables = on. 0 disables samples")
+	if sampleRows := os.Getenv(ENV_SAMPLE_ROWS); sampleRows != "" {
+		_config.SampleRows = common.StringToInt(sampleRows)
+	}
+	flag.IntVar(&_config.SampleRefreshIntervalSeconds, "sample-refresh-seconds", DEFAULT_SAMPLE_REFRESH_SECONDS, "Seconds between refreshes of the samples of tables that changed")
+	if sampleRefreshIntervalSeconds := os.Getenv(ENV_SAMPLE_REFRESH); sampleRefreshIntervalSeconds != "" {
+		_config.SampleRefreshIntervalSeconds = common.StringToInt(sampleRefreshIntervalSeconds)
+	}
+	flag.IntVar(&_config.MemoryPressurePercent, "memory-pressure-percent", 0, "DuckDB or OS memory usage in percent at which new queries reading tables are queued until memory is freed. 0 disables queueing")
+	if memoryPressurePercent := os.Getenv(ENV_MEMORY_PRESSURE); memoryPressurePercent != "" {
+		_config.MemoryPressurePercent = common.StringToInt(memoryPressurePercent)
+	}
+	flag.IntVar(&_config.SessionCheckpointTtlSeconds, "session-checkpoint-ttl-seconds", 0, "Seconds to keep prepared statements of a disconnected session with the bemidb.session_token startup parameter for a reconnecting client with the same token. 0 disables checkpoints")
+	if sessionCheckpointTtlSeconds := os.Getenv(ENV_SESSION_CHECKPOINT); sessionCheckpointTtlSeconds != "" {
+		_config.SessionCheckpointTtlSeconds = common.StringToInt(sessionCheckpointTtlSeconds)
+	}
+	flag.IntVar(&_config.StatementTimeoutMs, "statement-timeout-ms", 0, "Default statement_timeout in milliseconds after which running queries are canceled, can be changed per session with SET statement_timeout. 0 disables the timeout")
+	if statementTimeoutMs := os.Getenv(ENV_STATEMENT_TIMEOUT); statementTimeoutMs != "" {
+		_config.StatementTimeoutMs = common.StringToInt(statementTimeoutMs)
+	}
+	flag.StringVar(&_config.HealthPort, "health-port", os.Getenv(ENV_HEALTH_PORT), "Port for the /healthz and /readyz HTTP endpoints. Default: disabled")
+	flag.StringVar(&_configParseValues.canaryQueriesFile, "canary-queries-file", os.Getenv(ENV_CANARY_QUERIES_FILE), `Path to a JSON file with canary queries, e.g. [{"name": "users", "query": "SELECT id FROM users LIMIT 1", "columns": ["id"], "rowCount": 1, "latencyBudgetMs": 1000}]. Default: none`)
+	flag.IntVar(&_config.CanaryIntervalSeconds, "canary-interval-seconds", DEFAULT_CANARY_INTERVAL_SECONDS, "Seconds between runs of the canary queries")
+	if canaryIntervalSeconds := os.Getenv(ENV_CANARY_INTERVAL); canaryIntervalSeconds != "" {
+		_config.CanaryIntervalSeconds = common.StringToInt(canaryIntervalSeconds)
+	}
+	flag.StringVar(&_config.CanaryWebhookUrl, "canary-alert-webhook-url", os.Getenv(ENV_CANARY_WEBHOOK_URL), "URL to POST a JSON alert to when a canary query starts failing or recovers. Default: none")
+	flag.StringVar(&_config.QueryHookWebhookUrl, "query-hook-webhook-url", os.Getenv(ENV_QUERY_HOOK_URL), `URL to POST each table access to before and after the query, a {"allow": false, "reason": "..."} response rejects the query. Default: none`)
+	flag.Int64Var(&_config.QueryHookRowThreshold, "query-hook-row-threshold", 0, "Number of rows returned from tables by a query to log it as anomalous access. 0 disables the check")
+	if queryHookRowThreshold := os.Getenv(ENV_QUERY_HOOK_ROWS); queryHookRowThreshold != "" {
+		_config.QueryHookRowThreshold = common.StringToInt64(queryHookRowThreshold)
+	}
+	flag.StringVar(&_config.CandidateCatalogDatabaseUrl, "candidate-catalog-database-url", os.Getenv(ENV_CANDIDATE_CATALOG_URL), "Candidate catalog database URL for sessions with SET bemidb.catalog = candidate, e.g. to validate a migration before switching to it with ALTER SYSTEM SET bemidb.catalog = candidate. Default: none")
+	flag.IntVar(&_config.MaxParallelDownloads, "max-parallel-downloads", DEFAULT_MAX_PARALLEL_DOWNLOADS, "Number of DuckDB threads scanning tables, each reading from S3 with its own range requests")
+	if maxParallelDownloads := os.Getenv(ENV_MAX_PARALLEL_DOWNLOADS); maxParallelDownloads != "" {
+		_config.MaxParallelDownloads = common.StringToInt(maxParallelDownloads)
+	}
+	flag.StringVar(&_config.S3Prefetch, "s3-prefetch", os.Getenv(ENV_S3_PREFETCH), `Prefetching of Parquet row groups: "`+S3_PREFETCH_AUTO+`", "`+S3_PREFETCH_ALL+`", or "`+S3_PREFETCH_OFF+`" to read only the requested columns. Default: "`+S3_PREFETCH_AUTO+`"`)
+	flag.IntVar(&_config.S3HttpRetries, "s3-http-retries", 0, "Retries of failed S3 requests, can be changed per session with SET bemidb.http_retries. 0 uses the DuckDB default")
+	if s3HttpRetries := os.Getenv(ENV_S3_HTTP_RETRIES); s3HttpRetries != "" {
+		_config.S3HttpRetries = common.StringToInt(s3HttpRetries)
+	}
+	flag.IntVar(&_config.S3HttpRetryWaitMs, "s3-http-retry-wait-ms", 0, "Milliseconds to wait before retrying a failed S3 request, can be changed per session with SET bemidb.http_retry_wait_ms. 0 uses the DuckDB default")
+	if s3HttpRetryWaitMs := os.Getenv(ENV_S3_HTTP_RETRY_WAIT_MS); s3HttpRetryWaitMs != "" {
+		_config.S3HttpRetryWaitMs = common.StringToInt(s3HttpRetryWaitMs)
+	}
+	flag.IntVar(&_config.S3HttpTimeoutSeconds, "s3-http-timeout-seconds", 0, "Seconds before an S3 request times out, can be changed per session with SET bemidb.http_timeout. 0 uses the DuckDB default")
+	if s3HttpTimeoutSeconds := os.Getenv(ENV_S3_HTTP_TIMEOUT); s3HttpTimeoutSeconds != "" {
+		_config.S3HttpTimeoutSeconds = common.StringToInt(s3HttpTimeoutSeconds)
+	}
+	flag.StringVar(&_configParseValues.queryRewriteRules, "query-rewrite-rules-file", os.Getenv(ENV_QUERY_REWRITE_RULES), `Path to a JSON file with rules rewriting queries before they're remapped, e.g. [{"name": "tool-version", "match": "SELECT tool_version()", "rewrite": "SELECT '1.0' AS tool_version"}]. Default: none`)
+	flag.StringVar(&_config.IdentifierCase, "identifier-case", os.Getenv(ENV_IDENTIFIER_CASE), `Matching of table and column names: "`+IDENTIFIER_CASE_DUCKDB+`" (case-insensitive) or "`+IDENTIFIER_CASE_POSTGRES+`" (exact after folding unquoted names to lowercase). Default: "`+IDENTIFIER_CASE_DUCKDB+`"`)
 }
 
 func parseFlags() {
@@ -88,6 +357,12 @@ func parseFlags() {
 	if _config.CommonConfig.Aws.AccessKeyId == "" && _config.CommonConfig.Aws.SecretAccessKey != "" {
 		panic("AWS access key ID is required")
 	}
+	if _config.CommonConfig.Aws.ServerSideEncryption != "" && _config.CommonConfig.Aws.ServerSideEncryption != common.AWS_S3_SSE_S3 && _config.CommonConfig.Aws.ServerSideEncryption != common.AWS_S3_SSE_KMS {
+		panic("AWS S3 server-side encryption must be \"" + common.AWS_S3_SSE_S3 + "\" or \"" + common.AWS_S3_SSE_KMS + "\"")
+	}
+	if (_config.CommonConfig.Aws.KmsKeyId != "") != (_config.CommonConfig.Aws.ServerSideEncryption == common.AWS_S3_SSE_KMS) {
+		panic("AWS S3 KMS key ID is required for and only used with \"" + common.AWS_S3_SSE_KMS + "\" server-side encryption")
+	}
 
 	if _config.Host == "" {
 		_config.Host = DEFAULT_HOST
@@ -98,13 +373,393 @@ func parseFlags() {
 	if _config.Database == "" {
 		_config.Database = DEFAULT_DATABASE
 	}
+	if _configParseValues.unixSocketMode == "" {
+		_configParseValues.unixSocketMode = DEFAULT_UNIX_SOCKET_PERMISSIONS
+	}
+	unixSocketMode, err := strconv.ParseUint(_configParseValues.unixSocketMode, 8, 32)
+	if err != nil || unixSocketMode > 0777 {
+		panic("Invalid Unix socket permissions " + _configParseValues.unixSocketMode + ". Must be an octal number, e.g. 0770")
+	}
+	_config.UnixSocketMode = os.FileMode(unixSocketMode)
+	if _configParseValues.databases != "" {
+		_config.Databases = make(map[string][]string)
+		for _, databaseSchemas := range strings.Split(_configParseValues.databases, ",") {
+			database, schemas, ok := strings.Cut(strings.TrimSpace(databaseSchemas), "=")
+			if !ok || database == "" || schemas == "" {
+				panic("Invalid database " + databaseSchemas + ". Must be in the format name=schema1|schema2")
+			}
+			if database == _config.Database {
+				panic("Database " + database + " is already the default database")
+			}
+			_config.Databases[database] = strings.Split(schemas, "|")
+		}
+	}
+	_config.AllowedNetworks = parseNetworks(_configParseValues.allowedIps)
+	_config.DeniedNetworks = parseNetworks(_configParseValues.deniedIps)
+	if _configParseValues.pinnedTables != "" {
+		for _, schemaTable := range strings.Split(_configParseValues.pinnedTables, ",") {
+			schema, table, ok := strings.Cut(strings.TrimSpace(schemaTable), ".")
+			if !ok {
+				schema, table = PG_SCHEMA_PUBLIC, schema
+			}
+			if schema == "" || table == "" {
+				panic("Invalid pinned table " + schemaTable + ". Must be in the format schema.table")
+			}
+			_config.PinnedTables = append(_config.PinnedTables, common.IcebergSchemaTable{Schema: schema, Table: table})
+		}
+	}
+	if _config.TcpKeepaliveSeconds < 0 {
+		panic("TCP keepalive seconds must be greater than or equal to 0")
+	}
+	if _config.WriteTimeoutSeconds < 0 {
+		panic("Write timeout seconds must be greater than or equal to 0")
+	}
+	if _config.IdleTimeoutSeconds < 0 || _config.MaxSessionAgeSeconds < 0 {
+		panic("Idle timeout and max session age seconds must be greater than or equal to 0")
+	}
+	if _config.StorageSoftBudgetBytes < 0 || _config.StorageHardBudgetBytes < 0 {
+		panic("Storage budgets must be greater than or equal to 0")
+	}
+	if _config.MemoryPressurePercent < 0 || _config.MemoryPressurePercent > 100 {
+		panic("Memory pressure percent must be between 0 and 100")
+	}
+	if _config.SessionCheckpointTtlSeconds < 0 {
+		panic("Session checkpoint TTL seconds must be greater than or equal to 0")
+	}
+	if _config.StatementTimeoutMs < 0 {
+		panic("Statement timeout milliseconds must be greater than or equal to 0")
+	}
+	if _config.MaxParallelDownloads < 1 {
+		panic("Max parallel downloads must be greater than 0")
+	}
+	if _config.S3Prefetch == "" {
+		_config.S3Prefetch = S3_PREFETCH_AUTO
+	} else if _config.S3Prefetch != S3_PREFETCH_AUTO && _config.S3Prefetch != S3_PREFETCH_ALL && _config.S3Prefetch != S3_PREFETCH_OFF {
+		panic("Invalid S3 prefetch " + _config.S3Prefetch + ". Must be one of " + S3_PREFETCH_AUTO + ", " + S3_PREFETCH_ALL + ", " + S3_PREFETCH_OFF)
+	}
+	if _config.IdentifierCase == "" {
+		_config.IdentifierCase = IDENTIFIER_CASE_DUCKDB
+	} else if _config.IdentifierCase != IDENTIFIER_CASE_DUCKDB && _config.IdentifierCase != IDENTIFIER_CASE_POSTGRES {
+		panic("Invalid identifier case " + _config.IdentifierCase + ". Must be one of " + IDENTIFIER_CASE_DUCKDB + ", " + IDENTIFIER_CASE_POSTGRES)
+	}
+	if _config.S3HttpRetries < 0 || _config.S3HttpRetryWaitMs < 0 || _config.S3HttpTimeoutSeconds < 0 {
+		panic("S3 HTTP retries, retry wait milliseconds, and timeout seconds must be greater than or equal to 0")
+	}
+	if _configParseValues.storageSecretsFile != "" {
+		storageSecretsJson, err := os.ReadFile(_configParseValues.storageSecretsFile)
+		if err != nil {
+			panic("Couldn't read storage secrets file: " + err.Error())
+		}
+		err = json.Unmarshal(storageSecretsJson, &_config.StorageSecrets)
+		if err != nil {
+			panic("Invalid storage secrets format. Expected a JSON array: " + err.Error())
+		}
+		for i, storageSecret := range _config.StorageSecrets {
+			if !strings.HasPrefix(storageSecret.Scope, "s3://") || len(storageSecret.Scope) == len("s3://") {
+				panic("Invalid storage secret scope " + storageSecret.Scope + ". Must be in the format s3://bucket or s3://bucket/prefix")
+			}
+			if storageSecret.AccessKeyId == "" || storageSecret.SecretAccessKey == "" {
+				panic("Storage secret for " + storageSecret.Scope + " must have an access key ID and a secret access key")
+			}
+			if storageSecret.Region == "" {
+				_config.StorageSecrets[i].Region = _config.CommonConfig.Aws.Region
+			}
+			if storageSecret.Endpoint == "" {
+				_config.StorageSecrets[i].Endpoint = _config.CommonConfig.Aws.S3Endpoint
+			}
+		}
+	}
+	if _configParseValues.canaryQueriesFile != "" {
+		canaryQueriesJson, err := os.ReadFile(_configParseValues.canaryQueriesFile)
+		if err != nil {
+			panic("Couldn't read canary queries file: " + err.Error())
+		}
+		err = json.Unmarshal(canaryQueriesJson, &_config.Canaries)
+		if err != nil {
+			panic("Invalid canary queries format. Expected a JSON array: " + err.Error())
+		}
+		for _, canary := range _config.Canaries {
+			if canary.Name == "" || canary.Query == "" {
+				panic("Canary queries must have a name and a query")
+			}
+		}
+	}
+	if _config.CanaryIntervalSeconds <= 0 {
+		panic("Canary interval seconds must be greater than 0")
+	}
+	if _config.SampleRows < 0 {
+		panic("Sample rows must be greater than or equal to 0")
+	}
+	if _config.SampleRefreshIntervalSeconds <= 0 {
+		panic("Sample refresh interval seconds must be greater than 0")
+	}
+	if _config.StorageLatencyNoticeMs < 0 {
+		panic("Storage latency notice threshold must be greater than or equal to 0")
+	}
+	if _config.QueryHookRowThreshold < 0 {
+		panic("Query hook row threshold must be greater than or equal to 0")
+	}
 	if _configParseValues.password != "" {
-		_config.EncryptedPassword = StringToScramSha256(_configParseValues.password)
+		_config.EncryptedPassword = encryptPassword(_config.User, _configParseValues.password, _configParseValues.scramSaltSecret)
+	}
+	if _configParseValues.users != "" || _configParseValues.usersFile != "" {
+		passwords := make(map[string]string)
+		if _configParseValues.usersFile != "" {
+			usersJson, err := os.ReadFile(_configParseValues.usersFile)
+			if err != nil {
+				panic("Couldn't read users file: " + err.Error())
+			}
+			err = json.Unmarshal(usersJson, &passwords)
+			if err != nil {
+				panic("Invalid users format. Expected a JSON object with user names and passwords: " + err.Error())
+			}
+		}
+		if _configParseValues.users != "" {
+			for _, userPassword := range strings.Split(_configParseValues.users, ",") {
+				user, password, ok := strings.Cut(strings.TrimSpace(userPassword), "=")
+				if !ok || user == "" {
+					panic("Invalid user " + user + ". Must be in the format name=password")
+				}
+				passwords[user] = password
+			}
+		}
+
+		_config.Users = make(map[string]string)
+		for user, password := range passwords {
+			if user == _config.User || user == SYSTEM_AUTH_USER {
+				panic("User " + user + " is already configured")
+			}
+			if password == "" {
+				panic("Password is required for user " + user)
+			}
+			_config.Users[user] = encryptPassword(user, password, _configParseValues.scramSaltSecret)
+		}
+	}
+	if _configParseValues.permissionsFile != "" {
+		permissionsJson, err := os.ReadFile(_configParseValues.permissionsFile)
+		if err != nil {
+			panic("Couldn't read permissions file: " + err.Error())
+		}
+		err = json.Unmarshal(permissionsJson, &_config.Permissions)
+		if err != nil {
+			panic("Invalid permissions format. Expected a JSON object with users, tables, and column lists: " + err.Error())
+		}
+		for user, permissions := range _config.Permissions {
+			for schemaTable := range permissions {
+				if schema, table, ok := strings.Cut(schemaTable, "."); !ok || schema == "" || table == "" {
+					panic("Invalid table " + schemaTable + " in permissions of user " + user + ". Must be in the format schema.table or schema.*")
+				}
+			}
+		}
+	}
+	if _configParseValues.rowFiltersFile != "" {
+		rowFiltersJson, err := os.ReadFile(_configParseValues.rowFiltersFile)
+		if err != nil {
+			panic("Couldn't read row filters file: " + err.Error())
+		}
+		err = json.Unmarshal(rowFiltersJson, &_config.RowFilters)
+		if err != nil {
+			panic("Invalid row filters format. Expected a JSON object with tables and users: " + err.Error())
+		}
+		for schemaTable, filter := range _config.RowFilters.Tables {
+			if schema, table, ok := strings.Cut(schemaTable, "."); !ok || schema == "" || table == "" {
+				panic("Invalid table " + schemaTable + " in row filters. Must be in the format schema.table or schema.*")
+			}
+			if _, err := pgQuery.Parse("SELECT 1 WHERE " + ROW_FILTER_PLACEHOLDER_REGEXP.ReplaceAllString(filter, "''")); err != nil {
+				panic("Invalid row filter of table " + schemaTable + ": " + err.Error())
+			}
+		}
+	}
+	if (_configParseValues.tlsCertFile == "") != (_configParseValues.tlsKeyFile == "") {
+		panic("Both TLS certificate and key files are required")
+	}
+	if _configParseValues.tlsCertFile != "" {
+		certificate, err := tls.LoadX509KeyPair(_configParseValues.tlsCertFile, _configParseValues.tlsKeyFile)
+		if err != nil {
+			panic("Couldn't load TLS certificate: " + err.Error())
+		}
+		_config.TlsConfig = &tls.Config{Certificates: []tls.Certificate{certificate}, MinVersion: tls.VersionTLS12}
+	} else if _configParseValues.tlsSelfSigned {
+		certificate, err := GenerateSelfSignedCertificate(_config.Host)
+		if err != nil {
+			panic("Couldn't generate a self-signed TLS certificate: " + err.Error())
+		}
+		_config.TlsConfig = &tls.Config{Certificates: []tls.Certificate{certificate}, MinVersion: tls.VersionTLS12}
+	}
+	if _config.TlsRequired && _config.TlsConfig == nil {
+		panic("Requiring TLS needs a TLS certificate or a self-signed certificate")
+	}
+	if _configParseValues.hbaFile != "" {
+		hbaRules, err := os.ReadFile(_configParseValues.hbaFile)
+		if err != nil {
+			panic("Couldn't read HBA rules file: " + err.Error())
+		}
+		_config.HbaRules = parseHbaRules(string(hbaRules))
+		if len(_config.HbaRules) == 0 {
+			panic("HBA rules file has no rules")
+		}
+		for _, rule := range _config.HbaRules {
+			if rule.Type == HBA_TYPE_HOSTSSL && _config.TlsConfig == nil {
+				panic("HBA rules with the hostssl connection type require TLS")
+			}
+		}
+	}
+
+	if _configParseValues.queryRewriteRules != "" {
+		queryRewriteRules, err := os.ReadFile(_configParseValues.queryRewriteRules)
+		if err != nil {
+			panic("Couldn't read query rewrite rules file: " + err.Error())
+		}
+		_config.QueryRewriteRules = parseQueryRewriteRules(string(queryRewriteRules))
 	}
 
 	_configParseValues = configParseValues{}
 }
 
+// Returns the configured user followed by the additional users sorted by name
+func (config *Config) UserNames() []string {
+	userNames := slices.Sorted(maps.Keys(config.Users))
+	return append([]string{config.User}, userNames...)
+}
+
+// Returns the SCRAM-SHA-256 verifier of the user ("" if no password is required) and whether the user can connect.
+// Any user can connect without BEMIDB_USER only if there are no additional users, which would otherwise be bypassed
+func (config *Config) EncryptedPasswordFor(user string) (string, bool) {
+	if encryptedPassword, ok := config.Users[user]; ok {
+		return encryptedPassword, true
+	}
+	if (config.User != "" || len(config.Users) > 0) && user != config.User && user != SYSTEM_AUTH_USER {
+		return "", false
+	}
+	return config.EncryptedPassword, true
+}
+
+// Additional users aren't superusers, e.g. they can't read password verifiers in pg_shadow
+func (config *Config) IsSuperuser(user string) bool {
+	_, ok := config.Users[user]
+	return !ok
+}
+
+// Returns the permitted tables and columns of the user, nil if the user is unrestricted.
+// Sessions without a user (e.g., canary queries) are unrestricted
+func (config *Config) PermissionsFor(user string) *map[string][]string {
+	if config.Permissions == nil || user == "" {
+		return nil
+	}
+	if permissions, ok := config.Permissions[user]; ok {
+		return &permissions
+	}
+	if permissions, ok := config.Permissions[PERMISSIONS_WILDCARD]; ok {
+		return &permissions
+	}
+	return nil
+}
+
+// Returns "schema.table" or "schema.*" -> filter expression with the attributes of the user, nil if the user is unrestricted.
+// {{user}} is the user name unless it's set as an attribute, filters with attributes that the user doesn't have match no rows
+func (config *Config) RowFiltersFor(user string) map[string]string {
+	if len(config.RowFilters.Tables) == 0 || user == "" {
+		return nil
+	}
+	attributes, ok := config.RowFilters.Users[user]
+	if !ok {
+		attributes, ok = config.RowFilters.Users[PERMISSIONS_WILDCARD]
+	}
+	if !ok {
+		return nil
+	}
+
+	rowFilters := make(map[string]string, len(config.RowFilters.Tables))
+	for schemaTable, filter := range config.RowFilters.Tables {
+		missingAttribute := false
+		rowFilters[schemaTable] = ROW_FILTER_PLACEHOLDER_REGEXP.ReplaceAllStringFunc(filter, func(placeholder string) string {
+			name := ROW_FILTER_PLACEHOLDER_REGEXP.FindStringSubmatch(placeholder)[1]
+			value, ok := attributes[name]
+			if !ok && name == ROW_FILTER_USER_ATTRIBUTE {
+				value, ok = user, true
+			}
+			if !ok {
+				missingAttribute = true
+			}
+			return quoteSqlString(value)
+		})
+		if missingAttribute {
+			rowFilters[schemaTable] = "FALSE"
+		}
+	}
+	return rowFilters
+}
+
+// Restricted users can only read data permitted to them
+func (config *Config) IsRestricted(user string) bool {
+	return config.PermissionsFor(user) != nil || config.RowFiltersFor(user) != nil
+}
+
+// A stored verifier (e.g., copied from pg_authid to avoid configuring the plaintext password) is used as is
+func encryptPassword(user string, password string, scramSaltSecret string) string {
+	if strings.HasPrefix(password, SCRAM_SHA_256_MECHANISM+"$") {
+		if _, err := NewScramAuthenticator(password); err != nil {
+			panic("Invalid SCRAM-SHA-256 password verifier for user " + user + ": " + err.Error())
+		}
+		return password
+	}
+	return StringToScramSha256(user, password, scramSaltSecret)
+}
+
+// Unix socket clients are always allowed since they connect from the same host
+func (config *Config) IsClientAllowed(remoteAddr net.Addr) bool {
+	tcpAddr, ok := remoteAddr.(*net.TCPAddr)
+	if !ok {
+		return true
+	}
+
+	addr := tcpAddr.AddrPort().Addr().Unmap()
+	for _, network := range config.DeniedNetworks {
+		if network.Contains(addr) {
+			return false
+		}
+	}
+	if len(config.AllowedNetworks) == 0 {
+		return true
+	}
+	for _, network := range config.AllowedNetworks {
+		if network.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// "10.0.0.0/8,192.168.1.5" -> [10.0.0.0/8 192.168.1.5/32]
+func parseNetworks(networks string) []netip.Prefix {
+	var prefixes []netip.Prefix
+	for _, network := range strings.Split(networks, ",") {
+		network = strings.TrimSpace(network)
+		if network == "" {
+			continue
+		}
+		if addr, err := netip.ParseAddr(network); err == nil {
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(network)
+		if err != nil {
+			panic("Invalid IP address or CIDR range " + network)
+		}
+		if prefix.Addr().Is4In6() && prefix.Bits() >= 96 { // ::ffff:10.0.0.0/104 -> 10.0.0.0/8
+			prefix = netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()-96)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes
+}
+
+// Returns the default database followed by the logical databases sorted by name
+func (config *Config) DatabaseNames() []string {
+	databaseNames := slices.Sorted(maps.Keys(config.Databases))
+	return append([]string{config.Database}, databaseNames...)
+}
+
 func LoadConfig() *Config {
 	parseFlags()
 	return &_config
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"net"
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+func TestEncryptedPasswordFor(t *testing.T) {
+	t.Run("Allows any user without a configured user", func(t *testing.T) {
+		config := &Config{}
+
+		encryptedPassword, ok := config.EncryptedPasswordFor("any_user")
+
+		if !ok || encryptedPassword != "" {
+			t.Errorf("Expected any user to connect without a password, got %q, %v", encryptedPassword, ok)
+		}
+	})
+
+	t.Run("Returns the verifiers of the configured users", func(t *testing.T) {
+		config := &Config{User: "user", EncryptedPassword: "verifier", Users: map[string]string{"looker": "looker_verifier"}}
+
+		for user, expectedPassword := range map[string]string{"user": "verifier", "looker": "looker_verifier", SYSTEM_AUTH_USER: "verifier"} {
+			encryptedPassword, ok := config.EncryptedPasswordFor(user)
+			if !ok || encryptedPassword != expectedPassword {
+				t.Errorf("Expected %s to connect with %q, got %q, %v", user, expectedPassword, encryptedPassword, ok)
+			}
+		}
+	})
+
+	t.Run("Rejects unknown users", func(t *testing.T) {
+		for _, config := range []*Config{
+			{User: "user", EncryptedPassword: "verifier"},
+			{User: "user", Users: map[string]string{"looker": "looker_verifier"}},
+			{Users: map[string]string{"looker": "looker_verifier"}},
+		} {
+			if _, ok := config.EncryptedPasswordFor("unknown_user"); ok {
+				t.Errorf("Expected an unknown user to be rejected with users %v", config.Users)
+			}
+		}
+	})
+}
+
+func TestPgUserValues(t *testing.T) {
+	t.Run("Escapes user names", func(t *testing.T) {
+		config := &Config{User: "o'brien", EncryptedPassword: "verifier", Users: map[string]string{"looker'); DROP TABLE x; --": "looker_verifier"}}
+
+		values := pgUserValues(config)
+
+		if !strings.Contains(values, "'o''brien', 'verifier', TRUE") {
+			t.Errorf("Expected the escaped configured user, got %s", values)
+		}
+		if !strings.Contains(values, "'looker''); DROP TABLE x; --', 'looker_verifier', FALSE") {
+			t.Errorf("Expected the escaped additional user, got %s", values)
+		}
+	})
+}
+
+func TestPgDatabaseAcl(t *testing.T) {
+	t.Run("Returns the default privileges without a configured user", func(t *testing.T) {
+		config := &Config{}
+
+		acl := pgDatabaseAcl(config)
+
+		if acl != "NULL::text[]" {
+			t.Errorf("Expected no PUBLIC grants without a configured user, got %s", acl)
+		}
+	})
+
+	t.Run("Grants the configured user ownership and additional users access", func(t *testing.T) {
+		config := &Config{User: "user", Users: map[string]string{"looker": "looker_verifier", "o'brien \"bi\"": "verifier"}}
+
+		acl := pgDatabaseAcl(config)
+
+		expectedAcl := `['user=CTc/user', 'looker=Tc/user', '"o''brien ""bi"""=Tc/user']`
+		if acl != expectedAcl {
+			t.Errorf("Expected %s, got %s", expectedAcl, acl)
+		}
+	})
+}
+
+func TestParseNetworks(t *testing.T) {
+	t.Run("Parses IP addresses and CIDR ranges", func(t *testing.T) {
+		networks := parseNetworks(" 10.0.0.0/8, 192.168.1.5,,2001:db8::/32, ::ffff:172.16.0.0/108, ::ffff:127.0.0.1 ")
+
+		expectedNetworks := []string{"10.0.0.0/8", "192.168.1.5/32", "2001:db8::/32", "172.16.0.0/12", "127.0.0.1/32"}
+		if len(networks) != len(expectedNetworks) {
+			t.Fatalf("Expected %v, got %v", expectedNetworks, networks)
+		}
+		for i, network := range networks {
+			if network.String() != expectedNetworks[i] {
+				t.Errorf("Expected %s, got %s", expectedNetworks[i], network)
+			}
+		}
+	})
+
+	t.Run("Masks the host bits of CIDR ranges", func(t *testing.T) {
+		networks := parseNetworks("10.1.2.3/8")
+
+		if len(networks) != 1 || networks[0].String() != "10.0.0.0/8" {
+			t.Errorf("Expected [10.0.0.0/8], got %v", networks)
+		}
+	})
+
+	t.Run("Returns no networks for an empty list", func(t *testing.T) {
+		if networks := parseNetworks(""); len(networks) != 0 {
+			t.Errorf("Expected no networks, got %v", networks)
+		}
+	})
+
+	t.Run("Panics for an invalid network", func(t *testing.T) {
+		defer func() {
+			if recovered := recover(); recovered != "Invalid IP address or CIDR range 10.0.0.0/33" {
+				t.Errorf("Expected a panic for the invalid network, got %v", recovered)
+			}
+		}()
+
+		parseNetworks("10.0.0.0/8,10.0.0.0/33")
+	})
+}
+
+func TestIsClientAllowed(t *testing.T) {
+	t.Run("Allows any client without networks", func(t *testing.T) {
+		config := &Config{}
+
+		if !config.IsClientAllowed(testTcpAddr("203.0.113.1")) {
+			t.Errorf("Expected the client to be allowed")
+		}
+	})
+
+	t.Run("Allows only clients inside the allowed networks", func(t *testing.T) {
+		config := &Config{AllowedNetworks: parseNetworks("10.0.0.0/8,2001:db8::/32")}
+
+		for addr, expectedAllowed := range map[string]bool{"10.1.2.3": true, "::ffff:10.1.2.3": true, "2001:db8::1": true, "11.0.0.1": false, "2001:db9::1": false} {
+			if allowed := config.IsClientAllowed(testTcpAddr(addr)); allowed != expectedAllowed {
+				t.Errorf("Expected %s to be allowed: %v, got %v", addr, expectedAllowed, allowed)
+			}
+		}
+	})
+
+	t.Run("Rejects clients inside the denied networks even if they are allowed", func(t *testing.T) {
+		config := &Config{AllowedNetworks: parseNetworks("10.0.0.0/8"), DeniedNetworks: parseNetworks("10.0.0.5")}
+
+		for addr, expectedAllowed := range map[string]bool{"10.0.0.5": false, "::ffff:10.0.0.5": false, "10.0.0.6": true} {
+			if allowed := config.IsClientAllowed(testTcpAddr(addr)); allowed != expectedAllowed {
+				t.Errorf("Expected %s to be allowed: %v, got %v", addr, expectedAllowed, allowed)
+			}
+		}
+	})
+
+	t.Run("Allows clients connected over a Unix socket", func(t *testing.T) {
+		config := &Config{AllowedNetworks: parseNetworks("10.0.0.0/8")}
+
+		if !config.IsClientAllowed(&net.UnixAddr{Name: "/tmp/.s.PGSQL.54321", Net: "unix"}) {
+			t.Errorf("Expected the Unix socket client to be allowed")
+		}
+	})
+}
+
+func testTcpAddr(addr string) *net.TCPAddr {
+	return net.TCPAddrFromAddrPort(netip.AddrPortFrom(netip.MustParseAddr(addr), 5432))
+}
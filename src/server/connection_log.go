@@ -0,0 +1,241 @@
+package main
+
+import (
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgproto3"
+)
+
+const (
+	BEMIDB_SCHEMA               = "bemidb"
+	BEMIDB_TABLE_CONNECTION_LOG = "connection_log"
+
+	CONNECTION_LOG_MAX_CLOSED_ENTRIES = 1000
+
+	DATABASE_STATS_BLOCK_SIZE = 8192 // Object storage reads are counted in Postgres blocks
+)
+
+type ConnectionLogEntry struct {
+	Pid                       uint32
+	User                      string
+	Database                  string
+	ApplicationName           string
+	ClientAddr                string // Empty for Unix socket connections
+	ConnectedAt               time.Time
+	DisconnectedAt            *time.Time // nil while the client is connected
+	QueryCount                int64
+	StorageLatencyNoticeCount int64    // Queries that spent most of their time waiting on object storage
+	session                   *Session // nil after the client disconnected
+}
+
+// Activity of the sessions connected to a database since the server started, exposed in pg_stat_database and pg_stat_io
+type DatabaseStats struct {
+	NumBackends  int64
+	Sessions     int64
+	SessionTime  time.Duration // Including the connected sessions
+	ActiveTime   time.Duration // Spent running queries
+	XactCommit   int64         // Committed transaction blocks and successful queries outside of them
+	XactRollback int64         // Rolled back transaction blocks and failed queries outside of them
+	BlksRead     int64         // Bytes read from object storage in blocks, counted only while storage reads are tracked
+	BlkReadTime  time.Duration // Spent scanning object storage, counted only while queries are profiled
+	TupReturned  int64
+	TupInserted  int64
+	TupUpdated   int64
+	TupDeleted   int64
+}
+
+// Keeps the connected clients and the most recently closed connections in memory to expose them in bemidb.connection_log,
+// and counts the activity of each database for pg_stat_database
+type ConnectionLog struct {
+	mutex         sync.Mutex
+	openEntries   map[*Session]*ConnectionLogEntry
+	closedEntries []ConnectionLogEntry
+	databaseStats map[string]*DatabaseStats
+	StatsResetAt  time.Time
+}
+
+func NewConnectionLog() *ConnectionLog {
+	return &ConnectionLog{
+		openEntries:   make(map[*Session]*ConnectionLogEntry),
+		databaseStats: make(map[string]*DatabaseStats),
+		StatsResetAt:  time.Now(),
+	}
+}
+
+func (connectionLog *ConnectionLog) Open(session *Session) {
+	connectionLog.mutex.Lock()
+	defer connectionLog.mutex.Unlock()
+
+	connectionLog.openEntries[session] = &ConnectionLogEntry{
+		Pid:             session.ProcessId(),
+		User:            session.User,
+		Database:        session.Database,
+		ApplicationName: session.ApplicationName,
+		ClientAddr:      session.ClientAddr,
+		ConnectedAt:     time.Now(),
+		session:         session,
+	}
+	connectionLog.statsFor(session.Database).Sessions++
+}
+
+func (connectionLog *ConnectionLog) Close(session *Session) {
+	connectionLog.mutex.Lock()
+	defer connectionLog.mutex.Unlock()
+
+	entry, ok := connectionLog.openEntries[session]
+	if !ok {
+		return
+	}
+	delete(connectionLog.openEntries, session)
+
+	disconnectedAt := time.Now()
+	connectionLog.statsFor(entry.Database).SessionTime += disconnectedAt.Sub(entry.ConnectedAt)
+	closedEntry := entry.snapshot()
+	closedEntry.DisconnectedAt = &disconnectedAt
+	closedEntry.session = nil
+
+	connectionLog.closedEntries = append(connectionLog.closedEntries, closedEntry)
+	if len(connectionLog.closedEntries) > CONNECTION_LOG_MAX_CLOSED_ENTRIES {
+		connectionLog.closedEntries = connectionLog.closedEntries[len(connectionLog.closedEntries)-CONNECTION_LOG_MAX_CLOSED_ENTRIES:]
+	}
+}
+
+// Returns the closed and open connections sorted by connection time
+func (connectionLog *ConnectionLog) Entries() []ConnectionLogEntry {
+	connectionLog.mutex.Lock()
+	defer connectionLog.mutex.Unlock()
+
+	entries := make([]ConnectionLogEntry, 0, len(connectionLog.closedEntries)+len(connectionLog.openEntries))
+	entries = append(entries, connectionLog.closedEntries...)
+	for _, entry := range connectionLog.openEntries {
+		entries = append(entries, entry.snapshot())
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].ConnectedAt.Before(entries[j].ConnectedAt)
+	})
+	return entries
+}
+
+// Counts the returned and changed rows of a query, and its transaction if the query ended it: a query outside of a transaction block
+// is a transaction on its own, and a transaction block is committed only by a successful COMMIT
+func (connectionLog *ConnectionLog) TrackQuery(session *Session, previousTransaction *SessionTransaction, messages []pgproto3.Message, err error, duration time.Duration) {
+	connectionLog.mutex.Lock()
+	defer connectionLog.mutex.Unlock()
+
+	stats := connectionLog.statsFor(session.Database)
+	stats.ActiveTime += duration
+
+	var lastCommandTag string
+	for _, message := range messages {
+		switch message := message.(type) {
+		case *pgproto3.DataRow:
+			stats.TupReturned++
+		case *pgproto3.CommandComplete:
+			lastCommandTag = string(message.CommandTag)
+			fields := strings.Fields(lastCommandTag) // INSERT 0 <count>, UPDATE <count>, DELETE <count>
+			if len(fields) < 2 {
+				continue
+			}
+			rowCount, parseErr := strconv.ParseInt(fields[len(fields)-1], 10, 64)
+			if parseErr != nil {
+				continue
+			}
+			switch fields[0] {
+			case "INSERT":
+				stats.TupInserted += rowCount
+			case "UPDATE":
+				stats.TupUpdated += rowCount
+			case "DELETE":
+				stats.TupDeleted += rowCount
+			}
+		}
+	}
+
+	switch {
+	case session.Transaction != nil: // The transaction block continues
+	case previousTransaction != nil:
+		if err == nil && lastCommandTag == "COMMIT" {
+			stats.XactCommit++
+		} else {
+			stats.XactRollback++
+		}
+	case err == nil:
+		stats.XactCommit++
+	default:
+		stats.XactRollback++
+	}
+}
+
+// Bytes read from object storage by a query, if they could be attributed to it
+func (connectionLog *ConnectionLog) TrackStorageReads(database string, bytes int64) {
+	connectionLog.mutex.Lock()
+	defer connectionLog.mutex.Unlock()
+
+	connectionLog.statsFor(database).BlksRead += (bytes + DATABASE_STATS_BLOCK_SIZE - 1) / DATABASE_STATS_BLOCK_SIZE
+}
+
+// Time a profiled query spent scanning object storage, and whether it exceeded the storage latency notice threshold
+func (connectionLog *ConnectionLog) TrackStorageScan(session *Session, duration time.Duration, latencyExceeded bool) {
+	connectionLog.mutex.Lock()
+	defer connectionLog.mutex.Unlock()
+
+	connectionLog.statsFor(session.Database).BlkReadTime += duration
+	if entry, ok := connectionLog.openEntries[session]; ok && latencyExceeded {
+		entry.StorageLatencyNoticeCount++
+	}
+}
+
+// Returns the stats by database name, with the connected sessions
+func (connectionLog *ConnectionLog) DatabaseStats() map[string]DatabaseStats {
+	connectionLog.mutex.Lock()
+	defer connectionLog.mutex.Unlock()
+
+	result := make(map[string]DatabaseStats, len(connectionLog.databaseStats))
+	for database, stats := range connectionLog.databaseStats {
+		result[database] = *stats
+	}
+	now := time.Now()
+	for _, entry := range connectionLog.openEntries {
+		stats := result[entry.Database]
+		stats.NumBackends++
+		stats.SessionTime += now.Sub(entry.ConnectedAt)
+		result[entry.Database] = stats
+	}
+	return result
+}
+
+func (connectionLog *ConnectionLog) statsFor(database string) *DatabaseStats {
+	stats, ok := connectionLog.databaseStats[database]
+	if !ok {
+		stats = &DatabaseStats{}
+		connectionLog.databaseStats[database] = stats
+	}
+	return stats
+}
+
+// 10.0.0.1:54321 -> 10.0.0.1, empty for Unix socket connections
+func ClientHost(remoteAddr net.Addr) string {
+	if remoteAddr == nil || remoteAddr.Network() == "unix" {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(remoteAddr.String())
+	if err != nil {
+		return remoteAddr.String()
+	}
+	return host
+}
+
+// Queries are counted by the goroutine of the session
+func (entry *ConnectionLogEntry) snapshot() ConnectionLogEntry {
+	snapshot := *entry
+	if entry.session != nil {
+		snapshot.QueryCount = atomic.LoadInt64(&entry.session.QueryId)
+	}
+	return snapshot
+}
@@ -9,6 +9,7 @@ require (
 	github.com/marcboeker/go-duckdb/v2 v2.3.2
 	github.com/pganalyze/pg_query_go/v6 v6.1.0
 	golang.org/x/crypto v0.37.0
+	google.golang.org/protobuf v1.36.6
 )
 
 replace github.com/BemiHQ/BemiDB/src/common => ../common
@@ -64,5 +65,4 @@ require (
 	golang.org/x/text v0.26.0 // indirect
 	golang.org/x/tools v0.34.0 // indirect
 	golang.org/x/xerrors v0.0.0-20240903120638-7835f813f4da // indirect
-	google.golang.org/protobuf v1.36.6 // indirect
 )
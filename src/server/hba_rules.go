@@ -0,0 +1,136 @@
+package main
+
+import (
+	"net"
+	"net/netip"
+	"slices"
+	"strings"
+
+	"github.com/BemiHQ/BemiDB/src/common"
+)
+
+const (
+	HBA_TYPE_LOCAL     = "local"     // Unix socket connections
+	HBA_TYPE_HOST      = "host"      // TCP connections with or without TLS
+	HBA_TYPE_HOSTSSL   = "hostssl"   // TCP connections with TLS
+	HBA_TYPE_HOSTNOSSL = "hostnossl" // TCP connections without TLS
+
+	HBA_METHOD_TRUST         = "trust"
+	HBA_METHOD_PASSWORD      = "password"
+	HBA_METHOD_SCRAM_SHA_256 = "scram-sha-256" // Same as password, passwords are always checked with SCRAM-SHA-256
+	HBA_METHOD_REJECT        = "reject"
+
+	HBA_ALL = "all"
+)
+
+var HBA_TYPES = []string{HBA_TYPE_LOCAL, HBA_TYPE_HOST, HBA_TYPE_HOSTSSL, HBA_TYPE_HOSTNOSSL}
+var HBA_METHODS = []string{HBA_METHOD_TRUST, HBA_METHOD_PASSWORD, HBA_METHOD_SCRAM_SHA_256, HBA_METHOD_REJECT}
+
+// A line of a pg_hba.conf-style file, e.g. "hostssl all all 0.0.0.0/0 password"
+type HbaRule struct {
+	Type      string
+	Databases []string      // nil for all
+	Users     []string      // nil for all
+	Network   *netip.Prefix // nil for all addresses and local connections
+	Method    string
+}
+
+// Lines in the "TYPE DATABASE USER [ADDRESS] METHOD" format, the address is omitted for local connections.
+// Comments start with #, and databases and users can be comma-separated lists or "all"
+func parseHbaRules(content string) []HbaRule {
+	var rules []HbaRule
+	for i, line := range strings.Split(content, "\n") {
+		lineNumber := common.IntToString(i + 1)
+		line, _, _ = strings.Cut(line, "#")
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		rule := HbaRule{Type: strings.ToLower(fields[0])}
+		if !slices.Contains(HBA_TYPES, rule.Type) {
+			panic("Invalid connection type " + fields[0] + " on line " + lineNumber + " of the HBA rules file. Must be one of " + strings.Join(HBA_TYPES, ", "))
+		}
+
+		expectedFieldCount := 5
+		if rule.Type == HBA_TYPE_LOCAL {
+			expectedFieldCount = 4
+		}
+		if len(fields) != expectedFieldCount {
+			panic("Invalid line " + lineNumber + " of the HBA rules file. Must be in the format TYPE DATABASE USER ADDRESS METHOD, or TYPE DATABASE USER METHOD for local connections")
+		}
+
+		rule.Databases = parseHbaList(fields[1])
+		rule.Users = parseHbaList(fields[2])
+		if rule.Type != HBA_TYPE_LOCAL && fields[3] != HBA_ALL {
+			networks := parseNetworks(fields[3])
+			if len(networks) != 1 {
+				panic("Invalid address " + fields[3] + " on line " + lineNumber + " of the HBA rules file. Must be an IP address, a CIDR range, or all")
+			}
+			rule.Network = &networks[0]
+		}
+
+		rule.Method = strings.ToLower(fields[len(fields)-1])
+		if !slices.Contains(HBA_METHODS, rule.Method) {
+			panic("Invalid method " + fields[len(fields)-1] + " on line " + lineNumber + " of the HBA rules file. Must be one of " + strings.Join(HBA_METHODS, ", "))
+		}
+
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// "all" -> nil, "db1,db2" -> [db1 db2]
+func parseHbaList(value string) []string {
+	if value == HBA_ALL {
+		return nil
+	}
+	return strings.Split(value, ",")
+}
+
+// Returns the first rule matching the connection like Postgres, false if none of them matches
+func (config *Config) HbaRuleFor(remoteAddr net.Addr, tlsEnabled bool, database string, user string) (HbaRule, bool) {
+	tcpAddr, isTcp := remoteAddr.(*net.TCPAddr)
+
+	for _, rule := range config.HbaRules {
+		switch rule.Type {
+		case HBA_TYPE_LOCAL:
+			if isTcp {
+				continue
+			}
+		case HBA_TYPE_HOST:
+			if !isTcp {
+				continue
+			}
+		case HBA_TYPE_HOSTSSL:
+			if !isTcp || !tlsEnabled {
+				continue
+			}
+		case HBA_TYPE_HOSTNOSSL:
+			if !isTcp || tlsEnabled {
+				continue
+			}
+		}
+
+		if rule.Databases != nil && !slices.Contains(rule.Databases, database) {
+			continue
+		}
+		if rule.Users != nil && !slices.Contains(rule.Users, user) {
+			continue
+		}
+		if rule.Network != nil && !rule.Network.Contains(tcpAddr.AddrPort().Addr().Unmap()) {
+			continue
+		}
+		return rule, true
+	}
+	return HbaRule{}, false
+}
+
+// Without HBA rules, users connect without a password if none is configured. Rules with the password method
+// require one like Postgres and reject users without a configured password
+func (config *Config) PasswordRequired(hbaMethod string, encryptedPassword string) bool {
+	if hbaMethod == HBA_METHOD_TRUST {
+		return false
+	}
+	return encryptedPassword != "" || config.HbaRules != nil
+}
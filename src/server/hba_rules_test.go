@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net"
+	"testing"
+)
+
+func TestHbaRuleFor(t *testing.T) {
+	config := &Config{HbaRules: parseHbaRules(`
+# TYPE     DATABASE  USER         ADDRESS       METHOD
+local      all       all                        trust
+host       all       blocked                    all reject
+hostnossl  bemidb    looker,tool  10.0.0.0/8    password
+hostssl    all       all          all           scram-sha-256
+`)}
+	localAddr := &net.UnixAddr{Name: "/tmp/.s.PGSQL.54321", Net: "unix"}
+	privateAddr := &net.TCPAddr{IP: net.ParseIP("10.1.2.3"), Port: 5432}
+	publicAddr := &net.TCPAddr{IP: net.ParseIP("::ffff:203.0.113.1"), Port: 5432}
+
+	t.Run("Returns the method of the first matching rule", func(t *testing.T) {
+		for _, testCase := range []struct {
+			remoteAddr net.Addr
+			tlsEnabled bool
+			database   string
+			user       string
+			method     string
+		}{
+			{localAddr, false, "bemidb", "blocked", HBA_METHOD_TRUST},
+			{privateAddr, true, "bemidb", "blocked", HBA_METHOD_REJECT},
+			{privateAddr, false, "bemidb", "tool", HBA_METHOD_PASSWORD},
+			{privateAddr, true, "bemidb", "tool", HBA_METHOD_SCRAM_SHA_256},
+			{publicAddr, true, "other", "user", HBA_METHOD_SCRAM_SHA_256},
+		} {
+			rule, ok := config.HbaRuleFor(testCase.remoteAddr, testCase.tlsEnabled, testCase.database, testCase.user)
+
+			if !ok || rule.Method != testCase.method {
+				t.Errorf("Expected %s for %s@%s from %v (TLS: %v), got %+v, %v", testCase.method, testCase.user, testCase.database, testCase.remoteAddr, testCase.tlsEnabled, rule, ok)
+			}
+		}
+	})
+
+	t.Run("Doesn't match connections outside of the rules", func(t *testing.T) {
+		for _, remoteAddr := range []net.Addr{privateAddr, publicAddr} {
+			if rule, ok := config.HbaRuleFor(remoteAddr, false, "bemidb", "user"); ok {
+				t.Errorf("Expected no rule for a connection without TLS from %v, got %+v", remoteAddr, rule)
+			}
+		}
+		if rule, ok := config.HbaRuleFor(privateAddr, false, "other", "tool"); ok {
+			t.Errorf("Expected no rule for another database, got %+v", rule)
+		}
+	})
+}
+
+func TestPasswordRequired(t *testing.T) {
+	t.Run("Doesn't require a password without a configured one and HBA rules", func(t *testing.T) {
+		config := &Config{}
+
+		if config.PasswordRequired(HBA_METHOD_PASSWORD, "") {
+			t.Errorf("Expected no password to be required")
+		}
+		if !config.PasswordRequired(HBA_METHOD_PASSWORD, "verifier") {
+			t.Errorf("Expected the configured password to be required")
+		}
+	})
+
+	t.Run("Requires a password with the password method even if none is configured", func(t *testing.T) {
+		config := &Config{HbaRules: parseHbaRules("host all all all password")}
+
+		for _, method := range []string{HBA_METHOD_PASSWORD, HBA_METHOD_SCRAM_SHA_256} {
+			if !config.PasswordRequired(method, "") {
+				t.Errorf("Expected a password to be required with %s", method)
+			}
+		}
+		if config.PasswordRequired(HBA_METHOD_TRUST, "verifier") {
+			t.Errorf("Expected no password to be required with trust")
+		}
+	})
+}
@@ -20,6 +20,10 @@ func (reader *IcebergReader) SchemaTables() (icebergSchemaTables common.Set[comm
 	return reader.IcebergCatalog.SchemaTables()
 }
 
+func (reader *IcebergReader) Schemas() (schemas common.Set[string], err error) {
+	return reader.IcebergCatalog.Schemas()
+}
+
 func (reader *IcebergReader) MaterializedViews() (icebergSchemaTables []common.IcebergMaterializedView, err error) {
 	return reader.IcebergCatalog.MaterializedViews()
 }
@@ -28,6 +32,14 @@ func (reader *IcebergReader) MaterializedView(icebergSchemaTable common.IcebergS
 	return reader.IcebergCatalog.MaterializedView(icebergSchemaTable)
 }
 
+func (reader *IcebergReader) Views() (icebergViews []common.IcebergView, err error) {
+	return reader.IcebergCatalog.Views()
+}
+
+func (reader *IcebergReader) TablePartitions() (icebergTablePartitions []common.IcebergTablePartition, err error) {
+	return reader.IcebergCatalog.TablePartitions()
+}
+
 func (reader *IcebergReader) TableColumns(icebergSchemaTable common.IcebergSchemaTable) (catalogTableColumns []common.CatalogTableColumn, err error) {
 	return reader.IcebergCatalog.TableColumns(icebergSchemaTable)
 }
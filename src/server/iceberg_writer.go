@@ -1,6 +1,13 @@
 package main
 
 import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+
 	"github.com/BemiHQ/BemiDB/src/common"
 )
 
@@ -9,22 +16,34 @@ type IcebergWriter struct {
 	StorageS3          *common.StorageS3
 	ServerDuckdbClient *common.DuckdbClient
 	IcebergCatalog     *common.IcebergCatalog
+	LockTracker        *LockTracker
 }
 
-func NewIcebergWriter(config *Config, storageS3 *common.StorageS3, serverDuckdbClient *common.DuckdbClient, icebergCatalog *common.IcebergCatalog) *IcebergWriter {
+func NewIcebergWriter(config *Config, storageS3 *common.StorageS3, serverDuckdbClient *common.DuckdbClient, icebergCatalog *common.IcebergCatalog, lockTracker *LockTracker) *IcebergWriter {
 	return &IcebergWriter{
 		Config:             config,
 		StorageS3:          storageS3,
 		ServerDuckdbClient: serverDuckdbClient,
 		IcebergCatalog:     icebergCatalog,
+		LockTracker:        lockTracker,
 	}
 }
 
+func (writer *IcebergWriter) CreateSchema(schema string, ifNotExists bool) error {
+	return writer.IcebergCatalog.CreateSchema(schema, ifNotExists)
+}
+
 func (writer *IcebergWriter) CreateMaterializedView(icebergSchemaTable common.IcebergSchemaTable, remappedDefinitionQuery string, ifNotExists bool) error {
+	lockPid := writer.LockTracker.AcquireTableLock(icebergSchemaTable)
+	defer writer.LockTracker.Release(lockPid)
+
 	return writer.IcebergCatalog.CreateMaterializedView(icebergSchemaTable, remappedDefinitionQuery, ifNotExists)
 }
 
 func (writer *IcebergWriter) RenameMaterializedView(icebergSchemaTable common.IcebergSchemaTable, newName string, missingOk bool) error {
+	lockPid := writer.LockTracker.AcquireTableLock(icebergSchemaTable)
+	defer writer.LockTracker.Release(lockPid)
+
 	err := writer.IcebergCatalog.RenameMaterializedView(icebergSchemaTable, newName, missingOk)
 	if err != nil {
 		return err
@@ -35,7 +54,213 @@ func (writer *IcebergWriter) RenameMaterializedView(icebergSchemaTable common.Ic
 	return nil
 }
 
+func (writer *IcebergWriter) CreateView(icebergSchemaTable common.IcebergSchemaTable, definition string, orReplace bool) error {
+	return writer.IcebergCatalog.CreateView(icebergSchemaTable, definition, orReplace)
+}
+
+func (writer *IcebergWriter) DropView(icebergSchemaTable common.IcebergSchemaTable, missingOk bool) error {
+	return writer.IcebergCatalog.DropView(icebergSchemaTable, missingOk)
+}
+
+// CREATE TABLE table AS SELECT ...
+func (writer *IcebergWriter) CreateTableFromQuery(icebergSchemaTable common.IcebergSchemaTable, query string) error {
+	lockPid := writer.LockTracker.AcquireTableLock(icebergSchemaTable)
+	defer writer.LockTracker.Release(lockPid)
+
+	err := writer.replaceTableFromQuery(icebergSchemaTable, query)
+	if err != nil {
+		return err
+	}
+	return writer.IcebergCatalog.AddCreatedTable(icebergSchemaTable)
+}
+
+// ALTER TABLE table RENAME TO new_table, only for tables created with CREATE TABLE ... AS
+func (writer *IcebergWriter) RenameTable(icebergSchemaTable common.IcebergSchemaTable, newName string) error {
+	lockPid := writer.LockTracker.AcquireTableLock(icebergSchemaTable)
+	defer writer.LockTracker.Release(lockPid)
+
+	err := writer.checkCreatedTable(icebergSchemaTable, "renamed")
+	if err != nil {
+		return err
+	}
+
+	icebergTable := common.NewIcebergTable(writer.Config.CommonConfig, writer.StorageS3, writer.ServerDuckdbClient, icebergSchemaTable)
+	icebergTable.Rename(newName)
+	return writer.IcebergCatalog.RenameCreatedTable(icebergSchemaTable, newName)
+}
+
+// DROP TABLE table, only for tables created with CREATE TABLE ... AS since their files are deleted
+func (writer *IcebergWriter) DropTable(icebergSchemaTable common.IcebergSchemaTable) error {
+	lockPid := writer.LockTracker.AcquireTableLock(icebergSchemaTable)
+	defer writer.LockTracker.Release(lockPid)
+
+	err := writer.checkCreatedTable(icebergSchemaTable, "dropped")
+	if err != nil {
+		return err
+	}
+
+	icebergTable := common.NewIcebergTable(writer.Config.CommonConfig, writer.StorageS3, writer.ServerDuckdbClient, icebergSchemaTable)
+	icebergTable.DropIfExists()
+	return writer.IcebergCatalog.DropCreatedTable(icebergSchemaTable)
+}
+
+// Synced tables belong to their syncers, which would write them again
+func (writer *IcebergWriter) checkCreatedTable(icebergSchemaTable common.IcebergSchemaTable, action string) error {
+	created, err := writer.IcebergCatalog.IsCreatedTable(icebergSchemaTable)
+	if err != nil {
+		return err
+	}
+	if !created {
+		return &PgError{
+			Code:    PG_ERROR_CODE_INSUFFICIENT_PRIVILEGE,
+			Message: "must be owner of table " + icebergSchemaTable.Table,
+			Detail:  "Only tables created with CREATE TABLE ... AS can be " + action + ", synced tables are written by their syncers.",
+		}
+	}
+	return nil
+}
+
 func (writer *IcebergWriter) RefreshMaterializedView(icebergSchemaTable common.IcebergSchemaTable, remappedDefinitionQuery string) error {
+	lockPid := writer.LockTracker.AcquireTableLock(icebergSchemaTable)
+	defer writer.LockTracker.Release(lockPid)
+
+	return writer.replaceTableFromQuery(icebergSchemaTable, remappedDefinitionQuery)
+}
+
+func (writer *IcebergWriter) DropMaterializedView(icebergSchemaTable common.IcebergSchemaTable, missingOk bool) error {
+	lockPid := writer.LockTracker.AcquireTableLock(icebergSchemaTable)
+	defer writer.LockTracker.Release(lockPid)
+
+	err := writer.IcebergCatalog.DropMaterializedView(icebergSchemaTable, missingOk)
+	if err != nil {
+		return err
+	}
+
+	icebergTable := common.NewIcebergTable(writer.Config.CommonConfig, writer.StorageS3, writer.ServerDuckdbClient, icebergSchemaTable)
+	icebergTable.DropIfExists()
+
+	return nil
+}
+
+// COPY table (columns) FROM STDIN: appends the rows of the CSV file to a table created with CREATE TABLE ... AS. Returns the number of loaded rows
+func (writer *IcebergWriter) AppendFromCsvFile(icebergSchemaTable common.IcebergSchemaTable, columnNames []string, csvFilePath string, options CopyOptions) (int64, error) {
+	csvColumns := make([]string, len(columnNames))
+	for i, columnName := range columnNames {
+		csvColumns[i] = "'" + strings.ReplaceAll(columnName, "'", "''") + "': 'VARCHAR'"
+	}
+
+	return writer.appendRows(icebergSchemaTable, func(ctx context.Context, duckdbTableName string) (sql.Result, error) {
+		return writer.ServerDuckdbClient.ExecContext(ctx,
+			"INSERT INTO "+duckdbTableName+" BY NAME SELECT * FROM read_csv('$csvPath', auto_detect=false, header="+fmt.Sprint(options.Header)+
+				", delim='$delimiter', quote='$quote', escape='$escape', nullstr='$nullString', allow_quoted_nulls=false, columns={"+strings.Join(csvColumns, ", ")+"})",
+			map[string]string{
+				"csvPath":    csvFilePath,
+				"delimiter":  options.Delimiter,
+				"quote":      options.Quote,
+				"escape":     options.Escape,
+				"nullString": options.Null,
+			},
+		)
+	})
+}
+
+// INSERT INTO table [(columns)] VALUES ... / SELECT ...: same as AppendFromCsvFile with the rows of the remapped VALUES or SELECT query.
+// Columns that aren't listed are set to NULL
+func (writer *IcebergWriter) AppendFromQuery(icebergSchemaTable common.IcebergSchemaTable, columnNames []string, query string, variables []interface{}) (int64, error) {
+	var columnList string
+	if len(columnNames) > 0 {
+		quotedColumnNames := make([]string, len(columnNames))
+		for i, columnName := range columnNames {
+			quotedColumnNames[i] = "\"" + strings.ReplaceAll(columnName, "\"", "\"\"") + "\""
+		}
+		columnList = " (" + strings.Join(quotedColumnNames, ", ") + ")"
+	}
+
+	return writer.appendRows(icebergSchemaTable, func(ctx context.Context, duckdbTableName string) (sql.Result, error) {
+		return writer.ServerDuckdbClient.Db.ExecContext(ctx, "INSERT INTO "+duckdbTableName+columnList+" "+query, variables...)
+	})
+}
+
+// UPDATE table ... / DELETE FROM table ...: runs the remapped query retargeted to a DuckDB table with the rows of each Parquet file of a table
+// created with CREATE TABLE ... AS, and rewrites only the changed files. Returns the number of updated or deleted rows
+func (writer *IcebergWriter) ChangeFromQuery(icebergSchemaTable common.IcebergSchemaTable, retargetQuery func(duckdbTableName string) (string, error), variables []interface{}) (int64, error) {
+	lockPid := writer.LockTracker.AcquireTableLock(icebergSchemaTable)
+	defer writer.LockTracker.Release(lockPid)
+
+	err := writer.checkCreatedTable(icebergSchemaTable, "changed")
+	if err != nil {
+		return 0, err
+	}
+
+	icebergTableWriter := writer.newIcebergTableWriter(icebergSchemaTable)
+	return icebergTableWriter.ChangeFromQuery(func(duckdbTableName string) (int64, error) {
+		query, err := retargetQuery(duckdbTableName)
+		if err != nil {
+			return 0, err
+		}
+		result, err := writer.ServerDuckdbClient.Db.ExecContext(context.Background(), query, variables...)
+		if err != nil {
+			return 0, err
+		}
+		return result.RowsAffected()
+	})
+}
+
+// Loads the new rows into an empty DuckDB table with the table's columns to cast and validate them first, then appends them to a new Parquet file
+func (writer *IcebergWriter) appendRows(icebergSchemaTable common.IcebergSchemaTable, insertRows func(ctx context.Context, duckdbTableName string) (sql.Result, error)) (int64, error) {
+	lockPid := writer.LockTracker.AcquireTableLock(icebergSchemaTable)
+	defer writer.LockTracker.Release(lockPid)
+
+	err := writer.checkCreatedTable(icebergSchemaTable, "changed")
+	if err != nil {
+		return 0, err
+	}
+
+	ctx := context.Background()
+	duckdbTableName := "copy_" + strings.ReplaceAll(uuid.New().String(), "-", "")
+	defer writer.ServerDuckdbClient.ExecContext(ctx, "DROP TABLE IF EXISTS "+duckdbTableName)
+
+	_, err = writer.ServerDuckdbClient.ExecContext(ctx, "CREATE TABLE "+duckdbTableName+" AS SELECT * FROM iceberg_scan('$path') LIMIT 0", map[string]string{
+		"path": writer.IcebergCatalog.MetadataFileS3Path(icebergSchemaTable),
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := insertRows(ctx, duckdbTableName)
+	if err != nil {
+		return 0, err
+	}
+	rowCount, err := result.RowsAffected()
+	if err != nil || rowCount == 0 {
+		return 0, err
+	}
+
+	icebergTableWriter := writer.newIcebergTableWriter(icebergSchemaTable)
+	return icebergTableWriter.AppendFromQuery("SELECT * FROM " + duckdbTableName)
+}
+
+func (writer *IcebergWriter) newIcebergTableWriter(icebergSchemaTable common.IcebergSchemaTable) *common.IcebergTableWriter {
+	return common.NewIcebergTableWriter(
+		writer.Config.CommonConfig,
+		writer.StorageS3,
+		writer.ServerDuckdbClient,
+		common.NewIcebergTable(writer.Config.CommonConfig, writer.StorageS3, writer.ServerDuckdbClient, icebergSchemaTable),
+		[]*common.IcebergSchemaColumn{},
+		1,
+	)
+}
+
+// SELECT id, name AS full_name, CAST(NULL AS int) AS age -> rewrites the table with the selected columns of its rows
+func (writer *IcebergWriter) AlterColumns(icebergSchemaTable common.IcebergSchemaTable, selectQuery string) error {
+	lockPid := writer.LockTracker.AcquireTableLock(icebergSchemaTable)
+	defer writer.LockTracker.Release(lockPid)
+
+	return writer.replaceTableFromQuery(icebergSchemaTable, selectQuery+" FROM iceberg_scan('"+writer.IcebergCatalog.MetadataFileS3Path(icebergSchemaTable)+"')")
+}
+
+// Writes the query results to a -syncing table and swaps it with the table
+func (writer *IcebergWriter) replaceTableFromQuery(icebergSchemaTable common.IcebergSchemaTable, query string) error {
 	// Delete -syncing table
 	syncingIcebergSchemaTable := common.IcebergSchemaTable{Schema: icebergSchemaTable.Schema, Table: icebergSchemaTable.Table + common.TEMP_TABLE_SUFFIX_SYNCING}
 	syncingIcebergTable := common.NewIcebergTable(writer.Config.CommonConfig, writer.StorageS3, writer.ServerDuckdbClient, syncingIcebergSchemaTable)
@@ -50,7 +275,7 @@ func (writer *IcebergWriter) RefreshMaterializedView(icebergSchemaTable common.I
 		[]*common.IcebergSchemaColumn{},
 		1,
 	)
-	err := icebergTableWriter.InsertFromQuery(remappedDefinitionQuery)
+	err := icebergTableWriter.InsertFromQuery(query)
 	if err != nil {
 		return err
 	}
@@ -72,15 +297,3 @@ func (writer *IcebergWriter) RefreshMaterializedView(icebergSchemaTable common.I
 
 	return nil
 }
-
-func (writer *IcebergWriter) DropMaterializedView(icebergSchemaTable common.IcebergSchemaTable, missingOk bool) error {
-	err := writer.IcebergCatalog.DropMaterializedView(icebergSchemaTable, missingOk)
-	if err != nil {
-		return err
-	}
-
-	icebergTable := common.NewIcebergTable(writer.Config.CommonConfig, writer.StorageS3, writer.ServerDuckdbClient, icebergSchemaTable)
-	icebergTable.DropIfExists()
-
-	return nil
-}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"strings"
+
+	pgQuery "github.com/pganalyze/pg_query_go/v6"
+
+	"github.com/BemiHQ/BemiDB/src/common"
+)
+
+// Identifiers referenced and defined in a query, unquoted identifiers are already folded to lowercase by the parser
+type QueryIdentifiers struct {
+	Tables             []QuerySchemaTable // FROM schema.table
+	TableFunctionNames []string           // FROM function(), with columns that aren't known before running it
+	ColumnNames        []string           // Last field of column references, e.g. t.column -> column
+	DefinedNames       []string           // Table and column aliases, CTE names, and column definitions of table functions
+}
+
+// SELECT t.id AS "userId" FROM users t -> tables [users], columns [id], defined names [userId, t]
+func (parser *ParserTable) ReferencedIdentifiers(query string) (QueryIdentifiers, error) {
+	var identifiers QueryIdentifiers
+
+	qSchemaTables, err := parser.ReferencedQuerySchemaTables(query)
+	if err != nil {
+		return identifiers, err
+	}
+	identifiers.Tables = qSchemaTables
+
+	identifiers.TableFunctionNames, err = parser.ReferencedTableFunctionNames(query)
+	if err != nil {
+		return identifiers, err
+	}
+
+	err = parser.walkQueryTree(query, "ColumnRef", func(columnRef map[string]interface{}) {
+		fields, _ := columnRef["fields"].([]interface{})
+		if columnName := parser.stringNodeValue(fields[len(fields)-1]); columnName != "" { // Not t.*
+			identifiers.ColumnNames = append(identifiers.ColumnNames, columnName)
+		}
+	})
+	if err != nil {
+		return identifiers, err
+	}
+
+	for nodeType, nameKeys := range map[string][]string{
+		"ResTarget":       {"name"},
+		"Alias":           {"aliasname", "colnames"},
+		"CommonTableExpr": {"ctename", "aliascolnames"},
+		"ColumnDef":       {"colname"},
+	} {
+		err = parser.walkQueryTree(query, nodeType, func(node map[string]interface{}) {
+			for _, nameKey := range nameKeys {
+				switch value := node[nameKey].(type) {
+				case string:
+					identifiers.DefinedNames = append(identifiers.DefinedNames, value)
+				case []interface{}:
+					for _, nameNode := range value {
+						identifiers.DefinedNames = append(identifiers.DefinedNames, parser.stringNodeValue(nameNode))
+					}
+				}
+			}
+		})
+		if err != nil {
+			return identifiers, err
+		}
+	}
+
+	return identifiers, nil
+}
+
+// {"String": {"sval": "name"}} -> name
+func (parser *ParserTable) stringNodeValue(node interface{}) string {
+	typedNode, _ := node.(map[string]interface{})
+	stringNode, _ := typedNode["String"].(map[string]interface{})
+	value, _ := stringNode["sval"].(string)
+	return value
+}
+
+// DuckDB matches identifiers case-insensitively, while Postgres matches them exactly after folding unquoted identifiers to lowercase.
+// With BEMIDB_IDENTIFIER_CASE=postgres, a SELECT referencing a table or a column only by a different case fails like in Postgres:
+// SELECT timeMsColumn FROM t -> column "timemscolumn" does not exist, if t only has a "timeMsColumn" column.
+// Columns are checked against the Iceberg schemas of the tables cached from the catalog and the session's temp tables,
+// and aren't checked if the query also reads views, system tables, or table functions with columns known only to DuckDB
+func (remapper *QueryRemapper) checkIdentifierCase(query string) error {
+	if remapper.config.IdentifierCase != IDENTIFIER_CASE_POSTGRES {
+		return nil
+	}
+
+	identifiers, err := remapper.remapperTable.parserTable.ReferencedIdentifiers(query)
+	if err != nil || len(identifiers.Tables) == 0 {
+		return err
+	}
+
+	definedNames := common.NewSet[string]().AddAll(identifiers.DefinedNames)
+	existingColumnNames := common.NewSet[string]()
+	columnsKnown := len(identifiers.TableFunctionNames) == 0
+	var tempTableNames []string
+	for _, qSchemaTable := range identifiers.Tables {
+		if qSchemaTable.Schema == "" && definedNames.Contains(qSchemaTable.Table) { // CTE
+			continue
+		}
+		if remapper.tempTables.IsTempTable(remapper.Session, &pgQuery.RangeVar{Schemaname: qSchemaTable.Schema, Relname: qSchemaTable.Table}) {
+			tempTableNames = append(tempTableNames, qSchemaTable.Table)
+			continue
+		}
+
+		icebergSchemaTable := remapper.resolveQuerySchemaTable(qSchemaTable).ToIcebergSchemaTable()
+		columnNames, ok, err := remapper.remapperTable.IcebergColumnNames(icebergSchemaTable)
+		if err != nil {
+			return err
+		}
+		if ok {
+			existingColumnNames.AddAll(columnNames)
+			continue
+		}
+
+		columnsKnown = false // E.g. a view or a system table
+		if remapper.caseMismatchedTable(qSchemaTable, icebergSchemaTable.Schema) {
+			return &PgError{Code: PG_ERROR_CODE_UNDEFINED_TABLE, Message: "relation \"" + qSchemaTable.Table + "\" does not exist"}
+		}
+	}
+	if !columnsKnown {
+		return nil
+	}
+
+	if len(tempTableNames) > 0 {
+		columnNames, err := remapper.tempTables.ColumnNames(remapper.Session, tempTableNames)
+		if err != nil {
+			return err
+		}
+		existingColumnNames.AddAll(columnNames)
+	}
+
+	for _, columnName := range identifiers.ColumnNames {
+		if existingColumnName := caseMismatch(columnName, existingColumnNames, definedNames); existingColumnName != "" {
+			return &PgError{
+				Code:    PG_ERROR_CODE_UNDEFINED_COLUMN,
+				Message: "column \"" + columnName + "\" does not exist",
+				Hint:    "Perhaps you meant to reference the column \"" + existingColumnName + "\".",
+			}
+		}
+	}
+	return nil
+}
+
+// FROM Users -> true if the session has a "users" temp table or the schema has a "users" table or view, but no "Users"
+func (remapper *QueryRemapper) caseMismatchedTable(qSchemaTable QuerySchemaTable, schema string) bool {
+	existingTableNames := common.NewSet[string]().AddAll(remapper.remapperTable.IcebergTableNames(schema))
+	if qSchemaTable.Schema == "" || qSchemaTable.Schema == PG_SCHEMA_PG_TEMP {
+		existingTableNames.AddAll(remapper.Session.TempTables.Values())
+	}
+	return caseMismatch(qSchemaTable.Table, existingTableNames, common.NewSet[string]()) != ""
+}
+
+// Returns the existing name matching the name only case-insensitively, or an empty string
+func caseMismatch(name string, existingNames common.Set[string], definedNames common.Set[string]) string {
+	if existingNames.Contains(name) || definedNames.Contains(name) {
+		return ""
+	}
+	for _, existingName := range existingNames.Values() {
+		if strings.EqualFold(existingName, name) {
+			return existingName
+		}
+	}
+	return ""
+}
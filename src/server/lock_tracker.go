@@ -0,0 +1,74 @@
+package main
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/BemiHQ/BemiDB/src/common"
+)
+
+const (
+	PG_LOCK_TYPE_RELATION   = "relation"
+	PG_LOCK_TYPE_VIRTUALXID = "virtualxid"
+
+	PG_LOCK_MODE_ACCESS_EXCLUSIVE = "AccessExclusiveLock"
+	PG_LOCK_MODE_EXCLUSIVE        = "ExclusiveLock"
+)
+
+type TrackedLock struct {
+	Pid                int32 // Internal lock holder ID since all connections are served by a single process
+	LockType           string
+	Mode               string
+	IcebergSchemaTable *common.IcebergSchemaTable // nilable, set for relation locks
+}
+
+// Keeps track of running queries and DDL operations on Iceberg tables to expose them in pg_locks
+type LockTracker struct {
+	mutex   sync.Mutex
+	lastPid int32
+	locks   map[int32]TrackedLock
+}
+
+func NewLockTracker() *LockTracker {
+	return &LockTracker{locks: make(map[int32]TrackedLock)}
+}
+
+func (tracker *LockTracker) AcquireQueryLock() int32 {
+	return tracker.acquire(TrackedLock{LockType: PG_LOCK_TYPE_VIRTUALXID, Mode: PG_LOCK_MODE_EXCLUSIVE})
+}
+
+func (tracker *LockTracker) AcquireTableLock(icebergSchemaTable common.IcebergSchemaTable) int32 {
+	return tracker.acquire(TrackedLock{LockType: PG_LOCK_TYPE_RELATION, Mode: PG_LOCK_MODE_ACCESS_EXCLUSIVE, IcebergSchemaTable: &icebergSchemaTable})
+}
+
+func (tracker *LockTracker) Release(pid int32) {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+
+	delete(tracker.locks, pid)
+}
+
+// Returns locks sorted by acquisition order
+func (tracker *LockTracker) Locks() []TrackedLock {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+
+	locks := make([]TrackedLock, 0, len(tracker.locks))
+	for _, lock := range tracker.locks {
+		locks = append(locks, lock)
+	}
+	sort.Slice(locks, func(i, j int) bool {
+		return locks[i].Pid < locks[j].Pid
+	})
+	return locks
+}
+
+func (tracker *LockTracker) acquire(lock TrackedLock) int32 {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+
+	tracker.lastPid++
+	lock.Pid = tracker.lastPid
+	tracker.locks[lock.Pid] = lock
+	return lock.Pid
+}
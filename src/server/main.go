@@ -1,18 +1,27 @@
 package main
 
 import (
+	"flag"
 	"log"
+	"net"
 	"net/http"
 	_ "net/http/pprof"
+	"os"
 	"slices"
+	"strings"
 	"sync/atomic"
+	_ "time/tzdata" // Time zones of timestamptz values for SET timezone, the Docker image has no tzdata package
 
 	"github.com/BemiHQ/BemiDB/src/common"
 )
 
 const (
-	COMMAND_START   = "start"
-	COMMAND_VERSION = "version"
+	COMMAND_START           = "start"
+	COMMAND_VERSION         = "version"
+	COMMAND_BACKUP_CATALOG  = "backup-catalog"
+	COMMAND_RESTORE_CATALOG = "restore-catalog"
+	COMMAND_CHECK_CATALOG   = "check-catalog"
+	COMMAND_COMPARE         = "compare"
 
 	DUCKDB_SCHEMA_MAIN = "main"
 )
@@ -21,35 +30,85 @@ func main() {
 	config := LoadConfig()
 	defer common.HandleUnexpectedPanic(config.CommonConfig)
 
+	switch flag.Arg(0) {
+	case COMMAND_BACKUP_CATALOG:
+		BackupCatalog(config, flag.Arg(1))
+		return
+	case COMMAND_RESTORE_CATALOG:
+		RestoreCatalog(config, flag.Arg(1))
+		return
+	case COMMAND_CHECK_CATALOG:
+		if !CheckCatalog(config) {
+			os.Exit(1)
+		}
+		return
+	case COMMAND_COMPARE:
+		CompareResults(config, flag.Arg(1), flag.Arg(2), flag.Arg(3))
+		return
+	}
+
+	common.PanicInsteadOfExit = true // Failing queries are recovered from per connection
+
 	if config.CommonConfig.LogLevel == common.LOG_LEVEL_TRACE {
 		go enableProfiling()
 	}
 
 	tcpListener := NewTcpListener(config)
 	common.LogInfo(config.CommonConfig, "BemiDB: Listening on", tcpListener.Addr())
+	unixListener := NewUnixListener(config)
+	if unixListener != nil {
+		common.LogInfo(config.CommonConfig, "BemiDB: Listening on", unixListener.Addr())
+		defer unixListener.Close()
+	}
 
 	duckdbClient := common.NewDuckdbClient(config.CommonConfig, duckdbBootQueris(config))
 	common.LogInfo(config.CommonConfig, "DuckDB: Connected")
 	defer duckdbClient.Close()
 
 	queryHandler := NewQueryHandler(config, duckdbClient)
+	if config.CheckCatalogOnStart {
+		goWithPanicHandler(config, queryHandler.QueryRemapper.CheckCatalog)
+	}
+
+	canaryRunner := NewCanaryRunner(config, queryHandler)
+	goWithPanicHandler(config, canaryRunner.Run)
+	if config.HealthPort != "" {
+		goWithPanicHandler(config, canaryRunner.ServeHealth)
+	}
 
 	var connectionCount int64 = 0
+	if unixListener != nil {
+		goWithPanicHandler(config, func() { acceptConnections(config, unixListener, queryHandler, &connectionCount) })
+	}
+	acceptConnections(config, tcpListener, queryHandler, &connectionCount)
+}
+
+func acceptConnections(config *Config, listener net.Listener, queryHandler *QueryHandler, connectionCount *int64) {
 	for {
-		conn := AcceptConnection(config, tcpListener)
-		atomic.AddInt64(&connectionCount, 1)
-		common.LogInfo(config.CommonConfig, "BemiDB: Accepted", common.Int64ToString(atomic.LoadInt64(&connectionCount))+"th", "connection from", conn.RemoteAddr())
+		conn := AcceptConnection(config, listener)
+		atomic.AddInt64(connectionCount, 1)
+		common.LogInfo(config.CommonConfig, "BemiDB: Accepted", common.Int64ToString(atomic.LoadInt64(connectionCount))+"th", "connection from", conn.RemoteAddr())
 		server := NewPostgresServer(config, &conn)
 
 		go func() {
-			server.Run(queryHandler)
+			defer atomic.AddInt64(connectionCount, -1)
 			defer server.Close()
-			common.LogInfo(config.CommonConfig, "BemiDB: Closed", common.Int64ToString(atomic.LoadInt64(&connectionCount))+"th", "connection from", conn.RemoteAddr())
-			atomic.AddInt64(&connectionCount, -1)
+			defer server.RecoverPanic()
+
+			server.Run(queryHandler)
+			common.LogInfo(config.CommonConfig, "BemiDB: Closed", common.Int64ToString(atomic.LoadInt64(connectionCount))+"th", "connection from", conn.RemoteAddr())
 		}()
 	}
 }
 
+// Exits the process on unexpected errors in the goroutine like in the main goroutine, since PanicIfError panics in the server
+func goWithPanicHandler(config *Config, function func()) {
+	go func() {
+		defer common.HandleUnexpectedPanic(config.CommonConfig)
+		function()
+	}()
+}
+
 func duckdbBootQueris(config *Config) []string {
 	return slices.Concat(
 		[]string{
@@ -60,13 +119,17 @@ func duckdbBootQueris(config *Config) []string {
 			// Set up schemas
 			"SELECT oid FROM pg_catalog.pg_namespace",
 			"CREATE SCHEMA " + PG_SCHEMA_PUBLIC,
+			"CREATE SCHEMA " + BEMIDB_SCHEMA,
 
 			// Configure DuckDB
 			"SET memory_limit='3GB'",
-			"SET threads=2",
+			"SET threads=" + common.IntToString(config.MaxParallelDownloads),
 			"SET scalar_subquery_error_on_multiple_rows=false",
 		},
 
+		// Tune reading from S3
+		storageTuningQueries(config),
+
 		// Create pg-compatible functions
 		CreatePgCatalogMacroQueries(config),
 		CreateInformationSchemaMacroQueries(config),
@@ -75,11 +138,77 @@ func duckdbBootQueris(config *Config) []string {
 		CreatePgCatalogTableQueries(config),
 		CreateInformationSchemaTableQueries(config),
 
+		// Create BemiDB system tables
+		[]string{
+			"CREATE TABLE " + BEMIDB_SCHEMA + "." + BEMIDB_TABLE_CONNECTION_LOG + "(pid int4, usename text, datname text, application_name text, client_addr text, backend_start timestamp, backend_end timestamp, query_count int8, storage_latency_notice_count int8)",
+			"CREATE TABLE " + BEMIDB_SCHEMA + "." + BEMIDB_TABLE_BROKEN_TABLES + "(schema_name text, table_name text, problem text, checked_at timestamptz)",
+		},
+
 		// Use the public schema
 		[]string{"USE " + PG_SCHEMA_PUBLIC},
+
+		// Set up S3 credentials for other buckets and prefixes
+		storageSecretQueries(config),
+
+		// Run user-provided SQL (e.g., install extensions, create macros, change settings)
+		duckdbInitQueries(config),
 	)
 }
 
+// DuckDB uses the secret with the longest scope matching the S3 path, falling back to the secret of the configured bucket
+func storageSecretQueries(config *Config) []string {
+	queries := make([]string, len(config.StorageSecrets))
+	for i, storageSecret := range config.StorageSecrets {
+		options := []string{
+			"TYPE S3",
+			"KEY_ID " + quoteSqlString(storageSecret.AccessKeyId),
+			"SECRET " + quoteSqlString(storageSecret.SecretAccessKey),
+			"REGION " + quoteSqlString(storageSecret.Region),
+			"ENDPOINT " + quoteSqlString(storageSecret.Endpoint),
+			"SCOPE " + quoteSqlString(storageSecret.Scope),
+		}
+		if storageSecret.SessionToken != "" {
+			options = append(options, "SESSION_TOKEN "+quoteSqlString(storageSecret.SessionToken))
+		}
+		if storageSecret.Endpoint != common.DEFAULT_AWS_S3_ENDPOINT {
+			options = append(options, "URL_STYLE 'path'")
+		}
+		if common.IsLocalHost(storageSecret.Endpoint) {
+			options = append(options, "USE_SSL false")
+		}
+		queries[i] = "CREATE OR REPLACE SECRET storage_secret_" + common.IntToString(i+1) + " (" + strings.Join(options, ", ") + ")"
+	}
+	return queries
+}
+
+// Global defaults of the httpfs settings, sessions can override them with SET bemidb.http_retries, etc.
+func storageTuningQueries(config *Config) []string {
+	var queries []string
+	switch config.S3Prefetch {
+	case S3_PREFETCH_ALL:
+		queries = append(queries, "SET prefetch_all_parquet_files=true")
+	case S3_PREFETCH_OFF:
+		queries = append(queries, "SET disable_parquet_prefetching=true")
+	}
+	if config.S3HttpRetries > 0 {
+		queries = append(queries, "SET GLOBAL http_retries="+common.IntToString(config.S3HttpRetries))
+	}
+	if config.S3HttpRetryWaitMs > 0 {
+		queries = append(queries, "SET GLOBAL http_retry_wait_ms="+common.IntToString(config.S3HttpRetryWaitMs))
+	}
+	if config.S3HttpTimeoutSeconds > 0 {
+		queries = append(queries, "SET GLOBAL http_timeout="+common.IntToString(config.S3HttpTimeoutSeconds))
+	}
+	return queries
+}
+
+func duckdbInitQueries(config *Config) []string {
+	if strings.TrimSpace(config.DuckdbInitSql) == "" {
+		return []string{}
+	}
+	return []string{config.DuckdbInitSql}
+}
+
 func enableProfiling() {
 	func() { log.Println(http.ListenAndServe(":6060", nil)) }()
 }
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BemiHQ/BemiDB/src/common"
+)
+
+const (
+	MEMORY_ADMISSION_POLL_INTERVAL = 100 * time.Millisecond
+	MEMORY_ADMISSION_QUEUE_TIMEOUT = 60 * time.Second
+
+	PROC_MEMINFO_PATH = "/proc/meminfo"
+)
+
+var DUCKDB_MEMORY_UNIT_BYTES = map[string]float64{
+	"bytes": 1,
+	"KiB":   1 << 10,
+	"MiB":   1 << 20,
+	"GiB":   1 << 30,
+	"TiB":   1 << 40,
+	"PiB":   1 << 50,
+	"EiB":   1 << 60,
+	"KB":    1e3,
+	"MB":    1e6,
+	"GB":    1e9,
+	"TB":    1e12,
+	"PB":    1e15,
+	"EB":    1e18,
+}
+
+// Counts of admission decisions since the server started
+type MemoryAdmissionMetrics struct {
+	AdmittedCount int64
+	QueuedCount   int64 // Admitted after waiting for memory
+	RejectedCount int64 // Timed out or canceled while waiting for memory
+}
+
+// Queues new queries that scan Iceberg tables while DuckDB or the OS is low on memory instead of letting the process
+// get OOM-killed. Under pressure, a query is admitted only if no other Iceberg queries are running
+type MemoryAdmissionController struct {
+	mutex        sync.Mutex
+	config       *Config
+	duckdbClient *common.DuckdbClient
+	runningCount int
+	metrics      MemoryAdmissionMetrics
+}
+
+func NewMemoryAdmissionController(config *Config, duckdbClient *common.DuckdbClient) *MemoryAdmissionController {
+	return &MemoryAdmissionController{config: config, duckdbClient: duckdbClient}
+}
+
+func (controller *MemoryAdmissionController) Enabled() bool {
+	return controller.config.MemoryPressurePercent > 0
+}
+
+// Blocks until the query can run, the returned function must be called after the query rows are closed
+func (controller *MemoryAdmissionController) Admit(ctx context.Context, query string) (func(), error) {
+	if !controller.Enabled() || !strings.Contains(query, "iceberg_scan(") {
+		return func() {}, nil
+	}
+
+	queuedAt := time.Now()
+	queued := false
+	for {
+		pressure, err := controller.memoryPressure(ctx)
+		if err != nil {
+			common.LogWarn(controller.config.CommonConfig, "Couldn't check memory pressure:", err)
+		}
+
+		controller.mutex.Lock()
+		if pressure == "" || controller.runningCount == 0 {
+			controller.runningCount++
+			controller.metrics.AdmittedCount++
+			if queued {
+				controller.metrics.QueuedCount++
+			}
+			metrics := controller.metrics
+			controller.mutex.Unlock()
+
+			if queued {
+				common.LogInfo(controller.config.CommonConfig, "Memory admission: admitted a queued query after", time.Since(queuedAt).Round(time.Millisecond), metrics.String())
+			}
+			return controller.release, nil
+		}
+		controller.mutex.Unlock()
+
+		if !queued {
+			queued = true
+			common.LogWarn(controller.config.CommonConfig, "Memory admission: queued a query,", pressure)
+		}
+
+		if time.Since(queuedAt) >= MEMORY_ADMISSION_QUEUE_TIMEOUT {
+			controller.reject()
+			return nil, &PgError{
+				Code:    PG_ERROR_CODE_OUT_OF_MEMORY,
+				Message: "out of memory: " + pressure,
+				Hint:    "Retry the query later or reduce the amount of data it reads.",
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			controller.reject()
+			return nil, ctx.Err()
+		case <-time.After(MEMORY_ADMISSION_POLL_INTERVAL):
+		}
+	}
+}
+
+func (controller *MemoryAdmissionController) Metrics() MemoryAdmissionMetrics {
+	controller.mutex.Lock()
+	defer controller.mutex.Unlock()
+	return controller.metrics
+}
+
+func (controller *MemoryAdmissionController) release() {
+	controller.mutex.Lock()
+	defer controller.mutex.Unlock()
+	controller.runningCount--
+}
+
+func (controller *MemoryAdmissionController) reject() {
+	controller.mutex.Lock()
+	controller.metrics.RejectedCount++
+	metrics := controller.metrics
+	controller.mutex.Unlock()
+
+	common.LogWarn(controller.config.CommonConfig, "Memory admission: rejected a queued query,", metrics.String())
+}
+
+// Returns a description of the memory usage above the threshold, or an empty string if there is no pressure
+func (controller *MemoryAdmissionController) memoryPressure(ctx context.Context) (string, error) {
+	var usedBytes int64
+	var memoryLimit string
+	err := controller.duckdbClient.QueryRowContext(ctx, "SELECT COALESCE((SELECT SUM(memory_usage_bytes) FROM duckdb_memory()), 0)::BIGINT, current_setting('memory_limit')").Scan(&usedBytes, &memoryLimit)
+	if err != nil {
+		return "", err
+	}
+	limitBytes, err := parseDuckdbMemorySize(memoryLimit)
+	if err != nil {
+		return "", err
+	}
+	if controller.exceedsThreshold(usedBytes, limitBytes) {
+		return fmt.Sprintf("DuckDB memory usage: %d of %d bytes", usedBytes, limitBytes), nil
+	}
+
+	availableBytes, totalBytes, err := osMemory()
+	if err != nil {
+		return "", nil // Not available on this OS
+	}
+	if controller.exceedsThreshold(totalBytes-availableBytes, totalBytes) {
+		return fmt.Sprintf("OS memory usage: %d of %d bytes", totalBytes-availableBytes, totalBytes), nil
+	}
+
+	return "", nil
+}
+
+func (controller *MemoryAdmissionController) exceedsThreshold(usedBytes int64, limitBytes int64) bool {
+	return limitBytes > 0 && float64(usedBytes)*100 >= float64(limitBytes)*float64(controller.config.MemoryPressurePercent)
+}
+
+// admitted: 10, queued: 2, rejected: 1
+func (metrics MemoryAdmissionMetrics) String() string {
+	return fmt.Sprintf("admitted: %d, queued: %d, rejected: %d", metrics.AdmittedCount, metrics.QueuedCount, metrics.RejectedCount)
+}
+
+// "2.7 GiB" -> 2899102924
+func parseDuckdbMemorySize(size string) (int64, error) {
+	number, unit, ok := strings.Cut(strings.TrimSpace(size), " ")
+	if !ok {
+		return 0, fmt.Errorf("invalid DuckDB memory size: %s", size)
+	}
+	value, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid DuckDB memory size: %s", size)
+	}
+	unitBytes, ok := DUCKDB_MEMORY_UNIT_BYTES[unit]
+	if !ok {
+		return 0, fmt.Errorf("invalid DuckDB memory size unit: %s", size)
+	}
+	return int64(value * unitBytes), nil
+}
+
+// MemAvailable and MemTotal from /proc/meminfo in bytes
+func osMemory() (availableBytes int64, totalBytes int64, err error) {
+	file, err := os.Open(PROC_MEMINFO_PATH)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text()) // "MemTotal: 16384 kB"
+		if len(fields) < 2 {
+			continue
+		}
+		switch fields[0] {
+		case "MemTotal:":
+			totalBytes = common.StringToInt64(fields[1]) * 1024
+		case "MemAvailable:":
+			availableBytes = common.StringToInt64(fields[1]) * 1024
+		}
+	}
+	if totalBytes == 0 {
+		return 0, 0, fmt.Errorf("couldn't read memory from %s", PROC_MEMINFO_PATH)
+	}
+	return availableBytes, totalBytes, nil
+}
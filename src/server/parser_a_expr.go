@@ -2,6 +2,7 @@ package main
 
 import (
 	"strings"
+	"unicode"
 
 	pgQuery "github.com/pganalyze/pg_query_go/v6"
 )
@@ -76,6 +77,167 @@ func (parser *ParserAExpr) RemappedJsonExists(node *pgQuery.Node) *pgQuery.Node
 	)
 }
 
+// [tsvector] @@ [tsquery] -> ts_match_vq([tsvector], [tsquery])
+func (parser *ParserAExpr) RemappedTextSearchMatch(node *pgQuery.Node) *pgQuery.Node {
+	aExpr := parser.AExpr(node)
+	if aExpr == nil || parser.OperatorName(aExpr) != "@@" {
+		return node
+	}
+
+	return pgQuery.MakeFuncCallNode(
+		[]*pgQuery.Node{pgQuery.MakeStrNode("ts_match_vq")},
+		[]*pgQuery.Node{aExpr.Lexpr, aExpr.Rexpr},
+		0,
+	)
+}
+
+// [array] && [array] -> list_has_any([array], [array])
+// [array] @> [array] -> list_has_all([array], [array])
+// [array] <@ [array] -> list_has_all([array], [array]) with swapped arguments
+//
+// Array literals are compared as text: [array] @> '{1,2}' -> list_has_all([array]::varchar[], list_value('1', '2')),
+// other string constants are left as is, e.g. JSON containment with [jsonb] @> '{"key": "value"}' or [jsonb] @> '{}'
+func (parser *ParserAExpr) RemappedArrayOperator(node *pgQuery.Node) *pgQuery.Node {
+	aExpr := parser.AExpr(node)
+	if aExpr == nil {
+		return node
+	}
+
+	leftNode, rightNode := aExpr.Lexpr, aExpr.Rexpr
+	var functionName string
+	switch parser.OperatorName(aExpr) {
+	case "&&":
+		functionName = "list_has_any"
+	case "@>":
+		functionName = "list_has_all"
+	case "<@":
+		functionName = "list_has_all"
+		leftNode, rightNode = rightNode, leftNode
+	default:
+		return node
+	}
+
+	leftElements, leftArrayLiteral := parser.arrayLiteralElements(leftNode)
+	rightElements, rightArrayLiteral := parser.arrayLiteralElements(rightNode)
+	if (parser.isStringConstant(leftNode) && !leftArrayLiteral) || (parser.isStringConstant(rightNode) && !rightArrayLiteral) {
+		return node
+	}
+	// '{}' is an empty array only next to an array expression, e.g. ARRAY['a'] @> '{}'
+	if functionName == "list_has_all" &&
+		((leftArrayLiteral && len(leftElements) == 0 && !parser.isArrayExpression(rightNode)) || (rightArrayLiteral && len(rightElements) == 0 && !parser.isArrayExpression(leftNode))) {
+		return node
+	}
+	if leftArrayLiteral || rightArrayLiteral {
+		leftNode = parser.textListNode(leftNode, leftElements, leftArrayLiteral)
+		rightNode = parser.textListNode(rightNode, rightElements, rightArrayLiteral)
+	}
+
+	return pgQuery.MakeFuncCallNode(
+		[]*pgQuery.Node{pgQuery.MakeStrNode(functionName)},
+		[]*pgQuery.Node{leftNode, rightNode},
+		0,
+	)
+}
+
+// '{a,"b, c",NULL,"d \"e\""}' -> ['a', 'b, c', NULL, 'd "e"'], false if the node isn't a one-dimensional array literal
+func (parser *ParserAExpr) arrayLiteralElements(node *pgQuery.Node) ([]*pgQuery.Node, bool) {
+	if !parser.isStringConstant(node) {
+		return nil, false
+	}
+
+	value := strings.TrimSpace(node.GetAConst().GetSval().Sval)
+	if !strings.HasPrefix(value, "{") || !strings.HasSuffix(value, "}") {
+		return nil, false
+	}
+	arrayStr := value[1 : len(value)-1]
+
+	elements := []*pgQuery.Node{}
+	if strings.TrimSpace(arrayStr) == "" {
+		return elements, true
+	}
+	for i := 0; ; i++ { // After the comma
+		for i < len(arrayStr) && unicode.IsSpace(rune(arrayStr[i])) {
+			i++
+		}
+
+		var element strings.Builder
+		quoted := i < len(arrayStr) && arrayStr[i] == '"'
+		if quoted {
+			for i++; i < len(arrayStr) && arrayStr[i] != '"'; i++ {
+				if arrayStr[i] == '\\' && i+1 < len(arrayStr) {
+					i++
+				}
+				element.WriteByte(arrayStr[i])
+			}
+			if i == len(arrayStr) { // Unterminated quote
+				return nil, false
+			}
+			i++
+			for i < len(arrayStr) && unicode.IsSpace(rune(arrayStr[i])) {
+				i++
+			}
+		} else {
+			for ; i < len(arrayStr) && arrayStr[i] != ','; i++ {
+				if arrayStr[i] == '{' || arrayStr[i] == '}' || arrayStr[i] == '"' { // Nested array or JSON
+					return nil, false
+				}
+				if arrayStr[i] == '\\' && i+1 < len(arrayStr) {
+					i++
+				}
+				element.WriteByte(arrayStr[i])
+			}
+		}
+
+		if text := strings.TrimSpace(element.String()); !quoted && strings.EqualFold(text, "NULL") {
+			elements = append(elements, &pgQuery.Node{Node: &pgQuery.Node_AConst{AConst: &pgQuery.A_Const{Isnull: true}}})
+		} else if quoted {
+			elements = append(elements, pgQuery.MakeAConstStrNode(element.String(), 0))
+		} else {
+			elements = append(elements, pgQuery.MakeAConstStrNode(text, 0))
+		}
+
+		if i == len(arrayStr) {
+			return elements, true
+		}
+		if arrayStr[i] != ',' { // E.g. a JSON object '{"key": "value"}'
+			return nil, false
+		}
+	}
+}
+
+// ARRAY[...], ARRAY(SELECT ...), or [value]::type[]
+func (parser *ParserAExpr) isArrayExpression(node *pgQuery.Node) bool {
+	switch {
+	case node.GetAArrayExpr() != nil:
+		return true
+	case node.GetSubLink() != nil:
+		return node.GetSubLink().SubLinkType == pgQuery.SubLinkType_ARRAY_SUBLINK
+	case node.GetTypeCast() != nil:
+		return len(node.GetTypeCast().TypeName.ArrayBounds) > 0
+	}
+	return false
+}
+
+func (parser *ParserAExpr) isStringConstant(node *pgQuery.Node) bool {
+	return node != nil && node.GetAConst() != nil && node.GetAConst().GetSval() != nil
+}
+
+// [array] -> [array]::varchar[], or the list value of an array literal
+func (parser *ParserAExpr) textListNode(node *pgQuery.Node, arrayLiteralElements []*pgQuery.Node, isArrayLiteral bool) *pgQuery.Node {
+	if isArrayLiteral {
+		return pgQuery.MakeFuncCallNode([]*pgQuery.Node{pgQuery.MakeStrNode("list_value")}, arrayLiteralElements, 0)
+	}
+
+	return &pgQuery.Node{Node: &pgQuery.Node_TypeCast{TypeCast: &pgQuery.TypeCast{
+		Arg: node,
+		TypeName: &pgQuery.TypeName{
+			Names:       []*pgQuery.Node{pgQuery.MakeStrNode("varchar")},
+			ArrayBounds: []*pgQuery.Node{pgQuery.MakeIntNode(-1)},
+			Typemod:     -1,
+		},
+	}}}
+}
+
 func (parser *ParserAExpr) OperatorName(aExpr *pgQuery.A_Expr) string {
 	if aExpr.Kind != pgQuery.A_Expr_Kind_AEXPR_OP || len(aExpr.Name) != 1 {
 		return ""
@@ -106,34 +268,15 @@ func (parser *ParserAExpr) RightAConstValue(aExpr *pgQuery.A_Expr) string {
 func (parser *ParserAExpr) ConvertedRightAnyStringConstantToIn(node *pgQuery.Node) *pgQuery.Node {
 	aExpr := parser.AExpr(node)
 
-	if aExpr.Kind != pgQuery.A_Expr_Kind_AEXPR_OP_ANY {
+	if aExpr.Kind != pgQuery.A_Expr_Kind_AEXPR_OP_ANY || aExpr.Name[len(aExpr.Name)-1].GetString_().Sval != "=" {
 		return node
 	}
 
-	if aExpr.Rexpr.GetAConst() == nil {
+	items, ok := parser.arrayLiteralElements(aExpr.Rexpr)
+	if !ok || len(items) == 0 {
 		return node
 	}
 
-	arrayStr := aExpr.Rexpr.GetAConst().GetSval().Sval
-	arrayStr = strings.Trim(arrayStr, "{}")
-	values := strings.Split(arrayStr, ",")
-
-	items := make([]*pgQuery.Node, len(values))
-	for i, value := range values {
-		value = strings.Trim(value, " ")
-		items[i] = &pgQuery.Node{
-			Node: &pgQuery.Node_AConst{
-				AConst: &pgQuery.A_Const{
-					Val: &pgQuery.A_Const_Sval{
-						Sval: &pgQuery.String{
-							Sval: value,
-						},
-					},
-				},
-			},
-		}
-	}
-
 	return &pgQuery.Node{
 		Node: &pgQuery.Node_AExpr{
 			AExpr: &pgQuery.A_Expr{
@@ -153,6 +296,34 @@ func (parser *ParserAExpr) ConvertedRightAnyStringConstantToIn(node *pgQuery.Nod
 	}
 }
 
+// > ANY('{1,2}') -> (> '1' OR > '2')
+// <> ALL('{a,b}') -> (<> 'a' AND <> 'b')
+//
+// Unlike list elements, string constants are cast to the type of the left operand like in Postgres
+func (parser *ParserAExpr) ConvertedAnyAllArrayLiteral(node *pgQuery.Node) *pgQuery.Node {
+	aExpr := parser.AExpr(node)
+	if aExpr == nil || (aExpr.Kind != pgQuery.A_Expr_Kind_AEXPR_OP_ANY && aExpr.Kind != pgQuery.A_Expr_Kind_AEXPR_OP_ALL) {
+		return node
+	}
+
+	elements, ok := parser.arrayLiteralElements(aExpr.Rexpr)
+	if !ok || len(elements) == 0 {
+		return node
+	}
+
+	comparisons := make([]*pgQuery.Node, len(elements))
+	for i, element := range elements {
+		comparisons[i] = pgQuery.MakeAExprNode(pgQuery.A_Expr_Kind_AEXPR_OP, aExpr.Name, aExpr.Lexpr, element, aExpr.Location)
+	}
+	if len(comparisons) == 1 {
+		return comparisons[0]
+	}
+	if aExpr.Kind == pgQuery.A_Expr_Kind_AEXPR_OP_ANY {
+		return pgQuery.MakeBoolExprNode(pgQuery.BoolExprType_OR_EXPR, comparisons, aExpr.Location)
+	}
+	return pgQuery.MakeBoolExprNode(pgQuery.BoolExprType_AND_EXPR, comparisons, aExpr.Location)
+}
+
 // pg_catalog.[operator] -> [operator]
 func (parser *ParserAExpr) RemovePgCatalog(node *pgQuery.Node) {
 	aExpr := parser.AExpr(node)
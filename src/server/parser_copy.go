@@ -0,0 +1,279 @@
+package main
+
+import (
+	"strings"
+
+	pgQuery "github.com/pganalyze/pg_query_go/v6"
+
+	"github.com/BemiHQ/BemiDB/src/common"
+)
+
+const (
+	COPY_FORMAT_TEXT = "text"
+	COPY_FORMAT_CSV  = "csv"
+)
+
+// COPY ... TO STDOUT WITH (FORMAT csv, HEADER, DELIMITER ';', NULL 'null', QUOTE '"', ESCAPE '\')
+type CopyOptions struct {
+	Format    string
+	Header    bool
+	Delimiter string
+	Null      string
+	Quote     string // CSV only
+	Escape    string // CSV only
+}
+
+// CSV format that COPY ... FROM STDIN converts text rows to before loading them
+var COPY_FROM_CSV_OPTIONS = CopyOptions{Format: COPY_FORMAT_CSV, Delimiter: ",", Null: "", Quote: "\"", Escape: "\""}
+
+type ParserCopy struct {
+	config *Config
+}
+
+func NewParserCopy(config *Config) *ParserCopy {
+	return &ParserCopy{config: config}
+}
+
+// Defaults match Postgres: tab-separated text with \N for NULL, or comma-separated CSV with an empty string for NULL
+func (parser *ParserCopy) Options(copyStatement *pgQuery.CopyStmt) (CopyOptions, error) {
+	options := CopyOptions{Format: COPY_FORMAT_TEXT}
+	var delimiter, null, quote, escape *string
+
+	for _, optionNode := range copyStatement.Options {
+		option := optionNode.GetDefElem()
+		switch strings.ToLower(option.Defname) {
+		case "format":
+			options.Format = strings.ToLower(defElemStringArg(option))
+			if options.Format != COPY_FORMAT_TEXT && options.Format != COPY_FORMAT_CSV {
+				return options, &PgError{Code: PG_ERROR_CODE_FEATURE_NOT_SUPPORTED, Message: "COPY format \"" + options.Format + "\" is not supported", Hint: "Use FORMAT text or FORMAT csv."}
+			}
+		case "header":
+			if strings.ToLower(defElemStringArg(option)) == "match" {
+				return options, &PgError{Code: PG_ERROR_CODE_FEATURE_NOT_SUPPORTED, Message: "COPY HEADER MATCH is only available with COPY FROM"}
+			}
+			options.Header = defElemBooleanArg(option)
+		case "delimiter":
+			value := defElemStringArg(option)
+			delimiter = &value
+		case "null":
+			value := defElemStringArg(option)
+			null = &value
+		case "quote":
+			value := defElemStringArg(option)
+			quote = &value
+		case "escape":
+			value := defElemStringArg(option)
+			escape = &value
+		default:
+			return options, &PgError{Code: PG_ERROR_CODE_FEATURE_NOT_SUPPORTED, Message: "COPY option \"" + option.Defname + "\" is not supported"}
+		}
+	}
+
+	if options.Format == COPY_FORMAT_CSV {
+		options.Delimiter, options.Null, options.Quote = ",", "", "\""
+	} else {
+		options.Delimiter, options.Null = "\t", "\\N"
+		if quote != nil || escape != nil {
+			return options, &PgError{Code: PG_ERROR_CODE_FEATURE_NOT_SUPPORTED, Message: "COPY QUOTE and ESCAPE are available only in CSV mode"}
+		}
+	}
+	if delimiter != nil {
+		options.Delimiter = *delimiter
+	}
+	if null != nil {
+		options.Null = *null
+	}
+	if quote != nil {
+		options.Quote = *quote
+	}
+	options.Escape = options.Quote
+	if escape != nil {
+		options.Escape = *escape
+	}
+
+	if len(options.Delimiter) != 1 || (options.Format == COPY_FORMAT_CSV && (len(options.Quote) != 1 || len(options.Escape) != 1)) {
+		return options, &PgError{Code: PG_ERROR_CODE_FEATURE_NOT_SUPPORTED, Message: "COPY delimiter, quote, and escape must be single one-byte characters"}
+	}
+
+	return options, nil
+}
+
+// COPY schema.table (col1, col2) TO STDOUT -> SELECT col1, col2 FROM schema.table
+func (parser *ParserCopy) MakeSelectStatement(copyStatement *pgQuery.CopyStmt) *pgQuery.SelectStmt {
+	targetList := []*pgQuery.Node{}
+	for _, columnNode := range copyStatement.Attlist {
+		targetList = append(targetList, pgQuery.MakeResTargetNodeWithVal(
+			pgQuery.MakeColumnRefNode([]*pgQuery.Node{pgQuery.MakeStrNode(columnNode.GetString_().Sval)}, 0),
+			0,
+		))
+	}
+	if len(targetList) == 0 {
+		targetList = append(targetList, pgQuery.MakeResTargetNodeWithVal(
+			pgQuery.MakeColumnRefNode([]*pgQuery.Node{pgQuery.MakeAStarNode()}, 0),
+			0,
+		))
+	}
+
+	return &pgQuery.SelectStmt{
+		TargetList: targetList,
+		FromClause: []*pgQuery.Node{{Node: &pgQuery.Node_RangeVar{RangeVar: copyStatement.Relation}}},
+	}
+}
+
+// COPY schema.table FROM STDIN -> schema.table, public.table if the schema is omitted
+func (parser *ParserCopy) IcebergSchemaTable(copyStatement *pgQuery.CopyStmt) common.IcebergSchemaTable {
+	icebergSchemaTable := common.IcebergSchemaTable{Schema: copyStatement.Relation.Schemaname, Table: copyStatement.Relation.Relname}
+	if icebergSchemaTable.Schema == "" {
+		icebergSchemaTable.Schema = PG_SCHEMA_PUBLIC
+	}
+	return icebergSchemaTable
+}
+
+// [][]byte{"a", nil} -> "a\t\\N\n" (text) or "a,\n" (CSV), NULL values are nil
+func (options CopyOptions) FormatRow(values [][]byte) []byte {
+	var row []byte
+	for i, value := range values {
+		if i > 0 {
+			row = append(row, options.Delimiter...)
+		}
+		switch {
+		case value == nil:
+			row = append(row, options.Null...)
+		case options.Format == COPY_FORMAT_CSV:
+			row = append(row, options.csvValue(string(value))...)
+		default:
+			row = append(row, options.textValue(string(value))...)
+		}
+	}
+	return append(row, '\n')
+}
+
+// "a\t\\N" -> [][]byte{"a", nil} (text), reverses FormatRow for a line without the trailing newline, NULL values are nil
+func (options CopyOptions) ParseTextRow(line []byte) [][]byte {
+	var values [][]byte
+	start := 0
+	for i := 0; i <= len(line); i++ {
+		if i < len(line)-1 && line[i] == '\\' {
+			i++ // Skip the escaped character, it can be the delimiter
+			continue
+		}
+		if i < len(line) && line[i] != options.Delimiter[0] {
+			continue
+		}
+
+		rawValue := line[start:i]
+		if string(rawValue) == options.Null {
+			values = append(values, nil)
+		} else {
+			values = append(values, options.unescapeTextValue(rawValue))
+		}
+		start = i + 1
+	}
+	return values
+}
+
+// Backslash escapes for special characters so that they don't clash with delimiters and \N
+func (options CopyOptions) textValue(value string) string {
+	var builder strings.Builder
+	for i := 0; i < len(value); i++ {
+		switch char := value[i]; char {
+		case '\\':
+			builder.WriteString("\\\\")
+		case '\n':
+			builder.WriteString("\\n")
+		case '\r':
+			builder.WriteString("\\r")
+		case '\t':
+			builder.WriteString("\\t")
+		case '\b':
+			builder.WriteString("\\b")
+		case '\f':
+			builder.WriteString("\\f")
+		case '\v':
+			builder.WriteString("\\v")
+		default:
+			if char == options.Delimiter[0] {
+				builder.WriteByte('\\')
+			}
+			builder.WriteByte(char)
+		}
+	}
+	return builder.String()
+}
+
+// \n, \t, \\, octal \123 and hex \x53 escapes -> characters
+func (options CopyOptions) unescapeTextValue(rawValue []byte) []byte {
+	value := []byte{}
+	for i := 0; i < len(rawValue); i++ {
+		if rawValue[i] != '\\' || i == len(rawValue)-1 {
+			value = append(value, rawValue[i])
+			continue
+		}
+
+		i++
+		switch char := rawValue[i]; {
+		case char == 'b':
+			value = append(value, '\b')
+		case char == 'f':
+			value = append(value, '\f')
+		case char == 'n':
+			value = append(value, '\n')
+		case char == 'r':
+			value = append(value, '\r')
+		case char == 't':
+			value = append(value, '\t')
+		case char == 'v':
+			value = append(value, '\v')
+		case char >= '0' && char <= '7':
+			code := 0
+			for j := 0; j < 3 && i < len(rawValue) && rawValue[i] >= '0' && rawValue[i] <= '7'; j++ {
+				code = code*8 + int(rawValue[i]-'0')
+				i++
+			}
+			value = append(value, byte(code))
+			i--
+		case char == 'x' && i+1 < len(rawValue) && isHexDigit(rawValue[i+1]):
+			code := 0
+			for j := 0; j < 2 && i+1 < len(rawValue) && isHexDigit(rawValue[i+1]); j++ {
+				i++
+				code = code*16 + hexDigitValue(rawValue[i])
+			}
+			value = append(value, byte(code))
+		default:
+			value = append(value, char)
+		}
+	}
+	return value
+}
+
+// Quotes values with special characters and values equal to the NULL string to tell them apart from NULL
+func (options CopyOptions) csvValue(value string) string {
+	if value != options.Null && value != "\\." && !strings.ContainsAny(value, options.Delimiter+options.Quote+"\r\n") {
+		return value
+	}
+
+	var builder strings.Builder
+	builder.WriteString(options.Quote)
+	for i := 0; i < len(value); i++ {
+		if value[i] == options.Quote[0] || value[i] == options.Escape[0] {
+			builder.WriteString(options.Escape)
+		}
+		builder.WriteByte(value[i])
+	}
+	builder.WriteString(options.Quote)
+	return builder.String()
+}
+
+func isHexDigit(char byte) bool {
+	return (char >= '0' && char <= '9') || (char >= 'a' && char <= 'f') || (char >= 'A' && char <= 'F')
+}
+
+func hexDigitValue(char byte) int {
+	switch {
+	case char >= 'a':
+		return int(char-'a') + 10
+	case char >= 'A':
+		return int(char-'A') + 10
+	}
+	return int(char - '0')
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"strings"
+
+	pgQuery "github.com/pganalyze/pg_query_go/v6"
+
+	"github.com/BemiHQ/BemiDB/src/common"
+)
+
+const (
+	EXPLAIN_FORMAT_TEXT = "text"
+	EXPLAIN_FORMAT_JSON = "json"
+
+	EXPLAIN_QUERY_PLAN_COLUMN = "QUERY PLAN"
+)
+
+// Postgres options without a DuckDB equivalent, they only add details to the plan
+var EXPLAIN_IGNORED_OPTIONS = common.NewSet[string]().AddAll([]string{
+	"verbose", "costs", "settings", "generic_plan", "buffers", "serialize", "wal", "timing", "summary", "memory",
+})
+
+// EXPLAIN [ANALYZE] [VERBOSE] SELECT ... / EXPLAIN (ANALYZE, FORMAT json) SELECT ...
+type ExplainOptions struct {
+	Analyze bool
+	Format  string
+}
+
+type ParserExplain struct {
+	config *Config
+}
+
+func NewParserExplain(config *Config) *ParserExplain {
+	return &ParserExplain{config: config}
+}
+
+func (parser *ParserExplain) Options(explainStatement *pgQuery.ExplainStmt) (ExplainOptions, error) {
+	options := ExplainOptions{Format: EXPLAIN_FORMAT_TEXT}
+
+	for _, optionNode := range explainStatement.Options {
+		option := optionNode.GetDefElem()
+		switch strings.ToLower(option.Defname) {
+		case "analyze":
+			options.Analyze = defElemBooleanArg(option)
+		case "format":
+			options.Format = strings.ToLower(defElemStringArg(option))
+			if options.Format != EXPLAIN_FORMAT_TEXT && options.Format != EXPLAIN_FORMAT_JSON {
+				return options, &PgError{Code: PG_ERROR_CODE_FEATURE_NOT_SUPPORTED, Message: "EXPLAIN format \"" + options.Format + "\" is not supported", Hint: "Use FORMAT text or FORMAT json."}
+			}
+		default:
+			if !EXPLAIN_IGNORED_OPTIONS.Contains(strings.ToLower(option.Defname)) {
+				return options, &PgError{Code: PG_ERROR_CODE_SYNTAX_ERROR, Message: "unrecognized EXPLAIN option \"" + option.Defname + "\""}
+			}
+		}
+	}
+
+	return options, nil
+}
+
+// EXPLAIN (ANALYZE, VERBOSE, FORMAT json) -> EXPLAIN (ANALYZE, FORMAT "json") since DuckDB doesn't support the other options
+func (parser *ParserExplain) MakeDuckdbOptions(options ExplainOptions) []*pgQuery.Node {
+	var optionNodes []*pgQuery.Node
+	if options.Analyze {
+		optionNodes = append(optionNodes, pgQuery.MakeSimpleDefElemNode("analyze", nil, 0))
+	}
+	if options.Format != EXPLAIN_FORMAT_TEXT {
+		optionNodes = append(optionNodes, pgQuery.MakeSimpleDefElemNode("format", pgQuery.MakeStrNode(options.Format), 0))
+	}
+	return optionNodes
+}
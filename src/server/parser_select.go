@@ -2,8 +2,11 @@ package main
 
 import (
 	pgQuery "github.com/pganalyze/pg_query_go/v6"
+	"google.golang.org/protobuf/proto"
 )
 
+const FETCH_WITH_TIES_RANK_COLUMN = "bemidb_rank"
+
 type ParserSelect struct {
 	config *Config
 	utils  *ParserUtils
@@ -29,3 +32,243 @@ func (parser *ParserSelect) SetTargetName(targetNode *pgQuery.Node, name string)
 func (parser *ParserSelect) TargetName(targetNode *pgQuery.Node) string {
 	return targetNode.GetResTarget().Name
 }
+
+// ORDER BY ... [ASC|DESC] -> ORDER BY ... [ASC|DESC] NULLS [LAST|FIRST]
+func (parser *ParserSelect) SetDefaultNullsOrder(sortBy *pgQuery.SortBy) {
+	if sortBy.SortbyNulls != pgQuery.SortByNulls_SORTBY_NULLS_DEFAULT || sortBy.SortbyDir == pgQuery.SortByDir_SORTBY_USING {
+		return
+	}
+
+	if sortBy.SortbyDir == pgQuery.SortByDir_SORTBY_DESC {
+		sortBy.SortbyNulls = pgQuery.SortByNulls_SORTBY_NULLS_FIRST
+	} else {
+		sortBy.SortbyNulls = pgQuery.SortByNulls_SORTBY_NULLS_LAST
+	}
+}
+
+func (parser *ParserSelect) IsFetchWithTies(selectStatement *pgQuery.SelectStmt) bool {
+	return selectStatement.LimitOption == pgQuery.LimitOption_LIMIT_OPTION_WITH_TIES && selectStatement.LimitCount != nil
+}
+
+// SELECT ... ORDER BY ... [OFFSET o] FETCH FIRST n ROWS WITH TIES ->
+// SELECT columns(c -> (c <> 'bemidb_rank')) FROM (
+//
+//	SELECT ..., rank() OVER (ORDER BY ...) AS bemidb_rank
+//
+// ) bemidb_ties WHERE bemidb_rank <= o + n ORDER BY bemidb_rank OFFSET o
+//
+// The rows ranked up to o + n are the first o + n rows and the rows tied with the last of them.
+// Rows of SELECT DISTINCT [ON] and UNION are deduplicated first and then ranked by their output columns (see rankedStatement)
+func (parser *ParserSelect) SetFetchWithTies(selectStatement *pgQuery.SelectStmt) error {
+	rankedStatement, err := parser.rankedStatement(selectStatement)
+	if err != nil {
+		return err
+	}
+
+	rankNode := pgQuery.MakeColumnRefNode([]*pgQuery.Node{pgQuery.MakeStrNode(FETCH_WITH_TIES_RANK_COLUMN)}, 0)
+	columnNode := pgQuery.MakeColumnRefNode([]*pgQuery.Node{pgQuery.MakeStrNode("c")}, 0)
+	maxRankNode := selectStatement.LimitCount
+	if selectStatement.LimitOffset != nil {
+		maxRankNode = parser.makeArithmeticNode("+", selectStatement.LimitOffset, selectStatement.LimitCount)
+	}
+
+	tiesStatement := &pgQuery.SelectStmt{
+		TargetList: []*pgQuery.Node{pgQuery.MakeResTargetNodeWithVal(
+			pgQuery.MakeFuncCallNode([]*pgQuery.Node{pgQuery.MakeStrNode("columns")}, []*pgQuery.Node{
+				parser.makeArithmeticNode("->", columnNode, parser.makeArithmeticNode("<>", columnNode, pgQuery.MakeAConstStrNode(FETCH_WITH_TIES_RANK_COLUMN, 0))),
+			}, 0),
+			0,
+		)},
+		FromClause:  []*pgQuery.Node{parser.makeRangeSubselectNode(rankedStatement, "bemidb_ties")},
+		WhereClause: pgQuery.MakeAExprNode(pgQuery.A_Expr_Kind_AEXPR_OP, []*pgQuery.Node{pgQuery.MakeStrNode("<=")}, rankNode, maxRankNode, 0),
+		SortClause:  []*pgQuery.Node{pgQuery.MakeSortByNode(rankNode, pgQuery.SortByDir_SORTBY_DEFAULT, pgQuery.SortByNulls_SORTBY_NULLS_DEFAULT, 0)},
+		LimitOffset: selectStatement.LimitOffset,
+		LimitOption: pgQuery.LimitOption_LIMIT_OPTION_DEFAULT,
+		IntoClause:  selectStatement.IntoClause,
+	}
+
+	proto.Reset(selectStatement)
+	proto.Merge(selectStatement, tiesStatement)
+	return nil
+}
+
+// SELECT ... ORDER BY ... -> SELECT ..., rank() OVER (ORDER BY ...) AS bemidb_rank, with output names and positions in ORDER BY resolved to their expressions.
+//
+// SELECT DISTINCT [ON] ... ORDER BY ... and UNION ... ORDER BY ... ->
+// SELECT *, rank() OVER (ORDER BY output columns) AS bemidb_rank FROM (SELECT DISTINCT [ON] ... ORDER BY ...) bemidb_distinct,
+// since the window would be evaluated before the rows are deduplicated
+func (parser *ParserSelect) rankedStatement(selectStatement *pgQuery.SelectStmt) (*pgQuery.SelectStmt, error) {
+	statement := proto.Clone(selectStatement).(*pgQuery.SelectStmt)
+	statement.LimitCount = nil
+	statement.LimitOffset = nil
+	statement.LimitOption = pgQuery.LimitOption_LIMIT_OPTION_DEFAULT
+	statement.IntoClause = nil
+
+	outputStatement := statement
+	for outputStatement.Larg != nil {
+		outputStatement = outputStatement.Larg
+	}
+	deduplicated := statement.DistinctClause != nil || statement.Op != pgQuery.SetOperation_SET_OPERATION_UNDEFINED && statement.Op != pgQuery.SetOperation_SETOP_NONE
+
+	var orderClause []*pgQuery.Node
+	for _, sortNode := range selectStatement.SortClause {
+		sortBy := proto.Clone(sortNode.GetSortBy()).(*pgQuery.SortBy)
+		targetNode := parser.sortTargetNode(outputStatement.TargetList, sortBy.Node)
+		if targetNode == nil && parser.sortPosition(sortBy.Node) != 0 {
+			return nil, &PgError{
+				Code:    PG_ERROR_CODE_FEATURE_NOT_SUPPORTED,
+				Message: "FETCH FIRST ... WITH TIES must be ordered by expressions instead of positions of * columns",
+			}
+		}
+		if deduplicated {
+			columnName := parser.outputColumnName(targetNode, sortBy.Node)
+			if columnName == "" {
+				return nil, &PgError{
+					Code:    PG_ERROR_CODE_FEATURE_NOT_SUPPORTED,
+					Message: "FETCH FIRST ... WITH TIES with SELECT DISTINCT or UNION must be ordered by named output columns",
+				}
+			}
+			sortBy.Node = pgQuery.MakeColumnRefNode([]*pgQuery.Node{pgQuery.MakeStrNode(columnName)}, 0)
+		} else if targetNode != nil {
+			sortBy.Node = proto.Clone(targetNode.GetResTarget().Val).(*pgQuery.Node)
+		}
+		orderClause = append(orderClause, &pgQuery.Node{Node: &pgQuery.Node_SortBy{SortBy: sortBy}})
+	}
+
+	rankTargetNode := pgQuery.MakeResTargetNodeWithNameAndVal(
+		FETCH_WITH_TIES_RANK_COLUMN,
+		&pgQuery.Node{Node: &pgQuery.Node_FuncCall{FuncCall: &pgQuery.FuncCall{
+			Funcname:   []*pgQuery.Node{pgQuery.MakeStrNode("rank")},
+			Over:       &pgQuery.WindowDef{OrderClause: orderClause, FrameOptions: PG_FRAME_OPTION_DEFAULTS},
+			Funcformat: pgQuery.CoercionForm_COERCE_EXPLICIT_CALL,
+		}}},
+		0,
+	)
+
+	if !deduplicated {
+		statement.SortClause = nil
+		statement.TargetList = append(statement.TargetList, rankTargetNode)
+		return statement, nil
+	}
+
+	return &pgQuery.SelectStmt{
+		TargetList: []*pgQuery.Node{
+			pgQuery.MakeResTargetNodeWithVal(pgQuery.MakeColumnRefNode([]*pgQuery.Node{{Node: &pgQuery.Node_AStar{AStar: &pgQuery.A_Star{}}}}, 0), 0),
+			rankTargetNode,
+		},
+		FromClause:  []*pgQuery.Node{parser.makeRangeSubselectNode(statement, "bemidb_distinct")},
+		LimitOption: pgQuery.LimitOption_LIMIT_OPTION_DEFAULT,
+	}, nil
+}
+
+// ORDER BY 2 or ORDER BY output_name -> the target, nil if ordered by another expression
+func (parser *ParserSelect) sortTargetNode(targetList []*pgQuery.Node, sortKeyNode *pgQuery.Node) *pgQuery.Node {
+	if position := parser.sortPosition(sortKeyNode); position >= 1 && position <= len(targetList) && !parser.isStarTarget(targetList[position-1]) {
+		return targetList[position-1]
+	}
+
+	if columnRef := sortKeyNode.GetColumnRef(); columnRef != nil && len(columnRef.Fields) == 1 && columnRef.Fields[0].GetString_() != nil {
+		for _, targetNode := range targetList {
+			if targetNode.GetResTarget().Name != "" && targetNode.GetResTarget().Name == columnRef.Fields[0].GetString_().Sval {
+				return targetNode
+			}
+		}
+	}
+	return nil
+}
+
+// The name of the output column of the target or of the ORDER BY expression, which must be a selected column after SELECT DISTINCT
+func (parser *ParserSelect) outputColumnName(targetNode *pgQuery.Node, sortKeyNode *pgQuery.Node) string {
+	if targetNode != nil {
+		return parser.targetOutputName(targetNode)
+	}
+	if columnRef := sortKeyNode.GetColumnRef(); columnRef != nil {
+		if lastField := columnRef.Fields[len(columnRef.Fields)-1].GetString_(); lastField != nil {
+			return lastField.Sval
+		}
+	}
+	return ""
+}
+
+// SELECT expression AS name -> name, SELECT table.column -> column, "" otherwise
+func (parser *ParserSelect) targetOutputName(targetNode *pgQuery.Node) string {
+	target := targetNode.GetResTarget()
+	if target.Name != "" {
+		return target.Name
+	}
+	if columnRef := target.Val.GetColumnRef(); columnRef != nil {
+		if lastField := columnRef.Fields[len(columnRef.Fields)-1].GetString_(); lastField != nil {
+			return lastField.Sval
+		}
+	}
+	return ""
+}
+
+// ORDER BY 2 -> 2, 0 if ordered by an expression
+func (parser *ParserSelect) sortPosition(sortKeyNode *pgQuery.Node) int {
+	if aConst := sortKeyNode.GetAConst(); aConst != nil && aConst.GetIval() != nil {
+		return int(aConst.GetIval().Ival)
+	}
+	return 0
+}
+
+func (parser *ParserSelect) isStarTarget(targetNode *pgQuery.Node) bool {
+	columnRef := targetNode.GetResTarget().Val.GetColumnRef()
+	return columnRef != nil && columnRef.Fields[len(columnRef.Fields)-1].GetAStar() != nil
+}
+
+// SELECT 1 FROM table LIMIT n -> n, false if the query reads the columns of the rows or filters, groups, or orders them
+func (parser *ParserSelect) MetadataProbeLimit(selectStatement *pgQuery.SelectStmt) (int64, bool) {
+	if len(selectStatement.FromClause) != 1 || !parser.isUnfilteredSelect(selectStatement) || selectStatement.SortClause != nil || selectStatement.LimitOffset != nil ||
+		selectStatement.LimitOption != pgQuery.LimitOption_LIMIT_OPTION_COUNT {
+		return 0, false
+	}
+
+	limit := selectStatement.LimitCount.GetAConst()
+	if limit == nil || limit.GetIval() == nil || limit.GetIval().Ival < 0 {
+		return 0, false
+	}
+	for _, targetNode := range selectStatement.TargetList {
+		if targetNode.GetResTarget().Val.GetAConst() == nil {
+			return 0, false
+		}
+	}
+	return int64(limit.GetIval().Ival), true
+}
+
+// EXISTS (SELECT * FROM table) or EXISTS (SELECT column FROM table)
+func (parser *ParserSelect) IsExistsProbe(selectStatement *pgQuery.SelectStmt) bool {
+	if selectStatement == nil || !parser.isUnfilteredSelect(selectStatement) || selectStatement.LimitCount != nil || selectStatement.LimitOffset != nil {
+		return false
+	}
+	for _, targetNode := range selectStatement.TargetList {
+		val := targetNode.GetResTarget().Val
+		if val.GetAConst() == nil && val.GetColumnRef() == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// EXISTS (SELECT * FROM table) -> EXISTS (SELECT 1 FROM table LIMIT 1)
+func (parser *ParserSelect) SetExistsProbeLimit(selectStatement *pgQuery.SelectStmt) {
+	selectStatement.TargetList = []*pgQuery.Node{pgQuery.MakeResTargetNodeWithVal(pgQuery.MakeAConstIntNode(1, 0), 0)}
+	selectStatement.LimitCount = pgQuery.MakeAConstIntNode(1, 0)
+	selectStatement.LimitOption = pgQuery.LimitOption_LIMIT_OPTION_COUNT
+}
+
+func (parser *ParserSelect) isUnfilteredSelect(selectStatement *pgQuery.SelectStmt) bool {
+	return selectStatement.Larg == nil && selectStatement.WithClause == nil && selectStatement.WhereClause == nil && selectStatement.GroupClause == nil &&
+		selectStatement.HavingClause == nil && selectStatement.DistinctClause == nil && selectStatement.WindowClause == nil
+}
+
+func (parser *ParserSelect) makeArithmeticNode(operator string, leftNode *pgQuery.Node, rightNode *pgQuery.Node) *pgQuery.Node {
+	return pgQuery.MakeAExprNode(pgQuery.A_Expr_Kind_AEXPR_OP, []*pgQuery.Node{pgQuery.MakeStrNode(operator)}, leftNode, rightNode, 0)
+}
+
+func (parser *ParserSelect) makeRangeSubselectNode(selectStatement *pgQuery.SelectStmt, alias string) *pgQuery.Node {
+	return &pgQuery.Node{Node: &pgQuery.Node_RangeSubselect{RangeSubselect: &pgQuery.RangeSubselect{
+		Subquery: &pgQuery.Node{Node: &pgQuery.Node_SelectStmt{SelectStmt: selectStatement}},
+		Alias:    &pgQuery.Alias{Aliasname: alias},
+	}}}
+}
@@ -1,15 +1,29 @@
 package main
 
 import (
+	"encoding/json"
+	"slices"
 	"strings"
 
 	"github.com/BemiHQ/BemiDB/src/common"
 	pgQuery "github.com/pganalyze/pg_query_go/v6"
 )
 
+const PERMISSIONS_WILDCARD = "*" // "schema.*" permits all tables in the schema, ["*"] permits all columns
+
 type QueryToIcebergTable struct {
 	QuerySchemaTable QuerySchemaTable
 	IcebergTablePath string
+	PinnedTableName  string                    // DuckDB table with the loaded rows of a pinned table or the sample of a table, empty if not pinned
+	RowFilter        string                    // Filter expression configured for the user, empty if unrestricted
+	Partitions       []QueryToIcebergPartition // Iceberg tables read instead of IcebergTablePath for a partitioned table, empty if not partitioned
+	ColumnNames      []string                  // Columns of all partitions of a partitioned table
+}
+
+// Partition of a partitioned source table synced as a separate Iceberg table
+type QueryToIcebergPartition struct {
+	IcebergTablePath string
+	ColumnNames      common.Set[string]
 }
 
 type ParserTable struct {
@@ -36,6 +50,140 @@ func (parser *ParserTable) NodeToQuerySchemaTable(node *pgQuery.Node) QuerySchem
 	}
 }
 
+// SELECT ... FROM schema.table JOIN table2 -> [schema.table, table2]
+func (parser *ParserTable) ReferencedQuerySchemaTables(query string) ([]QuerySchemaTable, error) {
+	var qSchemaTables []QuerySchemaTable
+	err := parser.walkQueryTree(query, "RangeVar", func(rangeVar map[string]interface{}) {
+		schema, _ := rangeVar["schemaname"].(string)
+		table, _ := rangeVar["relname"].(string)
+		qSchemaTables = append(qSchemaTables, QuerySchemaTable{Schema: schema, Table: table})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return qSchemaTables, nil
+}
+
+// WITH recent AS (...), totals AS (...) SELECT ... -> {recent, totals}
+func (parser *ParserTable) CommonTableExpressionNames(query string) (common.Set[string], error) {
+	cteNames := common.NewSet[string]()
+	err := parser.walkQueryTree(query, "CommonTableExpr", func(cte map[string]interface{}) {
+		cteName, _ := cte["ctename"].(string)
+		cteNames.Add(cteName)
+	})
+	return cteNames, err
+}
+
+// SELECT ... FROM generate_series(1, 3), unnest(...) -> [generate_series, unnest]
+func (parser *ParserTable) ReferencedTableFunctionNames(query string) ([]string, error) {
+	var functionNames []string
+	err := parser.walkTableFunctionCalls(query, func(functionName string, funcCall map[string]interface{}) {
+		functionNames = append(functionNames, functionName)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return functionNames, nil
+}
+
+// SELECT ... FROM read_parquet('s3://bucket/file.parquet'), generate_series(1, 3) -> [read_parquet('s3://bucket/file.parquet'), generate_series()]
+func (parser *ParserTable) ReferencedTableFunctionCalls(query string) ([]string, error) {
+	var functionCalls []string
+	err := parser.walkTableFunctionCalls(query, func(functionName string, funcCall map[string]interface{}) {
+		var stringArguments []string
+		parser.walkNode(funcCall["args"], "A_Const", func(constant map[string]interface{}) {
+			if stringNode, ok := constant["sval"].(map[string]interface{}); ok {
+				value, _ := stringNode["sval"].(string)
+				stringArguments = append(stringArguments, "'"+strings.ReplaceAll(value, "'", "''")+"'")
+			}
+		})
+		functionCalls = append(functionCalls, functionName+"("+strings.Join(stringArguments, ", ")+")")
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return functionCalls, nil
+}
+
+// Calls the callback with the name and the FuncCall node of each table function in FROM
+func (parser *ParserTable) walkTableFunctionCalls(query string, callback func(functionName string, funcCall map[string]interface{})) error {
+	return parser.walkQueryTree(query, "RangeFunction", func(rangeFunction map[string]interface{}) {
+		functionNodes, _ := rangeFunction["functions"].([]interface{})
+		for _, functionNode := range functionNodes {
+			list, _ := functionNode.(map[string]interface{})["List"].(map[string]interface{})
+			items, _ := list["items"].([]interface{})
+			if len(items) == 0 {
+				continue
+			}
+			funcCall, ok := items[0].(map[string]interface{})["FuncCall"].(map[string]interface{})
+			if !ok {
+				continue
+			}
+			nameNodes, _ := funcCall["funcname"].([]interface{})
+			if len(nameNodes) == 0 {
+				continue
+			}
+			nameNode, _ := nameNodes[len(nameNodes)-1].(map[string]interface{})
+			stringNode, _ := nameNode["String"].(map[string]interface{})
+			functionName, _ := stringNode["sval"].(string)
+			callback(functionName, funcCall)
+		}
+	})
+}
+
+// SELECT ... WHERE id = $1 AND name = $2 -> 2
+func (parser *ParserTable) ParameterCount(query string) (int, error) {
+	parameterCount := 0
+	err := parser.walkQueryTree(query, "ParamRef", func(paramRef map[string]interface{}) {
+		number, _ := paramRef["number"].(float64)
+		parameterCount = max(parameterCount, int(number))
+	})
+	return parameterCount, err
+}
+
+// Calls the callback with each node of the type in the parsed query tree
+func (parser *ParserTable) walkQueryTree(query string, nodeType string, callback func(node map[string]interface{})) error {
+	queryTree, err := pgQuery.ParseToJSON(query)
+	if err != nil {
+		return err
+	}
+
+	var tree interface{}
+	err = json.Unmarshal([]byte(queryTree), &tree)
+	if err != nil {
+		return err
+	}
+
+	parser.walkNode(tree, nodeType, callback)
+	return nil
+}
+
+// Calls the callback with each node of the type in the JSON tree of a parsed node
+func (parser *ParserTable) walkNode(tree interface{}, nodeType string, callback func(node map[string]interface{})) {
+	var walk func(node interface{})
+	walk = func(node interface{}) {
+		switch typedNode := node.(type) {
+		case map[string]interface{}:
+			for key, value := range typedNode {
+				if key == nodeType {
+					if typedValue, ok := value.(map[string]interface{}); ok {
+						callback(typedValue)
+					}
+				}
+				walk(value)
+			}
+		case []interface{}:
+			for _, value := range typedNode {
+				walk(value)
+			}
+		}
+	}
+	walk(tree)
+}
+
 func (parser *ParserTable) RemapSchemaToMain(node *pgQuery.Node) {
 	node.GetRangeVar().Schemaname = DUCKDB_SCHEMA_MAIN
 }
@@ -49,36 +197,141 @@ func (parser *ParserTable) IsTableFromInformationSchema(qSchemaTable QuerySchema
 // schema.table -> (SELECT * FROM iceberg_scan('path')) schema_table
 // public.table -> (SELECT permitted, columns FROM iceberg_scan('path')) table
 // public.table -> (SELECT NULL WHERE FALSE) table
+// public.table -> (SELECT * FROM iceberg_scan('path') WHERE (tenant_id = '1')) table
 // public.table t -> (SELECT * FROM iceberg_scan('path')) t
+// public.partitioned_table -> (SELECT * FROM (SELECT a, b FROM iceberg_scan('path1') UNION ALL SELECT a, NULL AS b FROM iceberg_scan('path2')) partitions) partitioned_table
 func (parser *ParserTable) MakeIcebergTableNode(queryToIcebergTable QueryToIcebergTable, permissions *map[string][]string) *pgQuery.Node {
+	source := "iceberg_scan('" + queryToIcebergTable.IcebergTablePath + "')"
+	if queryToIcebergTable.PinnedTableName != "" {
+		source = queryToIcebergTable.PinnedTableName
+	} else if len(queryToIcebergTable.Partitions) > 0 {
+		source = parser.partitionsSource(queryToIcebergTable)
+	}
+
 	var query string
 	if permissions == nil {
-		query = "SELECT * FROM iceberg_scan('" + queryToIcebergTable.IcebergTablePath + "')"
-	} else if columnNames, allowed := (*permissions)[queryToIcebergTable.QuerySchemaTable.ToIcebergSchemaTable().ToArg()]; allowed {
+		query = "SELECT * FROM " + source
+	} else if columnNames, allowed := parser.permittedColumnNames(permissions, queryToIcebergTable.QuerySchemaTable.ToIcebergSchemaTable()); allowed && slices.Contains(columnNames, PERMISSIONS_WILDCARD) {
+		query = "SELECT * FROM " + source
+	} else if allowed {
 		quotedColumnNames := make([]string, len(columnNames))
 		for i, columnName := range columnNames {
 			quotedColumnNames[i] = "\"" + columnName + "\""
 		}
-		query = "SELECT " + strings.Join(quotedColumnNames, ", ") + " FROM iceberg_scan('" + queryToIcebergTable.IcebergTablePath + "')"
+		query = "SELECT " + strings.Join(quotedColumnNames, ", ") + " FROM " + source
 	} else {
 		query = "SELECT NULL WHERE FALSE"
 	}
+	if queryToIcebergTable.RowFilter != "" && !strings.HasSuffix(query, " WHERE FALSE") {
+		query += " WHERE (" + queryToIcebergTable.RowFilter + ")"
+	}
 
 	return parser.makeSubselectNode(query, queryToIcebergTable.QuerySchemaTable)
 }
 
+// Columns missing in older partitions are read as NULLs
+func (parser *ParserTable) partitionsSource(queryToIcebergTable QueryToIcebergTable) string {
+	selects := make([]string, len(queryToIcebergTable.Partitions))
+	for i, partition := range queryToIcebergTable.Partitions {
+		columns := []string{"*"}
+		if len(queryToIcebergTable.ColumnNames) > 0 {
+			columns = make([]string, len(queryToIcebergTable.ColumnNames))
+			for j, columnName := range queryToIcebergTable.ColumnNames {
+				columns[j] = "\"" + columnName + "\""
+				if !partition.ColumnNames.Contains(columnName) {
+					columns[j] = "NULL AS " + columns[j]
+				}
+			}
+		}
+		selects[i] = "SELECT " + strings.Join(columns, ", ") + " FROM iceberg_scan('" + partition.IcebergTablePath + "')"
+	}
+	return "(" + strings.Join(selects, " UNION ALL ") + ") partitions"
+}
+
+// pg_shadow -> (SELECT usename, ..., NULL::text AS passwd, ... FROM main.pg_shadow) pg_shadow
+func (parser *ParserTable) MakePgShadowWithoutPasswordsNode(qSchemaTable QuerySchemaTable) *pgQuery.Node {
+	if qSchemaTable.Alias == "" {
+		qSchemaTable.Alias = qSchemaTable.Table
+	}
+	return parser.makeSubselectNode("SELECT usename, usesysid, usecreatedb, usesuper, userepl, usebypassrls, NULL::text AS passwd, valuntil, useconfig FROM main."+PG_TABLE_PG_SHADOW, qSchemaTable)
+}
+
+// bemidb.connection_log -> (SELECT * FROM bemidb.connection_log WHERE usename = 'user') connection_log
+func (parser *ParserTable) MakeConnectionLogForUserNode(qSchemaTable QuerySchemaTable, user string) *pgQuery.Node {
+	if qSchemaTable.Alias == "" {
+		qSchemaTable.Alias = qSchemaTable.Table
+	}
+	return parser.makeSubselectNode("SELECT * FROM "+BEMIDB_SCHEMA+"."+BEMIDB_TABLE_CONNECTION_LOG+" WHERE usename = "+quoteSqlString(user), qSchemaTable)
+}
+
+// pg_namespace -> (SELECT * FROM main.pg_namespace WHERE nspname NOT IN ('hidden')) pg_namespace
+// pg_class -> (SELECT * FROM main.pg_class WHERE relnamespace NOT IN (SELECT oid FROM pg_catalog.pg_namespace WHERE nspname IN ('hidden'))) pg_class
+// pg_attribute -> (SELECT * FROM main.pg_attribute WHERE attrelid NOT IN (SELECT oid FROM pg_catalog.pg_class WHERE relnamespace IN (...))) pg_attribute
+func (parser *ParserTable) MakePgCatalogWithoutSchemasNode(qSchemaTable QuerySchemaTable, hiddenSchemas []string) *pgQuery.Node {
+	quotedSchemas := make([]string, len(hiddenSchemas))
+	for i, schema := range hiddenSchemas {
+		quotedSchemas[i] = "'" + schema + "'"
+	}
+	schemaList := strings.Join(quotedSchemas, ", ")
+	hiddenNamespaceOids := "SELECT oid FROM pg_catalog.pg_namespace WHERE nspname IN (" + schemaList + ")"
+
+	var query string
+	switch qSchemaTable.Table {
+	case PG_TABLE_PG_NAMESPACE:
+		query = "SELECT * FROM main." + PG_TABLE_PG_NAMESPACE + " WHERE nspname NOT IN (" + schemaList + ")"
+	case PG_TABLE_PG_CLASS:
+		query = "SELECT * FROM main." + PG_TABLE_PG_CLASS + " WHERE relnamespace NOT IN (" + hiddenNamespaceOids + ")"
+	case PG_TABLE_PG_ATTRIBUTE:
+		query = "SELECT * FROM main." + PG_TABLE_PG_ATTRIBUTE + " WHERE attrelid NOT IN (SELECT oid FROM pg_catalog.pg_class WHERE relnamespace IN (" + hiddenNamespaceOids + "))"
+	case PG_TABLE_PG_CONSTRAINT:
+		query = "SELECT * FROM main." + PG_TABLE_PG_CONSTRAINT + " WHERE connamespace NOT IN (" + hiddenNamespaceOids + ")"
+	case PG_TABLE_PG_TABLES:
+		query = "SELECT * FROM pg_catalog." + PG_TABLE_PG_TABLES + " WHERE schemaname NOT IN (" + schemaList + ")"
+	default:
+		return nil
+	}
+
+	if qSchemaTable.Alias == "" {
+		qSchemaTable.Alias = qSchemaTable.Table
+	}
+	return parser.makeSubselectNode(query, qSchemaTable)
+}
+
+// public.table -> (SELECT NULL FROM range(n)) table, n rows without columns
+func (parser *ParserTable) MakeMetadataProbeNode(qSchemaTable QuerySchemaTable, rowCount int64) *pgQuery.Node {
+	return parser.makeSubselectNode("SELECT NULL FROM range("+common.Int64ToString(rowCount)+")", qSchemaTable)
+}
+
 // information_schema.tables -> (SELECT * FROM main.tables) information_schema_tables
 // information_schema.tables -> (SELECT * FROM main.tables WHERE table_schema || '.' || table_name IN ('permitted.table')) information_schema_tables
 // information_schema.tables t -> (SELECT * FROM main.tables) t
-func (parser *ParserTable) MakeInformationSchemaTablesNode(qSchemaTable QuerySchemaTable, permissions *map[string][]string) *pgQuery.Node {
-	query := "SELECT * FROM main.tables"
+func (parser *ParserTable) MakeInformationSchemaTablesNode(qSchemaTable QuerySchemaTable, permissions *map[string][]string, visibleSchemas common.Set[string]) *pgQuery.Node {
+	return parser.makePermittedInformationSchemaNode("main."+PG_TABLE_TABLES, qSchemaTable, permissions, visibleSchemas)
+}
+
+// information_schema.views -> (SELECT * FROM main.views) information_schema_views
+// information_schema.views -> (SELECT * FROM main.views WHERE table_schema || '.' || table_name IN ('permitted.view')) information_schema_views
+func (parser *ParserTable) MakeInformationSchemaViewsNode(qSchemaTable QuerySchemaTable, permissions *map[string][]string, visibleSchemas common.Set[string]) *pgQuery.Node {
+	return parser.makePermittedInformationSchemaNode("main."+PG_TABLE_VIEWS, qSchemaTable, permissions, visibleSchemas)
+}
+
+func (parser *ParserTable) makePermittedInformationSchemaNode(tableName string, qSchemaTable QuerySchemaTable, permissions *map[string][]string, visibleSchemas common.Set[string]) *pgQuery.Node {
+	query := "SELECT * FROM " + tableName
+	conditions := []string{}
 
 	if permissions != nil {
-		quotedSchemaTableNames := []string{}
+		permissionConditions := []string{"FALSE"}
 		for schemaTable := range *permissions {
-			quotedSchemaTableNames = append(quotedSchemaTableNames, "'"+schemaTable+"'")
+			permissionConditions = append(permissionConditions, parser.permittedTableCondition(schemaTable))
 		}
-		query += " WHERE table_schema || '.' || table_name IN (" + strings.Join(quotedSchemaTableNames, ", ") + ")"
+		conditions = append(conditions, "("+strings.Join(permissionConditions, " OR ")+")")
+	}
+	if visibleSchemas != nil {
+		conditions = append(conditions, parser.visibleSchemasCondition(visibleSchemas))
+	}
+
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
 	}
 
 	return parser.makeSubselectNode(query, qSchemaTable)
@@ -87,24 +340,71 @@ func (parser *ParserTable) MakeInformationSchemaTablesNode(qSchemaTable QuerySch
 // information_schema.columns -> (SELECT * FROM main.columns) information_schema_columns
 // information_schema.columns -> (SELECT * FROM main.columns WHERE (table_schema || '.' || table_name IN ('permitted.table') AND column_name IN ('permitted', 'columns')) OR ...) information_schema_columns
 // information_schema.columns c -> (SELECT * FROM main.columns) c
-func (parser *ParserTable) MakeInformationSchemaColumnsNode(qSchemaTable QuerySchemaTable, permissions *map[string][]string) *pgQuery.Node {
+func (parser *ParserTable) MakeInformationSchemaColumnsNode(qSchemaTable QuerySchemaTable, permissions *map[string][]string, visibleSchemas common.Set[string]) *pgQuery.Node {
 	query := "SELECT * FROM main.columns"
+	conditions := []string{}
 
 	if permissions != nil {
-		conditions := []string{}
+		permissionConditions := []string{"FALSE"}
 		for schemaTable, columnNames := range *permissions {
-			quotedColumnNames := []string{}
+			if slices.Contains(columnNames, PERMISSIONS_WILDCARD) {
+				permissionConditions = append(permissionConditions, parser.permittedTableCondition(schemaTable))
+				continue
+			}
+			quotedColumnNames := []string{"NULL"}
 			for _, columnName := range columnNames {
 				quotedColumnNames = append(quotedColumnNames, "'"+columnName+"'")
 			}
-			conditions = append(conditions, "(table_schema || '.' || table_name = '"+schemaTable+"' AND column_name IN ("+strings.Join(quotedColumnNames, ", ")+"))")
+			permissionConditions = append(permissionConditions, "("+parser.permittedTableCondition(schemaTable)+" AND column_name IN ("+strings.Join(quotedColumnNames, ", ")+"))")
 		}
-		query += " WHERE " + strings.Join(conditions, " OR ")
+		conditions = append(conditions, "("+strings.Join(permissionConditions, " OR ")+")")
+	}
+	if visibleSchemas != nil {
+		conditions = append(conditions, parser.visibleSchemasCondition(visibleSchemas))
+	}
+
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
 	}
 
 	return parser.makeSubselectNode(query, qSchemaTable)
 }
 
+// "schema.table" -> permitted columns, falls back to the "schema.*" permissions
+func (parser *ParserTable) permittedColumnNames(permissions *map[string][]string, icebergSchemaTable common.IcebergSchemaTable) ([]string, bool) {
+	if columnNames, ok := (*permissions)[icebergSchemaTable.ToArg()]; ok {
+		return columnNames, true
+	}
+	columnNames, ok := (*permissions)[icebergSchemaTable.Schema+"."+PERMISSIONS_WILDCARD]
+	return columnNames, ok
+}
+
+// "schema.table" -> row filter of the user, falls back to the "schema.*" row filter
+func (parser *ParserTable) RowFilter(rowFilters map[string]string, icebergSchemaTable common.IcebergSchemaTable) string {
+	if rowFilter, ok := rowFilters[icebergSchemaTable.ToArg()]; ok {
+		return rowFilter
+	}
+	return rowFilters[icebergSchemaTable.Schema+"."+PERMISSIONS_WILDCARD]
+}
+
+// "schema.table" -> table_schema || '.' || table_name = 'schema.table'
+// "schema.*" -> table_schema = 'schema'
+func (parser *ParserTable) permittedTableCondition(schemaTable string) string {
+	if schema, found := strings.CutSuffix(schemaTable, "."+PERMISSIONS_WILDCARD); found {
+		return "table_schema = '" + schema + "'"
+	}
+	return "table_schema || '.' || table_name = '" + schemaTable + "'"
+}
+
+// Keeps system schemas visible in every logical database
+func (parser *ParserTable) visibleSchemasCondition(visibleSchemas common.Set[string]) string {
+	quotedSchemas := []string{"'" + PG_SCHEMA_PG_CATALOG + "'", "'" + PG_SCHEMA_INFORMATION_SCHEMA + "'"}
+	for _, schema := range visibleSchemas.Values() {
+		quotedSchemas = append(quotedSchemas, "'"+schema+"'")
+	}
+	return "table_schema IN (" + strings.Join(quotedSchemas, ", ") + ")"
+}
+
 func (parser *ParserTable) TopLevelSchemaFunction(rangeFunction *pgQuery.RangeFunction) *QuerySchemaFunction {
 	if len(rangeFunction.Functions) == 0 || len(rangeFunction.Functions[0].GetList().Items) == 0 {
 		return nil
@@ -159,10 +459,19 @@ func (parser *ParserTable) SetAliasIfNotExists(rangeFunction *pgQuery.RangeFunct
 ////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
 
 // (query) AS qSchemaTable
+// public.view -> (SELECT ...) view, with the remapped definition of a view created with CREATE VIEW
+func (parser *ParserTable) MakeViewNode(selectStatement *pgQuery.SelectStmt, qSchemaTable QuerySchemaTable) *pgQuery.Node {
+	return parser.makeSelectSubselectNode(selectStatement, qSchemaTable)
+}
+
 func (parser *ParserTable) makeSubselectNode(query string, qSchemaTable QuerySchemaTable) *pgQuery.Node {
 	queryTree, err := pgQuery.Parse(query)
 	common.PanicIfError(parser.config.CommonConfig, err)
 
+	return parser.makeSelectSubselectNode(queryTree.Stmts[0].Stmt.GetSelectStmt(), qSchemaTable)
+}
+
+func (parser *ParserTable) makeSelectSubselectNode(selectStatement *pgQuery.SelectStmt, qSchemaTable QuerySchemaTable) *pgQuery.Node {
 	alias := qSchemaTable.Alias
 	if alias == "" {
 		if qSchemaTable.Schema == PG_SCHEMA_PUBLIC || qSchemaTable.Schema == "" {
@@ -177,7 +486,7 @@ func (parser *ParserTable) makeSubselectNode(query string, qSchemaTable QuerySch
 			RangeSubselect: &pgQuery.RangeSubselect{
 				Subquery: &pgQuery.Node{
 					Node: &pgQuery.Node_SelectStmt{
-						SelectStmt: queryTree.Stmts[0].Stmt.GetSelectStmt(),
+						SelectStmt: selectStatement,
 					},
 				},
 				Alias: &pgQuery.Alias{
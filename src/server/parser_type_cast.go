@@ -62,13 +62,32 @@ func (parser *ParserTypeCast) NestedTypeCast(typeCast *pgQuery.TypeCast) *pgQuer
 }
 
 // "value" COLLATE pg_catalog.default -> "value"
-func (parser *ParserTypeCast) RemovedDefaultCollateClause(node *pgQuery.Node) *pgQuery.Node {
-	collname := node.GetCollateClause().Collname
+// "value" COLLATE "C" -> "value" (DuckDB compares strings byte-wise by default)
+// "value" COLLATE "en_US.utf8" -> "value" COLLATE en (DuckDB ICU collations are named by language)
+func (parser *ParserTypeCast) RemappedCollateClause(node *pgQuery.Node) *pgQuery.Node {
+	collateClause := node.GetCollateClause()
+	collname := collateClause.Collname[len(collateClause.Collname)-1].GetString_().Sval
+
+	switch strings.ToLower(collname) {
+	case "default", "c", "posix", "ucs_basic":
+		return collateClause.Arg
+	}
+
+	// en_US.utf8 -> en_US, en-US-x-icu -> en-US
+	collname = strings.SplitN(collname, ".", 2)[0]
+	collname = strings.TrimSuffix(strings.ToLower(collname), "-x-icu")
 
-	if len(collname) == 2 && collname[0].GetString_().Sval == "pg_catalog" && collname[1].GetString_().Sval == "default" {
-		return node.GetCollateClause().Arg
+	// en_US -> en, en-US -> en
+	collnameParts := strings.FieldsFunc(collname, func(r rune) bool { return r == '_' || r == '-' })
+	if len(collnameParts) == 0 { // Without a language, DuckDB rejects the unknown collation
+		return node
+	}
+	language := collnameParts[0]
+	if language == "und" { // ICU root collation
+		language = "en"
 	}
 
+	collateClause.Collname = []*pgQuery.Node{pgQuery.MakeStrNode(language)}
 	return node
 }
 
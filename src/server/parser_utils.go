@@ -1,7 +1,11 @@
 package main
 
 import (
+	"strings"
+
 	pgQuery "github.com/pganalyze/pg_query_go/v6"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
 
 	"github.com/BemiHQ/BemiDB/src/common"
 )
@@ -41,3 +45,60 @@ func (utils *ParserUtils) MakeNullNode() *pgQuery.Node {
 		},
 	}
 }
+
+// Option value of COPY, EXPLAIN, etc.
+func defElemStringArg(option *pgQuery.DefElem) string {
+	switch {
+	case option.Arg == nil:
+		return ""
+	case option.Arg.GetString_() != nil:
+		return option.Arg.GetString_().Sval
+	case option.Arg.GetBoolean() != nil:
+		if option.Arg.GetBoolean().Boolval {
+			return "true"
+		}
+		return "false"
+	case option.Arg.GetInteger() != nil:
+		return common.IntToString(int(option.Arg.GetInteger().Ival))
+	}
+	return ""
+}
+
+// HEADER / HEADER true / HEADER on / HEADER 1 -> true
+func defElemBooleanArg(option *pgQuery.DefElem) bool {
+	if option.Arg == nil {
+		return true
+	}
+	switch strings.ToLower(defElemStringArg(option)) {
+	case "true", "on", "1":
+		return true
+	}
+	return false
+}
+
+// Calls visit for every node in the tree, including the nodes that are nested in expressions and subqueries
+func VisitNodes(message proto.Message, visit func(node *pgQuery.Node)) {
+	visitNodes(message.ProtoReflect(), visit)
+}
+
+func visitNodes(message protoreflect.Message, visit func(node *pgQuery.Node)) {
+	if node, ok := message.Interface().(*pgQuery.Node); ok {
+		visit(node)
+	}
+
+	message.Range(func(field protoreflect.FieldDescriptor, value protoreflect.Value) bool {
+		if field.Message() == nil || field.IsMap() {
+			return true
+		}
+
+		if field.IsList() {
+			list := value.List()
+			for i := 0; i < list.Len(); i++ {
+				visitNodes(list.Get(i).Message(), visit) // self-recursion
+			}
+		} else {
+			visitNodes(value.Message(), visit) // self-recursion
+		}
+		return true
+	})
+}
@@ -8,20 +8,52 @@ const (
 	PG_SCHEMA_INFORMATION_SCHEMA = "information_schema"
 	PG_SCHEMA_PG_CATALOG         = "pg_catalog"
 	PG_SCHEMA_PUBLIC             = "public"
+	PG_SCHEMA_PG_TEMP            = "pg_temp"
 
 	PG_FUNCTION_FORMAT               = "format"
 	PG_FUNCTION_ENCODE               = "encode"
 	PG_FUNCTION_JSONB_AGG            = "jsonb_agg"
 	PG_FUNCTION_JSON_ARRAY_ELEMENTS  = "json_array_elements"
 	PG_FUNCTION_JSONB_ARRAY_ELEMENTS = "jsonb_array_elements"
+	PG_FUNCTION_CURRENT_DATABASE     = "current_database"
 
 	PG_TABLE_PG_MATVIEWS         = "pg_matviews"
+	PG_TABLE_PG_VIEWS            = "pg_views"
 	PG_TABLE_PG_CLASS            = "pg_class"
+	PG_TABLE_PG_NAMESPACE        = "pg_namespace"
+	PG_TABLE_PG_ATTRIBUTE        = "pg_attribute"
+	PG_TABLE_PG_CONSTRAINT       = "pg_constraint"
+	PG_TABLE_PG_TABLES           = "pg_tables"
+	PG_TABLE_PG_DEPEND           = "pg_depend"
+	PG_TABLE_PG_LOCKS            = "pg_locks"
+	PG_TABLE_PG_SHADOW           = "pg_shadow"
 	PG_TABLE_PG_STAT_USER_TABLES = "pg_stat_user_tables"
+	PG_TABLE_PG_STAT_DATABASE    = "pg_stat_database"
+	PG_TABLE_PG_STAT_IO          = "pg_stat_io"
 	PG_TABLE_TABLES              = "tables"
 	PG_TABLE_COLUMNS             = "columns"
+	PG_TABLE_VIEWS               = "views"
+	PG_TABLE_COLUMN_METADATA     = "column_metadata"
 
-	PG_VAR_SEARCH_PATH = "search_path"
+	PG_VAR_SEARCH_PATH       = "search_path"
+	PG_VAR_APPLICATION_NAME  = "application_name"
+	PG_VAR_STATEMENT_TIMEOUT = "statement_timeout"
+	PG_VAR_TIMEZONE          = "timezone"
+
+	PG_SEARCH_PATH_USER = "$user"   // Schema named after the session user
+	PG_SEARCH_PATH_TEMP = "pg_temp" // Temp tables
+
+	PG_DATABASE_OID        = 16388 // The default database, logical databases follow it
+	PG_USER_OID            = 10    // The configured superuser
+	PG_ADDITIONAL_USER_OID = 16484 // The first additional user, others follow it
+
+	PG_EPOCH_UNIX_SECONDS = 946684800 // 2000-01-01 00:00:00 UTC, the epoch of binary date and timestamp values
+
+	// Window frame options of Postgres' parsenodes.h
+	PG_FRAME_OPTION_RANGE                     = 0x00002
+	PG_FRAME_OPTION_START_UNBOUNDED_PRECEDING = 0x00020
+	PG_FRAME_OPTION_END_CURRENT_ROW           = 0x00400
+	PG_FRAME_OPTION_DEFAULTS                  = PG_FRAME_OPTION_RANGE | PG_FRAME_OPTION_START_UNBOUNDED_PRECEDING | PG_FRAME_OPTION_END_CURRENT_ROW // RANGE BETWEEN UNBOUNDED PRECEDING AND CURRENT ROW
 )
 
 var PG_SYSTEM_TABLES = common.NewSet[string]().AddAll([]string{
@@ -98,6 +130,10 @@ var PG_SYSTEM_TABLES = common.NewSet[string]().AddAll([]string{
 })
 
 var PG_SYSTEM_VIEWS = common.NewSet[string]().AddAll([]string{
+	"pg_available_extensions",
+	"pg_available_extension_versions",
+	"pg_cursors",
+	"pg_locks",
 	"pg_stat_activity",
 	"pg_stat_replication",
 	"pg_stat_wal_receiver",
@@ -141,4 +177,7 @@ var PG_SYSTEM_VIEWS = common.NewSet[string]().AddAll([]string{
 	"pg_statio_all_sequences",
 	"pg_statio_sys_sequences",
 	"pg_statio_user_sequences",
+	"pg_tables",
+	"pg_timezone_names",
+	"pg_timezone_abbrevs",
 })
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"errors"
+	"strings"
+
+	duckdb "github.com/marcboeker/go-duckdb/v2"
+)
+
+const (
+	PG_ERROR_CODE_SUCCESSFUL_COMPLETION        = "00000"
+	PG_ERROR_CODE_WARNING                      = "01000"
+	PG_ERROR_CODE_SYNTAX_ERROR                 = "42601"
+	PG_ERROR_CODE_FEATURE_NOT_SUPPORTED        = "0A000"
+	PG_ERROR_CODE_DUPLICATE_PREPARED_STATEMENT = "42P05"
+	PG_ERROR_CODE_INVALID_SQL_STATEMENT_NAME   = "26000"
+	PG_ERROR_CODE_DUPLICATE_CURSOR             = "42P03"
+	PG_ERROR_CODE_INVALID_CURSOR_NAME          = "34000"
+	PG_ERROR_CODE_INVALID_PASSWORD             = "28P01"
+	PG_ERROR_CODE_INVALID_AUTHORIZATION        = "28000"
+	PG_ERROR_CODE_IN_FAILED_TRANSACTION        = "25P02"
+	PG_ERROR_CODE_NO_ACTIVE_TRANSACTION        = "25P01"
+	PG_ERROR_CODE_ACTIVE_SQL_TRANSACTION       = "25001"
+	PG_ERROR_CODE_INVALID_SAVEPOINT            = "3B001"
+	PG_ERROR_CODE_QUERY_CANCELED               = "57014"
+	PG_ERROR_CODE_ADMIN_SHUTDOWN               = "57P01"
+	PG_ERROR_CODE_IDLE_SESSION_TIMEOUT         = "57P05"
+	PG_ERROR_CODE_PROTOCOL_VIOLATION           = "08P01"
+	PG_ERROR_CODE_WRONG_OBJECT_TYPE            = "42809"
+	PG_ERROR_CODE_UNDEFINED_TABLE              = "42P01"
+	PG_ERROR_CODE_DUPLICATE_TABLE              = "42P07"
+	PG_ERROR_CODE_INSUFFICIENT_PRIVILEGE       = "42501"
+	PG_ERROR_CODE_OUT_OF_MEMORY                = "53200"
+	PG_ERROR_CODE_CONFIGURATION_LIMIT_EXCEEDED = "53400"
+	PG_ERROR_CODE_INVALID_PARAMETER_VALUE      = "22023"
+	PG_ERROR_CODE_OBJECT_NOT_IN_PREREQUISITE   = "55000"
+	PG_ERROR_CODE_DUPLICATE_SCHEMA             = "42P06"
+	PG_ERROR_CODE_RESERVED_NAME                = "42939"
+	PG_ERROR_CODE_DUPLICATE_COLUMN             = "42701"
+	PG_ERROR_CODE_UNDEFINED_COLUMN             = "42703"
+	PG_ERROR_CODE_CANT_CHANGE_RUNTIME_PARAM    = "55P02"
+	PG_ERROR_CODE_INVALID_OBJECT_DEFINITION    = "42P17"
+	PG_ERROR_CODE_INVALID_SCHEMA_NAME          = "3F000"
+	PG_ERROR_CODE_UNDEFINED_FUNCTION           = "42883"
+	PG_ERROR_CODE_UNDEFINED_OBJECT             = "42704"
+	PG_ERROR_CODE_AMBIGUOUS_COLUMN             = "42702"
+	PG_ERROR_CODE_GROUPING_ERROR               = "42803"
+	PG_ERROR_CODE_DATATYPE_MISMATCH            = "42804"
+	PG_ERROR_CODE_CANNOT_COERCE                = "42846"
+	PG_ERROR_CODE_SYNTAX_ERROR_OR_ACCESS_RULE  = "42000"
+	PG_ERROR_CODE_DATA_CORRUPTED               = "XX001"
+	PG_ERROR_CODE_INVALID_TEXT_REPRESENTATION  = "22P02"
+	PG_ERROR_CODE_NUMERIC_VALUE_OUT_OF_RANGE   = "22003"
+	PG_ERROR_CODE_DIVISION_BY_ZERO             = "22012"
+	PG_ERROR_CODE_DATA_EXCEPTION               = "22000"
+	PG_ERROR_CODE_INTEGRITY_CONSTRAINT         = "23000"
+	PG_ERROR_CODE_NOT_NULL_VIOLATION           = "23502"
+	PG_ERROR_CODE_UNIQUE_VIOLATION             = "23505"
+	PG_ERROR_CODE_SERIALIZATION_FAILURE        = "40001"
+	PG_ERROR_CODE_IO_ERROR                     = "58030"
+	PG_ERROR_CODE_INTERNAL_ERROR               = "XX000"
+)
+
+// Error with a Postgres SQLSTATE code and an optional detail and hint sent to the client in the ErrorResponse
+type PgError struct {
+	Code    string
+	Message string
+	Detail  string
+	Hint    string
+}
+
+func (pgError *PgError) Error() string {
+	return pgError.Message
+}
+
+// Catalog Error: Table with name users does not exist! -> 42P01 (undefined_table), with the DuckDB error message.
+// Returns nil if the error isn't a DuckDB error
+func DuckdbErrorToPgError(err error) *PgError {
+	var duckdbError *duckdb.Error
+	if !errors.As(err, &duckdbError) {
+		return nil
+	}
+	return &PgError{Code: duckdbErrorCode(duckdbError), Message: err.Error()}
+}
+
+func duckdbErrorCode(duckdbError *duckdb.Error) string {
+	message := duckdbError.Msg
+	switch duckdbError.Type {
+	case duckdb.ErrorTypeCatalog:
+		switch {
+		case strings.Contains(message, "Table with name"), strings.Contains(message, "Table or view with name"), strings.Contains(message, "View with name"):
+			if strings.Contains(message, "already exists") {
+				return PG_ERROR_CODE_DUPLICATE_TABLE
+			}
+			return PG_ERROR_CODE_UNDEFINED_TABLE
+		case strings.Contains(message, "Schema with name"):
+			if strings.Contains(message, "already exists") {
+				return PG_ERROR_CODE_DUPLICATE_SCHEMA
+			}
+			return PG_ERROR_CODE_INVALID_SCHEMA_NAME
+		case strings.Contains(message, "Function with name"), strings.Contains(message, "Macro Function with name"):
+			return PG_ERROR_CODE_UNDEFINED_FUNCTION
+		}
+		return PG_ERROR_CODE_UNDEFINED_OBJECT
+	case duckdb.ErrorTypeBinder:
+		switch {
+		case strings.Contains(message, "Referenced column"), strings.Contains(message, "Referenced table"), strings.Contains(message, "not found in FROM clause"):
+			return PG_ERROR_CODE_UNDEFINED_COLUMN
+		case strings.Contains(strings.ToLower(message), "ambiguous"):
+			return PG_ERROR_CODE_AMBIGUOUS_COLUMN
+		case strings.Contains(message, "GROUP BY clause"):
+			return PG_ERROR_CODE_GROUPING_ERROR
+		case strings.Contains(message, "No function matches"), strings.Contains(message, "Could not choose a best candidate function"):
+			return PG_ERROR_CODE_UNDEFINED_FUNCTION
+		case strings.Contains(message, "Cannot compare values"), strings.Contains(message, "Cannot mix values"):
+			return PG_ERROR_CODE_DATATYPE_MISMATCH
+		}
+		return PG_ERROR_CODE_SYNTAX_ERROR_OR_ACCESS_RULE
+	case duckdb.ErrorTypeParser, duckdb.ErrorTypeSyntax:
+		return PG_ERROR_CODE_SYNTAX_ERROR
+	case duckdb.ErrorTypeConversion, duckdb.ErrorTypeInvalidInput:
+		switch {
+		case strings.Contains(message, "out of range"):
+			return PG_ERROR_CODE_NUMERIC_VALUE_OUT_OF_RANGE
+		case strings.Contains(message, "Unimplemented type for cast"):
+			return PG_ERROR_CODE_CANNOT_COERCE
+		}
+		return PG_ERROR_CODE_INVALID_TEXT_REPRESENTATION
+	case duckdb.ErrorTypeOutOfRange, duckdb.ErrorTypeDecimal:
+		return PG_ERROR_CODE_NUMERIC_VALUE_OUT_OF_RANGE
+	case duckdb.ErrorTypeDivideByZero:
+		return PG_ERROR_CODE_DIVISION_BY_ZERO
+	case duckdb.ErrorTypeMismatchType, duckdb.ErrorTypeInvalidType:
+		return PG_ERROR_CODE_DATATYPE_MISMATCH
+	case duckdb.ErrorTypeConstraint:
+		switch {
+		case strings.Contains(message, "NOT NULL constraint"):
+			return PG_ERROR_CODE_NOT_NULL_VIOLATION
+		case strings.Contains(message, "Duplicate key"):
+			return PG_ERROR_CODE_UNIQUE_VIOLATION
+		}
+		return PG_ERROR_CODE_INTEGRITY_CONSTRAINT
+	case duckdb.ErrorTypeNotImplemented:
+		return PG_ERROR_CODE_FEATURE_NOT_SUPPORTED
+	case duckdb.ErrorTypeTransaction:
+		return PG_ERROR_CODE_SERIALIZATION_FAILURE
+	case duckdb.ErrorTypeOutOfMemory:
+		return PG_ERROR_CODE_OUT_OF_MEMORY
+	case duckdb.ErrorTypeInterrupt:
+		return PG_ERROR_CODE_QUERY_CANCELED
+	case duckdb.ErrorTypePermission:
+		return PG_ERROR_CODE_INSUFFICIENT_PRIVILEGE
+	case duckdb.ErrorTypeIO, duckdb.ErrorTypeHTTP, duckdb.ErrorTypeNetwork:
+		return PG_ERROR_CODE_IO_ERROR
+	case duckdb.ErrorTypeParameterNotResolved, duckdb.ErrorTypeParameterNotAllowed:
+		return PG_ERROR_CODE_SYNTAX_ERROR_OR_ACCESS_RULE
+	case duckdb.ErrorTypeInvalid, duckdb.ErrorTypeExpression, duckdb.ErrorTypeExecutor, duckdb.ErrorTypeSequence:
+		return PG_ERROR_CODE_DATA_EXCEPTION
+	}
+	return PG_ERROR_CODE_INTERNAL_ERROR
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"sync"
+
+	"github.com/BemiHQ/BemiDB/src/common"
+)
+
+const PINNED_TABLES_DUCKDB_SCHEMA = "bemidb_pinned"
+
+// Keeps small tables from BEMIDB_PINNED_TABLES in native DuckDB tables so that queries don't read them from object storage.
+// A table is reloaded in the background when its Iceberg metadata file changes, queries read it with iceberg_scan until then.
+type PinnedTables struct {
+	mutex               sync.Mutex
+	config              *Config
+	icebergReader       *IcebergReader
+	duckdbClient        *common.DuckdbClient
+	loadedMetadataPaths map[common.IcebergSchemaTable]string // Metadata file each DuckDB table was loaded from
+	reloading           common.Set[common.IcebergSchemaTable]
+}
+
+func NewPinnedTables(config *Config, icebergReader *IcebergReader, duckdbClient *common.DuckdbClient) *PinnedTables {
+	return &PinnedTables{
+		config:              config,
+		icebergReader:       icebergReader,
+		duckdbClient:        duckdbClient,
+		loadedMetadataPaths: make(map[common.IcebergSchemaTable]string),
+		reloading:           common.NewSet[common.IcebergSchemaTable](),
+	}
+}
+
+// Loads all pinned tables on boot
+func (pinnedTables *PinnedTables) LoadAll() {
+	for _, icebergSchemaTable := range pinnedTables.config.PinnedTables {
+		metadataFileS3Path := pinnedTables.icebergReader.MetadataFileS3Path(icebergSchemaTable)
+		if metadataFileS3Path == "" {
+			common.LogWarn(pinnedTables.config.CommonConfig, "Couldn't find pinned table:", icebergSchemaTable.ToArg())
+			continue
+		}
+		pinnedTables.load(icebergSchemaTable, metadataFileS3Path)
+	}
+}
+
+// Returns the DuckDB table if the table is pinned and loaded from the current metadata file, otherwise starts reloading it and returns an empty string
+func (pinnedTables *PinnedTables) DuckdbTableName(icebergSchemaTable common.IcebergSchemaTable, metadataFileS3Path string) string {
+	if !pinnedTables.isPinned(icebergSchemaTable) {
+		return ""
+	}
+
+	pinnedTables.mutex.Lock()
+	defer pinnedTables.mutex.Unlock()
+
+	if pinnedTables.loadedMetadataPaths[icebergSchemaTable] == metadataFileS3Path {
+		return pinnedTables.duckdbTableName(icebergSchemaTable)
+	}
+
+	if !pinnedTables.reloading.Contains(icebergSchemaTable) {
+		pinnedTables.reloading.Add(icebergSchemaTable)
+		goWithPanicHandler(pinnedTables.config, func() {
+			pinnedTables.load(icebergSchemaTable, metadataFileS3Path)
+
+			pinnedTables.mutex.Lock()
+			defer pinnedTables.mutex.Unlock()
+			pinnedTables.reloading.Remove(icebergSchemaTable)
+		})
+	}
+	return ""
+}
+
+func (pinnedTables *PinnedTables) load(icebergSchemaTable common.IcebergSchemaTable, metadataFileS3Path string) {
+	common.LogInfo(pinnedTables.config.CommonConfig, "Loading pinned table:", icebergSchemaTable.ToArg())
+
+	ctx := context.Background()
+	err := pinnedTables.duckdbClient.ExecTransactionContext(ctx, []string{
+		"CREATE SCHEMA IF NOT EXISTS " + PINNED_TABLES_DUCKDB_SCHEMA,
+		"CREATE OR REPLACE TABLE " + pinnedTables.duckdbTableName(icebergSchemaTable) + " AS SELECT * FROM iceberg_scan('$path')",
+	}, []map[string]string{nil, {"path": metadataFileS3Path}})
+	if err != nil {
+		common.LogError(pinnedTables.config.CommonConfig, "Couldn't load pinned table "+icebergSchemaTable.ToArg()+":", err)
+		return
+	}
+
+	pinnedTables.mutex.Lock()
+	defer pinnedTables.mutex.Unlock()
+	pinnedTables.loadedMetadataPaths[icebergSchemaTable] = metadataFileS3Path
+}
+
+func (pinnedTables *PinnedTables) isPinned(icebergSchemaTable common.IcebergSchemaTable) bool {
+	for _, pinnedSchemaTable := range pinnedTables.config.PinnedTables {
+		if pinnedSchemaTable == icebergSchemaTable {
+			return true
+		}
+	}
+	return false
+}
+
+// public.table -> bemidb_pinned."public.table"
+func (pinnedTables *PinnedTables) duckdbTableName(icebergSchemaTable common.IcebergSchemaTable) string {
+	return PINNED_TABLES_DUCKDB_SCHEMA + `."` + icebergSchemaTable.ToArg() + `"`
+}
@@ -1,9 +1,17 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"net"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"slices"
+	"syscall"
+	"time"
 
 	"github.com/jackc/pgx/v5/pgproto3"
 
@@ -11,24 +19,35 @@ import (
 )
 
 const (
-	PG_VERSION        = "17.0"
-	PG_ENCODING       = "UTF8"
-	PG_TX_STATUS_IDLE = 'I'
+	PG_VERSION                  = "17.0"
+	PG_ENCODING                 = "UTF8"
+	PG_TX_STATUS_IDLE           = 'I'
+	PG_TX_STATUS_IN_TRANSACTION = 'T'
+	PG_TX_STATUS_FAILED         = 'E'
 
 	SYSTEM_AUTH_USER = "bemidb"
 )
 
+var errCancelRequest = errors.New("cancel request")
+
 type PostgresServer struct {
-	backend *pgproto3.Backend
-	conn    *net.Conn
-	config  *Config
+	backend       *pgproto3.Backend
+	conn          *net.Conn
+	readAheadConn *ReadAheadConn
+	session       *Session // Set by Run, reports the transaction status in ReadyForQuery
+	config        *Config
+	sslRequested  bool      // SSLRequest is answered once, whether TLS is enabled or not
+	connectedAt   time.Time // Set by Run after the startup, limits the session age
 }
 
 func NewPostgresServer(config *Config, conn *net.Conn) *PostgresServer {
+	readAheadConn := NewReadAheadConn(*conn)
+	*conn = readAheadConn
 	return &PostgresServer{
-		conn:    conn,
-		backend: pgproto3.NewBackend(*conn, *conn),
-		config:  config,
+		conn:          conn,
+		readAheadConn: readAheadConn,
+		backend:       pgproto3.NewBackend(*conn, *conn),
+		config:        config,
 	}
 }
 
@@ -52,21 +71,106 @@ func NewTcpListener(config *Config) net.Listener {
 	return tcpListener
 }
 
+// Listens on "<dir>/.s.PGSQL.<port>" like Postgres for local clients, returns nil if the Unix socket is disabled
+func NewUnixListener(config *Config) net.Listener {
+	if config.UnixSocketDir == "" {
+		return nil
+	}
+
+	socketPath := filepath.Join(config.UnixSocketDir, ".s.PGSQL."+config.Port)
+	err := removeStaleUnixSocket(socketPath)
+	if err != nil {
+		common.PrintErrorAndExit(config.CommonConfig, "Couldn't listen on the Unix socket: "+err.Error()+".")
+	}
+
+	unixListener, err := net.Listen("unix", socketPath)
+	common.PanicIfError(config.CommonConfig, err)
+	err = os.Chmod(socketPath, config.UnixSocketMode)
+	common.PanicIfError(config.CommonConfig, err)
+	return unixListener
+}
+
+// Removes a socket left behind by a server that didn't shut down gracefully, but not one that another server is still listening on
+func removeStaleUnixSocket(socketPath string) error {
+	fileInfo, err := os.Lstat(socketPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if fileInfo.Mode().Type() != os.ModeSocket {
+		return fmt.Errorf("%s exists and isn't a Unix socket", socketPath)
+	}
+
+	conn, err := net.DialTimeout("unix", socketPath, time.Second)
+	if err == nil {
+		conn.Close()
+		return fmt.Errorf("another server is already listening on %s", socketPath)
+	}
+	if !errors.Is(err, syscall.ECONNREFUSED) {
+		return fmt.Errorf("couldn't check whether %s is stale: %w", socketPath, err)
+	}
+	return os.Remove(socketPath)
+}
+
+// Connections from denied IP addresses are closed before the Postgres handshake
 func AcceptConnection(config *Config, listener net.Listener) net.Conn {
 	conn, err := listener.Accept()
 	common.PanicIfError(config.CommonConfig, err)
+
+	for !config.IsClientAllowed(conn.RemoteAddr()) {
+		common.LogWarn(config.CommonConfig, "BemiDB: Rejected connection from", conn.RemoteAddr())
+		conn.Close()
+		conn, err = listener.Accept()
+		common.PanicIfError(config.CommonConfig, err)
+	}
+
+	// Detect half-open connections from crashed clients or dropped networks
+	if tcpConn, ok := conn.(*net.TCPConn); ok && config.TcpKeepaliveSeconds > 0 {
+		err = tcpConn.SetKeepAliveConfig(net.KeepAliveConfig{
+			Enable:   true,
+			Idle:     time.Duration(config.TcpKeepaliveSeconds) * time.Second,
+			Interval: time.Duration(config.TcpKeepaliveSeconds) * time.Second,
+			Count:    3,
+		})
+		if err != nil {
+			common.LogWarn(config.CommonConfig, "Couldn't configure TCP keepalive:", err)
+		}
+	}
+
 	return conn
 }
 
 func (server *PostgresServer) Run(queryHandler *QueryHandler) {
-	err := server.handleStartup()
+	queryHandler = queryHandler.WithNewSession()
+	queryHandler.MessageWriter = server.writeMessages
+	defer queryHandler.QueryRemapper.Session.Cancel()
+	defer queryHandler.QueryRemapper.Session.CloseExtendedStatements()
+	defer queryHandler.QueryRemapper.Session.CloseCursors()
+	defer queryHandler.QueryRemapper.DropTempTables()
+	defer queryHandler.QueryRemapper.RollbackTransaction()
+	server.session = queryHandler.QueryRemapper.Session
+	server.session.ClientAddr = ClientHost((*server.conn).RemoteAddr())
+	go server.cancelOnDisconnect(queryHandler.QueryRemapper.Session)
+
+	err := server.handleStartup(queryHandler.QueryRemapper.Session)
+	if errors.Is(err, errCancelRequest) {
+		return // Terminate connection, it was opened only to cancel a query
+	}
 	if err != nil {
 		common.LogError(server.config.CommonConfig, "Error handling startup:", err)
 		return // Terminate connection
 	}
+	queryHandler.MessageReader = server.backend.Receive // After the startup replaced the backend with a TLS one
+	queryHandler.ConnectionLog.Open(queryHandler.QueryRemapper.Session)
+	defer queryHandler.ConnectionLog.Close(queryHandler.QueryRemapper.Session)
+	queryHandler.RestoreSessionCheckpoint()
+	defer queryHandler.SessionCheckpoints.Save(queryHandler.QueryRemapper.Session)
 
+	server.connectedAt = time.Now()
 	for {
-		message, err := server.backend.Receive()
+		message, err := server.receiveBeforeTimeout()
 		if err != nil {
 			return // Terminate connection
 		}
@@ -74,8 +178,8 @@ func (server *PostgresServer) Run(queryHandler *QueryHandler) {
 		switch message := message.(type) {
 		case *pgproto3.Query:
 			server.handleSimpleQuery(queryHandler, message)
-		case *pgproto3.Parse:
-			err = server.handleExtendedQuery(queryHandler, message) // recursion
+		case *pgproto3.Parse, *pgproto3.Bind, *pgproto3.Describe, *pgproto3.Execute, *pgproto3.Close, *pgproto3.Sync, *pgproto3.Flush:
+			err = server.handleExtendedQuery(queryHandler, message)
 			if err != nil {
 				return // Terminate connection
 			}
@@ -89,124 +193,251 @@ func (server *PostgresServer) Run(queryHandler *QueryHandler) {
 	}
 }
 
+// Waits for the next message of the client, closes the connection if it stays idle for too long or reached its max age.
+// A connection older than its max age is closed only between messages, so running queries aren't interrupted
+func (server *PostgresServer) receiveBeforeTimeout() (pgproto3.FrontendMessage, error) {
+	if server.config.IdleTimeoutSeconds == 0 && server.config.MaxSessionAgeSeconds == 0 {
+		return server.backend.Receive()
+	}
+
+	timeout := time.Duration(server.config.IdleTimeoutSeconds) * time.Second
+	timeoutError := &PgError{Code: PG_ERROR_CODE_IDLE_SESSION_TIMEOUT, Message: "terminating connection due to idle-session timeout"}
+	if server.config.MaxSessionAgeSeconds > 0 {
+		remainingAge := time.Duration(server.config.MaxSessionAgeSeconds)*time.Second - time.Since(server.connectedAt)
+		if server.config.IdleTimeoutSeconds == 0 || remainingAge < timeout {
+			timeout = max(remainingAge, 0)
+			timeoutError = &PgError{Code: PG_ERROR_CODE_ADMIN_SHUTDOWN, Message: "terminating connection due to max session age"}
+		}
+	}
+
+	timer := time.AfterFunc(timeout, func() {
+		common.LogInfo(server.config.CommonConfig, "Closing connection:", timeoutError.Message)
+		server.writeMessages(&pgproto3.ErrorResponse{Severity: "FATAL", Code: timeoutError.Code, Message: timeoutError.Message})
+		server.Close()
+	})
+	message, err := server.backend.Receive()
+	if !timer.Stop() {
+		return nil, timeoutError // The connection is being closed by the timer
+	}
+	return message, err
+}
+
+// Stops running DuckDB queries of the session as soon as the client disconnects instead of after they complete
+func (server *PostgresServer) cancelOnDisconnect(session *Session) {
+	<-server.readAheadConn.Closed()
+	common.LogDebug(server.config.CommonConfig, "Client disconnected, canceling running queries")
+	session.Cancel()
+}
+
+// Keeps the server running if a connection goroutine panics outside of query handling
+func (server *PostgresServer) RecoverPanic() {
+	if r := recover(); r != nil {
+		server.recoveredPanicError(r, "")
+	}
+}
+
 func (server *PostgresServer) Close() error {
 	return (*server.conn).Close()
 }
 
 func (server *PostgresServer) handleSimpleQuery(queryHandler *QueryHandler, queryMessage *pgproto3.Query) {
 	common.LogDebug(server.config.CommonConfig, "Received query:", queryMessage.String)
-	messages, err := queryHandler.HandleSimpleQuery(queryMessage.String)
+	queryHandler.QueryRemapper.Session.ClosePortals() // A simple query ends the implicit transaction of the extended query
+	var messages []pgproto3.Message
+	startedAt, transaction := time.Now(), queryHandler.QueryRemapper.Session.Transaction
+	err := server.withPanicRecovery(queryMessage.String, func() (err error) {
+		messages, err = queryHandler.HandleSimpleQuery(queryMessage.String)
+		return err
+	})
+	queryHandler.ConnectionLog.TrackQuery(queryHandler.QueryRemapper.Session, transaction, messages, err, time.Since(startedAt))
 	if err != nil {
 		server.writeError(err)
 		return
 	}
-	messages = append(messages, &pgproto3.ReadyForQuery{TxStatus: PG_TX_STATUS_IDLE})
+	messages = append(messages, server.readyForQuery())
 	server.writeMessages(messages...)
 }
 
-func (server *PostgresServer) handleExtendedQuery(queryHandler *QueryHandler, parseMessage *pgproto3.Parse) error {
-	common.LogDebug(server.config.CommonConfig, "Parsing query", parseMessage.Query)
-	messages, preparedStatement, err := queryHandler.HandleParseQuery(parseMessage)
-	if err != nil {
-		server.writeError(err)
-		return nil
-	}
-	server.writeMessages(messages...)
-
+// Handles extended query messages until Sync, statements and portals are kept in the session to be used by the next extended queries
+func (server *PostgresServer) handleExtendedQuery(queryHandler *QueryHandler, firstMessage pgproto3.FrontendMessage) error {
+	var preparedStatement *PreparedStatement // Parsed, bound, or described by the previous message
 	var previousErr error
 	for {
-		message, err := server.backend.Receive()
-		if err != nil {
-			return err
+		message := firstMessage
+		firstMessage = nil
+		if message == nil {
+			var err error
+			message, err = server.receiveBeforeTimeout()
+			if err != nil {
+				return err
+			}
 		}
 
-		switch message := message.(type) {
-		case *pgproto3.Bind:
-			if previousErr != nil { // Skip processing the next message if there was an error in the previous message
+		if previousErr != nil { // Skip processing the next messages until Sync if there was an error in the previous message
+			switch message.(type) {
+			case *pgproto3.Parse, *pgproto3.Bind, *pgproto3.Describe, *pgproto3.Execute, *pgproto3.Close, *pgproto3.Flush:
 				continue
 			}
+		}
 
+		var messages []pgproto3.Message
+		var err error
+		switch message := message.(type) {
+		case *pgproto3.Parse:
+			common.LogDebug(server.config.CommonConfig, "Parsing query", message.Query)
+			err = server.withPanicRecovery(message.Query, func() (err error) {
+				messages, preparedStatement, err = queryHandler.HandleParseQuery(message)
+				return err
+			})
+		case *pgproto3.Bind:
 			common.LogDebug(server.config.CommonConfig, "Binding query", message.PreparedStatement)
-			messages, preparedStatement, err = queryHandler.HandleBindQuery(message, preparedStatement)
-			if err != nil {
-				server.writeError(err)
-				previousErr = err
-			}
-			server.writeMessages(messages...)
+			err = server.withPanicRecovery(extendedQueryText(preparedStatement), func() (err error) {
+				messages, preparedStatement, err = queryHandler.HandleBindQuery(message, preparedStatement)
+				return err
+			})
 		case *pgproto3.Describe:
-			if previousErr != nil { // Skip processing the next message if there was an error in the previous message
-				continue
-			}
-
 			common.LogDebug(server.config.CommonConfig, "Describing query", message.Name, "("+string(message.ObjectType)+")")
-			var messages []pgproto3.Message
-			messages, preparedStatement, err = queryHandler.HandleDescribeQuery(message, preparedStatement)
-			if err != nil {
-				server.writeError(err)
-				previousErr = err
-			}
-			server.writeMessages(messages...)
+			err = server.withPanicRecovery(extendedQueryText(preparedStatement), func() (err error) {
+				messages, preparedStatement, err = queryHandler.HandleDescribeQuery(message, preparedStatement)
+				return err
+			})
 		case *pgproto3.Execute:
-			if previousErr != nil { // Skip processing the next message if there was an error in the previous message
-				continue
-			}
-
 			common.LogDebug(server.config.CommonConfig, "Executing query", message.Portal)
-			messages, err := queryHandler.HandleExecuteQuery(message, preparedStatement)
-			if err != nil {
-				server.writeError(err)
-				previousErr = err
-			}
-			server.writeMessages(messages...)
+			startedAt, transaction := time.Now(), queryHandler.QueryRemapper.Session.Transaction
+			err = server.withPanicRecovery(extendedQueryText(preparedStatement), func() (err error) {
+				messages, err = queryHandler.HandleExecuteQuery(message, preparedStatement)
+				return err
+			})
+			queryHandler.ConnectionLog.TrackQuery(queryHandler.QueryRemapper.Session, transaction, messages, err, time.Since(startedAt))
+		case *pgproto3.Close:
+			common.LogDebug(server.config.CommonConfig, "Closing", message.Name, "("+string(message.ObjectType)+")")
+			messages, err = queryHandler.HandleCloseQuery(message)
+		case *pgproto3.Flush:
+			// Ignore Flush messages, as we are sending responses immediately.
 		case *pgproto3.Sync:
+			// Sync ends the implicit transaction. A suspended portal can still be resumed with Execute (e.g., JDBC with setFetchSize)
+			// and statements can be bound again (e.g., psycopg sends Parse->[extra Sync]->Bind->Describe->Execute->Sync)
 			common.LogDebug(server.config.CommonConfig, "Syncing query")
+			queryHandler.QueryRemapper.Session.CloseCompletedPortals()
 			server.writeMessages(
-				&pgproto3.ReadyForQuery{TxStatus: PG_TX_STATUS_IDLE},
+				server.readyForQuery(),
 			)
-
-			// If there was an error or Parse->Bind->Sync (...) or Parse->Describe->Sync (e.g., Metabase)
-			// it means that sync is the last message in the extended query protocol, we can exit handleExtendedQuery
-			if previousErr != nil || preparedStatement.Bound || preparedStatement.Described {
-				return nil
-			}
-			// Otherwise, wait for Bind/Describe/Execute/Sync.
-			// For example, psycopg sends Parse->[extra Sync]->Bind->Describe->Execute->Sync
-		case *pgproto3.Parse:
-			server.handleExtendedQuery(queryHandler, message) // self-recursion
 			return nil
-		case *pgproto3.Flush:
-			// Ignore Flush messages, as we are sending responses immediately.
-		case *pgproto3.Close:
-			common.LogDebug(server.config.CommonConfig, "Closing prepared statement", message.Name)
-			server.writeMessages(&pgproto3.CloseComplete{})
+		case *pgproto3.Query: // Without Sync, e.g., after a suspended portal that wasn't resumed
+			server.handleSimpleQuery(queryHandler, message)
+			return nil
 		default:
 			common.LogError(server.config.CommonConfig, fmt.Sprintf("Received unexpected message type from client: %T", message))
 			return fmt.Errorf("received unexpected message type from client: %T", message)
 		}
+
+		if err != nil {
+			server.writeError(err)
+			previousErr = err
+		}
+		server.writeMessages(messages...)
 	}
 }
 
+// Original query for errors, empty if the extended query didn't parse or bind a statement yet
+func extendedQueryText(preparedStatement *PreparedStatement) string {
+	if preparedStatement == nil {
+		return ""
+	}
+	return preparedStatement.OriginalQuery
+}
+
+// Converts a panic while handling a query into an error to keep the connection and the server running
+func (server *PostgresServer) withPanicRecovery(query string, handleFunc func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = server.recoveredPanicError(r, query)
+		}
+	}()
+
+	return handleFunc()
+}
+
+func (server *PostgresServer) recoveredPanicError(recovered interface{}, query string) error {
+	err, ok := recovered.(error)
+	if !ok {
+		err = fmt.Errorf("%v", recovered)
+	}
+
+	common.LogError(server.config.CommonConfig, "Recovered from panic while handling query:", query+"\n"+err.Error()+"\n"+string(debug.Stack()))
+	common.ReportRecoveredError(server.config.CommonConfig, err)
+	return errors.New("internal error: " + err.Error())
+}
+
 func (server *PostgresServer) writeMessages(messages ...pgproto3.Message) {
 	var buf []byte
 	for _, message := range messages {
 		buf, _ = message.Encode(buf)
 	}
-	(*server.conn).Write(buf)
+
+	if server.config.WriteTimeoutSeconds > 0 {
+		(*server.conn).SetWriteDeadline(time.Now().Add(time.Duration(server.config.WriteTimeoutSeconds) * time.Second))
+	}
+	_, err := (*server.conn).Write(buf)
+	if err != nil {
+		// Broken pipe or timed out write -> close the connection to stop receiving messages from it
+		common.LogWarn(server.config.CommonConfig, "Couldn't write to client, closing connection:", err)
+		server.Close()
+	}
+}
+
+// Clients like psycopg track the transaction status to decide whether to send BEGIN before the next query
+func (server *PostgresServer) readyForQuery() *pgproto3.ReadyForQuery {
+	if server.session != nil && server.session.Transaction != nil {
+		if server.session.Transaction.Failed {
+			return &pgproto3.ReadyForQuery{TxStatus: PG_TX_STATUS_FAILED}
+		}
+		return &pgproto3.ReadyForQuery{TxStatus: PG_TX_STATUS_IN_TRANSACTION}
+	}
+	return &pgproto3.ReadyForQuery{TxStatus: PG_TX_STATUS_IDLE}
 }
 
 func (server *PostgresServer) writeError(err error) {
+	switch {
+	case errors.Is(err, context.Canceled):
+		err = &PgError{Code: PG_ERROR_CODE_QUERY_CANCELED, Message: "canceling statement due to user request"}
+	case errors.Is(err, context.DeadlineExceeded):
+		err = &PgError{Code: PG_ERROR_CODE_QUERY_CANCELED, Message: "canceling statement due to statement timeout"}
+	}
+
 	common.LogError(server.config.CommonConfig, err.Error())
+	if server.session != nil && server.session.Transaction != nil {
+		server.session.Transaction.Failed = true // Until COMMIT or ROLLBACK like in Postgres
+	}
+
+	errorResponse := &pgproto3.ErrorResponse{
+		Severity: "ERROR",
+		Code:     PG_ERROR_CODE_INTERNAL_ERROR,
+		Message:  err.Error(),
+	}
+	var pgError *PgError
+	if !errors.As(err, &pgError) {
+		pgError = DuckdbErrorToPgError(err)
+	}
+	if pgError != nil {
+		errorResponse.Code = pgError.Code
+		errorResponse.Detail = pgError.Detail
+		errorResponse.Hint = pgError.Hint
+	}
+
+	var notices []pgproto3.Message
+	if server.session != nil {
+		notices = server.session.TakeNotices() // Raised before the error, e.g. while remapping the query
+	}
 
-	server.writeMessages(
-		&pgproto3.ErrorResponse{
-			Severity: "ERROR",
-			Message:  err.Error(),
-		},
-		&pgproto3.ReadyForQuery{TxStatus: PG_TX_STATUS_IDLE},
-	)
+	server.writeMessages(append(
+		notices,
+		errorResponse,
+		server.readyForQuery(),
+	)...)
 }
 
-func (server *PostgresServer) handleStartup() error {
+func (server *PostgresServer) handleStartup(session *Session) error {
 	startupMessage, err := server.backend.ReceiveStartupMessage()
 	if err != nil {
 		return err
@@ -217,31 +448,185 @@ func (server *PostgresServer) handleStartup() error {
 		params := startupMessage.Parameters
 		common.LogDebug(server.config.CommonConfig, "BemiDB: startup message", params)
 
-		if params["database"] != server.config.Database {
+		if server.config.TlsRequired && !server.tlsEnabled() && server.tcpConnection() {
+			server.writeError(&PgError{Code: PG_ERROR_CODE_INVALID_AUTHORIZATION, Message: "SSL connection is required"})
+			return errors.New("SSL connection is required")
+		}
+
+		hbaMethod := HBA_METHOD_PASSWORD
+		if server.config.HbaRules != nil {
+			hbaMethod, err = server.checkHbaRules(session, params["database"], params["user"])
+			if err != nil {
+				return err
+			}
+		}
+
+		if !slices.Contains(server.config.DatabaseNames(), params["database"]) {
 			server.writeError(errors.New("database " + params["database"] + " does not exist"))
 			return errors.New("database does not exist")
 		}
 
-		if server.config.User != "" && params["user"] != server.config.User && params["user"] != SYSTEM_AUTH_USER {
+		encryptedPassword, ok := server.config.EncryptedPasswordFor(params["user"])
+		if !ok {
 			server.writeError(errors.New("role \"" + params["user"] + "\" does not exist"))
 			return errors.New("role does not exist")
 		}
 
+		if server.config.PasswordRequired(hbaMethod, encryptedPassword) {
+			err = server.authenticateWithScram(encryptedPassword) // Fails without a configured password
+			if err != nil {
+				common.LogDebug(server.config.CommonConfig, "SCRAM authentication failed:", err)
+				server.writeError(&PgError{
+					Code:    PG_ERROR_CODE_INVALID_PASSWORD,
+					Message: "password authentication failed for user \"" + params["user"] + "\"",
+				})
+				return errors.New("password authentication failed")
+			}
+		}
+
+		session.Database = params["database"]
+		session.User = params["user"]
+		session.ApplicationName = params["application_name"]
+		session.SessionToken = params[BEMIDB_STARTUP_PARAM_SESSION_TOKEN]
+		session.Register()
+
 		server.writeMessages(
 			&pgproto3.AuthenticationOk{},
 			&pgproto3.ParameterStatus{Name: "client_encoding", Value: PG_ENCODING},
 			&pgproto3.ParameterStatus{Name: "server_version", Value: PG_VERSION},
-			&pgproto3.ReadyForQuery{TxStatus: PG_TX_STATUS_IDLE},
+			&pgproto3.BackendKeyData{ProcessID: session.ProcessId(), SecretKey: session.SecretKey},
+			server.readyForQuery(),
 		)
 		return nil
+	case *pgproto3.CancelRequest:
+		// Sent over a new connection without any response, the client can't tell whether the query was canceled
+		if !CancelSessionQuery(startupMessage.ProcessID, startupMessage.SecretKey) {
+			common.LogDebug(server.config.CommonConfig, "BemiDB: ignoring cancel request for unknown process ID", startupMessage.ProcessID)
+		}
+		return errCancelRequest
 	case *pgproto3.SSLRequest:
-		_, err = (*server.conn).Write([]byte("N"))
+		if server.sslRequested {
+			server.writeError(&PgError{Code: PG_ERROR_CODE_PROTOCOL_VIOLATION, Message: "duplicate SSL negotiation request"})
+			return errors.New("duplicate SSL negotiation request")
+		}
+		server.sslRequested = true
+
+		if server.config.TlsConfig == nil {
+			_, err = (*server.conn).Write([]byte("N"))
+			if err != nil {
+				return err
+			}
+			return server.handleStartup(session) // self-recursion
+		}
+
+		_, err = (*server.conn).Write([]byte("S"))
 		if err != nil {
 			return err
 		}
-		server.handleStartup()
-		return nil
+		err = server.upgradeToTls()
+		if err != nil {
+			return err
+		}
+		return server.handleStartup(session) // self-recursion
 	default:
 		return errors.New("unknown startup message")
 	}
 }
+
+// Returns the method of the first matching HBA rule, rejects the connection if it's "reject" or none of the rules matches
+func (server *PostgresServer) checkHbaRules(session *Session, database string, user string) (string, error) {
+	tlsEnabled := server.tlsEnabled()
+	rule, ok := server.config.HbaRuleFor((*server.conn).RemoteAddr(), tlsEnabled, database, user)
+	if ok && rule.Method != HBA_METHOD_REJECT {
+		return rule.Method, nil
+	}
+
+	host := session.ClientAddr
+	if host == "" {
+		host = "[local]"
+	}
+	encryption := "no encryption"
+	if tlsEnabled {
+		encryption = "SSL encryption"
+	}
+	message := fmt.Sprintf(`no pg_hba.conf entry for host "%s", user "%s", database "%s", %s`, host, user, database, encryption)
+	if ok {
+		message = fmt.Sprintf(`pg_hba.conf rejects connection for host "%s", user "%s", database "%s", %s`, host, user, database, encryption)
+	}
+	server.writeError(&PgError{Code: PG_ERROR_CODE_INVALID_AUTHORIZATION, Message: message})
+	return "", errors.New(message)
+}
+
+// AuthenticationSASL -> SASLInitialResponse -> AuthenticationSASLContinue -> SASLResponse -> AuthenticationSASLFinal
+func (server *PostgresServer) authenticateWithScram(encryptedPassword string) error {
+	authenticator, err := NewScramAuthenticator(encryptedPassword)
+	if err != nil {
+		return err
+	}
+
+	server.writeMessages(&pgproto3.AuthenticationSASL{AuthMechanisms: []string{SCRAM_SHA_256_MECHANISM}})
+	err = server.backend.SetAuthType(pgproto3.AuthTypeSASL)
+	if err != nil {
+		return err
+	}
+	message, err := server.backend.Receive()
+	if err != nil {
+		return err
+	}
+	initialResponse, ok := message.(*pgproto3.SASLInitialResponse)
+	if !ok {
+		return fmt.Errorf("expected SASLInitialResponse, got %T", message)
+	}
+	if initialResponse.AuthMechanism != SCRAM_SHA_256_MECHANISM {
+		return errors.New("unsupported SASL mechanism: " + initialResponse.AuthMechanism)
+	}
+
+	serverFirstMessage, err := authenticator.ServerFirstMessage(string(initialResponse.Data))
+	if err != nil {
+		return err
+	}
+	server.writeMessages(&pgproto3.AuthenticationSASLContinue{Data: []byte(serverFirstMessage)})
+	err = server.backend.SetAuthType(pgproto3.AuthTypeSASLContinue)
+	if err != nil {
+		return err
+	}
+	message, err = server.backend.Receive()
+	if err != nil {
+		return err
+	}
+	response, ok := message.(*pgproto3.SASLResponse)
+	if !ok {
+		return fmt.Errorf("expected SASLResponse, got %T", message)
+	}
+
+	serverFinalMessage, err := authenticator.ServerFinalMessage(string(response.Data))
+	if err != nil {
+		return err
+	}
+	server.writeMessages(&pgproto3.AuthenticationSASLFinal{Data: []byte(serverFinalMessage)})
+	return nil
+}
+
+func (server *PostgresServer) tlsEnabled() bool {
+	_, ok := (*server.conn).(*tls.Conn)
+	return ok
+}
+
+// Unix socket connections are local and don't need TLS
+func (server *PostgresServer) tcpConnection() bool {
+	_, ok := (*server.conn).RemoteAddr().(*net.TCPAddr)
+	return ok
+}
+
+// Wraps the connection with TLS after accepting SSLRequest, the client starts the TLS handshake right away
+func (server *PostgresServer) upgradeToTls() error {
+	tlsConn := tls.Server(*server.conn, server.config.TlsConfig)
+	err := tlsConn.Handshake()
+	if err != nil {
+		return fmt.Errorf("couldn't complete TLS handshake: %w", err)
+	}
+
+	*server.conn = tlsConn
+	server.backend = pgproto3.NewBackend(tlsConn, tlsConn)
+	return nil
+}
@@ -0,0 +1,397 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgproto3"
+
+	"github.com/BemiHQ/BemiDB/src/common"
+)
+
+func TestRemoveStaleUnixSocket(t *testing.T) {
+	t.Run("Removes a socket left behind by a stopped server", func(t *testing.T) {
+		socketPath := filepath.Join(t.TempDir(), ".s.PGSQL.54321")
+		listener, err := net.Listen("unix", socketPath)
+		testNoError(t, err)
+		listener.(*net.UnixListener).SetUnlinkOnClose(false)
+		listener.Close()
+
+		err = removeStaleUnixSocket(socketPath)
+
+		testNoError(t, err)
+		if _, err := os.Lstat(socketPath); !os.IsNotExist(err) {
+			t.Errorf("Expected the stale socket to be removed, got %v", err)
+		}
+	})
+
+	t.Run("Keeps the socket of a running server", func(t *testing.T) {
+		socketPath := filepath.Join(t.TempDir(), ".s.PGSQL.54321")
+		listener, err := net.Listen("unix", socketPath)
+		testNoError(t, err)
+		defer listener.Close()
+
+		err = removeStaleUnixSocket(socketPath)
+
+		if err == nil {
+			t.Errorf("Expected an error for a socket in use")
+		}
+		if _, err := os.Lstat(socketPath); err != nil {
+			t.Errorf("Expected the socket to be kept, got %v", err)
+		}
+	})
+
+	t.Run("Keeps a file that isn't a socket", func(t *testing.T) {
+		socketPath := filepath.Join(t.TempDir(), ".s.PGSQL.54321")
+		testNoError(t, os.WriteFile(socketPath, []byte("data"), 0600))
+
+		err := removeStaleUnixSocket(socketPath)
+
+		if err == nil {
+			t.Errorf("Expected an error for a regular file")
+		}
+		if _, err := os.Lstat(socketPath); err != nil {
+			t.Errorf("Expected the file to be kept, got %v", err)
+		}
+	})
+
+	t.Run("Ignores a missing socket", func(t *testing.T) {
+		err := removeStaleUnixSocket(filepath.Join(t.TempDir(), ".s.PGSQL.54321"))
+
+		testNoError(t, err)
+	})
+}
+
+func TestNewUnixListener(t *testing.T) {
+	t.Run("Listens on the Postgres socket path with the configured mode", func(t *testing.T) {
+		config := *loadTestConfig()
+		config.UnixSocketDir = t.TempDir()
+		config.UnixSocketMode = 0770
+
+		listener := NewUnixListener(&config)
+		defer listener.Close()
+
+		fileInfo, err := os.Stat(filepath.Join(config.UnixSocketDir, ".s.PGSQL."+config.Port))
+		testNoError(t, err)
+		if fileInfo.Mode().Perm() != 0770 {
+			t.Errorf("Expected the socket mode to be 0770, got %o", fileInfo.Mode().Perm())
+		}
+	})
+
+	t.Run("Returns nil without a socket directory", func(t *testing.T) {
+		config := *loadTestConfig()
+		config.UnixSocketDir = ""
+
+		if listener := NewUnixListener(&config); listener != nil {
+			t.Errorf("Expected no listener, got %v", listener.Addr())
+		}
+	})
+}
+
+func TestWithPanicRecovery(t *testing.T) {
+	t.Run("Returns an error for a failing query instead of exiting the process", func(t *testing.T) {
+		common.PanicInsteadOfExit = true
+		defer func() { common.PanicInsteadOfExit = false }()
+		config := loadTestConfig()
+		server := &PostgresServer{config: config}
+
+		err := server.withPanicRecovery("SELECT 1", func() error {
+			common.PanicIfError(config.CommonConfig, errors.New("connection refused"))
+			return nil
+		})
+
+		if err == nil || err.Error() != "internal error: connection refused" {
+			t.Errorf("Expected an internal error, got %v", err)
+		}
+	})
+}
+
+func TestHandleStartupWithTls(t *testing.T) {
+	t.Run("Upgrades the connection to TLS after SSLRequest", func(t *testing.T) {
+		config := testTlsConfig(t)
+		config.TlsRequired = true
+		clientConn, startupErr := testStartupConn(t, config)
+
+		frontend := testRequestTls(t, clientConn)
+		frontend.Send(&pgproto3.StartupMessage{ProtocolVersion: pgproto3.ProtocolVersionNumber, Parameters: map[string]string{"user": "user", "database": config.Database}})
+		testNoError(t, frontend.Flush())
+
+		message, err := frontend.Receive()
+		testNoError(t, err)
+		if _, ok := message.(*pgproto3.AuthenticationOk); !ok {
+			t.Errorf("Expected AuthenticationOk, got %#v", message)
+		}
+		testNoError(t, <-startupErr)
+	})
+
+	t.Run("Rejects a second SSLRequest inside TLS", func(t *testing.T) {
+		clientConn, startupErr := testStartupConn(t, testTlsConfig(t))
+
+		frontend := testRequestTls(t, clientConn)
+		frontend.Send(&pgproto3.SSLRequest{})
+		testNoError(t, frontend.Flush())
+
+		testStartupError(t, frontend, PG_ERROR_CODE_PROTOCOL_VIOLATION, "duplicate SSL negotiation request")
+		if err := <-startupErr; err == nil {
+			t.Errorf("Expected the startup to fail")
+		}
+	})
+
+	t.Run("Rejects a second SSLRequest after declining TLS", func(t *testing.T) {
+		config := *loadTestConfig()
+		config.TlsConfig = nil
+		clientConn, startupErr := testStartupConn(t, &config)
+
+		frontend := pgproto3.NewFrontend(clientConn, clientConn)
+		frontend.Send(&pgproto3.SSLRequest{})
+		testNoError(t, frontend.Flush())
+		response := make([]byte, 1)
+		_, err := clientConn.Read(response)
+		testNoError(t, err)
+		if string(response) != "N" {
+			t.Errorf("Expected the server to decline TLS, got %s", response)
+		}
+		frontend.Send(&pgproto3.SSLRequest{})
+		testNoError(t, frontend.Flush())
+
+		testStartupError(t, frontend, PG_ERROR_CODE_PROTOCOL_VIOLATION, "duplicate SSL negotiation request")
+		if err := <-startupErr; err == nil {
+			t.Errorf("Expected the startup to fail")
+		}
+	})
+
+	t.Run("Rejects TCP connections without TLS if TLS is required", func(t *testing.T) {
+		config := testTlsConfig(t)
+		config.TlsRequired = true
+		clientConn, startupErr := testStartupConn(t, config)
+
+		frontend := pgproto3.NewFrontend(clientConn, clientConn)
+		frontend.Send(&pgproto3.StartupMessage{ProtocolVersion: pgproto3.ProtocolVersionNumber, Parameters: map[string]string{"user": "user", "database": config.Database}})
+		testNoError(t, frontend.Flush())
+
+		testStartupError(t, frontend, PG_ERROR_CODE_INVALID_AUTHORIZATION, "SSL connection is required")
+		if err := <-startupErr; err == nil {
+			t.Errorf("Expected the startup to fail")
+		}
+	})
+}
+
+func TestRunWithTls(t *testing.T) {
+	queryHandler := initQueryHandler()
+	defer queryHandler.ServerDuckdbClient.Close()
+
+	t.Run("Receives COPY FROM STDIN data over TLS", func(t *testing.T) {
+		_, err := queryHandler.HandleSimpleQuery("CREATE TABLE postgres.copied_rows AS SELECT 1 AS id, 'a' AS name")
+		testNoError(t, err)
+		defer queryHandler.HandleSimpleQuery("DROP TABLE postgres.copied_rows")
+		config := testTlsConfig(t)
+		clientConn := testRunConn(t, config, queryHandler)
+		frontend := testRequestTls(t, clientConn)
+		frontend.Send(&pgproto3.StartupMessage{ProtocolVersion: pgproto3.ProtocolVersionNumber, Parameters: map[string]string{"user": "user", "database": config.Database}})
+		testNoError(t, frontend.Flush())
+		testReceiveUntilReadyForQuery(t, frontend)
+
+		frontend.Send(&pgproto3.Query{String: "COPY postgres.copied_rows FROM STDIN"})
+		testNoError(t, frontend.Flush())
+		message, err := frontend.Receive()
+		testNoError(t, err)
+		if _, ok := message.(*pgproto3.CopyInResponse); !ok {
+			t.Fatalf("Expected CopyInResponse, got %#v", message)
+		}
+		frontend.Send(&pgproto3.CopyData{Data: []byte("2\tb\n")})
+		frontend.Send(&pgproto3.CopyDone{})
+		testNoError(t, frontend.Flush())
+
+		message, err = frontend.Receive()
+
+		testNoError(t, err)
+		if commandComplete, ok := message.(*pgproto3.CommandComplete); !ok || string(commandComplete.CommandTag) != "COPY 1" {
+			t.Errorf("Expected CommandComplete with COPY 1, got %#v", message)
+		}
+		testReceiveUntilReadyForQuery(t, frontend)
+	})
+}
+
+func TestReceiveBeforeTimeout(t *testing.T) {
+	t.Run("Receives the next message before the idle timeout", func(t *testing.T) {
+		config := *loadTestConfig()
+		config.IdleTimeoutSeconds = 1
+		server, frontend := testTimeoutServer(t, &config)
+
+		frontend.Send(&pgproto3.Query{String: "SELECT 1"})
+		testNoError(t, frontend.Flush())
+		message, err := server.receiveBeforeTimeout()
+
+		testNoError(t, err)
+		if query, ok := message.(*pgproto3.Query); !ok || query.String != "SELECT 1" {
+			t.Errorf("Expected the query, got %#v", message)
+		}
+	})
+
+	t.Run("Closes a connection that stays idle longer than the idle timeout", func(t *testing.T) {
+		config := *loadTestConfig()
+		config.IdleTimeoutSeconds = 1
+		server, frontend := testTimeoutServer(t, &config)
+
+		receiveErr := make(chan error, 1)
+		go func() {
+			_, err := server.receiveBeforeTimeout()
+			receiveErr <- err
+		}()
+
+		testStartupError(t, frontend, PG_ERROR_CODE_IDLE_SESSION_TIMEOUT, "terminating connection due to idle-session timeout")
+		if err := <-receiveErr; err == nil {
+			t.Errorf("Expected the receive to fail")
+		}
+	})
+
+	t.Run("Closes a connection past its max age before the next message", func(t *testing.T) {
+		config := *loadTestConfig()
+		config.IdleTimeoutSeconds = 60
+		config.MaxSessionAgeSeconds = 1
+		server, frontend := testTimeoutServer(t, &config)
+		server.connectedAt = time.Now().Add(-2 * time.Second)
+
+		receiveErr := make(chan error, 1)
+		go func() {
+			_, err := server.receiveBeforeTimeout()
+			receiveErr <- err
+		}()
+
+		testStartupError(t, frontend, PG_ERROR_CODE_ADMIN_SHUTDOWN, "terminating connection due to max session age")
+		if err := <-receiveErr; err == nil {
+			t.Errorf("Expected the receive to fail")
+		}
+	})
+
+	t.Run("Closes a connection that stays idle in the middle of an extended query", func(t *testing.T) {
+		config := *loadTestConfig()
+		config.IdleTimeoutSeconds = 1
+		server, frontend := testTimeoutServer(t, &config)
+
+		extendedQueryErr := make(chan error, 1)
+		go func() {
+			extendedQueryErr <- server.handleExtendedQuery(nil, &pgproto3.Flush{})
+		}()
+
+		testStartupError(t, frontend, PG_ERROR_CODE_IDLE_SESSION_TIMEOUT, "terminating connection due to idle-session timeout")
+		if err := <-extendedQueryErr; err == nil {
+			t.Errorf("Expected the extended query to fail")
+		}
+	})
+}
+
+// Without a configured password, so that the startup completes without authentication
+func testTlsConfig(t *testing.T) *Config {
+	config := *loadTestConfig()
+	config.User = ""
+	config.EncryptedPassword = ""
+	config.Users = nil
+	config.HbaRules = nil
+	certificate, err := GenerateSelfSignedCertificate("127.0.0.1")
+	testNoError(t, err)
+	config.TlsConfig = &tls.Config{Certificates: []tls.Certificate{certificate}, MinVersion: tls.VersionTLS12}
+	return &config
+}
+
+// Runs the startup of a server connection accepted over TCP and returns the client connection
+func testStartupConn(t *testing.T, config *Config) (net.Conn, <-chan error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	testNoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	startupErr := make(chan error, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			startupErr <- err
+			return
+		}
+		server := NewPostgresServer(config, &conn)
+		startupErr <- server.handleStartup(NewSession())
+	}()
+
+	clientConn, err := net.Dial("tcp", listener.Addr().String())
+	testNoError(t, err)
+	t.Cleanup(func() { clientConn.Close() })
+	return clientConn, startupErr
+}
+
+// Returns a server connected to a client through an in-memory connection, as if it had just completed the startup
+func testTimeoutServer(t *testing.T, config *Config) (*PostgresServer, *pgproto3.Frontend) {
+	serverConn, clientConn := net.Pipe()
+	t.Cleanup(func() { clientConn.Close() })
+	server := NewPostgresServer(config, &serverConn)
+	t.Cleanup(func() { server.Close() })
+	server.connectedAt = time.Now()
+	return server, pgproto3.NewFrontend(clientConn, clientConn)
+}
+
+// Runs a server connection accepted over TCP with the query handler and returns the client connection
+func testRunConn(t *testing.T, config *Config, queryHandler *QueryHandler) net.Conn {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	testNoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		server := NewPostgresServer(config, &conn)
+		defer server.Close()
+		server.Run(queryHandler)
+	}()
+
+	clientConn, err := net.Dial("tcp", listener.Addr().String())
+	testNoError(t, err)
+	t.Cleanup(func() { clientConn.Close() })
+	return clientConn
+}
+
+// Skips the messages received before ReadyForQuery, e.g. ParameterStatus after the startup
+func testReceiveUntilReadyForQuery(t *testing.T, frontend *pgproto3.Frontend) {
+	for {
+		message, err := frontend.Receive()
+		if err != nil {
+			t.Fatalf("Expected ReadyForQuery, got %v", err)
+		}
+		switch message := message.(type) {
+		case *pgproto3.ErrorResponse:
+			t.Fatalf("Expected no error, got %s", message.Message)
+		case *pgproto3.ReadyForQuery:
+			return
+		}
+	}
+}
+
+func testRequestTls(t *testing.T, clientConn net.Conn) *pgproto3.Frontend {
+	frontend := pgproto3.NewFrontend(clientConn, clientConn)
+	frontend.Send(&pgproto3.SSLRequest{})
+	testNoError(t, frontend.Flush())
+
+	response := make([]byte, 1)
+	_, err := clientConn.Read(response)
+	testNoError(t, err)
+	if string(response) != "S" {
+		t.Fatalf("Expected the server to accept TLS, got %s", response)
+	}
+
+	tlsConn := tls.Client(clientConn, &tls.Config{InsecureSkipVerify: true})
+	testNoError(t, tlsConn.Handshake())
+	return pgproto3.NewFrontend(tlsConn, tlsConn)
+}
+
+func testStartupError(t *testing.T, frontend *pgproto3.Frontend, expectedCode string, expectedMessage string) {
+	message, err := frontend.Receive()
+	testNoError(t, err)
+	errorResponse, ok := message.(*pgproto3.ErrorResponse)
+	if !ok || errorResponse.Code != expectedCode || errorResponse.Message != expectedMessage {
+		t.Errorf("Expected the %s error '%s', got %#v", expectedCode, expectedMessage, message)
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/jackc/pgx/v5/pgproto3"
+
+	"github.com/BemiHQ/BemiDB/src/common"
+)
+
+// Runs the statements of a query in the session's transaction block or on a DuckDB connection checked out from the pool
+// until the execution is closed, and meters the object storage reads of the query in both the simple and extended protocols
+type QueryExecution struct {
+	queryHandler       *QueryHandler
+	outsideTransaction bool              // Runs on a pooled connection even in a transaction block, e.g. for a cursor WITH HOLD
+	pooledConn         *sql.Conn         // Checked out on the first statement outside of a transaction block
+	pooledSettings     map[string]string // Of the session applied to the pooled connection
+	statsRun           *QueryStatsRun
+	stats              QueryStats
+	budgetWarning      string
+	latencyExceeded    bool
+	releaseMemory      func() // Of the memory admission, held until the execution is closed
+	closed             bool
+}
+
+// Returns an error if the session's user has already reached the hard storage budget today
+func (queryHandler *QueryHandler) startQueryExecution(ctx context.Context) (*QueryExecution, error) {
+	return queryHandler.newQueryExecution(ctx, false)
+}
+
+// Runs on a pooled connection until the execution is closed, e.g. for a cursor kept open after the transaction block
+func (queryHandler *QueryHandler) startPooledQueryExecution(ctx context.Context) (*QueryExecution, error) {
+	return queryHandler.newQueryExecution(ctx, true)
+}
+
+func (queryHandler *QueryHandler) newQueryExecution(ctx context.Context, outsideTransaction bool) (*QueryExecution, error) {
+	session := queryHandler.QueryRemapper.Session
+	err := queryHandler.StorageBudgets.Check(session.User)
+	if err != nil {
+		return nil, err
+	}
+
+	execution := &QueryExecution{queryHandler: queryHandler, outsideTransaction: outsideTransaction}
+	if !session.QueryStatsEnabled && !queryHandler.Config.StorageAccessLog && !queryHandler.StorageBudgets.Enabled() && queryHandler.Config.StorageLatencyNoticeMs == 0 {
+		return execution, nil
+	}
+
+	// The DuckDB connections are tracked when the query runs on them, so queries answered without DuckDB don't check out a connection
+	execution.statsRun, err = queryHandler.QueryStatsTracker.Start(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return execution, nil
+}
+
+func (execution *QueryExecution) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	conn, appliedSettings, err := execution.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	common.LogDebug(execution.queryHandler.Config.CommonConfig, "Querying DuckDB:", query)
+	return execution.queryHandler.queryWithDuckdbSettings(ctx, conn, appliedSettings, query, args...)
+}
+
+// Blocks until the memory admission controller admits the query, which is released when the execution is closed
+func (execution *QueryExecution) AdmitMemory(ctx context.Context, query string) error {
+	releaseMemory, err := execution.queryHandler.MemoryAdmission.Admit(ctx, query)
+	if err != nil {
+		return err
+	}
+	if execution.releaseMemory != nil {
+		execution.releaseMemory()
+	}
+	execution.releaseMemory = releaseMemory
+	return nil
+}
+
+// Adds the table scans of the last statement, must be called after its rows are closed
+func (execution *QueryExecution) TrackProfile() {
+	if execution.statsRun != nil {
+		execution.statsRun.TrackProfile()
+	}
+}
+
+// Meters the object storage reads of the query after its rows are closed and returns the pooled connection
+func (execution *QueryExecution) Close() {
+	if execution.closed {
+		return
+	}
+	execution.closed = true
+
+	if execution.statsRun != nil {
+		execution.meter()
+		execution.statsRun.Close()
+	}
+	if execution.pooledConn != nil {
+		execution.queryHandler.resetDuckdbSettings(execution.pooledConn, execution.pooledSettings) // Before the connection goes back to the pool
+		execution.pooledConn.Close()
+	}
+	if execution.releaseMemory != nil {
+		execution.releaseMemory()
+	}
+}
+
+// NoticeResponses with the budget warning, the storage latency, and the query stats after the execution is closed
+func (execution *QueryExecution) Notices(rowCount int64) []pgproto3.Message {
+	if execution.statsRun == nil {
+		return nil
+	}
+
+	var messages []pgproto3.Message
+	if execution.budgetWarning != "" {
+		messages = append(messages, &pgproto3.NoticeResponse{
+			Severity:            "WARNING",
+			SeverityUnlocalized: "WARNING",
+			Code:                PG_ERROR_CODE_WARNING,
+			Message:             execution.budgetWarning,
+		})
+	}
+	if execution.latencyExceeded {
+		messages = append(messages, &pgproto3.NoticeResponse{
+			Severity:            "NOTICE",
+			SeverityUnlocalized: "NOTICE",
+			Code:                PG_ERROR_CODE_SUCCESSFUL_COMPLETION,
+			Message:             execution.stats.StorageLatencyMessage(),
+			Hint:                STORAGE_LATENCY_NOTICE_HINT,
+		})
+	}
+	if execution.queryHandler.QueryRemapper.Session.QueryStatsEnabled {
+		stats := execution.stats
+		stats.RowCount = rowCount
+		messages = append(messages, &pgproto3.NoticeResponse{
+			Severity:            "INFO",
+			SeverityUnlocalized: "INFO",
+			Code:                PG_ERROR_CODE_SUCCESSFUL_COMPLETION,
+			Message:             "Query stats: " + stats.String(),
+		})
+	}
+	return messages
+}
+
+// The session's transaction, including one started earlier in the query, or the pooled connection with the settings applied to it
+func (execution *QueryExecution) conn(ctx context.Context) (duckdbConn, map[string]string, error) {
+	if transaction := execution.queryHandler.QueryRemapper.Session.Transaction; !execution.outsideTransaction && transaction != nil && transaction.Tx != nil {
+		conn, err := execution.track(ctx, transaction.Tx)
+		return conn, transaction.DuckdbSettings, err
+	}
+
+	if execution.pooledConn == nil {
+		pooledConn, err := execution.queryHandler.ServerDuckdbClient.Db.Conn(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+		execution.pooledConn = pooledConn
+		execution.pooledSettings = make(map[string]string)
+	}
+	conn, err := execution.track(ctx, execution.pooledConn)
+	return conn, execution.pooledSettings, err
+}
+
+func (execution *QueryExecution) track(ctx context.Context, conn duckdbConn) (duckdbConn, error) {
+	if execution.statsRun != nil {
+		err := execution.statsRun.Track(ctx, conn)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+func (execution *QueryExecution) meter() {
+	queryHandler := execution.queryHandler
+	session := queryHandler.QueryRemapper.Session
+
+	stats, err := execution.statsRun.Stats(context.Background(), 0) // The session context may already be canceled
+	if err != nil {
+		common.LogWarn(queryHandler.Config.CommonConfig, "Couldn't get storage stats:", err)
+	}
+	execution.stats = stats
+
+	if queryHandler.Config.StorageAccessLog && stats.StorageRequestCount > 0 {
+		common.LogInfo(queryHandler.Config.CommonConfig, "Storage access:", session.Labels(), "bytes="+common.Int64ToString(stats.StorageBytes), "requests="+common.Int64ToString(stats.StorageRequestCount))
+	}
+	if stats.StorageTracked {
+		queryHandler.ConnectionLog.TrackStorageReads(session.Database, stats.StorageBytes)
+	}
+	if queryHandler.StorageBudgets.Enabled() && stats.StorageTracked {
+		execution.budgetWarning = queryHandler.StorageBudgets.Add(session.User, stats.StorageBytes)
+		if execution.budgetWarning != "" {
+			common.LogWarn(queryHandler.Config.CommonConfig, "Storage budget:", execution.budgetWarning)
+		}
+	}
+	if stats.StorageScanDuration > 0 {
+		execution.latencyExceeded = stats.StorageLatencyExceeded(queryHandler.Config.StorageLatencyNoticeMs)
+		queryHandler.ConnectionLog.TrackStorageScan(session, stats.StorageScanDuration, execution.latencyExceeded)
+		if execution.latencyExceeded {
+			common.LogWarn(queryHandler.Config.CommonConfig, "Storage latency:", session.Labels(), execution.stats.StorageLatencyMessage())
+		}
+	}
+}
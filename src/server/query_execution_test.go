@@ -0,0 +1,36 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgproto3"
+)
+
+func TestQueryExecutionNotices(t *testing.T) {
+	t.Run("Returns a storage latency notice with a hint", func(t *testing.T) {
+		execution := &QueryExecution{
+			queryHandler:    &QueryHandler{QueryRemapper: &QueryRemapper{Session: NewSession()}},
+			statsRun:        &QueryStatsRun{},
+			stats:           QueryStats{Duration: 5 * time.Second, StorageRequestCount: 12, StorageBytes: 104857600, StorageScanDuration: 4200 * time.Millisecond},
+			latencyExceeded: true,
+		}
+
+		messages := execution.Notices(0)
+
+		testMessageTypes(t, messages, []pgproto3.Message{&pgproto3.NoticeResponse{}})
+		notice := messages[0].(*pgproto3.NoticeResponse)
+		expectedMessage := "Query spent 4.200 s of 5.000 s waiting on object storage (12 requests, 104857600 bytes)"
+		if notice.Severity != "NOTICE" || notice.Code != PG_ERROR_CODE_SUCCESSFUL_COMPLETION || notice.Message != expectedMessage || notice.Hint != STORAGE_LATENCY_NOTICE_HINT {
+			t.Errorf("Expected a storage latency notice, got %+v", notice)
+		}
+	})
+
+	t.Run("Returns no notices for queries that weren't tracked", func(t *testing.T) {
+		execution := &QueryExecution{latencyExceeded: true}
+
+		if messages := execution.Notices(0); len(messages) != 0 {
+			t.Errorf("Expected no notices, got %v", messages)
+		}
+	})
+}
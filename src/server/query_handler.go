@@ -1,28 +1,86 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
 	"encoding/binary"
 	"fmt"
+	"io"
+	"maps"
+	"math"
+	"os"
+	"slices"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgproto3"
 	"github.com/jackc/pgx/v5/pgtype"
+	duckdb "github.com/marcboeker/go-duckdb/v2"
+	pgQuery "github.com/pganalyze/pg_query_go/v6"
 
 	"github.com/BemiHQ/BemiDB/src/common"
 )
 
 const (
 	FALLBACK_SQL_QUERY = "SELECT 1"
+
+	PG_BINARY_EPOCH_UNIX_SECONDS = 946684800 // 2000-01-01, binary dates and timestamps are relative to it
+
+	COPY_STREAM_BATCH_ROW_COUNT = 1000
+
+	GLOBAL_SETTINGS_LOCK_RETRY_INTERVAL = 10 * time.Millisecond
+
+	// DECLARE options (CURSOR_OPT_* in Postgres)
+	CURSOR_OPT_BINARY = 0x0001
+	CURSOR_OPT_HOLD   = 0x0020
 )
 
+// Types of parameters inferred by DuckDB -> Postgres OIDs in ParameterDescription
+var DUCKDB_PARAMETER_TYPE_OIDS = map[duckdb.Type]uint32{
+	duckdb.TYPE_BOOLEAN:      pgtype.BoolOID,
+	duckdb.TYPE_TINYINT:      pgtype.Int2OID,
+	duckdb.TYPE_SMALLINT:     pgtype.Int2OID,
+	duckdb.TYPE_INTEGER:      pgtype.Int4OID,
+	duckdb.TYPE_BIGINT:       pgtype.Int8OID,
+	duckdb.TYPE_HUGEINT:      pgtype.NumericOID,
+	duckdb.TYPE_DECIMAL:      pgtype.NumericOID,
+	duckdb.TYPE_FLOAT:        pgtype.Float4OID,
+	duckdb.TYPE_DOUBLE:       pgtype.Float8OID,
+	duckdb.TYPE_VARCHAR:      pgtype.TextOID,
+	duckdb.TYPE_BLOB:         pgtype.ByteaOID,
+	duckdb.TYPE_DATE:         pgtype.DateOID,
+	duckdb.TYPE_TIME:         pgtype.TimeOID,
+	duckdb.TYPE_TIMESTAMP:    pgtype.TimestampOID,
+	duckdb.TYPE_TIMESTAMP_TZ: pgtype.TimestamptzOID,
+	duckdb.TYPE_INTERVAL:     pgtype.IntervalOID,
+	duckdb.TYPE_UUID:         pgtype.UUIDOID,
+}
+
 type QueryHandler struct {
-	Config             *Config
-	ServerDuckdbClient *common.DuckdbClient
-	QueryRemapper      *QueryRemapper
-	ResponseHandler    *ResponseHandler
+	Config              *Config
+	ServerDuckdbClient  *common.DuckdbClient
+	QueryRemapper       *QueryRemapper
+	ResponseHandler     *ResponseHandler
+	LockTracker         *LockTracker
+	QueryStatsTracker   *QueryStatsTracker
+	StorageBudgets      *StorageBudgetTracker
+	MemoryAdmission     *MemoryAdmissionController
+	SessionCheckpoints  *SessionCheckpoints
+	ConnectionLog       *ConnectionLog
+	QueryHooks          *QueryHooks
+	GlobalSettingsMutex *sync.RWMutex                            // Held exclusively while a query runs with DuckDB settings that apply to all connections
+	MessageWriter       func(messages ...pgproto3.Message)       // nilable, sends messages before the query is complete
+	MessageReader       func() (pgproto3.FrontendMessage, error) // nilable, receives messages during the query (COPY FROM STDIN)
+}
+
+// *sql.Conn or *sql.Tx
+type duckdbConn interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
 }
 
 type PreparedStatement struct {
@@ -31,54 +89,174 @@ type PreparedStatement struct {
 	OriginalQuery string
 	Query         string
 	Statement     *sql.Stmt
-	ParameterOIDs []uint32
+	ParameterOIDs []uint32 // Sent by the client or inferred by DuckDB for unspecified parameters
 
 	// Bind
-	Bound     bool
-	Variables []interface{}
-	Portal    string
+	Bound             bool
+	Variables         []interface{}
+	Portal            string
+	ResultFormatCodes []int16 // Empty for text, one code for all columns, or a code per column
+	Replanned         bool    // Statement was prepared for the portal with the bound values inlined (SET bemidb.replan_on_bind = on)
 
 	// Describe
 	Described bool
 
 	// Describe/Execute
-	Rows *sql.Rows
+	Rows          *sql.Rows
+	CancelTimeout context.CancelFunc // Releases the statement_timeout deadline of the rows after they are closed
+	Execution     *QueryExecution    // Meters the rows and returns their pooled connection after they are closed
+
+	// Execute with MaxRows
+	Suspended bool // Rows are kept open to resume the portal in the next Execute
+
+	// Execute with query hooks and query stats
+	Access       *QueryAccess // nil if the query hooks are disabled or the query doesn't read tables
+	ReturnedRows int64        // Rows returned by the Execute messages of the portal so far
 }
 
 func NewQueryHandler(config *Config, serverDuckdbClient *common.DuckdbClient) *QueryHandler {
 	storageS3 := common.NewStorageS3(config.CommonConfig)
 	icebergCatalog := common.NewIcebergCatalog(config.CommonConfig)
 	icebergReader := NewIcebergReader(config, icebergCatalog)
-	icebergWriter := NewIcebergWriter(config, storageS3, serverDuckdbClient, icebergCatalog)
+	lockTracker := NewLockTracker()
+	icebergWriter := NewIcebergWriter(config, storageS3, serverDuckdbClient, icebergCatalog, lockTracker)
+	connectionLog := NewConnectionLog()
 
 	queryHandler := &QueryHandler{
-		Config:             config,
-		ServerDuckdbClient: serverDuckdbClient,
-		QueryRemapper:      NewQueryRemapper(config, icebergReader, icebergWriter, serverDuckdbClient),
-		ResponseHandler:    NewResponseHandler(config),
+		Config:              config,
+		ServerDuckdbClient:  serverDuckdbClient,
+		QueryRemapper:       NewQueryRemapper(config, icebergReader, icebergWriter, connectionLog, serverDuckdbClient),
+		ResponseHandler:     NewResponseHandler(config),
+		LockTracker:         lockTracker,
+		QueryStatsTracker:   NewQueryStatsTracker(config, serverDuckdbClient),
+		StorageBudgets:      NewStorageBudgetTracker(config),
+		MemoryAdmission:     NewMemoryAdmissionController(config, serverDuckdbClient),
+		SessionCheckpoints:  NewSessionCheckpoints(config),
+		ConnectionLog:       connectionLog,
+		QueryHooks:          NewQueryHooks(config),
+		GlobalSettingsMutex: &sync.RWMutex{},
 	}
 
 	return queryHandler
 }
 
+// Returns a handler for a new connection with its own session state
+func (queryHandler *QueryHandler) WithNewSession() *QueryHandler {
+	sessionQueryHandler := *queryHandler
+	sessionQueryHandler.QueryRemapper = queryHandler.QueryRemapper.WithSession(NewSession())
+	return &sessionQueryHandler
+}
+
+// Prepares the statements saved by a disconnected session with the same session token again
+func (queryHandler *QueryHandler) RestoreSessionCheckpoint() {
+	session := queryHandler.QueryRemapper.Session
+	checkpoint, ok := queryHandler.SessionCheckpoints.Take(session)
+	if !ok {
+		return
+	}
+
+	for _, parseMessage := range checkpoint.ExtendedStatements {
+		_, _, err := queryHandler.HandleParseQuery(parseMessage)
+		if err != nil {
+			common.LogWarn(queryHandler.Config.CommonConfig, "Couldn't restore prepared statement", parseMessage.Name+":", err)
+		}
+	}
+	for name, preparedStatement := range checkpoint.PreparedStatements {
+		session.PreparedStatements[name] = preparedStatement
+	}
+	common.LogDebug(queryHandler.Config.CommonConfig, "Restored", len(checkpoint.ExtendedStatements)+len(checkpoint.PreparedStatements), "prepared statements for session", session.Id)
+}
+
 func (queryHandler *QueryHandler) HandleSimpleQuery(originalQuery string) ([]pgproto3.Message, error) {
+	lockPid := queryHandler.LockTracker.AcquireQueryLock()
+	defer queryHandler.LockTracker.Release(lockPid)
+
+	session := queryHandler.QueryRemapper.Session
+	session.NextQueryId()
+	session.LogTrace(queryHandler.Config.CommonConfig, "Received query:", originalQuery)
+
+	defer queryHandler.QueryRemapper.RemoveUncreatedTempTables()
 	queryStatements, originalQueryStatements, err := queryHandler.QueryRemapper.ParseAndRemapQuery(originalQuery)
 	if err != nil {
 		return nil, err
 	}
+	session.LogTrace(queryHandler.Config.CommonConfig, "Remapped query:", strings.Join(queryStatements, "; "))
 	if len(queryStatements) == 0 {
 		return []pgproto3.Message{&pgproto3.EmptyQueryResponse{}}, nil
 	}
 
 	var queriesMessages []pgproto3.Message
 
+	ctx, cancelTimeout := queryHandler.statementContext() // Shared by all statements to cancel the rest of them too
+	defer cancelTimeout()
+
+	access, err := queryHandler.queryAccess(originalQuery)
+	if err != nil {
+		return nil, err
+	}
+	if access != nil {
+		err = queryHandler.QueryHooks.BeforeQuery(ctx, *access)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	execution, err := queryHandler.startQueryExecution(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer execution.Close()
+
+	err = execution.AdmitMemory(ctx, strings.Join(queryStatements, "; "))
+	if err != nil {
+		return nil, err
+	}
+
 	for i, queryStatement := range queryStatements {
-		rows, err := queryHandler.ServerDuckdbClient.QueryContext(context.Background(), queryStatement)
+		if isTransactionCommand(originalQueryStatements[i]) {
+			transactionMessages, err := queryHandler.handleTransactionCommand(originalQueryStatements[i])
+			if err != nil {
+				return nil, err
+			}
+			queriesMessages = append(queriesMessages, transactionMessages...)
+			continue
+		}
+		if isCursorCommand(originalQueryStatements[i]) {
+			cursorMessages, err := queryHandler.handleCursorCommand(originalQueryStatements[i], queryStatement, nil, nil, true)
+			if err != nil {
+				return nil, err
+			}
+			queriesMessages = append(queriesMessages, cursorMessages...)
+			continue
+		}
+		if icebergSchemaTable, columnNames := queryHandler.QueryRemapper.IcebergInsertTable(originalQueryStatements[i]); icebergSchemaTable != nil {
+			insertMessages, err := queryHandler.insertIntoIcebergTable(*icebergSchemaTable, columnNames, queryStatement, nil)
+			if err != nil {
+				return nil, err
+			}
+			queriesMessages = append(queriesMessages, insertMessages...)
+			continue
+		}
+		if icebergSchemaTable, command := queryHandler.QueryRemapper.IcebergChangeTable(originalQueryStatements[i]); icebergSchemaTable != nil {
+			changeMessages, err := queryHandler.changeIcebergTable(*icebergSchemaTable, command, queryStatement, nil)
+			if err != nil {
+				return nil, err
+			}
+			queriesMessages = append(queriesMessages, changeMessages...)
+			continue
+		}
+
+		if session.Transaction != nil && isTransactionChangeCommand(originalQueryStatements[i]) {
+			session.Transaction.ChangeCount++
+		}
+
+		rows, err := execution.QueryContext(ctx, queryStatement)
 		if err != nil {
 			errorMessage := err.Error()
 			if errorMessage == "Binder Error: UNNEST requires a single list as input" {
 				// https://github.com/duckdbClient/duckdb/issues/11693
 				common.LogWarn(queryHandler.Config.CommonConfig, "Couldn't handle query via DuckDB:", queryStatement+"\n"+err.Error())
+				queriesMessages = append(queriesMessages, session.TakeNotices()...)    // Before the fallback query starts with its own notices
 				queriesMsgs, err := queryHandler.HandleSimpleQuery(FALLBACK_SQL_QUERY) // self-recursion
 				if err != nil {
 					return nil, err
@@ -90,62 +268,243 @@ func (queryHandler *QueryHandler) HandleSimpleQuery(originalQuery string) ([]pgp
 			}
 		}
 		defer rows.Close()
+		queryHandler.QueryRemapper.TrackCreatedTempTable(originalQueryStatements[i])
+
+		if strings.HasPrefix(strings.ToUpper(originalQueryStatements[i]), "COPY ") {
+			queriesMessages, err = queryHandler.rowsToCopyMessages(rows, originalQueryStatements[i], queriesMessages)
+			if err != nil {
+				return nil, err
+			}
+			rows.Close() // A later COMMIT waits for the rows of its transaction to be closed
+			execution.TrackProfile()
+			continue
+		}
 
 		var queryMessages []pgproto3.Message
-		descriptionMessages, err := queryHandler.rowsToDescriptionMessages(rows, originalQueryStatements[i])
+		descriptionMessages, err := queryHandler.rowsToDescriptionMessages(rows, originalQueryStatements[i], nil)
 		if err != nil {
 			return nil, err
 		}
 		queryMessages = append(queryMessages, descriptionMessages...)
-		dataMessages, err := queryHandler.rowsToDataMessages(rows, originalQueryStatements[i])
+		dataMessages, err := queryHandler.rowsToDataMessages(rows, originalQueryStatements[i], nil)
 		if err != nil {
 			return nil, err
 		}
 		queryMessages = append(queryMessages, dataMessages...)
+		rows.Close()
+		execution.TrackProfile()
 
 		queriesMessages = append(queriesMessages, queryMessages...)
 	}
 
-	return queriesMessages, nil
+	// Collects the stats of all statements in the query, the rows are already closed after reading them
+	execution.Close()
+	queriesMessages = append(queriesMessages, execution.Notices(dataRowCount(queriesMessages))...)
+
+	if access != nil {
+		queryHandler.QueryHooks.AfterQuery(*access, dataRowCount(queriesMessages))
+	}
+
+	return append(session.TakeNotices(), queriesMessages...), nil
+}
+
+// Runs the query with the session's DuckDB settings. Settings DuckDB applies to all connections are set only while the query runs,
+// after waiting for other queries without blocking new ones, since only the session with the settings should wait
+func (queryHandler *QueryHandler) queryWithDuckdbSettings(ctx context.Context, conn duckdbConn, appliedSettings map[string]string, query string, args ...any) (*sql.Rows, error) {
+	localSettings := maps.Clone(queryHandler.QueryRemapper.Session.DuckdbSettings)
+	globalSettings := make(map[string]string)
+	for _, name := range DUCKDB_GLOBAL_SETTINGS {
+		if value, ok := localSettings[name]; ok {
+			globalSettings[name] = value
+			delete(localSettings, name)
+		}
+	}
+
+	err := queryHandler.syncDuckdbSettings(ctx, conn, appliedSettings, localSettings)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(globalSettings) == 0 {
+		queryHandler.GlobalSettingsMutex.RLock()
+		defer queryHandler.GlobalSettingsMutex.RUnlock()
+		return conn.QueryContext(ctx, query, args...)
+	}
+
+	for !queryHandler.GlobalSettingsMutex.TryLock() {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(GLOBAL_SETTINGS_LOCK_RETRY_INTERVAL):
+		}
+	}
+	defer queryHandler.GlobalSettingsMutex.Unlock()
+	defer queryHandler.resetDuckdbSettings(conn, globalSettings)
+	err = queryHandler.applyDuckdbSettings(ctx, conn, globalSettings)
+	if err != nil {
+		return nil, err
+	}
+	return conn.QueryContext(ctx, query, args...)
+}
+
+// Sets the settings that changed since they were applied to the connection and resets the removed ones, e.g. after SET in the same query
+func (queryHandler *QueryHandler) syncDuckdbSettings(ctx context.Context, conn duckdbConn, appliedSettings map[string]string, duckdbSettings map[string]string) error {
+	for name := range appliedSettings {
+		if _, ok := duckdbSettings[name]; !ok {
+			_, err := conn.ExecContext(ctx, "RESET "+name)
+			if err != nil {
+				return err
+			}
+			delete(appliedSettings, name)
+		}
+	}
+	for name, value := range duckdbSettings {
+		if appliedValue, ok := appliedSettings[name]; !ok || appliedValue != value {
+			_, err := conn.ExecContext(ctx, "SET "+name+" = "+value)
+			if err != nil {
+				return err
+			}
+			appliedSettings[name] = value
+		}
+	}
+	return nil
+}
+
+// SET bemidb.join_order = off -> SET disabled_optimizers = 'join_order,build_side_probe_side'
+func (queryHandler *QueryHandler) applyDuckdbSettings(ctx context.Context, conn duckdbConn, duckdbSettings map[string]string) error {
+	for name, value := range duckdbSettings {
+		_, err := conn.ExecContext(ctx, "SET "+name+" = "+value)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (queryHandler *QueryHandler) resetDuckdbSettings(conn duckdbConn, duckdbSettings map[string]string) {
+	for name := range duckdbSettings {
+		_, err := conn.ExecContext(context.Background(), "RESET "+name)
+		if err != nil {
+			common.LogWarn(queryHandler.Config.CommonConfig, "Couldn't reset DuckDB setting:", name, err)
+		}
+	}
 }
 
 func (queryHandler *QueryHandler) HandleParseQuery(message *pgproto3.Parse) ([]pgproto3.Message, *PreparedStatement, error) {
-	ctx := context.Background()
 	originalQuery := string(message.Query)
+
+	session := queryHandler.QueryRemapper.Session
+	session.NextQueryId()
+	session.LogTrace(queryHandler.Config.CommonConfig, "Parsing query:", originalQuery)
+
 	queryStatements, _, err := queryHandler.QueryRemapper.ParseAndRemapQuery(originalQuery)
+	if err == nil && len(queryStatements) > 1 {
+		err = fmt.Errorf("multiple queries in a single parse message are not supported: %s", originalQuery)
+	}
 	if err != nil {
+		queryHandler.QueryRemapper.RemoveUncreatedTempTables()
 		return nil, nil, err
 	}
-	if len(queryStatements) > 1 {
-		return nil, nil, fmt.Errorf("multiple queries in a single parse message are not supported: %s", originalQuery)
-	}
 
 	preparedStatement := &PreparedStatement{
 		Name:          message.Name,
 		OriginalQuery: originalQuery,
 		ParameterOIDs: message.ParameterOIDs,
 	}
-	if len(queryStatements) == 0 {
-		return []pgproto3.Message{&pgproto3.ParseComplete{}}, preparedStatement, nil
+	if len(queryStatements) > 0 {
+		query := queryStatements[0]
+		preparedStatement.Query = query
+		statement, err := queryHandler.ServerDuckdbClient.PrepareContext(session.Context(), query)
+		preparedStatement.Statement = statement
+		if err != nil {
+			queryHandler.QueryRemapper.RemoveUncreatedTempTables()
+			return nil, nil, err
+		}
+		preparedStatement.ParameterOIDs = queryHandler.inferParameterOIDs(session.Context(), query, message.ParameterOIDs)
 	}
 
-	query := queryStatements[0]
-	preparedStatement.Query = query
-	statement, err := queryHandler.ServerDuckdbClient.PrepareContext(ctx, query)
-	preparedStatement.Statement = statement
+	err = session.AddExtendedStatement(preparedStatement)
 	if err != nil {
+		if preparedStatement.Statement != nil {
+			preparedStatement.Statement.Close()
+		}
+		queryHandler.QueryRemapper.RemoveUncreatedTempTables()
 		return nil, nil, err
 	}
 
-	return []pgproto3.Message{&pgproto3.ParseComplete{}}, preparedStatement, nil
+	return append(session.TakeNotices(), &pgproto3.ParseComplete{}), preparedStatement, nil
+}
+
+// Keeps the parameter types sent by the client and infers unspecified ones from how DuckDB binds the statement,
+// e.g. WHERE id = $1 -> int4 for an INTEGER column. Parameters DuckDB can't infer, e.g. SELECT $1, are text like in Postgres.
+func (queryHandler *QueryHandler) inferParameterOIDs(ctx context.Context, query string, parameterOIDs []uint32) []uint32 {
+	parameterCount, err := queryHandler.QueryRemapper.remapperTable.parserTable.ParameterCount(query)
+	if err != nil || parameterCount == 0 {
+		return parameterOIDs
+	}
+	if len(parameterOIDs) >= parameterCount && !slices.Contains(parameterOIDs[:parameterCount], 0) {
+		return parameterOIDs
+	}
+
+	conn, err := queryHandler.ServerDuckdbClient.Db.Conn(ctx)
+	if err != nil {
+		common.LogWarn(queryHandler.Config.CommonConfig, "Couldn't infer parameter types:", err)
+		return textParameterOIDs(parameterOIDs, parameterCount)
+	}
+	defer conn.Close()
+
+	inferredOIDs := make([]uint32, parameterCount)
+	err = conn.Raw(func(driverConn any) error {
+		statement, err := driverConn.(*duckdb.Conn).PrepareContext(ctx, query)
+		if err != nil {
+			return err
+		}
+		defer statement.Close()
+
+		for i := range inferredOIDs {
+			if i < len(parameterOIDs) && parameterOIDs[i] != 0 {
+				inferredOIDs[i] = parameterOIDs[i]
+				continue
+			}
+			duckdbType, err := statement.(*duckdb.Stmt).ParamType(i + 1)
+			if err != nil {
+				return err
+			}
+			inferredOIDs[i] = pgtype.TextOID
+			if oid, ok := DUCKDB_PARAMETER_TYPE_OIDS[duckdbType]; ok {
+				inferredOIDs[i] = oid
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		common.LogWarn(queryHandler.Config.CommonConfig, "Couldn't infer parameter types:", err)
+		return textParameterOIDs(parameterOIDs, parameterCount)
+	}
+	return inferredOIDs
+}
+
+// [int4, 0] -> [int4, text, text] for 3 parameters, so that the ParameterDescription describes all parameters
+func textParameterOIDs(parameterOIDs []uint32, parameterCount int) []uint32 {
+	textOIDs := make([]uint32, max(len(parameterOIDs), parameterCount))
+	for i := range textOIDs {
+		textOIDs[i] = pgtype.TextOID
+		if i < len(parameterOIDs) && parameterOIDs[i] != 0 {
+			textOIDs[i] = parameterOIDs[i]
+		}
+	}
+	return textOIDs
 }
 
+// Returns a portal with the bound variables for the statement, the statement can be parsed in an earlier extended query
 func (queryHandler *QueryHandler) HandleBindQuery(message *pgproto3.Bind, preparedStatement *PreparedStatement) ([]pgproto3.Message, *PreparedStatement, error) {
-	if message.PreparedStatement != preparedStatement.Name {
-		return nil, nil, fmt.Errorf("prepared statement mismatch, %s instead of %s: %s", message.PreparedStatement, preparedStatement.Name, preparedStatement.OriginalQuery)
+	preparedStatement, err := queryHandler.extendedStatement(message.PreparedStatement, preparedStatement)
+	if err != nil {
+		return nil, nil, err
 	}
 
 	var variables []interface{}
+	parameterValues := make([]interface{}, len(message.Parameters)) // Including NULLs, by parameter number
 	paramFormatCodes := message.ParameterFormatCodes
 
 	for i, param := range message.Parameters {
@@ -160,8 +519,15 @@ func (queryHandler *QueryHandler) HandleBindQuery(message *pgproto3.Bind, prepar
 			textFormat = paramFormatCodes[i] == 0
 		}
 
+		var oid uint32
+		if i < len(preparedStatement.ParameterOIDs) {
+			oid = preparedStatement.ParameterOIDs[i]
+		}
+
 		if textFormat {
 			variables = append(variables, string(param))
+		} else if value, ok := binaryParameterValue(param, oid); ok {
+			variables = append(variables, value)
 		} else if len(param) == 4 {
 			variables = append(variables, int32(binary.BigEndian.Uint32(param)))
 		} else if len(param) == 8 {
@@ -171,103 +537,734 @@ func (queryHandler *QueryHandler) HandleBindQuery(message *pgproto3.Bind, prepar
 		} else {
 			return nil, nil, fmt.Errorf("unsupported parameter format: %v (length %d). Original query: %s", param, len(param), preparedStatement.OriginalQuery)
 		}
+		parameterValues[i] = variables[len(variables)-1]
 	}
 
 	common.LogDebug(queryHandler.Config.CommonConfig, "Bound variables:", variables)
-	preparedStatement.Bound = true
-	preparedStatement.Variables = variables
-	preparedStatement.Portal = message.DestinationPortal
+	portal := &PreparedStatement{
+		Name:              preparedStatement.Name,
+		OriginalQuery:     preparedStatement.OriginalQuery,
+		Query:             preparedStatement.Query,
+		Statement:         preparedStatement.Statement,
+		ParameterOIDs:     preparedStatement.ParameterOIDs,
+		Bound:             true,
+		Variables:         variables,
+		Portal:            message.DestinationPortal,
+		ResultFormatCodes: message.ResultFormatCodes,
+	}
+
+	// Plan the query for the bound values instead of reusing the plan of the prepared statement
+	if queryHandler.QueryRemapper.Session.ReplanOnBind && len(parameterValues) > 0 && preparedStatement.Query != "" {
+		query, err := queryHandler.QueryRemapper.InlineParameters(preparedStatement.Query, parameterValues)
+		if err != nil {
+			return nil, nil, fmt.Errorf("couldn't inline bound values: %w. Original query: %s", err, preparedStatement.OriginalQuery)
+		}
+		common.LogDebug(queryHandler.Config.CommonConfig, "Re-planning query with bound values:", query)
+
+		statement, err := queryHandler.ServerDuckdbClient.PrepareContext(queryHandler.QueryRemapper.Session.Context(), query)
+		if err != nil {
+			return nil, nil, fmt.Errorf("couldn't prepare statement: %w. Original query: %s", err, preparedStatement.OriginalQuery)
+		}
+		portal.Query = query
+		portal.Statement = statement
+		portal.Variables = nil
+		portal.Replanned = true
+	}
+
+	err = queryHandler.QueryRemapper.Session.AddPortal(portal)
+	if err != nil {
+		if portal.Replanned {
+			portal.Statement.Close()
+		}
+		return nil, nil, err
+	}
 
 	messages := []pgproto3.Message{&pgproto3.BindComplete{}}
 
-	return messages, preparedStatement, nil
+	return messages, portal, nil
 }
 
+// Describe statement -> ParameterDescription, RowDescription/NoData
+// Describe portal -> RowDescription/NoData
 func (queryHandler *QueryHandler) HandleDescribeQuery(message *pgproto3.Describe, preparedStatement *PreparedStatement) ([]pgproto3.Message, *PreparedStatement, error) {
+	var err error
+	var messages []pgproto3.Message
 	switch message.ObjectType {
 	case 'S': // Statement
-		if message.Name != preparedStatement.Name {
-			return nil, nil, fmt.Errorf("statement mismatch, %s instead of %s: %s", message.Name, preparedStatement.Name, preparedStatement.OriginalQuery)
+		preparedStatement, err = queryHandler.extendedStatement(message.Name, preparedStatement)
+		if err == nil {
+			messages = append(messages, &pgproto3.ParameterDescription{ParameterOIDs: preparedStatement.ParameterOIDs})
 		}
 	case 'P': // Portal
-		if message.Name != preparedStatement.Portal {
-			return nil, nil, fmt.Errorf("portal mismatch, %s instead of %s: %s", message.Name, preparedStatement.Portal, preparedStatement.OriginalQuery)
-		}
+		preparedStatement, err = queryHandler.portal(message.Name, preparedStatement)
 	default:
-		return nil, nil, fmt.Errorf("unsupported describe object type: %c. Original query: %s", message.ObjectType, preparedStatement.OriginalQuery)
+		return nil, nil, fmt.Errorf("unsupported describe object type: %c", message.ObjectType)
+	}
+	if err != nil {
+		return nil, nil, err
 	}
 
 	preparedStatement.Described = true
-	if preparedStatement.Query == "" || !preparedStatement.Bound { // Empty query or Parse->[No Bind]->Describe
-		return []pgproto3.Message{&pgproto3.NoData{}}, preparedStatement, nil
+	rowsMessages, err := queryHandler.describeRows(preparedStatement)
+	if err != nil {
+		return nil, nil, err
+	}
+	return append(messages, rowsMessages...), preparedStatement, nil
+}
+
+func (queryHandler *QueryHandler) describeRows(preparedStatement *PreparedStatement) ([]pgproto3.Message, error) {
+	if preparedStatement.Query == "" || !preparedStatement.Bound || isTransactionCommand(preparedStatement.OriginalQuery) { // Empty query, Parse->[No Bind]->Describe, or BEGIN/COMMIT/ROLLBACK
+		return []pgproto3.Message{&pgproto3.NoData{}}, nil
+	}
+	if icebergSchemaTable, _ := queryHandler.QueryRemapper.IcebergInsertTable(preparedStatement.OriginalQuery); icebergSchemaTable != nil {
+		return []pgproto3.Message{&pgproto3.NoData{}}, nil
+	}
+	if icebergSchemaTable, _ := queryHandler.QueryRemapper.IcebergChangeTable(preparedStatement.OriginalQuery); icebergSchemaTable != nil {
+		return []pgproto3.Message{&pgproto3.NoData{}}, nil
+	}
+	if isCursorCommand(preparedStatement.OriginalQuery) {
+		return queryHandler.describeCursorCommand(preparedStatement.OriginalQuery, preparedStatement.ResultFormatCodes)
 	}
 
-	rows, err := preparedStatement.Statement.QueryContext(context.Background(), preparedStatement.Variables...)
+	err := queryHandler.checkPreparedStatementAccess(preparedStatement)
 	if err != nil {
-		return nil, nil, fmt.Errorf("couldn't execute statement: %w. Original query: %s", err, preparedStatement.OriginalQuery)
+		return nil, err
+	}
+
+	ctx, cancelTimeout := queryHandler.statementContext()
+	rows, err := queryHandler.queryPreparedStatement(ctx, preparedStatement)
+	if err != nil {
+		cancelTimeout()
+		return nil, fmt.Errorf("couldn't execute statement: %w. Original query: %s", err, preparedStatement.OriginalQuery)
 	}
 	preparedStatement.Rows = rows
+	preparedStatement.CancelTimeout = cancelTimeout
 
-	messages, err := queryHandler.rowsToDescriptionMessages(preparedStatement.Rows, preparedStatement.OriginalQuery)
+	messages, err := queryHandler.rowsToDescriptionMessages(preparedStatement.Rows, preparedStatement.OriginalQuery, preparedStatement.ResultFormatCodes)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
+	}
+	if len(messages) == 0 {
+		return []pgproto3.Message{&pgproto3.NoData{}}, nil
+	}
+	return messages, nil
+}
+
+// Binary parameter -> value of the parameter's type, false for unknown types to guess them by length
+func binaryParameterValue(param []byte, oid uint32) (interface{}, bool) {
+	switch {
+	case oid == pgtype.BoolOID && len(param) == 1:
+		return param[0] != 0, true
+	case oid == pgtype.Int2OID && len(param) == 2:
+		return int16(binary.BigEndian.Uint16(param)), true
+	case oid == pgtype.Int4OID && len(param) == 4:
+		return int32(binary.BigEndian.Uint32(param)), true
+	case oid == pgtype.Int8OID && len(param) == 8:
+		return int64(binary.BigEndian.Uint64(param)), true
+	case oid == pgtype.Float4OID && len(param) == 4:
+		return math.Float32frombits(binary.BigEndian.Uint32(param)), true
+	case oid == pgtype.Float8OID && len(param) == 8:
+		return math.Float64frombits(binary.BigEndian.Uint64(param)), true
+	case oid == pgtype.TextOID || oid == pgtype.VarcharOID || oid == pgtype.BPCharOID || oid == pgtype.NameOID:
+		return string(param), true
+	case oid == pgtype.UUIDOID && len(param) == 16:
+		return uuid.UUID(param).String(), true
+	case oid == pgtype.DateOID && len(param) == 4:
+		days := int32(binary.BigEndian.Uint32(param))
+		return time.Unix(PG_BINARY_EPOCH_UNIX_SECONDS, 0).UTC().AddDate(0, 0, int(days)), true
+	case (oid == pgtype.TimestampOID || oid == pgtype.TimestamptzOID) && len(param) == 8:
+		microseconds := int64(binary.BigEndian.Uint64(param))
+		return time.UnixMicro(PG_BINARY_EPOCH_UNIX_SECONDS*1_000_000 + microseconds).UTC(), true
 	}
-	return messages, preparedStatement, nil
+	return nil, false
 }
 
 func (queryHandler *QueryHandler) HandleExecuteQuery(message *pgproto3.Execute, preparedStatement *PreparedStatement) ([]pgproto3.Message, error) {
-	if message.Portal != preparedStatement.Portal {
-		return nil, fmt.Errorf("portal mismatch, %s instead of %s: %s", message.Portal, preparedStatement.Portal, preparedStatement.OriginalQuery)
+	preparedStatement, err := queryHandler.portal(message.Portal, preparedStatement)
+	if err != nil {
+		return nil, err
 	}
 
 	if preparedStatement.Query == "" {
 		return []pgproto3.Message{&pgproto3.EmptyQueryResponse{}}, nil
 	}
+	defer queryHandler.QueryRemapper.RemoveUncreatedTempTables()
+	if isTransactionCommand(preparedStatement.OriginalQuery) {
+		preparedStatement.CloseRows()
+		return queryHandler.handleTransactionCommand(preparedStatement.OriginalQuery)
+	}
+	if icebergSchemaTable, columnNames := queryHandler.QueryRemapper.IcebergInsertTable(preparedStatement.OriginalQuery); icebergSchemaTable != nil {
+		return queryHandler.executeIcebergWrite(preparedStatement, func() ([]pgproto3.Message, error) {
+			return queryHandler.insertIntoIcebergTable(*icebergSchemaTable, columnNames, preparedStatement.Query, preparedStatement.Variables)
+		})
+	}
+	if icebergSchemaTable, command := queryHandler.QueryRemapper.IcebergChangeTable(preparedStatement.OriginalQuery); icebergSchemaTable != nil {
+		return queryHandler.executeIcebergWrite(preparedStatement, func() ([]pgproto3.Message, error) {
+			return queryHandler.changeIcebergTable(*icebergSchemaTable, command, preparedStatement.Query, preparedStatement.Variables)
+		})
+	}
+
+	lockPid := queryHandler.LockTracker.AcquireQueryLock()
+	defer queryHandler.LockTracker.Release(lockPid)
+
+	if !preparedStatement.Suspended {
+		preparedStatement.ReturnedRows = 0
+		if preparedStatement.Rows == nil { // Otherwise checked by Describe before it ran the query
+			err = queryHandler.checkPreparedStatementAccess(preparedStatement)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// After the checks above, DECLARE runs the cursor's query
+	if isCursorCommand(preparedStatement.OriginalQuery) {
+		preparedStatement.CloseRows()
+		releaseMemory, err := queryHandler.MemoryAdmission.Admit(queryHandler.QueryRemapper.Session.Context(), preparedStatement.Query)
+		if err != nil {
+			return nil, err
+		}
+		defer releaseMemory()
+		messages, err := queryHandler.handleCursorCommand(preparedStatement.OriginalQuery, preparedStatement.Query, preparedStatement.Variables, preparedStatement.ResultFormatCodes, false)
+		if err != nil {
+			return nil, err
+		}
+		if preparedStatement.Access != nil {
+			queryHandler.QueryHooks.AfterQuery(*preparedStatement.Access, dataRowCount(messages))
+			preparedStatement.Access = nil
+		}
+		return messages, nil
+	}
 
 	if preparedStatement.Rows == nil { // Parse->[No Bind]->Describe->Execute or Parse->Bind->[No Describe]->Execute
-		rows, err := preparedStatement.Statement.QueryContext(context.Background(), preparedStatement.Variables...)
+		ctx, cancelTimeout := queryHandler.statementContext()
+		rows, err := queryHandler.queryPreparedStatement(ctx, preparedStatement)
 		if err != nil {
+			cancelTimeout()
 			return nil, err
 		}
 		preparedStatement.Rows = rows
+		preparedStatement.CancelTimeout = cancelTimeout
 	}
+	queryHandler.QueryRemapper.TrackCreatedTempTable(preparedStatement.OriginalQuery)
 
-	defer preparedStatement.Rows.Close()
+	var messages []pgproto3.Message
+	execution := preparedStatement.Execution
+	if message.MaxRows > 0 {
+		messages, err = queryHandler.rowsToSuspendableDataMessages(preparedStatement, message.MaxRows)
+	} else {
+		preparedStatement.Suspended = false
+		messages, err = queryHandler.rowsToDataMessages(preparedStatement.Rows, preparedStatement.OriginalQuery, preparedStatement.ResultFormatCodes)
+		preparedStatement.CloseRows()
+	}
+	if err != nil {
+		return nil, err
+	}
 
-	return queryHandler.rowsToDataMessages(preparedStatement.Rows, preparedStatement.OriginalQuery)
+	preparedStatement.ReturnedRows += dataRowCount(messages)
+	if preparedStatement.Suspended {
+		return messages, nil
+	}
+	if preparedStatement.Access != nil {
+		queryHandler.QueryHooks.AfterQuery(*preparedStatement.Access, preparedStatement.ReturnedRows)
+		preparedStatement.Access = nil
+	}
+	if execution != nil { // Closed with the rows
+		messages = append(messages, execution.Notices(preparedStatement.ReturnedRows)...)
+	}
+	return messages, nil
 }
 
-func (queryHandler *QueryHandler) rowsToDescriptionMessages(rows *sql.Rows, originalQuery string) ([]pgproto3.Message, error) {
-	cols, err := rows.ColumnTypes()
+// Runs the statement in the session's transaction if there is one, its execution is closed with the rows
+func (queryHandler *QueryHandler) queryPreparedStatement(ctx context.Context, preparedStatement *PreparedStatement) (*sql.Rows, error) {
+	if transaction := queryHandler.QueryRemapper.Session.Transaction; transaction != nil && isTransactionChangeCommand(preparedStatement.OriginalQuery) {
+		transaction.ChangeCount++
+	}
+
+	execution, err := queryHandler.startQueryExecution(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("couldn't get column types: %w. Original query: %s", err, originalQuery)
+		return nil, err
 	}
+	err = execution.AdmitMemory(ctx, preparedStatement.Query) // Held until the rows are closed, including by Describe and suspended portals
+	if err != nil {
+		execution.Close()
+		return nil, err
+	}
+	rows, err := execution.QueryContext(ctx, preparedStatement.Query, preparedStatement.Variables...)
+	if err != nil {
+		execution.Close()
+		return nil, err
+	}
+	preparedStatement.Execution = execution
+	return rows, nil
+}
 
-	var messages []pgproto3.Message
+// BEGIN / COMMIT / ROLLBACK -> [NoticeResponse], CommandComplete
+func (queryHandler *QueryHandler) handleTransactionCommand(originalQuery string) ([]pgproto3.Message, error) {
+	commandTag, warning, err := queryHandler.QueryRemapper.HandleTransactionQuery(originalQuery)
+	if err != nil {
+		return nil, err
+	}
 
-	rowDescription := queryHandler.generateRowDescription(cols)
-	if rowDescription != nil {
-		messages = append(messages, rowDescription)
+	messages := queryHandler.QueryRemapper.Session.TakeNotices()
+	if warning != "" {
+		messages = append(messages, &pgproto3.NoticeResponse{
+			Severity:            "WARNING",
+			SeverityUnlocalized: "WARNING",
+			Code:                PG_ERROR_CODE_NO_ACTIVE_TRANSACTION,
+			Message:             warning,
+		})
+	}
+	return append(messages, &pgproto3.CommandComplete{CommandTag: []byte(commandTag)}), nil
+}
+
+// Runs the query hooks and checks the storage budget before the write like HandleSimpleQuery does
+func (queryHandler *QueryHandler) executeIcebergWrite(preparedStatement *PreparedStatement, write func() ([]pgproto3.Message, error)) ([]pgproto3.Message, error) {
+	preparedStatement.CloseRows()
+	err := queryHandler.checkPreparedStatementAccess(preparedStatement)
+	if err != nil {
+		return nil, err
+	}
+	err = queryHandler.StorageBudgets.Check(queryHandler.QueryRemapper.Session.User)
+	if err != nil {
+		return nil, err
 	}
 
+	messages, err := write()
+	if err != nil {
+		return nil, err
+	}
+	if preparedStatement.Access != nil {
+		queryHandler.QueryHooks.AfterQuery(*preparedStatement.Access, dataRowCount(messages))
+		preparedStatement.Access = nil
+	}
 	return messages, nil
 }
 
-func (queryHandler *QueryHandler) rowsToDataMessages(rows *sql.Rows, originalQuery string) ([]pgproto3.Message, error) {
-	cols, err := rows.ColumnTypes()
+// INSERT INTO table ... -> CommandComplete "INSERT 0 <count>", the rows are appended outside of the session's transaction like with COPY FROM STDIN
+func (queryHandler *QueryHandler) insertIntoIcebergTable(icebergSchemaTable common.IcebergSchemaTable, columnNames []string, query string, variables []interface{}) ([]pgproto3.Message, error) {
+	rowCount, err := queryHandler.QueryRemapper.IcebergWriter.AppendFromQuery(icebergSchemaTable, columnNames, query, variables)
 	if err != nil {
-		return nil, fmt.Errorf("couldn't get column types: %w. Original query: %s", err, originalQuery)
+		return nil, fmt.Errorf("couldn't insert into table %s: %w", icebergSchemaTable.String(), err)
 	}
+	return []pgproto3.Message{&pgproto3.CommandComplete{CommandTag: []byte("INSERT 0 " + common.Int64ToString(rowCount))}}, nil
+}
 
-	var messages []pgproto3.Message
-	for rows.Next() {
-		dataRow, err := queryHandler.generateDataRow(rows, cols)
+// UPDATE table ... / DELETE FROM table ... -> CommandComplete "UPDATE <count>" / "DELETE <count>", the rows are changed outside of the session's transaction like with INSERT
+func (queryHandler *QueryHandler) changeIcebergTable(icebergSchemaTable common.IcebergSchemaTable, command string, query string, variables []interface{}) ([]pgproto3.Message, error) {
+	rowCount, err := queryHandler.QueryRemapper.IcebergWriter.ChangeFromQuery(icebergSchemaTable, func(duckdbTableName string) (string, error) {
+		return queryHandler.QueryRemapper.RetargetChangeStatement(query, duckdbTableName)
+	}, variables)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't change table %s: %w", icebergSchemaTable.String(), err)
+	}
+	return []pgproto3.Message{&pgproto3.CommandComplete{CommandTag: []byte(command + " " + common.Int64ToString(rowCount))}}, nil
+}
+
+// DECLARE -> CommandComplete
+// FETCH -> [RowDescription], DataRow (up to the count), ..., CommandComplete
+// MOVE / CLOSE -> CommandComplete
+func (queryHandler *QueryHandler) handleCursorCommand(originalQuery string, query string, variables []interface{}, resultFormatCodes []int16, withRowDescription bool) ([]pgproto3.Message, error) {
+	node, err := parseCursorCommand(originalQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	session := queryHandler.QueryRemapper.Session
+	switch {
+	case node.GetDeclareCursorStmt() != nil:
+		err = queryHandler.declareCursor(node.GetDeclareCursorStmt(), query, variables)
 		if err != nil {
-			return nil, fmt.Errorf("couldn't get data row: %w. Original query: %s", err, originalQuery)
+			return nil, err
 		}
-		messages = append(messages, dataRow)
+		return []pgproto3.Message{&pgproto3.CommandComplete{CommandTag: []byte("DECLARE CURSOR")}}, nil
+
+	case node.GetClosePortalStmt() != nil:
+		name := node.GetClosePortalStmt().Portalname
+		if name == "" { // CLOSE ALL
+			session.CloseCursors()
+			return []pgproto3.Message{&pgproto3.CommandComplete{CommandTag: []byte("CLOSE CURSOR ALL")}}, nil
+		}
+		_, err = session.Cursor(name)
+		if err != nil {
+			return nil, err
+		}
+		session.CloseCursor(name)
+		return []pgproto3.Message{&pgproto3.CommandComplete{CommandTag: []byte("CLOSE CURSOR")}}, nil
 	}
 
+	fetchStatement := node.GetFetchStmt()
+	cursor, err := session.Cursor(fetchStatement.Portalname)
+	if err != nil {
+		return nil, err
+	}
+	if fetchStatement.Direction != pgQuery.FetchDirection_FETCH_FORWARD || fetchStatement.HowMany <= 0 {
+		return nil, &PgError{
+			Code:    PG_ERROR_CODE_OBJECT_NOT_IN_PREREQUISITE,
+			Message: "cursor can only scan forward",
+			Hint:    "Use FETCH [FORWARD] count or FETCH ALL.",
+		}
+	}
+
+	var messages []pgproto3.Message
+	if withRowDescription && !fetchStatement.Ismove {
+		messages = append(messages, queryHandler.generateRowDescription(cursor.Cols, resultFormatCodes))
+	}
+
+	var rowCount int64
+	for rowCount < fetchStatement.HowMany && cursor.Rows.Next() { // FETCH ALL has the maximum count
+		rowCount++
+		if fetchStatement.Ismove {
+			continue
+		}
+		dataRow, err := queryHandler.generateDataRow(cursor.Rows, cursor.Cols, resultFormatCodes)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't get data row: %w. Original query: %s", err, originalQuery)
+		}
+		messages = append(messages, dataRow)
+	}
+	err = cursor.Rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	commandTag := "FETCH "
+	if fetchStatement.Ismove {
+		commandTag = "MOVE "
+	}
+	return append(messages, &pgproto3.CommandComplete{CommandTag: []byte(commandTag + common.Int64ToString(rowCount))}), nil
+}
+
+// Runs the cursor's query in the session's transaction, or on a pooled connection until CLOSE for a cursor WITH HOLD
+func (queryHandler *QueryHandler) declareCursor(declareStatement *pgQuery.DeclareCursorStmt, query string, variables []interface{}) error {
+	session := queryHandler.QueryRemapper.Session
+	if declareStatement.Options&CURSOR_OPT_BINARY != 0 {
+		return &PgError{Code: PG_ERROR_CODE_FEATURE_NOT_SUPPORTED, Message: "BINARY cursors are not supported"}
+	}
+	hold := declareStatement.Options&CURSOR_OPT_HOLD != 0
+	if !hold && session.Transaction == nil {
+		return &PgError{Code: PG_ERROR_CODE_NO_ACTIVE_TRANSACTION, Message: "DECLARE CURSOR can only be used in transaction blocks"}
+	}
+
+	// Canceled only when the connection is closed since the rows are read by later statements
+	ctx := session.ConnectionContext()
+	var rows *sql.Rows
+	var execution *QueryExecution
+	var err error
+	if !hold && session.Transaction.Tx != nil { // Reads are metered by the DECLARE and FETCH statements of the transaction
+		rows, err = queryHandler.queryWithDuckdbSettings(ctx, session.Transaction.Tx, session.Transaction.DuckdbSettings, query, variables...)
+	} else {
+		execution, err = queryHandler.startPooledQueryExecution(ctx)
+		if err != nil {
+			return err
+		}
+		rows, err = execution.QueryContext(ctx, query, variables...)
+		if err != nil {
+			execution.Close()
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	cursor := &SessionCursor{
+		Name:        declareStatement.Portalname,
+		Rows:        rows,
+		Hold:        hold,
+		Transaction: session.Transaction,
+		Execution:   execution,
+	}
+	cursor.Cols, err = rows.ColumnTypes()
+	if err != nil {
+		cursor.close()
+		return err
+	}
+	return session.AddCursor(cursor)
+}
+
+// FETCH -> RowDescription of the cursor, DECLARE / MOVE / CLOSE -> NoData
+func (queryHandler *QueryHandler) describeCursorCommand(originalQuery string, resultFormatCodes []int16) ([]pgproto3.Message, error) {
+	node, err := parseCursorCommand(originalQuery)
+	if err != nil {
+		return nil, err
+	}
+	if node.GetFetchStmt() == nil || node.GetFetchStmt().Ismove {
+		return []pgproto3.Message{&pgproto3.NoData{}}, nil
+	}
+
+	cursor, err := queryHandler.QueryRemapper.Session.Cursor(node.GetFetchStmt().Portalname)
+	if err != nil {
+		return nil, err
+	}
+	return []pgproto3.Message{queryHandler.generateRowDescription(cursor.Cols, resultFormatCodes)}, nil
+}
+
+// Runs the before_query hooks before Describe or Execute runs the query of the portal, the access is kept for the after_query hooks
+func (queryHandler *QueryHandler) checkPreparedStatementAccess(preparedStatement *PreparedStatement) error {
+	preparedStatement.Access = nil
+	access, err := queryHandler.queryAccess(preparedStatement.OriginalQuery)
+	if err != nil {
+		return err
+	}
+	if access != nil {
+		err = queryHandler.QueryHooks.BeforeQuery(queryHandler.QueryRemapper.Session.Context(), *access)
+		if err != nil {
+			return err
+		}
+	}
+	preparedStatement.Access = access
+	return nil
+}
+
+// Returns nil if the query hooks are disabled or the query doesn't read Iceberg tables, materialized views, or files
+func (queryHandler *QueryHandler) queryAccess(originalQuery string) (*QueryAccess, error) {
+	if !queryHandler.QueryHooks.Enabled() {
+		return nil, nil
+	}
+
+	tables, err := queryHandler.QueryRemapper.ReferencedDataTables(originalQuery)
+	if err != nil {
+		return nil, err
+	}
+	if len(tables) == 0 {
+		return nil, nil
+	}
+
+	session := queryHandler.QueryRemapper.Session
+	return &QueryAccess{
+		User:            session.User,
+		Database:        session.Database,
+		ApplicationName: session.ApplicationName,
+		ClientAddr:      session.ClientAddr,
+		Query:           originalQuery,
+		Tables:          tables,
+	}, nil
+}
+
+// Close succeeds even if there is no statement or portal with the name
+func (queryHandler *QueryHandler) HandleCloseQuery(message *pgproto3.Close) ([]pgproto3.Message, error) {
+	session := queryHandler.QueryRemapper.Session
+	switch message.ObjectType {
+	case 'S': // Statement
+		session.CloseExtendedStatement(message.Name)
+	case 'P': // Portal
+		session.ClosePortal(message.Name)
+	default:
+		return nil, fmt.Errorf("unsupported close object type: %c", message.ObjectType)
+	}
+	return []pgproto3.Message{&pgproto3.CloseComplete{}}, nil
+}
+
+func (preparedStatement *PreparedStatement) CloseRows() {
+	if preparedStatement.Rows != nil {
+		preparedStatement.Rows.Close()
+	}
+	if preparedStatement.Execution != nil {
+		preparedStatement.Execution.TrackProfile()
+		preparedStatement.Execution.Close()
+		preparedStatement.Execution = nil
+	}
+	if preparedStatement.CancelTimeout != nil {
+		preparedStatement.CancelTimeout()
+		preparedStatement.CancelTimeout = nil
+	}
+}
+
+// Session query context with the statement_timeout deadline, the returned function must be called after the query rows are closed
+func (queryHandler *QueryHandler) statementContext() (context.Context, context.CancelFunc) {
+	timeout := time.Duration(queryHandler.Config.StatementTimeoutMs) * time.Millisecond
+	if statementTimeout := queryHandler.QueryRemapper.Session.StatementTimeout; statementTimeout != nil {
+		timeout = *statementTimeout
+	}
+	if timeout > 0 {
+		return context.WithTimeout(queryHandler.QueryRemapper.Session.Context(), timeout)
+	}
+	return context.WithCancel(queryHandler.QueryRemapper.Session.Context())
+}
+
+// The statement parsed or bound by the previous message of the extended query if it has the name, otherwise a statement parsed earlier in the session
+func (queryHandler *QueryHandler) extendedStatement(name string, currentStatement *PreparedStatement) (*PreparedStatement, error) {
+	if currentStatement != nil && currentStatement.Name == name {
+		return currentStatement, nil
+	}
+	return queryHandler.QueryRemapper.Session.ExtendedStatement(name)
+}
+
+// The statement of the extended query if it has the portal name (e.g., Parse->[No Bind]->Execute), otherwise a portal bound earlier in the session
+func (queryHandler *QueryHandler) portal(name string, currentStatement *PreparedStatement) (*PreparedStatement, error) {
+	if currentStatement != nil && currentStatement.Portal == name && (currentStatement.Bound || name == "") {
+		return currentStatement, nil
+	}
+	return queryHandler.QueryRemapper.Session.Portal(name)
+}
+
+func (queryHandler *QueryHandler) rowsToDescriptionMessages(rows *sql.Rows, originalQuery string, resultFormatCodes []int16) ([]pgproto3.Message, error) {
+	cols, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get column types: %w. Original query: %s", err, originalQuery)
+	}
+
+	var messages []pgproto3.Message
+	if isRowCountCommand(originalQuery) {
+		return messages, nil
+	}
+	if isExplainCommand(originalQuery) {
+		return []pgproto3.Message{&pgproto3.RowDescription{Fields: []pgproto3.FieldDescription{{
+			Name:         []byte(EXPLAIN_QUERY_PLAN_COLUMN),
+			DataTypeOID:  pgtype.TextOID,
+			DataTypeSize: -1,
+			TypeModifier: -1,
+			Format:       pgtype.TextFormatCode,
+		}}}}, nil
+	}
+
+	rowDescription := queryHandler.generateRowDescription(cols, resultFormatCodes)
+	if rowDescription != nil {
+		messages = append(messages, rowDescription)
+	}
+
+	return messages, nil
+}
+
+func (queryHandler *QueryHandler) rowsToDataMessages(rows *sql.Rows, originalQuery string, resultFormatCodes []int16) ([]pgproto3.Message, error) {
+	cols, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get column types: %w. Original query: %s", err, originalQuery)
+	}
+
+	if isRowCountCommand(originalQuery) {
+		return queryHandler.rowCountMessages(rows, originalQuery)
+	}
+	if isExplainCommand(originalQuery) {
+		return queryHandler.explainMessages(rows, originalQuery)
+	}
+
+	var messages []pgproto3.Message
+	for rows.Next() {
+		dataRow, err := queryHandler.generateDataRow(rows, cols, resultFormatCodes)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't get data row: %w. Original query: %s", err, originalQuery)
+		}
+		messages = append(messages, dataRow)
+	}
+
+	messages = append(messages, &pgproto3.CommandComplete{CommandTag: []byte(queryHandler.commandTag(originalQuery))})
+	return messages, nil
+}
+
+// Execute with MaxRows -> DataRow (up to MaxRows), ..., PortalSuspended if there may be more rows, otherwise CommandComplete
+func (queryHandler *QueryHandler) rowsToSuspendableDataMessages(preparedStatement *PreparedStatement, maxRows uint32) ([]pgproto3.Message, error) {
+	rows := preparedStatement.Rows
+	if isRowCountCommand(preparedStatement.OriginalQuery) {
+		defer preparedStatement.CloseRows()
+		preparedStatement.Suspended = false
+		return queryHandler.rowCountMessages(rows, preparedStatement.OriginalQuery)
+	}
+	if isExplainCommand(preparedStatement.OriginalQuery) {
+		defer preparedStatement.CloseRows()
+		preparedStatement.Suspended = false
+		return queryHandler.explainMessages(rows, preparedStatement.OriginalQuery)
+	}
+
+	cols, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get column types: %w. Original query: %s", err, preparedStatement.OriginalQuery)
+	}
+
+	var messages []pgproto3.Message
+	for uint32(len(messages)) < maxRows && rows.Next() {
+		dataRow, err := queryHandler.generateDataRow(rows, cols, preparedStatement.ResultFormatCodes)
+		if err != nil {
+			preparedStatement.CloseRows()
+			return nil, fmt.Errorf("couldn't get data row: %w. Original query: %s", err, preparedStatement.OriginalQuery)
+		}
+		messages = append(messages, dataRow)
+	}
+
+	if uint32(len(messages)) == maxRows {
+		preparedStatement.Suspended = true
+		return append(messages, &pgproto3.PortalSuspended{}), nil
+	}
+
+	preparedStatement.Suspended = false
+	defer preparedStatement.CloseRows()
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	messages = append(messages, &pgproto3.CommandComplete{CommandTag: []byte(queryHandler.commandTag(preparedStatement.OriginalQuery))})
+	return messages, nil
+}
+
+// INSERT -> CommandComplete "INSERT 0 <count>"
+// UPDATE / DELETE -> CommandComplete "UPDATE <count>" / "DELETE <count>"
+// CREATE TEMP TABLE ... AS -> CommandComplete "SELECT <count>"
+// CREATE TEMP TABLE -> CommandComplete "CREATE TABLE"
+func (queryHandler *QueryHandler) rowCountMessages(rows *sql.Rows, originalQuery string) ([]pgproto3.Message, error) {
+	var rowCount int64
+	hasRowCount := rows.Next()
+	if hasRowCount {
+		err := rows.Scan(&rowCount)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't get row count: %w. Original query: %s", err, originalQuery)
+		}
+	}
+	err := rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	commandTag := "CREATE TABLE"
+	switch command := rowCountCommand(originalQuery); {
+	case command == "INSERT":
+		commandTag = "INSERT 0 " + common.Int64ToString(rowCount)
+	case command == "UPDATE" || command == "DELETE":
+		commandTag = command + " " + common.Int64ToString(rowCount)
+	case hasRowCount:
+		commandTag = "SELECT " + common.Int64ToString(rowCount)
+	}
+	return []pgproto3.Message{&pgproto3.CommandComplete{CommandTag: []byte(commandTag)}}, nil
+}
+
+// EXPLAIN -> DataRow (plan line), ..., CommandComplete "EXPLAIN"
+// EXPLAIN (FORMAT json) -> DataRow (plan), CommandComplete "EXPLAIN"
+// DuckDB returns the plan in the explain_value column of a single row instead of a row per line
+func (queryHandler *QueryHandler) explainMessages(rows *sql.Rows, originalQuery string) ([]pgproto3.Message, error) {
+	queryTree, err := pgQuery.Parse(originalQuery)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't parse query: %w. Original query: %s", err, originalQuery)
+	}
+	options, err := queryHandler.QueryRemapper.parserExplain.Options(queryTree.Stmts[0].Stmt.GetExplainStmt())
+	if err != nil {
+		return nil, err
+	}
+
+	var messages []pgproto3.Message
+	for rows.Next() {
+		var explainKey, explainValue string
+		err := rows.Scan(&explainKey, &explainValue)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't get query plan: %w. Original query: %s", err, originalQuery)
+		}
+
+		if options.Format == EXPLAIN_FORMAT_JSON {
+			messages = append(messages, &pgproto3.DataRow{Values: [][]byte{[]byte(explainValue)}})
+			continue
+		}
+		for _, line := range strings.Split(strings.TrimRight(explainValue, "\n"), "\n") {
+			messages = append(messages, &pgproto3.DataRow{Values: [][]byte{[]byte(line)}})
+		}
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return append(messages, &pgproto3.CommandComplete{CommandTag: []byte("EXPLAIN")}), nil
+}
+
+func (queryHandler *QueryHandler) commandTag(originalQuery string) string {
 	commandTag := FALLBACK_SQL_QUERY
 	upperOriginalQueryStatement := strings.ToUpper(originalQuery)
 	switch {
@@ -275,30 +1272,230 @@ func (queryHandler *QueryHandler) rowsToDataMessages(rows *sql.Rows, originalQue
 		commandTag = "SET"
 	case strings.HasPrefix(upperOriginalQueryStatement, "SHOW "):
 		commandTag = "SHOW"
+	case strings.HasPrefix(upperOriginalQueryStatement, "ALTER SYSTEM "):
+		commandTag = "ALTER SYSTEM"
 	case strings.HasPrefix(upperOriginalQueryStatement, "DISCARD ALL"):
 		commandTag = "DISCARD ALL"
+	case strings.HasPrefix(upperOriginalQueryStatement, "DISCARD TEMP"):
+		commandTag = "DISCARD TEMP"
 	case strings.HasPrefix(upperOriginalQueryStatement, "BEGIN"):
 		commandTag = "BEGIN"
-	case strings.HasPrefix(upperOriginalQueryStatement, "COMMIT"):
+	case strings.HasPrefix(upperOriginalQueryStatement, "START TRANSACTION"):
+		commandTag = "START TRANSACTION"
+	case strings.HasPrefix(upperOriginalQueryStatement, "COMMIT"), strings.HasPrefix(upperOriginalQueryStatement, "END"):
 		commandTag = "COMMIT"
+	case strings.HasPrefix(upperOriginalQueryStatement, "ROLLBACK"), strings.HasPrefix(upperOriginalQueryStatement, "ABORT"):
+		commandTag = "ROLLBACK"
+	case strings.HasPrefix(upperOriginalQueryStatement, "DROP TABLE "):
+		commandTag = "DROP TABLE"
+	case strings.HasPrefix(upperOriginalQueryStatement, "CREATE SCHEMA "):
+		commandTag = "CREATE SCHEMA"
+	case strings.HasPrefix(upperOriginalQueryStatement, "ALTER TABLE "):
+		commandTag = "ALTER TABLE"
 	case strings.HasPrefix(upperOriginalQueryStatement, "CREATE MATERIALIZED VIEW "):
 		commandTag = "CREATE MATERIALIZED VIEW"
 	case strings.HasPrefix(upperOriginalQueryStatement, "DROP MATERIALIZED VIEW "):
 		commandTag = "DROP MATERIALIZED VIEW"
+	case strings.HasPrefix(upperOriginalQueryStatement, "CREATE VIEW "), strings.HasPrefix(upperOriginalQueryStatement, "CREATE OR REPLACE VIEW "):
+		commandTag = "CREATE VIEW"
+	case strings.HasPrefix(upperOriginalQueryStatement, "DROP VIEW "):
+		commandTag = "DROP VIEW"
 	case strings.HasPrefix(upperOriginalQueryStatement, "REFRESH MATERIALIZED VIEW "):
 		commandTag = "REFRESH MATERIALIZED VIEW"
+	case strings.HasPrefix(upperOriginalQueryStatement, "DO "):
+		commandTag = "DO"
+	case strings.HasPrefix(upperOriginalQueryStatement, "VACUUM"):
+		commandTag = "VACUUM"
+	case strings.HasPrefix(upperOriginalQueryStatement, "ANALYZE"):
+		commandTag = "ANALYZE"
+	case strings.HasPrefix(upperOriginalQueryStatement, "REINDEX "):
+		commandTag = "REINDEX"
+	case strings.HasPrefix(upperOriginalQueryStatement, "CLUSTER"):
+		commandTag = "CLUSTER"
+	case strings.HasPrefix(upperOriginalQueryStatement, "PREPARE "):
+		commandTag = "PREPARE"
+	case strings.HasPrefix(upperOriginalQueryStatement, "DEALLOCATE ALL"):
+		commandTag = "DEALLOCATE ALL"
+	case strings.HasPrefix(upperOriginalQueryStatement, "DEALLOCATE "):
+		commandTag = "DEALLOCATE"
 	default:
 		// Fallback to SELECT from FALLBACK_SQL_QUERY
 	}
 
-	messages = append(messages, &pgproto3.CommandComplete{CommandTag: []byte(commandTag)})
+	return commandTag
+}
+
+// COPY ... TO STDOUT -> CopyOutResponse, CopyData (row), ..., CopyDone, CommandComplete. COPY ... FROM STDIN is handled by rowsToCopyInMessages.
+// Sends the preceding messages and then batches of rows right away if the MessageWriter is set, returns the rest.
+func (queryHandler *QueryHandler) rowsToCopyMessages(rows *sql.Rows, originalQuery string, messages []pgproto3.Message) ([]pgproto3.Message, error) {
+	queryTree, err := pgQuery.Parse(originalQuery)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't parse query: %w. Original query: %s", err, originalQuery)
+	}
+	copyStatement := queryTree.Stmts[0].Stmt.GetCopyStmt()
+	options, err := queryHandler.QueryRemapper.parserCopy.Options(copyStatement)
+	if err != nil {
+		return nil, err
+	}
+	if copyStatement.IsFrom {
+		return queryHandler.rowsToCopyInMessages(rows, copyStatement, options, messages)
+	}
+
+	cols, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get column types: %w. Original query: %s", err, originalQuery)
+	}
+
+	messages = append(messages, &pgproto3.CopyOutResponse{OverallFormat: 0, ColumnFormatCodes: make([]uint16, len(cols))})
+	if options.Header {
+		columnNames := make([][]byte, len(cols))
+		for i, col := range cols {
+			columnNames[i] = []byte(col.Name())
+		}
+		messages = append(messages, &pgproto3.CopyData{Data: options.FormatRow(columnNames)})
+	}
+
+	var rowCount int64
+	for rows.Next() {
+		dataRow, err := queryHandler.generateDataRow(rows, cols, nil)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't get data row: %w. Original query: %s", err, originalQuery)
+		}
+		messages = append(messages, &pgproto3.CopyData{Data: options.FormatRow(dataRow.Values)})
+		rowCount++
+
+		if queryHandler.MessageWriter != nil && rowCount%COPY_STREAM_BATCH_ROW_COUNT == 0 {
+			queryHandler.MessageWriter(messages...)
+			messages = nil
+		}
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	messages = append(messages, &pgproto3.CopyDone{}, &pgproto3.CommandComplete{CommandTag: []byte("COPY " + common.Int64ToString(rowCount))})
 	return messages, nil
 }
 
-func (queryHandler *QueryHandler) generateRowDescription(cols []*sql.ColumnType) *pgproto3.RowDescription {
+// COPY ... FROM STDIN -> CopyInResponse, receives CopyData, ..., CopyDone, then appends the rows to the table and returns CommandComplete.
+// The rows contain no data, only the table columns to load.
+func (queryHandler *QueryHandler) rowsToCopyInMessages(rows *sql.Rows, copyStatement *pgQuery.CopyStmt, options CopyOptions, messages []pgproto3.Message) ([]pgproto3.Message, error) {
+	cols, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get column types: %w", err)
+	}
+	rows.Close()
+
+	if queryHandler.MessageWriter == nil || queryHandler.MessageReader == nil {
+		return nil, &PgError{Code: PG_ERROR_CODE_FEATURE_NOT_SUPPORTED, Message: "COPY FROM STDIN is only supported with the simple query protocol"}
+	}
+
+	csvFile, err := os.CreateTemp("", "bemidb-copy-*.csv")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(csvFile.Name())
+	defer csvFile.Close()
+
+	messages = append(messages, &pgproto3.CopyInResponse{OverallFormat: 0, ColumnFormatCodes: make([]uint16, len(cols))})
+	queryHandler.MessageWriter(messages...)
+
+	err = queryHandler.receiveCopyData(csvFile, options)
+	if err != nil {
+		return nil, err
+	}
+	err = csvFile.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	csvOptions := options
+	if options.Format == COPY_FORMAT_TEXT {
+		csvOptions = COPY_FROM_CSV_OPTIONS // Text rows are converted to CSV without the header
+	}
+	columnNames := make([]string, len(cols))
+	for i, col := range cols {
+		columnNames[i] = col.Name()
+	}
+	icebergSchemaTable := queryHandler.QueryRemapper.parserCopy.IcebergSchemaTable(copyStatement)
+
+	rowCount, err := queryHandler.QueryRemapper.IcebergWriter.AppendFromCsvFile(icebergSchemaTable, columnNames, csvFile.Name(), csvOptions)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't load COPY data into table %s: %w", icebergSchemaTable.String(), err)
+	}
+
+	return []pgproto3.Message{&pgproto3.CommandComplete{CommandTag: []byte("COPY " + common.Int64ToString(rowCount))}}, nil
+}
+
+// Writes CopyData messages to the writer until CopyDone, rows in the text format are converted to CSV.
+// After an error, the rest of the data is discarded until CopyDone or CopyFail like in Postgres.
+func (queryHandler *QueryHandler) receiveCopyData(writer io.Writer, options CopyOptions) error {
+	var writeErr error
+	var pendingData []byte // Rows can be split across CopyData messages
+	skipHeader := options.Header
+	reachedEnd := false
+
+	writeTextRows := func(data []byte) error {
+		for !reachedEnd && len(data) > 0 {
+			line, rest, _ := bytes.Cut(data, []byte("\n"))
+			data = rest
+			line = bytes.TrimSuffix(line, []byte("\r"))
+			switch {
+			case skipHeader:
+				skipHeader = false
+			case string(line) == "\\.": // End-of-data marker
+				reachedEnd = true
+			default:
+				_, err := writer.Write(COPY_FROM_CSV_OPTIONS.FormatRow(options.ParseTextRow(line)))
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	for {
+		message, err := queryHandler.MessageReader()
+		if err != nil {
+			return err
+		}
+
+		switch message := message.(type) {
+		case *pgproto3.CopyData:
+			if writeErr != nil {
+				continue
+			}
+			if options.Format == COPY_FORMAT_CSV {
+				_, writeErr = writer.Write(message.Data)
+				continue
+			}
+			pendingData = append(pendingData, message.Data...)
+			lastNewlineIndex := bytes.LastIndexByte(pendingData, '\n')
+			if lastNewlineIndex >= 0 {
+				writeErr = writeTextRows(pendingData[:lastNewlineIndex+1])
+				pendingData = append([]byte{}, pendingData[lastNewlineIndex+1:]...)
+			}
+		case *pgproto3.CopyDone:
+			if writeErr == nil && options.Format == COPY_FORMAT_TEXT {
+				writeErr = writeTextRows(pendingData) // Last row without a trailing newline
+			}
+			return writeErr
+		case *pgproto3.CopyFail:
+			return &PgError{Code: PG_ERROR_CODE_QUERY_CANCELED, Message: "COPY from stdin failed: " + message.Message}
+		case *pgproto3.Flush, *pgproto3.Sync:
+			// Ignored during COPY
+		default:
+			return &PgError{Code: PG_ERROR_CODE_PROTOCOL_VIOLATION, Message: fmt.Sprintf("unexpected message type %T during COPY from stdin", message)}
+		}
+	}
+}
+
+func (queryHandler *QueryHandler) generateRowDescription(cols []*sql.ColumnType, resultFormatCodes []int16) *pgproto3.RowDescription {
 	description := pgproto3.RowDescription{Fields: []pgproto3.FieldDescription{}}
 
-	for _, col := range cols {
+	for i, col := range cols {
 		typeIod := queryHandler.ResponseHandler.ColumnDescriptionTypeOid(col)
 
 		if col.Name() == "Success" && typeIod == pgtype.BoolOID && len(cols) == 1 {
@@ -313,13 +1510,13 @@ func (queryHandler *QueryHandler) generateRowDescription(cols []*sql.ColumnType)
 			DataTypeOID:          typeIod,
 			DataTypeSize:         -1,
 			TypeModifier:         -1,
-			Format:               0,
+			Format:               queryHandler.ResponseHandler.ColumnFormatCode(col, i, resultFormatCodes),
 		})
 	}
 	return &description
 }
 
-func (queryHandler *QueryHandler) generateDataRow(rows *sql.Rows, cols []*sql.ColumnType) (*pgproto3.DataRow, error) {
+func (queryHandler *QueryHandler) generateDataRow(rows *sql.Rows, cols []*sql.ColumnType, resultFormatCodes []int16) (*pgproto3.DataRow, error) {
 	valuePointers := make([]interface{}, len(cols))
 	for i, col := range cols {
 		valuePointers[i] = queryHandler.ResponseHandler.RowValuePointer(col)
@@ -332,10 +1529,121 @@ func (queryHandler *QueryHandler) generateDataRow(rows *sql.Rows, cols []*sql.Co
 
 	var values [][]byte
 	for i, valuePointer := range valuePointers {
-		value := queryHandler.ResponseHandler.RowValueBytes(valuePointer, cols[i])
+		// timestamptz values are returned in the session's time zone like in Postgres
+		if nullTime, ok := valuePointer.(*sql.NullTime); ok && nullTime.Valid && cols[i].DatabaseTypeName() == "TIMESTAMPTZ" && queryHandler.QueryRemapper.Session.TimeZone != nil {
+			nullTime.Time = nullTime.Time.In(queryHandler.QueryRemapper.Session.TimeZone)
+		}
+
+		var value []byte
+		if queryHandler.ResponseHandler.ColumnFormatCode(cols[i], i, resultFormatCodes) == pgtype.BinaryFormatCode {
+			value, err = queryHandler.ResponseHandler.RowValueBinaryBytes(valuePointer, cols[i])
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			value = queryHandler.ResponseHandler.RowValueBytes(valuePointer, cols[i])
+		}
 		values = append(values, value)
 	}
 	dataRow := pgproto3.DataRow{Values: values}
 
 	return &dataRow, nil
 }
+
+// BEGIN / START TRANSACTION / COMMIT / END / ROLLBACK / ABORT / SAVEPOINT / RELEASE, run in order with the other statements of the query
+func isTransactionCommand(originalQuery string) bool {
+	upperOriginalQuery := strings.ToUpper(strings.TrimSpace(originalQuery))
+	for _, keyword := range []string{"BEGIN", "START TRANSACTION", "COMMIT", "END", "ROLLBACK", "ABORT", "SAVEPOINT", "RELEASE"} {
+		if upperOriginalQuery == keyword || strings.HasPrefix(upperOriginalQuery, keyword+" ") || strings.HasPrefix(upperOriginalQuery, keyword+";") {
+			return true
+		}
+	}
+	return false
+}
+
+// DECLARE / FETCH / MOVE / CLOSE, run in order with the other statements of the query
+func isCursorCommand(originalQuery string) bool {
+	upperOriginalQuery := strings.ToUpper(strings.TrimSpace(originalQuery))
+	for _, keyword := range []string{"DECLARE ", "FETCH ", "MOVE ", "CLOSE "} {
+		if strings.HasPrefix(upperOriginalQuery, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+func parseCursorCommand(originalQuery string) (*pgQuery.Node, error) {
+	queryTree, err := pgQuery.Parse(originalQuery)
+	if err != nil {
+		return nil, err
+	}
+	if len(queryTree.Stmts) != 1 || (queryTree.Stmts[0].Stmt.GetDeclareCursorStmt() == nil && queryTree.Stmts[0].Stmt.GetFetchStmt() == nil && queryTree.Stmts[0].Stmt.GetClosePortalStmt() == nil) {
+		return nil, fmt.Errorf("not a cursor statement: %s", originalQuery)
+	}
+	return queryTree.Stmts[0].Stmt, nil
+}
+
+// Statements that may change temp tables in a transaction, which can't be rolled back to a savepoint
+func isTransactionChangeCommand(originalQuery string) bool {
+	if isRowCountCommand(originalQuery) {
+		return true
+	}
+	upperOriginalQuery := strings.ToUpper(originalQuery)
+	for _, keyword := range []string{"INSERT ", "UPDATE ", "DELETE ", "CREATE ", "DROP ", "ALTER ", "TRUNCATE "} {
+		if strings.HasPrefix(upperOriginalQuery, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+func isExplainCommand(originalQuery string) bool {
+	return strings.HasPrefix(strings.ToUpper(originalQuery), "EXPLAIN ")
+}
+
+// INSERT / UPDATE / DELETE / CREATE TEMP TABLE [AS] return the number of affected rows from DuckDB in a "Count" column instead of rows
+func isRowCountCommand(originalQuery string) bool {
+	return rowCountCommand(originalQuery) != ""
+}
+
+// INSERT / UPDATE / DELETE, also after a WITH clause -> "INSERT" / "UPDATE" / "DELETE"
+// CREATE TEMP TABLE -> "CREATE TABLE"
+// Other statements -> ""
+func rowCountCommand(originalQuery string) string {
+	upperOriginalQuery := strings.ToUpper(originalQuery)
+	for _, command := range []string{"INSERT", "UPDATE", "DELETE"} {
+		if strings.HasPrefix(upperOriginalQuery, command+" ") {
+			return command
+		}
+	}
+	if strings.HasPrefix(upperOriginalQuery, "CREATE TEMP TABLE ") || strings.HasPrefix(upperOriginalQuery, "CREATE TEMPORARY TABLE ") {
+		return "CREATE TABLE"
+	}
+	if !strings.HasPrefix(upperOriginalQuery, "WITH ") {
+		return ""
+	}
+
+	queryTree, err := pgQuery.Parse(originalQuery)
+	if err != nil || len(queryTree.Stmts) != 1 {
+		return ""
+	}
+	switch node := queryTree.Stmts[0].Stmt; {
+	case node.GetInsertStmt() != nil:
+		return "INSERT"
+	case node.GetUpdateStmt() != nil:
+		return "UPDATE"
+	case node.GetDeleteStmt() != nil:
+		return "DELETE"
+	}
+	return ""
+}
+
+func dataRowCount(messages []pgproto3.Message) int64 {
+	var rowCount int64
+	for _, message := range messages {
+		if _, ok := message.(*pgproto3.DataRow); ok {
+			rowCount++
+		}
+	}
+	return rowCount
+}
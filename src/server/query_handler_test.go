@@ -1,13 +1,19 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"encoding/binary"
+	"errors"
 	"flag"
 	"os"
+	"path/filepath"
 	"reflect"
+	"slices"
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgproto3"
@@ -123,21 +129,11 @@ func TestHandleQuery(t *testing.T) {
 				"types":       {uint32ToString(pgtype.Int8OID)},
 				"values":      {"1"},
 			},
-			"SELECT pg_catalog.aclexplode(db.datacl) AS d FROM pg_catalog.pg_database db": {
-				"description": {"d"},
-				"types":       {uint32ToString(pgtype.JSONOID)},
-				"values":      {""},
-			},
 			"SELECT TRIM (BOTH '\"' FROM pg_catalog.pg_get_indexdef(1, 1, false)) AS trim": {
 				"description": {"trim"},
 				"types":       {uint32ToString(pgtype.TextOID)},
 				"values":      {""},
 			},
-			"SELECT (d).grantee AS grantee, (d).grantor AS grantor, (d).is_grantable AS is_grantable, (d).privilege_type AS privilege_type FROM (SELECT pg_catalog.aclexplode(db.datacl) AS d FROM pg_catalog.pg_database db WHERE db.oid = 16388::OID) a": {
-				"description": {"grantee", "grantor", "is_grantable", "privilege_type"},
-				"types":       {uint32ToString(pgtype.JSONOID), uint32ToString(pgtype.JSONOID), uint32ToString(pgtype.JSONOID), uint32ToString(pgtype.JSONOID)},
-				"values":      {"", "", "", ""},
-			},
 			"SELECT format('Hello %s, %s, %1$s', 'World', 'Earth') AS str": {
 				"description": {"str"},
 				"types":       {uint32ToString(pgtype.TextOID)},
@@ -223,7 +219,74 @@ func TestHandleQuery(t *testing.T) {
 				"types":       {uint32ToString(pgtype.TextOID)},
 				"values":      {"2024-01-15"},
 			},
+			"SELECT to_tsvector('simple', 'The fat Rats') AS tsvector, plainto_tsquery('simple', 'fat rats') AS tsquery": {
+				"description": {"tsvector", "tsquery"},
+				"types":       {uint32ToString(pgtype.TextOID), uint32ToString(pgtype.TextOID)},
+				"values":      {"'fat' 'rats' 'the'", "'fat' & 'rats'"},
+			},
+			"SELECT to_tsvector('The fat rats') @@ plainto_tsquery('fat rats') AS match, '''cat'':3 ''fat'':2'::tsvector @@ to_tsquery('fat & !rat | dog') AS match_query, to_tsvector('fat') @@ NULL AS null_query": {
+				"description": {"match", "match_query", "null_query"},
+				"types":       {uint32ToString(pgtype.BoolOID), uint32ToString(pgtype.BoolOID), uint32ToString(pgtype.BoolOID)},
+				"values":      {"t", "t", ""},
+			},
+			"SELECT ARRAY[1, 2] && ARRAY[2, 3] AS overlap, ARRAY['a', 'b'] @> '{a}' AS contains, ARRAY['a'] <@ '{a,b}' AS contained, 3 > ALL('{1,2}') AS all, 'c' < ANY('{a,b}') AS any": {
+				"description": {"overlap", "contains", "contained", "all", "any"},
+				"types":       {uint32ToString(pgtype.BoolOID), uint32ToString(pgtype.BoolOID), uint32ToString(pgtype.BoolOID), uint32ToString(pgtype.BoolOID), uint32ToString(pgtype.BoolOID)},
+				"values":      {"t", "t", "t", "t", "f"},
+			},
+			`SELECT ARRAY['a,b', 'c'] @> '{"a,b"}' AS quoted, 'c' = ANY('{a,NULL}') AS null_element, ARRAY['a'] @> '{}' AS empty, 3 > ANY(x) AS any_column, 3 > ALL(x) AS all_column FROM (SELECT ARRAY[1, 5] AS x) t`: {
+				"description": {"quoted", "null_element", "empty", "any_column", "all_column"},
+				"types":       {uint32ToString(pgtype.BoolOID), uint32ToString(pgtype.BoolOID), uint32ToString(pgtype.BoolOID), uint32ToString(pgtype.BoolOID), uint32ToString(pgtype.BoolOID)},
+				"values":      {"t", "", "t", "t", "f"},
+			},
+		})
+	})
+
+	t.Run("Returns the privileges of the databases from aclexplode", func(t *testing.T) {
+		messages, err := queryHandler.HandleSimpleQuery("SELECT pg_catalog.aclexplode(db.datacl) AS d FROM pg_catalog.pg_database db WHERE db.oid = 16388::OID")
+
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{
+			&pgproto3.RowDescription{},
+			&pgproto3.DataRow{},
+			&pgproto3.DataRow{},
+			&pgproto3.DataRow{},
+			&pgproto3.CommandComplete{},
 		})
+		testDataRowValues(t, messages[1], []string{"(10,10,CREATE,f)"})
+		testDataRowValues(t, messages[2], []string{"(10,10,TEMPORARY,f)"})
+		testDataRowValues(t, messages[3], []string{"(10,10,CONNECT,f)"})
+
+		messages, err = queryHandler.HandleSimpleQuery("SELECT (d).grantee AS grantee, (d).grantor AS grantor, (d).is_grantable AS is_grantable, (d).privilege_type AS privilege_type FROM (SELECT pg_catalog.aclexplode(db.datacl) AS d FROM pg_catalog.pg_database db WHERE db.oid = 16388::OID) a")
+
+		testNoError(t, err)
+		testRowDescription(t, messages[0], []string{"grantee", "grantor", "is_grantable", "privilege_type"}, []string{uint32ToString(pgtype.OIDOID), uint32ToString(pgtype.OIDOID), uint32ToString(pgtype.BoolOID), uint32ToString(pgtype.TextOID)})
+		testDataRowValues(t, messages[1], []string{"10", "10", "f", "CREATE"})
+	})
+
+	t.Run("Leaves JSON containment with an empty object as is", func(t *testing.T) {
+		queryStatements, _, err := queryHandler.QueryRemapper.ParseAndRemapQuery(`SELECT jsonb_column @> '{}' FROM postgres.test_table`)
+
+		testNoError(t, err)
+		if strings.Contains(queryStatements[0], "list_has_all") {
+			t.Errorf("Expected '{}' not to be compared as an empty array, got %s", queryStatements[0])
+		}
+	})
+
+	t.Run("Returns an error for unsupported full-text search configurations and tsquery syntax", func(t *testing.T) {
+		for query, expectedError := range map[string]string{
+			"SELECT to_tsvector('english', 'The fat rats')":                         `text search configuration "english" is not supported`,
+			"SELECT plainto_tsquery('english', 'fat rats')":                         `text search configuration "english" is not supported`,
+			"SELECT to_tsquery('fat & (rat | cat)')":                                `tsquery "fat & (rat | cat)" is not supported`,
+			"SELECT to_tsvector('fat rats') @@ to_tsquery('simple', 'fat <-> rat')": `tsquery "fat <-> rat" is not supported`,
+			"SELECT to_tsvector('fat rats') @@ 'ra:*'::tsquery":                     `tsquery "ra:*" is not supported`,
+		} {
+			_, err := queryHandler.HandleSimpleQuery(query)
+
+			if err == nil || !strings.Contains(err.Error(), expectedError) {
+				t.Errorf("Expected the error of '%s' to contain '%s', got %v", query, expectedError, err)
+			}
+		}
 	})
 
 	t.Run("PG system tables", func(t *testing.T) {
@@ -238,6 +301,16 @@ func TestHandleQuery(t *testing.T) {
 				"types":       {uint32ToString(pgtype.TextOID)},
 				"values":      {"test_table"},
 			},
+			"SELECT lanname FROM pg_catalog.pg_language WHERE lanispl": {
+				"description": {"lanname"},
+				"types":       {uint32ToString(pgtype.TextOID)},
+				"values":      {"plpgsql"},
+			},
+			"SELECT name, installed_version FROM pg_catalog.pg_available_extensions": {
+				"description": {"name", "installed_version"},
+				"types":       {uint32ToString(pgtype.TextOID), uint32ToString(pgtype.TextOID)},
+				"values":      {"plpgsql", "1.0"},
+			},
 			"SELECT oid FROM pg_catalog.pg_extension": {
 				"description": {"oid"},
 				"types":       {uint32ToString(pgtype.OIDOID)},
@@ -253,6 +326,11 @@ func TestHandleQuery(t *testing.T) {
 				"types":       {uint32ToString(pgtype.OIDOID), uint32ToString(pgtype.TextOID), uint32ToString(pgtype.Int8OID)},
 				"values":      {"16388", "bemidb", "10"},
 			},
+			"SELECT current_database()": {
+				"description": {"current_database"},
+				"types":       {uint32ToString(pgtype.TextOID)},
+				"values":      {"bemidb"},
+			},
 			"SELECT COALESCE(NULL, (SELECT datname FROM pg_database WHERE datname = 'bemidb')) AS datname": {
 				"description": {"datname"},
 				"types":       {uint32ToString(pgtype.TextOID)},
@@ -283,6 +361,11 @@ func TestHandleQuery(t *testing.T) {
 				"types":       {uint32ToString(pgtype.Int8OID)},
 				"values":      {},
 			},
+			"SELECT locktype, mode, granted FROM pg_catalog.pg_locks": {
+				"description": {"locktype", "mode", "granted"},
+				"types":       {uint32ToString(pgtype.TextOID), uint32ToString(pgtype.TextOID), uint32ToString(pgtype.BoolOID)},
+				"values":      {"virtualxid", "ExclusiveLock", "t"},
+			},
 			"SELECT schemaname, matviewname AS objectname FROM pg_catalog.pg_matviews": {
 				"description": {"schemaname", "objectname"},
 				"types":       {uint32ToString(pgtype.TextOID), uint32ToString(pgtype.TextOID)},
@@ -292,11 +375,44 @@ func TestHandleQuery(t *testing.T) {
 				"description": {"schemaname", "viewname", "viewowner", "definition"},
 				"types":       {uint32ToString(pgtype.TextOID), uint32ToString(pgtype.TextOID), uint32ToString(pgtype.TextOID), uint32ToString(pgtype.TextOID)},
 			},
+			"SELECT name, utc_offset FROM pg_catalog.pg_timezone_names WHERE name = 'UTC'": {
+				"description": {"name", "utc_offset"},
+				"types":       {uint32ToString(pgtype.TextOID), uint32ToString(pgtype.IntervalOID)},
+				"values":      {"UTC", "0 months 0 days 0 microseconds"},
+			},
+			"SELECT abbrev, utc_offset, is_dst FROM pg_catalog.pg_timezone_abbrevs WHERE abbrev = 'EDT'": {
+				"description": {"abbrev", "utc_offset", "is_dst"},
+				"types":       {uint32ToString(pgtype.TextOID), uint32ToString(pgtype.IntervalOID), uint32ToString(pgtype.BoolOID)},
+				"values":      {"EDT", "0 months 0 days -14400000000 microseconds", "t"},
+			},
 			"SELECT oid FROM pg_collation": {
 				"description": {"oid"},
 				"types":       {uint32ToString(pgtype.OIDOID)},
 				"values":      {"100"},
 			},
+			"SELECT oid, amname, amtype FROM pg_am WHERE amname = 'btree'": {
+				"description": {"oid", "amname", "amtype"},
+				"types":       {uint32ToString(pgtype.OIDOID), uint32ToString(pgtype.TextOID), uint32ToString(pgtype.TextOID)},
+				"values":      {"403", "btree", "i"},
+			},
+			"SELECT oprname, oprleft, oprright FROM pg_catalog.pg_operator WHERE oid = 96": {
+				"description": {"oprname", "oprleft", "oprright"},
+				"types":       {uint32ToString(pgtype.TextOID), uint32ToString(pgtype.Int8OID), uint32ToString(pgtype.Int8OID)},
+				"values":      {"=", "23", "23"},
+			},
+			"SELECT f.opfname, am.amname FROM pg_catalog.pg_opfamily f JOIN pg_catalog.pg_am am ON am.oid = f.opfmethod WHERE f.oid = 1977": {
+				"description": {"opfname", "amname"},
+				"types":       {uint32ToString(pgtype.TextOID), uint32ToString(pgtype.TextOID)},
+				"values":      {"integer_ops", "hash"},
+			},
+			"SELECT conname, confrelid FROM pg_catalog.pg_constraint WHERE contype = 'f'": {
+				"description": {"conname", "confrelid"},
+				"types":       {uint32ToString(pgtype.TextOID), uint32ToString(pgtype.Int8OID)},
+			},
+			"SELECT classid, objid, refobjid, deptype FROM pg_catalog.pg_depend WHERE classid = 2606": {
+				"description": {"classid", "objid", "refobjid", "deptype"},
+				"types":       {uint32ToString(pgtype.Int8OID), uint32ToString(pgtype.Int8OID), uint32ToString(pgtype.Int8OID), uint32ToString(pgtype.TextOID)},
+			},
 			"SELECT * FROM pg_opclass": {
 				"description": {"oid", "opcmethod", "opcname", "opcnamespace", "opcowner", "opcfamily", "opcintype", "opcdefault", "opckeytype"},
 				"types":       {uint32ToString(pgtype.OIDOID), uint32ToString(pgtype.Int8OID), uint32ToString(pgtype.TextOID), uint32ToString(pgtype.Int8OID), uint32ToString(pgtype.Int8OID), uint32ToString(pgtype.Int8OID), uint32ToString(pgtype.Int8OID), uint32ToString(pgtype.BoolOID), uint32ToString(pgtype.Int8OID)},
@@ -420,6 +536,11 @@ func TestHandleQuery(t *testing.T) {
 				"types":       {uint32ToString(pgtype.OIDOID)},
 				"values":      {"16"},
 			},
+			"SELECT DISTINCT ON (a) c FROM (VALUES (1, NULL, 'a'), (1, 2, 'b')) t(a, b, c) ORDER BY a, b DESC": {
+				"description": {"c"},
+				"types":       {uint32ToString(pgtype.TextOID)},
+				"values":      {"a"},
+			},
 		})
 	})
 
@@ -516,6 +637,36 @@ func TestHandleQuery(t *testing.T) {
 				"types":       {uint32ToString(pgtype.TextOID)},
 				"values":      {"numeric"},
 			},
+			"SELECT is_nullable FROM information_schema.columns WHERE table_schema = 'postgres' AND table_name = 'test_table' AND column_name = 'id'": {
+				"description": {"is_nullable"},
+				"types":       {uint32ToString(pgtype.TextOID)},
+				"values":      {"NO"},
+			},
+			"SELECT is_nullable FROM information_schema.columns WHERE table_schema = 'postgres' AND table_name = 'test_table' AND column_name = 'bool_column'": {
+				"description": {"is_nullable"},
+				"types":       {uint32ToString(pgtype.TextOID)},
+				"values":      {"YES"},
+			},
+			"SELECT character_maximum_length FROM information_schema.columns WHERE table_schema = 'postgres' AND table_name = 'test_table' AND column_name = 'varchar_column'": {
+				"description": {"character_maximum_length"},
+				"types":       {uint32ToString(pgtype.Int4OID)},
+				"values":      {"255"},
+			},
+			"SELECT character_maximum_length FROM information_schema.columns WHERE table_schema = 'postgres' AND table_name = 'test_table' AND column_name = 'bpchar_column'": {
+				"description": {"character_maximum_length"},
+				"types":       {uint32ToString(pgtype.Int4OID)},
+				"values":      {"10"},
+			},
+			"SELECT numeric_precision, numeric_scale FROM information_schema.columns WHERE table_schema = 'postgres' AND table_name = 'test_table' AND column_name = 'numeric_column'": {
+				"description": {"numeric_precision", "numeric_scale"},
+				"types":       {uint32ToString(pgtype.Int4OID), uint32ToString(pgtype.Int4OID)},
+				"values":      {"40", "2"},
+			},
+			"SELECT numeric_precision, numeric_scale FROM information_schema.columns WHERE table_schema = 'postgres' AND table_name = 'test_table' AND column_name = 'numeric_column_without_precision'": {
+				"description": {"numeric_precision", "numeric_scale"},
+				"types":       {uint32ToString(pgtype.Int4OID), uint32ToString(pgtype.Int4OID)},
+				"values":      {"", ""},
+			},
 			"SELECT udt_name FROM information_schema.columns WHERE table_schema = 'postgres' AND table_name = 'test_table' AND column_name = 'date_column'": {
 				"description": {"udt_name"},
 				"types":       {uint32ToString(pgtype.TextOID)},
@@ -690,13 +841,133 @@ func TestHandleQuery(t *testing.T) {
 				"types":       {uint32ToString(pgtype.Int4OID)},
 				"values":      {"1"},
 			},
-			// TODO: add support for partitioned tables
-			// "SELECT COUNT(*) FROM postgres.partitioned_table": {
-			// 	"description": {"count"},
-			// 	"types":       {uint32ToString(pgtype.Int8OID)},
-			// 	"values":      {"3"},
-			// },
+			"SELECT COUNT(*) FROM postgres.partitioned_table": {
+				"description": {"count"},
+				"types":       {uint32ToString(pgtype.Int8OID)},
+				"values":      {"3"},
+			},
+		})
+	})
+
+	t.Run("Resolves unqualified table names with SET search_path", func(t *testing.T) {
+		sessionQueryHandler := queryHandler.WithNewSession()
+
+		_, err := sessionQueryHandler.HandleSimpleQuery("SET search_path = analytics, postgres, \"$user\", public")
+		testNoError(t, err)
+
+		testResponseByQuery(t, sessionQueryHandler, map[string]map[string][]string{
+			"SHOW search_path": {
+				"description": {"search_path"},
+				"types":       {uint32ToString(pgtype.TextOID)},
+				"values":      {`analytics, postgres, "$user", public`},
+			},
+			"SELECT COUNT(*) AS count FROM test_table": {
+				"description": {"count"},
+				"types":       {uint32ToString(pgtype.Int8OID)},
+				"values":      {"2"},
+			},
+			"SELECT test_table.id FROM test_table WHERE test_table.id = 1": {
+				"description": {"id"},
+				"types":       {uint32ToString(pgtype.Int4OID)},
+				"values":      {"1"},
+			},
+		})
+
+		_, err = sessionQueryHandler.HandleSimpleQuery("RESET search_path")
+		testNoError(t, err)
+
+		testResponseByQuery(t, sessionQueryHandler, map[string]map[string][]string{
+			"SHOW search_path": {
+				"description": {"search_path"},
+				"types":       {uint32ToString(pgtype.TextOID)},
+				"values":      {`"$user", public`},
+			},
+		})
+	})
+
+	t.Run("Matches identifiers like Postgres with BEMIDB_IDENTIFIER_CASE=postgres", func(t *testing.T) {
+		queryHandler.Config.IdentifierCase = IDENTIFIER_CASE_POSTGRES
+		defer func() { queryHandler.Config.IdentifierCase = IDENTIFIER_CASE_DUCKDB }()
+		sessionQueryHandler := queryHandler.WithNewSession()
+
+		_, err := sessionQueryHandler.HandleSimpleQuery(`CREATE TEMP TABLE mixed_case ("timeMsColumn" INT, id INT); INSERT INTO mixed_case VALUES (1, 2)`)
+		testNoError(t, err)
+
+		testResponseByQuery(t, sessionQueryHandler, map[string]map[string][]string{
+			`SELECT "timeMsColumn", ID FROM mixed_case`: {
+				"description": {"timeMsColumn", "id"},
+				"types":       {uint32ToString(pgtype.Int4OID), uint32ToString(pgtype.Int4OID)},
+				"values":      {"1", "2"},
+			},
+			`SELECT m."timeMsColumn" AS "timeMs" FROM mixed_case m ORDER BY "timeMs"`: {
+				"description": {"timeMs"},
+				"types":       {uint32ToString(pgtype.Int4OID)},
+				"values":      {"1"},
+			},
+		})
+
+		for query, expectedMessage := range map[string]string{
+			"SELECT timeMsColumn FROM mixed_case": `column "timemscolumn" does not exist`,
+			`SELECT "ID" FROM mixed_case`:         `column "ID" does not exist`,
+		} {
+			_, err = sessionQueryHandler.HandleSimpleQuery(query)
+
+			var pgError *PgError
+			if !errors.As(err, &pgError) || pgError.Code != PG_ERROR_CODE_UNDEFINED_COLUMN || pgError.Message != expectedMessage {
+				t.Errorf("Expected the error of '%s' to be '%s', got %v", query, expectedMessage, err)
+			}
+		}
+
+		queryHandler.Config.IdentifierCase = IDENTIFIER_CASE_DUCKDB
+		messages, err := sessionQueryHandler.HandleSimpleQuery("SELECT timeMsColumn FROM mixed_case")
+
+		testNoError(t, err)
+		testRowDescription(t, messages[0], []string{"timeMsColumn"}, []string{uint32ToString(pgtype.Int4OID)})
+	})
+
+	t.Run("Matches identifiers of lake tables like Postgres with BEMIDB_IDENTIFIER_CASE=postgres", func(t *testing.T) {
+		queryHandler.Config.IdentifierCase = IDENTIFIER_CASE_POSTGRES
+		defer func() { queryHandler.Config.IdentifierCase = IDENTIFIER_CASE_DUCKDB }()
+
+		testResponseByQuery(t, queryHandler, map[string]map[string][]string{
+			"SELECT ID FROM postgres.test_table ORDER BY id LIMIT 1": {
+				"description": {"id"},
+				"types":       {uint32ToString(pgtype.Int4OID)},
+				"values":      {"1"},
+			},
 		})
+
+		for query, expectedError := range map[string]PgError{
+			`SELECT "ID" FROM postgres.test_table`:     {Code: PG_ERROR_CODE_UNDEFINED_COLUMN, Message: `column "ID" does not exist`, Hint: `Perhaps you meant to reference the column "id".`},
+			`SELECT id FROM postgres."Test_Table"`:     {Code: PG_ERROR_CODE_UNDEFINED_TABLE, Message: `relation "Test_Table" does not exist`},
+			`SELECT t."ID" FROM postgres.test_table t`: {Code: PG_ERROR_CODE_UNDEFINED_COLUMN, Message: `column "ID" does not exist`, Hint: `Perhaps you meant to reference the column "id".`},
+		} {
+			_, err := queryHandler.HandleSimpleQuery(query)
+
+			var pgError *PgError
+			if !errors.As(err, &pgError) || pgError.Code != expectedError.Code || pgError.Message != expectedError.Message || pgError.Hint != expectedError.Hint {
+				t.Errorf("Expected the error of '%s' to be '%s', got %v", query, expectedError.Message, err)
+			}
+		}
+	})
+
+	t.Run("Matches identifiers of temp tables only of the session with BEMIDB_IDENTIFIER_CASE=postgres", func(t *testing.T) {
+		queryHandler.Config.IdentifierCase = IDENTIFIER_CASE_POSTGRES
+		defer func() { queryHandler.Config.IdentifierCase = IDENTIFIER_CASE_DUCKDB }()
+		otherSessionQueryHandler := queryHandler.WithNewSession()
+		sessionQueryHandler := queryHandler.WithNewSession()
+
+		_, err := otherSessionQueryHandler.HandleSimpleQuery(`CREATE TEMP TABLE shared_name ("Value" INT)`)
+		testNoError(t, err)
+		_, err = sessionQueryHandler.HandleSimpleQuery(`CREATE TEMP TABLE shared_name (value INT)`)
+		testNoError(t, err)
+
+		_, err = sessionQueryHandler.HandleSimpleQuery(`SELECT "Value" FROM shared_name`)
+
+		var pgError *PgError
+		if !errors.As(err, &pgError) || pgError.Code != PG_ERROR_CODE_UNDEFINED_COLUMN || pgError.Hint != `Perhaps you meant to reference the column "value".` {
+			t.Errorf("Expected an undefined column error with a hint to the session's column, got %v", err)
+		}
 	})
 
 	t.Run("Column types", func(t *testing.T) {
@@ -1126,6 +1397,31 @@ func TestHandleQuery(t *testing.T) {
 				"types":       {uint32ToString(pgtype.Int8OID)},
 				"values":      {"40"},
 			},
+			"SELECT attnotnull FROM pg_attribute WHERE attrelid = '\"postgres\".\"test_table\"'::regclass AND attname = 'id'": {
+				"description": {"attnotnull"},
+				"types":       {uint32ToString(pgtype.BoolOID)},
+				"values":      {"t"},
+			},
+			"SELECT attnotnull FROM pg_attribute WHERE attrelid = '\"postgres\".\"test_table\"'::regclass AND attname = 'bool_column'": {
+				"description": {"attnotnull"},
+				"types":       {uint32ToString(pgtype.BoolOID)},
+				"values":      {"f"},
+			},
+			"SELECT atttypmod, format_type(atttypid, atttypmod) AS format_type FROM pg_attribute WHERE attrelid = '\"postgres\".\"test_table\"'::regclass AND attname = 'varchar_column'": {
+				"description": {"atttypmod", "format_type"},
+				"types":       {uint32ToString(pgtype.Int4OID), uint32ToString(pgtype.TextOID)},
+				"values":      {"259", "varchar(255)"},
+			},
+			"SELECT atttypmod, format_type(atttypid, atttypmod) AS format_type FROM pg_attribute WHERE attrelid = '\"postgres\".\"test_table\"'::regclass AND attname = 'numeric_column'": {
+				"description": {"atttypmod", "format_type"},
+				"types":       {uint32ToString(pgtype.Int4OID), uint32ToString(pgtype.TextOID)},
+				"values":      {"2621446", "numeric(40,2)"},
+			},
+			"SELECT atttypmod, format_type(atttypid, atttypmod) AS format_type FROM pg_attribute WHERE attrelid = '\"postgres\".\"test_table\"'::regclass AND attname = 'numeric_column_without_precision'": {
+				"description": {"atttypmod", "format_type"},
+				"types":       {uint32ToString(pgtype.Int4OID), uint32ToString(pgtype.TextOID)},
+				"values":      {"-1", "numeric"},
+			},
 			"SELECT objoid, classoid, objsubid, description FROM pg_description WHERE classoid = 'pg_class'::regclass": {
 				"description": {"objoid", "classoid", "objsubid", "description"},
 				"types":       {uint32ToString(pgtype.OIDOID), uint32ToString(pgtype.TextOID), uint32ToString(pgtype.Int4OID), uint32ToString(pgtype.TextOID)},
@@ -1236,6 +1532,11 @@ func TestHandleQuery(t *testing.T) {
 				"types":       {uint32ToString(pgtype.TextOID)},
 				"values":      {"abort"},
 			},
+			"SELECT word, catcode, catdesc FROM pg_catalog.pg_get_keywords() WHERE word = 'select'": {
+				"description": {"word", "catcode", "catdesc"},
+				"types":       {uint32ToString(pgtype.TextOID), uint32ToString(pgtype.TextOID), uint32ToString(pgtype.TextOID)},
+				"values":      {"select", "R", "reserved"},
+			},
 			"SELECT * FROM generate_series(1, 2) AS series(index) LIMIT 1": {
 				"description": {"index"},
 				"types":       {uint32ToString(pgtype.Int8OID)},
@@ -1385,9 +1686,105 @@ func TestHandleQuery(t *testing.T) {
 				"types":       {uint32ToString(pgtype.Int4OID)},
 				"values":      {"2"},
 			},
+			"SELECT b FROM (VALUES (1), (NULL)) t(b) ORDER BY b LIMIT 1": {
+				"description": {"b"},
+				"types":       {uint32ToString(pgtype.Int4OID)},
+				"values":      {"1"},
+			},
+			"SELECT b FROM (VALUES (1), (NULL)) t(b) ORDER BY b DESC LIMIT 1": {
+				"description": {"b"},
+				"types":       {uint32ToString(pgtype.Int4OID)},
+				"values":      {""},
+			},
+			"SELECT b FROM (VALUES (1), (NULL)) t(b) ORDER BY b NULLS FIRST LIMIT 1": {
+				"description": {"b"},
+				"types":       {uint32ToString(pgtype.Int4OID)},
+				"values":      {""},
+			},
+			"SELECT b FROM (SELECT b, row_number() OVER (ORDER BY b DESC) AS r FROM (VALUES (1), (NULL)) t(b)) s WHERE r = 1": {
+				"description": {"b"},
+				"types":       {uint32ToString(pgtype.Int4OID)},
+				"values":      {""},
+			},
+			"SELECT c FROM (VALUES ('b'), ('B'), ('a')) t(c) ORDER BY c COLLATE \"C\" LIMIT 1": {
+				"description": {"c"},
+				"types":       {uint32ToString(pgtype.TextOID)},
+				"values":      {"B"},
+			},
+			"SELECT string_agg(c, ',' ORDER BY c COLLATE \"en_US.utf8\") AS s FROM (VALUES ('b'), ('B'), ('a')) t(c)": {
+				"description": {"s"},
+				"types":       {uint32ToString(pgtype.TextOID)},
+				"values":      {"a,b,B"},
+			},
+			"SELECT b FROM (VALUES (1, 'x'), (2, 'y'), (2, 'z'), (3, 'w')) t(a, b) ORDER BY a OFFSET 1 ROWS FETCH NEXT 1 ROW ONLY": {
+				"description": {"b"},
+				"types":       {uint32ToString(pgtype.TextOID)},
+				"values":      {"y"},
+			},
+			"SELECT count(*) AS count FROM (SELECT b FROM (VALUES (1, 'x'), (2, 'y'), (2, 'z'), (3, 'w')) t(a, b) ORDER BY a FETCH FIRST 2 ROWS WITH TIES) s": {
+				"description": {"count"},
+				"types":       {uint32ToString(pgtype.Int8OID)},
+				"values":      {"3"},
+			},
+			"SELECT count(*) AS count FROM (SELECT b FROM (VALUES (1, 'x'), (2, 'y'), (2, 'z'), (3, 'w')) t(a, b) ORDER BY a OFFSET 3 ROWS FETCH FIRST 5 ROWS WITH TIES) s": {
+				"description": {"count"},
+				"types":       {uint32ToString(pgtype.Int8OID)},
+				"values":      {"1"},
+			},
+			"SELECT a, b FROM (VALUES (2, 'y'), (1, 'x'), (1, 'z')) t(a, b) ORDER BY 1, 2 DESC FETCH FIRST 1 ROW WITH TIES": {
+				"description": {"a", "b"},
+				"types":       {uint32ToString(pgtype.Int4OID), uint32ToString(pgtype.TextOID)},
+				"values":      {"1", "z"},
+			},
+			"SELECT count(*) AS count FROM (SELECT DISTINCT a FROM (VALUES (1), (1), (2), (2), (3)) t(a) ORDER BY a FETCH FIRST 2 ROWS WITH TIES) s": {
+				"description": {"count"},
+				"types":       {uint32ToString(pgtype.Int8OID)},
+				"values":      {"2"},
+			},
+			"SELECT count(*) AS count FROM (SELECT a, count(*) AS n FROM (VALUES (1), (1), (2), (2), (3)) t(a) GROUP BY a ORDER BY n DESC FETCH FIRST 1 ROW WITH TIES) s": {
+				"description": {"count"},
+				"types":       {uint32ToString(pgtype.Int8OID)},
+				"values":      {"2"},
+			},
+			"SELECT count(*) AS count FROM (SELECT a FROM (VALUES (1), (2)) t(a) UNION SELECT a FROM (VALUES (2), (3)) t(a) ORDER BY a FETCH FIRST 2 ROWS WITH TIES) s": {
+				"description": {"count"},
+				"types":       {uint32ToString(pgtype.Int8OID)},
+				"values":      {"2"},
+			},
 		})
 	})
 
+	t.Run("Returns an error for ORDER BY with a collation without a language", func(t *testing.T) {
+		for _, collation := range []string{"-x-icu", "_"} {
+			_, err := queryHandler.HandleSimpleQuery("SELECT c FROM (VALUES ('a')) t(c) ORDER BY c COLLATE \"" + collation + "\"")
+
+			expectedError := "Collation with name " + collation + " does not exist!"
+			if err == nil || !strings.Contains(err.Error(), expectedError) {
+				t.Errorf("Expected the error to contain '%s', got %v", expectedError, err)
+			}
+		}
+	})
+
+	t.Run("FOR UPDATE/FOR SHARE", func(t *testing.T) {
+		for query, expectedId := range map[string]string{
+			"SELECT id FROM postgres.test_table ORDER BY id LIMIT 1 FOR UPDATE":                                            "1",
+			"SELECT id FROM postgres.test_table WHERE id = 2 FOR SHARE OF test_table NOWAIT":                               "2",
+			"SELECT id FROM (SELECT id FROM postgres.test_table ORDER BY id DESC LIMIT 1 FOR NO KEY UPDATE SKIP LOCKED) t": "2",
+		} {
+			messages, err := queryHandler.HandleSimpleQuery(query)
+
+			testNoError(t, err)
+			testMessageTypes(t, messages, []pgproto3.Message{
+				&pgproto3.NoticeResponse{},
+				&pgproto3.RowDescription{},
+				&pgproto3.DataRow{},
+				&pgproto3.CommandComplete{},
+			})
+			testRowDescription(t, messages[1], []string{"id"}, []string{uint32ToString(pgtype.Int4OID)})
+			testDataRowValues(t, messages[2], []string{expectedId})
+		}
+	})
+
 	t.Run("GROUP BY", func(t *testing.T) {
 		testResponseByQuery(t, queryHandler, map[string]map[string][]string{
 			"SELECT MAX(id) AS max FROM postgres.test_table GROUP BY postgres.test_table.id ORDER BY max LIMIT 1": {
@@ -1506,6 +1903,56 @@ func TestHandleQuery(t *testing.T) {
 		}
 	})
 
+	t.Run("Maps DuckDB errors to Postgres error codes", func(t *testing.T) {
+		for query, expectedCode := range map[string]string{
+			"SELECT * FROM non_existent_table":                          PG_ERROR_CODE_UNDEFINED_TABLE,
+			"SELECT non_existent_column FROM postgres.test_table":       PG_ERROR_CODE_UNDEFINED_COLUMN,
+			"SELECT 'abc'::int":                                         PG_ERROR_CODE_INVALID_TEXT_REPRESENTATION,
+			"SELECT 100000::int2":                                       PG_ERROR_CODE_NUMERIC_VALUE_OUT_OF_RANGE,
+			"SELECT non_existent_function(1)":                           PG_ERROR_CODE_UNDEFINED_FUNCTION,
+			"SELECT id, COUNT(*) FROM postgres.test_table":              PG_ERROR_CODE_GROUPING_ERROR,
+			"SELECT id FROM postgres.test_table a, postgres.test_table": PG_ERROR_CODE_AMBIGUOUS_COLUMN,
+		} {
+			_, err := queryHandler.HandleSimpleQuery(query)
+
+			pgError := DuckdbErrorToPgError(err)
+			if pgError == nil || pgError.Code != expectedCode {
+				t.Errorf("Expected the error code of '%s' to be %s, got %v", query, expectedCode, pgError)
+			}
+		}
+	})
+
+	t.Run("Returns the DuckDB query plan for EXPLAIN", func(t *testing.T) {
+		messages, err := queryHandler.HandleSimpleQuery("EXPLAIN (VERBOSE, COSTS off) SELECT 1")
+
+		testNoError(t, err)
+		testRowDescription(t, messages[0], []string{"QUERY PLAN"}, []string{uint32ToString(pgtype.TextOID)})
+		var plan []string
+		for _, message := range messages[1 : len(messages)-1] {
+			plan = append(plan, string(message.(*pgproto3.DataRow).Values[0]))
+		}
+		if !strings.Contains(strings.Join(plan, "\n"), "DUMMY_SCAN") {
+			t.Errorf("Expected the query plan to contain DUMMY_SCAN, got %v", plan)
+		}
+		testCommandCompleteTag(t, messages[len(messages)-1], "EXPLAIN")
+
+		messages, err = queryHandler.HandleSimpleQuery("EXPLAIN (FORMAT json) SELECT 1")
+
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{
+			&pgproto3.RowDescription{},
+			&pgproto3.DataRow{},
+			&pgproto3.CommandComplete{},
+		})
+
+		_, err = queryHandler.HandleSimpleQuery("EXPLAIN (FORMAT yaml) SELECT 1")
+
+		var pgError *PgError
+		if !errors.As(err, &pgError) || pgError.Code != PG_ERROR_CODE_FEATURE_NOT_SUPPORTED {
+			t.Errorf("Expected a not supported error, got %v", err)
+		}
+	})
+
 	t.Run("Returns an error if permission for a column is denied", func(t *testing.T) {
 		_, err := queryHandler.HandleSimpleQuery("SELECT id, bit_column FROM postgres.test_table /*BEMIDB_PERMISSIONS {\"postgres.test_table\": [\"id\"]} BEMIDB_PERMISSIONS*/")
 
@@ -1525,306 +1972,2357 @@ func TestHandleQuery(t *testing.T) {
 		}
 	})
 
-	t.Run("Returns a result without a row description for SET queries", func(t *testing.T) {
-		messages, err := queryHandler.HandleSimpleQuery("SET SESSION CHARACTERISTICS AS TRANSACTION ISOLATION LEVEL READ UNCOMMITTED")
+	t.Run("Applies configured permissions of the session user", func(t *testing.T) {
+		queryHandler.Config.Permissions = map[string]map[string][]string{"analyst": {"postgres.test_table": {"id"}}}
+		defer func() { queryHandler.Config.Permissions = nil }()
+		sessionQueryHandler := queryHandler.WithNewSession()
+		sessionQueryHandler.QueryRemapper.Session.User = "analyst"
+
+		messages, err := sessionQueryHandler.HandleSimpleQuery("SELECT * FROM postgres.test_table WHERE id = 1 /*BEMIDB_PERMISSIONS {\"postgres.test_table\": [\"id\", \"bit_column\"]} BEMIDB_PERMISSIONS*/")
 
 		testNoError(t, err)
 		testMessageTypes(t, messages, []pgproto3.Message{
+			&pgproto3.NoticeResponse{},
+			&pgproto3.RowDescription{},
+			&pgproto3.DataRow{},
 			&pgproto3.CommandComplete{},
 		})
-		testCommandCompleteTag(t, messages[0], "SET")
-	})
+		testRowDescription(t, messages[1], []string{"id"}, []string{uint32ToString(pgtype.Int4OID)})
 
-	t.Run("Allows setting and querying timezone", func(t *testing.T) {
-		queryHandler.HandleSimpleQuery("SET timezone = 'UTC'")
+		for query, expectedErrorMessage := range map[string]string{
+			"SELECT * FROM read_parquet('s3://bemidb-bucket/file.parquet')": "permission denied for function read_parquet",
+			"SELECT * FROM query('SELECT * FROM postgres.test_table')":      "permission denied for function query",
+			`SELECT * FROM "s3://bemidb-bucket/file.parquet"`:               `relation "s3://bemidb-bucket/file.parquet" does not exist`,
+			`SELECT * FROM bemidb_pinned."postgres.test_table"`:             `relation "bemidb_pinned.postgres.test_table" does not exist`,
+			"SELECT (SELECT id FROM main.pg_stat_user_tables LIMIT 1)::int": `relation "main.pg_stat_user_tables" does not exist`,
+		} {
+			_, err = sessionQueryHandler.HandleSimpleQuery(query)
 
-		messages, err := queryHandler.HandleSimpleQuery("show timezone")
+			if err == nil || err.Error() != expectedErrorMessage {
+				t.Errorf("Expected the error of '%s' to be '%s', got %v", query, expectedErrorMessage, err)
+			}
+		}
+
+		messages, err = sessionQueryHandler.HandleSimpleQuery("WITH ids AS (SELECT id FROM postgres.test_table) SELECT ids.id FROM ids, generate_series(1, 1) WHERE ids.id = 1")
 
 		testNoError(t, err)
-		testMessageTypes(t, messages, []pgproto3.Message{
-			&pgproto3.RowDescription{},
-			&pgproto3.DataRow{},
-			&pgproto3.CommandComplete{},
-		})
-		testRowDescription(t, messages[0], []string{"timezone"}, []string{uint32ToString(pgtype.TextOID)})
-		testDataRowValues(t, messages[1], []string{"UTC"})
-		testCommandCompleteTag(t, messages[2], "SHOW")
+		testDataRowValues(t, messages[2], []string{"1"})
+
+		_, err = sessionQueryHandler.HandleSimpleQuery("REFRESH MATERIALIZED VIEW postgres.test_matview")
+
+		expectedErrorMessage := "permission denied for user analyst"
+		if err == nil || err.Error() != expectedErrorMessage {
+			t.Errorf("Expected the error to be '"+expectedErrorMessage+"', got %v", err)
+		}
 	})
 
-	t.Run("Handles an empty query", func(t *testing.T) {
-		messages, err := queryHandler.HandleSimpleQuery("-- ping")
+	t.Run("Hides password verifiers in pg_shadow from additional users", func(t *testing.T) {
+		queryHandler.Config.Users = map[string]string{"analyst": StringToScramSha256("analyst", "password", "")}
+		defer func() { queryHandler.Config.Users = nil }()
+		sessionQueryHandler := queryHandler.WithNewSession()
+		sessionQueryHandler.QueryRemapper.Session.User = "analyst"
+
+		messages, err := sessionQueryHandler.HandleSimpleQuery("SELECT COUNT(s.passwd) AS count, COUNT(*) > 0 AS has_users FROM pg_catalog.pg_shadow s")
 
 		testNoError(t, err)
-		testMessageTypes(t, messages, []pgproto3.Message{
-			&pgproto3.EmptyQueryResponse{},
-		})
+		testDataRowValues(t, messages[1], []string{"0", "t"})
 	})
 
-	t.Run("Handles a DISCARD ALL query", func(t *testing.T) {
-		messages, err := queryHandler.HandleSimpleQuery("DISCARD ALL")
+	t.Run("Applies configured row filters of the session user", func(t *testing.T) {
+		queryHandler.Config.RowFilters = RowFilters{
+			Tables: map[string]string{"postgres.test_table": "id = {{test_id}}::int"},
+			Users:  map[string]map[string]string{"analyst": {"test_id": "2"}},
+		}
+		defer func() { queryHandler.Config.RowFilters = RowFilters{} }()
+		sessionQueryHandler := queryHandler.WithNewSession()
+		sessionQueryHandler.QueryRemapper.Session.User = "analyst"
+
+		messages, err := sessionQueryHandler.HandleSimpleQuery("SELECT t.id FROM postgres.test_table t JOIN postgres.test_table t2 ON t.id = t2.id")
 
 		testNoError(t, err)
 		testMessageTypes(t, messages, []pgproto3.Message{
+			&pgproto3.RowDescription{},
+			&pgproto3.DataRow{},
 			&pgproto3.CommandComplete{},
 		})
-		testCommandCompleteTag(t, messages[0], "DISCARD ALL")
+		testDataRowValues(t, messages[1], []string{"2"})
+
+		_, err = sessionQueryHandler.HandleSimpleQuery("REFRESH MATERIALIZED VIEW postgres.test_matview")
+
+		expectedErrorMessage := "permission denied for user analyst"
+		if err == nil || err.Error() != expectedErrorMessage {
+			t.Errorf("Expected the error to be '"+expectedErrorMessage+"', got %v", err)
+		}
 	})
 
-	t.Run("Handles a BEGIN query", func(t *testing.T) {
-		messages, err := queryHandler.HandleSimpleQuery("BEGIN")
+	t.Run("Rewrites queries with the configured rewrite rules", func(t *testing.T) {
+		queryHandler.Config.QueryRewriteRules = parseQueryRewriteRules(`[
+			{"name": "tool-version", "match": "select tool_version() ;", "rewrite": "SELECT '1.0' AS tool_version"},
+			{"name": "tool-setting", "regex": "current_setting\\('tool\\.(\\w+)'\\)", "rewrite": "'$1'"}
+		]`)
+		defer func() { queryHandler.Config.QueryRewriteRules = nil }()
+
+		messages, err := queryHandler.HandleSimpleQuery("SELECT   tool_version()")
+
+		testNoError(t, err)
+		testRowDescription(t, messages[0], []string{"tool_version"}, []string{uint32ToString(pgtype.TextOID)})
+		testDataRowValues(t, messages[1], []string{"1.0"})
+
+		messages, err = queryHandler.HandleSimpleQuery("SELECT current_setting('tool.mode') AS mode")
+
+		testNoError(t, err)
+		testRowDescription(t, messages[0], []string{"mode"}, []string{uint32ToString(pgtype.TextOID)})
+		testDataRowValues(t, messages[1], []string{"mode"})
+	})
+
+	t.Run("Runs query hooks with the tables read by the query", func(t *testing.T) {
+		sessionQueryHandler := queryHandler.WithNewSession()
+		sessionQueryHandler.QueryRemapper.Session.User = "analyst"
+		hook := &testQueryHook{rejectedTable: "postgres.test_table"}
+		sessionQueryHandler.QueryHooks = NewQueryHooks(queryHandler.Config)
+		sessionQueryHandler.QueryHooks.Add(hook)
+
+		_, err := sessionQueryHandler.HandleSimpleQuery("SELECT COUNT(*) FROM postgres.test_table WHERE FALSE")
+
+		expectedErrorMessage := "query rejected by access policy"
+		if err == nil || err.Error() != expectedErrorMessage {
+			t.Errorf("Expected the error to be '"+expectedErrorMessage+"', got %v", err)
+		}
+
+		hook.rejectedTable = ""
+		messages, err := sessionQueryHandler.HandleSimpleQuery("SELECT id FROM postgres.test_table JOIN pg_catalog.pg_class ON FALSE")
+
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{
+			&pgproto3.RowDescription{},
+			&pgproto3.CommandComplete{},
+		})
+		if len(hook.afterAccesses) != 1 {
+			t.Fatalf("Expected 1 access after the query, got %v", len(hook.afterAccesses))
+		}
+		access := hook.afterAccesses[0]
+		if access.User != "analyst" || strings.Join(access.Tables, ",") != "postgres.test_table" || access.RowCount != 0 {
+			t.Errorf("Expected the access of analyst to postgres.test_table, got %+v", access)
+		}
+
+		_, err = sessionQueryHandler.HandleSimpleQuery("SELECT 1")
+
+		testNoError(t, err)
+		if len(hook.afterAccesses) != 1 {
+			t.Errorf("Expected no access for a query without tables, got %v", len(hook.afterAccesses))
+		}
+	})
+
+	t.Run("Reports the tables read by views and the files read by table functions to query hooks", func(t *testing.T) {
+		_, err := queryHandler.HandleSimpleQuery("CREATE VIEW postgres.hook_view AS SELECT id FROM postgres.test_table")
+		testNoError(t, err)
+		defer queryHandler.HandleSimpleQuery("DROP VIEW postgres.hook_view")
+
+		tables, err := queryHandler.QueryRemapper.ReferencedDataTables("WITH test_table AS (SELECT 1) SELECT * FROM postgres.hook_view, test_table, read_csv('/tmp/o''brien.csv'), \"s3://bucket/file.parquet\", generate_series(1, 2)")
+
+		testNoError(t, err)
+		expectedTables := []string{"postgres.test_table", "read_csv('/tmp/o''brien.csv')", "s3://bucket/file.parquet"}
+		if !reflect.DeepEqual(tables, expectedTables) {
+			t.Errorf("Expected the tables to be %v, got %v", expectedTables, tables)
+		}
+	})
+
+	t.Run("Refreshes system tables for concurrent readers", func(t *testing.T) {
+		for _, query := range []string{
+			"SELECT COUNT(*) FROM pg_catalog.pg_locks",
+			"SELECT COUNT(*) FROM pg_catalog.pg_depend",
+			"SELECT COUNT(*) FROM pg_catalog.pg_stat_database",
+			"SELECT COUNT(*) FROM pg_catalog.pg_stat_io",
+			"SELECT COUNT(*) FROM bemidb.broken_tables",
+		} {
+			errs := make(chan error, 50)
+			for range 50 {
+				go func() {
+					_, err := queryHandler.WithNewSession().HandleSimpleQuery(query)
+					errs <- err
+				}()
+			}
+
+			for range 50 {
+				testNoError(t, <-errs)
+			}
+		}
+	})
+
+	t.Run("Returns recent connections from bemidb.connection_log", func(t *testing.T) {
+		session := NewSession()
+		session.User = "analyst"
+		session.Database = "bemidb"
+		queryHandler.ConnectionLog.Open(session)
+		queryHandler.ConnectionLog.Close(session)
+
+		messages, err := queryHandler.HandleSimpleQuery("SELECT usename, datname, client_addr, backend_end IS NOT NULL AS closed, query_count FROM bemidb.connection_log")
+
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{
+			&pgproto3.RowDescription{},
+			&pgproto3.DataRow{},
+			&pgproto3.CommandComplete{},
+		})
+		testRowDescription(t, messages[0], []string{"usename", "datname", "client_addr", "closed", "query_count"}, []string{uint32ToString(pgtype.TextOID), uint32ToString(pgtype.TextOID), uint32ToString(pgtype.TextOID), uint32ToString(pgtype.BoolOID), uint32ToString(pgtype.Int8OID)})
+		testDataRowValues(t, messages[1], []string{"analyst", "bemidb", "", "t", "0"})
+	})
+
+	t.Run("Returns only the user's connections from bemidb.connection_log to additional users", func(t *testing.T) {
+		queryHandler.Config.Users = map[string]string{"looker": "verifier"}
+		defer func() { queryHandler.Config.Users = nil }()
+		for _, user := range []string{"looker", "other_user"} {
+			session := NewSession()
+			session.User = user
+			queryHandler.ConnectionLog.Open(session)
+			defer queryHandler.ConnectionLog.Close(session)
+		}
+		sessionQueryHandler := queryHandler.WithNewSession()
+		sessionQueryHandler.QueryRemapper.Session.User = "looker"
+
+		testResponseByQuery(t, sessionQueryHandler, map[string]map[string][]string{
+			"SELECT DISTINCT usename FROM bemidb.connection_log": {
+				"description": {"usename"},
+				"types":       {uint32ToString(pgtype.TextOID)},
+				"values":      {"looker"},
+			},
+		})
+	})
+
+	t.Run("Returns no tables from bemidb.broken_tables after checking a consistent catalog", func(t *testing.T) {
+		queryHandler.QueryRemapper.CheckCatalog()
+
+		messages, err := queryHandler.HandleSimpleQuery("SELECT COUNT(*) AS count FROM bemidb.broken_tables")
+
+		testNoError(t, err)
+		testRowDescription(t, messages[0], []string{"count"}, []string{uint32ToString(pgtype.Int8OID)})
+		testDataRowValues(t, messages[1], []string{"0"})
+	})
+
+	t.Run("Returns an error for queries of a broken table", func(t *testing.T) {
+		catalogChecker := queryHandler.QueryRemapper.remapperTable.catalogChecker
+		catalogChecker.brokenTables = []BrokenTable{{IcebergSchemaTable: common.IcebergSchemaTable{Schema: "postgres", Table: "test_table"}, Problem: "missing data file", CheckedAt: time.Now()}}
+		defer func() { catalogChecker.brokenTables = nil }()
+
+		_, err := queryHandler.HandleSimpleQuery("SELECT COUNT(*) FROM postgres.test_table")
+
+		var pgError *PgError
+		if !errors.As(err, &pgError) || pgError.Code != PG_ERROR_CODE_DATA_CORRUPTED {
+			t.Fatalf("Expected a data corrupted error, got %v", err)
+		}
+		if pgError.Message != `table "postgres"."test_table" is broken: missing data file` {
+			t.Errorf("Expected the error to name the table and its problem, got %v", pgError.Message)
+		}
+	})
+
+	t.Run("Returns catalog rows in a deterministic order without ORDER BY", func(t *testing.T) {
+		for _, query := range []string{
+			"SELECT table_schema || '.' || table_name FROM information_schema.tables",
+			"SELECT table_schema || '.' || table_name || '.' || lpad(ordinal_position::text, 4, '0') FROM information_schema.columns",
+			"SELECT lpad(oid::text, 12, '0') FROM pg_catalog.pg_class",
+		} {
+			messages, err := queryHandler.HandleSimpleQuery(query)
+			testNoError(t, err)
+
+			values := []string{}
+			for _, message := range messages {
+				if dataRow, ok := message.(*pgproto3.DataRow); ok {
+					values = append(values, string(dataRow.Values[0]))
+				}
+			}
+			if len(values) == 0 || !slices.IsSorted(values) {
+				t.Errorf("Expected sorted rows for %s, got %v", query, values)
+			}
+		}
+	})
+
+	t.Run("Counts transactions and rows in pg_stat_database and pg_stat_io", func(t *testing.T) {
+		session := NewSession()
+		session.Database = "stats_test"
+		queryHandler.Config.Databases = map[string][]string{"stats_test": {PG_SCHEMA_PUBLIC}}
+		defer func() { queryHandler.Config.Databases = nil }()
+		queryHandler.ConnectionLog.Open(session)
+		defer queryHandler.ConnectionLog.Close(session)
+		queryHandler.ConnectionLog.TrackQuery(session, nil, []pgproto3.Message{&pgproto3.DataRow{}, &pgproto3.DataRow{}, &pgproto3.CommandComplete{CommandTag: []byte("SELECT 2")}}, nil, time.Millisecond)
+		queryHandler.ConnectionLog.TrackQuery(session, nil, []pgproto3.Message{&pgproto3.CommandComplete{CommandTag: []byte("INSERT 0 3")}}, nil, time.Millisecond)
+		queryHandler.ConnectionLog.TrackQuery(session, &SessionTransaction{}, []pgproto3.Message{&pgproto3.CommandComplete{CommandTag: []byte("ROLLBACK")}}, nil, time.Millisecond)
+		queryHandler.ConnectionLog.TrackStorageReads(session.Database, 10000)
+
+		messages, err := queryHandler.HandleSimpleQuery("SELECT numbackends, xact_commit, xact_rollback, blks_read, tup_returned, tup_inserted, sessions FROM pg_stat_database WHERE datname = 'stats_test'")
+
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{
+			&pgproto3.RowDescription{},
+			&pgproto3.DataRow{},
+			&pgproto3.CommandComplete{},
+		})
+		testDataRowValues(t, messages[1], []string{"1", "2", "1", "2", "2", "3", "1"})
+
+		messages, err = queryHandler.HandleSimpleQuery("SELECT backend_type, object, context, reads >= 2 AS read, op_bytes FROM pg_stat_io")
+
+		testNoError(t, err)
+		testDataRowValues(t, messages[1], []string{"client backend", "relation", "normal", "t", "8192"})
+	})
+
+	t.Run("Doesn't count CPU-bound table scans as waiting on object storage in pg_stat_database", func(t *testing.T) {
+		session := queryHandler.QueryRemapper.Session
+		database := session.Database
+		session.Database = "latency_test"
+		queryHandler.Config.StorageLatencyNoticeMs = 1
+		defer func() {
+			session.Database = database
+			queryHandler.Config.StorageLatencyNoticeMs = 0
+		}()
+
+		startedAt := time.Now()
+		messages, err := queryHandler.HandleSimpleQuery("SELECT COUNT(*) FROM range(100000000)")
+		duration := time.Since(startedAt)
+
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{
+			&pgproto3.RowDescription{},
+			&pgproto3.DataRow{},
+			&pgproto3.CommandComplete{},
+		})
+		if blkReadTime := queryHandler.ConnectionLog.DatabaseStats()["latency_test"].BlkReadTime; blkReadTime > duration/2 {
+			t.Errorf("Expected the scan to mostly run on the CPU, got %s of %s waiting on object storage", blkReadTime, duration)
+		}
+	})
+
+	t.Run("Returns a result without a row description for SET queries", func(t *testing.T) {
+		messages, err := queryHandler.HandleSimpleQuery("SET SESSION CHARACTERISTICS AS TRANSACTION ISOLATION LEVEL READ UNCOMMITTED")
+
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{
+			&pgproto3.CommandComplete{},
+		})
+		testCommandCompleteTag(t, messages[0], "SET")
+	})
+
+	t.Run("Returns a warning for unknown SET queries", func(t *testing.T) {
+		messages, err := queryHandler.HandleSimpleQuery("SET unknown_setting = 1")
+
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{
+			&pgproto3.NoticeResponse{},
+			&pgproto3.CommandComplete{},
+		})
+		notice := messages[0].(*pgproto3.NoticeResponse)
+		if notice.Severity != "WARNING" || notice.Message != "unrecognized configuration parameter \"unknown_setting\" is ignored" {
+			t.Errorf("Expected a warning about the unknown setting, got %v", notice)
+		}
+		testCommandCompleteTag(t, messages[1], "SET")
+
+		messages, err = queryHandler.HandleSimpleQuery("SELECT 1")
+
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{
+			&pgproto3.RowDescription{},
+			&pgproto3.DataRow{},
+			&pgproto3.CommandComplete{},
+		})
+	})
+
+	t.Run("Answers LIMIT and EXISTS probes from the Iceberg metadata with SET bemidb.metadata_probes", func(t *testing.T) {
+		sessionQueryHandler := queryHandler.WithNewSession()
+		_, err := sessionQueryHandler.HandleSimpleQuery("SET bemidb.metadata_probes = on")
+		testNoError(t, err)
+
+		testResponseByQuery(t, sessionQueryHandler, map[string]map[string][]string{
+			"SELECT 1 AS probe FROM postgres.test_table LIMIT 1": {
+				"description": {"probe"},
+				"types":       {uint32ToString(pgtype.Int4OID)},
+				"values":      {"1"},
+			},
+			"SELECT EXISTS (SELECT * FROM postgres.test_table) AS probe": {
+				"description": {"probe"},
+				"types":       {uint32ToString(pgtype.BoolOID)},
+				"values":      {"t"},
+			},
+			"SELECT EXISTS (SELECT * FROM postgres.test_table WHERE id = 0) AS probe": {
+				"description": {"probe"},
+				"types":       {uint32ToString(pgtype.BoolOID)},
+				"values":      {"f"},
+			},
+		})
+
+		messages, err := sessionQueryHandler.HandleSimpleQuery("SELECT 1 FROM postgres.test_table LIMIT 5")
+
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{
+			&pgproto3.RowDescription{},
+			&pgproto3.DataRow{},
+			&pgproto3.DataRow{},
+			&pgproto3.CommandComplete{},
+		})
+	})
+
+	t.Run("Reads sampled tables with SET bemidb.sample_tables", func(t *testing.T) {
+		queryHandler.Config.SampleRows = 1
+		defer func() { queryHandler.Config.SampleRows = 0 }()
+		queryHandler.QueryRemapper.remapperTable.sampleTables.LoadAll()
+
+		sessionQueryHandler := queryHandler.WithNewSession()
+		_, err := sessionQueryHandler.HandleSimpleQuery("SET bemidb.sample_tables = on")
+		testNoError(t, err)
+
+		testResponseByQuery(t, sessionQueryHandler, map[string]map[string][]string{
+			"SELECT COUNT(*) AS count FROM postgres.test_table": {
+				"description": {"count"},
+				"types":       {uint32ToString(pgtype.Int8OID)},
+				"values":      {"1"},
+			},
+			"SELECT COUNT(*) AS count FROM postgres.test_empty_table": {
+				"description": {"count"},
+				"types":       {uint32ToString(pgtype.Int8OID)},
+				"values":      {"0"},
+			},
+		})
+
+		_, err = sessionQueryHandler.HandleSimpleQuery("SET bemidb.sample_tables = off")
+		testNoError(t, err)
+
+		testResponseByQuery(t, sessionQueryHandler, map[string]map[string][]string{
+			"SELECT COUNT(*) AS count FROM postgres.test_table": {
+				"description": {"count"},
+				"types":       {uint32ToString(pgtype.Int8OID)},
+				"values":      {"2"},
+			},
+			"SELECT COUNT(*) AS count FROM bemidb_sample('postgres.test_table')": {
+				"description": {"count"},
+				"types":       {uint32ToString(pgtype.Int8OID)},
+				"values":      {"1"},
+			},
+			"SELECT COUNT(*) AS count FROM pg_catalog.pg_namespace WHERE nspname = 'bemidb_samples'": {
+				"description": {"count"},
+				"types":       {uint32ToString(pgtype.Int8OID)},
+				"values":      {"0"},
+			},
+		})
+
+		for query, code := range map[string]string{
+			"SELECT * FROM bemidb_sample('postgres.non_existent_table')": PG_ERROR_CODE_UNDEFINED_TABLE,
+			"SELECT * FROM bemidb_sample(1)":                             PG_ERROR_CODE_INVALID_PARAMETER_VALUE,
+			`SELECT * FROM bemidb_samples."postgres.test_table"`:         PG_ERROR_CODE_UNDEFINED_TABLE,
+		} {
+			_, err = sessionQueryHandler.HandleSimpleQuery(query)
+			var pgError *PgError
+			if !errors.As(err, &pgError) || pgError.Code != code {
+				t.Errorf("Expected error code %s for %s, got %v", code, query, err)
+			}
+		}
+	})
+
+	t.Run("Switches the session catalog with SET bemidb.catalog", func(t *testing.T) {
+		sessionQueryHandler := queryHandler.WithNewSession()
+
+		messages, err := sessionQueryHandler.HandleSimpleQuery("SET bemidb.catalog = 'primary'; SHOW bemidb.catalog")
+
+		testNoError(t, err)
+		testCommandCompleteTag(t, messages[0], "SET")
+		testRowDescription(t, messages[1], []string{"bemidb.catalog"}, []string{uint32ToString(pgtype.TextOID)})
+		testDataRowValues(t, messages[2], []string{"primary"})
+
+		_, err = sessionQueryHandler.HandleSimpleQuery("SET bemidb.catalog = candidate")
+
+		var pgError *PgError
+		if !errors.As(err, &pgError) || pgError.Code != PG_ERROR_CODE_INVALID_PARAMETER_VALUE || pgError.Hint != "Available values: primary." {
+			t.Errorf("Expected an invalid parameter value error without a candidate catalog, got %v", err)
+		}
+	})
+
+	t.Run("Switches the active catalog with ALTER SYSTEM SET bemidb.catalog", func(t *testing.T) {
+		sessionQueryHandler := queryHandler.WithNewSession()
+		sessionQueryHandler.QueryRemapper.Session.User = queryHandler.Config.User
+
+		messages, err := sessionQueryHandler.HandleSimpleQuery("ALTER SYSTEM RESET bemidb.catalog")
+
+		testNoError(t, err)
+		testCommandCompleteTag(t, messages[0], "ALTER SYSTEM")
+
+		_, err = sessionQueryHandler.HandleSimpleQuery("ALTER SYSTEM SET work_mem = '1GB'")
+
+		var pgError *PgError
+		if !errors.As(err, &pgError) || pgError.Code != PG_ERROR_CODE_FEATURE_NOT_SUPPORTED {
+			t.Errorf("Expected a not supported error for other settings, got %v", err)
+		}
+
+		sessionQueryHandler.QueryRemapper.Session.User = "analyst"
+		_, err = sessionQueryHandler.HandleSimpleQuery("ALTER SYSTEM RESET bemidb.catalog")
+
+		if !errors.As(err, &pgError) || pgError.Code != PG_ERROR_CODE_INSUFFICIENT_PRIVILEGE {
+			t.Errorf("Expected a permission error for other users, got %v", err)
+		}
+	})
+
+	t.Run("Handles VACUUM, ANALYZE, REINDEX and CLUSTER queries", func(t *testing.T) {
+		messages, err := queryHandler.HandleSimpleQuery("ANALYZE postgres.test_table")
+
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{
+			&pgproto3.CommandComplete{},
+		})
+		testCommandCompleteTag(t, messages[0], "ANALYZE")
+
+		for query, commandTag := range map[string]string{
+			"VACUUM": "VACUUM",
+			"VACUUM FULL ANALYZE postgres.test_table": "VACUUM",
+			"REINDEX TABLE postgres.test_table":       "REINDEX",
+			"CLUSTER":                                 "CLUSTER",
+		} {
+			messages, err := queryHandler.HandleSimpleQuery(query)
+
+			testNoError(t, err)
+			testMessageTypes(t, messages, []pgproto3.Message{
+				&pgproto3.NoticeResponse{},
+				&pgproto3.CommandComplete{},
+			})
+			testCommandCompleteTag(t, messages[1], commandTag)
+		}
+
+		testResponseByQuery(t, queryHandler, map[string]map[string][]string{
+			"SELECT n_live_tup, vacuum_count > 0 AS vacuumed, analyze_count > 0 AS analyzed FROM pg_stat_user_tables WHERE schemaname = 'postgres' AND relname = 'test_table'": {
+				"description": {"n_live_tup", "vacuumed", "analyzed"},
+				"types":       {uint32ToString(pgtype.Int8OID), uint32ToString(pgtype.BoolOID), uint32ToString(pgtype.BoolOID)},
+				"values":      {"2", "t", "t"},
+			},
+		})
+	})
+
+	t.Run("Returns an error when analyzing a table that does not exist", func(t *testing.T) {
+		_, err := queryHandler.HandleSimpleQuery("ANALYZE non_existent_table")
+
+		if err == nil {
+			t.Errorf("Expected an error, got nil")
+		}
+
+		expectedErrorMessage := "relation \"public\".\"non_existent_table\" does not exist"
+		if err.Error() != expectedErrorMessage {
+			t.Errorf("Expected the error to be '"+expectedErrorMessage+"', got %v", err.Error())
+		}
+	})
+
+	t.Run("Handles DO blocks with SQL statements", func(t *testing.T) {
+		messages, err := queryHandler.HandleSimpleQuery("DO $$ BEGIN SET client_min_messages TO warning; ANALYZE postgres.test_table; END $$")
+
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{
+			&pgproto3.CommandComplete{},
+		})
+		testCommandCompleteTag(t, messages[0], "DO")
+	})
+
+	t.Run("Returns a not supported error for DO blocks with PL/pgSQL constructs", func(t *testing.T) {
+		_, err := queryHandler.HandleSimpleQuery("DO $$ BEGIN IF TRUE THEN ANALYZE; END IF; END $$")
+
+		var pgError *PgError
+		if !errors.As(err, &pgError) {
+			t.Fatalf("Expected a PgError, got %v", err)
+		}
+		if pgError.Code != PG_ERROR_CODE_FEATURE_NOT_SUPPORTED {
+			t.Errorf("Expected the error code to be %s, got %s", PG_ERROR_CODE_FEATURE_NOT_SUPPORTED, pgError.Code)
+		}
+		if pgError.Hint != DO_BLOCK_HINT {
+			t.Errorf("Expected the error hint to be '%s', got '%s'", DO_BLOCK_HINT, pgError.Hint)
+		}
+	})
+
+	t.Run("Doesn't run any statement of a DO block with an unsupported statement", func(t *testing.T) {
+		sessionQueryHandler := queryHandler.WithNewSession()
+
+		_, err := sessionQueryHandler.HandleSimpleQuery("DO $$ BEGIN SET bemidb.join_order = off; INSERT INTO postgres.test_table (id) VALUES (1); END $$")
+
+		var pgError *PgError
+		if !errors.As(err, &pgError) {
+			t.Fatalf("Expected a PgError, got %v", err)
+		}
+		if pgError.Code != PG_ERROR_CODE_FEATURE_NOT_SUPPORTED {
+			t.Errorf("Expected the error code to be %s, got %s", PG_ERROR_CODE_FEATURE_NOT_SUPPORTED, pgError.Code)
+		}
+		if !strings.HasPrefix(pgError.Message, "statement is not supported in DO blocks: INSERT INTO") {
+			t.Errorf("Expected the error to name the INSERT statement, got '%s'", pgError.Message)
+		}
+		if _, ok := sessionQueryHandler.QueryRemapper.Session.DuckdbSettings["disabled_optimizers"]; ok {
+			t.Errorf("Expected the SET statement not to run, got DuckDB settings %v", sessionQueryHandler.QueryRemapper.Session.DuckdbSettings)
+		}
+	})
+
+	t.Run("Handles PREPARE, EXECUTE and DEALLOCATE queries", func(t *testing.T) {
+		sessionQueryHandler := queryHandler.WithNewSession()
+
+		messages, err := sessionQueryHandler.HandleSimpleQuery("PREPARE test_statement(int) AS SELECT $1 + 1 AS value, $2 AS name")
+
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{
+			&pgproto3.CommandComplete{},
+		})
+		testCommandCompleteTag(t, messages[0], "PREPARE")
+
+		messages, err = sessionQueryHandler.HandleSimpleQuery("EXECUTE test_statement('1', 'bemidb')")
+
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{
+			&pgproto3.RowDescription{},
+			&pgproto3.DataRow{},
+			&pgproto3.CommandComplete{},
+		})
+		testRowDescription(t, messages[0], []string{"value", "name"}, []string{uint32ToString(pgtype.Int4OID), uint32ToString(pgtype.TextOID)})
+		testDataRowValues(t, messages[1], []string{"2", "bemidb"})
+
+		_, err = sessionQueryHandler.HandleSimpleQuery("EXECUTE test_statement((SELECT COUNT(*) FROM postgres.test_table), 'bemidb')")
+
+		var subqueryError *PgError
+		if !errors.As(err, &subqueryError) || subqueryError.Code != PG_ERROR_CODE_FEATURE_NOT_SUPPORTED {
+			t.Errorf("Expected a feature not supported error for a subquery parameter, got %v", err)
+		}
+
+		messages, err = sessionQueryHandler.HandleSimpleQuery("DEALLOCATE test_statement")
+
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{
+			&pgproto3.CommandComplete{},
+		})
+		testCommandCompleteTag(t, messages[0], "DEALLOCATE")
+
+		_, err = sessionQueryHandler.HandleSimpleQuery("EXECUTE test_statement(1, 'bemidb')")
+
+		var pgError *PgError
+		if !errors.As(err, &pgError) {
+			t.Fatalf("Expected a PgError, got %v", err)
+		}
+		if pgError.Code != PG_ERROR_CODE_INVALID_SQL_STATEMENT_NAME {
+			t.Errorf("Expected the error code to be %s, got %s", PG_ERROR_CODE_INVALID_SQL_STATEMENT_NAME, pgError.Code)
+		}
+	})
+
+	t.Run("Reads pinned tables from DuckDB", func(t *testing.T) {
+		pinnedConfig := *queryHandler.Config
+		pinnedConfig.PinnedTables = []common.IcebergSchemaTable{{Schema: "postgres", Table: "test_table"}}
+		remapperTable := queryHandler.QueryRemapper.remapperTable
+		previousPinnedTables := remapperTable.pinnedTables
+		remapperTable.pinnedTables = NewPinnedTables(&pinnedConfig, remapperTable.icebergReader, queryHandler.ServerDuckdbClient)
+		defer func() { remapperTable.pinnedTables = previousPinnedTables }()
+		remapperTable.pinnedTables.LoadAll()
+
+		queryStatements, _, err := queryHandler.QueryRemapper.ParseAndRemapQuery("SELECT COUNT(*) FROM postgres.test_table")
+
+		testNoError(t, err)
+		if !strings.Contains(queryStatements[0], `bemidb_pinned."postgres.test_table"`) {
+			t.Errorf("Expected the query to read the pinned table, got %s", queryStatements[0])
+		}
+		messages, err := queryHandler.HandleSimpleQuery("SELECT COUNT(*) FROM postgres.test_table")
+		testNoError(t, err)
+		testDataRowValues(t, messages[1], []string{"2"})
+
+		_, err = queryHandler.HandleSimpleQuery(`SELECT * FROM bemidb_pinned."postgres.test_table"`)
+		var pgError *PgError
+		if !errors.As(err, &pgError) || pgError.Code != PG_ERROR_CODE_UNDEFINED_TABLE {
+			t.Errorf("Expected an undefined table error, got %v", err)
+		}
+		messages, err = queryHandler.HandleSimpleQuery("SELECT (SELECT COUNT(*) FROM pg_catalog.pg_namespace WHERE nspname = 'bemidb_pinned') + (SELECT COUNT(*) FROM pg_catalog.pg_class WHERE relname = 'postgres.test_table')")
+		testNoError(t, err)
+		testDataRowValues(t, messages[1], []string{"0"})
+	})
+
+	t.Run("Returns source ordinal positions of columns in system tables", func(t *testing.T) {
+		remapperTable := queryHandler.QueryRemapper.remapperTable
+		icebergSchemaTable := common.IcebergSchemaTable{Schema: "postgres", Table: "reordered_table"}
+		remapperTable.createDuckdbTable(t.Context(), icebergSchemaTable, []common.CatalogTableColumn{
+			{Name: "id", Type: "integer", Position: 1},
+			{Name: "name", Type: "varchar", Position: 3}, // Column 2 was dropped in the source table
+			{Name: "age", Type: "integer", Position: 4},
+		})
+		defer func() {
+			_, err := queryHandler.ServerDuckdbClient.ExecContext(t.Context(), "DROP TABLE "+icebergSchemaTable.String())
+			testNoError(t, err)
+			remapperTable.upsertColumnMetadata(icebergSchemaTable, []common.CatalogTableColumn{})
+		}()
+
+		messages, err := queryHandler.HandleSimpleQuery("SELECT attname, attnum FROM pg_attribute WHERE attrelid = 'postgres.reordered_table'::regclass ORDER BY attnum")
+		testNoError(t, err)
+		testDataRowValues(t, messages[1], []string{"id", "1"})
+		testDataRowValues(t, messages[2], []string{"name", "3"})
+		testDataRowValues(t, messages[3], []string{"age", "4"})
+
+		messages, err = queryHandler.HandleSimpleQuery("SELECT column_name, ordinal_position FROM information_schema.columns WHERE table_name = 'reordered_table'")
+		testNoError(t, err)
+		testDataRowValues(t, messages[1], []string{"id", "1"})
+		testDataRowValues(t, messages[2], []string{"name", "3"})
+		testDataRowValues(t, messages[3], []string{"age", "4"})
+	})
+
+	t.Run("Handles COPY ... TO STDOUT queries", func(t *testing.T) {
+		messages, err := queryHandler.HandleSimpleQuery("COPY (SELECT 1 AS id, 'a,\"b' AS name, NULL AS note) TO STDOUT WITH (FORMAT csv, HEADER)")
+
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{
+			&pgproto3.CopyOutResponse{},
+			&pgproto3.CopyData{},
+			&pgproto3.CopyData{},
+			&pgproto3.CopyDone{},
+			&pgproto3.CommandComplete{},
+		})
+		if string(messages[1].(*pgproto3.CopyData).Data) != "id,name,note\n" {
+			t.Errorf("Expected the header to be 'id,name,note', got %q", messages[1].(*pgproto3.CopyData).Data)
+		}
+		if string(messages[2].(*pgproto3.CopyData).Data) != "1,\"a,\"\"b\",\n" {
+			t.Errorf("Expected the row to be '1,\"a,\"\"b\",', got %q", messages[2].(*pgproto3.CopyData).Data)
+		}
+		testCommandCompleteTag(t, messages[4], "COPY 1")
+
+		messages, err = queryHandler.HandleSimpleQuery("COPY postgres.test_table (id) TO STDOUT")
+
+		testNoError(t, err)
+		testCommandCompleteTag(t, messages[len(messages)-1], "COPY 2")
+	})
+
+	t.Run("Returns a not supported error for COPY to a file", func(t *testing.T) {
+		_, err := queryHandler.HandleSimpleQuery("COPY postgres.test_table TO '/tmp/test_table.csv'")
+
+		var pgError *PgError
+		if !errors.As(err, &pgError) {
+			t.Fatalf("Expected a PgError, got %v", err)
+		}
+		if pgError.Code != PG_ERROR_CODE_FEATURE_NOT_SUPPORTED {
+			t.Errorf("Expected the error code to be %s, got %s", PG_ERROR_CODE_FEATURE_NOT_SUPPORTED, pgError.Code)
+		}
+	})
+
+	t.Run("Rejects queries after the user reached the hard storage budget", func(t *testing.T) {
+		budgetConfig := *queryHandler.Config
+		budgetConfig.StorageHardBudgetBytes = 100
+		sessionQueryHandler := queryHandler.WithNewSession()
+		sessionQueryHandler.StorageBudgets = NewStorageBudgetTracker(&budgetConfig)
+		sessionQueryHandler.StorageBudgets.Add(sessionQueryHandler.QueryRemapper.Session.User, 100)
+
+		_, err := sessionQueryHandler.HandleSimpleQuery("SELECT 1")
+
+		var pgError *PgError
+		if !errors.As(err, &pgError) {
+			t.Fatalf("Expected a PgError, got %v", err)
+		}
+		if pgError.Code != PG_ERROR_CODE_CONFIGURATION_LIMIT_EXCEEDED {
+			t.Errorf("Expected the error code to be %s, got %s", PG_ERROR_CODE_CONFIGURATION_LIMIT_EXCEEDED, pgError.Code)
+		}
+	})
+
+	t.Run("Shares the storage budget of sessions without configured users", func(t *testing.T) {
+		budgetConfig := *queryHandler.Config
+		budgetConfig.StorageHardBudgetBytes = 100
+		budgetConfig.User = ""
+		budgetConfig.Users = nil
+		sessionQueryHandler := queryHandler.WithNewSession()
+		sessionQueryHandler.StorageBudgets = NewStorageBudgetTracker(&budgetConfig)
+		sessionQueryHandler.StorageBudgets.Add("other_user", 100)
+		sessionQueryHandler.QueryRemapper.Session.User = "new_user"
+
+		_, err := sessionQueryHandler.HandleSimpleQuery("SELECT 1")
+
+		var pgError *PgError
+		if !errors.As(err, &pgError) {
+			t.Fatalf("Expected a PgError, got %v", err)
+		}
+		if pgError.Message != "daily storage budget exceeded: read 100 of 100 bytes" {
+			t.Errorf("Expected the shared budget to be exceeded, got %s", pgError.Message)
+		}
+	})
+
+	t.Run("Returns query stats for a query in a transaction block", func(t *testing.T) {
+		sessionQueryHandler := queryHandler.WithNewSession()
+		_, err := sessionQueryHandler.HandleSimpleQuery("SET bemidb.query_stats = on; BEGIN")
+		testNoError(t, err)
+		defer sessionQueryHandler.HandleSimpleQuery("ROLLBACK")
+
+		messages, err := sessionQueryHandler.HandleSimpleQuery("SELECT 1")
+
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{
+			&pgproto3.RowDescription{},
+			&pgproto3.DataRow{},
+			&pgproto3.CommandComplete{},
+			&pgproto3.NoticeResponse{},
+		})
+		notice := messages[3].(*pgproto3.NoticeResponse).Message
+		if !strings.HasPrefix(notice, "Query stats: duration: ") || !strings.HasSuffix(notice, ", rows: 1, bytes scanned: 0 (0 requests)") {
+			t.Errorf("Expected the query stats with storage reads, got %s", notice)
+		}
+	})
+
+	t.Run("Returns query stats for all statements in a query once enabled for the current session", func(t *testing.T) {
+		sessionQueryHandler := queryHandler.WithNewSession()
+		_, err := sessionQueryHandler.HandleSimpleQuery("SET bemidb.query_stats = on")
+		testNoError(t, err)
+
+		messages, err := sessionQueryHandler.HandleSimpleQuery("SELECT 1; SELECT * FROM (VALUES (1), (2)) t(id)")
+
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{
+			&pgproto3.RowDescription{},
+			&pgproto3.DataRow{},
+			&pgproto3.CommandComplete{},
+			&pgproto3.RowDescription{},
+			&pgproto3.DataRow{},
+			&pgproto3.DataRow{},
+			&pgproto3.CommandComplete{},
+			&pgproto3.NoticeResponse{},
+		})
+		notice := messages[7].(*pgproto3.NoticeResponse)
+		if notice.Code != PG_ERROR_CODE_SUCCESSFUL_COMPLETION || !strings.HasPrefix(notice.Message, "Query stats: duration: ") || !strings.HasSuffix(notice.Message, ", rows: 3, bytes scanned: 0 (0 requests)") {
+			t.Errorf("Expected the query stats of both statements, got %s", notice.Message)
+		}
+		if queryHandler.QueryRemapper.Session.QueryStatsEnabled {
+			t.Errorf("Expected query stats to be disabled for other sessions")
+		}
+	})
+
+	t.Run("Doesn't return query stats after disabling them", func(t *testing.T) {
+		sessionQueryHandler := queryHandler.WithNewSession()
+		_, err := sessionQueryHandler.HandleSimpleQuery("SET bemidb.query_stats = on")
+		testNoError(t, err)
+		_, err = sessionQueryHandler.HandleSimpleQuery("SET bemidb.query_stats = off")
+		testNoError(t, err)
+
+		messages, err := sessionQueryHandler.HandleSimpleQuery("SELECT 1")
+
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{
+			&pgproto3.RowDescription{},
+			&pgproto3.DataRow{},
+			&pgproto3.CommandComplete{},
+		})
+	})
+
+	t.Run("Admits a table query under memory pressure if no other table queries are running", func(t *testing.T) {
+		memoryConfig := *queryHandler.Config
+		memoryConfig.MemoryPressurePercent = 1
+		sessionQueryHandler := queryHandler.WithNewSession()
+		sessionQueryHandler.MemoryAdmission = NewMemoryAdmissionController(&memoryConfig, queryHandler.ServerDuckdbClient)
+
+		messages, err := sessionQueryHandler.HandleSimpleQuery("SELECT COUNT(*) FROM postgres.test_table")
+
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{
+			&pgproto3.RowDescription{},
+			&pgproto3.DataRow{},
+			&pgproto3.CommandComplete{},
+		})
+		metrics := sessionQueryHandler.MemoryAdmission.Metrics()
+		if metrics.AdmittedCount != 1 || metrics.QueuedCount != 0 {
+			t.Errorf("Expected 1 admitted and 0 queued queries, got %s", metrics.String())
+		}
+	})
+
+	t.Run("Returns a not supported error for COPY from a file", func(t *testing.T) {
+		_, err := queryHandler.HandleSimpleQuery("COPY postgres.test_table FROM '/tmp/test_table.csv'")
+
+		var pgError *PgError
+		if !errors.As(err, &pgError) {
+			t.Fatalf("Expected a PgError, got %v", err)
+		}
+		if pgError.Code != PG_ERROR_CODE_FEATURE_NOT_SUPPORTED {
+			t.Errorf("Expected the error code to be %s, got %s", PG_ERROR_CODE_FEATURE_NOT_SUPPORTED, pgError.Code)
+		}
+	})
+
+	t.Run("Returns an error for INSERT into a table that does not exist", func(t *testing.T) {
+		_, err := queryHandler.HandleSimpleQuery("INSERT INTO postgres.non_existent_table (id) VALUES (1)")
+
+		var pgError *PgError
+		if !errors.As(err, &pgError) || pgError.Code != PG_ERROR_CODE_UNDEFINED_TABLE {
+			t.Errorf("Expected an undefined table error, got %v", err)
+		}
+	})
+
+	t.Run("Returns an error for CREATE SCHEMA with an existing or reserved name", func(t *testing.T) {
+		_, err := queryHandler.HandleSimpleQuery("CREATE SCHEMA public")
+
+		var pgError *PgError
+		if !errors.As(err, &pgError) || pgError.Code != PG_ERROR_CODE_DUPLICATE_SCHEMA {
+			t.Errorf("Expected a duplicate schema error, got %v", err)
+		}
+
+		_, err = queryHandler.HandleSimpleQuery("CREATE SCHEMA postgres")
+
+		if !errors.As(err, &pgError) || pgError.Code != PG_ERROR_CODE_DUPLICATE_SCHEMA || pgError.Message != `schema "postgres" already exists` {
+			t.Errorf("Expected a duplicate schema error for a schema in the catalog, got %v", err)
+		}
+
+		messages, err := queryHandler.HandleSimpleQuery("CREATE SCHEMA IF NOT EXISTS public")
+
+		testNoError(t, err)
+		testCommandCompleteTag(t, messages[0], "CREATE SCHEMA")
+
+		_, err = queryHandler.HandleSimpleQuery("CREATE SCHEMA pg_analytics")
+
+		if !errors.As(err, &pgError) || pgError.Code != PG_ERROR_CODE_RESERVED_NAME {
+			t.Errorf("Expected a reserved name error, got %v", err)
+		}
+	})
+
+	t.Run("Updates and deletes rows of a temp table", func(t *testing.T) {
+		sessionQueryHandler := queryHandler.WithNewSession()
+		defer sessionQueryHandler.QueryRemapper.DropTempTables()
+
+		_, err := sessionQueryHandler.HandleSimpleQuery("CREATE TEMP TABLE changed_rows (id INT, name TEXT); INSERT INTO changed_rows VALUES (1, 'a'), (2, 'b'), (3, 'c')")
+		testNoError(t, err)
+
+		messages, err := sessionQueryHandler.HandleSimpleQuery("UPDATE changed_rows SET name = upper(name) WHERE id IN (SELECT id FROM changed_rows WHERE id > 1); DELETE FROM changed_rows WHERE id = 3")
+
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{
+			&pgproto3.CommandComplete{},
+			&pgproto3.CommandComplete{},
+		})
+		testCommandCompleteTag(t, messages[0], "UPDATE 2")
+		testCommandCompleteTag(t, messages[1], "DELETE 1")
+
+		messages, err = sessionQueryHandler.HandleSimpleQuery("SELECT name FROM changed_rows ORDER BY id")
+
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{
+			&pgproto3.RowDescription{},
+			&pgproto3.DataRow{},
+			&pgproto3.DataRow{},
+			&pgproto3.CommandComplete{},
+		})
+		testDataRowValues(t, messages[1], []string{"a"})
+		testDataRowValues(t, messages[2], []string{"B"})
+	})
+
+	t.Run("Inserts rows with a WITH clause into a temp table", func(t *testing.T) {
+		sessionQueryHandler := queryHandler.WithNewSession()
+		defer sessionQueryHandler.QueryRemapper.DropTempTables()
+
+		_, err := sessionQueryHandler.HandleSimpleQuery("CREATE TEMP TABLE cte_rows (id INT)")
+		testNoError(t, err)
+
+		messages, err := sessionQueryHandler.HandleSimpleQuery("WITH ids AS (SELECT 1 AS id) INSERT INTO cte_rows SELECT id FROM ids; WITH ids AS (SELECT 2 AS id) INSERT INTO cte_rows WITH next_ids AS (SELECT id + 1 AS id FROM ids) SELECT id FROM next_ids")
+
+		testNoError(t, err)
+		testCommandCompleteTag(t, messages[0], "INSERT 0 1")
+		testCommandCompleteTag(t, messages[1], "INSERT 0 1")
+
+		messages, err = sessionQueryHandler.HandleSimpleQuery("SELECT string_agg(id::text, ',' ORDER BY id) FROM cte_rows")
+
+		testNoError(t, err)
+		testDataRowValues(t, messages[1], []string{"1,3"})
+	})
+
+	t.Run("Appends, updates, and deletes rows of a table created with CREATE TABLE ... AS", func(t *testing.T) {
+		_, err := queryHandler.HandleSimpleQuery("CREATE TABLE postgres.written_rows AS SELECT 1 AS id, 'a' AS name")
+		testNoError(t, err)
+		defer queryHandler.HandleSimpleQuery("DROP TABLE postgres.written_rows")
+
+		messages, err := queryHandler.HandleSimpleQuery("INSERT INTO postgres.written_rows VALUES (2, 'b'), (3, 'c'); WITH ids AS (SELECT 4 AS id) INSERT INTO postgres.written_rows (id) SELECT id FROM ids")
+
+		testNoError(t, err)
+		testCommandCompleteTag(t, messages[0], "INSERT 0 2")
+		testCommandCompleteTag(t, messages[1], "INSERT 0 1")
+
+		messages, err = queryHandler.HandleSimpleQuery("UPDATE postgres.written_rows SET name = upper(name) WHERE id IN (1, 2); DELETE FROM postgres.written_rows WHERE id = 3; DELETE FROM postgres.written_rows WHERE id = 5")
+
+		testNoError(t, err)
+		testCommandCompleteTag(t, messages[0], "UPDATE 2")
+		testCommandCompleteTag(t, messages[1], "DELETE 1")
+		testCommandCompleteTag(t, messages[2], "DELETE 0")
+
+		messages, err = queryHandler.HandleSimpleQuery("SELECT string_agg(id || ':' || COALESCE(name, 'NULL'), ',' ORDER BY id) FROM postgres.written_rows")
+
+		testNoError(t, err)
+		testDataRowValues(t, messages[1], []string{"1:A,2:B,4:NULL"})
+	})
+
+	t.Run("Writes to unqualified tables with SET search_path", func(t *testing.T) {
+		_, err := queryHandler.HandleSimpleQuery("CREATE TABLE postgres.search_path_rows AS SELECT 1 AS id, 'a' AS name")
+		testNoError(t, err)
+		defer queryHandler.HandleSimpleQuery("DROP TABLE postgres.search_path_rows")
+		sessionQueryHandler := queryHandler.WithNewSession()
+		_, err = sessionQueryHandler.HandleSimpleQuery("SET search_path = postgres, public")
+		testNoError(t, err)
+
+		messages, err := sessionQueryHandler.HandleSimpleQuery("INSERT INTO search_path_rows VALUES (2, 'b'), (3, 'c'); UPDATE search_path_rows SET name = upper(name) WHERE id = 1; DELETE FROM search_path_rows WHERE id = 3")
+
+		testNoError(t, err)
+		testCommandCompleteTag(t, messages[0], "INSERT 0 2")
+		testCommandCompleteTag(t, messages[1], "UPDATE 1")
+		testCommandCompleteTag(t, messages[2], "DELETE 1")
+
+		messages, err = sessionQueryHandler.HandleSimpleQuery("SELECT string_agg(id || ':' || name, ',' ORDER BY id) FROM search_path_rows")
+
+		testNoError(t, err)
+		testDataRowValues(t, messages[1], []string{"1:A,2:b"})
+	})
+
+	t.Run("Returns an error for INSERT, UPDATE, and DELETE of a synced table", func(t *testing.T) {
+		for _, query := range []string{
+			"INSERT INTO postgres.test_table (id) VALUES (3)",
+			"UPDATE postgres.test_table SET bit_column = '0' WHERE id = 1",
+			"DELETE FROM postgres.test_table WHERE id = 1",
+		} {
+			_, err := queryHandler.HandleSimpleQuery(query)
+
+			var pgError *PgError
+			if !errors.As(err, &pgError) || pgError.Code != PG_ERROR_CODE_INSUFFICIENT_PRIVILEGE {
+				t.Errorf("Expected an insufficient privilege error for %s, got %v", query, err)
+			}
+		}
+	})
+
+	t.Run("Returns an error for UPDATE and DELETE with RETURNING", func(t *testing.T) {
+		for _, query := range []string{
+			"UPDATE postgres.test_table SET bit_column = '0' RETURNING id",
+			"DELETE FROM postgres.test_table RETURNING id",
+		} {
+			_, err := queryHandler.HandleSimpleQuery(query)
+
+			var pgError *PgError
+			if !errors.As(err, &pgError) || pgError.Code != PG_ERROR_CODE_FEATURE_NOT_SUPPORTED {
+				t.Errorf("Expected a not supported error for %s, got %v", query, err)
+			}
+		}
+	})
+
+	t.Run("Returns an error for CREATE TABLE ... AS with an existing name or a column list", func(t *testing.T) {
+		for query, expectedCode := range map[string]string{
+			"CREATE TABLE postgres.test_table AS SELECT 1 AS id": PG_ERROR_CODE_DUPLICATE_TABLE,
+			"CREATE TABLE postgres.new_table (id) AS SELECT 1":   PG_ERROR_CODE_FEATURE_NOT_SUPPORTED,
+		} {
+			_, err := queryHandler.HandleSimpleQuery(query)
+
+			var pgError *PgError
+			if !errors.As(err, &pgError) || pgError.Code != expectedCode {
+				t.Errorf("Expected error code %s for %s, got %v", expectedCode, query, err)
+			}
+		}
+	})
+
+	t.Run("Creates, queries, and drops a view with CREATE VIEW", func(t *testing.T) {
+		messages, err := queryHandler.HandleSimpleQuery("CREATE VIEW postgres.test_view AS SELECT id FROM postgres.test_table WHERE id IS NOT NULL")
+
+		testNoError(t, err)
+		testCommandCompleteTag(t, messages[0], "CREATE VIEW")
+
+		testResponseByQuery(t, queryHandler, map[string]map[string][]string{
+			"SELECT id FROM postgres.test_view ORDER BY id DESC LIMIT 1": {
+				"description": {"id"},
+				"types":       {uint32ToString(pgtype.Int4OID)},
+				"values":      {"2"},
+			},
+			"SELECT viewname FROM pg_views WHERE schemaname = 'postgres'": {
+				"description": {"viewname"},
+				"types":       {uint32ToString(pgtype.TextOID)},
+				"values":      {"test_view"},
+			},
+			"SELECT table_name, check_option FROM information_schema.views WHERE table_schema = 'postgres'": {
+				"description": {"table_name", "check_option"},
+				"types":       {uint32ToString(pgtype.TextOID), uint32ToString(pgtype.TextOID)},
+				"values":      {"test_view", "NONE"},
+			},
+		})
+
+		for query, expectedCode := range map[string]string{
+			"CREATE VIEW postgres.test_view AS SELECT 1 AS id":                              PG_ERROR_CODE_DUPLICATE_TABLE,
+			"CREATE VIEW postgres.test_table AS SELECT 1 AS id":                             PG_ERROR_CODE_DUPLICATE_TABLE,
+			"CREATE OR REPLACE VIEW postgres.test_view AS SELECT * FROM postgres.test_view": PG_ERROR_CODE_INVALID_OBJECT_DEFINITION,
+			"CREATE VIEW postgres.new_view (id) AS SELECT 1":                                PG_ERROR_CODE_FEATURE_NOT_SUPPORTED,
+			"DROP VIEW postgres.test_table":                                                 PG_ERROR_CODE_WRONG_OBJECT_TYPE,
+		} {
+			_, err := queryHandler.HandleSimpleQuery(query)
+
+			var pgError *PgError
+			if !errors.As(err, &pgError) || pgError.Code != expectedCode {
+				t.Errorf("Expected error code %s for %s, got %v", expectedCode, query, err)
+			}
+		}
+
+		messages, err = queryHandler.HandleSimpleQuery("DROP VIEW postgres.test_view")
+
+		testNoError(t, err)
+		testCommandCompleteTag(t, messages[0], "DROP VIEW")
+
+		_, err = queryHandler.HandleSimpleQuery("DROP VIEW postgres.test_view")
+
+		var pgError *PgError
+		if !errors.As(err, &pgError) || pgError.Code != PG_ERROR_CODE_UNDEFINED_TABLE {
+			t.Errorf("Expected an undefined table error, got %v", err)
+		}
+	})
+
+	t.Run("Creates views reading tables that aren't synced yet", func(t *testing.T) {
+		_, err := queryHandler.HandleSimpleQuery("CREATE VIEW postgres.pending_view AS SELECT id FROM postgres.pending_table")
+		testNoError(t, err)
+		_, err = queryHandler.HandleSimpleQuery("CREATE VIEW postgres.pending_summary AS SELECT COUNT(*) AS count FROM postgres.pending_view")
+		testNoError(t, err)
+		defer queryHandler.HandleSimpleQuery("DROP VIEW postgres.pending_summary, postgres.pending_view")
+
+		testResponseByQuery(t, queryHandler, map[string]map[string][]string{
+			"SELECT viewname FROM pg_views WHERE schemaname = 'postgres' AND viewname = 'pending_view'": {
+				"description": {"viewname"},
+				"types":       {uint32ToString(pgtype.TextOID)},
+				"values":      {"pending_view"},
+			},
+		})
+
+		for _, query := range []string{"SELECT * FROM postgres.pending_view", "SELECT * FROM postgres.pending_summary"} {
+			_, err = queryHandler.HandleSimpleQuery(query)
+
+			var pgError *PgError
+			if !errors.As(err, &pgError) || pgError.Code != PG_ERROR_CODE_UNDEFINED_TABLE {
+				t.Errorf("Expected an undefined table error for %s, got %v", query, err)
+			} else if pgError.Message != "relation \"postgres.pending_table\" does not exist" {
+				t.Errorf("Expected the error to name the unsynced table, got %s", pgError.Message)
+			}
+		}
+	})
+
+	t.Run("Returns an error for renaming or dropping a synced table", func(t *testing.T) {
+		for _, query := range []string{
+			"ALTER TABLE postgres.test_table RENAME TO renamed_table",
+			"DROP TABLE postgres.test_table",
+		} {
+			_, err := queryHandler.HandleSimpleQuery(query)
+
+			var pgError *PgError
+			if !errors.As(err, &pgError) || pgError.Code != PG_ERROR_CODE_INSUFFICIENT_PRIVILEGE {
+				t.Errorf("Expected error code %s for %s, got %v", PG_ERROR_CODE_INSUFFICIENT_PRIVILEGE, query, err)
+			}
+		}
+
+		testResponseByQuery(t, queryHandler, map[string]map[string][]string{
+			"SELECT COUNT(*) FROM pg_catalog.pg_class WHERE relname = 'test_table'": {
+				"description": {"count"},
+				"types":       {uint32ToString(pgtype.Int8OID)},
+				"values":      {"1"},
+			},
+		})
+	})
+
+	t.Run("Adds, renames, and drops columns of a temp table", func(t *testing.T) {
+		sessionQueryHandler := queryHandler.WithNewSession()
+		defer sessionQueryHandler.QueryRemapper.DropTempTables()
+
+		_, err := sessionQueryHandler.HandleSimpleQuery("CREATE TEMP TABLE altered_columns (id INT, name TEXT); INSERT INTO altered_columns VALUES (1, 'a')")
+		testNoError(t, err)
+
+		messages, err := sessionQueryHandler.HandleSimpleQuery("ALTER TABLE altered_columns ADD COLUMN age INT; ALTER TABLE altered_columns RENAME COLUMN name TO full_name; ALTER TABLE altered_columns DROP COLUMN id")
+
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{
+			&pgproto3.CommandComplete{},
+			&pgproto3.CommandComplete{},
+			&pgproto3.CommandComplete{},
+		})
+		testCommandCompleteTag(t, messages[0], "ALTER TABLE")
+
+		messages, err = sessionQueryHandler.HandleSimpleQuery("SELECT * FROM altered_columns")
+
+		testNoError(t, err)
+		testRowDescription(t, messages[0], []string{"full_name", "age"}, []string{uint32ToString(pgtype.TextOID), uint32ToString(pgtype.Int4OID)})
+		testDataRowValues(t, messages[1], []string{"a", ""})
+	})
+
+	t.Run("Returns an error when executing a prepared statement with a wrong number of parameters", func(t *testing.T) {
+		sessionQueryHandler := queryHandler.WithNewSession()
+		sessionQueryHandler.HandleSimpleQuery("PREPARE test_statement AS SELECT $1 AS value")
+
+		_, err := sessionQueryHandler.HandleSimpleQuery("EXECUTE test_statement")
+
+		if err == nil {
+			t.Fatalf("Expected an error, got nil")
+		}
+
+		expectedErrorMessage := "wrong number of parameters for prepared statement \"test_statement\""
+		if err.Error() != expectedErrorMessage {
+			t.Errorf("Expected the error to be '"+expectedErrorMessage+"', got %v", err.Error())
+		}
+	})
+
+	t.Run("Allows setting and querying timezone", func(t *testing.T) {
+		queryHandler.HandleSimpleQuery("SET timezone = 'UTC'")
+
+		messages, err := queryHandler.HandleSimpleQuery("show timezone")
+
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{
+			&pgproto3.RowDescription{},
+			&pgproto3.DataRow{},
+			&pgproto3.CommandComplete{},
+		})
+		testRowDescription(t, messages[0], []string{"timezone"}, []string{uint32ToString(pgtype.TextOID)})
+		testDataRowValues(t, messages[1], []string{"UTC"})
+		testCommandCompleteTag(t, messages[2], "SHOW")
+	})
+
+	t.Run("Converts timestamps with named time zones around DST transitions", func(t *testing.T) {
+		sessionQueryHandler := queryHandler.WithNewSession()
+
+		_, err := sessionQueryHandler.HandleSimpleQuery("SET timezone = 'america/new_york'")
+		testNoError(t, err)
+
+		testResponseByQuery(t, sessionQueryHandler, map[string]map[string][]string{
+			"SHOW timezone": {
+				"description": {"timezone"},
+				"types":       {uint32ToString(pgtype.TextOID)},
+				"values":      {"America/New_York"},
+			},
+			"SELECT TIMESTAMPTZ '2024-03-10 06:59:59+00' AS before, TIMESTAMPTZ '2024-03-10 07:00:00+00' AS after": {
+				"description": {"before", "after"},
+				"types":       {uint32ToString(pgtype.TimestamptzOID), uint32ToString(pgtype.TimestamptzOID)},
+				"values":      {"2024-03-10 01:59:59-05:00", "2024-03-10 03:00:00-04:00"},
+			},
+			// Skipped local time in the spring -> offset before the transition
+			"SELECT TIMESTAMP '2024-03-10 02:30:00' AT TIME ZONE 'America/New_York' AS timezone": {
+				"description": {"timezone"},
+				"types":       {uint32ToString(pgtype.TimestamptzOID)},
+				"values":      {"2024-03-10 03:30:00-04:00"},
+			},
+			// Ambiguous local time in the fall -> offset after the transition (standard time)
+			"SELECT TIMESTAMP '2024-11-03 01:30:00' AT TIME ZONE 'America/New_York' AS timezone": {
+				"description": {"timezone"},
+				"types":       {uint32ToString(pgtype.TimestamptzOID)},
+				"values":      {"2024-11-03 01:30:00-05:00"},
+			},
+			"SELECT TIMESTAMPTZ '2024-11-03 05:30:00+00' AT TIME ZONE 'Europe/Paris' AS timezone": {
+				"description": {"timezone"},
+				"types":       {uint32ToString(pgtype.TimestampOID)},
+				"values":      {"2024-11-03 06:30:00"},
+			},
+		})
+
+		_, err = sessionQueryHandler.HandleSimpleQuery("SET timezone = 'Mars/Olympus'")
+
+		expectedErrorMessage := `invalid value for parameter "TimeZone": "Mars/Olympus"`
+		if err == nil || err.Error() != expectedErrorMessage {
+			t.Errorf("Expected the error to be '"+expectedErrorMessage+"', got %v", err)
+		}
+
+		_, err = sessionQueryHandler.HandleSimpleQuery("RESET timezone")
+		testNoError(t, err)
+
+		testResponseByQuery(t, sessionQueryHandler, map[string]map[string][]string{
+			"SELECT TIMESTAMPTZ '2024-03-10 07:00:00+00' AS utc": {
+				"description": {"utc"},
+				"types":       {uint32ToString(pgtype.TimestamptzOID)},
+				"values":      {"2024-03-10 07:00:00+00:00"},
+			},
+		})
+	})
+
+	t.Run("Routes queries to the logical database selected in the startup message", func(t *testing.T) {
+		queryHandler.Config.Databases = map[string][]string{"staging": {PG_SCHEMA_PUBLIC}}
+		defer func() { queryHandler.Config.Databases = nil }()
+		sessionQueryHandler := queryHandler.WithNewSession()
+		sessionQueryHandler.QueryRemapper.Session.Database = "staging"
+
+		testResponseByQuery(t, sessionQueryHandler, map[string]map[string][]string{
+			"SELECT current_database()": {
+				"description": {"current_database"},
+				"types":       {uint32ToString(pgtype.TextOID)},
+				"values":      {"staging"},
+			},
+		})
+
+		_, err := sessionQueryHandler.HandleSimpleQuery("SELECT COUNT(*) FROM postgres.test_table")
+
+		var pgError *PgError
+		if !errors.As(err, &pgError) || pgError.Code != PG_ERROR_CODE_UNDEFINED_TABLE {
+			t.Fatalf("Expected an undefined table error for a table outside of the database schemas, got %v", err)
+		}
+		if pgError.Message != "relation \"postgres.test_table\" does not exist" {
+			t.Errorf("Expected the error to name the table, got %v", pgError.Message)
+		}
+	})
+
+	t.Run("Rejects writes to tables outside the logical database", func(t *testing.T) {
+		queryHandler.Config.Databases = map[string][]string{"staging": {PG_SCHEMA_PUBLIC}}
+		defer func() { queryHandler.Config.Databases = nil }()
+		sessionQueryHandler := queryHandler.WithNewSession()
+		sessionQueryHandler.QueryRemapper.Session.Database = "staging"
+
+		for _, query := range []string{
+			"INSERT INTO postgres.test_table (id) VALUES (1)",
+			"UPDATE postgres.test_table SET id = 1",
+			"DELETE FROM postgres.test_table WHERE id = 1",
+		} {
+			_, err := sessionQueryHandler.HandleSimpleQuery(query)
+
+			var pgError *PgError
+			if !errors.As(err, &pgError) || pgError.Code != PG_ERROR_CODE_UNDEFINED_TABLE {
+				t.Fatalf("Expected an undefined table error for %s, got %v", query, err)
+			}
+			if pgError.Message != "relation \"postgres.test_table\" does not exist" {
+				t.Errorf("Expected the error to name the table, got %v", pgError.Message)
+			}
+		}
+	})
+
+	t.Run("Hides schemas outside the logical database from the catalog", func(t *testing.T) {
+		queryHandler.Config.Databases = map[string][]string{"staging": {PG_SCHEMA_PUBLIC}}
+		defer func() { queryHandler.Config.Databases = nil }()
+		sessionQueryHandler := queryHandler.WithNewSession()
+		sessionQueryHandler.QueryRemapper.Session.Database = "staging"
+
+		for _, query := range []string{
+			"SELECT COUNT(*) FROM pg_namespace WHERE nspname = 'postgres'",
+			"SELECT COUNT(*) FROM pg_catalog.pg_class c JOIN pg_catalog.pg_namespace n ON n.oid = c.relnamespace WHERE n.nspname = 'postgres'",
+			"SELECT COUNT(*) FROM pg_attribute WHERE attrelid = (SELECT table_oid FROM duckdb_tables() WHERE schema_name = 'postgres' AND table_name = 'test_table')",
+			"SELECT COUNT(*) FROM pg_constraint c WHERE c.conrelid = (SELECT table_oid FROM duckdb_tables() WHERE schema_name = 'postgres' AND table_name = 'test_table')",
+			"SELECT COUNT(*) FROM pg_tables WHERE schemaname = 'postgres'",
+		} {
+			testResponseByQuery(t, sessionQueryHandler, map[string]map[string][]string{
+				query: {
+					"description": {"count"},
+					"types":       {uint32ToString(pgtype.Int8OID)},
+					"values":      {"0"},
+				},
+			})
+		}
+		testResponseByQuery(t, queryHandler, map[string]map[string][]string{
+			"SELECT COUNT(*) FROM pg_namespace WHERE nspname = 'postgres'": {
+				"description": {"count"},
+				"types":       {uint32ToString(pgtype.Int8OID)},
+				"values":      {"1"},
+			},
+		})
+	})
+
+	t.Run("Allows enabling trace logging for the current session", func(t *testing.T) {
+		sessionQueryHandler := queryHandler.WithNewSession()
+
+		messages, err := sessionQueryHandler.HandleSimpleQuery("SET bemidb.trace = on")
+
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{
+			&pgproto3.CommandComplete{},
+		})
+		testCommandCompleteTag(t, messages[0], "SET")
+		if !sessionQueryHandler.QueryRemapper.Session.TraceEnabled {
+			t.Errorf("Expected trace to be enabled for the session")
+		}
+		if queryHandler.QueryRemapper.Session.TraceEnabled {
+			t.Errorf("Expected trace to be disabled for other sessions")
+		}
+
+		_, err = sessionQueryHandler.HandleSimpleQuery("RESET bemidb.trace")
+
+		testNoError(t, err)
+		if sessionQueryHandler.QueryRemapper.Session.TraceEnabled {
+			t.Errorf("Expected trace to be disabled after RESET")
+		}
+	})
+
+	t.Run("Applies join planning settings to the current session queries", func(t *testing.T) {
+		sessionQueryHandler := queryHandler.WithNewSession()
+
+		_, err := sessionQueryHandler.HandleSimpleQuery("SET bemidb.join_order = off")
+		testNoError(t, err)
+		_, err = sessionQueryHandler.HandleSimpleQuery("SET bemidb.merge_join_threshold = 0")
+		testNoError(t, err)
+
+		messages, err := sessionQueryHandler.HandleSimpleQuery("SELECT value FROM duckdb_settings() WHERE name = 'disabled_optimizers'")
+
+		testNoError(t, err)
+		testDataRowValues(t, messages[1], []string{"join_order,build_side_probe_side"})
+
+		messages, err = queryHandler.HandleSimpleQuery("SELECT value FROM duckdb_settings() WHERE name = 'disabled_optimizers'")
+
+		testNoError(t, err)
+		testDataRowValues(t, messages[1], []string{""})
+
+		_, err = sessionQueryHandler.HandleSimpleQuery("RESET bemidb.join_order")
+		testNoError(t, err)
+
+		messages, err = sessionQueryHandler.HandleSimpleQuery("SELECT value FROM duckdb_settings() WHERE name = 'disabled_optimizers'")
+
+		testNoError(t, err)
+		testDataRowValues(t, messages[1], []string{""})
+	})
+
+	t.Run("Applies join planning settings set earlier in the same query and in a transaction block", func(t *testing.T) {
+		sessionQueryHandler := queryHandler.WithNewSession()
+
+		messages, err := sessionQueryHandler.HandleSimpleQuery("SET bemidb.merge_join_threshold = 0; BEGIN; SELECT value FROM duckdb_settings() WHERE name = 'merge_join_threshold'; COMMIT")
+
+		testNoError(t, err)
+		testDataRowValues(t, messages[3], []string{"0"})
+	})
+
+	t.Run("Applies S3 request settings to the current session queries", func(t *testing.T) {
+		sessionQueryHandler := queryHandler.WithNewSession()
+
+		_, err := sessionQueryHandler.HandleSimpleQuery("SET bemidb.http_retries = 7")
+		testNoError(t, err)
+
+		messages, err := sessionQueryHandler.HandleSimpleQuery("SELECT value FROM duckdb_settings() WHERE name = 'http_retries'")
+
+		testNoError(t, err)
+		testDataRowValues(t, messages[1], []string{"7"})
+
+		_, err = sessionQueryHandler.HandleSimpleQuery("SET bemidb.http_retries = 'many'")
+
+		var pgError *PgError
+		if !errors.As(err, &pgError) || pgError.Code != PG_ERROR_CODE_INVALID_PARAMETER_VALUE {
+			t.Errorf("Expected an invalid parameter value error, got %v", err)
+		}
+	})
+
+	t.Run("Shows but doesn't set max parallel downloads in a session", func(t *testing.T) {
+		messages, err := queryHandler.HandleSimpleQuery("SHOW bemidb.max_parallel_downloads")
+
+		testNoError(t, err)
+		testDataRowValues(t, messages[1], []string{common.IntToString(DEFAULT_MAX_PARALLEL_DOWNLOADS)})
+
+		_, err = queryHandler.HandleSimpleQuery("SET bemidb.max_parallel_downloads = 8")
+
+		var pgError *PgError
+		if !errors.As(err, &pgError) || pgError.Code != PG_ERROR_CODE_CANT_CHANGE_RUNTIME_PARAM {
+			t.Errorf("Expected a runtime parameter error, got %v", err)
+		}
+	})
+
+	t.Run("Cancels a query running longer than the session statement timeout", func(t *testing.T) {
+		sessionQueryHandler := queryHandler.WithNewSession()
+
+		_, err := sessionQueryHandler.HandleSimpleQuery("SET statement_timeout = '10ms'")
+		testNoError(t, err)
+
+		_, err = sessionQueryHandler.HandleSimpleQuery("SELECT SUM(a.range * b.range) FROM range(100000) a, range(100000) b")
+
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Expected the statement timeout error, got %v", err)
+		}
+
+		_, err = sessionQueryHandler.HandleSimpleQuery("SET statement_timeout = '1 year'")
+
+		expectedErrorMessage := `invalid value for parameter "statement_timeout": "1 year"`
+		if err == nil || err.Error() != expectedErrorMessage {
+			t.Errorf("Expected the error to be '"+expectedErrorMessage+"', got %v", err)
+		}
+	})
+
+	t.Run("Handles an empty query", func(t *testing.T) {
+		messages, err := queryHandler.HandleSimpleQuery("-- ping")
+
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{
+			&pgproto3.EmptyQueryResponse{},
+		})
+	})
+
+	t.Run("Handles a DISCARD ALL query", func(t *testing.T) {
+		messages, err := queryHandler.HandleSimpleQuery("DISCARD ALL")
+
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{
+			&pgproto3.CommandComplete{},
+		})
+		testCommandCompleteTag(t, messages[0], "DISCARD ALL")
+	})
+
+	t.Run("Handles a BEGIN query", func(t *testing.T) {
+		messages, err := queryHandler.HandleSimpleQuery("BEGIN")
+
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{
+			&pgproto3.CommandComplete{},
+		})
+		testCommandCompleteTag(t, messages[0], "BEGIN")
+	})
+}
+
+func TestHandleParseQuery(t *testing.T) {
+	queryHandler := initQueryHandler()
+	defer queryHandler.ServerDuckdbClient.Close()
+
+	t.Run("Handles PARSE extended query step", func(t *testing.T) {
+		query := "SELECT usename, passwd FROM pg_shadow WHERE usename=$1"
+		message := &pgproto3.Parse{Query: query}
+
+		messages, preparedStatement, err := queryHandler.HandleParseQuery(message)
+
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{
+			&pgproto3.ParseComplete{},
+		})
+
+		remappedQuery := "SELECT usename, passwd FROM main.pg_shadow WHERE usename = $1"
+		if preparedStatement.Query != remappedQuery {
+			t.Errorf("Expected the prepared statement query to be %v, got %v", remappedQuery, preparedStatement.Query)
+		}
+		if preparedStatement.Statement == nil {
+			t.Errorf("Expected the prepared statement to have a statement")
+		}
+	})
+
+	t.Run("Handles PARSE extended query step if query is empty", func(t *testing.T) {
+		message := &pgproto3.Parse{Query: ""}
+
+		messages, preparedStatement, err := queryHandler.HandleParseQuery(message)
+
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{
+			&pgproto3.ParseComplete{},
+		})
+
+		if preparedStatement.Query != "" {
+			t.Errorf("Expected the prepared statement query to be empty, got %v", preparedStatement.Query)
+		}
+		if preparedStatement.Statement != nil {
+			t.Errorf("Expected the prepared statement not to have a statement, got %v", preparedStatement.Statement)
+		}
+	})
+	t.Run("Returns an error for PARSE with the name of an existing statement", func(t *testing.T) {
+		message := &pgproto3.Parse{Name: "duplicate_statement", Query: "SELECT 1"}
+		_, _, err := queryHandler.HandleParseQuery(message)
+		testNoError(t, err)
+
+		_, _, err = queryHandler.HandleParseQuery(message)
+
+		if err == nil {
+			t.Fatalf("Expected an error for a duplicate prepared statement, got nil")
+		}
+		if err.Error() != "prepared statement \"duplicate_statement\" already exists" {
+			t.Errorf("Expected the error to be 'prepared statement \"duplicate_statement\" already exists', got %v", err.Error())
+		}
+	})
+}
+
+func TestHandleBindQuery(t *testing.T) {
+	queryHandler := initQueryHandler()
+	defer queryHandler.ServerDuckdbClient.Close()
+
+	t.Run("Handles BIND extended query step with text format parameter", func(t *testing.T) {
+		parseMessage := &pgproto3.Parse{Query: "SELECT usename, passwd FROM pg_shadow WHERE usename=$1"}
+		_, preparedStatement, err := queryHandler.HandleParseQuery(parseMessage)
+		testNoError(t, err)
+
+		bindMessage := &pgproto3.Bind{
+			Parameters:           [][]byte{[]byte("user")},
+			ParameterFormatCodes: []int16{0}, // Text format
+		}
+		messages, preparedStatement, err := queryHandler.HandleBindQuery(bindMessage, preparedStatement)
+
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{
+			&pgproto3.BindComplete{},
+		})
+		if len(preparedStatement.Variables) != 1 {
+			t.Errorf("Expected the prepared statement to have 1 variable, got %v", len(preparedStatement.Variables))
+		}
+		if preparedStatement.Variables[0] != "user" {
+			t.Errorf("Expected the prepared statement variable to be 'user', got %v", preparedStatement.Variables[0])
+		}
+	})
+
+	t.Run("Handles BIND extended query step with binary format 4-byte parameter", func(t *testing.T) {
+		parseMessage := &pgproto3.Parse{Query: "SELECT c.oid FROM pg_catalog.pg_class c WHERE c.relnamespace = $1"}
+		_, preparedStatement, err := queryHandler.HandleParseQuery(parseMessage)
+		testNoError(t, err)
+
+		paramValue := int32(2200)
+		paramBytes := make([]byte, 4)
+		binary.BigEndian.PutUint32(paramBytes, uint32(paramValue))
+
+		bindMessage := &pgproto3.Bind{
+			Parameters:           [][]byte{paramBytes},
+			ParameterFormatCodes: []int16{1}, // Binary format
+		}
+		messages, preparedStatement, err := queryHandler.HandleBindQuery(bindMessage, preparedStatement)
+
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{
+			&pgproto3.BindComplete{},
+		})
+		if len(preparedStatement.Variables) != 1 {
+			t.Errorf("Expected the prepared statement to have 1 variable, got %v", len(preparedStatement.Variables))
+		}
+		if preparedStatement.Variables[0] != paramValue {
+			t.Errorf("Expected the prepared statement variable to be %v, got %v", paramValue, preparedStatement.Variables[0])
+		}
+	})
+
+	t.Run("Handles BIND extended query step with binary format 8-byte parameter", func(t *testing.T) {
+		parseMessage := &pgproto3.Parse{Query: "SELECT c.oid FROM pg_catalog.pg_class c WHERE c.relnamespace = $1"}
+		_, preparedStatement, err := queryHandler.HandleParseQuery(parseMessage)
+		testNoError(t, err)
+
+		paramValue := int64(2200)
+		paramBytes := make([]byte, 8)
+		binary.BigEndian.PutUint64(paramBytes, uint64(paramValue))
+
+		bindMessage := &pgproto3.Bind{
+			Parameters:           [][]byte{paramBytes},
+			ParameterFormatCodes: []int16{1}, // Binary format
+		}
+		messages, preparedStatement, err := queryHandler.HandleBindQuery(bindMessage, preparedStatement)
+
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{
+			&pgproto3.BindComplete{},
+		})
+		if len(preparedStatement.Variables) != 1 {
+			t.Errorf("Expected the prepared statement to have 1 variable, got %v", len(preparedStatement.Variables))
+		}
+		if preparedStatement.Variables[0] != paramValue {
+			t.Errorf("Expected the prepared statement variable to be %v, got %v", paramValue, preparedStatement.Variables[0])
+		}
+	})
+
+	t.Run("Handles BIND extended query step with binary format 16-byte (uuid) parameter", func(t *testing.T) {
+		parseMessage := &pgproto3.Parse{Query: "SELECT uuid_column FROM postgres.test_table WHERE uuid_column = $1"}
+		_, preparedStatement, err := queryHandler.HandleParseQuery(parseMessage)
+		testNoError(t, err)
+
+		uuidParam := "58a7c845-af77-44b2-8664-7ca613d92f04"
+		paramBytes, _ := uuid.Must(uuid.Parse(uuidParam)).MarshalBinary()
+
+		bindMessage := &pgproto3.Bind{
+			Parameters:           [][]byte{paramBytes},
+			ParameterFormatCodes: []int16{1}, // Binary format
+		}
+		messages, preparedStatement, err := queryHandler.HandleBindQuery(bindMessage, preparedStatement)
+
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{
+			&pgproto3.BindComplete{},
+		})
+		if len(preparedStatement.Variables) != 1 {
+			t.Errorf("Expected the prepared statement to have 1 variable, got %v", len(preparedStatement.Variables))
+		}
+		if preparedStatement.Variables[0] != uuidParam {
+			t.Errorf("Expected the prepared statement variable to be %v, got %v", uuidParam, preparedStatement.Variables[0])
+		}
+	})
+
+	t.Run("Handles BIND extended query step with binary format parameter of inferred type", func(t *testing.T) {
+		parseMessage := &pgproto3.Parse{Query: "SELECT usename FROM pg_shadow WHERE valuntil > $1"}
+		_, preparedStatement, err := queryHandler.HandleParseQuery(parseMessage)
+		testNoError(t, err)
+
+		paramValue := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+		paramBytes := make([]byte, 8)
+		binary.BigEndian.PutUint64(paramBytes, uint64(paramValue.Sub(time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)).Microseconds()))
+
+		bindMessage := &pgproto3.Bind{
+			Parameters:           [][]byte{paramBytes},
+			ParameterFormatCodes: []int16{1}, // Binary format
+		}
+		messages, preparedStatement, err := queryHandler.HandleBindQuery(bindMessage, preparedStatement)
+
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{
+			&pgproto3.BindComplete{},
+		})
+		if preparedStatement.Variables[0] != paramValue {
+			t.Errorf("Expected the prepared statement variable to be %v, got %v", paramValue, preparedStatement.Variables[0])
+		}
+	})
+	t.Run("Handles BIND extended query step with a statement parsed in an earlier extended query", func(t *testing.T) {
+		parseMessage := &pgproto3.Parse{Name: "named_statement", Query: "SELECT usename FROM pg_shadow WHERE usename=$1"}
+		_, _, err := queryHandler.HandleParseQuery(parseMessage)
+		testNoError(t, err)
+
+		bindMessage := &pgproto3.Bind{PreparedStatement: "named_statement", DestinationPortal: "named_portal", Parameters: [][]byte{[]byte("user")}}
+		messages, _, err := queryHandler.HandleBindQuery(bindMessage, nil)
+
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{
+			&pgproto3.BindComplete{},
+		})
+
+		messages, err = queryHandler.HandleExecuteQuery(&pgproto3.Execute{Portal: "named_portal"}, nil)
+
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{
+			&pgproto3.DataRow{},
+			&pgproto3.CommandComplete{},
+		})
+		testDataRowValues(t, messages[0], []string{"user"})
+	})
+
+	t.Run("Re-plans the query with bound values if enabled in the session", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+		defer queryHandler.ServerDuckdbClient.Close()
+		_, err := queryHandler.HandleSimpleQuery("SET bemidb.replan_on_bind = on")
+		testNoError(t, err)
+
+		parseMessage := &pgproto3.Parse{Query: "SELECT usename FROM pg_shadow WHERE usename=$1 AND $2::int IS NULL"}
+		_, preparedStatement, err := queryHandler.HandleParseQuery(parseMessage)
+		testNoError(t, err)
+
+		bindMessage := &pgproto3.Bind{Parameters: [][]byte{[]byte("user"), nil}}
+		_, preparedStatement, err = queryHandler.HandleBindQuery(bindMessage, preparedStatement)
+		testNoError(t, err)
+		if !preparedStatement.Replanned || preparedStatement.Variables != nil {
+			t.Errorf("Expected the portal to be re-planned without variables, got %v", preparedStatement.Variables)
+		}
+
+		messages, err := queryHandler.HandleExecuteQuery(&pgproto3.Execute{}, preparedStatement)
+
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{
+			&pgproto3.DataRow{},
+			&pgproto3.CommandComplete{},
+		})
+		testDataRowValues(t, messages[0], []string{"user"})
+	})
+
+	t.Run("Returns an error for BIND with an unknown statement", func(t *testing.T) {
+		bindMessage := &pgproto3.Bind{PreparedStatement: "unknown_statement"}
+
+		_, _, err := queryHandler.HandleBindQuery(bindMessage, nil)
+
+		if err == nil {
+			t.Fatalf("Expected an error for an unknown prepared statement, got nil")
+		}
+		if err.Error() != "prepared statement \"unknown_statement\" does not exist" {
+			t.Errorf("Expected the error to be 'prepared statement \"unknown_statement\" does not exist', got %v", err.Error())
+		}
+	})
+}
+
+func TestHandleDescribeQuery(t *testing.T) {
+	queryHandler := initQueryHandler()
+	defer queryHandler.ServerDuckdbClient.Close()
+
+	t.Run("Handles DESCRIBE extended query step", func(t *testing.T) {
+		query := "SELECT usename, passwd FROM pg_shadow WHERE usename=$1"
+		parseMessage := &pgproto3.Parse{Query: query}
+		_, preparedStatement, _ := queryHandler.HandleParseQuery(parseMessage)
+		bindMessage := &pgproto3.Bind{Parameters: [][]byte{[]byte("user")}}
+		_, preparedStatement, _ = queryHandler.HandleBindQuery(bindMessage, preparedStatement)
+		message := &pgproto3.Describe{ObjectType: 'P'}
+
+		messages, preparedStatement, err := queryHandler.HandleDescribeQuery(message, preparedStatement)
+
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{
+			&pgproto3.RowDescription{},
+		})
+		testRowDescription(t, messages[0], []string{"usename", "passwd"}, []string{uint32ToString(pgtype.TextOID), uint32ToString(pgtype.TextOID)})
+		if preparedStatement.Rows == nil {
+			t.Errorf("Expected the prepared statement to have rows")
+		}
+	})
+
+	t.Run("Runs query hooks before DESCRIBE runs the query", func(t *testing.T) {
+		csvPath := filepath.Join(t.TempDir(), "test.csv")
+		err := os.WriteFile(csvPath, []byte("id\n1\n"), 0644)
+		testNoError(t, err)
+		sessionQueryHandler := queryHandler.WithNewSession()
+		hook := &testQueryHook{rejectedTable: "read_csv('" + csvPath + "')"}
+		sessionQueryHandler.QueryHooks = NewQueryHooks(queryHandler.Config)
+		sessionQueryHandler.QueryHooks.Add(hook)
+		_, preparedStatement, err := sessionQueryHandler.HandleParseQuery(&pgproto3.Parse{Query: "SELECT id FROM read_csv('" + csvPath + "')"})
+		testNoError(t, err)
+		_, preparedStatement, err = sessionQueryHandler.HandleBindQuery(&pgproto3.Bind{}, preparedStatement)
+		testNoError(t, err)
+
+		_, _, err = sessionQueryHandler.HandleDescribeQuery(&pgproto3.Describe{ObjectType: 'P'}, preparedStatement)
+
+		expectedErrorMessage := "query rejected by access policy"
+		if err == nil || err.Error() != expectedErrorMessage {
+			t.Errorf("Expected the error to be '"+expectedErrorMessage+"', got %v", err)
+		}
+		if preparedStatement.Rows != nil {
+			t.Errorf("Expected the query not to run")
+		}
+
+		hook.rejectedTable = ""
+		_, preparedStatement, err = sessionQueryHandler.HandleDescribeQuery(&pgproto3.Describe{ObjectType: 'P'}, preparedStatement)
+		testNoError(t, err)
+		messages, err := sessionQueryHandler.HandleExecuteQuery(&pgproto3.Execute{}, preparedStatement)
+
+		testNoError(t, err)
+		testDataRowValues(t, messages[0], []string{"1"})
+		if len(hook.beforeAccesses) != 2 || len(hook.afterAccesses) != 1 {
+			t.Errorf("Expected the hooks to run once per DESCRIBE before and once after the query, got %d and %d", len(hook.beforeAccesses), len(hook.afterAccesses))
+		}
+	})
+
+	t.Run("Handles DESCRIBE extended query step if query is empty", func(t *testing.T) {
+		parseMessage := &pgproto3.Parse{Query: ""}
+		_, preparedStatement, _ := queryHandler.HandleParseQuery(parseMessage)
+		bindMessage := &pgproto3.Bind{}
+		_, preparedStatement, _ = queryHandler.HandleBindQuery(bindMessage, preparedStatement)
+		message := &pgproto3.Describe{ObjectType: 'P'}
+
+		messages, _, err := queryHandler.HandleDescribeQuery(message, preparedStatement)
 
 		testNoError(t, err)
 		testMessageTypes(t, messages, []pgproto3.Message{
-			&pgproto3.CommandComplete{},
+			&pgproto3.NoData{},
 		})
-		testCommandCompleteTag(t, messages[0], "BEGIN")
+	})
+
+	t.Run("Handles DESCRIBE (Statement) extended query step if there was no BIND step", func(t *testing.T) {
+		query := "SELECT usename, passwd FROM pg_shadow WHERE usename=$1"
+		parseMessage := &pgproto3.Parse{Query: query, ParameterOIDs: []uint32{pgtype.TextOID}}
+		_, preparedStatement, _ := queryHandler.HandleParseQuery(parseMessage)
+		message := &pgproto3.Describe{ObjectType: 'S'}
+
+		messages, _, err := queryHandler.HandleDescribeQuery(message, preparedStatement)
+
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{
+			&pgproto3.ParameterDescription{},
+			&pgproto3.NoData{},
+		})
+	})
+
+	t.Run("Returns inferred parameter types for DESCRIBE (Statement) extended query step", func(t *testing.T) {
+		query := "SELECT usename FROM pg_shadow WHERE usename = $1 AND usesysid = $2 AND valuntil > $3 LIMIT $4"
+		parseMessage := &pgproto3.Parse{Query: query, ParameterOIDs: []uint32{pgtype.VarcharOID}}
+		_, preparedStatement, _ := queryHandler.HandleParseQuery(parseMessage)
+		message := &pgproto3.Describe{ObjectType: 'S'}
+
+		messages, _, err := queryHandler.HandleDescribeQuery(message, preparedStatement)
+
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{
+			&pgproto3.ParameterDescription{},
+			&pgproto3.NoData{},
+		})
+		parameterOIDs := messages[0].(*pgproto3.ParameterDescription).ParameterOIDs
+		expectedOIDs := []uint32{pgtype.VarcharOID, pgtype.Int8OID, pgtype.TimestampOID, pgtype.Int8OID}
+		if !slices.Equal(parameterOIDs, expectedOIDs) {
+			t.Errorf("Expected the parameter types to be %v, got %v", expectedOIDs, parameterOIDs)
+		}
+	})
+
+	t.Run("Returns text for parameter types that can't be inferred", func(t *testing.T) {
+		parameterOIDs := textParameterOIDs([]uint32{pgtype.Int4OID, 0}, 3)
+
+		expectedOIDs := []uint32{pgtype.Int4OID, pgtype.TextOID, pgtype.TextOID}
+		if !slices.Equal(parameterOIDs, expectedOIDs) {
+			t.Errorf("Expected the parameter types to be %v, got %v", expectedOIDs, parameterOIDs)
+		}
 	})
 }
 
-func TestHandleParseQuery(t *testing.T) {
+func TestHandleExecuteQuery(t *testing.T) {
 	queryHandler := initQueryHandler()
 	defer queryHandler.ServerDuckdbClient.Close()
 
-	t.Run("Handles PARSE extended query step", func(t *testing.T) {
-		query := "SELECT usename, passwd FROM pg_shadow WHERE usename=$1"
-		message := &pgproto3.Parse{Query: query}
+	t.Run("Handles EXECUTE extended query step", func(t *testing.T) {
+		query := "SELECT usename, split_part(passwd, ':', 1) FROM pg_shadow WHERE usename=$1"
+		parseMessage := &pgproto3.Parse{Query: query}
+		_, preparedStatement, _ := queryHandler.HandleParseQuery(parseMessage)
+		bindMessage := &pgproto3.Bind{Parameters: [][]byte{[]byte("user")}}
+		_, preparedStatement, _ = queryHandler.HandleBindQuery(bindMessage, preparedStatement)
+		describeMessage := &pgproto3.Describe{ObjectType: 'P'}
+		_, preparedStatement, _ = queryHandler.HandleDescribeQuery(describeMessage, preparedStatement)
+		message := &pgproto3.Execute{}
 
-		messages, preparedStatement, err := queryHandler.HandleParseQuery(message)
+		messages, err := queryHandler.HandleExecuteQuery(message, preparedStatement)
 
 		testNoError(t, err)
 		testMessageTypes(t, messages, []pgproto3.Message{
-			&pgproto3.ParseComplete{},
+			&pgproto3.DataRow{},
+			&pgproto3.CommandComplete{},
 		})
+		testDataRowValues(t, messages[0], []string{"user", "SCRAM-SHA-256$4096"})
+	})
 
-		remappedQuery := "SELECT usename, passwd FROM main.pg_shadow WHERE usename = $1"
-		if preparedStatement.Query != remappedQuery {
-			t.Errorf("Expected the prepared statement query to be %v, got %v", remappedQuery, preparedStatement.Query)
+	t.Run("Rejects a statement after the user reached the hard storage budget", func(t *testing.T) {
+		budgetConfig := *queryHandler.Config
+		budgetConfig.StorageHardBudgetBytes = 100
+		sessionQueryHandler := queryHandler.WithNewSession()
+		sessionQueryHandler.StorageBudgets = NewStorageBudgetTracker(&budgetConfig)
+		sessionQueryHandler.StorageBudgets.Add(sessionQueryHandler.QueryRemapper.Session.User, 100)
+		_, preparedStatement, err := sessionQueryHandler.HandleParseQuery(&pgproto3.Parse{Query: "SELECT 1"})
+		testNoError(t, err)
+		_, preparedStatement, err = sessionQueryHandler.HandleBindQuery(&pgproto3.Bind{}, preparedStatement)
+		testNoError(t, err)
+
+		_, _, err = sessionQueryHandler.HandleDescribeQuery(&pgproto3.Describe{ObjectType: 'P'}, preparedStatement)
+
+		var pgError *PgError
+		if !errors.As(err, &pgError) {
+			t.Fatalf("Expected a PgError, got %v", err)
 		}
-		if preparedStatement.Statement == nil {
-			t.Errorf("Expected the prepared statement to have a statement")
+		if pgError.Code != PG_ERROR_CODE_CONFIGURATION_LIMIT_EXCEEDED {
+			t.Errorf("Expected the error code to be %s, got %s", PG_ERROR_CODE_CONFIGURATION_LIMIT_EXCEEDED, pgError.Code)
 		}
 	})
 
-	t.Run("Handles PARSE extended query step if query is empty", func(t *testing.T) {
-		message := &pgproto3.Parse{Query: ""}
+	t.Run("Rejects an INSERT after the user reached the hard storage budget", func(t *testing.T) {
+		budgetConfig := *queryHandler.Config
+		budgetConfig.StorageHardBudgetBytes = 100
+		sessionQueryHandler := queryHandler.WithNewSession()
+		sessionQueryHandler.StorageBudgets = NewStorageBudgetTracker(&budgetConfig)
+		sessionQueryHandler.StorageBudgets.Add(sessionQueryHandler.QueryRemapper.Session.User, 100)
+		_, preparedStatement, err := sessionQueryHandler.HandleParseQuery(&pgproto3.Parse{Query: "INSERT INTO postgres.test_table (id) VALUES (1)"})
+		testNoError(t, err)
+		_, preparedStatement, err = sessionQueryHandler.HandleBindQuery(&pgproto3.Bind{}, preparedStatement)
+		testNoError(t, err)
 
-		messages, preparedStatement, err := queryHandler.HandleParseQuery(message)
+		_, err = sessionQueryHandler.HandleExecuteQuery(&pgproto3.Execute{}, preparedStatement)
+
+		var pgError *PgError
+		if !errors.As(err, &pgError) {
+			t.Fatalf("Expected a PgError, got %v", err)
+		}
+		if pgError.Code != PG_ERROR_CODE_CONFIGURATION_LIMIT_EXCEEDED {
+			t.Errorf("Expected the error code to be %s, got %s", PG_ERROR_CODE_CONFIGURATION_LIMIT_EXCEEDED, pgError.Code)
+		}
+	})
 
+	t.Run("Runs query hooks before an INSERT reads its rows", func(t *testing.T) {
+		sessionQueryHandler := queryHandler.WithNewSession()
+		hook := &testQueryHook{rejectedTable: "postgres.test_table"}
+		sessionQueryHandler.QueryHooks = NewQueryHooks(queryHandler.Config)
+		sessionQueryHandler.QueryHooks.Add(hook)
+		_, preparedStatement, err := sessionQueryHandler.HandleParseQuery(&pgproto3.Parse{Query: "INSERT INTO postgres.test_table SELECT * FROM postgres.test_table"})
+		testNoError(t, err)
+		_, preparedStatement, err = sessionQueryHandler.HandleBindQuery(&pgproto3.Bind{}, preparedStatement)
 		testNoError(t, err)
-		testMessageTypes(t, messages, []pgproto3.Message{
-			&pgproto3.ParseComplete{},
-		})
 
-		if preparedStatement.Query != "" {
-			t.Errorf("Expected the prepared statement query to be empty, got %v", preparedStatement.Query)
+		_, err = sessionQueryHandler.HandleExecuteQuery(&pgproto3.Execute{}, preparedStatement)
+
+		expectedErrorMessage := "query rejected by access policy"
+		if err == nil || err.Error() != expectedErrorMessage {
+			t.Errorf("Expected the error to be '"+expectedErrorMessage+"', got %v", err)
 		}
-		if preparedStatement.Statement != nil {
-			t.Errorf("Expected the prepared statement not to have a statement, got %v", preparedStatement.Statement)
+		if len(hook.afterAccesses) != 0 {
+			t.Errorf("Expected the INSERT not to run")
 		}
 	})
-}
 
-func TestHandleBindQuery(t *testing.T) {
-	queryHandler := initQueryHandler()
-	defer queryHandler.ServerDuckdbClient.Close()
+	t.Run("Rejects an UPDATE after the user reached the hard storage budget", func(t *testing.T) {
+		budgetConfig := *queryHandler.Config
+		budgetConfig.StorageHardBudgetBytes = 100
+		sessionQueryHandler := queryHandler.WithNewSession()
+		sessionQueryHandler.StorageBudgets = NewStorageBudgetTracker(&budgetConfig)
+		sessionQueryHandler.StorageBudgets.Add(sessionQueryHandler.QueryRemapper.Session.User, 100)
+		_, preparedStatement, err := sessionQueryHandler.HandleParseQuery(&pgproto3.Parse{Query: "UPDATE postgres.test_table SET id = 1"})
+		testNoError(t, err)
+		_, preparedStatement, err = sessionQueryHandler.HandleBindQuery(&pgproto3.Bind{}, preparedStatement)
+		testNoError(t, err)
 
-	t.Run("Handles BIND extended query step with text format parameter", func(t *testing.T) {
-		parseMessage := &pgproto3.Parse{Query: "SELECT usename, passwd FROM pg_shadow WHERE usename=$1"}
-		_, preparedStatement, err := queryHandler.HandleParseQuery(parseMessage)
+		_, err = sessionQueryHandler.HandleExecuteQuery(&pgproto3.Execute{}, preparedStatement)
+
+		var pgError *PgError
+		if !errors.As(err, &pgError) {
+			t.Fatalf("Expected a PgError, got %v", err)
+		}
+		if pgError.Code != PG_ERROR_CODE_CONFIGURATION_LIMIT_EXCEEDED {
+			t.Errorf("Expected the error code to be %s, got %s", PG_ERROR_CODE_CONFIGURATION_LIMIT_EXCEEDED, pgError.Code)
+		}
+	})
+
+	t.Run("Runs query hooks before a DELETE reads its rows", func(t *testing.T) {
+		sessionQueryHandler := queryHandler.WithNewSession()
+		hook := &testQueryHook{rejectedTable: "postgres.test_table"}
+		sessionQueryHandler.QueryHooks = NewQueryHooks(queryHandler.Config)
+		sessionQueryHandler.QueryHooks.Add(hook)
+		_, preparedStatement, err := sessionQueryHandler.HandleParseQuery(&pgproto3.Parse{Query: "DELETE FROM postgres.test_table WHERE id IN (SELECT id FROM postgres.test_table)"})
+		testNoError(t, err)
+		_, preparedStatement, err = sessionQueryHandler.HandleBindQuery(&pgproto3.Bind{}, preparedStatement)
 		testNoError(t, err)
 
-		bindMessage := &pgproto3.Bind{
-			Parameters:           [][]byte{[]byte("user")},
-			ParameterFormatCodes: []int16{0}, // Text format
+		_, err = sessionQueryHandler.HandleExecuteQuery(&pgproto3.Execute{}, preparedStatement)
+
+		expectedErrorMessage := "query rejected by access policy"
+		if err == nil || err.Error() != expectedErrorMessage {
+			t.Errorf("Expected the error to be '"+expectedErrorMessage+"', got %v", err)
 		}
-		messages, preparedStatement, err := queryHandler.HandleBindQuery(bindMessage, preparedStatement)
+		if len(hook.afterAccesses) != 0 {
+			t.Errorf("Expected the DELETE not to run")
+		}
+	})
+
+	t.Run("Returns query stats for an executed statement", func(t *testing.T) {
+		sessionQueryHandler := queryHandler.WithNewSession()
+		sessionQueryHandler.QueryRemapper.Session.QueryStatsEnabled = true
+		_, preparedStatement, err := sessionQueryHandler.HandleParseQuery(&pgproto3.Parse{Query: "SELECT 1"})
+		testNoError(t, err)
+		_, preparedStatement, err = sessionQueryHandler.HandleBindQuery(&pgproto3.Bind{}, preparedStatement)
+		testNoError(t, err)
+
+		messages, err := sessionQueryHandler.HandleExecuteQuery(&pgproto3.Execute{}, preparedStatement)
 
 		testNoError(t, err)
 		testMessageTypes(t, messages, []pgproto3.Message{
-			&pgproto3.BindComplete{},
+			&pgproto3.DataRow{},
+			&pgproto3.CommandComplete{},
+			&pgproto3.NoticeResponse{},
 		})
-		if len(preparedStatement.Variables) != 1 {
-			t.Errorf("Expected the prepared statement to have 1 variable, got %v", len(preparedStatement.Variables))
-		}
-		if preparedStatement.Variables[0] != "user" {
-			t.Errorf("Expected the prepared statement variable to be 'user', got %v", preparedStatement.Variables[0])
+		notice := messages[2].(*pgproto3.NoticeResponse).Message
+		if !strings.HasSuffix(notice, ", rows: 1, bytes scanned: 0 (0 requests)") {
+			t.Errorf("Expected the query stats with storage reads, got %s", notice)
 		}
 	})
 
-	t.Run("Handles BIND extended query step with binary format 4-byte parameter", func(t *testing.T) {
-		parseMessage := &pgproto3.Parse{Query: "SELECT c.oid FROM pg_catalog.pg_class c WHERE c.relnamespace = $1"}
-		_, preparedStatement, err := queryHandler.HandleParseQuery(parseMessage)
+	t.Run("Applies the session's DuckDB settings to executed statements", func(t *testing.T) {
+		sessionQueryHandler := queryHandler.WithNewSession()
+		_, err := sessionQueryHandler.HandleSimpleQuery("SET bemidb.merge_join_threshold = 0")
+		testNoError(t, err)
+		_, preparedStatement, err := sessionQueryHandler.HandleParseQuery(&pgproto3.Parse{Query: "SELECT value FROM duckdb_settings() WHERE name = 'merge_join_threshold'"})
+		testNoError(t, err)
+		_, preparedStatement, err = sessionQueryHandler.HandleBindQuery(&pgproto3.Bind{}, preparedStatement)
 		testNoError(t, err)
 
-		paramValue := int32(2200)
-		paramBytes := make([]byte, 4)
-		binary.BigEndian.PutUint32(paramBytes, uint32(paramValue))
+		messages, err := sessionQueryHandler.HandleExecuteQuery(&pgproto3.Execute{}, preparedStatement)
 
-		bindMessage := &pgproto3.Bind{
-			Parameters:           [][]byte{paramBytes},
-			ParameterFormatCodes: []int16{1}, // Binary format
+		testNoError(t, err)
+		testDataRowValues(t, messages[0], []string{"0"})
+	})
+
+	t.Run("Returns timestamps in the session time zone for executed statements", func(t *testing.T) {
+		sessionQueryHandler := queryHandler.WithNewSession()
+		_, err := sessionQueryHandler.HandleSimpleQuery("SET timezone = 'America/New_York'")
+		testNoError(t, err)
+		_, preparedStatement, err := sessionQueryHandler.HandleParseQuery(&pgproto3.Parse{Query: "SELECT TIMESTAMPTZ '2000-01-01 00:00:00+00'::text AS value"})
+		testNoError(t, err)
+		_, preparedStatement, err = sessionQueryHandler.HandleBindQuery(&pgproto3.Bind{}, preparedStatement)
+		testNoError(t, err)
+
+		messages, err := sessionQueryHandler.HandleExecuteQuery(&pgproto3.Execute{}, preparedStatement)
+
+		testNoError(t, err)
+		testDataRowValues(t, messages[0], []string{"1999-12-31 19:00:00-05"})
+	})
+
+	t.Run("Applies join order settings only while the session's statement runs", func(t *testing.T) {
+		sessionQueryHandler := queryHandler.WithNewSession()
+		_, err := sessionQueryHandler.HandleSimpleQuery("SET bemidb.join_order = off")
+		testNoError(t, err)
+		_, preparedStatement, err := sessionQueryHandler.HandleParseQuery(&pgproto3.Parse{Query: "SELECT value FROM duckdb_settings() WHERE name = 'disabled_optimizers'"})
+		testNoError(t, err)
+		_, preparedStatement, err = sessionQueryHandler.HandleBindQuery(&pgproto3.Bind{}, preparedStatement)
+		testNoError(t, err)
+		_, preparedStatement, err = sessionQueryHandler.HandleDescribeQuery(&pgproto3.Describe{ObjectType: 'P'}, preparedStatement)
+		testNoError(t, err)
+
+		messages, err := queryHandler.HandleSimpleQuery("SELECT value FROM duckdb_settings() WHERE name = 'disabled_optimizers'")
+
+		testNoError(t, err)
+		testDataRowValues(t, messages[1], []string{""})
+
+		messages, err = sessionQueryHandler.HandleExecuteQuery(&pgproto3.Execute{}, preparedStatement)
+
+		testNoError(t, err)
+		testDataRowValues(t, messages[0], []string{"join_order,build_side_probe_side"})
+	})
+
+	t.Run("Runs query hooks before declaring a cursor", func(t *testing.T) {
+		sessionQueryHandler := queryHandler.WithNewSession()
+		defer sessionQueryHandler.QueryRemapper.Session.CloseCursors()
+		hook := &testQueryHook{rejectedTable: "postgres.test_table"}
+		sessionQueryHandler.QueryHooks = NewQueryHooks(queryHandler.Config)
+		sessionQueryHandler.QueryHooks.Add(hook)
+		parseMessage := &pgproto3.Parse{Query: "DECLARE test_cursor CURSOR WITH HOLD FOR SELECT id FROM postgres.test_table"}
+		_, preparedStatement, err := sessionQueryHandler.HandleParseQuery(parseMessage)
+		testNoError(t, err)
+		_, preparedStatement, err = sessionQueryHandler.HandleBindQuery(&pgproto3.Bind{}, preparedStatement)
+		testNoError(t, err)
+
+		_, err = sessionQueryHandler.HandleExecuteQuery(&pgproto3.Execute{}, preparedStatement)
+
+		expectedErrorMessage := "query rejected by access policy"
+		if err == nil || err.Error() != expectedErrorMessage {
+			t.Errorf("Expected the error to be '"+expectedErrorMessage+"', got %v", err)
 		}
-		messages, preparedStatement, err := queryHandler.HandleBindQuery(bindMessage, preparedStatement)
+		if _, err = sessionQueryHandler.QueryRemapper.Session.Cursor("test_cursor"); err == nil {
+			t.Errorf("Expected the cursor not to be declared")
+		}
+	})
+
+	t.Run("Handles EXECUTE extended query step if query is empty", func(t *testing.T) {
+		parseMessage := &pgproto3.Parse{Query: ""}
+		_, preparedStatement, _ := queryHandler.HandleParseQuery(parseMessage)
+		bindMessage := &pgproto3.Bind{}
+		_, preparedStatement, _ = queryHandler.HandleBindQuery(bindMessage, preparedStatement)
+		describeMessage := &pgproto3.Describe{ObjectType: 'P'}
+		_, preparedStatement, _ = queryHandler.HandleDescribeQuery(describeMessage, preparedStatement)
+		message := &pgproto3.Execute{}
+
+		messages, err := queryHandler.HandleExecuteQuery(message, preparedStatement)
 
 		testNoError(t, err)
 		testMessageTypes(t, messages, []pgproto3.Message{
-			&pgproto3.BindComplete{},
+			&pgproto3.EmptyQueryResponse{},
 		})
-		if len(preparedStatement.Variables) != 1 {
-			t.Errorf("Expected the prepared statement to have 1 variable, got %v", len(preparedStatement.Variables))
+	})
+
+	t.Run("Encodes values in the binary format requested in BIND", func(t *testing.T) {
+		parseMessage := &pgproto3.Parse{Query: "SELECT 1::int4 AS id, DATE '2000-01-02' AS day, 1.5::numeric(10, 2) AS amount, ARRAY[1, NULL, 3]::int4[] AS ids, '{\"a\": 1}'::json AS doc, INTERVAL '1 day' AS period"}
+		_, preparedStatement, _ := queryHandler.HandleParseQuery(parseMessage)
+		bindMessage := &pgproto3.Bind{ResultFormatCodes: []int16{pgtype.BinaryFormatCode}}
+		_, preparedStatement, _ = queryHandler.HandleBindQuery(bindMessage, preparedStatement)
+		describeMessage := &pgproto3.Describe{ObjectType: 'P'}
+		describeMessages, _, _ := queryHandler.HandleDescribeQuery(describeMessage, preparedStatement)
+		message := &pgproto3.Execute{}
+
+		messages, err := queryHandler.HandleExecuteQuery(message, preparedStatement)
+
+		testNoError(t, err)
+		fields := describeMessages[0].(*pgproto3.RowDescription).Fields
+		for i, expectedFormat := range []int16{pgtype.BinaryFormatCode, pgtype.BinaryFormatCode, pgtype.BinaryFormatCode, pgtype.BinaryFormatCode, pgtype.BinaryFormatCode, pgtype.BinaryFormatCode} {
+			if fields[i].Format != expectedFormat {
+				t.Errorf("Expected the format of %s to be %d, got %d", fields[i].Name, expectedFormat, fields[i].Format)
+			}
 		}
-		if preparedStatement.Variables[0] != paramValue {
-			t.Errorf("Expected the prepared statement variable to be %v, got %v", paramValue, preparedStatement.Variables[0])
+		values := messages[0].(*pgproto3.DataRow).Values
+		if !bytes.Equal(values[0], []byte{0, 0, 0, 1}) {
+			t.Errorf("Expected the binary int4 value to be 1, got %v", values[0])
+		}
+		if !bytes.Equal(values[1], []byte{0, 0, 0, 1}) {
+			t.Errorf("Expected the binary date value to be 1 day since 2000-01-01, got %v", values[1])
+		}
+		typeMap := pgtype.NewMap()
+		var amount pgtype.Numeric
+		testNoError(t, typeMap.Scan(pgtype.NumericOID, pgtype.BinaryFormatCode, values[2], &amount))
+		if amountFloat, _ := amount.Float64Value(); amountFloat.Float64 != 1.5 {
+			t.Errorf("Expected the binary numeric value to be 1.5, got %v", amountFloat.Float64)
+		}
+		var ids []pgtype.Int4
+		testNoError(t, typeMap.Scan(pgtype.Int4ArrayOID, pgtype.BinaryFormatCode, values[3], &ids))
+		if len(ids) != 3 || ids[0].Int32 != 1 || ids[1].Valid || ids[2].Int32 != 3 {
+			t.Errorf("Expected the binary int4 array to be {1,NULL,3}, got %v", ids)
+		}
+		if string(values[4]) != `{"a":1}` {
+			t.Errorf("Expected the binary json value to be {\"a\":1}, got %s", values[4])
+		}
+		var period pgtype.Interval
+		testNoError(t, typeMap.Scan(pgtype.IntervalOID, pgtype.BinaryFormatCode, values[5], &period))
+		if period.Days != 1 || period.Months != 0 || period.Microseconds != 0 {
+			t.Errorf("Expected the binary interval value to be 1 day, got %+v", period)
 		}
 	})
 
-	t.Run("Handles BIND extended query step with binary format 8-byte parameter", func(t *testing.T) {
-		parseMessage := &pgproto3.Parse{Query: "SELECT c.oid FROM pg_catalog.pg_class c WHERE c.relnamespace = $1"}
-		_, preparedStatement, err := queryHandler.HandleParseQuery(parseMessage)
+	t.Run("Suspends and resumes the portal with EXECUTE max rows", func(t *testing.T) {
+		parseMessage := &pgproto3.Parse{Query: "SELECT * FROM generate_series(1, 3)"}
+		_, preparedStatement, _ := queryHandler.HandleParseQuery(parseMessage)
+		bindMessage := &pgproto3.Bind{}
+		_, preparedStatement, _ = queryHandler.HandleBindQuery(bindMessage, preparedStatement)
+		message := &pgproto3.Execute{MaxRows: 2}
+
+		messages, err := queryHandler.HandleExecuteQuery(message, preparedStatement)
+
 		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{
+			&pgproto3.DataRow{},
+			&pgproto3.DataRow{},
+			&pgproto3.PortalSuspended{},
+		})
+		testDataRowValues(t, messages[1], []string{"2"})
 
-		paramValue := int64(2200)
-		paramBytes := make([]byte, 8)
-		binary.BigEndian.PutUint64(paramBytes, uint64(paramValue))
+		messages, err = queryHandler.HandleExecuteQuery(message, preparedStatement)
 
-		bindMessage := &pgproto3.Bind{
-			Parameters:           [][]byte{paramBytes},
-			ParameterFormatCodes: []int16{1}, // Binary format
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{
+			&pgproto3.DataRow{},
+			&pgproto3.CommandComplete{},
+		})
+		testDataRowValues(t, messages[0], []string{"3"})
+	})
+
+	t.Run("Holds the memory admission of a table query from DESCRIBE until the portal's rows are closed", func(t *testing.T) {
+		memoryConfig := *queryHandler.Config
+		memoryConfig.MemoryPressurePercent = 1
+		sessionQueryHandler := queryHandler.WithNewSession()
+		sessionQueryHandler.MemoryAdmission = NewMemoryAdmissionController(&memoryConfig, queryHandler.ServerDuckdbClient)
+		_, preparedStatement, _ := sessionQueryHandler.HandleParseQuery(&pgproto3.Parse{Query: "SELECT id FROM postgres.test_table"})
+		_, preparedStatement, _ = sessionQueryHandler.HandleBindQuery(&pgproto3.Bind{}, preparedStatement)
+
+		_, preparedStatement, err := sessionQueryHandler.HandleDescribeQuery(&pgproto3.Describe{ObjectType: 'P'}, preparedStatement)
+
+		testNoError(t, err)
+		if sessionQueryHandler.MemoryAdmission.runningCount != 1 {
+			t.Errorf("Expected the query to be admitted by DESCRIBE, got %d running queries", sessionQueryHandler.MemoryAdmission.runningCount)
 		}
-		messages, preparedStatement, err := queryHandler.HandleBindQuery(bindMessage, preparedStatement)
+
+		messages, err := sessionQueryHandler.HandleExecuteQuery(&pgproto3.Execute{MaxRows: 1}, preparedStatement)
 
 		testNoError(t, err)
 		testMessageTypes(t, messages, []pgproto3.Message{
-			&pgproto3.BindComplete{},
+			&pgproto3.DataRow{},
+			&pgproto3.PortalSuspended{},
 		})
-		if len(preparedStatement.Variables) != 1 {
-			t.Errorf("Expected the prepared statement to have 1 variable, got %v", len(preparedStatement.Variables))
+		if sessionQueryHandler.MemoryAdmission.runningCount != 1 {
+			t.Errorf("Expected the suspended portal to keep its admission, got %d running queries", sessionQueryHandler.MemoryAdmission.runningCount)
 		}
-		if preparedStatement.Variables[0] != paramValue {
-			t.Errorf("Expected the prepared statement variable to be %v, got %v", paramValue, preparedStatement.Variables[0])
+
+		_, err = sessionQueryHandler.HandleExecuteQuery(&pgproto3.Execute{}, preparedStatement)
+
+		testNoError(t, err)
+		metrics := sessionQueryHandler.MemoryAdmission.Metrics()
+		if sessionQueryHandler.MemoryAdmission.runningCount != 0 || metrics.AdmittedCount != 1 {
+			t.Errorf("Expected the admission to be released once after the rows are closed, got %d running queries and %s", sessionQueryHandler.MemoryAdmission.runningCount, metrics.String())
 		}
 	})
 
-	t.Run("Handles BIND extended query step with binary format 16-byte (uuid) parameter", func(t *testing.T) {
-		parseMessage := &pgproto3.Parse{Query: "SELECT uuid_column FROM postgres.test_table WHERE uuid_column = $1"}
-		_, preparedStatement, err := queryHandler.HandleParseQuery(parseMessage)
+	t.Run("Keeps a temp table created by an executed statement", func(t *testing.T) {
+		sessionQueryHandler := queryHandler.WithNewSession()
+		defer sessionQueryHandler.QueryRemapper.DropTempTables()
+		_, preparedStatement, err := sessionQueryHandler.HandleParseQuery(&pgproto3.Parse{Query: "CREATE TEMP TABLE executed_create (id INT)"})
+		testNoError(t, err)
+		_, preparedStatement, err = sessionQueryHandler.HandleBindQuery(&pgproto3.Bind{}, preparedStatement)
 		testNoError(t, err)
 
-		uuidParam := "58a7c845-af77-44b2-8664-7ca613d92f04"
-		paramBytes, _ := uuid.Must(uuid.Parse(uuidParam)).MarshalBinary()
+		_, err = sessionQueryHandler.HandleExecuteQuery(&pgproto3.Execute{}, preparedStatement)
 
-		bindMessage := &pgproto3.Bind{
-			Parameters:           [][]byte{paramBytes},
-			ParameterFormatCodes: []int16{1}, // Binary format
+		testNoError(t, err)
+		session := sessionQueryHandler.QueryRemapper.Session
+		if !session.TempTables.Contains("executed_create") || session.PendingTempTables.Contains("executed_create") {
+			t.Errorf("Expected the temp table to be registered after it was created")
 		}
-		messages, preparedStatement, err := queryHandler.HandleBindQuery(bindMessage, preparedStatement)
+		_, err = sessionQueryHandler.HandleSimpleQuery("INSERT INTO executed_create VALUES (1)")
+		testNoError(t, err)
+	})
 
+	t.Run("Doesn't keep a temp table whose executed statement failed", func(t *testing.T) {
+		sessionQueryHandler := queryHandler.WithNewSession()
+		defer sessionQueryHandler.QueryRemapper.DropTempTables()
+		_, preparedStatement, err := sessionQueryHandler.HandleParseQuery(&pgproto3.Parse{Query: "CREATE TEMP TABLE failed_execute AS SELECT 'a'::INT AS id"})
 		testNoError(t, err)
-		testMessageTypes(t, messages, []pgproto3.Message{
-			&pgproto3.BindComplete{},
-		})
-		if len(preparedStatement.Variables) != 1 {
-			t.Errorf("Expected the prepared statement to have 1 variable, got %v", len(preparedStatement.Variables))
+		_, preparedStatement, err = sessionQueryHandler.HandleBindQuery(&pgproto3.Bind{}, preparedStatement)
+		testNoError(t, err)
+
+		_, err = sessionQueryHandler.HandleExecuteQuery(&pgproto3.Execute{}, preparedStatement)
+
+		if err == nil {
+			t.Fatalf("Expected CREATE TEMP TABLE to fail")
 		}
-		if preparedStatement.Variables[0] != uuidParam {
-			t.Errorf("Expected the prepared statement variable to be %v, got %v", uuidParam, preparedStatement.Variables[0])
+		if sessionQueryHandler.QueryRemapper.Session.TempTables.Contains("failed_execute") {
+			t.Errorf("Expected the temp table not to be registered")
 		}
 	})
 }
 
-func TestHandleDescribeQuery(t *testing.T) {
+func TestHandleCloseQuery(t *testing.T) {
 	queryHandler := initQueryHandler()
 	defer queryHandler.ServerDuckdbClient.Close()
 
-	t.Run("Handles DESCRIBE extended query step", func(t *testing.T) {
-		query := "SELECT usename, passwd FROM pg_shadow WHERE usename=$1"
-		parseMessage := &pgproto3.Parse{Query: query}
-		_, preparedStatement, _ := queryHandler.HandleParseQuery(parseMessage)
-		bindMessage := &pgproto3.Bind{Parameters: [][]byte{[]byte("user")}}
-		_, preparedStatement, _ = queryHandler.HandleBindQuery(bindMessage, preparedStatement)
-		message := &pgproto3.Describe{ObjectType: 'P'}
+	t.Run("Handles CLOSE extended query step for a statement and its portals", func(t *testing.T) {
+		parseMessage := &pgproto3.Parse{Name: "closed_statement", Query: "SELECT 1"}
+		_, _, err := queryHandler.HandleParseQuery(parseMessage)
+		testNoError(t, err)
+		bindMessage := &pgproto3.Bind{PreparedStatement: "closed_statement", DestinationPortal: "closed_portal"}
+		_, _, err = queryHandler.HandleBindQuery(bindMessage, nil)
+		testNoError(t, err)
 
-		messages, preparedStatement, err := queryHandler.HandleDescribeQuery(message, preparedStatement)
+		messages, err := queryHandler.HandleCloseQuery(&pgproto3.Close{ObjectType: 'S', Name: "closed_statement"})
 
 		testNoError(t, err)
 		testMessageTypes(t, messages, []pgproto3.Message{
-			&pgproto3.RowDescription{},
+			&pgproto3.CloseComplete{},
 		})
-		testRowDescription(t, messages[0], []string{"usename", "passwd"}, []string{uint32ToString(pgtype.TextOID), uint32ToString(pgtype.TextOID)})
-		if preparedStatement.Rows == nil {
-			t.Errorf("Expected the prepared statement to have rows")
+		_, _, err = queryHandler.HandleBindQuery(bindMessage, nil)
+		if err == nil {
+			t.Errorf("Expected an error for BIND with a closed statement, got nil")
+		}
+		_, err = queryHandler.HandleExecuteQuery(&pgproto3.Execute{Portal: "closed_portal"}, nil)
+		if err == nil {
+			t.Errorf("Expected an error for EXECUTE with a portal of a closed statement, got nil")
 		}
 	})
 
-	t.Run("Handles DESCRIBE extended query step if query is empty", func(t *testing.T) {
-		parseMessage := &pgproto3.Parse{Query: ""}
-		_, preparedStatement, _ := queryHandler.HandleParseQuery(parseMessage)
-		bindMessage := &pgproto3.Bind{}
-		_, preparedStatement, _ = queryHandler.HandleBindQuery(bindMessage, preparedStatement)
-		message := &pgproto3.Describe{ObjectType: 'P'}
+	t.Run("Executes a statement created with PARSE with EXECUTE", func(t *testing.T) {
+		sessionQueryHandler := queryHandler.WithNewSession()
+		_, _, err := sessionQueryHandler.HandleParseQuery(&pgproto3.Parse{Name: "parsed_statement", Query: "SELECT $1::int + 1 AS value"})
+		testNoError(t, err)
 
-		messages, _, err := queryHandler.HandleDescribeQuery(message, preparedStatement)
+		messages, err := sessionQueryHandler.HandleSimpleQuery("EXECUTE parsed_statement(1)")
 
 		testNoError(t, err)
 		testMessageTypes(t, messages, []pgproto3.Message{
-			&pgproto3.NoData{},
+			&pgproto3.RowDescription{},
+			&pgproto3.DataRow{},
+			&pgproto3.CommandComplete{},
 		})
+		testDataRowValues(t, messages[1], []string{"2"})
+
+		_, err = sessionQueryHandler.HandleSimpleQuery("PREPARE parsed_statement AS SELECT 1")
+
+		var pgError *PgError
+		if !errors.As(err, &pgError) {
+			t.Fatalf("Expected a PgError, got %v", err)
+		}
+		if pgError.Code != PG_ERROR_CODE_DUPLICATE_PREPARED_STATEMENT {
+			t.Errorf("Expected the error code to be %s, got %s", PG_ERROR_CODE_DUPLICATE_PREPARED_STATEMENT, pgError.Code)
+		}
 	})
 
-	t.Run("Handles DESCRIBE (Statement) extended query step if there was no BIND step", func(t *testing.T) {
-		query := "SELECT usename, passwd FROM pg_shadow WHERE usename=$1"
-		parseMessage := &pgproto3.Parse{Query: query, ParameterOIDs: []uint32{pgtype.TextOID}}
-		_, preparedStatement, _ := queryHandler.HandleParseQuery(parseMessage)
-		message := &pgproto3.Describe{ObjectType: 'S'}
+	t.Run("Deallocates a statement created with PARSE", func(t *testing.T) {
+		parseMessage := &pgproto3.Parse{Name: "deallocated_statement", Query: "SELECT 1"}
+		_, _, err := queryHandler.HandleParseQuery(parseMessage)
+		testNoError(t, err)
 
-		messages, _, err := queryHandler.HandleDescribeQuery(message, preparedStatement)
+		_, err = queryHandler.HandleSimpleQuery("DEALLOCATE deallocated_statement")
 
 		testNoError(t, err)
-		testMessageTypes(t, messages, []pgproto3.Message{
-			&pgproto3.NoData{},
-		})
+		_, _, err = queryHandler.HandleBindQuery(&pgproto3.Bind{PreparedStatement: "deallocated_statement"}, nil)
+		if err == nil {
+			t.Errorf("Expected an error for BIND with a deallocated statement, got nil")
+		}
 	})
 }
 
-func TestHandleExecuteQuery(t *testing.T) {
+func TestRestoreSessionCheckpoint(t *testing.T) {
 	queryHandler := initQueryHandler()
 	defer queryHandler.ServerDuckdbClient.Close()
 
-	t.Run("Handles EXECUTE extended query step", func(t *testing.T) {
-		query := "SELECT usename, split_part(passwd, ':', 1) FROM pg_shadow WHERE usename=$1"
-		parseMessage := &pgproto3.Parse{Query: query}
-		_, preparedStatement, _ := queryHandler.HandleParseQuery(parseMessage)
-		bindMessage := &pgproto3.Bind{Parameters: [][]byte{[]byte("user")}}
-		_, preparedStatement, _ = queryHandler.HandleBindQuery(bindMessage, preparedStatement)
-		describeMessage := &pgproto3.Describe{ObjectType: 'P'}
-		_, preparedStatement, _ = queryHandler.HandleDescribeQuery(describeMessage, preparedStatement)
-		message := &pgproto3.Execute{}
+	t.Run("Restores prepared statements of a disconnected session with the same session token", func(t *testing.T) {
+		checkpointConfig := *queryHandler.Config
+		checkpointConfig.SessionCheckpointTtlSeconds = 60
+		queryHandler.SessionCheckpoints = NewSessionCheckpoints(&checkpointConfig)
 
-		messages, err := queryHandler.HandleExecuteQuery(message, preparedStatement)
+		disconnectedQueryHandler := queryHandler.WithNewSession()
+		disconnectedQueryHandler.QueryRemapper.Session.SessionToken = "token"
+		_, _, err := disconnectedQueryHandler.HandleParseQuery(&pgproto3.Parse{Name: "checkpoint_statement", Query: "SELECT 1 AS one"})
+		testNoError(t, err)
+		_, err = disconnectedQueryHandler.HandleSimpleQuery("PREPARE checkpoint_prepare AS SELECT 2 AS two")
+		testNoError(t, err)
+		disconnectedQueryHandler.SessionCheckpoints.Save(disconnectedQueryHandler.QueryRemapper.Session)
 
+		sessionQueryHandler := queryHandler.WithNewSession()
+		sessionQueryHandler.QueryRemapper.Session.SessionToken = "token"
+		sessionQueryHandler.RestoreSessionCheckpoint()
+
+		_, _, err = sessionQueryHandler.HandleBindQuery(&pgproto3.Bind{PreparedStatement: "checkpoint_statement"}, nil)
 		testNoError(t, err)
-		testMessageTypes(t, messages, []pgproto3.Message{
-			&pgproto3.DataRow{},
-			&pgproto3.CommandComplete{},
-		})
-		testDataRowValues(t, messages[0], []string{"user", "SCRAM-SHA-256$4096"})
+		messages, err := sessionQueryHandler.HandleSimpleQuery("EXECUTE checkpoint_prepare")
+		testNoError(t, err)
+		testDataRowValues(t, messages[1], []string{"2"})
+
+		otherQueryHandler := queryHandler.WithNewSession()
+		otherQueryHandler.QueryRemapper.Session.SessionToken = "token"
+		otherQueryHandler.RestoreSessionCheckpoint()
+
+		_, _, err = otherQueryHandler.HandleBindQuery(&pgproto3.Bind{PreparedStatement: "checkpoint_statement"}, nil)
+		if err == nil {
+			t.Errorf("Expected the checkpoint to be restored only once, got no error")
+		}
 	})
+}
 
-	t.Run("Handles EXECUTE extended query step if query is empty", func(t *testing.T) {
-		parseMessage := &pgproto3.Parse{Query: ""}
-		_, preparedStatement, _ := queryHandler.HandleParseQuery(parseMessage)
-		bindMessage := &pgproto3.Bind{}
-		_, preparedStatement, _ = queryHandler.HandleBindQuery(bindMessage, preparedStatement)
-		describeMessage := &pgproto3.Describe{ObjectType: 'P'}
-		_, preparedStatement, _ = queryHandler.HandleDescribeQuery(describeMessage, preparedStatement)
-		message := &pgproto3.Execute{}
+func TestCanaryRunner(t *testing.T) {
+	queryHandler := initQueryHandler()
+	defer queryHandler.ServerDuckdbClient.Close()
 
-		messages, err := queryHandler.HandleExecuteQuery(message, preparedStatement)
+	t.Run("Reports canary queries with unexpected result shapes as failing until they recover", func(t *testing.T) {
+		canaryRunner := NewCanaryRunner(queryHandler.Config, queryHandler)
+		rowCount := 1
+		passingCanary := CanaryQuery{Name: "passing", Query: "SELECT 1 AS one", Columns: []string{"one"}, RowCount: &rowCount}
+		failingCanary := CanaryQuery{Name: "failing", Query: "SELECT 1 AS one", Columns: []string{"two"}}
 
-		testNoError(t, err)
-		testMessageTypes(t, messages, []pgproto3.Message{
-			&pgproto3.EmptyQueryResponse{},
-		})
+		canaryRunner.recordResult(passingCanary, canaryRunner.runCanary(passingCanary))
+		canaryRunner.recordResult(failingCanary, canaryRunner.runCanary(failingCanary))
+
+		failures := canaryRunner.Failures()
+		if len(failures) != 1 || failures["failing"] != "expected columns [two], got [one]" {
+			t.Errorf("Expected only the failing canary to fail, got %v", failures)
+		}
+
+		failingCanary.Columns = []string{"one"}
+		canaryRunner.recordResult(failingCanary, canaryRunner.runCanary(failingCanary))
+
+		if len(canaryRunner.Failures()) != 0 {
+			t.Errorf("Expected the canary to recover, got %v", canaryRunner.Failures())
+		}
 	})
 }
 
@@ -1905,6 +4403,290 @@ SET standard_conforming_strings = on;`
 			t.Errorf("Expected error message to contain 'non_existent_table', got: %s", err.Error())
 		}
 	})
+
+	t.Run("Handles temp tables in a transaction", func(t *testing.T) {
+		sessionQueryHandler := queryHandler.WithNewSession()
+		defer sessionQueryHandler.QueryRemapper.DropTempTables()
+		query := `BEGIN;
+CREATE TEMP TABLE extract (id INT, name TEXT) ON COMMIT DROP;
+INSERT INTO extract VALUES (1, 'a'), (2, 'b');
+CREATE TEMP TABLE extract_count AS SELECT COUNT(*) AS count FROM extract;
+SELECT name FROM extract ORDER BY id DESC;
+COMMIT;`
+
+		messages, err := sessionQueryHandler.HandleSimpleQuery(query)
+
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{
+			&pgproto3.CommandComplete{},
+			&pgproto3.CommandComplete{},
+			&pgproto3.CommandComplete{},
+			&pgproto3.CommandComplete{},
+			&pgproto3.RowDescription{},
+			&pgproto3.DataRow{},
+			&pgproto3.DataRow{},
+			&pgproto3.CommandComplete{},
+			&pgproto3.CommandComplete{},
+		})
+		testCommandCompleteTag(t, messages[0], "BEGIN")
+		testCommandCompleteTag(t, messages[1], "CREATE TABLE")
+		testCommandCompleteTag(t, messages[2], "INSERT 0 2")
+		testCommandCompleteTag(t, messages[3], "SELECT 1")
+		testDataRowValues(t, messages[5], []string{"b"})
+		testDataRowValues(t, messages[6], []string{"a"})
+		testCommandCompleteTag(t, messages[8], "COMMIT")
+
+		messages, err = sessionQueryHandler.HandleSimpleQuery("SELECT count FROM extract_count")
+
+		testNoError(t, err)
+		testDataRowValues(t, messages[1], []string{"2"})
+
+		_, err = sessionQueryHandler.HandleSimpleQuery("SELECT * FROM extract")
+
+		if err == nil || !strings.Contains(err.Error(), "extract") {
+			t.Errorf("Expected the ON COMMIT DROP temp table to be dropped, got %v", err)
+		}
+
+		_, err = queryHandler.WithNewSession().HandleSimpleQuery("SELECT count FROM extract_count")
+
+		if err == nil || !strings.Contains(err.Error(), "extract_count") {
+			t.Errorf("Expected the temp table to be visible only in its session, got %v", err)
+		}
+	})
+
+	t.Run("Drops temp tables created in a rolled back transaction", func(t *testing.T) {
+		sessionQueryHandler := queryHandler.WithNewSession()
+
+		_, err := sessionQueryHandler.HandleSimpleQuery("BEGIN; CREATE TEMP TABLE rolled_back (id INT); ROLLBACK")
+		testNoError(t, err)
+
+		_, err = sessionQueryHandler.HandleSimpleQuery("SELECT * FROM rolled_back")
+
+		if err == nil || !strings.Contains(err.Error(), "rolled_back") {
+			t.Errorf("Expected the temp table to be dropped, got %v", err)
+		}
+	})
+
+	t.Run("Doesn't keep temp tables whose CREATE TEMP TABLE failed", func(t *testing.T) {
+		sessionQueryHandler := queryHandler.WithNewSession()
+		defer sessionQueryHandler.QueryRemapper.DropTempTables()
+
+		_, err := sessionQueryHandler.HandleSimpleQuery("CREATE TEMP TABLE failed_create AS SELECT 'a'::INT AS id")
+		if err == nil {
+			t.Fatalf("Expected CREATE TEMP TABLE to fail")
+		}
+
+		if sessionQueryHandler.QueryRemapper.Session.TempTables.Contains("failed_create") {
+			t.Errorf("Expected the temp table not to be registered")
+		}
+		_, err = sessionQueryHandler.HandleSimpleQuery("CREATE TEMP TABLE failed_create (id INT); INSERT INTO failed_create VALUES (1)")
+		testNoError(t, err)
+		if !sessionQueryHandler.QueryRemapper.Session.TempTables.Contains("failed_create") {
+			t.Errorf("Expected the temp table to be registered after it was created")
+		}
+	})
+
+	t.Run("Doesn't keep temp tables of a query that failed before creating them", func(t *testing.T) {
+		sessionQueryHandler := queryHandler.WithNewSession()
+		defer sessionQueryHandler.QueryRemapper.DropTempTables()
+
+		_, err := sessionQueryHandler.HandleSimpleQuery("CREATE TEMP TABLE created (id INT); SELECT 'a'::INT; CREATE TEMP TABLE not_created (id INT)")
+		if err == nil {
+			t.Fatalf("Expected the query to fail")
+		}
+
+		if !sessionQueryHandler.QueryRemapper.Session.TempTables.Contains("created") {
+			t.Errorf("Expected the temp table created before the error to be registered")
+		}
+		if sessionQueryHandler.QueryRemapper.Session.TempTables.Contains("not_created") {
+			t.Errorf("Expected the temp table after the error not to be registered")
+		}
+	})
+
+	t.Run("Rolls back changes made in a transaction", func(t *testing.T) {
+		sessionQueryHandler := queryHandler.WithNewSession()
+		defer sessionQueryHandler.QueryRemapper.DropTempTables()
+
+		_, err := sessionQueryHandler.HandleSimpleQuery("CREATE TEMP TABLE accounts (id INT); INSERT INTO accounts VALUES (1)")
+		testNoError(t, err)
+
+		messages, err := sessionQueryHandler.HandleSimpleQuery("BEGIN; INSERT INTO accounts VALUES (2); SELECT COUNT(*) FROM accounts")
+
+		testNoError(t, err)
+		testDataRowValues(t, messages[3], []string{"2"})
+
+		messages, err = sessionQueryHandler.HandleSimpleQuery("ROLLBACK")
+
+		testNoError(t, err)
+		testCommandCompleteTag(t, messages[0], "ROLLBACK")
+
+		messages, err = sessionQueryHandler.HandleSimpleQuery("SELECT COUNT(*) FROM accounts")
+
+		testNoError(t, err)
+		testDataRowValues(t, messages[1], []string{"1"})
+	})
+
+	t.Run("Continues a failed transaction after ROLLBACK TO SAVEPOINT", func(t *testing.T) {
+		sessionQueryHandler := queryHandler.WithNewSession()
+		defer sessionQueryHandler.QueryRemapper.RollbackTransaction()
+
+		messages, err := sessionQueryHandler.HandleSimpleQuery("BEGIN; SAVEPOINT s1; SELECT 1; RELEASE SAVEPOINT s1; SAVEPOINT s2")
+
+		testNoError(t, err)
+		testCommandCompleteTag(t, messages[1], "SAVEPOINT")
+		testCommandCompleteTag(t, messages[5], "RELEASE")
+		testCommandCompleteTag(t, messages[6], "SAVEPOINT")
+
+		_, err = sessionQueryHandler.HandleSimpleQuery("SELECT 1 / 'a'")
+		if err == nil {
+			t.Fatalf("Expected an error, got nil")
+		}
+		sessionQueryHandler.QueryRemapper.Session.Transaction.Failed = true // Set by the server after an error
+
+		messages, err = sessionQueryHandler.HandleSimpleQuery("ROLLBACK TO SAVEPOINT s2; SELECT 2")
+
+		testNoError(t, err)
+		testCommandCompleteTag(t, messages[0], "ROLLBACK")
+		testDataRowValues(t, messages[2], []string{"2"})
+
+		_, err = sessionQueryHandler.HandleSimpleQuery("ROLLBACK TO SAVEPOINT s1")
+
+		var pgError *PgError
+		if !errors.As(err, &pgError) || pgError.Code != PG_ERROR_CODE_INVALID_SAVEPOINT {
+			t.Errorf("Expected a released savepoint to not exist, got %v", err)
+		}
+	})
+
+	t.Run("Rejects rolling back changes to temp tables to a savepoint", func(t *testing.T) {
+		sessionQueryHandler := queryHandler.WithNewSession()
+		defer sessionQueryHandler.QueryRemapper.DropTempTables()
+		defer sessionQueryHandler.QueryRemapper.RollbackTransaction()
+
+		_, err := sessionQueryHandler.HandleSimpleQuery("BEGIN; CREATE TEMP TABLE savepoint_changes (id INT); SAVEPOINT s1; INSERT INTO savepoint_changes VALUES (1)")
+		testNoError(t, err)
+
+		_, err = sessionQueryHandler.HandleSimpleQuery("ROLLBACK TO SAVEPOINT s1")
+
+		var pgError *PgError
+		if !errors.As(err, &pgError) || pgError.Code != PG_ERROR_CODE_FEATURE_NOT_SUPPORTED {
+			t.Errorf("Expected a not supported error, got %v", err)
+		}
+	})
+
+	t.Run("Pages through query results with a cursor", func(t *testing.T) {
+		sessionQueryHandler := queryHandler.WithNewSession()
+		defer sessionQueryHandler.QueryRemapper.DropTempTables()
+		defer sessionQueryHandler.QueryRemapper.RollbackTransaction()
+
+		_, err := sessionQueryHandler.HandleSimpleQuery("BEGIN; CREATE TEMP TABLE cursor_rows (id INT); INSERT INTO cursor_rows VALUES (1), (2), (3), (4), (5)")
+		testNoError(t, err)
+
+		messages, err := sessionQueryHandler.HandleSimpleQuery("DECLARE rows_cursor CURSOR FOR SELECT id FROM cursor_rows ORDER BY id")
+
+		testNoError(t, err)
+		testCommandCompleteTag(t, messages[0], "DECLARE CURSOR")
+
+		messages, err = sessionQueryHandler.HandleSimpleQuery("FETCH 2 FROM rows_cursor")
+
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{
+			&pgproto3.RowDescription{},
+			&pgproto3.DataRow{},
+			&pgproto3.DataRow{},
+			&pgproto3.CommandComplete{},
+		})
+		testRowDescription(t, messages[0], []string{"id"}, []string{uint32ToString(pgtype.Int4OID)})
+		testDataRowValues(t, messages[1], []string{"1"})
+		testDataRowValues(t, messages[2], []string{"2"})
+		testCommandCompleteTag(t, messages[3], "FETCH 2")
+
+		messages, err = sessionQueryHandler.HandleSimpleQuery("MOVE 1 IN rows_cursor; FETCH ALL FROM rows_cursor; CLOSE rows_cursor")
+
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{
+			&pgproto3.CommandComplete{},
+			&pgproto3.RowDescription{},
+			&pgproto3.DataRow{},
+			&pgproto3.DataRow{},
+			&pgproto3.CommandComplete{},
+			&pgproto3.CommandComplete{},
+		})
+		testCommandCompleteTag(t, messages[0], "MOVE 1")
+		testDataRowValues(t, messages[2], []string{"4"})
+		testDataRowValues(t, messages[3], []string{"5"})
+		testCommandCompleteTag(t, messages[4], "FETCH 2")
+		testCommandCompleteTag(t, messages[5], "CLOSE CURSOR")
+
+		_, err = sessionQueryHandler.HandleSimpleQuery("FETCH 1 FROM rows_cursor")
+
+		var pgError *PgError
+		if !errors.As(err, &pgError) || pgError.Code != PG_ERROR_CODE_INVALID_CURSOR_NAME {
+			t.Errorf("Expected an invalid cursor name error, got %v", err)
+		}
+	})
+
+	t.Run("Keeps only cursors WITH HOLD after a transaction block", func(t *testing.T) {
+		sessionQueryHandler := queryHandler.WithNewSession()
+		defer sessionQueryHandler.QueryRemapper.Session.CloseCursors()
+
+		_, err := sessionQueryHandler.HandleSimpleQuery("DECLARE no_hold_cursor CURSOR FOR SELECT 1")
+
+		var pgError *PgError
+		if !errors.As(err, &pgError) || pgError.Code != PG_ERROR_CODE_NO_ACTIVE_TRANSACTION {
+			t.Errorf("Expected a no active transaction error, got %v", err)
+		}
+
+		_, err = sessionQueryHandler.HandleSimpleQuery("BEGIN; DECLARE no_hold_cursor CURSOR FOR SELECT 1; DECLARE hold_cursor CURSOR WITH HOLD FOR SELECT 2 AS value; COMMIT")
+		testNoError(t, err)
+
+		messages, err := sessionQueryHandler.HandleSimpleQuery("FETCH ALL FROM hold_cursor")
+
+		testNoError(t, err)
+		testDataRowValues(t, messages[1], []string{"2"})
+		testCommandCompleteTag(t, messages[2], "FETCH 1")
+
+		_, err = sessionQueryHandler.HandleSimpleQuery("FETCH ALL FROM no_hold_cursor")
+
+		if !errors.As(err, &pgError) || pgError.Code != PG_ERROR_CODE_INVALID_CURSOR_NAME {
+			t.Errorf("Expected an invalid cursor name error, got %v", err)
+		}
+	})
+
+	t.Run("Reads cursors WITH HOLD with the session's DuckDB settings", func(t *testing.T) {
+		sessionQueryHandler := queryHandler.WithNewSession()
+		defer sessionQueryHandler.QueryRemapper.Session.CloseCursors()
+		_, err := sessionQueryHandler.HandleSimpleQuery("SET timezone = 'America/New_York'")
+		testNoError(t, err)
+
+		_, err = sessionQueryHandler.HandleSimpleQuery("BEGIN; DECLARE hold_cursor CURSOR WITH HOLD FOR SELECT TIMESTAMPTZ '2000-01-01 00:00:00+00'::text AS value; COMMIT")
+		testNoError(t, err)
+		messages, err := sessionQueryHandler.HandleSimpleQuery("FETCH ALL FROM hold_cursor")
+
+		testNoError(t, err)
+		testDataRowValues(t, messages[1], []string{"1999-12-31 19:00:00-05"})
+	})
+
+	t.Run("Rejects queries in a failed transaction until it ends", func(t *testing.T) {
+		sessionQueryHandler := queryHandler.WithNewSession()
+		_, err := sessionQueryHandler.HandleSimpleQuery("BEGIN")
+		testNoError(t, err)
+		sessionQueryHandler.QueryRemapper.Session.Transaction.Failed = true // Set by the server after an error
+
+		_, err = sessionQueryHandler.HandleSimpleQuery("SELECT 1")
+
+		var pgError *PgError
+		if !errors.As(err, &pgError) || pgError.Code != PG_ERROR_CODE_IN_FAILED_TRANSACTION {
+			t.Errorf("Expected a failed transaction error, got %v", err)
+		}
+
+		messages, err := sessionQueryHandler.HandleSimpleQuery("COMMIT")
+
+		testNoError(t, err)
+		testCommandCompleteTag(t, messages[0], "ROLLBACK")
+		if sessionQueryHandler.QueryRemapper.Session.Transaction != nil {
+			t.Errorf("Expected the transaction to end")
+		}
+	})
 }
 
 func initQueryHandler() *QueryHandler {
@@ -2011,6 +4793,24 @@ func testResponseByQuery(t *testing.T, queryHandler *QueryHandler, responseByQue
 	}
 }
 
+type testQueryHook struct {
+	rejectedTable  string
+	beforeAccesses []QueryAccess
+	afterAccesses  []QueryAccess
+}
+
+func (hook *testQueryHook) BeforeQuery(ctx context.Context, access QueryAccess) error {
+	hook.beforeAccesses = append(hook.beforeAccesses, access)
+	if slices.Contains(access.Tables, hook.rejectedTable) {
+		return errors.New("table " + hook.rejectedTable + " is not allowed")
+	}
+	return nil
+}
+
+func (hook *testQueryHook) AfterQuery(access QueryAccess) {
+	hook.afterAccesses = append(hook.afterAccesses, access)
+}
+
 func uint32ToString(i uint32) string {
 	return strconv.FormatUint(uint64(i), 10)
 }
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/BemiHQ/BemiDB/src/common"
+)
+
+const (
+	QUERY_HOOK_WEBHOOK_TIMEOUT = 5 * time.Second
+
+	QUERY_HOOK_EVENT_BEFORE_QUERY = "before_query"
+	QUERY_HOOK_EVENT_AFTER_QUERY  = "after_query"
+)
+
+// Who ran a query and which tables it read, passed to the query hooks
+type QueryAccess struct {
+	Event           string   `json:"event"`
+	User            string   `json:"user"`
+	Database        string   `json:"database"`
+	ApplicationName string   `json:"applicationName"`
+	ClientAddr      string   `json:"clientAddr"`
+	Query           string   `json:"query"`
+	Tables          []string `json:"tables"`             // schema.table, or the call of a table function reading files, without system tables
+	RowCount        int64    `json:"rowCount,omitempty"` // Returned rows, set only after the query
+}
+
+// Inspects queries to veto or flag anomalous access patterns, e.g. a full dump of a table with PII
+type QueryHook interface {
+	BeforeQuery(ctx context.Context, access QueryAccess) error // Rejects the query if an error is returned
+	AfterQuery(access QueryAccess)
+}
+
+// Runs the configured query hooks in order, the first veto rejects the query
+type QueryHooks struct {
+	config *Config
+	hooks  []QueryHook
+}
+
+func NewQueryHooks(config *Config) *QueryHooks {
+	queryHooks := &QueryHooks{config: config}
+	if config.QueryHookRowThreshold > 0 {
+		queryHooks.Add(&RowThresholdQueryHook{config: config, rowThreshold: config.QueryHookRowThreshold})
+	}
+	if config.QueryHookWebhookUrl != "" {
+		queryHooks.Add(&WebhookQueryHook{config: config, url: config.QueryHookWebhookUrl})
+	}
+	return queryHooks
+}
+
+func (queryHooks *QueryHooks) Add(hook QueryHook) {
+	queryHooks.hooks = append(queryHooks.hooks, hook)
+}
+
+func (queryHooks *QueryHooks) Enabled() bool {
+	return len(queryHooks.hooks) > 0
+}
+
+func (queryHooks *QueryHooks) BeforeQuery(ctx context.Context, access QueryAccess) error {
+	access.Event = QUERY_HOOK_EVENT_BEFORE_QUERY
+	for _, hook := range queryHooks.hooks {
+		err := hook.BeforeQuery(ctx, access)
+		if err != nil {
+			common.LogWarn(queryHooks.config.CommonConfig, "Query rejected by a query hook:", "user="+access.User, "client_addr="+access.ClientAddr, "tables="+strings.Join(access.Tables, ","), err)
+			return &PgError{
+				Code:    PG_ERROR_CODE_INSUFFICIENT_PRIVILEGE,
+				Message: "query rejected by access policy",
+				Detail:  err.Error(),
+			}
+		}
+	}
+	return nil
+}
+
+func (queryHooks *QueryHooks) AfterQuery(access QueryAccess, rowCount int64) {
+	access.Event = QUERY_HOOK_EVENT_AFTER_QUERY
+	access.RowCount = rowCount
+	for _, hook := range queryHooks.hooks {
+		hook.AfterQuery(access)
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Logs a warning for queries returning at least the configured number of rows from tables
+type RowThresholdQueryHook struct {
+	config       *Config
+	rowThreshold int64
+}
+
+func (hook *RowThresholdQueryHook) BeforeQuery(ctx context.Context, access QueryAccess) error {
+	return nil
+}
+
+func (hook *RowThresholdQueryHook) AfterQuery(access QueryAccess) {
+	if access.RowCount < hook.rowThreshold {
+		return
+	}
+	common.LogWarn(hook.config.CommonConfig, "Anomalous access:", common.Int64ToString(access.RowCount), "rows returned", "user="+access.User, "client_addr="+access.ClientAddr, "application_name="+access.ApplicationName, "tables="+strings.Join(access.Tables, ","))
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Sends the accesses to an HTTP endpoint (e.g., a SIEM collector). Before a query, a {"allow": false, "reason": "..."} response
+// rejects the query. Requests that fail, time out, or get an unexpected response also reject queries to not bypass the policy
+type WebhookQueryHook struct {
+	config *Config
+	url    string
+}
+
+type WebhookQueryHookResponse struct {
+	Allow  *bool  `json:"allow"`
+	Reason string `json:"reason"`
+}
+
+func (hook *WebhookQueryHook) BeforeQuery(ctx context.Context, access QueryAccess) error {
+	ctx, cancel := context.WithTimeout(ctx, QUERY_HOOK_WEBHOOK_TIMEOUT)
+	defer cancel()
+
+	response, err := hook.post(ctx, access)
+	if err != nil {
+		common.LogWarn(hook.config.CommonConfig, "Couldn't send query access to the webhook:", err)
+		return errors.New("couldn't reach the access policy webhook")
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode >= http.StatusMultipleChoices {
+		common.LogWarn(hook.config.CommonConfig, "Unexpected query access webhook response:", response.Status)
+		return fmt.Errorf("unexpected access policy webhook response: %s", response.Status)
+	}
+
+	var hookResponse WebhookQueryHookResponse
+	err = json.NewDecoder(response.Body).Decode(&hookResponse)
+	if errors.Is(err, io.EOF) {
+		return nil // Empty response allows the query
+	}
+	if err != nil {
+		common.LogWarn(hook.config.CommonConfig, "Invalid query access webhook response:", err)
+		return errors.New("invalid access policy webhook response")
+	}
+	if hookResponse.Allow != nil && !*hookResponse.Allow {
+		if hookResponse.Reason == "" {
+			return fmt.Errorf("rejected by %s", hook.url)
+		}
+		return fmt.Errorf("%s", hookResponse.Reason)
+	}
+	return nil
+}
+
+// Sent in the background to not delay the query response
+func (hook *WebhookQueryHook) AfterQuery(access QueryAccess) {
+	goWithPanicHandler(hook.config, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), QUERY_HOOK_WEBHOOK_TIMEOUT)
+		defer cancel()
+
+		response, err := hook.post(ctx, access)
+		if err != nil {
+			common.LogWarn(hook.config.CommonConfig, "Couldn't send query access to the webhook:", err)
+			return
+		}
+		response.Body.Close()
+	})
+}
+
+func (hook *WebhookQueryHook) post(ctx context.Context, access QueryAccess) (*http.Response, error) {
+	jsonData, err := json.Marshal(access)
+	common.PanicIfError(hook.config.CommonConfig, err)
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	return http.DefaultClient.Do(request)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWebhookQueryHook(t *testing.T) {
+	config := loadTestConfig()
+	access := QueryAccess{Event: QUERY_HOOK_EVENT_BEFORE_QUERY, User: "user", Tables: []string{"public.users"}}
+
+	t.Run("Allows queries with an allowing or empty response", func(t *testing.T) {
+		for _, body := range []string{`{"allow": true}`, ""} {
+			server := testWebhookServer(http.StatusOK, body)
+			defer server.Close()
+			hook := &WebhookQueryHook{config: config, url: server.URL}
+
+			err := hook.BeforeQuery(context.Background(), access)
+
+			testNoError(t, err)
+		}
+	})
+
+	t.Run("Rejects queries with the reason of the response", func(t *testing.T) {
+		server := testWebhookServer(http.StatusOK, `{"allow": false, "reason": "PII export"}`)
+		defer server.Close()
+		hook := &WebhookQueryHook{config: config, url: server.URL}
+
+		err := hook.BeforeQuery(context.Background(), access)
+
+		if err == nil || err.Error() != "PII export" {
+			t.Errorf("Expected the query to be rejected with the reason, got %v", err)
+		}
+	})
+
+	t.Run("Rejects queries if the webhook fails", func(t *testing.T) {
+		failingServer := testWebhookServer(http.StatusInternalServerError, "")
+		defer failingServer.Close()
+		invalidServer := testWebhookServer(http.StatusOK, "<html>")
+		defer invalidServer.Close()
+		closedServer := testWebhookServer(http.StatusOK, "")
+		closedServer.Close()
+
+		for _, url := range []string{failingServer.URL, invalidServer.URL, closedServer.URL} {
+			hook := &WebhookQueryHook{config: config, url: url}
+
+			err := hook.BeforeQuery(context.Background(), access)
+
+			if err == nil {
+				t.Errorf("Expected the query to be rejected with %s", url)
+			}
+		}
+	})
+}
+
+func testWebhookServer(statusCode int, body string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.WriteHeader(statusCode)
+		writer.Write([]byte(body))
+	}))
+}
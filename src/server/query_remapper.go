@@ -1,12 +1,20 @@
 package main
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	pgQuery "github.com/pganalyze/pg_query_go/v6"
+	"google.golang.org/protobuf/proto"
 
 	"github.com/BemiHQ/BemiDB/src/common"
 )
@@ -16,10 +24,6 @@ const (
 	PERMISSIONS_SQL_COMMENT = "BEMIDB_PERMISSIONS"
 )
 
-var SUPPORTED_SET_STATEMENTS = common.NewSet[string]().AddAll([]string{
-	"timezone", // SET SESSION timezone TO 'UTC'
-})
-
 var KNOWN_SET_STATEMENTS = common.NewSet[string]().AddAll([]string{
 	"client_encoding",             // SET client_encoding TO 'UTF8'
 	"client_min_messages",         // SET client_min_messages TO 'warning'
@@ -31,44 +35,115 @@ var KNOWN_SET_STATEMENTS = common.NewSet[string]().AddAll([]string{
 	"session characteristics",     // SET SESSION CHARACTERISTICS AS TRANSACTION ISOLATION LEVEL READ COMMITTED
 })
 
+// Table functions that restricted users can call, others like read_parquet() or query() could read data without their permissions
+var RESTRICTED_TABLE_FUNCTION_NAMES = common.NewSet[string]().AddAll([]string{
+	"generate_series", "range", "unnest", "generate_subscripts", "regexp_split_to_table", "string_to_table",
+	"json_array_elements", "jsonb_array_elements", "json_array_elements_text", "jsonb_array_elements_text",
+	"json_each", "jsonb_each", "json_each_text", "jsonb_each_text", "json_object_keys", "jsonb_object_keys",
+	"pg_get_keywords", "pg_show_all_settings", "pg_is_in_recovery", "pg_options_to_table", "pg_timezone_names", "pg_timezone_abbrevs", "_pg_expandarray",
+	SAMPLE_TABLES_FUNCTION, // Reads the table with the user's permissions
+})
+
 var NOOP_QUERY_TREE, _ = pgQuery.Parse("SET TimeZone = 'UTC'")
 
+var DO_BLOCK_BODY_REGEX = regexp.MustCompile(`(?is)^\s*BEGIN\s(.*?);?\s*END\s*;?\s*$`)
+
+var STATEMENT_TIMEOUT_REGEX = regexp.MustCompile(`^\s*([0-9]+(?:\.[0-9]+)?)\s*([a-z]*)\s*$`)
+
+var STATEMENT_TIMEOUT_UNITS = map[string]time.Duration{
+	"":    time.Millisecond,
+	"us":  time.Microsecond,
+	"ms":  time.Millisecond,
+	"s":   time.Second,
+	"min": time.Minute,
+	"h":   time.Hour,
+	"d":   24 * time.Hour,
+}
+
+const DO_BLOCK_HINT = "Only DO blocks with a BEGIN ... END body of SQL statements that don't return rows (e.g., REFRESH MATERIALIZED VIEW) are supported."
+
 type QueryRemapper struct {
 	remapperTable      *QueryRemapperTable
 	remapperExpression *QueryRemapperExpression
 	remapperFunction   *QueryRemapperFunction
 	remapperSelect     *QueryRemapperSelect
 	remapperShow       *QueryRemapperShow
+	parserCopy         *ParserCopy
+	parserExplain      *ParserExplain
+	tempTables         *TempTables
+	remapError         error // Set while remapping nodes that can't return errors, e.g. a view with tables that aren't synced yet
 	IcebergReader      *IcebergReader
 	IcebergWriter      *IcebergWriter
+	Session            *Session
+	catalogSwitch      *CatalogSwitch // nilable
+	catalogName        string         // Catalog of the remappers above
 	config             *Config
 }
 
-func NewQueryRemapper(config *Config, icebergReader *IcebergReader, icebergWriter *IcebergWriter, serverDuckdbClient *common.DuckdbClient) *QueryRemapper {
-	return &QueryRemapper{
-		remapperTable:      NewQueryRemapperTable(config, icebergReader, serverDuckdbClient),
+func NewQueryRemapper(config *Config, icebergReader *IcebergReader, icebergWriter *IcebergWriter, connectionLog *ConnectionLog, serverDuckdbClient *common.DuckdbClient) *QueryRemapper {
+	remapper := &QueryRemapper{
+		remapperTable:      NewQueryRemapperTable(config, icebergReader, icebergWriter.LockTracker, connectionLog, serverDuckdbClient),
 		remapperExpression: NewQueryRemapperExpression(config),
 		remapperFunction:   NewQueryRemapperFunction(config, icebergReader),
 		remapperSelect:     NewQueryRemapperSelect(config),
 		remapperShow:       NewQueryRemapperShow(config),
+		parserCopy:         NewParserCopy(config),
+		parserExplain:      NewParserExplain(config),
+		tempTables:         NewTempTables(config, serverDuckdbClient),
 		IcebergReader:      icebergReader,
 		IcebergWriter:      icebergWriter,
+		Session:            NewSession(),
+		catalogName:        CATALOG_PRIMARY,
 		config:             config,
 	}
+	remapper.catalogSwitch = NewCatalogSwitch(config, &CatalogRemappers{
+		remapperTable:    remapper.remapperTable,
+		remapperFunction: remapper.remapperFunction,
+		icebergReader:    icebergReader,
+		icebergWriter:    icebergWriter,
+	})
+	if config.CandidateCatalogDatabaseUrl != "" {
+		remapper.catalogSwitch.AddCandidate(icebergWriter.StorageS3, icebergWriter.LockTracker, connectionLog, serverDuckdbClient)
+	}
+	return remapper
+}
+
+// Shares the remappers and their caches across connections, keeping the session state separate
+func (remapper *QueryRemapper) WithSession(session *Session) *QueryRemapper {
+	sessionRemapper := *remapper
+	sessionRemapper.Session = session
+	return &sessionRemapper
 }
 
 func (remapper *QueryRemapper) ParseAndRemapQuery(query string) ([]string, []string, error) {
-	queryTree, err := pgQuery.Parse(query)
+	// Permissions in a query comment are still extracted from the query before it's rewritten
+	rewrittenQuery, ruleName, rewritten := remapper.config.RewriteQuery(query)
+	if rewritten {
+		common.LogDebug(remapper.config.CommonConfig, "Rewrote query with rule "+ruleName+":", query, "->", rewrittenQuery)
+	}
+
+	queryTree, err := pgQuery.Parse(rewrittenQuery)
 	if err != nil {
-		return nil, nil, fmt.Errorf("couldn't parse query: %s. %w", query, err)
+		return nil, nil, fmt.Errorf("couldn't parse query: %s. %w", rewrittenQuery, err)
 	}
 
 	if strings.HasSuffix(query, INSPECT_SQL_COMMENT) {
 		common.LogDebug(remapper.config.CommonConfig, queryTree.Stmts)
 	}
 
-	var permissions *map[string][]string
-	if strings.Count(query, "/*"+PERMISSIONS_SQL_COMMENT+" ") == 1 && strings.Count(query, " "+PERMISSIONS_SQL_COMMENT+"*/") == 1 {
+	// Permissions configured for the user can't be overridden by a query comment
+	permissions := remapper.config.PermissionsFor(remapper.Session.User)
+	err = remapper.checkHiddenTables(rewrittenQuery)
+	if err != nil {
+		return nil, nil, err
+	}
+	if remapper.config.IsRestricted(remapper.Session.User) {
+		err = remapper.checkRestrictedQuery(rewrittenQuery)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	if permissions == nil && strings.Count(query, "/*"+PERMISSIONS_SQL_COMMENT+" ") == 1 && strings.Count(query, " "+PERMISSIONS_SQL_COMMENT+"*/") == 1 {
 		permissions, err = remapper.extractPermissions(query)
 		if err != nil {
 			return nil, nil, fmt.Errorf("couldn't extract permissions from query comment: %s. %w", query, err)
@@ -77,18 +152,35 @@ func (remapper *QueryRemapper) ParseAndRemapQuery(query string) ([]string, []str
 	}
 
 	var originalQueryStatements []string
+	var originalSelectStatements []string
 	for _, stmt := range queryTree.Stmts {
 		originalQueryStatement, err := pgQuery.Deparse(&pgQuery.ParseResult{Stmts: []*pgQuery.RawStmt{stmt}})
 		if err != nil {
 			return nil, nil, fmt.Errorf("couldn't deparse query: %s. %w", query, err)
 		}
 		originalQueryStatements = append(originalQueryStatements, originalQueryStatement)
+		if stmt.Stmt.GetSelectStmt() != nil {
+			originalSelectStatements = append(originalSelectStatements, originalQueryStatement)
+		}
 	}
 
+	remapper.remapError = nil
 	remappedStatements, err := remapper.remapStatements(queryTree.Stmts, permissions)
 	if err != nil {
 		return nil, nil, err
 	}
+	if remapper.remapError != nil {
+		err, remapper.remapError = remapper.remapError, nil
+		return nil, nil, err
+	}
+
+	// After remapping, which loads the referenced Iceberg tables into DuckDB
+	for _, originalSelectStatement := range originalSelectStatements {
+		err = remapper.checkIdentifierCase(originalSelectStatement)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
 
 	var queryStatements []string
 	for _, remappedStatement := range remappedStatements {
@@ -110,10 +202,30 @@ func (remapper *QueryRemapper) remapStatements(statements []*pgQuery.RawStmt, pe
 		return statements, nil
 	}
 
+	transactionEnding := false
 	for i, stmt := range statements {
-		common.LogTrace(remapper.config.CommonConfig, "Remapping statement #"+common.IntToString(i+1))
+		remapper.Session.LogTrace(remapper.config.CommonConfig, "Remapping statement #"+common.IntToString(i+1))
 
 		node := stmt.Stmt
+		remapper.useSessionCatalog() // Also after SET bemidb.catalog in a previous statement
+
+		if isTransactionEndStatement(node) {
+			transactionEnding = true // The next statements run after it
+		}
+		if remapper.Session.Transaction != nil && remapper.Session.Transaction.Failed && !transactionEnding {
+			return nil, &PgError{
+				Code:    PG_ERROR_CODE_IN_FAILED_TRANSACTION,
+				Message: "current transaction is aborted, commands ignored until end of transaction block",
+			}
+		}
+
+		if node != nil && remapper.config.IsRestricted(remapper.Session.User) && remapper.isWriteStatement(node) {
+			return nil, &PgError{
+				Code:    PG_ERROR_CODE_INSUFFICIENT_PRIVILEGE,
+				Message: "permission denied for user " + remapper.Session.User,
+				Detail:  "Users with configured permissions can only read data.",
+			}
+		}
 
 		switch {
 		// Empty statement
@@ -127,22 +239,119 @@ func (remapper *QueryRemapper) remapStatements(statements []*pgQuery.RawStmt, pe
 			stmt.Stmt = &pgQuery.Node{Node: &pgQuery.Node_SelectStmt{SelectStmt: selectStatement}}
 			statements[i] = stmt
 
+		// COPY (SELECT ...) TO STDOUT / COPY table TO STDOUT
+		case node.GetCopyStmt() != nil:
+			copyStatement, err := remapper.remapCopyStatement(stmt, permissions)
+			if err != nil {
+				return nil, err
+			}
+			statements[i] = copyStatement
+
+		// EXPLAIN [ANALYZE] SELECT ... -> EXPLAIN [ANALYZE] SELECT ... (remapped), the query handler returns the plan as QUERY PLAN rows
+		case node.GetExplainStmt() != nil:
+			err := remapper.remapExplainStatement(node.GetExplainStmt(), permissions)
+			if err != nil {
+				return nil, err
+			}
+			statements[i] = stmt
+
 		// SET
 		case node.GetVariableSetStmt() != nil:
-			statements[i] = remapper.remapSetStatement(stmt)
+			setStatement, err := remapper.remapSetStatement(stmt)
+			if err != nil {
+				return nil, err
+			}
+			statements[i] = setStatement
 
-		// DISCARD ALL
+		// DISCARD ALL / DISCARD TEMP
 		case node.GetDiscardStmt() != nil:
+			if node.GetDiscardStmt().Target == pgQuery.DiscardMode_DISCARD_ALL {
+				clear(remapper.Session.PreparedStatements)
+				remapper.Session.CloseExtendedStatements()
+				remapper.Session.CloseCursors()
+			}
+			if node.GetDiscardStmt().Target == pgQuery.DiscardMode_DISCARD_ALL || node.GetDiscardStmt().Target == pgQuery.DiscardMode_DISCARD_TEMP {
+				remapper.tempTables.DropAll(remapper.Session)
+			}
 			statements[i] = NOOP_QUERY_TREE.Stmts[0]
 
+		// SHOW bemidb.catalog
+		case node.GetVariableShowStmt() != nil && strings.ToLower(node.GetVariableShowStmt().Name) == BEMIDB_VAR_CATALOG:
+			statements[i] = remapper.remapperShow.RemapShowValue(stmt, remapper.catalogName)
+
+		// SHOW search_path
+		case node.GetVariableShowStmt() != nil && strings.ToLower(node.GetVariableShowStmt().Name) == PG_VAR_SEARCH_PATH && remapper.Session.SearchPath != nil:
+			statements[i] = remapper.remapperShow.RemapShowValue(stmt, remapper.searchPathSetting())
+
+		// SHOW bemidb.max_parallel_downloads
+		case node.GetVariableShowStmt() != nil && strings.ToLower(node.GetVariableShowStmt().Name) == BEMIDB_VAR_MAX_PARALLEL_DOWNLOADS:
+			statements[i] = remapper.remapperShow.RemapShowValue(stmt, common.IntToString(remapper.config.MaxParallelDownloads))
+
 		// SHOW
 		case node.GetVariableShowStmt() != nil:
 			statements[i] = remapper.remapperShow.RemapShowStatement(stmt)
 
-		// BEGIN
+		// ALTER SYSTEM SET bemidb.catalog = candidate
+		case node.GetAlterSystemStmt() != nil:
+			err := remapper.alterSystem(node.GetAlterSystemStmt().Setstmt)
+			if err != nil {
+				return nil, err
+			}
+			statements[i] = NOOP_QUERY_TREE.Stmts[0]
+
+		// BEGIN / COMMIT / ROLLBACK, handled by HandleTransactionQuery when the statement runs
 		case node.GetTransactionStmt() != nil:
 			statements[i] = NOOP_QUERY_TREE.Stmts[0]
 
+		// CREATE TEMP TABLE ... / CREATE TEMP TABLE ... AS SELECT ...
+		case (node.GetCreateStmt() != nil && node.GetCreateStmt().Relation.Relpersistence == RELPERSISTENCE_TEMP) ||
+			(node.GetCreateTableAsStmt() != nil && node.GetCreateTableAsStmt().Into.Rel.Relpersistence == RELPERSISTENCE_TEMP):
+			err := remapper.createTempTable(node, permissions)
+			if err != nil {
+				return nil, err
+			}
+			statements[i] = stmt
+
+		// INSERT INTO temp_table ... / INSERT INTO table ... -> VALUES ... / SELECT ... (remapped), the query handler appends the rows to the table
+		case node.GetInsertStmt() != nil:
+			insertStatement, err := remapper.remapInsertStatement(stmt, permissions)
+			if err != nil {
+				return nil, err
+			}
+			statements[i] = insertStatement
+
+		// UPDATE temp_table ... / DELETE FROM temp_table ... / UPDATE table ... / DELETE FROM table ... (remapped), the query handler changes the rows of the table
+		case node.GetUpdateStmt() != nil || node.GetDeleteStmt() != nil:
+			err := remapper.remapUpdateOrDeleteStatement(node, permissions)
+			if err != nil {
+				return nil, err
+			}
+			statements[i] = stmt
+
+		// DROP TABLE [IF EXISTS] temp_table
+		case node.GetDropStmt() != nil && node.GetDropStmt().RemoveType == pgQuery.ObjectType_OBJECT_TABLE && remapper.isDropTempTables(node.GetDropStmt()):
+			err := remapper.dropTempTables(node.GetDropStmt())
+			if err != nil {
+				return nil, err
+			}
+			statements[i] = NOOP_QUERY_TREE.Stmts[0]
+
+		// CREATE SCHEMA [IF NOT EXISTS] schema
+		case node.GetCreateSchemaStmt() != nil:
+			err := remapper.createSchema(node.GetCreateSchemaStmt())
+			if err != nil {
+				return nil, err
+			}
+			statements[i] = NOOP_QUERY_TREE.Stmts[0]
+
+		// CREATE TABLE [IF NOT EXISTS] ... AS SELECT ... [WITH NO DATA]
+		case node.GetCreateTableAsStmt() != nil && node.GetCreateTableAsStmt().Objtype == pgQuery.ObjectType_OBJECT_TABLE:
+			err := remapper.createTableAs(node.GetCreateTableAsStmt(), permissions)
+			if err != nil {
+				return nil, err
+			}
+			statements[i] = NOOP_QUERY_TREE.Stmts[0]
+
 		// CREATE MATERIALIZED VIEW [IF NOT EXISTS] AS ... [WITH NO DATA]
 		case node.GetCreateTableAsStmt() != nil:
 			err := remapper.createMaterializedView(node)
@@ -151,6 +360,22 @@ func (remapper *QueryRemapper) remapStatements(statements []*pgQuery.RawStmt, pe
 			}
 			statements[i] = NOOP_QUERY_TREE.Stmts[0]
 
+		// CREATE [OR REPLACE] VIEW ... AS SELECT ...
+		case node.GetViewStmt() != nil:
+			err := remapper.createView(node.GetViewStmt())
+			if err != nil {
+				return nil, err
+			}
+			statements[i] = NOOP_QUERY_TREE.Stmts[0]
+
+		// DROP VIEW [IF EXISTS] view, ...
+		case node.GetDropStmt() != nil && node.GetDropStmt().RemoveType == pgQuery.ObjectType_OBJECT_VIEW:
+			err := remapper.dropViews(node.GetDropStmt())
+			if err != nil {
+				return nil, err
+			}
+			statements[i] = NOOP_QUERY_TREE.Stmts[0]
+
 		// DROP MATERIALIZED VIEW [IF EXISTS]
 		case node.GetDropStmt() != nil &&
 			(node.GetDropStmt().RemoveType == pgQuery.ObjectType_OBJECT_TABLE || node.GetDropStmt().RemoveType == pgQuery.ObjectType_OBJECT_MATVIEW):
@@ -168,6 +393,15 @@ func (remapper *QueryRemapper) remapStatements(statements []*pgQuery.RawStmt, pe
 			}
 			statements[i] = NOOP_QUERY_TREE.Stmts[0]
 
+		// ALTER TABLE [IF EXISTS] table ADD COLUMN ... / DROP COLUMN ... / RENAME COLUMN ... TO ...
+		case (node.GetAlterTableStmt() != nil && node.GetAlterTableStmt().Objtype == pgQuery.ObjectType_OBJECT_TABLE) ||
+			(node.GetRenameStmt() != nil && node.GetRenameStmt().RenameType == pgQuery.ObjectType_OBJECT_COLUMN):
+			alterStatement, err := remapper.alterTableColumns(stmt)
+			if err != nil {
+				return nil, err
+			}
+			statements[i] = alterStatement
+
 		// ALTER TABLE [IF EXISTS] ... RENAME TO ...
 		case node.GetRenameStmt() != nil &&
 			(node.GetRenameStmt().RenameType == pgQuery.ObjectType_OBJECT_TABLE || node.GetRenameStmt().RenameType == pgQuery.ObjectType_OBJECT_MATVIEW):
@@ -177,6 +411,65 @@ func (remapper *QueryRemapper) remapStatements(statements []*pgQuery.RawStmt, pe
 			}
 			statements[i] = NOOP_QUERY_TREE.Stmts[0]
 
+		// DO $$ BEGIN ... END $$
+		case node.GetDoStmt() != nil:
+			err := remapper.runDoBlockFromNode(node, permissions)
+			if err != nil {
+				return nil, err
+			}
+			statements[i] = NOOP_QUERY_TREE.Stmts[0]
+
+		// VACUUM [ANALYZE] [table, ...] / ANALYZE [table, ...]
+		case node.GetVacuumStmt() != nil:
+			err := remapper.vacuumOrAnalyzeFromNode(node)
+			if err != nil {
+				return nil, err
+			}
+			statements[i] = NOOP_QUERY_TREE.Stmts[0]
+
+		// PREPARE name [(type, ...)] AS SELECT ...
+		case node.GetPrepareStmt() != nil:
+			err := remapper.prepareStatementFromNode(node, permissions)
+			if err != nil {
+				return nil, err
+			}
+			statements[i] = NOOP_QUERY_TREE.Stmts[0]
+
+		// EXECUTE name [(value, ...)]
+		case node.GetExecuteStmt() != nil:
+			executeStatement, err := remapper.remapExecuteStatement(node)
+			if err != nil {
+				return nil, err
+			}
+			statements[i] = executeStatement
+
+		// DEALLOCATE [PREPARE] name / DEALLOCATE [PREPARE] ALL
+		case node.GetDeallocateStmt() != nil:
+			err := remapper.deallocateStatementFromNode(node)
+			if err != nil {
+				return nil, err
+			}
+			statements[i] = NOOP_QUERY_TREE.Stmts[0]
+
+		// DECLARE name [NO SCROLL] CURSOR [WITH HOLD] FOR SELECT ... -> SELECT ... (remapped), run by the query handler
+		case node.GetDeclareCursorStmt() != nil:
+			selectStatement := node.GetDeclareCursorStmt().Query.GetSelectStmt()
+			if selectStatement == nil {
+				return nil, &PgError{Code: PG_ERROR_CODE_FEATURE_NOT_SUPPORTED, Message: "DECLARE CURSOR supports only SELECT queries"}
+			}
+			remapper.remapSelectStatement(selectStatement, permissions, 1)
+			statements[i] = &pgQuery.RawStmt{Stmt: &pgQuery.Node{Node: &pgQuery.Node_SelectStmt{SelectStmt: selectStatement}}}
+
+		// FETCH / MOVE / CLOSE, handled by the query handler when the statement runs
+		case node.GetFetchStmt() != nil || node.GetClosePortalStmt() != nil:
+			statements[i] = NOOP_QUERY_TREE.Stmts[0]
+
+		// REINDEX ... / CLUSTER ... (no-op)
+		case node.GetReindexStmt() != nil || node.GetClusterStmt() != nil:
+			common.LogInfo(remapper.config.CommonConfig, "Skipping REINDEX/CLUSTER: Iceberg tables don't have indexes")
+			remapper.Session.AddNotice("NOTICE", PG_ERROR_CODE_SUCCESSFUL_COMPLETION, "REINDEX and CLUSTER are ignored, tables don't have indexes")
+			statements[i] = NOOP_QUERY_TREE.Stmts[0]
+
 		// Unsupported query
 		default:
 			common.LogDebug(remapper.config.CommonConfig, "Query tree:", stmt, node)
@@ -187,529 +480,2466 @@ func (remapper *QueryRemapper) remapStatements(statements []*pgQuery.RawStmt, pe
 	return statements, nil
 }
 
-// SET ... (no-op)
-func (remapper *QueryRemapper) remapSetStatement(stmt *pgQuery.RawStmt) *pgQuery.RawStmt {
-	setStatement := stmt.Stmt.GetVariableSetStmt()
+// COPY (SELECT ...) TO STDOUT -> SELECT ..., the query handler sends the rows via the COPY protocol
+func (remapper *QueryRemapper) remapCopyStatement(stmt *pgQuery.RawStmt, permissions *map[string][]string) (*pgQuery.RawStmt, error) {
+	copyStatement := stmt.Stmt.GetCopyStmt()
+
+	if copyStatement.Filename != "" || copyStatement.IsProgram {
+		if copyStatement.IsFrom {
+			return nil, &PgError{
+				Code:    PG_ERROR_CODE_FEATURE_NOT_SUPPORTED,
+				Message: "COPY from a file or a program is not supported",
+				Hint:    "Use COPY ... FROM STDIN or psql's \\copy command.",
+			}
+		}
+		return nil, &PgError{
+			Code:    PG_ERROR_CODE_FEATURE_NOT_SUPPORTED,
+			Message: "COPY to a file or a program is not supported",
+			Hint:    "Use COPY ... TO STDOUT or psql's \\copy command.",
+		}
+	}
 
-	if SUPPORTED_SET_STATEMENTS.Contains(strings.ToLower(setStatement.Name)) {
-		return stmt
+	_, err := remapper.parserCopy.Options(copyStatement)
+	if err != nil {
+		return nil, err
 	}
 
-	if !KNOWN_SET_STATEMENTS.Contains(strings.ToLower(setStatement.Name)) {
-		common.LogWarn(remapper.config.CommonConfig, "Unknown SET ", setStatement.Name, ":", setStatement)
+	var selectStatement *pgQuery.SelectStmt
+	if copyStatement.IsFrom {
+		// COPY table (columns) FROM STDIN -> SELECT columns FROM table LIMIT 0 to validate the columns and get them for loading the rows
+		selectStatement = remapper.parserCopy.MakeSelectStatement(copyStatement)
+		selectStatement.LimitCount = pgQuery.MakeAConstIntNode(0, 0)
+		selectStatement.LimitOption = pgQuery.LimitOption_LIMIT_OPTION_COUNT
+	} else if copyStatement.Query != nil {
+		selectStatement = copyStatement.Query.GetSelectStmt()
+		if selectStatement == nil {
+			return nil, &PgError{Code: PG_ERROR_CODE_FEATURE_NOT_SUPPORTED, Message: "COPY query must be a SELECT"}
+		}
+	} else {
+		selectStatement = remapper.parserCopy.MakeSelectStatement(copyStatement)
 	}
 
-	return NOOP_QUERY_TREE.Stmts[0]
+	remapper.remapSelectStatement(selectStatement, permissions, 1)
+
+	if copyStatement.IsFrom {
+		icebergSchemaTable := remapper.parserCopy.IcebergSchemaTable(copyStatement)
+		if remapper.remapperTable.IcebergMaterlizedSchemaTables.Contains(icebergSchemaTable) { // Reloaded by remapping the table
+			return nil, &PgError{Code: PG_ERROR_CODE_WRONG_OBJECT_TYPE, Message: "cannot copy to materialized view \"" + icebergSchemaTable.Table + "\""}
+		}
+	}
+
+	return &pgQuery.RawStmt{Stmt: &pgQuery.Node{Node: &pgQuery.Node_SelectStmt{SelectStmt: selectStatement}}}, nil
 }
 
-func (remapper *QueryRemapper) remapSelectStatement(selectStatement *pgQuery.SelectStmt, permissions *map[string][]string, indentLevel int) {
-	// SELECT
-	remappedColumnRefs := remapper.remapSelect(selectStatement, permissions, indentLevel) // recursion
+// EXPLAIN (ANALYZE, VERBOSE) SELECT ... -> EXPLAIN (ANALYZE) SELECT ... (remapped)
+func (remapper *QueryRemapper) remapExplainStatement(explainStatement *pgQuery.ExplainStmt, permissions *map[string][]string) error {
+	options, err := remapper.parserExplain.Options(explainStatement)
+	if err != nil {
+		return err
+	}
 
-	// UNION
-	if selectStatement.FromClause == nil && selectStatement.Larg != nil && selectStatement.Rarg != nil {
-		remapper.traceTreeTraversal("UNION left", indentLevel)
-		leftSelectStatement := selectStatement.Larg
-		remapper.remapSelectStatement(leftSelectStatement, permissions, indentLevel+1) // self-recursion
+	selectStatement := explainStatement.Query.GetSelectStmt()
+	if selectStatement == nil {
+		return &PgError{Code: PG_ERROR_CODE_FEATURE_NOT_SUPPORTED, Message: "EXPLAIN supports only SELECT queries"}
+	}
+	remapper.remapSelectStatement(selectStatement, permissions, 1)
+	explainStatement.Options = remapper.parserExplain.MakeDuckdbOptions(options)
+	return nil
+}
 
-		remapper.traceTreeTraversal("UNION right", indentLevel)
-		rightSelectStatement := selectStatement.Rarg
-		remapper.remapSelectStatement(rightSelectStatement, permissions, indentLevel+1) // self-recursion
+// SET ... (no-op)
+func (remapper *QueryRemapper) remapSetStatement(stmt *pgQuery.RawStmt) (*pgQuery.RawStmt, error) {
+	setStatement := stmt.Stmt.GetVariableSetStmt()
+
+	// SET bemidb.trace = on
+	if strings.ToLower(setStatement.Name) == BEMIDB_VAR_TRACE {
+		remapper.Session.TraceEnabled = remapper.isSetStatementEnabled(setStatement)
+		common.LogDebug(remapper.config.CommonConfig, "Session trace enabled:", remapper.Session.TraceEnabled)
+		return NOOP_QUERY_TREE.Stmts[0], nil
 	}
 
-	// WHERE
-	if selectStatement.WhereClause != nil {
-		remapper.traceTreeTraversal("WHERE statements", indentLevel)
+	// SET bemidb.query_stats = on
+	if strings.ToLower(setStatement.Name) == BEMIDB_VAR_QUERY_STATS {
+		remapper.Session.QueryStatsEnabled = remapper.isSetStatementEnabled(setStatement)
+		common.LogDebug(remapper.config.CommonConfig, "Session query stats enabled:", remapper.Session.QueryStatsEnabled)
+		return NOOP_QUERY_TREE.Stmts[0], nil
+	}
 
-		if remapper.removeWhereClause(selectStatement.WhereClause) {
-			selectStatement.WhereClause = nil
-		} else {
-			selectStatement.WhereClause = remapper.remappedExpressions(selectStatement.WhereClause, remappedColumnRefs, permissions, indentLevel) // recursion
-		}
+	// SET bemidb.replan_on_bind = on
+	if strings.ToLower(setStatement.Name) == BEMIDB_VAR_REPLAN_ON_BIND {
+		remapper.Session.ReplanOnBind = remapper.isSetStatementEnabled(setStatement)
+		common.LogDebug(remapper.config.CommonConfig, "Session replan on bind enabled:", remapper.Session.ReplanOnBind)
+		return NOOP_QUERY_TREE.Stmts[0], nil
 	}
 
-	// WITH
-	if selectStatement.WithClause != nil {
-		remapper.traceTreeTraversal("WITH CTE's", indentLevel)
-		for _, cte := range selectStatement.WithClause.Ctes {
-			if cteSelect := cte.GetCommonTableExpr().Ctequery.GetSelectStmt(); cteSelect != nil {
-				remapper.remapSelectStatement(cteSelect, permissions, indentLevel+1) // self-recursion
-			}
+	// SET bemidb.metadata_probes = on
+	if strings.ToLower(setStatement.Name) == BEMIDB_VAR_METADATA_PROBES {
+		remapper.Session.MetadataProbes = remapper.isSetStatementEnabled(setStatement)
+		common.LogDebug(remapper.config.CommonConfig, "Session metadata probes enabled:", remapper.Session.MetadataProbes)
+		return NOOP_QUERY_TREE.Stmts[0], nil
+	}
+
+	// SET bemidb.sample_tables = on
+	if strings.ToLower(setStatement.Name) == BEMIDB_VAR_SAMPLE_TABLES {
+		remapper.Session.SampleTables = remapper.isSetStatementEnabled(setStatement)
+		common.LogDebug(remapper.config.CommonConfig, "Session sample tables enabled:", remapper.Session.SampleTables)
+		return NOOP_QUERY_TREE.Stmts[0], nil
+	}
+
+	// SET bemidb.join_order = off
+	if _, ok := BEMIDB_JOIN_VARS_DUCKDB_SETTINGS[strings.ToLower(setStatement.Name)]; ok {
+		remapper.setJoinVariable(setStatement)
+		return NOOP_QUERY_TREE.Stmts[0], nil
+	}
+
+	// SET bemidb.http_retries = 5
+	if _, ok := BEMIDB_HTTP_VARS_DUCKDB_SETTINGS[strings.ToLower(setStatement.Name)]; ok {
+		err := remapper.setHttpVariable(setStatement)
+		if err != nil {
+			return nil, err
 		}
+		return NOOP_QUERY_TREE.Stmts[0], nil
 	}
 
-	if len(selectStatement.FromClause) > 0 {
-		for i, fromNode := range selectStatement.FromClause {
-			// JOIN
-			if fromNode.GetJoinExpr() != nil {
-				selectStatement.FromClause[i] = remapper.remapJoinExpressions(selectStatement, fromNode, remappedColumnRefs, permissions, indentLevel+1) // recursion
-			}
+	// SET bemidb.max_parallel_downloads = 8
+	if strings.ToLower(setStatement.Name) == BEMIDB_VAR_MAX_PARALLEL_DOWNLOADS {
+		return nil, &PgError{
+			Code:    PG_ERROR_CODE_CANT_CHANGE_RUNTIME_PARAM,
+			Message: "parameter \"" + BEMIDB_VAR_MAX_PARALLEL_DOWNLOADS + "\" cannot be changed without restarting the server",
+			Hint:    "DuckDB threads are shared by all sessions. Set " + ENV_MAX_PARALLEL_DOWNLOADS + " instead.",
+		}
+	}
 
-			// FROM
-			if fromNode.GetRangeVar() != nil {
-				// FROM [TABLE]
-				remapper.traceTreeTraversal("FROM table", indentLevel)
-				selectStatement.FromClause[i] = remapper.remapperTable.RemapTable(fromNode, permissions)
-			} else if fromNode.GetRangeSubselect() != nil {
-				// FROM (SELECT ...)
-				remapper.traceTreeTraversal("FROM subselect", indentLevel)
-				subSelectStatement := fromNode.GetRangeSubselect().Subquery.GetSelectStmt()
-				remapper.remapSelectStatement(subSelectStatement, permissions, indentLevel+1) // self-recursion
-			} else if fromNode.GetRangeFunction() != nil {
-				// FROM PG_FUNCTION()
-				remapper.traceTreeTraversal("FROM function()", indentLevel)
-				remapper.remapperTable.RemapTableFunctionCall(fromNode.GetRangeFunction()) // recursion
-			}
+	// SET bemidb.catalog = candidate
+	if strings.ToLower(setStatement.Name) == BEMIDB_VAR_CATALOG {
+		catalogName, err := remapper.catalogSetting(setStatement)
+		if err != nil {
+			return nil, err
 		}
+		remapper.Session.Catalog = catalogName
+		common.LogDebug(remapper.config.CommonConfig, "Session catalog:", catalogName)
+		return NOOP_QUERY_TREE.Stmts[0], nil
 	}
 
-	// ORDER BY
-	if selectStatement.SortClause != nil {
-		remapper.traceTreeTraversal("ORDER BY statements", indentLevel)
-		for _, sortNode := range selectStatement.SortClause {
-			sortNode.GetSortBy().Node = remapper.remappedExpressions(sortNode.GetSortBy().Node, remappedColumnRefs, permissions, indentLevel) // recursion
+	// SET statement_timeout = '30s'
+	if strings.ToLower(setStatement.Name) == PG_VAR_STATEMENT_TIMEOUT {
+		err := remapper.setStatementTimeout(setStatement)
+		if err != nil {
+			return nil, err
 		}
+		return NOOP_QUERY_TREE.Stmts[0], nil
 	}
 
-	// GROUP BY
-	if selectStatement.GroupClause != nil {
-		remapper.traceTreeTraversal("GROUP BY statements", indentLevel)
-		for i, groupNode := range selectStatement.GroupClause {
-			selectStatement.GroupClause[i] = remapper.remappedExpressions(groupNode, remappedColumnRefs, permissions, indentLevel) // recursion
+	// SET timezone = 'America/New_York'
+	if strings.ToLower(setStatement.Name) == PG_VAR_TIMEZONE {
+		err := remapper.setTimezone(setStatement)
+		if err != nil {
+			return nil, err
 		}
+		return NOOP_QUERY_TREE.Stmts[0], nil
 	}
-}
 
-func (remapper *QueryRemapper) remapJoinExpressions(selectStatement *pgQuery.SelectStmt, node *pgQuery.Node, remappedColumnRefs map[string]string, permissions *map[string][]string, indentLevel int) *pgQuery.Node {
-	remapper.traceTreeTraversal("JOIN left", indentLevel)
-	leftJoinNode := node.GetJoinExpr().Larg
-	if leftJoinNode.GetJoinExpr() != nil {
-		leftJoinNode = remapper.remapJoinExpressions(selectStatement, leftJoinNode, remappedColumnRefs, permissions, indentLevel+1) // self-recursion
-	} else if leftJoinNode.GetRangeVar() != nil {
-		// TABLE
-		remapper.traceTreeTraversal("TABLE left", indentLevel+1)
-		leftJoinNode = remapper.remapperTable.RemapTable(leftJoinNode, permissions)
-	} else if leftJoinNode.GetRangeSubselect() != nil {
-		leftSelectStatement := leftJoinNode.GetRangeSubselect().Subquery.GetSelectStmt()
-		remapper.remapSelectStatement(leftSelectStatement, permissions, indentLevel+1) // parent-recursion
+	// SET search_path = analytics, public
+	if strings.ToLower(setStatement.Name) == PG_VAR_SEARCH_PATH {
+		remapper.setSearchPath(setStatement)
+		return NOOP_QUERY_TREE.Stmts[0], nil
 	}
-	node.GetJoinExpr().Larg = leftJoinNode
 
-	remapper.traceTreeTraversal("JOIN right", indentLevel)
-	rightJoinNode := node.GetJoinExpr().Rarg
-	if rightJoinNode.GetJoinExpr() != nil {
-		rightJoinNode = remapper.remapJoinExpressions(selectStatement, rightJoinNode, remappedColumnRefs, permissions, indentLevel+1) // self-recursion
-	} else if rightJoinNode.GetRangeVar() != nil {
-		// TABLE
-		remapper.traceTreeTraversal("TABLE right", indentLevel+1)
-		rightJoinNode = remapper.remapperTable.RemapTable(rightJoinNode, permissions)
-	} else if rightJoinNode.GetRangeSubselect() != nil {
-		rightSelectStatement := rightJoinNode.GetRangeSubselect().Subquery.GetSelectStmt()
-		remapper.remapSelectStatement(rightSelectStatement, permissions, indentLevel+1) // parent-recursion
+	// SET application_name = 'psql'
+	if strings.ToLower(setStatement.Name) == PG_VAR_APPLICATION_NAME {
+		remapper.Session.ApplicationName = ""
+		if setStatement.Kind == pgQuery.VariableSetKind_VAR_SET_VALUE && len(setStatement.Args) == 1 {
+			remapper.Session.ApplicationName = setStatement.Args[0].GetAConst().GetSval().GetSval()
+		}
 	}
-	node.GetJoinExpr().Rarg = rightJoinNode
 
-	if quals := node.GetJoinExpr().Quals; quals != nil {
-		remapper.traceTreeTraversal("JOIN on", indentLevel)
-		node.GetJoinExpr().Quals = remapper.remappedExpressions(quals, remappedColumnRefs, permissions, indentLevel) // recursion
+	if !KNOWN_SET_STATEMENTS.Contains(strings.ToLower(setStatement.Name)) {
+		common.LogWarn(remapper.config.CommonConfig, "Unknown SET ", setStatement.Name, ":", setStatement)
+		remapper.Session.AddNotice("WARNING", PG_ERROR_CODE_WARNING, "unrecognized configuration parameter \""+setStatement.Name+"\" is ignored")
+	}
 
-		// DuckDB doesn't support non-INNER JOINs with ON clauses that reference columns from outer tables:
-		//   SELECT (
-		//     SELECT 1 AS test FROM (SELECT 1 AS inner_val) LEFT JOIN (SELECT NULL) ON inner_val = *outer_val*
-		//   ) FROM (SELECT 1 AS outer_val)
-		//   > "Non-inner join on correlated columns not supported"
-		//
-		// References:
-		// - https://github.com/duckdb/duckdb/blob/f6ae05d0a23cae549c6f612026eda27130fe1600/src/planner/joinside.cpp#L63
-		// - https://github.com/duckdb/duckdb/discussions/16012
-		if node.GetJoinExpr().Jointype != pgQuery.JoinType_JOIN_INNER {
-			// Change the JOIN type to INNER in some cases like: ON ... = indclass[i] (sent via Postico)
-			if indentLevel > 2 && node.GetJoinExpr().Quals.GetAExpr() != nil && node.GetJoinExpr().Quals.GetAExpr().Rexpr.GetAIndirection() != nil {
-				rightIndirectionColumnRef := node.GetJoinExpr().Quals.GetAExpr().Rexpr.GetAIndirection().Arg.GetColumnRef().Fields[0].GetString_().Sval
-				if rightIndirectionColumnRef == "indclass" {
-					node.GetJoinExpr().Jointype = pgQuery.JoinType_JOIN_INNER
-				}
-			}
+	return NOOP_QUERY_TREE.Stmts[0], nil
+}
+
+// SET bemidb.catalog = primary / candidate -> catalog name
+// RESET bemidb.catalog / SET bemidb.catalog TO DEFAULT -> empty for the active catalog
+func (remapper *QueryRemapper) catalogSetting(setStatement *pgQuery.VariableSetStmt) (string, error) {
+	if setStatement.Kind != pgQuery.VariableSetKind_VAR_SET_VALUE {
+		return "", nil
+	}
+
+	var value string
+	if len(setStatement.Args) == 1 && setStatement.Args[0].GetAConst().GetSval() != nil {
+		value = setStatement.Args[0].GetAConst().GetSval().Sval
+	}
+	if remapper.catalogSwitch == nil || !remapper.catalogSwitch.Has(value) {
+		hint := "Available values: " + CATALOG_PRIMARY + "."
+		if remapper.catalogSwitch != nil {
+			hint = "Available values: " + remapper.catalogSwitch.Names() + "."
+		}
+		return "", &PgError{
+			Code:    PG_ERROR_CODE_INVALID_PARAMETER_VALUE,
+			Message: "invalid value for parameter \"" + BEMIDB_VAR_CATALOG + "\": \"" + value + "\"",
+			Hint:    hint,
 		}
 	}
+	return value, nil
+}
 
-	return node
+// ALTER SYSTEM SET bemidb.catalog = candidate -> switches the active catalog of the server, e.g. after validating a migration
+// ALTER SYSTEM RESET bemidb.catalog -> switches back to the primary catalog
+func (remapper *QueryRemapper) alterSystem(setStatement *pgQuery.VariableSetStmt) error {
+	if strings.ToLower(setStatement.Name) != BEMIDB_VAR_CATALOG {
+		return &PgError{Code: PG_ERROR_CODE_FEATURE_NOT_SUPPORTED, Message: "ALTER SYSTEM is only supported for " + BEMIDB_VAR_CATALOG}
+	}
+	if remapper.config.User != "" && remapper.Session.User != remapper.config.User {
+		return &PgError{Code: PG_ERROR_CODE_INSUFFICIENT_PRIVILEGE, Message: "must be superuser to execute ALTER SYSTEM command"}
+	}
+
+	catalogName, err := remapper.catalogSetting(setStatement)
+	if err != nil {
+		return err
+	}
+	if catalogName == "" {
+		catalogName = CATALOG_PRIMARY
+	}
+	remapper.catalogSwitch.Activate(catalogName)
+	remapper.useSessionCatalog()
+	return nil
 }
 
-func (remapper *QueryRemapper) remappedExpressions(node *pgQuery.Node, remappedColumnRefs map[string]string, permissions *map[string][]string, indentLevel int) *pgQuery.Node {
-	// CASE
-	caseExpression := node.GetCaseExpr()
-	if caseExpression != nil {
-		remapper.remapCaseExpression(caseExpression, remappedColumnRefs, permissions, indentLevel) // recursion
+// Uses the remappers of the catalog set for the session or of the active catalog, which can be switched by other sessions
+func (remapper *QueryRemapper) useSessionCatalog() {
+	if remapper.catalogSwitch == nil {
+		return
 	}
 
-	// OR/AND
-	boolExpr := node.GetBoolExpr()
-	if boolExpr != nil {
-		for i, arg := range boolExpr.Args {
-			boolExpr.Args[i] = remapper.remappedExpressions(arg, remappedColumnRefs, permissions, indentLevel+1) // self-recursion
+	catalogName, catalog := remapper.catalogSwitch.CatalogFor(remapper.Session)
+	if catalogName == remapper.catalogName {
+		return
+	}
+	remapper.remapperTable = catalog.remapperTable
+	remapper.remapperFunction = catalog.remapperFunction
+	remapper.IcebergReader = catalog.icebergReader
+	remapper.IcebergWriter = catalog.icebergWriter
+	remapper.catalogName = catalogName
+}
+
+// SET statement_timeout = 5000 / '5s' / '1min' -> 5s / 1m, the number without a unit is in milliseconds, 0 disables the timeout
+// RESET statement_timeout / SET statement_timeout TO DEFAULT -> server default
+func (remapper *QueryRemapper) setStatementTimeout(setStatement *pgQuery.VariableSetStmt) error {
+	if setStatement.Kind != pgQuery.VariableSetKind_VAR_SET_VALUE {
+		remapper.Session.StatementTimeout = nil
+		return nil
+	}
+
+	var value string
+	if len(setStatement.Args) == 1 {
+		aConst := setStatement.Args[0].GetAConst()
+		if aConst.GetIval() != nil {
+			value = common.IntToString(int(aConst.GetIval().Ival))
+		} else if aConst.GetSval() != nil {
+			value = aConst.GetSval().Sval
 		}
 	}
 
-	// COALESCE(value1, value2, ...)
-	coalesceExpr := node.GetCoalesceExpr()
-	if coalesceExpr != nil {
-		for i, arg := range coalesceExpr.Args {
-			if arg != nil {
-				coalesceExpr.Args[i] = remapper.remappedExpressions(arg, remappedColumnRefs, permissions, indentLevel+1) // self-recursion
-			}
+	timeout, ok := parseStatementTimeout(value)
+	if !ok {
+		return &PgError{
+			Code:    PG_ERROR_CODE_INVALID_PARAMETER_VALUE,
+			Message: "invalid value for parameter \"" + PG_VAR_STATEMENT_TIMEOUT + "\": \"" + value + "\"",
+			Hint:    "Valid units for this parameter are \"us\", \"ms\", \"s\", \"min\", \"h\", and \"d\".",
 		}
 	}
 
-	// Nested SELECT
-	subLink := node.GetSubLink()
-	if subLink != nil {
-		subSelect := subLink.Subselect.GetSelectStmt()
-		remapper.remapSelectStatement(subSelect, permissions, indentLevel+1) // recursion
+	remapper.Session.StatementTimeout = &timeout
+	common.LogDebug(remapper.config.CommonConfig, "Session statement timeout:", timeout)
+	return nil
+}
+
+// SET timezone = 'america/new_york' -> TimeZone = 'America/New_York' (full time zone names known to ICU, matched case-insensitively)
+// RESET timezone / SET timezone TO DEFAULT / SET TIME ZONE LOCAL -> UTC
+func (remapper *QueryRemapper) setTimezone(setStatement *pgQuery.VariableSetStmt) error {
+	delete(remapper.Session.DuckdbSettings, DUCKDB_SETTING_TIMEZONE)
+	remapper.Session.TimeZone = nil
+	if setStatement.Kind != pgQuery.VariableSetKind_VAR_SET_VALUE {
+		common.LogDebug(remapper.config.CommonConfig, "Session DuckDB settings:", remapper.Session.DuckdbSettings)
+		return nil
 	}
 
-	// Operator: =, ?, etc.
-	aExpr := node.GetAExpr()
-	if aExpr != nil {
-		node = remapper.remapperExpression.RemappedExpression(node)
-		if aExpr.Lexpr != nil {
-			aExpr.Lexpr = remapper.remappedExpressions(aExpr.Lexpr, remappedColumnRefs, permissions, indentLevel+1) // self-recursion
-		}
-		if aExpr.Rexpr != nil {
-			aExpr.Rexpr = remapper.remappedExpressions(aExpr.Rexpr, remappedColumnRefs, permissions, indentLevel+1) // self-recursion
+	var value string
+	if len(setStatement.Args) == 1 { // Numeric offsets and intervals (SET TIME ZONE -5) aren't supported by DuckDB
+		aConst := setStatement.Args[0].GetAConst()
+		if aConst.GetIval() != nil {
+			value = common.IntToString(int(aConst.GetIval().Ival))
+		} else {
+			value = aConst.GetSval().GetSval()
 		}
 	}
 
-	// IS NULL
-	nullTest := node.GetNullTest()
-	if nullTest != nil {
-		nullTest.Arg = remapper.remappedExpressions(nullTest.Arg, remappedColumnRefs, permissions, indentLevel+1) // self-recursion
+	timezone := value
+	if duckdbClient := remapper.remapperTable.ServerDuckdbClient; duckdbClient != nil && value != "" {
+		err := duckdbClient.QueryRowContext(context.Background(), "SELECT name FROM pg_timezone_names() WHERE lower(name) = lower('$name') ORDER BY name = '$name' DESC LIMIT 1", map[string]string{"name": value}).Scan(&timezone)
+		if errors.Is(err, sql.ErrNoRows) {
+			timezone = ""
+		} else if err != nil {
+			return err
+		}
+	}
+	location, err := time.LoadLocation(timezone)
+	if timezone == "" || err != nil {
+		return &PgError{
+			Code:    PG_ERROR_CODE_INVALID_PARAMETER_VALUE,
+			Message: "invalid value for parameter \"TimeZone\": \"" + value + "\"",
+			Hint:    "Use a full time zone name such as \"America/New_York\" from pg_timezone_names.",
+		}
 	}
 
-	// IN
-	list := node.GetList()
-	if list != nil {
-		for i, item := range list.Items {
-			if item != nil {
-				list.Items[i] = remapper.remapperExpression.RemappedExpression(item)
+	remapper.Session.DuckdbSettings[DUCKDB_SETTING_TIMEZONE] = quoteSqlString(timezone)
+	remapper.Session.TimeZone = location
+	common.LogDebug(remapper.config.CommonConfig, "Session DuckDB settings:", remapper.Session.DuckdbSettings)
+	return nil
+}
+
+// SET search_path = analytics, "$user", public -> ["analytics", "$user", "public"]
+// RESET search_path / SET search_path TO DEFAULT -> "$user", public
+func (remapper *QueryRemapper) setSearchPath(setStatement *pgQuery.VariableSetStmt) {
+	remapper.Session.SearchPath = nil
+	if setStatement.Kind == pgQuery.VariableSetKind_VAR_SET_VALUE {
+		remapper.Session.SearchPath = []string{}
+		for _, arg := range setStatement.Args {
+			for _, schema := range strings.Split(arg.GetAConst().GetSval().GetSval(), ",") { // SET search_path = 'analytics, public'
+				schema = strings.Trim(strings.TrimSpace(schema), "\"")
+				if schema != "" {
+					remapper.Session.SearchPath = append(remapper.Session.SearchPath, schema)
+				}
 			}
 		}
 	}
+	common.LogDebug(remapper.config.CommonConfig, "Session search path:", remapper.Session.SearchPath)
+}
 
-	// FUNCTION(...)
-	functionCall := node.GetFuncCall()
-	if functionCall != nil {
-		remapper.remapperFunction.RemapFunctionCall(functionCall)
-		remapper.remapperFunction.RemapNestedFunctionCalls(functionCall) // recursion
+// SHOW search_path -> "$user", public
+func (remapper *QueryRemapper) searchPathSetting() string {
+	quotedSchemas := make([]string, len(remapper.Session.SearchPath))
+	for i, schema := range remapper.Session.SearchPath {
+		quotedSchemas[i] = schema
+		if schema == PG_SEARCH_PATH_USER {
+			quotedSchemas[i] = "\"" + schema + "\""
+		}
+	}
+	return strings.Join(quotedSchemas, ", ")
+}
 
-		for i, arg := range functionCall.Args {
-			if arg != nil {
-				functionCall.Args[i] = remapper.remappedExpressions(arg, remappedColumnRefs, permissions, indentLevel+1) // self-recursion
-			}
+// FROM table -> FROM schema.table table with the first schema of SET search_path that has the table,
+// unchanged without a session search path or if no schema has the table (public is used)
+func (remapper *QueryRemapper) resolveSearchPath(node *pgQuery.Node) {
+	rangeVar := node.GetRangeVar()
+	qSchemaTable := remapper.resolveQuerySchemaTable(remapper.remapperTable.parserTable.NodeToQuerySchemaTable(node))
+	if qSchemaTable.Schema != rangeVar.Schemaname {
+		rangeVar.Schemaname = qSchemaTable.Schema
+		if rangeVar.Alias == nil {
+			rangeVar.Alias = &pgQuery.Alias{Aliasname: qSchemaTable.Table} // Columns are referenced by the table name without the schema
 		}
+	}
+}
 
-		if functionCall.AggFilter != nil && functionCall.AggFilter.GetNullTest() != nil {
-			functionCall.AggFilter.GetNullTest().Arg = remapper.remappedExpressions(functionCall.AggFilter.GetNullTest().Arg, remappedColumnRefs, permissions, indentLevel+1) // self-recursion
+func (remapper *QueryRemapper) resolveQuerySchemaTable(qSchemaTable QuerySchemaTable) QuerySchemaTable {
+	if qSchemaTable.Schema != "" || remapper.Session.SearchPath == nil || remapper.remapperTable.isTableFromPgCatalog(qSchemaTable) {
+		return qSchemaTable
+	}
+
+	schemas := make([]string, 0, len(remapper.Session.SearchPath))
+	for _, schema := range remapper.Session.SearchPath {
+		switch schema {
+		case PG_SEARCH_PATH_USER:
+			schemas = append(schemas, remapper.Session.User)
+		case PG_SCHEMA_PG_CATALOG, PG_SEARCH_PATH_TEMP: // Searched before other schemas
+		default:
+			schemas = append(schemas, schema)
 		}
 	}
 
-	// (FUNCTION()).n
-	indirectionFunctionCall := node.GetAIndirection()
-	if indirectionFunctionCall != nil {
-		functionCall := indirectionFunctionCall.Arg.GetFuncCall()
-		if functionCall != nil {
-			remapper.remapperFunction.RemapFunctionCall(functionCall)
-			remapper.remapperFunction.RemapNestedFunctionCalls(functionCall) // recursion
+	if schema := remapper.remapperTable.SearchPathSchema(qSchemaTable.Table, schemas, remapper.visibleSchemas()); schema != "" {
+		qSchemaTable.Schema = schema
+	}
+	return qSchemaTable
+}
+
+// SET bemidb.join_order = off -> disabled_optimizers = 'join_order,build_side_probe_side' (joins run in the written order, the right side builds the hash table)
+// SET bemidb.prefer_range_joins = on -> prefer_range_joins = true
+// SET bemidb.merge_join_threshold = 0 -> merge_join_threshold = 0
+// RESET bemidb.join_order / SET bemidb.join_order = on -> DuckDB default
+func (remapper *QueryRemapper) setJoinVariable(setStatement *pgQuery.VariableSetStmt) {
+	name := strings.ToLower(setStatement.Name)
+	duckdbSetting := BEMIDB_JOIN_VARS_DUCKDB_SETTINGS[name]
+	delete(remapper.Session.DuckdbSettings, duckdbSetting)
+
+	switch name {
+	case BEMIDB_VAR_JOIN_ORDER:
+		if setStatement.Kind == pgQuery.VariableSetKind_VAR_SET_VALUE && !remapper.isSetStatementEnabled(setStatement) {
+			remapper.Session.DuckdbSettings[duckdbSetting] = "'join_order,build_side_probe_side'"
+		}
+	case BEMIDB_VAR_PREFER_RANGE_JOINS:
+		if remapper.isSetStatementEnabled(setStatement) {
+			remapper.Session.DuckdbSettings[duckdbSetting] = "true"
+		}
+	default:
+		if setStatement.Kind == pgQuery.VariableSetKind_VAR_SET_VALUE && len(setStatement.Args) == 1 && setStatement.Args[0].GetAConst().GetIval() != nil {
+			remapper.Session.DuckdbSettings[duckdbSetting] = common.IntToString(int(setStatement.Args[0].GetAConst().GetIval().Ival))
 		}
 	}
+	common.LogDebug(remapper.config.CommonConfig, "Session DuckDB settings:", remapper.Session.DuckdbSettings)
+}
 
-	// [column]
-	columnRef := node.GetColumnRef()
-	if columnRef != nil {
-		if len(columnRef.Fields) == 1 && columnRef.Fields[0].GetString_() != nil {
-			remappedField, ok := remappedColumnRefs[columnRef.Fields[0].GetString_().Sval]
-			if ok {
-				columnRef.Fields[0] = pgQuery.MakeStrNode(remappedField)
-			}
+// SET bemidb.http_retries = 5 -> http_retries = 5
+// SET bemidb.http_retry_wait_ms = 500 -> http_retry_wait_ms = 500
+// SET bemidb.http_timeout = 60 -> http_timeout = 60 (seconds)
+// RESET bemidb.http_retries / SET bemidb.http_retries TO DEFAULT -> server default
+func (remapper *QueryRemapper) setHttpVariable(setStatement *pgQuery.VariableSetStmt) error {
+	name := strings.ToLower(setStatement.Name)
+	duckdbSetting := BEMIDB_HTTP_VARS_DUCKDB_SETTINGS[name]
+
+	if setStatement.Kind != pgQuery.VariableSetKind_VAR_SET_VALUE {
+		delete(remapper.Session.DuckdbSettings, duckdbSetting)
+		common.LogDebug(remapper.config.CommonConfig, "Session DuckDB settings:", remapper.Session.DuckdbSettings)
+		return nil
+	}
+
+	if len(setStatement.Args) != 1 || setStatement.Args[0].GetAConst().GetIval() == nil || setStatement.Args[0].GetAConst().GetIval().Ival < 0 {
+		value := ""
+		if len(setStatement.Args) == 1 {
+			value = setStatement.Args[0].GetAConst().GetSval().GetSval()
+		}
+		return &PgError{
+			Code:    PG_ERROR_CODE_INVALID_PARAMETER_VALUE,
+			Message: "invalid value for parameter \"" + name + "\": \"" + value + "\"",
+			Hint:    "Use a non-negative integer.",
 		}
 	}
 
-	return remapper.remapperExpression.RemappedExpression(node)
+	remapper.Session.DuckdbSettings[duckdbSetting] = common.IntToString(int(setStatement.Args[0].GetAConst().GetIval().Ival))
+	common.LogDebug(remapper.config.CommonConfig, "Session DuckDB settings:", remapper.Session.DuckdbSettings)
+	return nil
 }
 
-// CASE ...
-func (remapper *QueryRemapper) remapCaseExpression(caseExpr *pgQuery.CaseExpr, remappedColumnRefs map[string]string, permissions *map[string][]string, indentLevel int) {
-	for _, when := range caseExpr.Args {
-		if whenClause := when.GetCaseWhen(); whenClause != nil {
-			// WHEN ...
-			if whenClause.Expr != nil {
-				whenClause.Expr = remapper.remappedExpressions(whenClause.Expr, remappedColumnRefs, permissions, indentLevel+1) // recursion
+// SET ... = on/true/yes/1 -> true, RESET ... / SET ... TO DEFAULT / other values -> false
+func (remapper *QueryRemapper) isSetStatementEnabled(setStatement *pgQuery.VariableSetStmt) bool {
+	if setStatement.Kind != pgQuery.VariableSetKind_VAR_SET_VALUE || len(setStatement.Args) != 1 {
+		return false
+	}
+
+	aConst := setStatement.Args[0].GetAConst()
+	if aConst == nil {
+		return false
+	}
+	if aConst.GetIval() != nil {
+		return aConst.GetIval().Ival == 1
+	}
+	if aConst.GetSval() != nil {
+		switch strings.ToLower(aConst.GetSval().Sval) {
+		case "on", "true", "yes", "1":
+			return true
+		}
+	}
+	return false
+}
+
+func (remapper *QueryRemapper) remapSelectStatement(selectStatement *pgQuery.SelectStmt, permissions *map[string][]string, indentLevel int) {
+	// SELECT
+	remappedColumnRefs := remapper.remapSelect(selectStatement, permissions, indentLevel) // recursion
+
+	// UNION
+	if selectStatement.FromClause == nil && selectStatement.Larg != nil && selectStatement.Rarg != nil {
+		remapper.traceTreeTraversal("UNION left", indentLevel)
+		leftSelectStatement := selectStatement.Larg
+		remapper.remapSelectStatement(leftSelectStatement, permissions, indentLevel+1) // self-recursion
+
+		remapper.traceTreeTraversal("UNION right", indentLevel)
+		rightSelectStatement := selectStatement.Rarg
+		remapper.remapSelectStatement(rightSelectStatement, permissions, indentLevel+1) // self-recursion
+	}
+
+	// FOR UPDATE/FOR NO KEY UPDATE/FOR SHARE/FOR KEY SHARE
+	if selectStatement.LockingClause != nil {
+		// DuckDB doesn't support row-level locks, and the data is read-only anyway
+		remapper.traceTreeTraversal("Locking clause (removed)", indentLevel)
+		remapper.Session.AddNotice("NOTICE", PG_ERROR_CODE_SUCCESSFUL_COMPLETION, "locking clause is ignored, rows are not locked")
+		selectStatement.LockingClause = nil
+	}
+
+	// WHERE
+	if selectStatement.WhereClause != nil {
+		remapper.traceTreeTraversal("WHERE statements", indentLevel)
+
+		if remapper.removeWhereClause(selectStatement.WhereClause) {
+			selectStatement.WhereClause = nil
+		} else {
+			selectStatement.WhereClause = remapper.remappedExpressions(selectStatement.WhereClause, remappedColumnRefs, permissions, indentLevel) // recursion
+		}
+	}
+
+	// WITH
+	if selectStatement.WithClause != nil {
+		remapper.traceTreeTraversal("WITH CTE's", indentLevel)
+		for _, cte := range selectStatement.WithClause.Ctes {
+			if cteSelect := cte.GetCommonTableExpr().Ctequery.GetSelectStmt(); cteSelect != nil {
+				remapper.remapSelectStatement(cteSelect, permissions, indentLevel+1) // self-recursion
 			}
+		}
+	}
 
-			// THEN ...
-			if whenClause.Result != nil {
-				whenClause.Result = remapper.remappedExpressions(whenClause.Result, remappedColumnRefs, permissions, indentLevel+1) // recursion
+	if len(selectStatement.FromClause) > 0 {
+		for i, fromNode := range selectStatement.FromClause {
+			// JOIN
+			if fromNode.GetJoinExpr() != nil {
+				selectStatement.FromClause[i] = remapper.remapJoinExpressions(selectStatement, fromNode, remappedColumnRefs, permissions, indentLevel+1) // recursion
+			}
+
+			// FROM
+			if fromNode.GetRangeVar() != nil {
+				// FROM [TABLE]
+				remapper.traceTreeTraversal("FROM table", indentLevel)
+				if probeNode := remapper.remapMetadataProbe(selectStatement, fromNode, permissions); probeNode != nil {
+					selectStatement.FromClause[i] = probeNode
+				} else {
+					selectStatement.FromClause[i] = remapper.remapTable(fromNode, permissions)
+				}
+			} else if fromNode.GetRangeSubselect() != nil {
+				// FROM (SELECT ...)
+				remapper.traceTreeTraversal("FROM subselect", indentLevel)
+				subSelectStatement := fromNode.GetRangeSubselect().Subquery.GetSelectStmt()
+				remapper.remapSelectStatement(subSelectStatement, permissions, indentLevel+1) // self-recursion
+			} else if fromNode.GetRangeFunction() != nil {
+				if sampleNode := remapper.remapSampleFunction(fromNode.GetRangeFunction(), permissions); sampleNode != nil {
+					// FROM bemidb_sample('table')
+					remapper.traceTreeTraversal("FROM bemidb_sample()", indentLevel)
+					selectStatement.FromClause[i] = sampleNode
+				} else {
+					// FROM PG_FUNCTION()
+					remapper.traceTreeTraversal("FROM function()", indentLevel)
+					remapper.remapperTable.RemapTableFunctionCall(fromNode.GetRangeFunction()) // recursion
+				}
 			}
 		}
 	}
 
-	// ELSE ...
-	if caseExpr.Defresult != nil {
-		caseExpr.Defresult = remapper.remappedExpressions(caseExpr.Defresult, remappedColumnRefs, permissions, indentLevel+1) // recursion
+	// ORDER BY
+	if selectStatement.SortClause != nil {
+		remapper.traceTreeTraversal("ORDER BY statements", indentLevel)
+		for _, sortNode := range selectStatement.SortClause {
+			sortNode.GetSortBy().Node = remapper.remappedExpressions(sortNode.GetSortBy().Node, remappedColumnRefs, permissions, indentLevel) // recursion
+		}
+		remapper.remapperSelect.RemapSortClause(selectStatement.SortClause)
+	}
+
+	// WINDOW w AS (... ORDER BY ...)
+	for _, windowNode := range selectStatement.WindowClause {
+		remapper.remapperSelect.RemapSortClause(windowNode.GetWindowDef().OrderClause)
+	}
+
+	// GROUP BY
+	if selectStatement.GroupClause != nil {
+		remapper.traceTreeTraversal("GROUP BY statements", indentLevel)
+		for i, groupNode := range selectStatement.GroupClause {
+			selectStatement.GroupClause[i] = remapper.remappedExpressions(groupNode, remappedColumnRefs, permissions, indentLevel) // recursion
+		}
+	}
+
+	// FETCH FIRST n ROWS WITH TIES
+	err := remapper.remapperSelect.RemapFetchWithTies(selectStatement)
+	if err != nil && remapper.remapError == nil {
+		remapper.remapError = err
 	}
 }
 
-// SELECT ...
-func (remapper *QueryRemapper) remapSelect(selectStatement *pgQuery.SelectStmt, permissions *map[string][]string, indentLevel int) map[string]string {
-	remapper.traceTreeTraversal("SELECT statements", indentLevel)
-	remappedColumnRefs := make(map[string]string)
+// FROM / JOIN [TABLE], temp tables of the session are read from its DuckDB schema,
+// and tables are read from their samples with SET bemidb.sample_tables = on
+func (remapper *QueryRemapper) remapTable(node *pgQuery.Node, permissions *map[string][]string) *pgQuery.Node {
+	return remapper.remapTableOrSample(node, permissions, remapper.Session.SampleTables)
+}
 
-	// SELECT ...
-	for targetNodeIdx, targetNode := range selectStatement.TargetList {
-		targetNode, remappedColRefs := remapper.remapperSelect.RemapTargetName(targetNode)
-		for previousName, newName := range remappedColRefs {
-			remappedColumnRefs[previousName] = newName
+func (remapper *QueryRemapper) remapTableOrSample(node *pgQuery.Node, permissions *map[string][]string, readSample bool) *pgQuery.Node {
+	if remapper.tempTables.RemapTable(remapper.Session, node.GetRangeVar()) {
+		return node
+	}
+	// pg_shadow -> password verifiers are readable only by the superuser, e.g. for PgBouncer's auth_query
+	if qSchemaTable := remapper.remapperTable.parserTable.NodeToQuerySchemaTable(node); qSchemaTable.Table == PG_TABLE_PG_SHADOW && remapper.remapperTable.isTableFromPgCatalog(qSchemaTable) && !remapper.config.IsSuperuser(remapper.Session.User) {
+		return remapper.remapperTable.parserTable.MakePgShadowWithoutPasswordsNode(qSchemaTable)
+	}
+	remapper.resolveSearchPath(node)
+	if viewNode := remapper.remapView(node, permissions); viewNode != nil {
+		return viewNode
+	}
+	if readSample {
+		if sampleNode := remapper.remapperTable.RemapSampleTable(node, permissions, remapper.config.RowFiltersFor(remapper.Session.User), remapper.visibleSchemas()); sampleNode != nil {
+			if permissions != nil {
+				remapper.noticePermittedColumns(node, permissions)
+			}
+			return sampleNode
+		}
+	}
+	err := remapper.remapperTable.RefreshSystemTable(node)
+	if err != nil {
+		if remapper.remapError == nil {
+			remapper.remapError = fmt.Errorf("couldn't refresh system table: %w", err)
 		}
+		return node
+	}
+	// bemidb.connection_log -> connections of other users are readable only by the superuser
+	if qSchemaTable := remapper.remapperTable.parserTable.NodeToQuerySchemaTable(node); qSchemaTable.Schema == BEMIDB_SCHEMA && qSchemaTable.Table == BEMIDB_TABLE_CONNECTION_LOG && !remapper.config.IsSuperuser(remapper.Session.User) {
+		return remapper.remapperTable.parserTable.MakeConnectionLogForUserNode(qSchemaTable, remapper.Session.User)
+	}
+	if brokenTable, ok := remapper.remapperTable.BrokenTable(node); ok {
+		if remapper.remapError == nil {
+			remapper.remapError = &PgError{
+				Code:    PG_ERROR_CODE_DATA_CORRUPTED,
+				Message: "table " + brokenTable.IcebergSchemaTable.String() + " is broken: " + brokenTable.Problem,
+				Hint:    "The table is listed in " + BEMIDB_SCHEMA + "." + BEMIDB_TABLE_BROKEN_TABLES + " until the next catalog check finds it readable.",
+			}
+		}
+		return node
+	}
+	tableNode := remapper.remapperTable.RemapTable(node, permissions, remapper.config.RowFiltersFor(remapper.Session.User), remapper.visibleSchemas())
+	if permissions != nil && tableNode != node {
+		remapper.noticePermittedColumns(node, permissions)
+	}
+	return tableNode
+}
 
-		targetNode = remapper.remapperSelect.SetTargetNameIfEmpty(targetNode)
+// FROM bemidb_sample('schema.table') alias -> FROM schema.table alias, read from its sample even without SET bemidb.sample_tables = on.
+// Returns nil if the function isn't bemidb_sample()
+func (remapper *QueryRemapper) remapSampleFunction(rangeFunction *pgQuery.RangeFunction, permissions *map[string][]string) *pgQuery.Node {
+	schemaFunction := remapper.remapperTable.parserTable.TopLevelSchemaFunction(rangeFunction)
+	if schemaFunction == nil || schemaFunction.Function != SAMPLE_TABLES_FUNCTION || (schemaFunction.Schema != "" && schemaFunction.Schema != PG_SCHEMA_PUBLIC) {
+		return nil
+	}
+
+	functionCall := rangeFunction.Functions[0].GetList().Items[0].GetFuncCall()
+	if len(rangeFunction.Functions) != 1 || len(functionCall.Args) != 1 || functionCall.Args[0].GetAConst().GetSval() == nil {
+		if remapper.remapError == nil {
+			remapper.remapError = &PgError{Code: PG_ERROR_CODE_INVALID_PARAMETER_VALUE, Message: SAMPLE_TABLES_FUNCTION + "() expects a table name, e.g. " + SAMPLE_TABLES_FUNCTION + "('public.users')"}
+		}
+		return nil
+	}
+
+	tableName := functionCall.Args[0].GetAConst().GetSval().Sval
+	qSchemaTable := NewQuerySchemaTableFromString(tableName)
+	icebergSchemaTable := remapper.resolveQuerySchemaTable(qSchemaTable).ToIcebergSchemaTable()
+	visibleSchemas := remapper.visibleSchemas()
+	if (visibleSchemas != nil && !visibleSchemas.Contains(icebergSchemaTable.Schema)) || !remapper.remapperTable.IsIcebergTableOrView(icebergSchemaTable) {
+		if remapper.remapError == nil {
+			remapper.remapError = &PgError{Code: PG_ERROR_CODE_UNDEFINED_TABLE, Message: "relation \"" + tableName + "\" does not exist"}
+		}
+		return nil
+	}
+
+	alias := remapper.remapperTable.parserTable.Alias(rangeFunction)
+	if alias == "" {
+		alias = qSchemaTable.Table
+	}
+	tableNode := pgQuery.MakeFullRangeVarNode(qSchemaTable.Schema, qSchemaTable.Table, alias, functionCall.Location)
+	return remapper.remapTableOrSample(tableNode, permissions, true)
+}
+
+// FROM table the user can't read -> WARNING, FROM table with some permitted columns -> NOTICE,
+// the table is read without rows or without the other columns instead of failing the query
+func (remapper *QueryRemapper) noticePermittedColumns(node *pgQuery.Node, permissions *map[string][]string) {
+	parser := remapper.remapperTable.parserTable
+	qSchemaTable := parser.NodeToQuerySchemaTable(node)
+	if parser.IsTableFromInformationSchema(qSchemaTable) {
+		return
+	}
+
+	icebergSchemaTable := qSchemaTable.ToIcebergSchemaTable()
+	columnNames, allowed := parser.permittedColumnNames(permissions, icebergSchemaTable)
+	if !allowed {
+		remapper.Session.AddNotice("WARNING", PG_ERROR_CODE_INSUFFICIENT_PRIVILEGE, "permission denied for table "+icebergSchemaTable.String()+", no rows are returned")
+	} else if !slices.Contains(columnNames, PERMISSIONS_WILDCARD) {
+		remapper.Session.AddNotice("NOTICE", PG_ERROR_CODE_SUCCESSFUL_COMPLETION, "only columns "+strings.Join(columnNames, ", ")+" of table "+icebergSchemaTable.String()+" are returned")
+	}
+}
+
+// FROM view -> FROM (SELECT ...) view, the definition is remapped with the permissions of the querying user,
+// nil if the table isn't a view created with CREATE VIEW
+func (remapper *QueryRemapper) remapView(node *pgQuery.Node, permissions *map[string][]string) *pgQuery.Node {
+	qSchemaTable := remapper.remapperTable.parserTable.NodeToQuerySchemaTable(node)
+	definition, ok := remapper.remapperTable.ViewDefinition(qSchemaTable, remapper.visibleSchemas())
+	if !ok {
+		return nil
+	}
+	if unsyncedSchemaTables := remapper.remapperTable.UnsyncedViewTables(definition); len(unsyncedSchemaTables) > 0 && remapper.remapError == nil {
+		unsyncedTableNames := make([]string, len(unsyncedSchemaTables))
+		for i, unsyncedSchemaTable := range unsyncedSchemaTables {
+			unsyncedTableNames[i] = unsyncedSchemaTable.ToArg()
+		}
+		remapper.remapError = &PgError{
+			Code:    PG_ERROR_CODE_UNDEFINED_TABLE,
+			Message: "relation \"" + unsyncedTableNames[0] + "\" does not exist",
+			Detail:  "View " + qSchemaTable.ToIcebergSchemaTable().ToArg() + " reads tables that aren't synced yet: " + strings.Join(unsyncedTableNames, ", ") + ".",
+		}
+	}
+
+	queryTree, err := pgQuery.Parse(definition)
+	common.PanicIfError(remapper.config.CommonConfig, err)
+	selectStatement := queryTree.Stmts[0].Stmt.GetSelectStmt()
+	remapper.remapSelectStatement(selectStatement, permissions, 1)
+	return remapper.remapperTable.parserTable.MakeViewNode(selectStatement, qSchemaTable)
+}
+
+// SELECT 1 FROM table LIMIT 1 -> SELECT 1 FROM (SELECT NULL FROM range(1)) table with SET bemidb.metadata_probes = on,
+// nil if the query reads the rows of the table
+func (remapper *QueryRemapper) remapMetadataProbe(selectStatement *pgQuery.SelectStmt, node *pgQuery.Node, permissions *map[string][]string) *pgQuery.Node {
+	if !remapper.Session.MetadataProbes || remapper.tempTables.IsTempTable(remapper.Session, node.GetRangeVar()) {
+		return nil
+	}
+	remapper.resolveSearchPath(node)
+	limit, ok := remapper.remapperSelect.MetadataProbeLimit(selectStatement)
+	if !ok {
+		return nil
+	}
+	return remapper.remapperTable.RemapMetadataProbe(node, permissions, remapper.config.RowFiltersFor(remapper.Session.User), remapper.visibleSchemas(), limit)
+}
+
+func (remapper *QueryRemapper) remapJoinExpressions(selectStatement *pgQuery.SelectStmt, node *pgQuery.Node, remappedColumnRefs map[string]string, permissions *map[string][]string, indentLevel int) *pgQuery.Node {
+	remapper.traceTreeTraversal("JOIN left", indentLevel)
+	leftJoinNode := node.GetJoinExpr().Larg
+	if leftJoinNode.GetJoinExpr() != nil {
+		leftJoinNode = remapper.remapJoinExpressions(selectStatement, leftJoinNode, remappedColumnRefs, permissions, indentLevel+1) // self-recursion
+	} else if leftJoinNode.GetRangeVar() != nil {
+		// TABLE
+		remapper.traceTreeTraversal("TABLE left", indentLevel+1)
+		leftJoinNode = remapper.remapTable(leftJoinNode, permissions)
+	} else if leftJoinNode.GetRangeSubselect() != nil {
+		leftSelectStatement := leftJoinNode.GetRangeSubselect().Subquery.GetSelectStmt()
+		remapper.remapSelectStatement(leftSelectStatement, permissions, indentLevel+1) // parent-recursion
+	}
+	node.GetJoinExpr().Larg = leftJoinNode
+
+	remapper.traceTreeTraversal("JOIN right", indentLevel)
+	rightJoinNode := node.GetJoinExpr().Rarg
+	if rightJoinNode.GetJoinExpr() != nil {
+		rightJoinNode = remapper.remapJoinExpressions(selectStatement, rightJoinNode, remappedColumnRefs, permissions, indentLevel+1) // self-recursion
+	} else if rightJoinNode.GetRangeVar() != nil {
+		// TABLE
+		remapper.traceTreeTraversal("TABLE right", indentLevel+1)
+		rightJoinNode = remapper.remapTable(rightJoinNode, permissions)
+	} else if rightJoinNode.GetRangeSubselect() != nil {
+		rightSelectStatement := rightJoinNode.GetRangeSubselect().Subquery.GetSelectStmt()
+		remapper.remapSelectStatement(rightSelectStatement, permissions, indentLevel+1) // parent-recursion
+	}
+	node.GetJoinExpr().Rarg = rightJoinNode
+
+	if quals := node.GetJoinExpr().Quals; quals != nil {
+		remapper.traceTreeTraversal("JOIN on", indentLevel)
+		node.GetJoinExpr().Quals = remapper.remappedExpressions(quals, remappedColumnRefs, permissions, indentLevel) // recursion
+
+		// DuckDB doesn't support non-INNER JOINs with ON clauses that reference columns from outer tables:
+		//   SELECT (
+		//     SELECT 1 AS test FROM (SELECT 1 AS inner_val) LEFT JOIN (SELECT NULL) ON inner_val = *outer_val*
+		//   ) FROM (SELECT 1 AS outer_val)
+		//   > "Non-inner join on correlated columns not supported"
+		//
+		// References:
+		// - https://github.com/duckdb/duckdb/blob/f6ae05d0a23cae549c6f612026eda27130fe1600/src/planner/joinside.cpp#L63
+		// - https://github.com/duckdb/duckdb/discussions/16012
+		if node.GetJoinExpr().Jointype != pgQuery.JoinType_JOIN_INNER {
+			// Change the JOIN type to INNER in some cases like: ON ... = indclass[i] (sent via Postico)
+			if indentLevel > 2 && node.GetJoinExpr().Quals.GetAExpr() != nil && node.GetJoinExpr().Quals.GetAExpr().Rexpr.GetAIndirection() != nil {
+				rightIndirectionColumnRef := node.GetJoinExpr().Quals.GetAExpr().Rexpr.GetAIndirection().Arg.GetColumnRef().Fields[0].GetString_().Sval
+				if rightIndirectionColumnRef == "indclass" {
+					node.GetJoinExpr().Jointype = pgQuery.JoinType_JOIN_INNER
+				}
+			}
+		}
+	}
+
+	return node
+}
+
+func (remapper *QueryRemapper) remappedExpressions(node *pgQuery.Node, remappedColumnRefs map[string]string, permissions *map[string][]string, indentLevel int) *pgQuery.Node {
+	// CASE
+	caseExpression := node.GetCaseExpr()
+	if caseExpression != nil {
+		remapper.remapCaseExpression(caseExpression, remappedColumnRefs, permissions, indentLevel) // recursion
+	}
+
+	// OR/AND
+	boolExpr := node.GetBoolExpr()
+	if boolExpr != nil {
+		for i, arg := range boolExpr.Args {
+			boolExpr.Args[i] = remapper.remappedExpressions(arg, remappedColumnRefs, permissions, indentLevel+1) // self-recursion
+		}
+	}
+
+	// COALESCE(value1, value2, ...)
+	coalesceExpr := node.GetCoalesceExpr()
+	if coalesceExpr != nil {
+		for i, arg := range coalesceExpr.Args {
+			if arg != nil {
+				coalesceExpr.Args[i] = remapper.remappedExpressions(arg, remappedColumnRefs, permissions, indentLevel+1) // self-recursion
+			}
+		}
+	}
+
+	// Nested SELECT
+	subLink := node.GetSubLink()
+	if subLink != nil {
+		subSelect := subLink.Subselect.GetSelectStmt()
+		if subLink.SubLinkType == pgQuery.SubLinkType_EXISTS_SUBLINK && remapper.Session.MetadataProbes {
+			remapper.remapperSelect.RemapExistsProbe(subSelect)
+		}
+		remapper.remapSelectStatement(subSelect, permissions, indentLevel+1) // recursion
+	}
+
+	// Operator: =, ?, etc.
+	aExpr := node.GetAExpr()
+	if aExpr != nil {
+		node = remapper.remapperExpression.RemappedExpression(node)
+		if aExpr.Lexpr != nil {
+			aExpr.Lexpr = remapper.remappedExpressions(aExpr.Lexpr, remappedColumnRefs, permissions, indentLevel+1) // self-recursion
+		}
+		if aExpr.Rexpr != nil {
+			aExpr.Rexpr = remapper.remappedExpressions(aExpr.Rexpr, remappedColumnRefs, permissions, indentLevel+1) // self-recursion
+		}
+	}
+
+	// COLLATE
+	collateClause := node.GetCollateClause()
+	if collateClause != nil {
+		collateClause.Arg = remapper.remappedExpressions(collateClause.Arg, remappedColumnRefs, permissions, indentLevel+1) // self-recursion
+	}
+
+	// IS NULL
+	nullTest := node.GetNullTest()
+	if nullTest != nil {
+		nullTest.Arg = remapper.remappedExpressions(nullTest.Arg, remappedColumnRefs, permissions, indentLevel+1) // self-recursion
+	}
+
+	// IN
+	list := node.GetList()
+	if list != nil {
+		for i, item := range list.Items {
+			if item != nil {
+				list.Items[i] = remapper.remapperExpression.RemappedExpression(item)
+			}
+		}
+	}
+
+	// current_database() / current_catalog -> 'database'
+	if remapper.remapperFunction.IsCurrentDatabaseFunction(node) {
+		return pgQuery.MakeAConstStrNode(remapper.currentDatabase(), 0)
+	}
+
+	// FUNCTION(...)
+	functionCall := node.GetFuncCall()
+	if functionCall != nil {
+		remapper.remapperFunction.RemapFunctionCall(functionCall)
+		remapper.remapperFunction.RemapNestedFunctionCalls(functionCall) // recursion
+
+		for i, arg := range functionCall.Args {
+			if arg != nil {
+				functionCall.Args[i] = remapper.remappedExpressions(arg, remappedColumnRefs, permissions, indentLevel+1) // self-recursion
+			}
+		}
+
+		if functionCall.AggFilter != nil && functionCall.AggFilter.GetNullTest() != nil {
+			functionCall.AggFilter.GetNullTest().Arg = remapper.remappedExpressions(functionCall.AggFilter.GetNullTest().Arg, remappedColumnRefs, permissions, indentLevel+1) // self-recursion
+		}
+
+		// FUNCTION(... ORDER BY ...) OVER (... ORDER BY ...)
+		sortClause := functionCall.AggOrder
+		if functionCall.Over != nil {
+			sortClause = slices.Concat(functionCall.AggOrder, functionCall.Over.OrderClause) // Without appending to AggOrder's backing array
+		}
+		for _, sortNode := range sortClause {
+			sortNode.GetSortBy().Node = remapper.remappedExpressions(sortNode.GetSortBy().Node, remappedColumnRefs, permissions, indentLevel+1) // self-recursion
+		}
+		remapper.remapperSelect.RemapSortClause(sortClause)
+	}
+
+	// (FUNCTION()).n
+	indirectionFunctionCall := node.GetAIndirection()
+	if indirectionFunctionCall != nil {
+		functionCall := indirectionFunctionCall.Arg.GetFuncCall()
+		if functionCall != nil {
+			remapper.remapperFunction.RemapFunctionCall(functionCall)
+			remapper.remapperFunction.RemapNestedFunctionCalls(functionCall) // recursion
+		}
+	}
+
+	// [column]
+	columnRef := node.GetColumnRef()
+	if columnRef != nil {
+		if len(columnRef.Fields) == 1 && columnRef.Fields[0].GetString_() != nil {
+			remappedField, ok := remappedColumnRefs[columnRef.Fields[0].GetString_().Sval]
+			if ok {
+				columnRef.Fields[0] = pgQuery.MakeStrNode(remappedField)
+			}
+		}
+	}
+
+	return remapper.remapperExpression.RemappedExpression(node)
+}
+
+// CASE ...
+func (remapper *QueryRemapper) remapCaseExpression(caseExpr *pgQuery.CaseExpr, remappedColumnRefs map[string]string, permissions *map[string][]string, indentLevel int) {
+	for _, when := range caseExpr.Args {
+		if whenClause := when.GetCaseWhen(); whenClause != nil {
+			// WHEN ...
+			if whenClause.Expr != nil {
+				whenClause.Expr = remapper.remappedExpressions(whenClause.Expr, remappedColumnRefs, permissions, indentLevel+1) // recursion
+			}
+
+			// THEN ...
+			if whenClause.Result != nil {
+				whenClause.Result = remapper.remappedExpressions(whenClause.Result, remappedColumnRefs, permissions, indentLevel+1) // recursion
+			}
+		}
+	}
+
+	// ELSE ...
+	if caseExpr.Defresult != nil {
+		caseExpr.Defresult = remapper.remappedExpressions(caseExpr.Defresult, remappedColumnRefs, permissions, indentLevel+1) // recursion
+	}
+}
+
+// SELECT ...
+func (remapper *QueryRemapper) remapSelect(selectStatement *pgQuery.SelectStmt, permissions *map[string][]string, indentLevel int) map[string]string {
+	remapper.traceTreeTraversal("SELECT statements", indentLevel)
+	remappedColumnRefs := make(map[string]string)
+
+	// SELECT ...
+	for targetNodeIdx, targetNode := range selectStatement.TargetList {
+		targetNode, remappedColRefs := remapper.remapperSelect.RemapTargetName(targetNode)
+		for previousName, newName := range remappedColRefs {
+			remappedColumnRefs[previousName] = newName
+		}
+
+		targetNode = remapper.remapperSelect.SetTargetNameIfEmpty(targetNode)
+
+		valNode := targetNode.GetResTarget().Val
+		if valNode != nil {
+			targetNode.GetResTarget().Val = remapper.remappedExpressions(valNode, remappedColumnRefs, permissions, indentLevel) // recursion
+		}
+
+		// Nested SELECT
+		if valNode.GetSubLink() != nil {
+			subLink := valNode.GetSubLink()
+			subSelect := subLink.Subselect.GetSelectStmt()
+
+			// DuckDB doesn't work with ORDER BY in ARRAY subqueries:
+			//   SELECT ARRAY(SELECT 1 FROM pg_enum ORDER BY enumsortorder)
+			//   > Referenced column "enumsortorder" not found in FROM clause!
+			//
+			// Remove ORDER BY from ARRAY subqueries
+			if subLink.SubLinkType == pgQuery.SubLinkType_ARRAY_SUBLINK && subSelect.SortClause != nil {
+				subSelect.SortClause = nil
+			}
+		}
+
+		selectStatement.TargetList[targetNodeIdx] = targetNode
+	}
+
+	// VALUES (...)
+	if len(selectStatement.ValuesLists) > 0 {
+		for i, valuesList := range selectStatement.ValuesLists {
+			for j, value := range valuesList.GetList().Items {
+				if value != nil {
+					selectStatement.ValuesLists[i].GetList().Items[j] = remapper.remapperExpression.RemappedExpression(value)
+				}
+			}
+		}
+	}
+
+	// DISTINCT ON (column)
+	distinctClauses := selectStatement.GetDistinctClause()
+	for i, distinctNode := range distinctClauses {
+		distinctClauses[i] = remapper.remappedExpressions(distinctNode, remappedColumnRefs, permissions, indentLevel) // recursion
+	}
+
+	return remappedColumnRefs
+}
+
+// Fix the query sent by psql "\d [table]": ... WHERE attrelid = pr.prrelid AND attnum = prattrs[s] ...
+// DuckDB fails with the following errors:
+//
+// 1) INTERNAL Error: Failed to bind column reference "prrelid" [93.3] (bindings: {#[101.0], #[101.1], #[101.2]}) This error signals an assertion failure within DuckDB. This usually occurs due to unexpected conditions or errors in the program's logic.
+// 2) Binder Error: No function matches the given name and argument types 'array_extract(VARCHAR, STRUCT(generate_series BIGINT))'. You might need to add explicit type casts.
+func (remapper *QueryRemapper) removeWhereClause(whereClause *pgQuery.Node) bool {
+	boolExpr := whereClause.GetBoolExpr()
+	if boolExpr == nil || boolExpr.Boolop != pgQuery.BoolExprType_AND_EXPR || len(boolExpr.Args) != 2 {
+		return false
+	}
+
+	arg1 := boolExpr.Args[0].GetAExpr()
+	if arg1 == nil || arg1.Kind != pgQuery.A_Expr_Kind_AEXPR_OP || arg1.Name[0].GetString_().Sval != "=" {
+		return false
+	}
+
+	arg2 := boolExpr.Args[1].GetAExpr()
+	if arg2 == nil || arg2.Kind != pgQuery.A_Expr_Kind_AEXPR_OP || arg2.Name[0].GetString_().Sval != "=" {
+		return false
+	}
+
+	arg1LColRef := arg1.Lexpr.GetColumnRef()
+	if arg1LColRef == nil || len(arg1LColRef.Fields) != 1 || arg1LColRef.Fields[0].GetString_().Sval != "attrelid" {
+		return false
+	}
+
+	arg1RColRef := arg1.Rexpr.GetColumnRef()
+	if arg1RColRef == nil || len(arg1RColRef.Fields) != 2 || arg1RColRef.Fields[0].GetString_().Sval != "pr" || arg1RColRef.Fields[1].GetString_().Sval != "prrelid" {
+		return false
+	}
+
+	arg2LColRef := arg2.Lexpr.GetColumnRef()
+	if arg2LColRef == nil || len(arg2LColRef.Fields) != 1 || arg2LColRef.Fields[0].GetString_().Sval != "attnum" {
+		return false
+	}
+
+	arg2RIndir := arg2.Rexpr.GetAIndirection()
+	if arg2RIndir == nil || arg2RIndir.Arg.GetColumnRef() == nil || len(arg2RIndir.Arg.GetColumnRef().Fields) != 1 || arg2RIndir.Arg.GetColumnRef().Fields[0].GetString_().Sval != "prattrs" {
+		return false
+	}
+	if len(arg2RIndir.Indirection) != 1 || arg2RIndir.Indirection[0].GetAIndices() == nil || arg2RIndir.Indirection[0].GetAIndices().Uidx.GetColumnRef() == nil || len(arg2RIndir.Indirection[0].GetAIndices().Uidx.GetColumnRef().Fields) != 1 || arg2RIndir.Indirection[0].GetAIndices().Uidx.GetColumnRef().Fields[0].GetString_().Sval != "s" {
+		return false
+	}
+
+	return true
+}
+
+// COMMIT / ROLLBACK end a failed transaction block, ROLLBACK TO SAVEPOINT continues it
+func isTransactionEndStatement(node *pgQuery.Node) bool {
+	if node == nil || node.GetTransactionStmt() == nil {
+		return false
+	}
+	switch node.GetTransactionStmt().Kind {
+	case pgQuery.TransactionStmtKind_TRANS_STMT_COMMIT, pgQuery.TransactionStmtKind_TRANS_STMT_ROLLBACK, pgQuery.TransactionStmtKind_TRANS_STMT_ROLLBACK_TO:
+		return true
+	}
+	return false
+}
+
+// Called when the client disconnects
+func (remapper *QueryRemapper) DropTempTables() {
+	remapper.tempTables.DropAll(remapper.Session)
+}
+
+// Called after running a query, temp tables registered while remapping it are kept only if their CREATE TEMP TABLE ran
+func (remapper *QueryRemapper) RemoveUncreatedTempTables() {
+	remapper.tempTables.RemoveUncreated(remapper.Session)
+}
+
+// Called after the server starts with BEMIDB_CHECK_CATALOG_ON_START
+func (remapper *QueryRemapper) CheckCatalog() {
+	remapper.remapperTable.CheckCatalog()
+}
+
+// BEGIN / COMMIT / ROLLBACK / SAVEPOINT / RELEASE / ROLLBACK TO -> command tag and a warning (e.g., if there is no transaction in progress)
+func (remapper *QueryRemapper) HandleTransactionQuery(query string) (string, string, error) {
+	queryTree, err := pgQuery.Parse(query)
+	if err != nil {
+		return "", "", err
+	}
+	if len(queryTree.Stmts) != 1 || queryTree.Stmts[0].Stmt.GetTransactionStmt() == nil {
+		return "", "", fmt.Errorf("not a transaction statement: %s", query)
+	}
+
+	session := remapper.Session
+	transactionStatement := queryTree.Stmts[0].Stmt.GetTransactionStmt()
+	switch transactionStatement.Kind {
+	case pgQuery.TransactionStmtKind_TRANS_STMT_BEGIN:
+		return "BEGIN", "", remapper.beginTransaction()
+	case pgQuery.TransactionStmtKind_TRANS_STMT_START:
+		return "START TRANSACTION", "", remapper.beginTransaction()
+	case pgQuery.TransactionStmtKind_TRANS_STMT_COMMIT:
+		if session.Transaction == nil {
+			return "COMMIT", "there is no transaction in progress", nil
+		}
+		if session.Transaction.Failed {
+			return "ROLLBACK", "", remapper.endTransaction(false)
+		}
+		return "COMMIT", "", remapper.endTransaction(true)
+	case pgQuery.TransactionStmtKind_TRANS_STMT_ROLLBACK:
+		if session.Transaction == nil {
+			return "ROLLBACK", "there is no transaction in progress", nil
+		}
+		return "ROLLBACK", "", remapper.endTransaction(false)
+	case pgQuery.TransactionStmtKind_TRANS_STMT_SAVEPOINT:
+		if session.Transaction == nil {
+			return "", "", &PgError{Code: PG_ERROR_CODE_NO_ACTIVE_TRANSACTION, Message: "SAVEPOINT can only be used in transaction blocks"}
+		}
+		session.Transaction.Savepoints = append(session.Transaction.Savepoints, TransactionSavepoint{
+			Name:        transactionStatement.SavepointName,
+			ChangeCount: session.Transaction.ChangeCount,
+		})
+		return "SAVEPOINT", "", nil
+	case pgQuery.TransactionStmtKind_TRANS_STMT_RELEASE:
+		if session.Transaction == nil {
+			return "", "", &PgError{Code: PG_ERROR_CODE_NO_ACTIVE_TRANSACTION, Message: "RELEASE SAVEPOINT can only be used in transaction blocks"}
+		}
+		i, err := remapper.savepointIndex(transactionStatement.SavepointName)
+		if err != nil {
+			return "", "", err
+		}
+		session.Transaction.Savepoints = session.Transaction.Savepoints[:i]
+		return "RELEASE", "", nil
+	case pgQuery.TransactionStmtKind_TRANS_STMT_ROLLBACK_TO:
+		if session.Transaction == nil {
+			return "", "", &PgError{Code: PG_ERROR_CODE_NO_ACTIVE_TRANSACTION, Message: "ROLLBACK TO SAVEPOINT can only be used in transaction blocks"}
+		}
+		return "ROLLBACK", "", remapper.rollbackToSavepoint(transactionStatement.SavepointName)
+	}
+
+	return "ROLLBACK", "", nil
+}
+
+// DuckDB doesn't support savepoints, so rolling back to one only resets the failed state of the transaction. Changes to temp tables
+// made after the savepoint can't be undone, and a DuckDB transaction aborted by an error is restarted only if nothing changed in it
+func (remapper *QueryRemapper) rollbackToSavepoint(name string) error {
+	transaction := remapper.Session.Transaction
+	i, err := remapper.savepointIndex(name)
+	if err != nil {
+		return err
+	}
+	savepoint := transaction.Savepoints[i]
+	if transaction.ChangeCount > savepoint.ChangeCount {
+		return &PgError{
+			Code:    PG_ERROR_CODE_FEATURE_NOT_SUPPORTED,
+			Message: "cannot roll back changes to temp tables made after savepoint \"" + name + "\"",
+			Hint:    "Use ROLLBACK to roll back the whole transaction.",
+		}
+	}
+
+	if transaction.Failed && transaction.Tx != nil {
+		_, err := transaction.Tx.ExecContext(remapper.Session.ConnectionContext(), "SELECT 1")
+		if err != nil { // Aborted by DuckDB after an execution error
+			if transaction.ChangeCount > 0 {
+				return &PgError{
+					Code:    PG_ERROR_CODE_FEATURE_NOT_SUPPORTED,
+					Message: "cannot roll back to savepoint \"" + name + "\" after an error in a transaction that changed temp tables",
+					Hint:    "Use ROLLBACK to roll back the whole transaction.",
+				}
+			}
+			transaction.Tx.Rollback()
+			transaction.Tx, err = transaction.Conn.BeginTx(remapper.Session.ConnectionContext(), nil)
+			if err != nil {
+				transaction.Tx = nil
+				return err
+			}
+		}
+	}
+
+	transaction.Savepoints = transaction.Savepoints[:i+1] // The savepoint can be rolled back to again
+	transaction.Failed = false
+	return nil
+}
+
+// The innermost savepoint with the name like in Postgres
+func (remapper *QueryRemapper) savepointIndex(name string) (int, error) {
+	savepoints := remapper.Session.Transaction.Savepoints
+	for i := len(savepoints) - 1; i >= 0; i-- {
+		if savepoints[i].Name == name {
+			return i, nil
+		}
+	}
+	return 0, &PgError{Code: PG_ERROR_CODE_INVALID_SAVEPOINT, Message: "savepoint \"" + name + "\" does not exist"}
+}
+
+// Rolls back the transaction of a disconnected client
+func (remapper *QueryRemapper) RollbackTransaction() {
+	if remapper.Session.Transaction == nil {
+		return
+	}
+	err := remapper.endTransaction(false)
+	if err != nil {
+		common.LogWarn(remapper.config.CommonConfig, "Couldn't roll back transaction:", err)
+	}
+}
+
+func (remapper *QueryRemapper) beginTransaction() error {
+	session := remapper.Session
+	if session.Transaction != nil {
+		common.LogWarn(remapper.config.CommonConfig, "There is already a transaction in progress")
+		session.AddNotice("WARNING", PG_ERROR_CODE_ACTIVE_SQL_TRANSACTION, "there is already a transaction in progress")
+		return nil
+	}
+
+	transaction := &SessionTransaction{
+		DuckdbSettings:         make(map[string]string),
+		CreatedTempTables:      common.NewSet[string](),
+		OnCommitDropTempTables: common.NewSet[string](),
+	}
+	duckdbClient := remapper.remapperTable.ServerDuckdbClient
+	if duckdbClient != nil {
+		// Rolled back by database/sql if the client disconnects
+		conn, err := duckdbClient.Db.Conn(session.ConnectionContext())
+		if err != nil {
+			return err
+		}
+		tx, err := conn.BeginTx(session.ConnectionContext(), nil)
+		if err != nil {
+			conn.Close()
+			return err
+		}
+		transaction.Conn = conn
+		transaction.Tx = tx
+	}
+	session.Transaction = transaction
+	return nil
+}
+
+// Commits or rolls back the DuckDB transaction and releases its connection. Temp tables created in the transaction
+// are forgotten if it didn't commit, and ON COMMIT DROP temp tables are dropped after it
+func (remapper *QueryRemapper) endTransaction(commit bool) error {
+	session := remapper.Session
+	transaction := session.Transaction
+	session.Transaction = nil
+	session.CloseTransactionCursors(transaction, commit) // A commit waits for the rows of the transaction to be closed
+
+	var err error
+	if transaction.Tx != nil {
+		if commit {
+			err = transaction.Tx.Commit()
+		} else {
+			err = transaction.Tx.Rollback()
+			if errors.Is(err, sql.ErrTxDone) {
+				err = nil // Already rolled back after the client disconnected
+			}
+		}
+		for name := range transaction.DuckdbSettings { // The connection goes back to the pool
+			transaction.Conn.ExecContext(context.Background(), "RESET "+name)
+		}
+		transaction.Conn.Close()
+	}
+
+	if !commit || err != nil {
+		for _, tableName := range transaction.CreatedTempTables.Values() {
+			session.TempTables.Remove(tableName)
+		}
+		return err
+	}
+	return remapper.tempTables.Drop(session, transaction.OnCommitDropTempTables.Values())
+}
+
+// CREATE TEMP TABLE table (...) -> CREATE TABLE bemidb_temp_1.table (...)
+// CREATE TEMP TABLE table AS SELECT ... -> CREATE TABLE bemidb_temp_1.table AS SELECT ... (remapped)
+func (remapper *QueryRemapper) createTempTable(node *pgQuery.Node, permissions *map[string][]string) error {
+	if createStatement := node.GetCreateStmt(); createStatement != nil {
+		onCommit := createStatement.Oncommit
+		createStatement.Oncommit = pgQuery.OnCommitAction_ONCOMMIT_NOOP // Not supported by DuckDB
+		return remapper.tempTables.Create(remapper.Session, createStatement.Relation, onCommit)
+	}
+
+	createTableAsStatement := node.GetCreateTableAsStmt()
+	selectStatement := createTableAsStatement.Query.GetSelectStmt()
+	if selectStatement == nil {
+		return &PgError{Code: PG_ERROR_CODE_FEATURE_NOT_SUPPORTED, Message: "CREATE TEMP TABLE ... AS must be followed by a SELECT"}
+	}
+	remapper.remapSelectStatement(selectStatement, permissions, 1)
+	onCommit := createTableAsStatement.Into.OnCommit
+	createTableAsStatement.Into.OnCommit = pgQuery.OnCommitAction_ONCOMMIT_NOOP
+	return remapper.tempTables.Create(remapper.Session, createTableAsStatement.Into.Rel, onCommit)
+}
+
+// Called after a statement ran, registers the temp table if the statement is CREATE TEMP TABLE
+func (remapper *QueryRemapper) TrackCreatedTempTable(originalQuery string) {
+	if !strings.Contains(strings.ToUpper(originalQuery), "TEMP") {
+		return
+	}
+	queryTree, err := pgQuery.Parse(originalQuery)
+	if err != nil || len(queryTree.Stmts) != 1 {
+		return
+	}
+
+	node := queryTree.Stmts[0].Stmt
+	if createStatement := node.GetCreateStmt(); createStatement != nil && createStatement.Relation.Relpersistence == RELPERSISTENCE_TEMP {
+		remapper.tempTables.TrackCreated(remapper.Session, createStatement.Relation.Relname, createStatement.Oncommit)
+	} else if createTableAsStatement := node.GetCreateTableAsStmt(); createTableAsStatement != nil && createTableAsStatement.Into.Rel.Relpersistence == RELPERSISTENCE_TEMP {
+		remapper.tempTables.TrackCreated(remapper.Session, createTableAsStatement.Into.Rel.Relname, createTableAsStatement.Into.OnCommit)
+	}
+}
+
+// INSERT INTO temp_table [(columns)] VALUES (...) / SELECT ... -> INSERT INTO bemidb_temp_1.temp_table ...
+func (remapper *QueryRemapper) remapInsertStatement(stmt *pgQuery.RawStmt, permissions *map[string][]string) (*pgQuery.RawStmt, error) {
+	insertStatement := stmt.Stmt.GetInsertStmt()
+	if len(insertStatement.ReturningList) > 0 || insertStatement.OnConflictClause != nil {
+		return nil, &PgError{Code: PG_ERROR_CODE_FEATURE_NOT_SUPPORTED, Message: "INSERT with RETURNING or ON CONFLICT is not supported"}
+	}
+
+	selectStatement := insertStatement.SelectStmt.GetSelectStmt()
+	if selectStatement != nil {
+		// WITH cte AS (...) INSERT INTO table SELECT ... FROM cte -> INSERT INTO table WITH cte AS (...) SELECT ... FROM cte
+		if insertStatement.WithClause != nil {
+			if selectStatement.WithClause == nil {
+				selectStatement.WithClause = insertStatement.WithClause
+			} else {
+				selectStatement.WithClause.Ctes = append(append([]*pgQuery.Node{}, insertStatement.WithClause.Ctes...), selectStatement.WithClause.Ctes...)
+				selectStatement.WithClause.Recursive = selectStatement.WithClause.Recursive || insertStatement.WithClause.Recursive
+			}
+			insertStatement.WithClause = nil
+		}
+		remapper.remapSelectStatement(selectStatement, permissions, 1)
+	}
+	if remapper.tempTables.RemapTable(remapper.Session, insertStatement.Relation) {
+		return stmt, nil
+	}
+
+	if selectStatement == nil {
+		return nil, &PgError{Code: PG_ERROR_CODE_FEATURE_NOT_SUPPORTED, Message: "INSERT ... DEFAULT VALUES is supported only into temp tables"}
+	}
+	err := remapper.checkChangedIcebergTable(insertStatement.Relation)
+	if err != nil {
+		return nil, err
+	}
+	return &pgQuery.RawStmt{Stmt: &pgQuery.Node{Node: &pgQuery.Node_SelectStmt{SelectStmt: selectStatement}}}, nil
+}
+
+// UPDATE table SET column = value [FROM ...] [WHERE ...] / DELETE FROM table [USING ...] [WHERE ...]:
+// remaps the values, the joined tables, and the conditions like in SELECT value FROM ... WHERE ..., and keeps the target table
+func (remapper *QueryRemapper) remapUpdateOrDeleteStatement(node *pgQuery.Node, permissions *map[string][]string) error {
+	var relation *pgQuery.RangeVar
+	var setTargets []*pgQuery.Node
+	selectStatement := &pgQuery.SelectStmt{}
+
+	if updateStatement := node.GetUpdateStmt(); updateStatement != nil {
+		if len(updateStatement.ReturningList) > 0 {
+			return &PgError{Code: PG_ERROR_CODE_FEATURE_NOT_SUPPORTED, Message: "UPDATE with RETURNING is not supported"}
+		}
+		relation, setTargets = updateStatement.Relation, updateStatement.TargetList
+		selectStatement.FromClause, selectStatement.WhereClause, selectStatement.WithClause = updateStatement.FromClause, updateStatement.WhereClause, updateStatement.WithClause
+	} else {
+		deleteStatement := node.GetDeleteStmt()
+		if len(deleteStatement.ReturningList) > 0 {
+			return &PgError{Code: PG_ERROR_CODE_FEATURE_NOT_SUPPORTED, Message: "DELETE with RETURNING is not supported"}
+		}
+		relation = deleteStatement.Relation
+		selectStatement.FromClause, selectStatement.WhereClause, selectStatement.WithClause = deleteStatement.UsingClause, deleteStatement.WhereClause, deleteStatement.WithClause
+	}
+
+	for _, setTarget := range setTargets {
+		selectStatement.TargetList = append(selectStatement.TargetList, pgQuery.MakeResTargetNodeWithVal(setTarget.GetResTarget().Val, 0))
+	}
+	remapper.remapSelectStatement(selectStatement, permissions, 1)
+	for i, setTarget := range setTargets {
+		setTarget.GetResTarget().Val = selectStatement.TargetList[i].GetResTarget().Val
+	}
+
+	if updateStatement := node.GetUpdateStmt(); updateStatement != nil {
+		updateStatement.FromClause, updateStatement.WhereClause = selectStatement.FromClause, selectStatement.WhereClause
+	} else {
+		node.GetDeleteStmt().UsingClause, node.GetDeleteStmt().WhereClause = selectStatement.FromClause, selectStatement.WhereClause
+	}
+
+	if remapper.tempTables.RemapTable(remapper.Session, relation) {
+		return nil
+	}
+	return remapper.checkChangedIcebergTable(relation)
+}
+
+// INSERT/UPDATE/DELETE: only Iceberg tables can be changed, not materialized views. The writer also checks that they were created with CREATE TABLE ... AS
+// Tables outside the schemas of the connected logical database don't exist like for reads
+func (remapper *QueryRemapper) checkChangedIcebergTable(relation *pgQuery.RangeVar) error {
+	icebergSchemaTable := remapper.changedIcebergSchemaTable(relation)
+	if visibleSchemas := remapper.visibleSchemas(); visibleSchemas != nil && !visibleSchemas.Contains(icebergSchemaTable.Schema) {
+		return &PgError{Code: PG_ERROR_CODE_UNDEFINED_TABLE, Message: "relation \"" + icebergSchemaTable.Schema + "." + icebergSchemaTable.Table + "\" does not exist"}
+	}
+	remapper.remapperTable.reloadIcebergTables()
+	if remapper.remapperTable.IcebergMaterlizedSchemaTables.Contains(icebergSchemaTable) {
+		return &PgError{Code: PG_ERROR_CODE_WRONG_OBJECT_TYPE, Message: "cannot change materialized view \"" + icebergSchemaTable.Table + "\""}
+	}
+	if !remapper.remapperTable.IcebergPersistentSchemaTables.Contains(icebergSchemaTable) {
+		return &PgError{Code: PG_ERROR_CODE_UNDEFINED_TABLE, Message: "relation \"" + icebergSchemaTable.Schema + "." + icebergSchemaTable.Table + "\" does not exist"}
+	}
+	return nil
+}
+
+// INSERT INTO table that isn't a temp table -> the table and the listed columns to append the rows to
+func (remapper *QueryRemapper) IcebergInsertTable(originalQuery string) (*common.IcebergSchemaTable, []string) {
+	upperOriginalQuery := strings.ToUpper(originalQuery)
+	if !strings.HasPrefix(upperOriginalQuery, "INSERT ") && !strings.HasPrefix(upperOriginalQuery, "WITH ") {
+		return nil, nil
+	}
+	queryTree, err := pgQuery.Parse(originalQuery)
+	if err != nil || len(queryTree.Stmts) != 1 || queryTree.Stmts[0].Stmt.GetInsertStmt() == nil {
+		return nil, nil
+	}
+	insertStatement := queryTree.Stmts[0].Stmt.GetInsertStmt()
+	if remapper.tempTables.IsTempTable(remapper.Session, insertStatement.Relation) {
+		return nil, nil
+	}
+
+	icebergSchemaTable := remapper.changedIcebergSchemaTable(insertStatement.Relation)
+	var columnNames []string
+	for _, columnNode := range insertStatement.Cols {
+		columnNames = append(columnNames, columnNode.GetResTarget().Name)
+	}
+	return &icebergSchemaTable, columnNames
+}
+
+// UPDATE table ... / DELETE FROM table ... -> table, "UPDATE" / "DELETE"
+// Returns nil for other statements and for temp tables, which are changed by the remapped query directly
+func (remapper *QueryRemapper) IcebergChangeTable(originalQuery string) (*common.IcebergSchemaTable, string) {
+	upperOriginalQuery := strings.ToUpper(originalQuery)
+	if !strings.HasPrefix(upperOriginalQuery, "UPDATE ") && !strings.HasPrefix(upperOriginalQuery, "DELETE ") && !strings.HasPrefix(upperOriginalQuery, "WITH ") {
+		return nil, ""
+	}
+	queryTree, err := pgQuery.Parse(originalQuery)
+	if err != nil || len(queryTree.Stmts) != 1 {
+		return nil, ""
+	}
+
+	var relation *pgQuery.RangeVar
+	var command string
+	switch node := queryTree.Stmts[0].Stmt; {
+	case node.GetUpdateStmt() != nil:
+		relation, command = node.GetUpdateStmt().Relation, "UPDATE"
+	case node.GetDeleteStmt() != nil:
+		relation, command = node.GetDeleteStmt().Relation, "DELETE"
+	default:
+		return nil, ""
+	}
+	if remapper.tempTables.IsTempTable(remapper.Session, relation) {
+		return nil, ""
+	}
+
+	icebergSchemaTable := remapper.changedIcebergSchemaTable(relation)
+	return &icebergSchemaTable, command
+}
+
+// UPDATE table ... (remapped) -> UPDATE copy_<uuid> AS table ... to change the rows copied from the Iceberg table
+func (remapper *QueryRemapper) RetargetChangeStatement(query string, duckdbTableName string) (string, error) {
+	queryTree, err := pgQuery.Parse(query)
+	if err != nil {
+		return "", err
+	}
+
+	node := queryTree.Stmts[0].Stmt
+	relation := node.GetDeleteStmt().GetRelation()
+	if node.GetUpdateStmt() != nil {
+		relation = node.GetUpdateStmt().Relation
+	}
+	if relation.Alias == nil {
+		relation.Alias = &pgQuery.Alias{Aliasname: relation.Relname}
+	}
+	relation.Catalogname = ""
+	relation.Schemaname = ""
+	relation.Relname = duckdbTableName
+
+	return pgQuery.Deparse(queryTree)
+}
+
+func (remapper *QueryRemapper) isDropTempTables(dropStatement *pgQuery.DropStmt) bool {
+	for _, object := range dropStatement.Objects {
+		if !remapper.tempTables.IsTempTable(remapper.Session, remapper.dropObjectRangeVar(object)) {
+			return false
+		}
+	}
+	return true
+}
+
+func (remapper *QueryRemapper) dropTempTables(dropStatement *pgQuery.DropStmt) error {
+	var tableNames []string
+	for _, object := range dropStatement.Objects {
+		tableNames = append(tableNames, remapper.dropObjectRangeVar(object).Relname)
+	}
+	return remapper.tempTables.Drop(remapper.Session, tableNames)
+}
+
+// DROP TABLE [schema.]table -> RangeVar
+func (remapper *QueryRemapper) dropObjectRangeVar(object *pgQuery.Node) *pgQuery.RangeVar {
+	items := object.GetList().Items
+	rangeVar := &pgQuery.RangeVar{Relname: items[len(items)-1].GetString_().Sval}
+	if len(items) > 1 {
+		rangeVar.Schemaname = items[len(items)-2].GetString_().Sval
+	}
+	return rangeVar
+}
+
+// Stores the schema in the catalog, so materialized views and tables can be created in it before it has any
+func (remapper *QueryRemapper) createSchema(createSchemaStatement *pgQuery.CreateSchemaStmt) error {
+	if len(createSchemaStatement.SchemaElts) > 0 {
+		return &PgError{Code: PG_ERROR_CODE_FEATURE_NOT_SUPPORTED, Message: "CREATE SCHEMA with schema elements is not supported"}
+	}
+	schema := createSchemaStatement.Schemaname
+	if schema == "" {
+		schema = createSchemaStatement.Authrole.GetRolename() // CREATE SCHEMA AUTHORIZATION role
+	}
+	if strings.HasPrefix(schema, "pg_") {
+		return &PgError{Code: PG_ERROR_CODE_RESERVED_NAME, Message: "unacceptable schema name \"" + schema + "\"", Detail: "The prefix \"pg_\" is reserved for system schemas."}
+	}
+
+	if schema == PG_SCHEMA_PUBLIC || schema == PG_SCHEMA_INFORMATION_SCHEMA || schema == BEMIDB_SCHEMA {
+		if createSchemaStatement.IfNotExists {
+			return nil
+		}
+		return &PgError{Code: PG_ERROR_CODE_DUPLICATE_SCHEMA, Message: "schema \"" + schema + "\" already exists"}
+	}
+
+	err := remapper.IcebergWriter.CreateSchema(schema, createSchemaStatement.IfNotExists)
+	if err != nil {
+		if errors.Is(err, common.ErrAlreadyExists) {
+			return &PgError{Code: PG_ERROR_CODE_DUPLICATE_SCHEMA, Message: "schema \"" + schema + "\" already exists"}
+		}
+		return fmt.Errorf("couldn't create schema: %w", err)
+	}
+	remapper.remapperTable.reloadIcebergTables()
+	return nil
+}
+
+// CREATE TABLE table AS SELECT ... -> writes the rows of the SELECT (remapped) to a new table, e.g. for dbt table materializations.
+// Unlike materialized views, the table doesn't keep the definition and can be changed with INSERT, UPDATE, etc.
+func (remapper *QueryRemapper) createTableAs(createTableAsStatement *pgQuery.CreateTableAsStmt, permissions *map[string][]string) error {
+	selectStatement := createTableAsStatement.Query.GetSelectStmt()
+	if selectStatement == nil {
+		return &PgError{Code: PG_ERROR_CODE_FEATURE_NOT_SUPPORTED, Message: "CREATE TABLE ... AS must be followed by a SELECT"}
+	}
+	if len(createTableAsStatement.Into.ColNames) > 0 {
+		return &PgError{Code: PG_ERROR_CODE_FEATURE_NOT_SUPPORTED, Message: "CREATE TABLE with a column list ... AS is not supported", Hint: "Name the columns in the SELECT instead."}
+	}
+
+	icebergSchemaTable := icebergSchemaTableFromRangeVar(createTableAsStatement.Into.Rel)
+	remapper.remapperTable.reloadIcebergTables()
+	if remapper.remapperTable.IcebergPersistentSchemaTables.Contains(icebergSchemaTable) || remapper.remapperTable.IcebergMaterlizedSchemaTables.Contains(icebergSchemaTable) {
+		if createTableAsStatement.IfNotExists {
+			return nil
+		}
+		return &PgError{Code: PG_ERROR_CODE_DUPLICATE_TABLE, Message: "relation \"" + icebergSchemaTable.Table + "\" already exists"}
+	}
+
+	remapper.remapSelectStatement(selectStatement, permissions, 1)
+	if createTableAsStatement.Into.SkipData { // WITH NO DATA
+		selectStatement.LimitCount = pgQuery.MakeAConstIntNode(0, 0)
+	}
+	selectRawStmt := &pgQuery.RawStmt{Stmt: &pgQuery.Node{Node: &pgQuery.Node_SelectStmt{SelectStmt: selectStatement}}}
+	query, err := pgQuery.Deparse(&pgQuery.ParseResult{Stmts: []*pgQuery.RawStmt{selectRawStmt}})
+	if err != nil {
+		return fmt.Errorf("couldn't read query of CREATE TABLE ... AS: %w", err)
+	}
+
+	err = remapper.IcebergWriter.CreateTableFromQuery(icebergSchemaTable, query)
+	if err != nil {
+		return fmt.Errorf("couldn't create table: %w", err)
+	}
+	remapper.remapperTable.reloadIcebergTables()
+	return nil
+}
+
+// CREATE [OR REPLACE] VIEW view AS SELECT ... -> stores the definition in the catalog.
+// Unlike materialized views, queries of the view run the definition and read the current rows of its tables.
+func (remapper *QueryRemapper) createView(viewStatement *pgQuery.ViewStmt) error {
+	if viewStatement.View.Relpersistence == RELPERSISTENCE_TEMP {
+		return &PgError{Code: PG_ERROR_CODE_FEATURE_NOT_SUPPORTED, Message: "CREATE TEMP VIEW is not supported"}
+	}
+	if len(viewStatement.Aliases) > 0 {
+		return &PgError{Code: PG_ERROR_CODE_FEATURE_NOT_SUPPORTED, Message: "CREATE VIEW with a column list is not supported", Hint: "Name the columns in the SELECT instead."}
+	}
+	selectStatement := viewStatement.Query.GetSelectStmt()
+	if selectStatement == nil {
+		return &PgError{Code: PG_ERROR_CODE_FEATURE_NOT_SUPPORTED, Message: "CREATE VIEW ... AS must be followed by a SELECT"}
+	}
+
+	icebergSchemaTable := icebergSchemaTableFromRangeVar(viewStatement.View)
+	remapper.remapperTable.reloadIcebergTables()
+	if remapper.remapperTable.IcebergPersistentSchemaTables.Contains(icebergSchemaTable) || remapper.remapperTable.IcebergMaterlizedSchemaTables.Contains(icebergSchemaTable) {
+		return &PgError{Code: PG_ERROR_CODE_DUPLICATE_TABLE, Message: "relation \"" + icebergSchemaTable.Table + "\" already exists"}
+	}
+	if _, ok := remapper.remapperTable.IcebergViews[icebergSchemaTable]; ok && !viewStatement.Replace {
+		return &PgError{Code: PG_ERROR_CODE_DUPLICATE_TABLE, Message: "relation \"" + icebergSchemaTable.Table + "\" already exists"}
+	}
+
+	selectRawStmt := &pgQuery.RawStmt{Stmt: &pgQuery.Node{Node: &pgQuery.Node_SelectStmt{SelectStmt: selectStatement}}}
+	definition, err := pgQuery.Deparse(&pgQuery.ParseResult{Stmts: []*pgQuery.RawStmt{selectRawStmt}})
+	if err != nil {
+		return fmt.Errorf("couldn't read definition of CREATE VIEW: %w", err)
+	}
+
+	isRecursive, err := remapper.isRecursiveView(icebergSchemaTable, definition, common.NewSet[common.IcebergSchemaTable]())
+	if err != nil {
+		return fmt.Errorf("couldn't read definition of CREATE VIEW: %w", err)
+	}
+	if isRecursive {
+		return &PgError{Code: PG_ERROR_CODE_INVALID_OBJECT_DEFINITION, Message: "infinite recursion detected in rules for relation \"" + icebergSchemaTable.Table + "\""}
+	}
+
+	// The definition can read tables that aren't synced yet, directly or through other views, and fails until they are
+	_, _, err = remapper.ParseAndRemapQuery(definition)
+	var pgError *PgError
+	if err != nil && !(errors.As(err, &pgError) && pgError.Code == PG_ERROR_CODE_UNDEFINED_TABLE) {
+		return fmt.Errorf("couldn't remap definition of CREATE VIEW: %w", err)
+	}
+
+	err = remapper.IcebergWriter.CreateView(icebergSchemaTable, definition, viewStatement.Replace)
+	if err != nil {
+		return fmt.Errorf("couldn't create view: %w", err)
+	}
+	remapper.remapperTable.reloadIcebergTables()
+	return nil
+}
+
+// Whether the definition reads from the view, directly or through other views
+func (remapper *QueryRemapper) isRecursiveView(icebergSchemaTable common.IcebergSchemaTable, definition string, visitedViews common.Set[common.IcebergSchemaTable]) (bool, error) {
+	qSchemaTables, err := remapper.remapperTable.parserTable.ReferencedQuerySchemaTables(definition)
+	if err != nil {
+		return false, err
+	}
+
+	for _, qSchemaTable := range qSchemaTables {
+		referencedSchemaTable := qSchemaTable.ToIcebergSchemaTable()
+		if referencedSchemaTable == icebergSchemaTable {
+			return true, nil
+		}
+		referencedDefinition, ok := remapper.remapperTable.IcebergViews[referencedSchemaTable]
+		if !ok || visitedViews.Contains(referencedSchemaTable) {
+			continue
+		}
+		visitedViews.Add(referencedSchemaTable)
+		isRecursive, err := remapper.isRecursiveView(icebergSchemaTable, referencedDefinition, visitedViews) // recursion
+		if err != nil || isRecursive {
+			return isRecursive, err
+		}
+	}
+	return false, nil
+}
+
+// DROP VIEW [IF EXISTS] view, ... -> removes the definitions from the catalog
+func (remapper *QueryRemapper) dropViews(dropStatement *pgQuery.DropStmt) error {
+	remapper.remapperTable.reloadIcebergTables()
+
+	for _, object := range dropStatement.Objects {
+		nameItems := object.GetList().Items
+		icebergSchemaTable := common.IcebergSchemaTable{Schema: PG_SCHEMA_PUBLIC, Table: nameItems[len(nameItems)-1].GetString_().Sval}
+		if len(nameItems) > 1 {
+			icebergSchemaTable.Schema = nameItems[len(nameItems)-2].GetString_().Sval
+		}
+
+		if _, ok := remapper.remapperTable.IcebergViews[icebergSchemaTable]; !ok {
+			if remapper.remapperTable.IcebergMaterlizedSchemaTables.Contains(icebergSchemaTable) {
+				return &PgError{Code: PG_ERROR_CODE_WRONG_OBJECT_TYPE, Message: "\"" + icebergSchemaTable.Table + "\" is not a view", Hint: "Use DROP MATERIALIZED VIEW to remove a materialized view."}
+			}
+			if remapper.remapperTable.IcebergPersistentSchemaTables.Contains(icebergSchemaTable) {
+				return &PgError{Code: PG_ERROR_CODE_WRONG_OBJECT_TYPE, Message: "\"" + icebergSchemaTable.Table + "\" is not a view", Hint: "Use DROP TABLE to remove a table."}
+			}
+			if dropStatement.MissingOk {
+				continue
+			}
+			return &PgError{Code: PG_ERROR_CODE_UNDEFINED_TABLE, Message: "view \"" + icebergSchemaTable.Table + "\" does not exist"}
+		}
+
+		err := remapper.IcebergWriter.DropView(icebergSchemaTable, true)
+		if err != nil {
+			return fmt.Errorf("couldn't drop view: %w", err)
+		}
+	}
+
+	remapper.remapperTable.reloadIcebergTables()
+	return nil
+}
+
+func (remapper *QueryRemapper) createMaterializedView(node *pgQuery.Node) error {
+	// Extract the schema and table names
+	icebergSchemaTable := common.IcebergSchemaTable{
+		Schema: node.GetCreateTableAsStmt().Into.Rel.Schemaname,
+		Table:  node.GetCreateTableAsStmt().Into.Rel.Relname,
+	}
+	if icebergSchemaTable.Schema == "" {
+		icebergSchemaTable.Schema = PG_SCHEMA_PUBLIC
+	}
+
+	// Extract the definition of the materialized view
+	definitionSelectStmt := node.GetCreateTableAsStmt().Query.GetSelectStmt()
+	definitionRawStmt := &pgQuery.RawStmt{Stmt: &pgQuery.Node{Node: &pgQuery.Node_SelectStmt{SelectStmt: definitionSelectStmt}}}
+	definition, err := pgQuery.Deparse(&pgQuery.ParseResult{Stmts: []*pgQuery.RawStmt{definitionRawStmt}})
+	if err != nil {
+		return fmt.Errorf("couldn't read definition of CREATE MATERIALIZED VIEW: %w", err)
+	}
+
+	ifNotExists := node.GetCreateTableAsStmt().IfNotExists
+
+	// Store the materialized view in the catalog
+	err = remapper.IcebergWriter.CreateMaterializedView(icebergSchemaTable, definition, ifNotExists)
+	if err != nil {
+		if strings.HasPrefix(err.Error(), "ERROR: duplicate key value violates unique constraint") {
+			return fmt.Errorf("relation %s already exists", icebergSchemaTable.String())
+		} else {
+			return fmt.Errorf("couldn't create materialized view: %w", err)
+		}
+	}
+
+	// Refresh the materialized view if it is not a "CREATE MATERIALIZED VIEW ... WITH NO DATA" statement
+	if !node.GetCreateTableAsStmt().Into.SkipData {
+		queryStatements, _, err := remapper.ParseAndRemapQuery(definition)
+		if err != nil {
+			deleteErr := remapper.IcebergWriter.DropMaterializedView(icebergSchemaTable, true)
+			if deleteErr != nil {
+				return fmt.Errorf("couldn't remap definition of CREATE MATERIALIZED VIEW: %w (%w)", err, deleteErr)
+			}
+			return fmt.Errorf("couldn't remap definition of CREATE MATERIALIZED VIEW: %w", err)
+		}
+
+		err = remapper.IcebergWriter.RefreshMaterializedView(icebergSchemaTable, queryStatements[0])
+		if err != nil {
+			deleteErr := remapper.IcebergWriter.DropMaterializedView(icebergSchemaTable, true)
+			if deleteErr != nil {
+				return fmt.Errorf("couldn't refresh materialized view: %w (%w)", err, deleteErr)
+			}
+			return fmt.Errorf("couldn't refresh materialized view: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (remapper *QueryRemapper) dropMaterializedViewFromNode(node *pgQuery.Node) error {
+	var icebergSchemaTable common.IcebergSchemaTable
+	dropStatement := node.GetDropStmt()
+	nodeItems := dropStatement.Objects[0].GetList().Items
+
+	switch len(nodeItems) {
+	case 3:
+		if nodeItems[0].GetString_().Sval != remapper.currentDatabase() {
+			return fmt.Errorf("cross-database materialized view drop is not supported: %s", nodeItems[0].GetString_().Sval)
+		}
+		icebergSchemaTable = common.IcebergSchemaTable{
+			Schema: nodeItems[1].GetString_().Sval,
+			Table:  nodeItems[2].GetString_().Sval,
+		}
+	case 2:
+		icebergSchemaTable = common.IcebergSchemaTable{
+			Schema: nodeItems[0].GetString_().Sval,
+			Table:  nodeItems[1].GetString_().Sval,
+		}
+	case 1:
+		icebergSchemaTable = common.IcebergSchemaTable{
+			Schema: PG_SCHEMA_PUBLIC,
+			Table:  nodeItems[0].GetString_().Sval,
+		}
+	default:
+		return errors.New("couldn't read DROP MATERIALIZED VIEW statement")
+	}
+
+	// DROP TABLE table, e.g. a table created with CREATE TABLE ... AS
+	remapper.remapperTable.reloadIcebergTables()
+	if dropStatement.RemoveType == pgQuery.ObjectType_OBJECT_TABLE && remapper.remapperTable.IcebergPersistentSchemaTables.Contains(icebergSchemaTable) {
+		err := remapper.IcebergWriter.DropTable(icebergSchemaTable)
+		if err != nil {
+			return err
+		}
+		remapper.remapperTable.reloadIcebergTables()
+		return nil
+	}
+
+	// Drop the materialized view from the catalog
+	err := remapper.IcebergWriter.DropMaterializedView(icebergSchemaTable, dropStatement.MissingOk)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (remapper *QueryRemapper) refreshMaterializedViewFromNode(node *pgQuery.Node) error {
+	icebergSchemaTable := common.IcebergSchemaTable{
+		Schema: node.GetRefreshMatViewStmt().Relation.Schemaname,
+		Table:  node.GetRefreshMatViewStmt().Relation.Relname,
+	}
+	if icebergSchemaTable.Schema == "" {
+		icebergSchemaTable.Schema = PG_SCHEMA_PUBLIC
+	}
+
+	materializedView, err := remapper.IcebergReader.MaterializedView(icebergSchemaTable)
+	if err != nil {
+		return err
+	}
+
+	queryStatements, _, err := remapper.ParseAndRemapQuery(materializedView.Definition)
+	if err != nil {
+		return fmt.Errorf("couldn't remap definition of REFRESH MATERIALIZED VIEW: %w", err)
+	}
+
+	if node.GetRefreshMatViewStmt().Concurrent {
+		goWithPanicHandler(remapper.config, func() {
+			err := remapper.IcebergWriter.RefreshMaterializedView(icebergSchemaTable, queryStatements[0])
+			if err != nil {
+				common.LogError(remapper.config.CommonConfig, "couldn't refresh materialized view concurrently: %s", err)
+			}
+		})
+	} else {
+		err = remapper.IcebergWriter.RefreshMaterializedView(icebergSchemaTable, queryStatements[0])
+		if err != nil {
+			return fmt.Errorf("couldn't refresh materialized view: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// ALTER TABLE temp_table ... -> runs in DuckDB as is.
+// ALTER TABLE table ADD COLUMN ... / DROP COLUMN ... / RENAME COLUMN ... TO ... -> rewrites the table with the new columns,
+// e.g. SELECT id, name AS full_name, CAST(NULL AS int) AS age FROM table. Added columns are NULL in the existing rows
+func (remapper *QueryRemapper) alterTableColumns(stmt *pgQuery.RawStmt) (*pgQuery.RawStmt, error) {
+	relation := stmt.Stmt.GetAlterTableStmt().GetRelation()
+	missingOk := stmt.Stmt.GetAlterTableStmt().GetMissingOk()
+	if stmt.Stmt.GetRenameStmt() != nil {
+		relation = stmt.Stmt.GetRenameStmt().Relation
+		missingOk = stmt.Stmt.GetRenameStmt().MissingOk
+	}
+	if remapper.tempTables.RemapTable(remapper.Session, relation) {
+		return stmt, nil
+	}
+
+	err := remapper.checkChangedIcebergTable(relation)
+	if err != nil {
+		var pgError *PgError
+		if missingOk && errors.As(err, &pgError) && pgError.Code == PG_ERROR_CODE_UNDEFINED_TABLE {
+			return NOOP_QUERY_TREE.Stmts[0], nil
+		}
+		return nil, err
+	}
+	icebergSchemaTable := remapper.changedIcebergSchemaTable(relation)
+
+	catalogTableColumns, err := remapper.remapperTable.icebergReader.TableColumns(icebergSchemaTable)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read columns of table %s: %w", icebergSchemaTable.String(), err)
+	}
+	var targets []*pgQuery.ResTarget
+	for _, catalogTableColumn := range catalogTableColumns {
+		targets = append(targets, &pgQuery.ResTarget{
+			Name: catalogTableColumn.Name,
+			Val:  pgQuery.MakeColumnRefNode([]*pgQuery.Node{pgQuery.MakeStrNode(catalogTableColumn.Name)}, 0),
+		})
+	}
+	targetIndex := func(name string) int {
+		return slices.IndexFunc(targets, func(target *pgQuery.ResTarget) bool { return target.Name == name })
+	}
+
+	if stmt.Stmt.GetRenameStmt() != nil {
+		renameStatement := stmt.Stmt.GetRenameStmt()
+		i := targetIndex(renameStatement.Subname)
+		if i == -1 {
+			return nil, &PgError{Code: PG_ERROR_CODE_UNDEFINED_COLUMN, Message: "column \"" + renameStatement.Subname + "\" does not exist"}
+		}
+		if targetIndex(renameStatement.Newname) != -1 {
+			return nil, &PgError{Code: PG_ERROR_CODE_DUPLICATE_COLUMN, Message: "column \"" + renameStatement.Newname + "\" of relation \"" + icebergSchemaTable.Table + "\" already exists"}
+		}
+		targets[i].Name = renameStatement.Newname
+	}
+
+	for _, cmdNode := range stmt.Stmt.GetAlterTableStmt().GetCmds() {
+		cmd := cmdNode.GetAlterTableCmd()
+		switch cmd.Subtype {
+		case pgQuery.AlterTableType_AT_AddColumn:
+			columnDef := cmd.Def.GetColumnDef()
+			if len(columnDef.Constraints) > 0 {
+				return nil, &PgError{Code: PG_ERROR_CODE_FEATURE_NOT_SUPPORTED, Message: "ADD COLUMN with constraints or defaults is not supported"}
+			}
+			if targetIndex(columnDef.Colname) != -1 {
+				if cmd.MissingOk { // ADD COLUMN IF NOT EXISTS
+					continue
+				}
+				return nil, &PgError{Code: PG_ERROR_CODE_DUPLICATE_COLUMN, Message: "column \"" + columnDef.Colname + "\" of relation \"" + icebergSchemaTable.Table + "\" already exists"}
+			}
+			nullValue := &pgQuery.Node{Node: &pgQuery.Node_AConst{AConst: &pgQuery.A_Const{Isnull: true}}}
+			typeCast := &pgQuery.Node{Node: &pgQuery.Node_TypeCast{TypeCast: &pgQuery.TypeCast{Arg: nullValue, TypeName: columnDef.TypeName}}}
+			targets = append(targets, &pgQuery.ResTarget{Name: columnDef.Colname, Val: remapper.remapperExpression.RemappedExpression(typeCast)})
+		case pgQuery.AlterTableType_AT_DropColumn:
+			i := targetIndex(cmd.Name)
+			if i == -1 {
+				if cmd.MissingOk { // DROP COLUMN IF EXISTS
+					continue
+				}
+				return nil, &PgError{Code: PG_ERROR_CODE_UNDEFINED_COLUMN, Message: "column \"" + cmd.Name + "\" of relation \"" + icebergSchemaTable.Table + "\" does not exist"}
+			}
+			targets = slices.Delete(targets, i, i+1)
+		default:
+			return nil, &PgError{
+				Code:    PG_ERROR_CODE_FEATURE_NOT_SUPPORTED,
+				Message: "ALTER TABLE " + strings.TrimPrefix(cmd.Subtype.String(), "AT_") + " is not supported",
+				Hint:    "Use ADD COLUMN, DROP COLUMN, or RENAME COLUMN.",
+			}
+		}
+	}
+	if len(targets) == 0 {
+		return nil, &PgError{Code: PG_ERROR_CODE_FEATURE_NOT_SUPPORTED, Message: "tables without columns are not supported"}
+	}
+
+	selectStatement := &pgQuery.SelectStmt{}
+	for _, target := range targets {
+		if target.Val.GetColumnRef() != nil && target.Val.GetColumnRef().Fields[0].GetString_().Sval == target.Name {
+			target.Name = ""
+		}
+		selectStatement.TargetList = append(selectStatement.TargetList, &pgQuery.Node{Node: &pgQuery.Node_ResTarget{ResTarget: target}})
+	}
+	selectRawStmt := &pgQuery.RawStmt{Stmt: &pgQuery.Node{Node: &pgQuery.Node_SelectStmt{SelectStmt: selectStatement}}}
+	selectQuery, err := pgQuery.Deparse(&pgQuery.ParseResult{Stmts: []*pgQuery.RawStmt{selectRawStmt}})
+	if err != nil {
+		return nil, fmt.Errorf("couldn't build the columns of ALTER TABLE: %w", err)
+	}
+
+	err = remapper.IcebergWriter.AlterColumns(icebergSchemaTable, selectQuery)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't alter table: %w", err)
+	}
+	remapper.remapperTable.reloadIcebergTableColumns(icebergSchemaTable)
+
+	return NOOP_QUERY_TREE.Stmts[0], nil
+}
+
+func (remapper *QueryRemapper) renameMaterializedViewFromNode(node *pgQuery.Node) error {
+	icebergSchemaTable := common.IcebergSchemaTable{
+		Schema: node.GetRenameStmt().Relation.Schemaname,
+		Table:  node.GetRenameStmt().Relation.Relname,
+	}
+	if icebergSchemaTable.Schema == "" {
+		icebergSchemaTable.Schema = PG_SCHEMA_PUBLIC
+	}
+
+	renameStatement := node.GetRenameStmt()
+	newName := renameStatement.Newname
+
+	// ALTER TABLE table RENAME TO new_table, e.g. to swap in a table created by dbt
+	remapper.remapperTable.reloadIcebergTables()
+	if renameStatement.RenameType == pgQuery.ObjectType_OBJECT_TABLE && remapper.remapperTable.IcebergPersistentSchemaTables.Contains(icebergSchemaTable) {
+		newIcebergSchemaTable := common.IcebergSchemaTable{Schema: icebergSchemaTable.Schema, Table: newName}
+		if remapper.remapperTable.IcebergPersistentSchemaTables.Contains(newIcebergSchemaTable) || remapper.remapperTable.IcebergMaterlizedSchemaTables.Contains(newIcebergSchemaTable) {
+			return &PgError{Code: PG_ERROR_CODE_DUPLICATE_TABLE, Message: "relation \"" + newName + "\" already exists"}
+		}
+		err := remapper.IcebergWriter.RenameTable(icebergSchemaTable, newName)
+		if err != nil {
+			return err
+		}
+		remapper.remapperTable.reloadIcebergTables()
+		return nil
+	}
+
+	err := remapper.IcebergWriter.RenameMaterializedView(icebergSchemaTable, newName, renameStatement.MissingOk)
+	if err != nil {
+		return fmt.Errorf("couldn't rename table: %w", err)
+	}
+
+	return nil
+}
+
+// DO blocks are supported only if their body is a BEGIN ... END block with plain SQL statements that BemiDB
+// handles without returning rows, e.g.:
+//
+//	DO $$ BEGIN REFRESH MATERIALIZED VIEW a; REFRESH MATERIALIZED VIEW b; END $$
+//
+// PL/pgSQL constructs (DECLARE, IF, LOOP, RAISE, PERFORM, etc.) and other languages aren't supported.
+func (remapper *QueryRemapper) runDoBlockFromNode(node *pgQuery.Node, permissions *map[string][]string) error {
+	body := ""
+	language := "plpgsql"
+	for _, argNode := range node.GetDoStmt().Args {
+		defElem := argNode.GetDefElem()
+		switch defElem.Defname {
+		case "as":
+			body = defElem.Arg.GetString_().Sval
+		case "language":
+			language = defElem.Arg.GetString_().Sval
+		}
+	}
+
+	if strings.ToLower(language) != "plpgsql" {
+		return &PgError{
+			Code:    PG_ERROR_CODE_FEATURE_NOT_SUPPORTED,
+			Message: "language \"" + language + "\" is not supported in DO blocks",
+			Hint:    DO_BLOCK_HINT,
+		}
+	}
+
+	bodyMatch := DO_BLOCK_BODY_REGEX.FindStringSubmatch(body)
+	if bodyMatch == nil {
+		return &PgError{
+			Code:    PG_ERROR_CODE_FEATURE_NOT_SUPPORTED,
+			Message: "DO blocks without a BEGIN ... END body are not supported",
+			Hint:    DO_BLOCK_HINT,
+		}
+	}
+
+	queryTree, err := pgQuery.Parse(bodyMatch[1])
+	if err != nil {
+		return &PgError{
+			Code:    PG_ERROR_CODE_FEATURE_NOT_SUPPORTED,
+			Message: "PL/pgSQL constructs in DO blocks are not supported: " + err.Error(),
+			Hint:    DO_BLOCK_HINT,
+		}
+	}
+
+	// The whole block is validated before running its statements, so that an unsupported statement doesn't leave it half-run
+	for _, stmt := range queryTree.Stmts {
+		if stmt.Stmt.GetSelectStmt() != nil {
+			return &PgError{
+				Code:    PG_ERROR_CODE_SYNTAX_ERROR,
+				Message: "query has no destination for result data",
+				Hint:    DO_BLOCK_HINT,
+			}
+		}
+		if !isDoBlockStatement(stmt.Stmt) {
+			originalStatement, err := pgQuery.Deparse(&pgQuery.ParseResult{Stmts: []*pgQuery.RawStmt{stmt}})
+			if err != nil {
+				return fmt.Errorf("couldn't deparse DO block statement: %w", err)
+			}
+			return &PgError{
+				Code:    PG_ERROR_CODE_FEATURE_NOT_SUPPORTED,
+				Message: "statement is not supported in DO blocks: " + originalStatement,
+				Hint:    DO_BLOCK_HINT,
+			}
+		}
+	}
+
+	remappedStatements, err := remapper.remapStatements(queryTree.Stmts, permissions)
+	if err != nil {
+		return err
+	}
+
+	// E.g., DROP TABLE of a temp table, which needs to be executed by DuckDB
+	for _, remappedStatement := range remappedStatements {
+		if remappedStatement != NOOP_QUERY_TREE.Stmts[0] {
+			statement, err := pgQuery.Deparse(&pgQuery.ParseResult{Stmts: []*pgQuery.RawStmt{remappedStatement}})
+			if err != nil {
+				return fmt.Errorf("couldn't deparse DO block statement: %w", err)
+			}
+			return &PgError{
+				Code:    PG_ERROR_CODE_FEATURE_NOT_SUPPORTED,
+				Message: "statement is not supported in DO blocks: " + statement,
+				Hint:    DO_BLOCK_HINT,
+			}
+		}
+	}
+	return nil
+}
+
+// Statements run by the remapper without DuckDB, e.g. REFRESH MATERIALIZED VIEW. Others, e.g. INSERT, are run by the query handler
+func isDoBlockStatement(node *pgQuery.Node) bool {
+	switch {
+	case node.GetCreateTableAsStmt() != nil:
+		return node.GetCreateTableAsStmt().Into.Rel.Relpersistence != RELPERSISTENCE_TEMP
+	case node.GetVariableSetStmt() != nil,
+		node.GetRefreshMatViewStmt() != nil,
+		node.GetViewStmt() != nil,
+		node.GetCreateSchemaStmt() != nil,
+		node.GetVacuumStmt() != nil,
+		node.GetReindexStmt() != nil,
+		node.GetClusterStmt() != nil:
+		return true
+	case node.GetDropStmt() != nil:
+		removeType := node.GetDropStmt().RemoveType
+		return removeType == pgQuery.ObjectType_OBJECT_TABLE || removeType == pgQuery.ObjectType_OBJECT_VIEW || removeType == pgQuery.ObjectType_OBJECT_MATVIEW
+	case node.GetRenameStmt() != nil:
+		return node.GetRenameStmt().RenameType == pgQuery.ObjectType_OBJECT_TABLE || node.GetRenameStmt().RenameType == pgQuery.ObjectType_OBJECT_MATVIEW
+	}
+	return false
+}
+
+func (remapper *QueryRemapper) vacuumOrAnalyzeFromNode(node *pgQuery.Node) error {
+	vacuumStatement := node.GetVacuumStmt()
 
-		valNode := targetNode.GetResTarget().Val
-		if valNode != nil {
-			targetNode.GetResTarget().Val = remapper.remappedExpressions(valNode, remappedColumnRefs, permissions, indentLevel) // recursion
+	isVacuum := vacuumStatement.IsVacuumcmd
+	isAnalyze := !vacuumStatement.IsVacuumcmd
+	for _, optionNode := range vacuumStatement.Options {
+		if optionNode.GetDefElem() != nil && optionNode.GetDefElem().Defname == "analyze" {
+			isAnalyze = true
 		}
+	}
 
-		// Nested SELECT
-		if valNode.GetSubLink() != nil {
-			subLink := valNode.GetSubLink()
-			subSelect := subLink.Subselect.GetSelectStmt()
-
-			// DuckDB doesn't work with ORDER BY in ARRAY subqueries:
-			//   SELECT ARRAY(SELECT 1 FROM pg_enum ORDER BY enumsortorder)
-			//   > Referenced column "enumsortorder" not found in FROM clause!
-			//
-			// Remove ORDER BY from ARRAY subqueries
-			if subLink.SubLinkType == pgQuery.SubLinkType_ARRAY_SUBLINK && subSelect.SortClause != nil {
-				subSelect.SortClause = nil
-			}
+	var icebergSchemaTables []common.IcebergSchemaTable
+	for _, relationNode := range vacuumStatement.Rels {
+		relation := relationNode.GetVacuumRelation().Relation
+		icebergSchemaTable := common.IcebergSchemaTable{Schema: relation.Schemaname, Table: relation.Relname}
+		if icebergSchemaTable.Schema == "" {
+			icebergSchemaTable.Schema = PG_SCHEMA_PUBLIC
 		}
+		icebergSchemaTables = append(icebergSchemaTables, icebergSchemaTable)
+	}
 
-		selectStatement.TargetList[targetNodeIdx] = targetNode
+	icebergSchemaTables, err := remapper.remapperTable.IcebergSchemaTablesOrAll(icebergSchemaTables)
+	if err != nil {
+		return err
 	}
 
-	// VALUES (...)
-	if len(selectStatement.ValuesLists) > 0 {
-		for i, valuesList := range selectStatement.ValuesLists {
-			for j, value := range valuesList.GetList().Items {
-				if value != nil {
-					selectStatement.ValuesLists[i].GetList().Items[j] = remapper.remapperExpression.RemappedExpression(value)
-				}
+	if isVacuum {
+		remapper.Session.AddNotice("NOTICE", PG_ERROR_CODE_SUCCESSFUL_COMPLETION, "VACUUM doesn't compact tables, their data files are compacted when they are synced")
+	}
+	for _, icebergSchemaTable := range icebergSchemaTables {
+		if isVacuum {
+			remapper.remapperTable.VacuumTable(icebergSchemaTable)
+		}
+		if isAnalyze {
+			err := remapper.remapperTable.AnalyzeTable(remapper.Session.Context(), icebergSchemaTable)
+			if err != nil {
+				return fmt.Errorf("couldn't analyze table %s: %w", icebergSchemaTable.String(), err)
 			}
 		}
 	}
 
-	// DISTINCT ON (column)
-	distinctClauses := selectStatement.GetDistinctClause()
-	for i, distinctNode := range distinctClauses {
-		distinctClauses[i] = remapper.remappedExpressions(distinctNode, remappedColumnRefs, permissions, indentLevel) // recursion
-	}
-
-	return remappedColumnRefs
+	return nil
 }
 
-// Fix the query sent by psql "\d [table]": ... WHERE attrelid = pr.prrelid AND attnum = prattrs[s] ...
-// DuckDB fails with the following errors:
-//
-// 1) INTERNAL Error: Failed to bind column reference "prrelid" [93.3] (bindings: {#[101.0], #[101.1], #[101.2]}) This error signals an assertion failure within DuckDB. This usually occurs due to unexpected conditions or errors in the program's logic.
-// 2) Binder Error: No function matches the given name and argument types 'array_extract(VARCHAR, STRUCT(generate_series BIGINT))'. You might need to add explicit type casts.
-func (remapper *QueryRemapper) removeWhereClause(whereClause *pgQuery.Node) bool {
-	boolExpr := whereClause.GetBoolExpr()
-	if boolExpr == nil || boolExpr.Boolop != pgQuery.BoolExprType_AND_EXPR || len(boolExpr.Args) != 2 {
-		return false
+// Stores the remapped query in the session, EXECUTE substitutes its $n parameters with the passed values.
+// Shares the names with the statements created with the Parse message of the extended query protocol
+func (remapper *QueryRemapper) prepareStatementFromNode(node *pgQuery.Node, permissions *map[string][]string) error {
+	prepareStatement := node.GetPrepareStmt()
+	if remapper.Session.HasPreparedStatement(prepareStatement.Name) {
+		return &PgError{
+			Code:    PG_ERROR_CODE_DUPLICATE_PREPARED_STATEMENT,
+			Message: "prepared statement \"" + prepareStatement.Name + "\" already exists",
+		}
 	}
 
-	arg1 := boolExpr.Args[0].GetAExpr()
-	if arg1 == nil || arg1.Kind != pgQuery.A_Expr_Kind_AEXPR_OP || arg1.Name[0].GetString_().Sval != "=" {
-		return false
+	selectStatement := prepareStatement.Query.GetSelectStmt()
+	if selectStatement == nil {
+		return &PgError{
+			Code:    PG_ERROR_CODE_FEATURE_NOT_SUPPORTED,
+			Message: "only SELECT statements can be prepared",
+		}
 	}
+	remapper.remapSelectStatement(selectStatement, permissions, 1)
 
-	arg2 := boolExpr.Args[1].GetAExpr()
-	if arg2 == nil || arg2.Kind != pgQuery.A_Expr_Kind_AEXPR_OP || arg2.Name[0].GetString_().Sval != "=" {
-		return false
+	var parameterTypes []*pgQuery.TypeName
+	for _, argTypeNode := range prepareStatement.Argtypes {
+		parameterTypes = append(parameterTypes, argTypeNode.GetTypeName())
 	}
 
-	arg1LColRef := arg1.Lexpr.GetColumnRef()
-	if arg1LColRef == nil || len(arg1LColRef.Fields) != 1 || arg1LColRef.Fields[0].GetString_().Sval != "attrelid" {
-		return false
+	remapper.Session.PreparedStatements[prepareStatement.Name] = &SessionPreparedStatement{
+		Name:           prepareStatement.Name,
+		Statement:      &pgQuery.RawStmt{Stmt: &pgQuery.Node{Node: &pgQuery.Node_SelectStmt{SelectStmt: selectStatement}}},
+		ParameterTypes: parameterTypes,
 	}
+	return nil
+}
 
-	arg1RColRef := arg1.Rexpr.GetColumnRef()
-	if arg1RColRef == nil || len(arg1RColRef.Fields) != 2 || arg1RColRef.Fields[0].GetString_().Sval != "pr" || arg1RColRef.Fields[1].GetString_().Sval != "prrelid" {
-		return false
+// EXECUTE name(1, 'a') -> remapped SELECT ... $1 ... $2 with $1 = 1 and $2 = 'a'
+func (remapper *QueryRemapper) remapExecuteStatement(node *pgQuery.Node) (*pgQuery.RawStmt, error) {
+	executeStatement := node.GetExecuteStmt()
+	preparedStatement, ok := remapper.Session.PreparedStatements[executeStatement.Name]
+	if !ok {
+		var err error
+		preparedStatement, err = remapper.extendedPreparedStatement(executeStatement.Name)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	arg2LColRef := arg2.Lexpr.GetColumnRef()
-	if arg2LColRef == nil || len(arg2LColRef.Fields) != 1 || arg2LColRef.Fields[0].GetString_().Sval != "attnum" {
-		return false
+	statement := proto.Clone(preparedStatement.Statement).(*pgQuery.RawStmt)
+
+	parameterCount := len(preparedStatement.ParameterTypes)
+	VisitNodes(statement, func(node *pgQuery.Node) {
+		if paramRef := node.GetParamRef(); paramRef != nil && int(paramRef.Number) > parameterCount {
+			parameterCount = int(paramRef.Number)
+		}
+	})
+	if len(executeStatement.Params) != parameterCount {
+		return nil, &PgError{
+			Code:    PG_ERROR_CODE_SYNTAX_ERROR,
+			Message: "wrong number of parameters for prepared statement \"" + executeStatement.Name + "\"",
+			Detail:  fmt.Sprintf("Expected %d parameters but got %d.", parameterCount, len(executeStatement.Params)),
+		}
 	}
 
-	arg2RIndir := arg2.Rexpr.GetAIndirection()
-	if arg2RIndir == nil || arg2RIndir.Arg.GetColumnRef() == nil || len(arg2RIndir.Arg.GetColumnRef().Fields) != 1 || arg2RIndir.Arg.GetColumnRef().Fields[0].GetString_().Sval != "prattrs" {
-		return false
+	// Parameters are substituted without remapping their tables with permissions, so subqueries are rejected like in PostgreSQL
+	for _, param := range executeStatement.Params {
+		hasSubquery := false
+		VisitNodes(param, func(node *pgQuery.Node) {
+			if node.GetSubLink() != nil {
+				hasSubquery = true
+			}
+		})
+		if hasSubquery {
+			return nil, &PgError{Code: PG_ERROR_CODE_FEATURE_NOT_SUPPORTED, Message: "cannot use subquery in EXECUTE parameter"}
+		}
 	}
-	if len(arg2RIndir.Indirection) != 1 || arg2RIndir.Indirection[0].GetAIndices() == nil || arg2RIndir.Indirection[0].GetAIndices().Uidx.GetColumnRef() == nil || len(arg2RIndir.Indirection[0].GetAIndices().Uidx.GetColumnRef().Fields) != 1 || arg2RIndir.Indirection[0].GetAIndices().Uidx.GetColumnRef().Fields[0].GetString_().Sval != "s" {
-		return false
+
+	params := make([]*pgQuery.Node, len(executeStatement.Params))
+	for i, param := range executeStatement.Params {
+		if i < len(preparedStatement.ParameterTypes) {
+			param = &pgQuery.Node{Node: &pgQuery.Node_TypeCast{TypeCast: &pgQuery.TypeCast{Arg: param, TypeName: preparedStatement.ParameterTypes[i]}}}
+		}
+		params[i] = remapper.remapperExpression.RemappedExpression(param)
 	}
 
-	return true
+	VisitNodes(statement, func(node *pgQuery.Node) {
+		if paramRef := node.GetParamRef(); paramRef != nil {
+			node.Node = proto.Clone(params[paramRef.Number-1]).(*pgQuery.Node).Node
+		}
+	})
+
+	return statement, nil
 }
 
-func (remapper *QueryRemapper) createMaterializedView(node *pgQuery.Node) error {
-	// Extract the schema and table names
-	icebergSchemaTable := common.IcebergSchemaTable{
-		Schema: node.GetCreateTableAsStmt().Into.Rel.Schemaname,
-		Table:  node.GetCreateTableAsStmt().Into.Rel.Relname,
-	}
-	if icebergSchemaTable.Schema == "" {
-		icebergSchemaTable.Schema = PG_SCHEMA_PUBLIC
+// Parse message with a name -> the remapped SELECT with $n parameters for EXECUTE
+func (remapper *QueryRemapper) extendedPreparedStatement(name string) (*SessionPreparedStatement, error) {
+	extendedStatement, err := remapper.Session.ExtendedStatement(name)
+	if err != nil || name == "" {
+		return nil, &PgError{
+			Code:    PG_ERROR_CODE_INVALID_SQL_STATEMENT_NAME,
+			Message: "prepared statement \"" + name + "\" does not exist",
+		}
 	}
 
-	// Extract the definition of the materialized view
-	definitionSelectStmt := node.GetCreateTableAsStmt().Query.GetSelectStmt()
-	definitionRawStmt := &pgQuery.RawStmt{Stmt: &pgQuery.Node{Node: &pgQuery.Node_SelectStmt{SelectStmt: definitionSelectStmt}}}
-	definition, err := pgQuery.Deparse(&pgQuery.ParseResult{Stmts: []*pgQuery.RawStmt{definitionRawStmt}})
-	if err != nil {
-		return fmt.Errorf("couldn't read definition of CREATE MATERIALIZED VIEW: %w", err)
+	queryTree, err := pgQuery.Parse(extendedStatement.Query)
+	if err != nil || len(queryTree.Stmts) != 1 || queryTree.Stmts[0].Stmt.GetSelectStmt() == nil {
+		return nil, &PgError{
+			Code:    PG_ERROR_CODE_FEATURE_NOT_SUPPORTED,
+			Message: "only SELECT statements can be executed",
+			Detail:  "Prepared statement \"" + name + "\" was created with the Parse message of the extended query protocol.",
+		}
 	}
 
-	ifNotExists := node.GetCreateTableAsStmt().IfNotExists
+	return &SessionPreparedStatement{Name: name, Statement: queryTree.Stmts[0]}, nil
+}
 
-	// Store the materialized view in the catalog
-	err = remapper.IcebergWriter.CreateMaterializedView(icebergSchemaTable, definition, ifNotExists)
+// SELECT ... WHERE id = $1 AND name = $2 with [1, 'a'] -> SELECT ... WHERE id = 1 AND name = 'a'
+//
+// Lets DuckDB plan a remapped query for the bound values (e.g., to prune Iceberg data files by their column stats) instead of
+// reusing the plan of the prepared statement
+func (remapper *QueryRemapper) InlineParameters(query string, parameterValues []interface{}) (string, error) {
+	queryTree, err := pgQuery.Parse(query)
 	if err != nil {
-		if strings.HasPrefix(err.Error(), "ERROR: duplicate key value violates unique constraint") {
-			return fmt.Errorf("relation %s already exists", icebergSchemaTable.String())
-		} else {
-			return fmt.Errorf("couldn't create materialized view: %w", err)
-		}
+		return "", fmt.Errorf("couldn't parse query: %s. %w", query, err)
 	}
 
-	// Refresh the materialized view if it is not a "CREATE MATERIALIZED VIEW ... WITH NO DATA" statement
-	if !node.GetCreateTableAsStmt().Into.SkipData {
-		queryStatements, _, err := remapper.ParseAndRemapQuery(definition)
-		if err != nil {
-			deleteErr := remapper.IcebergWriter.DropMaterializedView(icebergSchemaTable, true)
-			if deleteErr != nil {
-				return fmt.Errorf("couldn't remap definition of CREATE MATERIALIZED VIEW: %w (%w)", err, deleteErr)
+	params := make([]*pgQuery.Node, len(parameterValues))
+	for i, value := range parameterValues {
+		switch value := value.(type) {
+		case nil:
+			params[i] = &pgQuery.Node{Node: &pgQuery.Node_AConst{AConst: &pgQuery.A_Const{Isnull: true}}}
+		case string:
+			params[i] = pgQuery.MakeAConstStrNode(value, 0)
+		case int32:
+			params[i] = pgQuery.MakeAConstIntNode(int64(value), 0)
+		case int64:
+			if value >= math.MinInt32 && value <= math.MaxInt32 {
+				params[i] = pgQuery.MakeAConstIntNode(value, 0)
+				break
 			}
-			return fmt.Errorf("couldn't remap definition of CREATE MATERIALIZED VIEW: %w", err)
+			params[i] = &pgQuery.Node{Node: &pgQuery.Node_AConst{AConst: &pgQuery.A_Const{Val: &pgQuery.A_Const_Fval{Fval: &pgQuery.Float{Fval: common.Int64ToString(value)}}}}}
+		default:
+			return "", fmt.Errorf("unsupported parameter value: %v", value)
 		}
+	}
 
-		err = remapper.IcebergWriter.RefreshMaterializedView(icebergSchemaTable, queryStatements[0])
-		if err != nil {
-			deleteErr := remapper.IcebergWriter.DropMaterializedView(icebergSchemaTable, true)
-			if deleteErr != nil {
-				return fmt.Errorf("couldn't refresh materialized view: %w (%w)", err, deleteErr)
+	for _, stmt := range queryTree.Stmts {
+		var err error
+		VisitNodes(stmt, func(node *pgQuery.Node) {
+			if paramRef := node.GetParamRef(); paramRef != nil {
+				if int(paramRef.Number) > len(params) {
+					err = fmt.Errorf("there is no parameter $%d", paramRef.Number)
+					return
+				}
+				node.Node = proto.Clone(params[paramRef.Number-1]).(*pgQuery.Node).Node
 			}
-			return fmt.Errorf("couldn't refresh materialized view: %w", err)
+		})
+		if err != nil {
+			return "", err
 		}
 	}
 
+	return pgQuery.Deparse(queryTree)
+}
+
+func (remapper *QueryRemapper) deallocateStatementFromNode(node *pgQuery.Node) error {
+	deallocateStatement := node.GetDeallocateStmt()
+	if deallocateStatement.Isall {
+		clear(remapper.Session.PreparedStatements)
+		remapper.Session.CloseExtendedStatements()
+		return nil
+	}
+
+	// Statements created with the Parse message of the extended query protocol share the names with PREPARE
+	if remapper.Session.CloseExtendedStatement(deallocateStatement.Name) {
+		return nil
+	}
+
+	if _, ok := remapper.Session.PreparedStatements[deallocateStatement.Name]; !ok {
+		return &PgError{
+			Code:    PG_ERROR_CODE_INVALID_SQL_STATEMENT_NAME,
+			Message: "prepared statement \"" + deallocateStatement.Name + "\" does not exist",
+		}
+	}
+	delete(remapper.Session.PreparedStatements, deallocateStatement.Name)
 	return nil
 }
 
-func (remapper *QueryRemapper) dropMaterializedViewFromNode(node *pgQuery.Node) error {
-	var icebergSchemaTable common.IcebergSchemaTable
-	dropStatement := node.GetDropStmt()
-	nodeItems := dropStatement.Objects[0].GetList().Items
+// SELECT ... FROM users JOIN pg_class ... -> [public.users], only Iceberg tables and materialized views loaded while remapping,
+// including the tables read by views, and files read by DuckDB, e.g. FROM read_parquet('s3://...') -> [read_parquet('s3://...')]
+func (remapper *QueryRemapper) ReferencedDataTables(query string) ([]string, error) {
+	tables := make(common.Set[string])
+	err := remapper.addReferencedDataTables(query, false, tables)
+	if err != nil {
+		return nil, err
+	}
 
-	switch len(nodeItems) {
-	case 3:
-		if nodeItems[0].GetString_().Sval != remapper.config.Database {
-			return fmt.Errorf("cross-database materialized view drop is not supported: %s", nodeItems[0].GetString_().Sval)
+	values := tables.Values()
+	slices.Sort(values)
+	return values, nil
+}
+
+// Unqualified tables in view definitions are looked up in the public schema like when the view was created
+func (remapper *QueryRemapper) addReferencedDataTables(query string, viewDefinition bool, tables common.Set[string]) error {
+	parser := remapper.remapperTable.parserTable
+	qSchemaTables, err := parser.ReferencedQuerySchemaTables(query)
+	if err != nil {
+		return err
+	}
+	cteNames, err := parser.CommonTableExpressionNames(query)
+	if err != nil {
+		return err
+	}
+
+	for _, qSchemaTable := range qSchemaTables {
+		if qSchemaTable.Schema == "" && cteNames.Contains(qSchemaTable.Table) {
+			continue
 		}
-		icebergSchemaTable = common.IcebergSchemaTable{
-			Schema: nodeItems[1].GetString_().Sval,
-			Table:  nodeItems[2].GetString_().Sval,
+		if !viewDefinition && (qSchemaTable.Schema == "" || qSchemaTable.Schema == PG_SCHEMA_PG_TEMP) && remapper.Session.TempTables.Contains(qSchemaTable.Table) {
+			continue
 		}
-	case 2:
-		icebergSchemaTable = common.IcebergSchemaTable{
-			Schema: nodeItems[0].GetString_().Sval,
-			Table:  nodeItems[1].GetString_().Sval,
+
+		icebergSchemaTable := qSchemaTable.ToIcebergSchemaTable()
+		if !viewDefinition {
+			icebergSchemaTable = remapper.resolveQuerySchemaTable(qSchemaTable).ToIcebergSchemaTable()
 		}
-	case 1:
-		icebergSchemaTable = common.IcebergSchemaTable{
-			Schema: PG_SCHEMA_PUBLIC,
-			Table:  nodeItems[0].GetString_().Sval,
+		if remapper.remapperTable.isIcebergTable(icebergSchemaTable) {
+			tables.Add(icebergSchemaTable.ToArg())
+		} else if definition, ok := remapper.remapperTable.IcebergViews[icebergSchemaTable]; ok {
+			err := remapper.addReferencedDataTables(definition, true, tables) // recursion, views can't reference themselves
+			if err != nil {
+				return err
+			}
+		} else if qSchemaTable.Schema == "" && strings.ContainsAny(qSchemaTable.Table, "./") { // FROM "s3://bucket/file.parquet"
+			tables.Add(qSchemaTable.Table)
 		}
-	default:
-		return errors.New("couldn't read DROP MATERIALIZED VIEW statement")
 	}
 
-	// Drop the materialized view from the catalog
-	err := remapper.IcebergWriter.DropMaterializedView(icebergSchemaTable, dropStatement.MissingOk)
+	functionCalls, err := parser.ReferencedTableFunctionCalls(query)
 	if err != nil {
 		return err
 	}
-
+	for _, functionCall := range functionCalls {
+		functionName, _, _ := strings.Cut(functionCall, "(")
+		if functionName == SAMPLE_TABLES_FUNCTION || !RESTRICTED_TABLE_FUNCTION_NAMES.Contains(strings.ToLower(functionName)) {
+			tables.Add(functionCall)
+		}
+	}
 	return nil
 }
 
-func (remapper *QueryRemapper) refreshMaterializedViewFromNode(node *pgQuery.Node) error {
-	icebergSchemaTable := common.IcebergSchemaTable{
-		Schema: node.GetRefreshMatViewStmt().Relation.Schemaname,
-		Table:  node.GetRefreshMatViewStmt().Relation.Relname,
-	}
-	if icebergSchemaTable.Schema == "" {
-		icebergSchemaTable.Schema = PG_SCHEMA_PUBLIC
-	}
+// Internal copies of Iceberg tables are read only through RemapTable, which applies the user's permissions.
+// Iceberg tables outside the schemas of the connected logical database don't exist for the session,
+// instead of being read from their empty DuckDB tables
+func (remapper *QueryRemapper) checkHiddenTables(query string) error {
+	parser := remapper.remapperTable.parserTable
 
-	materializedView, err := remapper.IcebergReader.MaterializedView(icebergSchemaTable)
+	qSchemaTables, err := parser.ReferencedQuerySchemaTables(query)
 	if err != nil {
 		return err
 	}
+	for _, qSchemaTable := range qSchemaTables {
+		if slices.Contains(INTERNAL_DUCKDB_SCHEMAS, qSchemaTable.Schema) {
+			return undefinedTableError(qSchemaTable)
+		}
+	}
 
-	queryStatements, _, err := remapper.ParseAndRemapQuery(materializedView.Definition)
+	visibleSchemas := remapper.visibleSchemas()
+	if visibleSchemas == nil {
+		return nil
+	}
+	cteNames, err := parser.CommonTableExpressionNames(query)
 	if err != nil {
-		return fmt.Errorf("couldn't remap definition of REFRESH MATERIALIZED VIEW: %w", err)
+		return err
 	}
-
-	if node.GetRefreshMatViewStmt().Concurrent {
-		go func() {
-			err := remapper.IcebergWriter.RefreshMaterializedView(icebergSchemaTable, queryStatements[0])
-			if err != nil {
-				common.LogError(remapper.config.CommonConfig, "couldn't refresh materialized view concurrently: %s", err)
-			}
-		}()
-	} else {
-		err = remapper.IcebergWriter.RefreshMaterializedView(icebergSchemaTable, queryStatements[0])
-		if err != nil {
-			return fmt.Errorf("couldn't refresh materialized view: %w", err)
+	for _, qSchemaTable := range qSchemaTables {
+		if qSchemaTable.Schema == "" && cteNames.Contains(qSchemaTable.Table) {
+			continue
+		}
+		if (qSchemaTable.Schema == "" || qSchemaTable.Schema == PG_SCHEMA_PG_TEMP) && remapper.Session.TempTables.Contains(qSchemaTable.Table) {
+			continue
+		}
+		if remapper.remapperTable.IsSystemTable(qSchemaTable) {
+			continue
+		}
+		schemaTable := remapper.resolveQuerySchemaTable(qSchemaTable).ToIcebergSchemaTable()
+		if !visibleSchemas.Contains(schemaTable.Schema) && remapper.remapperTable.IsIcebergTableOrView(schemaTable) {
+			return undefinedTableError(qSchemaTable)
 		}
 	}
-
 	return nil
 }
 
-func (remapper *QueryRemapper) renameMaterializedViewFromNode(node *pgQuery.Node) error {
-	icebergSchemaTable := common.IcebergSchemaTable{
-		Schema: node.GetRenameStmt().Relation.Schemaname,
-		Table:  node.GetRenameStmt().Relation.Relname,
+// Restricted users can only read Iceberg tables and views, with their permissions and row filters, and system tables.
+// Other relations and table functions would be read by DuckDB as is, e.g. its internal schemas, files with FROM "s3://bucket/file.parquet",
+// or read_parquet('s3://...')
+func (remapper *QueryRemapper) checkRestrictedQuery(query string) error {
+	parser := remapper.remapperTable.parserTable
+
+	functionNames, err := parser.ReferencedTableFunctionNames(query)
+	if err != nil {
+		return err
 	}
-	if icebergSchemaTable.Schema == "" {
-		icebergSchemaTable.Schema = PG_SCHEMA_PUBLIC
+	for _, functionName := range functionNames {
+		if !RESTRICTED_TABLE_FUNCTION_NAMES.Contains(strings.ToLower(functionName)) {
+			return &PgError{Code: PG_ERROR_CODE_INSUFFICIENT_PRIVILEGE, Message: "permission denied for function " + functionName}
+		}
 	}
 
-	renameStatement := node.GetRenameStmt()
-	newName := renameStatement.Newname
-
-	err := remapper.IcebergWriter.RenameMaterializedView(icebergSchemaTable, newName, renameStatement.MissingOk)
+	qSchemaTables, err := parser.ReferencedQuerySchemaTables(query)
 	if err != nil {
-		return fmt.Errorf("couldn't rename table: %w", err)
+		return err
+	}
+	cteNames, err := parser.CommonTableExpressionNames(query)
+	if err != nil {
+		return err
 	}
+	for _, qSchemaTable := range qSchemaTables {
+		if qSchemaTable.Schema == "" && cteNames.Contains(qSchemaTable.Table) {
+			continue
+		}
+		if (qSchemaTable.Schema == "" || qSchemaTable.Schema == PG_SCHEMA_PG_TEMP) && remapper.Session.TempTables.Contains(qSchemaTable.Table) {
+			continue
+		}
+		if remapper.remapperTable.IsSystemTable(qSchemaTable) {
+			continue
+		}
+		schemaTable := remapper.resolveQuerySchemaTable(qSchemaTable).ToIcebergSchemaTable()
+		if visibleSchemas := remapper.visibleSchemas(); (visibleSchemas == nil || visibleSchemas.Contains(schemaTable.Schema)) && remapper.remapperTable.IsIcebergTableOrView(schemaTable) {
+			continue
+		}
 
+		return undefinedTableError(qSchemaTable)
+	}
 	return nil
 }
 
+func undefinedTableError(qSchemaTable QuerySchemaTable) error {
+	tableName := qSchemaTable.Table
+	if qSchemaTable.Schema != "" {
+		tableName = qSchemaTable.Schema + "." + tableName
+	}
+	return &PgError{Code: PG_ERROR_CODE_UNDEFINED_TABLE, Message: "relation \"" + tableName + "\" does not exist"}
+}
+
+// Statements changing data shared with other users: views, materialized views, Iceberg tables, and table statistics
+func (remapper *QueryRemapper) isWriteStatement(node *pgQuery.Node) bool {
+	switch {
+	case node.GetCreateTableAsStmt() != nil:
+		return node.GetCreateTableAsStmt().Into.Rel.Relpersistence != RELPERSISTENCE_TEMP
+	case node.GetDropStmt() != nil:
+		return !remapper.isDropTempTables(node.GetDropStmt())
+	case node.GetCopyStmt() != nil:
+		return node.GetCopyStmt().IsFrom
+	case node.GetInsertStmt() != nil:
+		return !remapper.tempTables.IsTempTable(remapper.Session, node.GetInsertStmt().Relation)
+	case node.GetUpdateStmt() != nil:
+		return !remapper.tempTables.IsTempTable(remapper.Session, node.GetUpdateStmt().Relation)
+	case node.GetDeleteStmt() != nil:
+		return !remapper.tempTables.IsTempTable(remapper.Session, node.GetDeleteStmt().Relation)
+	case node.GetAlterTableStmt() != nil:
+		return !remapper.tempTables.IsTempTable(remapper.Session, node.GetAlterTableStmt().Relation)
+	case node.GetRefreshMatViewStmt() != nil, node.GetRenameStmt() != nil, node.GetDoStmt() != nil, node.GetVacuumStmt() != nil, node.GetCreateSchemaStmt() != nil, node.GetViewStmt() != nil:
+		return true
+	}
+	return false
+}
+
 func (remapper *QueryRemapper) extractPermissions(query string) (*map[string][]string, error) {
 	parts := strings.Split(query, "/*"+PERMISSIONS_SQL_COMMENT+" ")
 	if len(parts) != 2 {
@@ -730,6 +2960,54 @@ func (remapper *QueryRemapper) extractPermissions(query string) (*map[string][]s
 	return &permissions, nil
 }
 
+// Database from the startup message, or the default database if the session didn't go through the startup
+// table -> schema.table with the first schema of SET search_path that has the table like for reads, public.table otherwise
+func (remapper *QueryRemapper) changedIcebergSchemaTable(relation *pgQuery.RangeVar) common.IcebergSchemaTable {
+	return remapper.resolveQuerySchemaTable(QuerySchemaTable{Schema: relation.Schemaname, Table: relation.Relname}).ToIcebergSchemaTable()
+}
+
+func (remapper *QueryRemapper) currentDatabase() string {
+	if remapper.Session.Database == "" {
+		return remapper.config.Database
+	}
+	return remapper.Session.Database
+}
+
+// Schemas exposed by the current logical database, nil if it's the default database that exposes all schemas
+func (remapper *QueryRemapper) visibleSchemas() common.Set[string] {
+	schemas, ok := remapper.config.Databases[remapper.currentDatabase()]
+	if !ok {
+		return nil
+	}
+	return common.NewSet[string]().AddAll(schemas)
+}
+
 func (remapper *QueryRemapper) traceTreeTraversal(label string, indentLevel int) {
-	common.LogTrace(remapper.config.CommonConfig, strings.Repeat(">", indentLevel), label)
+	remapper.Session.LogTrace(remapper.config.CommonConfig, strings.Repeat(">", indentLevel), label)
+}
+
+// "5000" -> 5s, "1.5min" -> 1m30s
+func parseStatementTimeout(value string) (time.Duration, bool) {
+	match := STATEMENT_TIMEOUT_REGEX.FindStringSubmatch(value)
+	if match == nil {
+		return 0, false
+	}
+	unit, ok := STATEMENT_TIMEOUT_UNITS[match[2]]
+	if !ok {
+		return 0, false
+	}
+	number, err := strconv.ParseFloat(match[1], 64)
+	if err != nil {
+		return 0, false
+	}
+	return time.Duration(number * float64(unit)), true
+}
+
+// table -> public.table
+func icebergSchemaTableFromRangeVar(relation *pgQuery.RangeVar) common.IcebergSchemaTable {
+	icebergSchemaTable := common.IcebergSchemaTable{Schema: relation.Schemaname, Table: relation.Relname}
+	if icebergSchemaTable.Schema == "" {
+		icebergSchemaTable.Schema = PG_SCHEMA_PUBLIC
+	}
+	return icebergSchemaTable
 }
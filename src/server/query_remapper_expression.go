@@ -66,6 +66,9 @@ func (remapper *QueryRemapperExpression) remappedTypeCast(node *pgQuery.Node) *p
 	case "jsonb":
 		// value::jsonb -> value::json
 		remapper.parserTypeCast.SetTypeName(typeCast, "json")
+	case "tsvector", "tsquery":
+		// value::tsvector -> value::text
+		remapper.parserTypeCast.SetTypeName(typeCast, "text")
 	case "text":
 		// value::(regtype|regnamespace|regclass)::text -> value::text
 		nestedTypeCast := remapper.parserTypeCast.NestedTypeCast(typeCast)
@@ -91,6 +94,9 @@ func (remapper *QueryRemapperExpression) remappedOperatorExpression(node *pgQuer
 	// = ANY('{information_schema, ...}') -> IN ('information_schema', ...)
 	node = remapper.parserAExpr.ConvertedRightAnyStringConstantToIn(node)
 
+	// > ANY('{1,2}') -> (> '1' OR > '2')
+	node = remapper.parserAExpr.ConvertedAnyAllArrayLiteral(node)
+
 	// pg_catalog.[operator] -> [operator]
 	remapper.parserAExpr.RemovePgCatalog(node)
 
@@ -103,6 +109,12 @@ func (remapper *QueryRemapperExpression) remappedOperatorExpression(node *pgQuer
 	// [column] ? 'key' -> json_exists([column], 'key')
 	node = remapper.parserAExpr.RemappedJsonExists(node)
 
+	// [tsvector] @@ [tsquery] -> ts_match_vq([tsvector], [tsquery])
+	node = remapper.parserAExpr.RemappedTextSearchMatch(node)
+
+	// [array] && [array] -> list_has_any([array], [array])
+	node = remapper.parserAExpr.RemappedArrayOperator(node)
+
 	return node
 }
 
@@ -153,10 +165,11 @@ func (remapper *QueryRemapperExpression) remapColumnReference(node *pgQuery.Node
 }
 
 // "value" COLLATE pg_catalog.default -> "value"
+// "value" COLLATE "en_US.utf8" -> "value" COLLATE en
 func (remapper *QueryRemapperExpression) remappedCollateClause(node *pgQuery.Node) *pgQuery.Node {
 	if node.GetCollateClause() == nil {
 		return node
 	}
 
-	return remapper.parserTypeCast.RemovedDefaultCollateClause(node)
+	return remapper.parserTypeCast.RemappedCollateClause(node)
 }
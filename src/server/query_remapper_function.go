@@ -2,6 +2,8 @@ package main
 
 import (
 	"regexp"
+	"strconv"
+	"strings"
 
 	pgQuery "github.com/pganalyze/pg_query_go/v6"
 
@@ -14,13 +16,48 @@ var PG_INFORMATION_SCHEMA_MACRO_FUNCTION_NAMES = common.Set[string]{}
 func CreatePgCatalogMacroQueries(config *Config) []string {
 	result := []string{
 		// Functions
-		"CREATE MACRO aclexplode(aclitem_array) AS json(aclitem_array)",
+		// {grantee=privileges/grantor} -> rows of (grantor, grantee, privilege_type, is_grantable), an empty grantee means PUBLIC
+		`CREATE MACRO aclexplode(aclitem_array) AS unnest(flatten(list_transform(aclitem_array, aclitem ->
+			list_transform(regexp_extract_all(split_part(split_part(aclitem, '=', 2), '/', 1), '[a-zA-Z]\*?'), privilege -> {
+				'grantor': ` + pgRoleOidCase(config, "split_part(split_part(aclitem, '=', 2), '/', 2)") + `,
+				'grantee': ` + pgRoleOidCase(config, "split_part(aclitem, '=', 1)") + `,
+				'privilege_type': CASE left(privilege, 1)
+					WHEN 'a' THEN 'INSERT'
+					WHEN 'r' THEN 'SELECT'
+					WHEN 'w' THEN 'UPDATE'
+					WHEN 'd' THEN 'DELETE'
+					WHEN 'D' THEN 'TRUNCATE'
+					WHEN 'x' THEN 'REFERENCES'
+					WHEN 't' THEN 'TRIGGER'
+					WHEN 'X' THEN 'EXECUTE'
+					WHEN 'U' THEN 'USAGE'
+					WHEN 'C' THEN 'CREATE'
+					WHEN 'T' THEN 'TEMPORARY'
+					WHEN 'c' THEN 'CONNECT'
+					WHEN 'm' THEN 'MAINTAIN'
+				END,
+				'is_grantable': ends_with(privilege, '*')
+			})
+		)))`,
 		"CREATE MACRO current_setting(setting_name) AS '', (setting_name, missing_ok) AS ''",
+		`CREATE MACRO format_type(data_type_oid, type_modifier) AS (
+			SELECT pg_catalog.format_pg_type(logical_type, type_name) ||
+				CASE
+					WHEN type_modifier < 4 THEN ''
+					WHEN logical_type = 'DECIMAL' THEN '(' || ((type_modifier - 4) >> 16) || ',' || ((type_modifier - 4) & 65535) || ')'
+					WHEN logical_type = 'VARCHAR' THEN '(' || (type_modifier - 4) || ')'
+					ELSE ''
+				END
+			FROM duckdb_types() types
+			WHERE types.type_oid = data_type_oid
+		)`,
 		"CREATE MACRO pg_backend_pid() AS 0",
 		"CREATE MACRO pg_cancel_backend(pid) AS true",
 		"CREATE MACRO pg_encoding_to_char(encoding_int) AS 'UTF8'",
 		"CREATE MACRO pg_get_expr(pg_node_tree, relation_oid) AS pg_catalog.pg_get_expr(pg_node_tree, relation_oid), (pg_node_tree, relation_oid, pretty_bool) AS pg_catalog.pg_get_expr(pg_node_tree, relation_oid)",
+		"CREATE MACRO pg_get_function_arguments(func_oid) AS ''",
 		"CREATE MACRO pg_get_function_identity_arguments(func_oid) AS ''",
+		"CREATE MACRO pg_get_function_result(func_oid) AS ''",
 		"CREATE MACRO pg_get_indexdef(index_oid) AS '', (index_oid, column_int) AS '', (index_oid, column_int, pretty_bool) AS ''",
 		"CREATE MACRO pg_get_partkeydef(table_oid) AS ''",
 		"CREATE MACRO pg_get_userbyid(role_id) AS '" + config.User + "'",
@@ -67,6 +104,31 @@ func CreatePgCatalogMacroQueries(config *Config) []string {
 			WHEN 'DD' THEN strftime(timestamp, '%d')
 			ELSE strftime(timestamp, text)
 		END`,
+		// Full-text search on text values, e.g. tsvector 'cat':3 'fat':2 and tsquery 'fat' & !'rat' | 'cat'.
+		// Lexemes are lowercase words without stemming and stop words, like with the "simple" text search configuration,
+		// other configurations and tsquery operators other than &, |, and ! fail instead of returning different matches than Postgres.
+		`CREATE MACRO ts_simple_config(config) AS
+			CASE WHEN config IS NULL OR lower(config) IN ('simple', 'pg_catalog.simple') THEN true
+			ELSE error('text search configuration "' || config || '" is not supported, only "simple" without stemming and stop words is')
+		END`,
+		`CREATE MACRO ts_simple_query(query) AS
+			CASE WHEN query IS NULL OR NOT regexp_matches(query, '[()<>:]') THEN query
+			ELSE error('tsquery "' || query || '" is not supported, only lexemes combined with &, |, and ! without parentheses, phrase search (<->), and prefix matching (:*) are')
+		END`,
+		`CREATE MACRO to_tsvector(document) AS array_to_string(list_transform(list_sort(list_distinct(regexp_extract_all(lower(document), '[\pL\pN]+'))), lexeme -> '''' || lexeme || ''''), ' '),
+			(config, document) AS CASE WHEN ts_simple_config(config) THEN to_tsvector(document) END`,
+		`CREATE MACRO plainto_tsquery(query) AS array_to_string(list_transform(regexp_extract_all(lower(query), '[\pL\pN]+'), lexeme -> '''' || lexeme || ''''), ' & '),
+			(config, query) AS CASE WHEN ts_simple_config(config) THEN plainto_tsquery(query) END`,
+		`CREATE MACRO to_tsquery(query) AS regexp_replace(lower(ts_simple_query(query)), '''?([\pL\pN]+)''?', '''\1''', 'g'),
+			(config, query) AS CASE WHEN ts_simple_config(config) THEN to_tsquery(query) END`,
+		// Quoted lexemes of a tsvector with optional positions, or words of an unparsed text
+		`CREATE MACRO tsvector_to_array(vector) AS
+			CASE WHEN contains(vector, '''') THEN regexp_extract_all(vector, '''([^'']+)''', 1) ELSE regexp_extract_all(lower(vector), '[\pL\pN]+') END`,
+		// Any of the |-separated alternatives has all its lexemes and none of its !-negated lexemes
+		`CREATE MACRO ts_match_vq(vector, query) AS list_bool_or(list_transform(string_split(ts_simple_query(query), '|'), alternative ->
+			list_has_all(tsvector_to_array(vector), regexp_extract_all(regexp_replace(lower(alternative), '!\s*''?[\pL\pN]+''?', '', 'g'), '[\pL\pN]+')) AND
+			NOT list_has_any(tsvector_to_array(vector), regexp_extract_all(lower(alternative), '!\s*''?([\pL\pN]+)', 1))
+		))`,
 
 		// Table functions
 		"CREATE MACRO pg_is_in_recovery() AS TABLE SELECT false AS pg_is_in_recovery",
@@ -92,17 +154,31 @@ func CreatePgCatalogMacroQueries(config *Config) []string {
 			FALSE AS pending_restart
 		FROM duckdb_settings()`,
 		`CREATE MACRO pg_get_keywords() AS TABLE SELECT
-			keyword_name AS word,
-			'U' AS catcode,
-			TRUE AS barelabel,
-			keyword_category AS catdesc,
-			'can be bare label' AS baredesc
-		FROM duckdb_keywords()`,
+			word,
+			catcode,
+			barelabel,
+			CASE catcode
+				WHEN 'U' THEN 'unreserved'
+				WHEN 'C' THEN 'unreserved (cannot be function or type name)'
+				WHEN 'T' THEN 'reserved (can be function or type name)'
+				ELSE 'reserved'
+			END AS catdesc,
+			CASE WHEN barelabel THEN 'can be bare label' ELSE 'requires AS' END AS baredesc
+		FROM (VALUES ` + pgKeywordsValues() + `) keywords(word, catcode, barelabel)`,
 	}
 	PG_CATALOG_MACRO_FUNCTION_NAMES = extractMacroNames(result)
 	return result
 }
 
+// ('abort', 'U', TRUE), ('absent', 'U', TRUE), ...
+func pgKeywordsValues() string {
+	values := make([]string, len(PG_KEYWORDS))
+	for i, keyword := range PG_KEYWORDS {
+		values[i] = "('" + keyword.Word + "', '" + string(keyword.CatCode) + "', " + strings.ToUpper(strconv.FormatBool(keyword.BareLabel)) + ")"
+	}
+	return strings.Join(values, ", ")
+}
+
 func CreateInformationSchemaMacroQueries(config *Config) []string {
 	result := []string{
 		"CREATE MACRO _pg_expandarray(arr) AS STRUCT_PACK(x := unnest(arr), n := unnest(generate_series(1, array_length(arr))))",
@@ -174,6 +250,20 @@ func (remapper *QueryRemapperFunction) RemapFunctionCall(functionCall *pgQuery.F
 	return nil
 }
 
+// current_database() or current_catalog
+func (remapper *QueryRemapperFunction) IsCurrentDatabaseFunction(node *pgQuery.Node) bool {
+	if sqlValueFunction := node.GetSqlvalueFunction(); sqlValueFunction != nil {
+		return sqlValueFunction.Op == pgQuery.SQLValueFunctionOp_SVFOP_CURRENT_CATALOG
+	}
+
+	functionCall := node.GetFuncCall()
+	if functionCall == nil {
+		return false
+	}
+	schemaFunction := remapper.parserFunction.SchemaFunction(functionCall)
+	return (schemaFunction.Schema == PG_SCHEMA_PG_CATALOG || schemaFunction.Schema == "") && schemaFunction.Function == PG_FUNCTION_CURRENT_DATABASE
+}
+
 func (remapper *QueryRemapperFunction) RemapNestedFunctionCalls(functionCall *pgQuery.FuncCall) {
 	nestedFunctionCalls := remapper.parserFunction.NestedFunctionCalls(functionCall)
 	if len(nestedFunctionCalls) == 0 {
@@ -84,3 +84,42 @@ func (remapper *QueryRemapperSelect) SetTargetNameIfEmpty(targetNode *pgQuery.No
 
 	return targetNode
 }
+
+// ORDER BY a, b DESC -> ORDER BY a NULLS LAST, b DESC NULLS FIRST
+//
+// Postgres treats NULLs as larger than any value, while DuckDB sorts NULLs last in both directions by default
+// (configurable via default_null_order). Make the Postgres ordering explicit, so that paginated results and
+// the first row of each DISTINCT ON group picked by DuckDB stay the same.
+func (remapper *QueryRemapperSelect) RemapSortClause(sortClause []*pgQuery.Node) {
+	for _, sortNode := range sortClause {
+		remapper.parserSelect.SetDefaultNullsOrder(sortNode.GetSortBy())
+	}
+}
+
+// SELECT ... ORDER BY ... FETCH FIRST n ROWS WITH TIES -> the rows of the query ranked up to the n-th row
+//
+// DuckDB supports FETCH FIRST n ROWS ONLY (deparsed as LIMIT n), but not WITH TIES.
+func (remapper *QueryRemapperSelect) RemapFetchWithTies(selectStatement *pgQuery.SelectStmt) error {
+	if !remapper.parserSelect.IsFetchWithTies(selectStatement) {
+		return nil
+	}
+
+	return remapper.parserSelect.SetFetchWithTies(selectStatement)
+}
+
+// EXISTS (SELECT * FROM table) -> EXISTS (SELECT 1 FROM table LIMIT 1)
+//
+// EXISTS checks only whether a row is returned, so the selected columns don't matter and the first row is enough.
+// The subquery can then be answered from the Iceberg metadata with SET bemidb.metadata_probes = on.
+func (remapper *QueryRemapperSelect) RemapExistsProbe(selectStatement *pgQuery.SelectStmt) {
+	if !remapper.parserSelect.IsExistsProbe(selectStatement) {
+		return
+	}
+
+	remapper.parserSelect.SetExistsProbeLimit(selectStatement)
+}
+
+// SELECT 1 FROM table LIMIT n -> n, false if the query reads the rows of the table
+func (remapper *QueryRemapperSelect) MetadataProbeLimit(selectStatement *pgQuery.SelectStmt) (int64, bool) {
+	return remapper.parserSelect.MetadataProbeLimit(selectStatement)
+}
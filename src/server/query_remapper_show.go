@@ -30,3 +30,18 @@ func (remapper *QueryRemapperShow) RemapShowStatement(stmt *pgQuery.RawStmt) *pg
 
 	return newStmt
 }
+
+// SHOW var -> SELECT 'value' AS var, for variables that aren't DuckDB settings
+func (remapper *QueryRemapperShow) RemapShowValue(stmt *pgQuery.RawStmt, value string) *pgQuery.RawStmt {
+	return &pgQuery.RawStmt{
+		Stmt: &pgQuery.Node{
+			Node: &pgQuery.Node_SelectStmt{
+				SelectStmt: &pgQuery.SelectStmt{
+					TargetList: []*pgQuery.Node{
+						pgQuery.MakeResTargetNodeWithNameAndVal(remapper.parserShow.VariableName(stmt), pgQuery.MakeAConstStrNode(value, 0), 0),
+					},
+				},
+			},
+		},
+	}
+}
@@ -2,8 +2,13 @@ package main
 
 import (
 	"context"
+	"fmt"
+	"maps"
 	"regexp"
+	"slices"
 	"strings"
+	"sync"
+	"time"
 
 	pgQuery "github.com/pganalyze/pg_query_go/v6"
 
@@ -12,6 +17,13 @@ import (
 
 var PG_CATALOG_TABLE_NAMES = common.Set[string]{}
 
+// DuckDB schemas with internal copies of Iceberg tables, which are read only through the Iceberg tables with the user's permissions
+var INTERNAL_DUCKDB_SCHEMAS = []string{PINNED_TABLES_DUCKDB_SCHEMA, SAMPLE_TABLES_DUCKDB_SCHEMA}
+
+func internalDuckdbSchemasSqlList() string {
+	return "'" + strings.Join(INTERNAL_DUCKDB_SCHEMAS, "', '") + "'"
+}
+
 type QueryRemapperTable struct {
 	parserTable                   *ParserTable
 	parserFunction                *ParserFunction
@@ -19,26 +31,76 @@ type QueryRemapperTable struct {
 	IcebergPersistentSchemaTables common.Set[common.IcebergSchemaTable]
 	IcebergMaterlizedSchemaTables common.Set[common.IcebergSchemaTable]
 	IcebergMaterializedViews      []common.IcebergMaterializedView
+	IcebergViews                  map[common.IcebergSchemaTable]string                         // Definitions of views created with CREATE VIEW
+	IcebergPartitionedTables      map[common.IcebergSchemaTable][]common.IcebergTablePartition // Partitioned source tables read from their synced partitions
+	IcebergSchemas                common.Set[string]                                           // Created with CREATE SCHEMA, possibly without tables
+	viewsWithoutColumns           common.Set[common.IcebergSchemaTable]                        // Created in DuckDB without their columns, e.g. before their tables are synced
+	icebergColumnNames            map[common.IcebergSchemaTable][]string                       // Of the catalog, cached for BEMIDB_IDENTIFIER_CASE=postgres until the tables are reloaded
+	icebergColumnNamesMutex       sync.Mutex
 	icebergReader                 *IcebergReader
+	lockTracker                   *LockTracker
+	connectionLog                 *ConnectionLog
+	statsTracker                  *StatsTracker
+	tableRowCounts                *TableRowCounts
+	catalogChecker                *CatalogChecker
+	pinnedTables                  *PinnedTables        // nilable
+	sampleTables                  *SampleTables        // nilable
 	ServerDuckdbClient            *common.DuckdbClient // nilable
+	SystemTablesDisabled          bool                 // The tables aren't created in DuckDB for pg_class, information_schema, etc. (inactive candidate catalog)
+	systemTablesMutex             sync.Mutex           // Serializes refreshing system tables on read, concurrent DELETE and INSERT conflict in DuckDB
+	reloadMutex                   sync.Mutex           // Serializes reloading the tables with switching the catalog, so the tables of an inactive catalog aren't recreated
 	config                        *Config
 }
 
-func NewQueryRemapperTable(config *Config, icebergReader *IcebergReader, serverDuckdbClient *common.DuckdbClient) *QueryRemapperTable {
+func NewQueryRemapperTable(config *Config, icebergReader *IcebergReader, lockTracker *LockTracker, connectionLog *ConnectionLog, serverDuckdbClient *common.DuckdbClient) *QueryRemapperTable {
+	tableRowCounts := NewTableRowCounts(config, serverDuckdbClient)
 	remapper := &QueryRemapperTable{
-		parserTable:        NewParserTable(config),
-		parserFunction:     NewParserFunction(config),
-		remapperFunction:   NewQueryRemapperFunction(config, icebergReader),
-		icebergReader:      icebergReader,
-		ServerDuckdbClient: serverDuckdbClient,
-		config:             config,
+		parserTable:         NewParserTable(config),
+		parserFunction:      NewParserFunction(config),
+		remapperFunction:    NewQueryRemapperFunction(config, icebergReader),
+		icebergReader:       icebergReader,
+		lockTracker:         lockTracker,
+		connectionLog:       connectionLog,
+		statsTracker:        NewStatsTracker(),
+		tableRowCounts:      tableRowCounts,
+		catalogChecker:      NewCatalogChecker(config, icebergReader, serverDuckdbClient),
+		pinnedTables:        NewPinnedTables(config, icebergReader, serverDuckdbClient),
+		sampleTables:        NewSampleTables(config, icebergReader, serverDuckdbClient, tableRowCounts),
+		viewsWithoutColumns: common.NewSet[common.IcebergSchemaTable](),
+		ServerDuckdbClient:  serverDuckdbClient,
+		config:              config,
+	}
+	remapper.reloadIcebergTables()
+	remapper.pinnedTables.LoadAll()
+	goWithPanicHandler(config, remapper.sampleTables.Run)
+	return remapper
+}
+
+// Reads the tables of a candidate catalog, without pinned tables and without listing them in the system tables until it's activated
+func NewCandidateQueryRemapperTable(config *Config, icebergReader *IcebergReader, lockTracker *LockTracker, connectionLog *ConnectionLog, serverDuckdbClient *common.DuckdbClient) *QueryRemapperTable {
+	remapper := &QueryRemapperTable{
+		parserTable:          NewParserTable(config),
+		parserFunction:       NewParserFunction(config),
+		remapperFunction:     NewQueryRemapperFunction(config, icebergReader),
+		icebergReader:        icebergReader,
+		lockTracker:          lockTracker,
+		connectionLog:        connectionLog,
+		statsTracker:         NewStatsTracker(),
+		tableRowCounts:       NewTableRowCounts(config, serverDuckdbClient),
+		catalogChecker:       NewCatalogChecker(config, icebergReader, serverDuckdbClient),
+		viewsWithoutColumns:  common.NewSet[common.IcebergSchemaTable](),
+		ServerDuckdbClient:   serverDuckdbClient,
+		SystemTablesDisabled: true,
+		config:               config,
 	}
 	remapper.reloadIcebergTables()
 	return remapper
 }
 
 // FROM / JOIN [TABLE]
-func (remapper *QueryRemapperTable) RemapTable(node *pgQuery.Node, permissions *map[string][]string) *pgQuery.Node {
+//
+// visibleSchemas limits Iceberg tables to the schemas exposed by the connected logical database (nil if all are exposed)
+func (remapper *QueryRemapperTable) RemapTable(node *pgQuery.Node, permissions *map[string][]string, rowFilters map[string]string, visibleSchemas common.Set[string]) *pgQuery.Node {
 	parser := remapper.parserTable
 	qSchemaTable := parser.NodeToQuerySchemaTable(node)
 
@@ -57,8 +119,21 @@ func (remapper *QueryRemapperTable) RemapTable(node *pgQuery.Node, permissions *
 
 		// pg_matviews -> reload Iceberg materialized views
 		case PG_TABLE_PG_MATVIEWS:
-			remapper.reloadIcebergMaterializedViews()
+			remapper.withReloadLock(remapper.reloadIcebergMaterializedViews)
 			remapper.upsertPgMatviews()
+
+		// pg_views -> reload views
+		case PG_TABLE_PG_VIEWS:
+			remapper.withReloadLock(remapper.reloadIcebergViews)
+		}
+
+		// pg_class, pg_namespace, etc. -> exclude schemas hidden from the connected logical database
+		if visibleSchemas != nil {
+			if hiddenSchemas := remapper.hiddenSchemas(visibleSchemas); len(hiddenSchemas) > 0 {
+				if tableNode := parser.MakePgCatalogWithoutSchemasNode(qSchemaTable, hiddenSchemas); tableNode != nil {
+					return tableNode
+				}
+			}
 		}
 
 		// pg_catalog.[table] -> main.[table] for tables defined in CreatePgCatalogTableQueries
@@ -78,12 +153,17 @@ func (remapper *QueryRemapperTable) RemapTable(node *pgQuery.Node, permissions *
 		// information_schema.tables -> (SELECT * FROM main.tables WHERE table_schema || '.' || table_name IN ('permitted.table')) information_schema_tables
 		case PG_TABLE_TABLES:
 			remapper.reloadIcebergTables()
-			return parser.MakeInformationSchemaTablesNode(qSchemaTable, permissions)
+			return parser.MakeInformationSchemaTablesNode(qSchemaTable, permissions, visibleSchemas)
+
+		// information_schema.views -> (SELECT * FROM main.views) information_schema_views
+		case PG_TABLE_VIEWS:
+			remapper.reloadIcebergTables()
+			return parser.MakeInformationSchemaViewsNode(qSchemaTable, permissions, visibleSchemas)
 
 		// information_schema.columns -> (SELECT * FROM main.columns) information_schema_columns
 		// information_schema.columns -> (SELECT * FROM main.columns WHERE (table_schema || '.' || table_name IN ('permitted.table') AND column_name IN ('permitted', 'columns')) OR ...) information_schema_columns
 		case PG_TABLE_COLUMNS:
-			return parser.MakeInformationSchemaColumnsNode(qSchemaTable, permissions)
+			return parser.MakeInformationSchemaColumnsNode(qSchemaTable, permissions, visibleSchemas)
 		}
 
 		// information_schema.* other system tables -> return as is
@@ -94,21 +174,127 @@ func (remapper *QueryRemapperTable) RemapTable(node *pgQuery.Node, permissions *
 	// schema.table -> (SELECT * FROM iceberg_scan('path')) schema_table
 	// public.table -> (SELECT permitted, columns FROM iceberg_scan('path')) table
 	// public.table -> (SELECT NULL WHERE FALSE) table
+	// public.table -> (SELECT * FROM iceberg_scan('path') WHERE (tenant_id = '1')) table
 	schemaTable := qSchemaTable.ToIcebergSchemaTable()
-	if !remapper.IcebergPersistentSchemaTables.Contains(schemaTable) && !remapper.IcebergMaterlizedSchemaTables.Contains(schemaTable) { // Reload Iceberg tables if not found
+	if visibleSchemas != nil && !visibleSchemas.Contains(schemaTable.Schema) {
+		return node // Let it return "Catalog Error: Table with name _ does not exist!"
+	}
+	if !remapper.isIcebergTable(schemaTable) { // Reload Iceberg tables if not found
 		remapper.reloadIcebergTables()
-		if !remapper.IcebergPersistentSchemaTables.Contains(schemaTable) && !remapper.IcebergMaterlizedSchemaTables.Contains(schemaTable) {
+		if !remapper.isIcebergTable(schemaTable) {
 			return node // Let it return "Catalog Error: Table with name _ does not exist!"
 		}
 	}
+
+	// public.partitioned_table -> (SELECT * FROM (SELECT ... FROM iceberg_scan('path1') UNION ALL ...) partitions) partitioned_table
+	if icebergTablePartitions, ok := remapper.IcebergPartitionedTables[schemaTable]; ok {
+		queryToIcebergPartitions := make([]QueryToIcebergPartition, len(icebergTablePartitions))
+		for i, icebergTablePartition := range icebergTablePartitions {
+			columnNames := common.NewSet[string]()
+			for _, column := range icebergTablePartition.Columns {
+				columnNames.Add(column.Name)
+			}
+			queryToIcebergPartitions[i] = QueryToIcebergPartition{
+				IcebergTablePath: remapper.icebergReader.MetadataFileS3Path(icebergTablePartition.ToPartitionIcebergSchemaTable()),
+				ColumnNames:      columnNames,
+			}
+		}
+		partitionedTableColumns := remapper.partitionedTableColumns(icebergTablePartitions)
+		columnNames := make([]string, len(partitionedTableColumns))
+		for i, column := range partitionedTableColumns {
+			columnNames[i] = column.Name
+		}
+		return parser.MakeIcebergTableNode(QueryToIcebergTable{
+			QuerySchemaTable: qSchemaTable,
+			RowFilter:        parser.RowFilter(rowFilters, schemaTable),
+			Partitions:       queryToIcebergPartitions,
+			ColumnNames:      columnNames,
+		}, permissions)
+	}
+
 	icebergPath := remapper.icebergReader.MetadataFileS3Path(schemaTable) // iceberg/schema/table/metadata/v1.metadata.json
 
+	// public.pinned_table -> (SELECT * FROM bemidb_pinned."public.pinned_table") pinned_table
+	var pinnedTableName string
+	if remapper.pinnedTables != nil {
+		pinnedTableName = remapper.pinnedTables.DuckdbTableName(schemaTable, icebergPath)
+	}
+
+	return parser.MakeIcebergTableNode(QueryToIcebergTable{
+		QuerySchemaTable: qSchemaTable,
+		IcebergTablePath: icebergPath,
+		PinnedTableName:  pinnedTableName,
+		RowFilter:        parser.RowFilter(rowFilters, schemaTable),
+	}, permissions)
+}
+
+// public.table -> (SELECT * FROM bemidb_samples."public.table") table
+//
+// Returns nil to read the table as usual if it isn't a readable Iceberg table or it isn't sampled (yet)
+func (remapper *QueryRemapperTable) RemapSampleTable(node *pgQuery.Node, permissions *map[string][]string, rowFilters map[string]string, visibleSchemas common.Set[string]) *pgQuery.Node {
+	parser := remapper.parserTable
+	qSchemaTable := parser.NodeToQuerySchemaTable(node)
+	if remapper.sampleTables == nil || remapper.isTableFromPgCatalog(qSchemaTable) || parser.IsTableFromInformationSchema(qSchemaTable) || qSchemaTable.Schema == BEMIDB_SCHEMA {
+		return nil
+	}
+
+	schemaTable := qSchemaTable.ToIcebergSchemaTable()
+	if visibleSchemas != nil && !visibleSchemas.Contains(schemaTable.Schema) {
+		return nil
+	}
+	if !remapper.IcebergPersistentSchemaTables.Contains(schemaTable) {
+		return nil
+	}
+
+	icebergPath := remapper.icebergReader.MetadataFileS3Path(schemaTable)
+	sampleTableName := remapper.sampleTables.DuckdbTableName(schemaTable, icebergPath)
+	if sampleTableName == "" {
+		return nil
+	}
+
 	return parser.MakeIcebergTableNode(QueryToIcebergTable{
 		QuerySchemaTable: qSchemaTable,
 		IcebergTablePath: icebergPath,
+		PinnedTableName:  sampleTableName,
+		RowFilter:        parser.RowFilter(rowFilters, schemaTable),
 	}, permissions)
 }
 
+// SELECT 1 FROM table LIMIT n -> SELECT 1 FROM (SELECT NULL FROM range(min(n, row count))) table
+//
+// Answers probes of dashboards from the row count in the Iceberg metadata file instead of opening Parquet files.
+// Returns nil to read the table as usual if it isn't a readable Iceberg table without a row filter, or the row count can't be read.
+func (remapper *QueryRemapperTable) RemapMetadataProbe(node *pgQuery.Node, permissions *map[string][]string, rowFilters map[string]string, visibleSchemas common.Set[string], limit int64) *pgQuery.Node {
+	parser := remapper.parserTable
+	qSchemaTable := parser.NodeToQuerySchemaTable(node)
+	if remapper.isTableFromPgCatalog(qSchemaTable) || parser.IsTableFromInformationSchema(qSchemaTable) || qSchemaTable.Schema == BEMIDB_SCHEMA {
+		return nil
+	}
+
+	schemaTable := qSchemaTable.ToIcebergSchemaTable()
+	if visibleSchemas != nil && !visibleSchemas.Contains(schemaTable.Schema) {
+		return nil
+	}
+	if !remapper.IcebergPersistentSchemaTables.Contains(schemaTable) && !remapper.IcebergMaterlizedSchemaTables.Contains(schemaTable) {
+		return nil
+	}
+	if permissions != nil {
+		if _, allowed := parser.permittedColumnNames(permissions, schemaTable); !allowed {
+			return nil
+		}
+	}
+	if parser.RowFilter(rowFilters, schemaTable) != "" {
+		return nil
+	}
+
+	rowCount, err := remapper.tableRowCounts.RowCount(remapper.icebergReader.MetadataFileS3Path(schemaTable))
+	if err != nil {
+		common.LogWarn(remapper.config.CommonConfig, "Couldn't read the row count of "+schemaTable.ToArg()+" from the Iceberg metadata:", err)
+		return nil
+	}
+	return parser.MakeMetadataProbeNode(qSchemaTable, min(rowCount, limit))
+}
+
 // FROM FUNCTION()
 func (remapper *QueryRemapperTable) RemapTableFunctionCall(rangeFunction *pgQuery.RangeFunction) {
 	schemaFunction := remapper.parserTable.TopLevelSchemaFunction(rangeFunction)
@@ -134,8 +320,135 @@ func (remapper *QueryRemapperTable) RemapTableFunctionCall(rangeFunction *pgQuer
 }
 
 func (remapper *QueryRemapperTable) reloadIcebergTables() {
+	remapper.withReloadLock(remapper.reloadIcebergSchemasAndTables)
+}
+
+func (remapper *QueryRemapperTable) withReloadLock(reloadFunc func()) {
+	remapper.reloadMutex.Lock()
+	defer remapper.reloadMutex.Unlock()
+	reloadFunc()
+}
+
+func (remapper *QueryRemapperTable) reloadIcebergSchemasAndTables() {
+	remapper.resetIcebergColumnNames()
+	remapper.reloadIcebergSchemas()
 	remapper.reloadIcebergMaterializedViews()
 	remapper.reloadIcebergPersistentTables()
+	remapper.reloadIcebergPartitionedTables()
+	remapper.reloadIcebergViews()
+}
+
+// pg_catalog.*, information_schema.*, bemidb.connection_log, and bemidb.broken_tables
+func (remapper *QueryRemapperTable) IsSystemTable(qSchemaTable QuerySchemaTable) bool {
+	return remapper.isTableFromPgCatalog(qSchemaTable) ||
+		remapper.parserTable.IsTableFromInformationSchema(qSchemaTable) ||
+		(qSchemaTable.Schema == BEMIDB_SCHEMA && (qSchemaTable.Table == BEMIDB_TABLE_CONNECTION_LOG || qSchemaTable.Table == BEMIDB_TABLE_BROKEN_TABLES))
+}
+
+// Reloads the tables if it isn't known yet
+func (remapper *QueryRemapperTable) IsIcebergTableOrView(icebergSchemaTable common.IcebergSchemaTable) bool {
+	isIcebergTableOrView := func() bool {
+		_, ok := remapper.IcebergViews[icebergSchemaTable]
+		return ok || remapper.isIcebergTable(icebergSchemaTable)
+	}
+	if isIcebergTableOrView() {
+		return true
+	}
+	remapper.reloadIcebergTables()
+	return isIcebergTableOrView()
+}
+
+func (remapper *QueryRemapperTable) isIcebergTable(icebergSchemaTable common.IcebergSchemaTable) bool {
+	if remapper.IcebergPersistentSchemaTables.Contains(icebergSchemaTable) || remapper.IcebergMaterlizedSchemaTables.Contains(icebergSchemaTable) {
+		return true
+	}
+	_, ok := remapper.IcebergPartitionedTables[icebergSchemaTable]
+	return ok
+}
+
+// Names of the Iceberg tables, materialized views, and views in the schema
+func (remapper *QueryRemapperTable) IcebergTableNames(schema string) []string {
+	var tableNames []string
+	addTableName := func(icebergSchemaTable common.IcebergSchemaTable) {
+		if icebergSchemaTable.Schema == schema {
+			tableNames = append(tableNames, icebergSchemaTable.Table)
+		}
+	}
+	for _, icebergSchemaTable := range remapper.IcebergPersistentSchemaTables.Values() {
+		addTableName(icebergSchemaTable)
+	}
+	for _, icebergSchemaTable := range remapper.IcebergMaterlizedSchemaTables.Values() {
+		addTableName(icebergSchemaTable)
+	}
+	for icebergSchemaTable := range remapper.IcebergPartitionedTables {
+		addTableName(icebergSchemaTable)
+	}
+	for icebergSchemaTable := range remapper.IcebergViews {
+		addTableName(icebergSchemaTable)
+	}
+	return tableNames
+}
+
+// Column names of an Iceberg table or materialized view stored in the catalog with its Iceberg schema, returns false for other tables
+func (remapper *QueryRemapperTable) IcebergColumnNames(icebergSchemaTable common.IcebergSchemaTable) ([]string, bool, error) {
+	if !remapper.isIcebergTable(icebergSchemaTable) {
+		return nil, false, nil
+	}
+
+	remapper.icebergColumnNamesMutex.Lock()
+	defer remapper.icebergColumnNamesMutex.Unlock()
+	if columnNames, ok := remapper.icebergColumnNames[icebergSchemaTable]; ok {
+		return columnNames, true, nil
+	}
+
+	catalogTableColumns, err := remapper.icebergTableColumns(icebergSchemaTable)
+	if err != nil {
+		return nil, false, fmt.Errorf("couldn't read columns of table %s: %w", icebergSchemaTable.String(), err)
+	}
+	columnNames := make([]string, len(catalogTableColumns))
+	for i, catalogTableColumn := range catalogTableColumns {
+		columnNames[i] = catalogTableColumn.Name
+	}
+	if remapper.icebergColumnNames == nil {
+		remapper.icebergColumnNames = make(map[common.IcebergSchemaTable][]string)
+	}
+	remapper.icebergColumnNames[icebergSchemaTable] = columnNames
+	return columnNames, true, nil
+}
+
+// Partitioned tables have the columns of all their partitions
+func (remapper *QueryRemapperTable) icebergTableColumns(icebergSchemaTable common.IcebergSchemaTable) ([]common.CatalogTableColumn, error) {
+	if icebergTablePartitions, ok := remapper.IcebergPartitionedTables[icebergSchemaTable]; ok {
+		return remapper.partitionedTableColumns(icebergTablePartitions), nil
+	}
+	return remapper.icebergReader.TableColumns(icebergSchemaTable)
+}
+
+func (remapper *QueryRemapperTable) resetIcebergColumnNames() {
+	remapper.icebergColumnNamesMutex.Lock()
+	defer remapper.icebergColumnNamesMutex.Unlock()
+	remapper.icebergColumnNames = nil
+}
+
+// Schemas without tables are listed in pg_namespace and information_schema.schemata too
+func (remapper *QueryRemapperTable) reloadIcebergSchemas() {
+	newIcebergSchemas, err := remapper.icebergReader.Schemas()
+	common.PanicIfError(remapper.config.CommonConfig, err)
+
+	previousIcebergSchemas := remapper.IcebergSchemas
+	remapper.IcebergSchemas = newIcebergSchemas
+
+	if remapper.SystemTablesDisabled {
+		return
+	}
+
+	ctx := context.Background()
+	for _, schema := range slices.Sorted(maps.Keys(newIcebergSchemas)) {
+		if !previousIcebergSchemas.Contains(schema) {
+			_, err = remapper.ServerDuckdbClient.ExecContext(ctx, "CREATE SCHEMA IF NOT EXISTS \""+schema+"\"")
+			common.PanicIfError(remapper.config.CommonConfig, err)
+		}
+	}
 }
 
 func (remapper *QueryRemapperTable) reloadIcebergPersistentTables() {
@@ -150,31 +463,207 @@ func (remapper *QueryRemapperTable) reloadIcebergPersistentTables() {
 	previousIcebergSchemaTables := remapper.IcebergPersistentSchemaTables
 	remapper.IcebergPersistentSchemaTables = newIcebergSchemaTables
 
+	if remapper.SystemTablesDisabled {
+		return
+	}
+
 	ctx := context.Background()
-	// CREATE TABLE IF NOT EXISTS
-	for _, icebergSchemaTable := range newIcebergSchemaTables.Values() {
+	// CREATE TABLE IF NOT EXISTS, in the same order on every start for stable pg_class OIDs
+	for _, icebergSchemaTable := range slices.SortedFunc(maps.Keys(newIcebergSchemaTables), common.CompareIcebergSchemaTables) {
 		if !previousIcebergSchemaTables.Contains(icebergSchemaTable) {
-			catalogTableColumns, err := remapper.icebergReader.TableColumns(icebergSchemaTable)
+			remapper.createIcebergTable(ctx, icebergSchemaTable)
+		}
+	}
+	// DROP TABLE IF EXISTS
+	for _, icebergSchemaTable := range previousIcebergSchemaTables.Values() {
+		if !newIcebergSchemaTables.Contains(icebergSchemaTable) {
+			_, err = remapper.ServerDuckdbClient.ExecContext(ctx, "DROP TABLE IF EXISTS "+icebergSchemaTable.String())
 			common.PanicIfError(remapper.config.CommonConfig, err)
+			remapper.upsertColumnMetadata(icebergSchemaTable, []common.CatalogTableColumn{})
+		}
+	}
+}
 
-			var sqlColumns []string
-			for _, catalogTableColumn := range catalogTableColumns {
-				sqlColumns = append(sqlColumns, catalogTableColumn.ToSql())
-			}
+// Recreates the table in DuckDB with its new columns for the system tables, e.g. after ALTER TABLE ... ADD COLUMN
+func (remapper *QueryRemapperTable) reloadIcebergTableColumns(icebergSchemaTable common.IcebergSchemaTable) {
+	remapper.reloadMutex.Lock()
+	defer remapper.reloadMutex.Unlock()
 
-			_, err = remapper.ServerDuckdbClient.ExecContext(ctx, "CREATE SCHEMA IF NOT EXISTS "+icebergSchemaTable.Schema)
-			common.PanicIfError(remapper.config.CommonConfig, err)
-			_, err = remapper.ServerDuckdbClient.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS "+icebergSchemaTable.String()+" ("+strings.Join(sqlColumns, ", ")+")")
-			common.PanicIfError(remapper.config.CommonConfig, err)
+	remapper.resetIcebergColumnNames()
+	if remapper.SystemTablesDisabled {
+		return
+	}
+
+	ctx := context.Background()
+	_, err := remapper.ServerDuckdbClient.ExecContext(ctx, "DROP TABLE IF EXISTS "+icebergSchemaTable.String())
+	common.PanicIfError(remapper.config.CommonConfig, err)
+	remapper.createIcebergTable(ctx, icebergSchemaTable)
+}
+
+func (remapper *QueryRemapperTable) createIcebergTable(ctx context.Context, icebergSchemaTable common.IcebergSchemaTable) {
+	catalogTableColumns, err := remapper.icebergReader.TableColumns(icebergSchemaTable)
+	common.PanicIfError(remapper.config.CommonConfig, err)
+
+	remapper.createDuckdbTable(ctx, icebergSchemaTable, catalogTableColumns)
+}
+
+func (remapper *QueryRemapperTable) createDuckdbTable(ctx context.Context, icebergSchemaTable common.IcebergSchemaTable, catalogTableColumns []common.CatalogTableColumn) {
+	var sqlColumns []string
+	for _, catalogTableColumn := range catalogTableColumns {
+		sqlColumns = append(sqlColumns, catalogTableColumn.ToSql())
+	}
+
+	_, err := remapper.ServerDuckdbClient.ExecContext(ctx, "CREATE SCHEMA IF NOT EXISTS "+icebergSchemaTable.Schema)
+	common.PanicIfError(remapper.config.CommonConfig, err)
+	_, err = remapper.ServerDuckdbClient.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS "+icebergSchemaTable.String()+" ("+strings.Join(sqlColumns, ", ")+")")
+	common.PanicIfError(remapper.config.CommonConfig, err)
+	remapper.upsertColumnMetadata(icebergSchemaTable, catalogTableColumns)
+}
+
+// Partitions of a partitioned source table are synced as separate tables, e.g. public.events_2025_01 for public.events.
+// The parent table is created in DuckDB with the columns of all partitions for the system tables and read as their union.
+func (remapper *QueryRemapperTable) reloadIcebergPartitionedTables() {
+	icebergTablePartitions, err := remapper.icebergReader.TablePartitions()
+	common.PanicIfError(remapper.config.CommonConfig, err)
+
+	newIcebergPartitionedTables := make(map[common.IcebergSchemaTable][]common.IcebergTablePartition)
+	for _, icebergTablePartition := range icebergTablePartitions {
+		parentSchemaTable := icebergTablePartition.ToIcebergSchemaTable()
+		if remapper.IcebergPersistentSchemaTables.Contains(parentSchemaTable) || remapper.IcebergMaterlizedSchemaTables.Contains(parentSchemaTable) {
+			continue
+		}
+		newIcebergPartitionedTables[parentSchemaTable] = append(newIcebergPartitionedTables[parentSchemaTable], icebergTablePartition)
+	}
+
+	previousIcebergPartitionedTables := remapper.IcebergPartitionedTables
+	remapper.IcebergPartitionedTables = newIcebergPartitionedTables
+
+	if remapper.SystemTablesDisabled {
+		return
+	}
+
+	ctx := context.Background()
+	// CREATE TABLE with the columns of all partitions, recreated after they change
+	for _, icebergSchemaTable := range slices.SortedFunc(maps.Keys(newIcebergPartitionedTables), common.CompareIcebergSchemaTables) {
+		partitions := newIcebergPartitionedTables[icebergSchemaTable]
+		catalogTableColumns := remapper.partitionedTableColumns(partitions)
+		previousPartitions, ok := previousIcebergPartitionedTables[icebergSchemaTable]
+		if ok && slices.Equal(remapper.partitionedTableColumns(previousPartitions), catalogTableColumns) {
+			continue
 		}
+		_, err = remapper.ServerDuckdbClient.ExecContext(ctx, "DROP TABLE IF EXISTS "+icebergSchemaTable.String())
+		common.PanicIfError(remapper.config.CommonConfig, err)
+		remapper.createDuckdbTable(ctx, icebergSchemaTable, catalogTableColumns)
 	}
 	// DROP TABLE IF EXISTS
-	for _, icebergSchemaTable := range previousIcebergSchemaTables.Values() {
-		if !newIcebergSchemaTables.Contains(icebergSchemaTable) {
+	for icebergSchemaTable := range previousIcebergPartitionedTables {
+		if _, ok := newIcebergPartitionedTables[icebergSchemaTable]; !ok {
 			_, err = remapper.ServerDuckdbClient.ExecContext(ctx, "DROP TABLE IF EXISTS "+icebergSchemaTable.String())
 			common.PanicIfError(remapper.config.CommonConfig, err)
+			remapper.upsertColumnMetadata(icebergSchemaTable, []common.CatalogTableColumn{})
+		}
+	}
+}
+
+// Columns of the first partition followed by columns only found in other partitions, nullable unless they're required in all partitions
+func (remapper *QueryRemapperTable) partitionedTableColumns(icebergTablePartitions []common.IcebergTablePartition) []common.CatalogTableColumn {
+	catalogTableColumns := []common.CatalogTableColumn{}
+	for _, icebergTablePartition := range icebergTablePartitions {
+		for _, column := range icebergTablePartition.Columns {
+			index := slices.IndexFunc(catalogTableColumns, func(c common.CatalogTableColumn) bool { return c.Name == column.Name })
+			if index == -1 {
+				catalogTableColumns = append(catalogTableColumns, column)
+			}
+		}
+	}
+	for i := range catalogTableColumns {
+		catalogTableColumns[i].Position = i + 1
+		for _, icebergTablePartition := range icebergTablePartitions {
+			index := slices.IndexFunc(icebergTablePartition.Columns, func(c common.CatalogTableColumn) bool { return c.Name == catalogTableColumns[i].Name })
+			if index == -1 || !icebergTablePartition.Columns[index].Required {
+				catalogTableColumns[i].Required = false
+			}
+		}
+	}
+	return catalogTableColumns
+}
+
+// Drops the tables of the catalog from DuckDB and creates the tables of the other catalog for the system tables instead.
+// Sessions reloading the tables of either catalog wait until the switch is done, so they can't recreate the dropped tables.
+func (remapper *QueryRemapperTable) SwitchSystemTablesTo(otherRemapper *QueryRemapperTable) {
+	remapper.reloadMutex.Lock()
+	defer remapper.reloadMutex.Unlock()
+	otherRemapper.reloadMutex.Lock()
+	defer otherRemapper.reloadMutex.Unlock()
+
+	remapper.disableSystemTables()
+	otherRemapper.enableSystemTables()
+}
+
+// Creates all tables in DuckDB for the system tables after switching to the catalog
+func (remapper *QueryRemapperTable) enableSystemTables() {
+	remapper.SystemTablesDisabled = false
+	remapper.IcebergSchemas = common.NewSet[string]()
+	remapper.IcebergPersistentSchemaTables = common.NewSet[common.IcebergSchemaTable]()
+	remapper.IcebergMaterlizedSchemaTables = common.NewSet[common.IcebergSchemaTable]()
+	remapper.IcebergViews = make(map[common.IcebergSchemaTable]string)
+	remapper.IcebergPartitionedTables = make(map[common.IcebergSchemaTable][]common.IcebergTablePartition)
+	remapper.viewsWithoutColumns = common.NewSet[common.IcebergSchemaTable]()
+	remapper.reloadIcebergSchemasAndTables()
+}
+
+// Drops all tables from DuckDB after switching to another catalog, the other catalog's tables may differ
+func (remapper *QueryRemapperTable) disableSystemTables() {
+	remapper.SystemTablesDisabled = true
+	ctx := context.Background()
+	for _, icebergSchemaTable := range remapper.IcebergPersistentSchemaTables.Values() {
+		_, err := remapper.ServerDuckdbClient.ExecContext(ctx, "DROP TABLE IF EXISTS "+icebergSchemaTable.String())
+		common.PanicIfError(remapper.config.CommonConfig, err)
+		remapper.upsertColumnMetadata(icebergSchemaTable, []common.CatalogTableColumn{})
+	}
+	for icebergSchemaTable := range remapper.IcebergPartitionedTables {
+		_, err := remapper.ServerDuckdbClient.ExecContext(ctx, "DROP TABLE IF EXISTS "+icebergSchemaTable.String())
+		common.PanicIfError(remapper.config.CommonConfig, err)
+		remapper.upsertColumnMetadata(icebergSchemaTable, []common.CatalogTableColumn{})
+	}
+	for _, icebergSchemaTable := range remapper.IcebergMaterlizedSchemaTables.Values() {
+		_, err := remapper.ServerDuckdbClient.ExecContext(ctx, "DROP VIEW IF EXISTS "+icebergSchemaTable.String())
+		common.PanicIfError(remapper.config.CommonConfig, err)
+		_, err = remapper.ServerDuckdbClient.ExecContext(ctx, "DELETE FROM pg_matviews WHERE schemaname = '"+icebergSchemaTable.Schema+"' AND matviewname = '"+icebergSchemaTable.Table+"'")
+		common.PanicIfError(remapper.config.CommonConfig, err)
+	}
+	for icebergSchemaTable := range remapper.IcebergViews {
+		remapper.dropDuckdbView(ctx, icebergSchemaTable)
+	}
+}
+
+// Stores source column metadata that can't be represented in DuckDB tables for information_schema.columns,
+// including source ordinal positions that differ from the DuckDB column index, e.g. after a dropped source column
+func (remapper *QueryRemapperTable) upsertColumnMetadata(icebergSchemaTable common.IcebergSchemaTable, catalogTableColumns []common.CatalogTableColumn) {
+	sqls := []string{"DELETE FROM " + PG_TABLE_COLUMN_METADATA + " WHERE table_schema = '$schema' AND table_name = '$table'"}
+	args := []map[string]string{{"schema": icebergSchemaTable.Schema, "table": icebergSchemaTable.Table}}
+
+	for i, catalogTableColumn := range catalogTableColumns {
+		if catalogTableColumn.Default == "" && catalogTableColumn.GenerationExpression == "" && catalogTableColumn.TypeModifier == 0 && catalogTableColumn.ReferencedTable == "" &&
+			(catalogTableColumn.Position == 0 || catalogTableColumn.Position == i+1) {
+			continue
 		}
+		sqls = append(sqls, "INSERT INTO "+PG_TABLE_COLUMN_METADATA+" VALUES ('$schema', '$table', '$column', NULLIF('$default', ''), NULLIF('$expression', ''), NULLIF($typeModifier, 0), NULLIF('$referencedTable', ''), NULLIF('$referencedColumn', ''), NULLIF($position, 0))")
+		args = append(args, map[string]string{
+			"schema":           icebergSchemaTable.Schema,
+			"table":            icebergSchemaTable.Table,
+			"column":           catalogTableColumn.Name,
+			"default":          catalogTableColumn.Default,
+			"expression":       catalogTableColumn.GenerationExpression,
+			"typeModifier":     common.IntToString(catalogTableColumn.TypeModifier),
+			"referencedTable":  catalogTableColumn.ReferencedTable,
+			"referencedColumn": catalogTableColumn.ReferencedColumn,
+			"position":         common.IntToString(catalogTableColumn.Position),
+		})
 	}
+
+	err := remapper.ServerDuckdbClient.ExecTransactionContext(context.Background(), sqls, args)
+	common.PanicIfError(remapper.config.CommonConfig, err)
 }
 
 func (remapper *QueryRemapperTable) reloadIcebergMaterializedViews() {
@@ -190,9 +679,14 @@ func (remapper *QueryRemapperTable) reloadIcebergMaterializedViews() {
 	previousIcebergSchemaTables := remapper.IcebergMaterlizedSchemaTables
 	remapper.IcebergMaterlizedSchemaTables = newMaterializedSchemaTables
 
+	if remapper.SystemTablesDisabled {
+		return
+	}
+
 	ctx := context.Background()
 	// CREATE VIEW IF NOT EXISTS
-	for _, icebergSchemaTable := range remapper.IcebergMaterlizedSchemaTables.Values() {
+	for _, icebergMaterializedView := range newIcebergMaterializedViews { // Ordered by schema and name
+		icebergSchemaTable := icebergMaterializedView.ToIcebergSchemaTable()
 		if !previousIcebergSchemaTables.Contains(icebergSchemaTable) {
 			_, err = remapper.ServerDuckdbClient.ExecContext(ctx, "CREATE SCHEMA IF NOT EXISTS "+icebergSchemaTable.Schema)
 			common.PanicIfError(remapper.config.CommonConfig, err)
@@ -213,14 +707,165 @@ func (remapper *QueryRemapperTable) reloadIcebergMaterializedViews() {
 	}
 }
 
+// Views are created in DuckDB with their definitions for pg_class and information_schema.columns, queries expand the definitions instead of reading the DuckDB views
+func (remapper *QueryRemapperTable) reloadIcebergViews() {
+	newIcebergViews, err := remapper.icebergReader.Views()
+	common.PanicIfError(remapper.config.CommonConfig, err)
+
+	previousDefinitions := remapper.IcebergViews
+	remapper.IcebergViews = make(map[common.IcebergSchemaTable]string, len(newIcebergViews))
+	for _, icebergView := range newIcebergViews {
+		remapper.IcebergViews[icebergView.ToIcebergSchemaTable()] = icebergView.Definition
+	}
+
+	if remapper.SystemTablesDisabled {
+		return
+	}
+
+	ctx := context.Background()
+	// CREATE OR REPLACE VIEW, also retried for views created without columns whose tables may have been synced since
+	for _, icebergView := range newIcebergViews { // Ordered by schema and name
+		icebergSchemaTable, definition := icebergView.ToIcebergSchemaTable(), icebergView.Definition
+		if previousDefinition, ok := previousDefinitions[icebergSchemaTable]; !ok || previousDefinition != definition || remapper.viewsWithoutColumns.Contains(icebergSchemaTable) {
+			remapper.createDuckdbView(ctx, icebergSchemaTable, definition)
+		}
+	}
+	// DROP VIEW IF EXISTS
+	for icebergSchemaTable := range previousDefinitions {
+		if _, ok := remapper.IcebergViews[icebergSchemaTable]; !ok {
+			remapper.dropDuckdbView(ctx, icebergSchemaTable)
+		}
+	}
+}
+
+func (remapper *QueryRemapperTable) createDuckdbView(ctx context.Context, icebergSchemaTable common.IcebergSchemaTable, definition string) {
+	_, err := remapper.ServerDuckdbClient.ExecContext(ctx, "CREATE SCHEMA IF NOT EXISTS \""+icebergSchemaTable.Schema+"\"")
+	common.PanicIfError(remapper.config.CommonConfig, err)
+	_, err = remapper.ServerDuckdbClient.ExecContext(ctx, "CREATE OR REPLACE VIEW "+icebergSchemaTable.String()+" AS "+definition)
+	if err != nil {
+		// E.g., the definition reads tables that aren't synced yet or calls Postgres functions that are remapped only in queries
+		if !remapper.viewsWithoutColumns.Contains(icebergSchemaTable) {
+			common.LogWarn(remapper.config.CommonConfig, "Couldn't create view", icebergSchemaTable.String(), "in DuckDB, its columns won't be listed:", err)
+		}
+		remapper.viewsWithoutColumns.Add(icebergSchemaTable)
+		_, err = remapper.ServerDuckdbClient.ExecContext(ctx, "CREATE OR REPLACE VIEW "+icebergSchemaTable.String()+" AS SELECT 1")
+		common.PanicIfError(remapper.config.CommonConfig, err)
+	} else {
+		remapper.viewsWithoutColumns.Remove(icebergSchemaTable)
+	}
+
+	err = remapper.ServerDuckdbClient.ExecTransactionContext(ctx, []string{
+		"DELETE FROM pg_views WHERE schemaname = '$schema' AND viewname = '$table'",
+		"INSERT INTO pg_views VALUES ('$schema', '$table', '$owner', '$definition')",
+	}, []map[string]string{
+		{"schema": icebergSchemaTable.Schema, "table": icebergSchemaTable.Table},
+		{"schema": icebergSchemaTable.Schema, "table": icebergSchemaTable.Table, "owner": remapper.config.User, "definition": definition},
+	})
+	common.PanicIfError(remapper.config.CommonConfig, err)
+}
+
+func (remapper *QueryRemapperTable) dropDuckdbView(ctx context.Context, icebergSchemaTable common.IcebergSchemaTable) {
+	remapper.viewsWithoutColumns.Remove(icebergSchemaTable)
+	_, err := remapper.ServerDuckdbClient.ExecContext(ctx, "DROP VIEW IF EXISTS "+icebergSchemaTable.String())
+	common.PanicIfError(remapper.config.CommonConfig, err)
+	_, err = remapper.ServerDuckdbClient.ExecContext(ctx, "DELETE FROM pg_views WHERE schemaname = '$schema' AND viewname = '$table'", map[string]string{"schema": icebergSchemaTable.Schema, "table": icebergSchemaTable.Table})
+	common.PanicIfError(remapper.config.CommonConfig, err)
+}
+
+// Returns the first schema with a table, materialized view, or view with the name, reloading the tables if none has it, or "" if none has it after reloading
+func (remapper *QueryRemapperTable) SearchPathSchema(table string, schemas []string, visibleSchemas common.Set[string]) string {
+	schema := remapper.searchPathSchema(table, schemas, visibleSchemas)
+	if schema == "" {
+		remapper.reloadIcebergTables()
+		schema = remapper.searchPathSchema(table, schemas, visibleSchemas)
+	}
+	return schema
+}
+
+func (remapper *QueryRemapperTable) searchPathSchema(table string, schemas []string, visibleSchemas common.Set[string]) string {
+	for _, schema := range schemas {
+		if visibleSchemas != nil && !visibleSchemas.Contains(schema) {
+			continue
+		}
+		icebergSchemaTable := common.IcebergSchemaTable{Schema: schema, Table: table}
+		if _, ok := remapper.IcebergViews[icebergSchemaTable]; ok || remapper.isIcebergTable(icebergSchemaTable) {
+			return schema
+		}
+	}
+	return ""
+}
+
+// Returns the definition if the table is a view created with CREATE VIEW, reloading the tables if it isn't known yet
+func (remapper *QueryRemapperTable) ViewDefinition(qSchemaTable QuerySchemaTable, visibleSchemas common.Set[string]) (string, bool) {
+	if remapper.isTableFromPgCatalog(qSchemaTable) || remapper.parserTable.IsTableFromInformationSchema(qSchemaTable) || qSchemaTable.Schema == BEMIDB_SCHEMA {
+		return "", false
+	}
+
+	schemaTable := qSchemaTable.ToIcebergSchemaTable()
+	if visibleSchemas != nil && !visibleSchemas.Contains(schemaTable.Schema) {
+		return "", false
+	}
+
+	definition, ok := remapper.IcebergViews[schemaTable]
+	if !ok && !remapper.isIcebergTable(schemaTable) {
+		remapper.reloadIcebergTables()
+		definition, ok = remapper.IcebergViews[schemaTable]
+	}
+	return definition, ok
+}
+
+// Tables read by the view definition that aren't synced yet, e.g. if views are deployed together with the syncs of their tables.
+// Unqualified tables are looked up in the public schema like when the view was created.
+func (remapper *QueryRemapperTable) UnsyncedViewTables(definition string) []common.IcebergSchemaTable {
+	qSchemaTables, err := remapper.parserTable.ReferencedQuerySchemaTables(definition)
+	common.PanicIfError(remapper.config.CommonConfig, err)
+	cteNames, err := remapper.parserTable.CommonTableExpressionNames(definition)
+	common.PanicIfError(remapper.config.CommonConfig, err)
+
+	unsyncedSchemaTables := []common.IcebergSchemaTable{}
+	reloaded := false
+	for _, qSchemaTable := range qSchemaTables {
+		if (qSchemaTable.Schema == "" && cteNames.Contains(qSchemaTable.Table)) || remapper.isTableFromPgCatalog(qSchemaTable) || remapper.parserTable.IsTableFromInformationSchema(qSchemaTable) || qSchemaTable.Schema == BEMIDB_SCHEMA {
+			continue
+		}
+
+		schemaTable := qSchemaTable.ToIcebergSchemaTable()
+		if _, ok := remapper.IcebergViews[schemaTable]; ok || remapper.isIcebergTable(schemaTable) {
+			continue
+		}
+		if !reloaded { // Reload Iceberg tables once if not found
+			remapper.reloadIcebergTables()
+			reloaded = true
+			if _, ok := remapper.IcebergViews[schemaTable]; ok || remapper.isIcebergTable(schemaTable) {
+				continue
+			}
+		}
+		unsyncedSchemaTables = append(unsyncedSchemaTables, schemaTable)
+	}
+	return unsyncedSchemaTables
+}
+
 func (remapper *QueryRemapperTable) upsertPgStatUserTables() {
 	icebergSchemaTables := append(remapper.IcebergPersistentSchemaTables.Values(), remapper.IcebergMaterlizedSchemaTables.Values()...)
+	slices.SortFunc(icebergSchemaTables, common.CompareIcebergSchemaTables)
 
 	sqls := []string{"DELETE FROM pg_stat_user_tables"}
 	if len(icebergSchemaTables) > 0 {
 		values := make([]string, len(icebergSchemaTables))
 		for i, icebergSchemaTable := range icebergSchemaTables {
-			values[i] = "('123456', '" + icebergSchemaTable.Schema + "', '" + icebergSchemaTable.Table + "', 0, NULL, 0, 0, NULL, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, NULL, NULL, NULL, NULL, 0, 0, 0, 0)"
+			liveTupleCount, lastVacuum, lastAnalyze, vacuumCount, analyzeCount := "1", "NULL", "NULL", "0", "0"
+			if stats, ok := remapper.statsTracker.Stats(icebergSchemaTable); ok {
+				if stats.LastAnalyzedAt != nil {
+					liveTupleCount = common.Int64ToString(stats.LiveTupleCount)
+					lastAnalyze = "'" + stats.LastAnalyzedAt.UTC().Format("2006-01-02 15:04:05.999999") + "'"
+				}
+				if stats.LastVacuumedAt != nil {
+					lastVacuum = "'" + stats.LastVacuumedAt.UTC().Format("2006-01-02 15:04:05.999999") + "'"
+				}
+				vacuumCount = common.Int64ToString(stats.VacuumCount)
+				analyzeCount = common.Int64ToString(stats.AnalyzeCount)
+			}
+			values[i] = "('123456', '" + icebergSchemaTable.Schema + "', '" + icebergSchemaTable.Table + "', 0, NULL, 0, 0, NULL, 0, 0, 0, 0, 0, 0, " + liveTupleCount + ", 0, 0, 0, " + lastVacuum + ", NULL, " + lastAnalyze + ", NULL, " + vacuumCount + ", 0, " + analyzeCount + ", 0)"
 		}
 		sqls = append(sqls, "INSERT INTO pg_stat_user_tables VALUES "+strings.Join(values, ", "))
 	}
@@ -228,6 +873,43 @@ func (remapper *QueryRemapperTable) upsertPgStatUserTables() {
 	common.PanicIfError(remapper.config.CommonConfig, err)
 }
 
+// ANALYZE [table] -> count the rows of the Iceberg table for pg_stat_user_tables
+func (remapper *QueryRemapperTable) AnalyzeTable(ctx context.Context, icebergSchemaTable common.IcebergSchemaTable) error {
+	icebergPath := remapper.icebergReader.MetadataFileS3Path(icebergSchemaTable)
+
+	var liveTupleCount int64
+	err := remapper.ServerDuckdbClient.QueryRowContext(ctx, "SELECT COUNT(*) FROM iceberg_scan('$path')", map[string]string{"path": icebergPath}).Scan(&liveTupleCount)
+	if err != nil {
+		return err
+	}
+
+	remapper.statsTracker.TrackAnalyze(icebergSchemaTable, liveTupleCount)
+	return nil
+}
+
+// VACUUM [table] -> no-op, Iceberg data files are compacted by the syncers
+func (remapper *QueryRemapperTable) VacuumTable(icebergSchemaTable common.IcebergSchemaTable) {
+	remapper.statsTracker.TrackVacuum(icebergSchemaTable)
+}
+
+// Returns all Iceberg tables and materialized views if no tables are specified, or an error if any of them doesn't exist
+func (remapper *QueryRemapperTable) IcebergSchemaTablesOrAll(icebergSchemaTables []common.IcebergSchemaTable) ([]common.IcebergSchemaTable, error) {
+	remapper.reloadIcebergTables()
+
+	if len(icebergSchemaTables) == 0 {
+		allIcebergSchemaTables := append(remapper.IcebergPersistentSchemaTables.Values(), remapper.IcebergMaterlizedSchemaTables.Values()...)
+		slices.SortFunc(allIcebergSchemaTables, common.CompareIcebergSchemaTables)
+		return allIcebergSchemaTables, nil
+	}
+
+	for _, icebergSchemaTable := range icebergSchemaTables {
+		if !remapper.IcebergPersistentSchemaTables.Contains(icebergSchemaTable) && !remapper.IcebergMaterlizedSchemaTables.Contains(icebergSchemaTable) {
+			return nil, fmt.Errorf("relation %s does not exist", icebergSchemaTable.String())
+		}
+	}
+	return icebergSchemaTables, nil
+}
+
 func (remapper *QueryRemapperTable) upsertPgMatviews() {
 	args := []map[string]string{map[string]string{}}
 	sqls := []string{"DELETE FROM pg_matviews"}
@@ -249,7 +931,271 @@ func (remapper *QueryRemapperTable) upsertPgMatviews() {
 	common.PanicIfError(remapper.config.CommonConfig, err)
 }
 
+// pg_locks, etc. -> refresh the rows of system tables built from the server's state before reading them
+func (remapper *QueryRemapperTable) RefreshSystemTable(node *pgQuery.Node) error {
+	qSchemaTable := remapper.parserTable.NodeToQuerySchemaTable(node)
+
+	if remapper.isTableFromPgCatalog(qSchemaTable) {
+		switch qSchemaTable.Table {
+
+		// pg_stat_database / pg_stat_io -> return the activity of the databases since the server started
+		case PG_TABLE_PG_STAT_DATABASE:
+			return remapper.upsertPgStatDatabase()
+		case PG_TABLE_PG_STAT_IO:
+			return remapper.upsertPgStatIo()
+
+		// pg_locks -> return running queries and DDL operations
+		case PG_TABLE_PG_LOCKS:
+			return remapper.upsertPgLocks()
+
+		// pg_depend -> return foreign key and materialized view dependencies
+		case PG_TABLE_PG_DEPEND:
+			remapper.reloadIcebergTables()
+			return remapper.upsertPgDepend()
+		}
+	}
+
+	// bemidb.connection_log -> return recent connections
+	if qSchemaTable.Schema == BEMIDB_SCHEMA && qSchemaTable.Table == BEMIDB_TABLE_CONNECTION_LOG {
+		return remapper.upsertConnectionLog()
+	}
+
+	// bemidb.broken_tables -> return tables found broken by the last catalog check
+	if qSchemaTable.Schema == BEMIDB_SCHEMA && qSchemaTable.Table == BEMIDB_TABLE_BROKEN_TABLES {
+		return remapper.upsertBrokenTables()
+	}
+
+	return nil
+}
+
+// Iceberg table found broken by the last catalog check, queries of it fail with its problem instead of a DuckDB error
+func (remapper *QueryRemapperTable) BrokenTable(node *pgQuery.Node) (BrokenTable, bool) {
+	qSchemaTable := remapper.parserTable.NodeToQuerySchemaTable(node)
+	if remapper.IsSystemTable(qSchemaTable) {
+		return BrokenTable{}, false
+	}
+	return remapper.catalogChecker.BrokenTable(qSchemaTable.ToIcebergSchemaTable())
+}
+
+func (remapper *QueryRemapperTable) upsertPgLocks() error {
+	args := []map[string]string{map[string]string{}}
+	sqls := []string{"DELETE FROM pg_locks"}
+	locks := remapper.lockTracker.Locks()
+	if len(locks) > 0 {
+		values := make([]string, len(locks))
+		arg := map[string]string{}
+		for i, lock := range locks {
+			iStr := common.IntToString(i)
+			relation := "NULL"
+			virtualxid := "NULL"
+			if lock.IcebergSchemaTable != nil {
+				relation = "(" + relationOidSql("$schema"+iStr, "$table"+iStr) + ")"
+				arg["schema"+iStr] = lock.IcebergSchemaTable.Schema
+				arg["table"+iStr] = lock.IcebergSchemaTable.Table
+			} else {
+				virtualxid = "'" + common.IntToString(int(lock.Pid)) + "/1'"
+			}
+			values[i] = "('" + lock.LockType + "', NULL, " + relation + ", NULL, NULL, " + virtualxid + ", NULL, NULL, NULL, NULL, '" + common.IntToString(int(lock.Pid)) + "/1', " + common.IntToString(int(lock.Pid)) + ", '" + lock.Mode + "', TRUE, FALSE, NULL)"
+		}
+		sqls = append(sqls, "INSERT INTO pg_locks VALUES "+strings.Join(values, ", "))
+		args = append(args, arg)
+	}
+
+	remapper.systemTablesMutex.Lock()
+	defer remapper.systemTablesMutex.Unlock()
+	return remapper.ServerDuckdbClient.ExecTransactionContext(context.Background(), sqls, args)
+}
+
+// Sessions, transactions, and rows counted by the connection log, object storage reads as blks_read
+func (remapper *QueryRemapperTable) upsertPgStatDatabase() error {
+	databaseStats := remapper.connectionLog.DatabaseStats()
+	statsResetAt := "'" + remapper.connectionLog.StatsResetAt.UTC().Format(time.RFC3339Nano) + "'"
+
+	var values []string
+	for i, databaseName := range remapper.config.DatabaseNames() {
+		stats := databaseStats[databaseName]
+		values = append(values, "('"+common.IntToString(PG_DATABASE_OID+i)+"', "+
+			quoteSqlString(databaseName)+", "+
+			common.Int64ToString(stats.NumBackends)+", "+
+			common.Int64ToString(stats.XactCommit)+", "+
+			common.Int64ToString(stats.XactRollback)+", "+
+			common.Int64ToString(stats.BlksRead)+", 0, "+ // blks_hit
+			common.Int64ToString(stats.TupReturned)+", "+
+			common.Int64ToString(stats.TupReturned)+", "+ // tup_fetched
+			common.Int64ToString(stats.TupInserted)+", "+
+			common.Int64ToString(stats.TupUpdated)+", "+
+			common.Int64ToString(stats.TupDeleted)+", "+
+			"0, 0, 0, 0, NULL, NULL, "+ // conflicts, temp_files, temp_bytes, deadlocks, checksum_failures, checksum_last_failure
+			common.Int64ToString(stats.BlkReadTime.Milliseconds())+", 0, "+ // blk_write_time
+			common.Int64ToString(stats.SessionTime.Milliseconds())+", "+
+			common.Int64ToString(stats.ActiveTime.Milliseconds())+", 0, "+ // idle_in_transaction_time
+			common.Int64ToString(stats.Sessions)+", 0, 0, 0, "+ // sessions_abandoned, sessions_fatal, sessions_killed
+			statsResetAt+")")
+	}
+
+	sqls := []string{"DELETE FROM pg_stat_database", "INSERT INTO pg_stat_database VALUES " + strings.Join(values, ", ")}
+
+	remapper.systemTablesMutex.Lock()
+	defer remapper.systemTablesMutex.Unlock()
+	return remapper.ServerDuckdbClient.ExecTransactionContext(context.Background(), sqls)
+}
+
+// Object storage reads of client queries as reads of relations in 8 KB blocks, BemiDB doesn't write to local relations
+func (remapper *QueryRemapperTable) upsertPgStatIo() error {
+	var blocksRead int64
+	var readTime time.Duration
+	for _, stats := range remapper.connectionLog.DatabaseStats() {
+		blocksRead += stats.BlksRead
+		readTime += stats.BlkReadTime
+	}
+	statsResetAt := "'" + remapper.connectionLog.StatsResetAt.UTC().Format(time.RFC3339Nano) + "'"
+
+	sqls := []string{
+		"DELETE FROM pg_stat_io",
+		"INSERT INTO pg_stat_io VALUES ('client backend', 'relation', 'normal', " + common.Int64ToString(blocksRead) + ", " + common.Int64ToString(readTime.Milliseconds()) + ", 0, 0, 0, 0, 0, 0, " + common.IntToString(DATABASE_STATS_BLOCK_SIZE) + ", 0, 0, 0, 0, 0, " + statsResetAt + ")",
+	}
+
+	remapper.systemTablesMutex.Lock()
+	defer remapper.systemTablesMutex.Unlock()
+	return remapper.ServerDuckdbClient.ExecTransactionContext(context.Background(), sqls)
+}
+
+func (remapper *QueryRemapperTable) upsertConnectionLog() error {
+	sqls := []string{"DELETE FROM " + BEMIDB_SCHEMA + "." + BEMIDB_TABLE_CONNECTION_LOG}
+	entries := remapper.connectionLog.Entries()
+	if len(entries) > 0 {
+		values := make([]string, len(entries))
+		for i, entry := range entries {
+			clientAddr := "NULL"
+			if entry.ClientAddr != "" {
+				clientAddr = quoteSqlString(entry.ClientAddr)
+			}
+			disconnectedAt := "NULL"
+			if entry.DisconnectedAt != nil {
+				disconnectedAt = "'" + entry.DisconnectedAt.UTC().Format(time.RFC3339Nano) + "'"
+			}
+			values[i] = "(" + common.IntToString(int(entry.Pid)) + ", " +
+				quoteSqlString(entry.User) + ", " +
+				quoteSqlString(entry.Database) + ", " +
+				quoteSqlString(entry.ApplicationName) + ", " +
+				clientAddr + ", " +
+				"'" + entry.ConnectedAt.UTC().Format(time.RFC3339Nano) + "', " +
+				disconnectedAt + ", " +
+				common.Int64ToString(entry.QueryCount) + ", " +
+				common.Int64ToString(entry.StorageLatencyNoticeCount) + ")"
+		}
+		sqls = append(sqls, "INSERT INTO "+BEMIDB_SCHEMA+"."+BEMIDB_TABLE_CONNECTION_LOG+" VALUES "+strings.Join(values, ", "))
+	}
+
+	remapper.systemTablesMutex.Lock()
+	defer remapper.systemTablesMutex.Unlock()
+	return remapper.ServerDuckdbClient.ExecTransactionContext(context.Background(), sqls)
+}
+
+func (remapper *QueryRemapperTable) upsertBrokenTables() error {
+	sqls := []string{"DELETE FROM " + BEMIDB_SCHEMA + "." + BEMIDB_TABLE_BROKEN_TABLES}
+	brokenTables := remapper.catalogChecker.BrokenTables()
+	if len(brokenTables) > 0 {
+		values := make([]string, len(brokenTables))
+		for i, brokenTable := range brokenTables {
+			values[i] = "(" + quoteSqlString(brokenTable.IcebergSchemaTable.Schema) + ", " +
+				quoteSqlString(brokenTable.IcebergSchemaTable.Table) + ", " +
+				quoteSqlString(brokenTable.Problem) + ", " +
+				"'" + brokenTable.CheckedAt.UTC().Format(time.RFC3339Nano) + "')"
+		}
+		sqls = append(sqls, "INSERT INTO "+BEMIDB_SCHEMA+"."+BEMIDB_TABLE_BROKEN_TABLES+" VALUES "+strings.Join(values, ", "))
+	}
+
+	remapper.systemTablesMutex.Lock()
+	defer remapper.systemTablesMutex.Unlock()
+	return remapper.ServerDuckdbClient.ExecTransactionContext(context.Background(), sqls)
+}
+
+// Checks the files and columns of all tables for bemidb.broken_tables
+func (remapper *QueryRemapperTable) CheckCatalog() {
+	_, err := remapper.catalogChecker.CheckAll()
+	if err != nil {
+		common.LogError(remapper.config.CommonConfig, "Couldn't check the catalog:", err)
+	}
+}
+
+func (remapper *QueryRemapperTable) upsertPgDepend() error {
+	args := []map[string]string{map[string]string{}, map[string]string{}, map[string]string{}}
+	sqls := []string{
+		"DELETE FROM pg_depend",
+		"INSERT INTO pg_depend SELECT classid, objid, objsubid, refclassid, refobjid, refobjsubid, deptype FROM pg_catalog.pg_depend",
+		// Foreign key constraints depend on both the constrained and the referenced columns
+		`INSERT INTO pg_depend
+			SELECT 2606, oid, 0, 1259, conrelid, conkey[1], 'a' FROM main.pg_constraint WHERE contype = 'f' AND confrelid != 0
+			UNION ALL
+			SELECT 2606, oid, 0, 1259, confrelid, confkey[1], 'n' FROM main.pg_constraint WHERE contype = 'f' AND confrelid != 0`,
+	}
+
+	// Materialized views depend on the tables they select from
+	var values []string
+	arg := map[string]string{}
+	for i, icebergMaterializedView := range remapper.IcebergMaterializedViews {
+		qSchemaTables, err := remapper.parserTable.ReferencedQuerySchemaTables(icebergMaterializedView.Definition)
+		if err != nil {
+			common.LogWarn(remapper.config.CommonConfig, "Couldn't parse materialized view definition for "+icebergMaterializedView.ToIcebergSchemaTable().String()+":", err)
+			continue
+		}
+
+		iStr := common.IntToString(i) + "_" // Suffix to avoid replacing $viewSchema1 in $viewSchema10
+		arg["viewSchema"+iStr] = icebergMaterializedView.Schema
+		arg["viewTable"+iStr] = icebergMaterializedView.Table
+		for j, qSchemaTable := range qSchemaTables {
+			schemaTable := qSchemaTable.ToIcebergSchemaTable()
+			if !remapper.IcebergPersistentSchemaTables.Contains(schemaTable) && !remapper.IcebergMaterlizedSchemaTables.Contains(schemaTable) {
+				continue
+			}
+
+			jStr := iStr + common.IntToString(j) + "_"
+			arg["schema"+jStr] = schemaTable.Schema
+			arg["table"+jStr] = schemaTable.Table
+			values = append(values, "SELECT 1259, ("+relationOidSql("$viewSchema"+iStr, "$viewTable"+iStr)+"), 0, 1259, ("+relationOidSql("$schema"+jStr, "$table"+jStr)+"), 0, 'n'")
+		}
+	}
+	if len(values) > 0 {
+		sqls = append(sqls, "INSERT INTO pg_depend "+strings.Join(values, " UNION ALL "))
+		args = append(args, arg)
+	}
+
+	remapper.systemTablesMutex.Lock()
+	defer remapper.systemTablesMutex.Unlock()
+	return remapper.ServerDuckdbClient.ExecTransactionContext(context.Background(), sqls, args)
+}
+
+func relationOidSql(schema string, table string) string {
+	return "SELECT c.oid FROM pg_catalog.pg_class c JOIN pg_catalog.pg_namespace n ON n.oid = c.relnamespace WHERE n.nspname = '" + schema + "' AND c.relname = '" + table + "' LIMIT 1"
+}
+
 // System pg_* tables
+// Iceberg schemas outside the schemas exposed by the connected logical database
+func (remapper *QueryRemapperTable) hiddenSchemas(visibleSchemas common.Set[string]) []string {
+	schemas := common.NewSet[string]()
+	for schema := range remapper.IcebergSchemas {
+		schemas.Add(schema)
+	}
+	for icebergSchemaTable := range remapper.IcebergPersistentSchemaTables {
+		schemas.Add(icebergSchemaTable.Schema)
+	}
+	for icebergSchemaTable := range remapper.IcebergMaterlizedSchemaTables {
+		schemas.Add(icebergSchemaTable.Schema)
+	}
+	for icebergSchemaTable := range remapper.IcebergViews {
+		schemas.Add(icebergSchemaTable.Schema)
+	}
+
+	hiddenSchemas := []string{}
+	for _, schema := range slices.Sorted(maps.Keys(schemas)) {
+		if !visibleSchemas.Contains(schema) {
+			hiddenSchemas = append(hiddenSchemas, schema)
+		}
+	}
+	return hiddenSchemas
+}
+
 func (remapper *QueryRemapperTable) isTableFromPgCatalog(qSchemaTable QuerySchemaTable) bool {
 	return qSchemaTable.Schema == PG_SCHEMA_PG_CATALOG ||
 		(qSchemaTable.Schema == "" &&
@@ -282,7 +1228,7 @@ func CreatePgCatalogTableQueries(config *Config) []string {
 		"CREATE TABLE pg_stat_gssapi(pid int4, gss_authenticated bool, principal text, encrypted bool, credentials_delegated bool)",
 		"CREATE TABLE pg_auth_members(oid text, roleid oid, member oid, grantor oid, admin_option bool, inherit_option bool, set_option bool)",
 		"CREATE TABLE pg_stat_activity(datid oid, datname text, pid int4, usesysid oid, usename text, application_name text, client_addr inet, client_hostname text, client_port int4, backend_start timestamp, xact_start timestamp, query_start timestamp, state_change timestamp, wait_event_type text, wait_event text, state text, backend_xid int8, backend_xmin int8, query text, backend_type text)",
-		"CREATE TABLE pg_views(schemaname text, viewname text, viewowner text, definition text)",
+		"CREATE TABLE pg_cursors(name text, statement text, is_holdable bool, is_binary bool, is_scrollable bool, creation_time timestamptz)",
 		"CREATE TABLE pg_matviews(schemaname text, matviewname text, matviewowner text, tablespace text, hasindexes bool, ispopulated bool, definition text)",
 		"CREATE TABLE pg_opclass(oid oid, opcmethod oid, opcname text, opcnamespace oid, opcowner oid, opcfamily oid, opcintype oid, opcdefault bool, opckeytype oid)",
 		"CREATE TABLE pg_policy(oid oid, polname text, polrelid oid, polcmd text, polpermissive bool, polroles oid, polqual text, polwithcheck text)",
@@ -294,22 +1240,180 @@ func CreatePgCatalogTableQueries(config *Config) []string {
 
 		// Dynamic tables
 		// DuckDB doesn't handle dynamic view replacement properly
+		"CREATE TABLE pg_views(schemaname text, viewname text, viewowner text, definition text)",
+		"CREATE TABLE pg_locks(locktype text, database oid, relation oid, page int4, tuple int2, virtualxid text, transactionid int8, classid oid, objid oid, objsubid int2, virtualtransaction text, pid int4, mode text, granted bool, fastpath bool, waitstart timestamp)",
+		"CREATE TABLE pg_depend(classid oid, objid oid, objsubid int4, refclassid oid, refobjid oid, refobjsubid int4, deptype text)",
+		"CREATE TABLE " + PG_TABLE_COLUMN_METADATA + "(table_schema text, table_name text, column_name text, column_default text, generation_expression text, type_modifier int4, referenced_table text, referenced_column text, ordinal_position int4)",
+		"CREATE TABLE pg_stat_database(datid oid, datname text, numbackends int4, xact_commit int8, xact_rollback int8, blks_read int8, blks_hit int8, tup_returned int8, tup_fetched int8, tup_inserted int8, tup_updated int8, tup_deleted int8, conflicts int8, temp_files int8, temp_bytes int8, deadlocks int8, checksum_failures int8, checksum_last_failure timestamptz, blk_read_time float8, blk_write_time float8, session_time float8, active_time float8, idle_in_transaction_time float8, sessions int8, sessions_abandoned int8, sessions_fatal int8, sessions_killed int8, stats_reset timestamptz)",
+		"CREATE TABLE pg_stat_io(backend_type text, object text, context text, reads int8, read_time float8, writes int8, write_time float8, writebacks int8, writeback_time float8, extends int8, extend_time float8, op_bytes int8, hits int8, evictions int8, reuses int8, fsyncs int8, fsync_time float8, stats_reset timestamptz)",
 		"CREATE TABLE pg_stat_user_tables(relid oid, schemaname text, relname text, seq_scan int8, last_seq_scan timestamp, seq_tup_read int8, idx_scan int8, last_idx_scan timestamp, idx_tup_fetch int8, n_tup_ins int8, n_tup_upd int8, n_tup_del int8, n_tup_hot_upd int8, n_tup_newpage_upd int8, n_live_tup int8, n_dead_tup int8, n_mod_since_analyze int8, n_ins_since_vacuum int8, last_vacuum timestamp, last_autovacuum timestamp, last_analyze timestamp, last_autoanalyze timestamp, vacuum_count int8, autovacuum_count int8, analyze_count int8, autoanalyze_count int8)",
 
 		// Static views
-		"CREATE VIEW pg_shadow AS SELECT '" + config.User + "' AS usename, '10'::oid AS usesysid, FALSE AS usecreatedb, FALSE AS usesuper, TRUE AS userepl, FALSE AS usebypassrls, '" + config.EncryptedPassword + "' AS passwd, NULL::timestamp AS valuntil, NULL::text[] AS useconfig",
-		"CREATE VIEW pg_roles AS SELECT '10'::oid AS oid, '" + config.User + "' AS rolname, TRUE AS rolsuper, TRUE AS rolinherit, TRUE AS rolcreaterole, TRUE AS rolcreatedb, TRUE AS rolcanlogin, FALSE AS rolreplication, -1 AS rolconnlimit, NULL::text AS rolpassword, NULL::timestamp AS rolvaliduntil, FALSE AS rolbypassrls, NULL::text[] AS rolconfig",
+		"CREATE VIEW pg_shadow AS SELECT usr.usename AS usename, usr.oid::oid AS usesysid, FALSE AS usecreatedb, FALSE AS usesuper, TRUE AS userepl, FALSE AS usebypassrls, usr.passwd AS passwd, NULL::timestamp AS valuntil, NULL::text[] AS useconfig FROM (VALUES " + pgUserValues(config) + ") usr(oid, usename, passwd, usesuper)",
+		"CREATE VIEW pg_roles AS SELECT usr.oid::oid AS oid, usr.usename AS rolname, usr.usesuper AS rolsuper, TRUE AS rolinherit, usr.usesuper AS rolcreaterole, usr.usesuper AS rolcreatedb, TRUE AS rolcanlogin, FALSE AS rolreplication, -1 AS rolconnlimit, NULL::text AS rolpassword, NULL::timestamp AS rolvaliduntil, FALSE AS rolbypassrls, NULL::text[] AS rolconfig FROM (VALUES " + pgUserValues(config) + ") usr(oid, usename, passwd, usesuper)",
 		"CREATE VIEW pg_extension AS SELECT '13823'::oid AS oid, 'plpgsql' AS extname, '10'::oid AS extowner, '11'::oid AS extnamespace, FALSE AS extrelocatable, '1.0'::text AS extversion, NULL::text[] AS extconfig, NULL::text[] AS extcondition",
-		"CREATE VIEW pg_database AS SELECT '16388'::oid AS oid, '" + config.Database + "' AS datname, '10'::oid AS datdba, '6'::int4 AS encoding, 'c' AS datlocprovider, FALSE AS datistemplate, TRUE AS datallowconn, '-1'::int4 AS datconnlimit, '722'::int8 AS datfrozenxid, '1'::int4 AS datminmxid, '1663'::oid AS dattablespace, 'en_US.UTF-8' AS datcollate, 'en_US.UTF-8' AS datctype, 'en_US.UTF-8' AS datlocale, NULL::text AS daticurules, NULL::text AS datcollversion, NULL::text[] AS datacl",
-		"CREATE VIEW pg_user AS SELECT '" + config.User + "' AS usename, '10'::oid AS usesysid, TRUE AS usecreatedb, TRUE AS usesuper, TRUE AS userepl, TRUE AS usebypassrls, '' AS passwd, NULL::timestamp AS valuntil, NULL::text[] AS useconfig",
+		"CREATE VIEW pg_available_extensions AS SELECT 'plpgsql' AS name, '1.0' AS default_version, '1.0' AS installed_version, 'PL/pgSQL procedural language' AS comment",
+		"CREATE VIEW pg_available_extension_versions AS SELECT 'plpgsql' AS name, '1.0' AS version, TRUE AS installed, FALSE AS superuser, TRUE AS trusted, FALSE AS relocatable, 'pg_catalog' AS schema, NULL::text[] AS requires, 'PL/pgSQL procedural language' AS comment",
+		`CREATE VIEW pg_language AS
+			SELECT col0::oid AS oid, col1 AS lanname, '10'::oid AS lanowner, col2 AS lanispl, col3 AS lanpltrusted, '0'::oid AS lanplcallfoid, '0'::oid AS laninline, '0'::oid AS lanvalidator, NULL::text[] AS lanacl
+			FROM (VALUES
+				(12, 'internal', FALSE, FALSE),
+				(13, 'c', FALSE, FALSE),
+				(14, 'sql', FALSE, TRUE),
+				(13827, 'plpgsql', TRUE, TRUE)
+			)`,
+		"CREATE VIEW pg_database AS SELECT database.oid::oid AS oid, database.datname AS datname, '10'::oid AS datdba, '6'::int4 AS encoding, 'c' AS datlocprovider, FALSE AS datistemplate, TRUE AS datallowconn, '-1'::int4 AS datconnlimit, '722'::int8 AS datfrozenxid, '1'::int4 AS datminmxid, '1663'::oid AS dattablespace, 'en_US.UTF-8' AS datcollate, 'en_US.UTF-8' AS datctype, 'en_US.UTF-8' AS datlocale, NULL::text AS daticurules, NULL::text AS datcollversion, " + pgDatabaseAcl(config) + " AS datacl FROM (VALUES " + pgDatabaseValues(config) + ") database(oid, datname)",
+		"CREATE VIEW pg_user AS SELECT usr.usename AS usename, usr.oid::oid AS usesysid, usr.usesuper AS usecreatedb, usr.usesuper AS usesuper, TRUE AS userepl, usr.usesuper AS usebypassrls, '' AS passwd, NULL::timestamp AS valuntil, NULL::text[] AS useconfig FROM (VALUES " + pgUserValues(config) + ") usr(oid, usename, passwd, usesuper)",
 		"CREATE VIEW pg_collation AS SELECT '100'::oid AS oid, 'default' AS collname, '11'::oid AS collnamespace, '10'::oid AS collowner, 'd' AS collprovider, TRUE AS collisdeterministic, '-1'::int4 AS collencoding, NULL::text AS collcollate, NULL::text AS collctype, NULL::text AS colliculocale, NULL::text AS collicurules, NULL::text AS collversion",
 		"CREATE VIEW user AS SELECT '" + config.User + "' AS user",
+		// Time zone pickers in BI tools, names from the ICU time zone list and common abbreviations with standard offsets
+		"CREATE VIEW pg_timezone_names AS SELECT name, abbrev, utc_offset, is_dst FROM pg_timezone_names()",
+		`CREATE VIEW pg_timezone_abbrevs AS
+			SELECT col0 AS abbrev, col1::interval AS utc_offset, col2 AS is_dst
+			FROM (VALUES
+				('ACDT', '10:30:00', TRUE),
+				('ACST', '09:30:00', FALSE),
+				('ADT', '-03:00:00', TRUE),
+				('AEDT', '11:00:00', TRUE),
+				('AEST', '10:00:00', FALSE),
+				('AKDT', '-08:00:00', TRUE),
+				('AKST', '-09:00:00', FALSE),
+				('AST', '-04:00:00', FALSE),
+				('AWST', '08:00:00', FALSE),
+				('BST', '01:00:00', TRUE),
+				('CAT', '02:00:00', FALSE),
+				('CDT', '-05:00:00', TRUE),
+				('CEST', '02:00:00', TRUE),
+				('CET', '01:00:00', FALSE),
+				('CST', '-06:00:00', FALSE),
+				('EAT', '03:00:00', FALSE),
+				('EDT', '-04:00:00', TRUE),
+				('EEST', '03:00:00', TRUE),
+				('EET', '02:00:00', FALSE),
+				('EST', '-05:00:00', FALSE),
+				('GMT', '00:00:00', FALSE),
+				('HKT', '08:00:00', FALSE),
+				('HST', '-10:00:00', FALSE),
+				('IST', '02:00:00', FALSE),
+				('JST', '09:00:00', FALSE),
+				('KST', '09:00:00', FALSE),
+				('MDT', '-06:00:00', TRUE),
+				('MSK', '03:00:00', FALSE),
+				('MST', '-07:00:00', FALSE),
+				('NDT', '-02:30:00', TRUE),
+				('NST', '-03:30:00', FALSE),
+				('NZDT', '13:00:00', TRUE),
+				('NZST', '12:00:00', FALSE),
+				('PDT', '-07:00:00', TRUE),
+				('PST', '-08:00:00', FALSE),
+				('SAST', '02:00:00', FALSE),
+				('SGT', '08:00:00', FALSE),
+				('UTC', '00:00:00', FALSE),
+				('WAT', '01:00:00', FALSE),
+				('WEST', '01:00:00', TRUE),
+				('WET', '00:00:00', FALSE)
+			)`,
+		// Built-in access methods, operators, and operator families used by index and operator details in SQL clients
+		`CREATE VIEW pg_am AS
+			SELECT col0::oid AS oid, col1 AS amname, col2 AS amhandler, 'i' AS amtype
+			FROM (VALUES
+				(403, 'btree', 'bthandler'),
+				(405, 'hash', 'hashhandler')
+			)`,
+		`CREATE VIEW pg_operator AS
+			SELECT
+				col0::oid AS oid,
+				col1 AS oprname,
+				(SELECT typnamespace FROM pg_catalog.pg_type WHERE typname = 'bool') AS oprnamespace,
+				'10'::oid AS oprowner,
+				'b' AS oprkind,
+				col9 AS oprcanmerge,
+				col9 AS oprcanhash,
+				col2::oid AS oprleft,
+				col3::oid AS oprright,
+				'16'::oid AS oprresult,
+				col4::oid AS oprcom,
+				col5::oid AS oprnegate,
+				col6 AS oprcode,
+				col7 AS oprrest,
+				col8 AS oprjoin
+			FROM (VALUES
+				(91, '=', 16, 16, 91, 85, 'booleq', 'eqsel', 'eqjoinsel', true),
+				(96, '=', 23, 23, 96, 518, 'int4eq', 'eqsel', 'eqjoinsel', true),
+				(97, '<', 23, 23, 521, 525, 'int4lt', 'scalarltsel', 'scalarltjoinsel', false),
+				(521, '>', 23, 23, 97, 523, 'int4gt', 'scalargtsel', 'scalargtjoinsel', false),
+				(410, '=', 20, 20, 410, 411, 'int8eq', 'eqsel', 'eqjoinsel', true),
+				(412, '<', 20, 20, 413, 415, 'int8lt', 'scalarltsel', 'scalarltjoinsel', false),
+				(413, '>', 20, 20, 412, 414, 'int8gt', 'scalargtsel', 'scalargtjoinsel', false),
+				(98, '=', 25, 25, 98, 531, 'texteq', 'eqsel', 'eqjoinsel', true),
+				(664, '<', 25, 25, 666, 667, 'text_lt', 'scalarltsel', 'scalarltjoinsel', false),
+				(666, '>', 25, 25, 664, 665, 'text_gt', 'scalargtsel', 'scalargtjoinsel', false)
+			)`,
+		`CREATE VIEW pg_opfamily AS
+			SELECT col0::oid AS oid, col1::oid AS opfmethod, col2 AS opfname, (SELECT typnamespace FROM pg_catalog.pg_type WHERE typname = 'bool') AS opfnamespace, '10'::oid AS opfowner
+			FROM (VALUES
+				(424, 403, 'bool_ops'),
+				(1976, 403, 'integer_ops'),
+				(1994, 403, 'text_ops'),
+				(2222, 405, 'bool_ops'),
+				(1977, 405, 'integer_ops'),
+				(1995, 405, 'text_ops')
+			)`,
 
 		// Dynamic views
 		// DuckDB does not support indnullsnotdistinct column
-		"CREATE VIEW pg_index AS SELECT *, FALSE AS indnullsnotdistinct FROM pg_catalog.pg_index",
-		// Hide DuckDB's system and duplicate schemas
-		"CREATE VIEW pg_namespace AS SELECT * FROM pg_catalog.pg_namespace WHERE oid >= (SELECT oid FROM pg_catalog.pg_namespace WHERE nspname = '" + PG_SCHEMA_PUBLIC + "')",
+		"CREATE VIEW pg_index AS SELECT *, FALSE AS indnullsnotdistinct FROM pg_catalog.pg_index ORDER BY indexrelid",
+		// DuckDB encodes DECIMAL atttypmod as precision * 1000 + scale and doesn't know the source type modifiers and ordinal positions
+		`CREATE VIEW pg_attribute AS SELECT
+			pg_attribute.* REPLACE (
+				COALESCE(` + PG_TABLE_COLUMN_METADATA + `.ordinal_position, pg_attribute.attnum) AS attnum,
+				COALESCE(
+					` + PG_TABLE_COLUMN_METADATA + `.type_modifier,
+					CASE WHEN starts_with(duckdb_columns.data_type, 'DECIMAL') THEN ((duckdb_columns.numeric_precision << 16) | duckdb_columns.numeric_scale) + 4 ELSE -1 END
+				) AS atttypmod
+			)
+		FROM pg_catalog.pg_attribute
+		JOIN duckdb_columns() duckdb_columns ON duckdb_columns.table_oid = pg_attribute.attrelid AND duckdb_columns.column_index = pg_attribute.attnum
+		LEFT JOIN ` + PG_TABLE_COLUMN_METADATA + ` ON ` + PG_TABLE_COLUMN_METADATA + `.table_schema = duckdb_columns.schema_name AND ` + PG_TABLE_COLUMN_METADATA + `.table_name = duckdb_columns.table_name AND ` + PG_TABLE_COLUMN_METADATA + `.column_name = duckdb_columns.column_name
+		WHERE duckdb_columns.schema_name NOT IN (` + internalDuckdbSchemasSqlList() + `)
+		ORDER BY pg_attribute.attrelid, COALESCE(` + PG_TABLE_COLUMN_METADATA + `.ordinal_position, pg_attribute.attnum)`,
+		// Synthesize single-column foreign keys captured from the source schema
+		`CREATE VIEW pg_constraint AS
+			SELECT * FROM pg_catalog.pg_constraint
+			UNION ALL
+			SELECT
+				(duckdb_columns.table_oid * 1000000) + 500000 + duckdb_columns.column_index AS oid,
+				` + PG_TABLE_COLUMN_METADATA + `.table_name || '_' || ` + PG_TABLE_COLUMN_METADATA + `.column_name || '_fkey' AS conname,
+				duckdb_columns.schema_oid AS connamespace,
+				'f' AS contype,
+				FALSE AS condeferrable,
+				FALSE AS condeferred,
+				TRUE AS convalidated,
+				duckdb_columns.table_oid AS conrelid,
+				0 AS contypid,
+				0 AS conindid,
+				0 AS conparentid,
+				referenced_columns.table_oid AS confrelid,
+				'a' AS confupdtype,
+				'a' AS confdeltype,
+				's' AS confmatchtype,
+				TRUE AS conislocal,
+				0 AS coninhcount,
+				TRUE AS connoinherit,
+				[COALESCE(` + PG_TABLE_COLUMN_METADATA + `.ordinal_position, duckdb_columns.column_index)] AS conkey,
+				[COALESCE(referenced_metadata.ordinal_position, referenced_columns.column_index)] AS confkey,
+				NULL AS conpfeqop,
+				NULL AS conppeqop,
+				NULL AS conffeqop,
+				NULL AS conexclop,
+				NULL AS conbin
+			FROM ` + PG_TABLE_COLUMN_METADATA + `
+			JOIN duckdb_columns() duckdb_columns ON duckdb_columns.schema_name = ` + PG_TABLE_COLUMN_METADATA + `.table_schema AND duckdb_columns.table_name = ` + PG_TABLE_COLUMN_METADATA + `.table_name AND duckdb_columns.column_name = ` + PG_TABLE_COLUMN_METADATA + `.column_name
+			JOIN duckdb_columns() referenced_columns ON referenced_columns.schema_name = ` + PG_TABLE_COLUMN_METADATA + `.table_schema AND referenced_columns.table_name = ` + PG_TABLE_COLUMN_METADATA + `.referenced_table AND referenced_columns.column_name = ` + PG_TABLE_COLUMN_METADATA + `.referenced_column
+			LEFT JOIN ` + PG_TABLE_COLUMN_METADATA + ` referenced_metadata ON referenced_metadata.table_schema = referenced_columns.schema_name AND referenced_metadata.table_name = referenced_columns.table_name AND referenced_metadata.column_name = referenced_columns.column_name
+			ORDER BY oid`,
+		// Hide DuckDB's system, duplicate, and internal schemas
+		"CREATE VIEW pg_namespace AS SELECT * FROM pg_catalog.pg_namespace WHERE oid >= (SELECT oid FROM pg_catalog.pg_namespace WHERE nspname = '" + PG_SCHEMA_PUBLIC + "') AND nspname NOT IN (" + internalDuckdbSchemasSqlList() + ") ORDER BY oid",
 		// DuckDB does not support relforcerowsecurity column
 		`CREATE VIEW pg_class AS SELECT
 			oid,
@@ -332,7 +1436,7 @@ func CreatePgCatalogTableQueries(config *Config) []string {
 				WHEN 'v' THEN
 					CASE relnamespace >= (SELECT oid FROM pg_catalog.pg_namespace WHERE nspname = '` + PG_SCHEMA_PUBLIC + `')
 					WHEN TRUE THEN
-						'm'
+						CASE WHEN EXISTS (SELECT 1 FROM main.pg_views v JOIN pg_catalog.pg_namespace n ON n.nspname = v.schemaname WHERE n.oid = relnamespace AND v.viewname = relname) THEN 'v' ELSE 'm' END
 					ELSE
 						'v'
 					END
@@ -340,7 +1444,9 @@ func CreatePgCatalogTableQueries(config *Config) []string {
 				relkind
 			END AS relkind,
 			FALSE AS relforcerowsecurity
-		FROM pg_catalog.pg_class`,
+		FROM pg_catalog.pg_class
+		WHERE relnamespace NOT IN (SELECT oid FROM pg_catalog.pg_namespace WHERE nspname IN (` + internalDuckdbSchemasSqlList() + `))
+		ORDER BY oid`,
 		`CREATE VIEW pg_type AS
 			SELECT * FROM pg_catalog.pg_type
 			UNION ALL
@@ -705,19 +1811,102 @@ func CreatePgCatalogTableQueries(config *Config) []string {
 			SELECT 6155, '_datemultirange', (SELECT typnamespace FROM pg_catalog.pg_type WHERE typname = 'bool'), 0, -1, false, 'b', 'A', false, true, NULL, NULL, NULL, NULL, NULL, NULL, NULL, NULL, NULL, NULL, NULL, NULL, 'd', 'p', NULL, NULL, NULL, NULL, NULL, NULL, NULL, NULL
 			UNION ALL
 			SELECT 6157, '_int8multirange', (SELECT typnamespace FROM pg_catalog.pg_type WHERE typname = 'bool'), 0, -1, false, 'b', 'A', false, true, NULL, NULL, NULL, NULL, NULL, NULL, NULL, NULL, NULL, NULL, NULL, NULL, 'd', 'p', NULL, NULL, NULL, NULL, NULL, NULL, NULL, NULL
+			ORDER BY oid
 		`,
 	}
 	PG_CATALOG_TABLE_NAMES = extractTableNames(result)
 	return result
 }
 
+// ('16388', 'bemidb'), ('16389', 'production'), ...
+func pgDatabaseValues(config *Config) string {
+	var values []string
+	for i, databaseName := range config.DatabaseNames() {
+		values = append(values, "('"+common.IntToString(PG_DATABASE_OID+i)+"', '"+databaseName+"')")
+	}
+	return strings.Join(values, ", ")
+}
+
+// The configured user owns the databases, and additional users can connect to them and create temp tables.
+// NULL means the default privileges if any user can connect without BEMIDB_USER
+func pgDatabaseAcl(config *Config) string {
+	if config.User == "" {
+		return "NULL::text[]"
+	}
+
+	owner := pgAclRoleName(config.User)
+	aclItems := []string{quoteSqlString(owner + "=CTc/" + owner)}
+	for _, userName := range config.UserNames()[1:] {
+		aclItems = append(aclItems, quoteSqlString(pgAclRoleName(userName)+"=Tc/"+owner))
+	}
+	return "[" + strings.Join(aclItems, ", ") + "]"
+}
+
+// Role name in an ACL item -> CASE expression with the OID of the role, 0 for PUBLIC
+func pgRoleOidCase(config *Config, roleNameExpression string) string {
+	whenClauses := []string{"WHEN '' THEN 0"}
+	for i, userName := range config.UserNames() {
+		if userName == "" {
+			continue
+		}
+		oid := PG_USER_OID
+		if i > 0 {
+			oid = PG_ADDITIONAL_USER_OID + i - 1
+		}
+		whenClauses = append(whenClauses, "WHEN "+quoteSqlString(pgAclRoleName(userName))+" THEN "+common.IntToString(oid))
+	}
+	return "(CASE " + roleNameExpression + " " + strings.Join(whenClauses, " ") + " END)::oid"
+}
+
+// user -> user, looker user -> "looker user" like Postgres quotes role names in ACL items
+func pgAclRoleName(userName string) string {
+	for _, char := range userName {
+		if !(char >= 'a' && char <= 'z' || char >= 'A' && char <= 'Z' || char >= '0' && char <= '9' || char == '_') {
+			return `"` + strings.ReplaceAll(userName, `"`, `""`) + `"`
+		}
+	}
+	return userName
+}
+
+// The configured user is a superuser, additional users aren't
+func pgUserValues(config *Config) string {
+	values := []string{"('" + common.IntToString(PG_USER_OID) + "', " + quoteSqlString(config.User) + ", " + quoteSqlString(config.EncryptedPassword) + ", TRUE)"}
+	for i, userName := range config.UserNames()[1:] {
+		values = append(values, "('"+common.IntToString(PG_ADDITIONAL_USER_OID+i)+"', "+quoteSqlString(userName)+", "+quoteSqlString(config.Users[userName])+", FALSE)")
+	}
+	return strings.Join(values, ", ")
+}
+
 func CreateInformationSchemaTableQueries(config *Config) []string {
 	result := []string{
 		// Dynamic views
 		// DuckDB does not support udt_catalog, udt_schema, udt_name
 		`CREATE VIEW ` + PG_TABLE_COLUMNS + ` AS
 		SELECT
-			table_catalog, table_schema, table_name, column_name, ordinal_position, column_default, is_nullable, data_type, character_maximum_length, character_octet_length, numeric_precision, numeric_precision_radix, numeric_scale, datetime_precision, interval_type, interval_precision, character_set_catalog, character_set_schema, character_set_name, collation_catalog, collation_schema, collation_name, domain_catalog, domain_schema, domain_name,
+			table_catalog, table_schema, table_name, column_name,
+			COALESCE(` + PG_TABLE_COLUMN_METADATA + `.ordinal_position, columns.ordinal_position) AS ordinal_position,
+			COALESCE(` + PG_TABLE_COLUMN_METADATA + `.column_default, columns.column_default) AS column_default,
+			is_nullable, data_type,
+			CASE
+				WHEN ` + PG_TABLE_COLUMN_METADATA + `.type_modifier >= 4 AND starts_with(data_type, 'VARCHAR') THEN ` + PG_TABLE_COLUMN_METADATA + `.type_modifier - 4
+				ELSE character_maximum_length
+			END AS character_maximum_length,
+			CASE
+				WHEN ` + PG_TABLE_COLUMN_METADATA + `.type_modifier >= 4 AND starts_with(data_type, 'VARCHAR') THEN (` + PG_TABLE_COLUMN_METADATA + `.type_modifier - 4) * 4
+				ELSE character_octet_length
+			END AS character_octet_length,
+			CASE
+				WHEN ` + PG_TABLE_COLUMN_METADATA + `.type_modifier IS NULL OR NOT starts_with(data_type, 'DECIMAL') THEN numeric_precision
+				WHEN ` + PG_TABLE_COLUMN_METADATA + `.type_modifier = -1 THEN NULL
+				ELSE ((` + PG_TABLE_COLUMN_METADATA + `.type_modifier - 4) >> 16) & 65535
+			END AS numeric_precision,
+			numeric_precision_radix,
+			CASE
+				WHEN ` + PG_TABLE_COLUMN_METADATA + `.type_modifier IS NULL OR NOT starts_with(data_type, 'DECIMAL') THEN numeric_scale
+				WHEN ` + PG_TABLE_COLUMN_METADATA + `.type_modifier = -1 THEN NULL
+				ELSE (` + PG_TABLE_COLUMN_METADATA + `.type_modifier - 4) & 65535
+			END AS numeric_scale,
+			datetime_precision, interval_type, interval_precision, character_set_catalog, character_set_schema, character_set_name, collation_catalog, collation_schema, collation_name, domain_catalog, domain_schema, domain_name,
 			'` + config.Database + `' AS udt_catalog,
 			'pg_catalog' AS udt_schema,
 			CASE data_type
@@ -753,8 +1942,14 @@ func CreateInformationSchemaTableQueries(config *Config) []string {
 		        ELSE 'unknown'
 				END
 			END AS udt_name,
-			scope_catalog, scope_schema, scope_name, maximum_cardinality, dtd_identifier, is_self_referencing, is_identity, identity_generation, identity_start, identity_increment, identity_maximum, identity_minimum, identity_cycle, is_generated, generation_expression, is_updatable
-		FROM information_schema.columns`,
+			scope_catalog, scope_schema, scope_name, maximum_cardinality, dtd_identifier, is_self_referencing, is_identity, identity_generation, identity_start, identity_increment, identity_maximum, identity_minimum, identity_cycle,
+			CASE WHEN ` + PG_TABLE_COLUMN_METADATA + `.generation_expression IS NULL THEN columns.is_generated ELSE 'ALWAYS' END AS is_generated,
+			COALESCE(` + PG_TABLE_COLUMN_METADATA + `.generation_expression, columns.generation_expression) AS generation_expression,
+			is_updatable
+		FROM information_schema.columns
+		LEFT JOIN ` + PG_TABLE_COLUMN_METADATA + ` USING (table_schema, table_name, column_name)
+		WHERE table_schema NOT IN (` + internalDuckdbSchemasSqlList() + `)
+		ORDER BY table_schema, table_name, COALESCE(` + PG_TABLE_COLUMN_METADATA + `.ordinal_position, columns.ordinal_position)`,
 		`CREATE VIEW ` + PG_TABLE_TABLES + ` AS SELECT
 			table_catalog,
 			table_schema,
@@ -769,7 +1964,21 @@ func CreateInformationSchemaTableQueries(config *Config) []string {
 			is_typed,
 			commit_action
 		FROM information_schema.tables
-		WHERE table_type != 'VIEW' AND table_schema != 'main'`,
+		WHERE (table_type != 'VIEW' OR EXISTS (SELECT 1 FROM main.pg_views WHERE schemaname = table_schema AND viewname = table_name)) AND table_schema NOT IN ('main', ` + internalDuckdbSchemasSqlList() + `)
+		ORDER BY table_schema, table_name`,
+		`CREATE VIEW ` + PG_TABLE_VIEWS + ` AS SELECT
+			'` + config.Database + `' AS table_catalog,
+			schemaname AS table_schema,
+			viewname AS table_name,
+			definition AS view_definition,
+			'NONE' AS check_option,
+			'NO' AS is_updatable,
+			'NO' AS is_insertable_into,
+			'NO' AS is_trigger_updatable,
+			'NO' AS is_trigger_deletable,
+			'NO' AS is_trigger_insertable_into
+		FROM main.pg_views
+		ORDER BY table_schema, table_name`,
 	}
 	return result
 }
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+
+	pgQuery "github.com/pganalyze/pg_query_go/v6"
+)
+
+// A rule configured by operators to hotfix a query sent by a tool that can't be remapped yet, e.g.
+// {"name": "tool-version", "match": "SELECT tool_version()", "rewrite": "SELECT '1.0' AS tool_version"}
+type QueryRewriteRule struct {
+	Name    string `json:"name"`
+	Match   string `json:"match,omitempty"` // Query replaced with the rewrite if it's the same after normalization
+	Regex   string `json:"regex,omitempty"` // Replaces the matching parts of the normalized query with the rewrite, which can reference groups with $1, ${name}, etc.
+	Rewrite string `json:"rewrite"`
+
+	normalizedMatch string
+	regexp          *regexp.Regexp
+}
+
+// A JSON array of rules, each with a name, a rewrite, and either a match or a regex
+func parseQueryRewriteRules(content string) []QueryRewriteRule {
+	var rules []QueryRewriteRule
+	err := json.Unmarshal([]byte(content), &rules)
+	if err != nil {
+		panic("Invalid query rewrite rules format. Expected a JSON array: " + err.Error())
+	}
+
+	for i, rule := range rules {
+		if rule.Name == "" || (rule.Match == "") == (rule.Regex == "") {
+			panic("Query rewrite rules must have a name and either a match or a regex")
+		}
+
+		if rule.Match != "" {
+			if _, err := pgQuery.Parse(rule.Rewrite); err != nil {
+				panic("Invalid rewrite of query rewrite rule " + rule.Name + ": " + err.Error())
+			}
+			rules[i].normalizedMatch = normalizeRewrittenQuery(rule.Match)
+		} else {
+			rules[i].regexp, err = regexp.Compile(rule.Regex)
+			if err != nil {
+				panic("Invalid regex of query rewrite rule " + rule.Name + ": " + err.Error())
+			}
+		}
+	}
+	return rules
+}
+
+// Returns the query rewritten by the first matching rule with its name, false if none of them matches
+func (config *Config) RewriteQuery(query string) (string, string, bool) {
+	if len(config.QueryRewriteRules) == 0 {
+		return query, "", false
+	}
+
+	normalizedQuery := normalizeRewrittenQuery(query)
+	for _, rule := range config.QueryRewriteRules {
+		if rule.regexp == nil {
+			if strings.EqualFold(normalizedQuery, rule.normalizedMatch) {
+				return rule.Rewrite, rule.Name, true
+			}
+		} else if rule.regexp.MatchString(normalizedQuery) {
+			return rule.regexp.ReplaceAllString(normalizedQuery, rule.Rewrite), rule.Name, true
+		}
+	}
+	return query, "", false
+}
+
+// "select  version() ;" -> "SELECT version()", the same format as the original queries in logs.
+// Queries that can't be parsed only have their whitespace collapsed
+func normalizeRewrittenQuery(query string) string {
+	queryTree, err := pgQuery.Parse(query)
+	if err == nil {
+		normalizedQuery, err := pgQuery.Deparse(queryTree)
+		if err == nil {
+			return normalizedQuery
+		}
+	}
+	return strings.TrimRight(strings.Join(strings.Fields(query), " "), "; ")
+}
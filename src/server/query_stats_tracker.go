@@ -0,0 +1,318 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	duckdb "github.com/marcboeker/go-duckdb/v2"
+
+	"github.com/BemiHQ/BemiDB/src/common"
+)
+
+const (
+	STORAGE_LATENCY_NOTICE_SHARE = 0.5 // Share of the query duration spent scanning object storage for a notice
+	STORAGE_LATENCY_NOTICE_HINT  = "Warm up the cache by pinning small tables with BEMIDB_PINNED_TABLES, or re-sync tables with many small data files to compact them."
+
+	STORAGE_LOGS_MAX_ENTRIES    = 100_000          // Of the duckdb_logs table before it's truncated while queries with stats are still running
+	STORAGE_LOGS_CHECK_INTERVAL = 10 * time.Second // Between counting the duckdb_logs entries while queries with stats are running
+)
+
+// Execution stats sent to the client in a NoticeResponse after each query with SET bemidb.query_stats = on
+type QueryStats struct {
+	Duration            time.Duration
+	RowCount            int64
+	StorageBytes        int64 // Bytes scanned from object storage
+	StorageRequestCount int64
+	StorageTracked      bool          // False if object storage reads couldn't be attributed to the query
+	StorageScanDuration time.Duration // Wall time table scans waited on object storage estimated with DuckDB profiling, 0 if the query wasn't profiled
+}
+
+// Enables DuckDB HTTP logging only while queries with stats are running, and attributes logged object storage
+// reads to a query by the DuckDB connections and transactions it ran on since it started.
+//
+// The logs are dropped after the last running query, or once they reach STORAGE_LOGS_MAX_ENTRIES if queries keep overlapping,
+// in which case the reads of the queries still running can't be attributed to them anymore
+type QueryStatsTracker struct {
+	mutex           sync.RWMutex // Held for reading while querying the logs, and for writing while truncating them
+	config          *Config
+	duckdbClient    *common.DuckdbClient
+	runningCount    int
+	truncationCount int
+	logsCheckedAt   time.Time
+	maxLogEntries   int64
+}
+
+type QueryStatsRun struct {
+	tracker         *QueryStatsTracker
+	startedAt       time.Time
+	truncationCount int // Of the tracker when the query started
+	conns           []trackedConn
+	profilingConn   *sql.Conn     // DuckDB profiling is enabled on the pooled connection to measure table scans, nil otherwise
+	cpuTimeAt       time.Duration // Process CPU time when the last profiled statement started
+	scanDuration    time.Duration
+	closed          bool
+}
+
+// Object storage reads logged on a DuckDB connection since the query started running on it.
+// Statements of a transaction block share the transaction, so the earlier ones are excluded by the start time
+type trackedConn struct {
+	conn          duckdbConn
+	connectionId  uint64
+	transactionId uint64
+	startedAt     time.Time
+}
+
+func NewQueryStatsTracker(config *Config, duckdbClient *common.DuckdbClient) *QueryStatsTracker {
+	return &QueryStatsTracker{config: config, duckdbClient: duckdbClient, maxLogEntries: STORAGE_LOGS_MAX_ENTRIES}
+}
+
+// Starts tracking the query, which is attributed the reads of the DuckDB connections it runs on with Track
+func (tracker *QueryStatsTracker) Start(ctx context.Context) (*QueryStatsRun, error) {
+	truncationCount, err := tracker.enableLogging(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &QueryStatsRun{tracker: tracker, startedAt: time.Now(), truncationCount: truncationCount}, nil
+}
+
+// Attributes the object storage reads on the session's transaction or a pooled connection from now on to the query,
+// e.g. after BEGIN in the middle of the query. Table scans are profiled only on a pooled connection
+func (run *QueryStatsRun) Track(ctx context.Context, conn duckdbConn) error {
+	for _, trackedConn := range run.conns {
+		if trackedConn.conn == conn {
+			return nil
+		}
+	}
+
+	tracked := trackedConn{conn: conn, startedAt: time.Now()}
+	err := conn.QueryRowContext(ctx, "SELECT current_connection_id(), current_transaction_id()").Scan(&tracked.connectionId, &tracked.transactionId)
+	if err != nil {
+		return err
+	}
+	run.conns = append(run.conns, tracked)
+
+	if pooledConn, ok := conn.(*sql.Conn); ok && run.profilingConn == nil && run.tracker.config.StorageLatencyNoticeMs > 0 {
+		_, err = pooledConn.ExecContext(ctx, "PRAGMA enable_profiling = 'no_output'")
+		if err != nil {
+			return err
+		}
+		run.profilingConn = pooledConn
+		run.cpuTimeAt = processCpuTime()
+	}
+	return nil
+}
+
+// Adds the time table scans of the last statement run on the connection waited on object storage, must be called after its rows are closed
+func (run *QueryStatsRun) TrackProfile() {
+	if run.profilingConn == nil {
+		return
+	}
+
+	cpuTime := processCpuTime()
+	statementCpuTime := cpuTime - run.cpuTimeAt
+	run.cpuTimeAt = cpuTime
+
+	profilingInfo, err := duckdb.GetProfilingInfo(run.profilingConn)
+	if err != nil {
+		common.LogWarn(run.tracker.config.CommonConfig, "Couldn't get DuckDB profiling info:", err)
+		return
+	}
+	run.scanDuration += storageWaitDuration(profilingInfo, statementCpuTime)
+}
+
+func (run *QueryStatsRun) Stats(ctx context.Context, rowCount int64) (QueryStats, error) {
+	stats := QueryStats{Duration: time.Since(run.startedAt), RowCount: rowCount, StorageScanDuration: run.scanDuration}
+	if run.tracker.config.CommonConfig.LogLevel == common.LOG_LEVEL_TRACE {
+		return stats, nil // HTTP logs are written to stdout instead of the duckdb_logs table
+	}
+	if len(run.conns) == 0 {
+		stats.StorageTracked = true // The query didn't run in DuckDB
+		return stats, nil
+	}
+
+	run.tracker.mutex.RLock()
+	defer run.tracker.mutex.RUnlock()
+	if run.truncationCount != run.tracker.truncationCount {
+		return stats, nil // The logs were truncated while the query was running
+	}
+
+	// The connections are checked out or in a transaction block of the session while the query runs on them
+	var conditions []string
+	for _, trackedConn := range run.conns {
+		conditions = append(conditions, "(connection_id = "+fmt.Sprint(trackedConn.connectionId)+
+			" AND transaction_id >= "+fmt.Sprint(trackedConn.transactionId)+
+			" AND timestamp >= '"+trackedConn.startedAt.UTC().Format("2006-01-02 15:04:05.999999")+"')")
+	}
+	row := run.tracker.duckdbClient.QueryRowContext(ctx,
+		"SELECT COALESCE(SUM(TRY_CAST(response.headers['Content-Length'] AS BIGINT)), 0), COUNT(*) "+
+			"FROM duckdb_logs_parsed('HTTP') "+
+			"WHERE ("+strings.Join(conditions, " OR ")+") AND request.type = 'GET'",
+	)
+	err := row.Scan(&stats.StorageBytes, &stats.StorageRequestCount)
+	if err != nil {
+		return stats, err
+	}
+
+	stats.StorageTracked = true
+	return stats, nil
+}
+
+// Must be called after the query rows are closed and before the pooled connection goes back to the pool
+func (run *QueryStatsRun) Close() {
+	if run.closed {
+		return
+	}
+	run.closed = true
+	run.tracker.disableLogging(context.Background())
+	run.disableProfiling()
+}
+
+func (run *QueryStatsRun) disableProfiling() {
+	if run.profilingConn == nil {
+		return
+	}
+	_, err := run.profilingConn.ExecContext(context.Background(), "PRAGMA disable_profiling")
+	if err != nil {
+		common.LogWarn(run.tracker.config.CommonConfig, "Couldn't disable DuckDB profiling:", err)
+	}
+}
+
+// Returns the number of times the logs were truncated so far
+func (tracker *QueryStatsTracker) enableLogging(ctx context.Context) (int, error) {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+
+	if tracker.runningCount == 0 && tracker.config.CommonConfig.LogLevel != common.LOG_LEVEL_TRACE {
+		_, err := tracker.duckdbClient.ExecContext(ctx, "PRAGMA enable_logging('HTTP')")
+		if err != nil {
+			return 0, err
+		}
+	}
+	tracker.runningCount++
+	return tracker.truncationCount, nil
+}
+
+// Disables logging and drops the collected logs after the last running query with stats
+func (tracker *QueryStatsTracker) disableLogging(ctx context.Context) {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+
+	tracker.runningCount--
+	if tracker.config.CommonConfig.LogLevel == common.LOG_LEVEL_TRACE {
+		return
+	}
+	if tracker.runningCount > 0 {
+		tracker.truncateFullLogs(ctx)
+		return
+	}
+
+	for _, query := range []string{"PRAGMA disable_logging", "PRAGMA truncate_duckdb_logs"} {
+		_, err := tracker.duckdbClient.ExecContext(ctx, query)
+		if err != nil {
+			common.LogWarn(tracker.config.CommonConfig, "Couldn't reset DuckDB logging:", err)
+		}
+	}
+}
+
+// Drops the logs once they reach the max entries while other queries with stats keep logging, must be called with the mutex held
+func (tracker *QueryStatsTracker) truncateFullLogs(ctx context.Context) {
+	if time.Since(tracker.logsCheckedAt) < STORAGE_LOGS_CHECK_INTERVAL {
+		return
+	}
+	tracker.logsCheckedAt = time.Now()
+
+	var entryCount int64
+	err := tracker.duckdbClient.QueryRowContext(ctx, "SELECT COUNT(*) FROM duckdb_logs").Scan(&entryCount)
+	if err != nil {
+		common.LogWarn(tracker.config.CommonConfig, "Couldn't count DuckDB logs:", err)
+		return
+	}
+	if entryCount < tracker.maxLogEntries {
+		return
+	}
+
+	_, err = tracker.duckdbClient.ExecContext(ctx, "PRAGMA truncate_duckdb_logs")
+	if err != nil {
+		common.LogWarn(tracker.config.CommonConfig, "Couldn't truncate DuckDB logs:", err)
+		return
+	}
+	tracker.truncationCount++
+	common.LogWarn(tracker.config.CommonConfig, "Truncated", entryCount, "DuckDB logs, storage reads of the running queries won't be tracked")
+}
+
+// Most of the query duration was spent scanning object storage and it took longer than BEMIDB_STORAGE_LATENCY_NOTICE_MS
+func (stats QueryStats) StorageLatencyExceeded(thresholdMs int) bool {
+	if thresholdMs == 0 || !stats.StorageTracked || stats.StorageRequestCount == 0 {
+		return false
+	}
+	return stats.StorageScanDuration >= time.Duration(thresholdMs)*time.Millisecond &&
+		float64(stats.StorageScanDuration) >= float64(stats.Duration)*STORAGE_LATENCY_NOTICE_SHARE
+}
+
+// Query spent 4.200 s of 5.000 s waiting on object storage (12 requests, 104857600 bytes)
+func (stats QueryStats) StorageLatencyMessage() string {
+	return fmt.Sprintf(
+		"Query spent %.3f s of %.3f s waiting on object storage (%d requests, %d bytes)",
+		stats.StorageScanDuration.Seconds(), stats.Duration.Seconds(), stats.StorageRequestCount, stats.StorageBytes,
+	)
+}
+
+// duration: 12.345 ms, rows: 10, bytes scanned: 1048576 (3 requests)
+func (stats QueryStats) String() string {
+	message := fmt.Sprintf("duration: %.3f ms, rows: %d", float64(stats.Duration.Microseconds())/1000, stats.RowCount)
+	if stats.StorageTracked {
+		message += fmt.Sprintf(", bytes scanned: %d (%d requests)", stats.StorageBytes, stats.StorageRequestCount)
+	}
+	return message
+}
+
+// "0.123" -> 0.123, 0 if the metric is missing
+func parseProfilingSeconds(value string) float64 {
+	seconds, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0
+	}
+	return seconds
+}
+
+// Wall time the table scans of a statement waited on object storage.
+//
+// TABLE_SCAN operators time the threads scanning in parallel, including decoding. The CPU time of the process while the statement ran is
+// subtracted from them, which underestimates the wait while other queries run, and their remaining share of the time of all operators
+// is applied to the statement latency
+func storageWaitDuration(profilingInfo duckdb.ProfilingInfo, statementCpuTime time.Duration) time.Duration {
+	latency := parseProfilingSeconds(profilingInfo.Metrics["LATENCY"])
+	operatorTime := parseProfilingSeconds(profilingInfo.Metrics["CPU_TIME"])
+	waitTime := tableScanSeconds(profilingInfo) - statementCpuTime.Seconds()
+	if operatorTime <= 0 || waitTime <= 0 {
+		return 0
+	}
+	return time.Duration(latency * min(waitTime/operatorTime, 1) * float64(time.Second))
+}
+
+// User and system CPU time of the process, including all DuckDB threads
+func processCpuTime() time.Duration {
+	var rusage syscall.Rusage
+	err := syscall.Getrusage(syscall.RUSAGE_SELF, &rusage)
+	if err != nil {
+		return 0
+	}
+	return time.Duration(rusage.Utime.Nano() + rusage.Stime.Nano())
+}
+
+func tableScanSeconds(profilingInfo duckdb.ProfilingInfo) float64 {
+	var seconds float64
+	if profilingInfo.Metrics["OPERATOR_TYPE"] == "TABLE_SCAN" {
+		seconds += parseProfilingSeconds(profilingInfo.Metrics["OPERATOR_TIMING"])
+	}
+	for _, child := range profilingInfo.Children {
+		seconds += tableScanSeconds(child)
+	}
+	return seconds
+}
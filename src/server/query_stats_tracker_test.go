@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	duckdb "github.com/marcboeker/go-duckdb/v2"
+
+	"github.com/BemiHQ/BemiDB/src/common"
+)
+
+func TestQueryStatsTracker(t *testing.T) {
+	t.Run("Tracks queries answered without DuckDB", func(t *testing.T) {
+		tracker := testQueryStatsTracker(t)
+
+		run, err := tracker.Start(context.Background())
+		testNoError(t, err)
+		defer run.Close()
+
+		stats, err := run.Stats(context.Background(), 1)
+
+		testNoError(t, err)
+		if !stats.StorageTracked || stats.StorageRequestCount != 0 || stats.RowCount != 1 {
+			t.Errorf("Expected tracked stats without storage reads, got %+v", stats)
+		}
+	})
+
+	t.Run("Truncates full logs while other queries are running and stops tracking them", func(t *testing.T) {
+		tracker := testQueryStatsTracker(t)
+		tracker.maxLogEntries = 0
+		ctx := context.Background()
+
+		runningRun, err := tracker.Start(ctx)
+		testNoError(t, err)
+		defer runningRun.Close()
+		testNoError(t, runningRun.Track(ctx, testPooledConn(t, tracker)))
+
+		closedRun, err := tracker.Start(ctx)
+		testNoError(t, err)
+		closedRun.Close()
+
+		stats, err := runningRun.Stats(ctx, 0)
+		testNoError(t, err)
+		if stats.StorageTracked || tracker.truncationCount != 1 {
+			t.Errorf("Expected the logs to be truncated and the running query untracked, got %+v after %d truncations", stats, tracker.truncationCount)
+		}
+
+		nextRun, err := tracker.Start(ctx)
+		testNoError(t, err)
+		defer nextRun.Close()
+		testNoError(t, nextRun.Track(ctx, testPooledConn(t, tracker)))
+
+		stats, err = nextRun.Stats(ctx, 0)
+		testNoError(t, err)
+		if !stats.StorageTracked {
+			t.Errorf("Expected a query started after the truncation to be tracked, got %+v", stats)
+		}
+	})
+
+	t.Run("Checks the logs size at most once per interval", func(t *testing.T) {
+		tracker := testQueryStatsTracker(t)
+		tracker.maxLogEntries = 0
+		ctx := context.Background()
+
+		runningRun, err := tracker.Start(ctx)
+		testNoError(t, err)
+		defer runningRun.Close()
+
+		for i := 0; i < 3; i++ {
+			run, err := tracker.Start(ctx)
+			testNoError(t, err)
+			run.Close()
+		}
+
+		if tracker.truncationCount != 1 {
+			t.Errorf("Expected 1 truncation, got %d", tracker.truncationCount)
+		}
+	})
+
+	t.Run("Doesn't count decoding Parquet files as waiting on object storage", func(t *testing.T) {
+		tracker := testQueryStatsTracker(t)
+		tracker.config.StorageLatencyNoticeMs = 1
+		defer func() { tracker.config.StorageLatencyNoticeMs = 0 }()
+		ctx := context.Background()
+		parquetFilePath := filepath.Join(t.TempDir(), "test.parquet")
+		_, err := tracker.duckdbClient.ExecContext(ctx, "COPY (SELECT range AS id, md5(range::VARCHAR) AS value FROM range(2000000)) TO '"+parquetFilePath+"'")
+		testNoError(t, err)
+
+		run, err := tracker.Start(ctx)
+		testNoError(t, err)
+		defer run.Close()
+		conn := testPooledConn(t, tracker)
+		testNoError(t, run.Track(ctx, conn))
+
+		startedAt := time.Now()
+		rows, err := conn.QueryContext(ctx, "SELECT COUNT(*), MAX(value) FROM read_parquet('"+parquetFilePath+"')")
+		testNoError(t, err)
+		for rows.Next() {
+		}
+		rows.Close()
+		duration := time.Since(startedAt)
+		run.TrackProfile()
+
+		if run.scanDuration > duration/2 {
+			t.Errorf("Expected the scan to mostly decode the file, got %s of %s waiting on object storage", run.scanDuration, duration)
+		}
+	})
+}
+
+func TestStorageWaitDuration(t *testing.T) {
+	// 2 threads scan for 1.5 s each and aggregate for 0.5 s each in parallel during 2 s
+	profilingInfo := duckdb.ProfilingInfo{
+		Metrics: map[string]string{"LATENCY": "2.0", "CPU_TIME": "4.0"},
+		Children: []duckdb.ProfilingInfo{{
+			Metrics: map[string]string{"OPERATOR_TYPE": "HASH_GROUP_BY", "OPERATOR_TIMING": "1.0"},
+			Children: []duckdb.ProfilingInfo{
+				{Metrics: map[string]string{"OPERATOR_TYPE": "TABLE_SCAN", "OPERATOR_TIMING": "1.5"}},
+				{Metrics: map[string]string{"OPERATOR_TYPE": "TABLE_SCAN", "OPERATOR_TIMING": "1.5"}},
+			},
+		}},
+	}
+
+	t.Run("Applies the share of the scans waiting on object storage to the latency", func(t *testing.T) {
+		// 3 s of scans - 2 s on the CPU = 1 s of 4 s waiting -> a quarter of 2 s
+		waitDuration := storageWaitDuration(profilingInfo, 2*time.Second)
+
+		if waitDuration != 500*time.Millisecond {
+			t.Errorf("Expected 500ms, got %s", waitDuration)
+		}
+	})
+
+	t.Run("Returns 0 if the scans spent all their time on the CPU", func(t *testing.T) {
+		waitDuration := storageWaitDuration(profilingInfo, 4*time.Second)
+
+		if waitDuration != 0 {
+			t.Errorf("Expected 0, got %s", waitDuration)
+		}
+	})
+
+	t.Run("Returns 0 without table scans", func(t *testing.T) {
+		waitDuration := storageWaitDuration(duckdb.ProfilingInfo{Metrics: map[string]string{"LATENCY": "2.0", "CPU_TIME": "4.0"}}, 0)
+
+		if waitDuration != 0 {
+			t.Errorf("Expected 0, got %s", waitDuration)
+		}
+	})
+}
+
+func TestQueryStatsStorageLatencyExceeded(t *testing.T) {
+	stats := QueryStats{Duration: 3 * time.Second, StorageTracked: true, StorageRequestCount: 10, StorageScanDuration: 2 * time.Second}
+
+	t.Run("Returns true if most of the query waited on object storage for longer than the threshold", func(t *testing.T) {
+		if !stats.StorageLatencyExceeded(2000) {
+			t.Errorf("Expected the latency to be exceeded for %+v", stats)
+		}
+	})
+
+	t.Run("Returns false below the threshold, below half of the query duration, or without tracked storage reads", func(t *testing.T) {
+		shortWaitStats := stats
+		shortWaitStats.Duration = 5 * time.Second
+		untrackedStats := stats
+		untrackedStats.StorageTracked = false
+		cachedStats := stats
+		cachedStats.StorageRequestCount = 0
+
+		for thresholdMs, stats := range map[int]QueryStats{0: stats, 2001: stats, 1000: shortWaitStats, 1: untrackedStats, 2: cachedStats} {
+			if stats.StorageLatencyExceeded(thresholdMs) {
+				t.Errorf("Expected the latency not to be exceeded with %d ms for %+v", thresholdMs, stats)
+			}
+		}
+	})
+}
+
+func TestQueryStatsString(t *testing.T) {
+	t.Run("Returns the duration, rows, and storage reads", func(t *testing.T) {
+		stats := QueryStats{Duration: 12345 * time.Microsecond, RowCount: 10, StorageTracked: true, StorageBytes: 1048576, StorageRequestCount: 3}
+
+		if stats.String() != "duration: 12.345 ms, rows: 10, bytes scanned: 1048576 (3 requests)" {
+			t.Errorf("Unexpected stats message: %s", stats.String())
+		}
+	})
+
+	t.Run("Omits untracked storage reads", func(t *testing.T) {
+		stats := QueryStats{Duration: time.Millisecond, RowCount: 1, StorageBytes: 100}
+
+		if stats.String() != "duration: 1.000 ms, rows: 1" {
+			t.Errorf("Unexpected stats message: %s", stats.String())
+		}
+	})
+
+	t.Run("Returns the storage latency message", func(t *testing.T) {
+		stats := QueryStats{Duration: 5 * time.Second, StorageScanDuration: 4200 * time.Millisecond, StorageRequestCount: 12, StorageBytes: 104857600}
+
+		if stats.StorageLatencyMessage() != "Query spent 4.200 s of 5.000 s waiting on object storage (12 requests, 104857600 bytes)" {
+			t.Errorf("Unexpected storage latency message: %s", stats.StorageLatencyMessage())
+		}
+	})
+}
+
+func testQueryStatsTracker(t *testing.T) *QueryStatsTracker {
+	config := loadTestConfig()
+	duckdbClient := common.NewDuckdbClient(config.CommonConfig)
+	t.Cleanup(duckdbClient.Close)
+	return NewQueryStatsTracker(config, duckdbClient)
+}
+
+func testPooledConn(t *testing.T, tracker *QueryStatsTracker) duckdbConn {
+	conn, err := tracker.duckdbClient.Db.Conn(context.Background())
+	testNoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
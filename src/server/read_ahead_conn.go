@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"sync"
+)
+
+const READ_AHEAD_MAX_BUFFER_BYTES = 1 << 20
+
+// Reads from the client connection in the background to notice that the client disconnected while a query is running,
+// buffered bytes are returned by Read in the same order
+type ReadAheadConn struct {
+	net.Conn
+	mutex         sync.Mutex
+	cond          *sync.Cond
+	buffer        bytes.Buffer
+	err           error
+	stopped       bool // Closed by the server
+	closed        chan struct{}
+	closeOnce     sync.Once
+	readAheadDone chan struct{}
+}
+
+func NewReadAheadConn(conn net.Conn) *ReadAheadConn {
+	readAheadConn := &ReadAheadConn{Conn: conn, closed: make(chan struct{}), readAheadDone: make(chan struct{})}
+	readAheadConn.cond = sync.NewCond(&readAheadConn.mutex)
+	go readAheadConn.readAhead()
+	return readAheadConn
+}
+
+func (readAheadConn *ReadAheadConn) Read(data []byte) (int, error) {
+	readAheadConn.mutex.Lock()
+	defer readAheadConn.mutex.Unlock()
+
+	for readAheadConn.buffer.Len() == 0 && readAheadConn.err == nil && !readAheadConn.stopped {
+		readAheadConn.cond.Wait()
+	}
+	if readAheadConn.buffer.Len() == 0 {
+		if readAheadConn.err == nil {
+			return 0, net.ErrClosed
+		}
+		return 0, readAheadConn.err
+	}
+
+	n, _ := readAheadConn.buffer.Read(data)
+	readAheadConn.cond.Broadcast() // Resume reading ahead if the buffer was full
+	return n, nil
+}
+
+// Stops reading ahead, including while the buffer is full, and closes the client connection
+func (readAheadConn *ReadAheadConn) Close() error {
+	readAheadConn.mutex.Lock()
+	readAheadConn.stopped = true
+	readAheadConn.cond.Broadcast()
+	readAheadConn.mutex.Unlock()
+
+	readAheadConn.closeOnce.Do(func() { close(readAheadConn.closed) })
+	return readAheadConn.Conn.Close()
+}
+
+// Closed when the client disconnected or the connection was closed by the server. A client that only closed
+// its writing side (EOF) may still read the results, e.g. after piping queries into psql
+func (readAheadConn *ReadAheadConn) Closed() <-chan struct{} {
+	return readAheadConn.closed
+}
+
+func (readAheadConn *ReadAheadConn) readAhead() {
+	defer close(readAheadConn.readAheadDone)
+
+	chunk := make([]byte, 8192)
+	for {
+		readAheadConn.mutex.Lock()
+		for readAheadConn.buffer.Len() >= READ_AHEAD_MAX_BUFFER_BYTES && !readAheadConn.stopped {
+			readAheadConn.cond.Wait()
+		}
+		stopped := readAheadConn.stopped
+		readAheadConn.mutex.Unlock()
+		if stopped {
+			return
+		}
+
+		n, err := readAheadConn.Conn.Read(chunk)
+
+		readAheadConn.mutex.Lock()
+		readAheadConn.buffer.Write(chunk[:n])
+		readAheadConn.err = err
+		readAheadConn.cond.Broadcast()
+		readAheadConn.mutex.Unlock()
+
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				readAheadConn.closeOnce.Do(func() { close(readAheadConn.closed) })
+			}
+			return
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestReadAheadConn(t *testing.T) {
+	t.Run("Returns the client's bytes in the same order", func(t *testing.T) {
+		serverConn, clientConn := net.Pipe()
+		readAheadConn := NewReadAheadConn(serverConn)
+		defer readAheadConn.Close()
+		go func() {
+			clientConn.Write([]byte("first "))
+			clientConn.Write([]byte("second"))
+			clientConn.Close()
+		}()
+
+		data, err := io.ReadAll(readAheadConn)
+
+		testNoError(t, err)
+		if string(data) != "first second" {
+			t.Errorf("Expected %q, got %q", "first second", data)
+		}
+	})
+
+	t.Run("Stops reading ahead when closed with a full buffer", func(t *testing.T) {
+		serverConn, clientConn := net.Pipe()
+		readAheadConn := NewReadAheadConn(serverConn)
+		go clientConn.Write(bytes.Repeat([]byte("a"), 2*READ_AHEAD_MAX_BUFFER_BYTES))
+		testWaitFor(t, func() bool {
+			readAheadConn.mutex.Lock()
+			defer readAheadConn.mutex.Unlock()
+			return readAheadConn.buffer.Len() >= READ_AHEAD_MAX_BUFFER_BYTES
+		})
+
+		readAheadConn.Close()
+
+		select {
+		case <-readAheadConn.readAheadDone:
+		case <-time.After(time.Second):
+			t.Errorf("Expected the read-ahead goroutine to stop")
+		}
+		select {
+		case <-readAheadConn.Closed():
+		default:
+			t.Errorf("Expected the connection to be closed")
+		}
+	})
+
+	t.Run("Doesn't report a disconnect after the client closed its writing side", func(t *testing.T) {
+		readAheadConn, clientConn := testTcpReadAheadConn(t)
+		defer readAheadConn.Close()
+
+		clientConn.Write([]byte("query"))
+		clientConn.CloseWrite()
+		data, err := io.ReadAll(readAheadConn)
+
+		testNoError(t, err)
+		if string(data) != "query" {
+			t.Errorf("Expected %q, got %q", "query", data)
+		}
+		<-readAheadConn.readAheadDone
+		select {
+		case <-readAheadConn.Closed():
+			t.Errorf("Expected no disconnect after a half-close")
+		default:
+		}
+		_, err = readAheadConn.Write([]byte("results"))
+		testNoError(t, err)
+	})
+
+	t.Run("Reports a disconnect after the client reset the connection", func(t *testing.T) {
+		readAheadConn, clientConn := testTcpReadAheadConn(t)
+		defer readAheadConn.Close()
+
+		clientConn.SetLinger(0)
+		clientConn.Close()
+
+		select {
+		case <-readAheadConn.Closed():
+		case <-time.After(time.Second):
+			t.Errorf("Expected a disconnect after a reset")
+		}
+		if _, err := readAheadConn.Read(make([]byte, 1)); err == nil || errors.Is(err, io.EOF) {
+			t.Errorf("Expected a connection error, got %v", err)
+		}
+	})
+}
+
+func testTcpReadAheadConn(t *testing.T) (*ReadAheadConn, *net.TCPConn) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	testNoError(t, err)
+	defer listener.Close()
+
+	clientConn, err := net.Dial("tcp", listener.Addr().String())
+	testNoError(t, err)
+	serverConn, err := listener.Accept()
+	testNoError(t, err)
+	t.Cleanup(func() { clientConn.Close() })
+	return NewReadAheadConn(serverConn), clientConn.(*net.TCPConn)
+}
+
+func testWaitFor(t *testing.T, condition func() bool) {
+	deadline := time.Now().Add(time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for the condition")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
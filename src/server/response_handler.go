@@ -3,10 +3,14 @@ package main
 import (
 	"bytes"
 	"database/sql"
+	"encoding/binary"
 	"encoding/csv"
 	"encoding/json"
 	"fmt"
+	"math"
+	"math/big"
 	"strings"
+	"time"
 
 	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/marcboeker/go-duckdb/v2"
@@ -100,6 +104,10 @@ func (responseHandler *ResponseHandler) ColumnDescriptionTypeOid(col *sql.Column
 		return pgtype.JSONOID
 	}
 
+	if strings.HasPrefix(col.DatabaseTypeName(), "STRUCT(") && !strings.HasSuffix(col.DatabaseTypeName(), "[]") {
+		return pgtype.RecordOID
+	}
+
 	if strings.HasPrefix(col.DatabaseTypeName(), "DECIMAL") {
 		if strings.HasSuffix(col.DatabaseTypeName(), "[]") {
 			return pgtype.NumericArrayOID
@@ -139,6 +147,8 @@ func (responseHandler *ResponseHandler) RowValuePointer(col *sql.ColumnType) int
 		return new(NullJson)
 	case "[]interface {}":
 		return new(NullArray)
+	case "map[string]interface {}": // struct
+		return &NullRecord{FieldNames: structFieldNames(col.DatabaseTypeName())}
 	}
 
 	common.Panic(responseHandler.Config.CommonConfig, "Unsupported data row type: "+col.ScanType().String())
@@ -224,6 +234,12 @@ func (responseHandler *ResponseHandler) RowValueBytes(valuePtr interface{}, col
 		} else {
 			return nil
 		}
+	case *NullRecord:
+		if value.Present {
+			return []byte(value.String())
+		} else {
+			return nil
+		}
 	case *string:
 		return []byte(*value)
 	}
@@ -232,6 +248,224 @@ func (responseHandler *ResponseHandler) RowValueBytes(valuePtr interface{}, col
 	return nil
 }
 
+// Element types of the array types encoded in the binary format
+var PG_BINARY_ARRAY_ELEMENT_OIDS = map[uint32]uint32{
+	pgtype.BoolArrayOID:        pgtype.BoolOID,
+	pgtype.Int2ArrayOID:        pgtype.Int2OID,
+	pgtype.Int4ArrayOID:        pgtype.Int4OID,
+	pgtype.Int8ArrayOID:        pgtype.Int8OID,
+	pgtype.XIDArrayOID:         pgtype.XIDOID,
+	pgtype.Float4ArrayOID:      pgtype.Float4OID,
+	pgtype.Float8ArrayOID:      pgtype.Float8OID,
+	pgtype.NumericArrayOID:     pgtype.NumericOID,
+	pgtype.TextArrayOID:        pgtype.TextOID,
+	pgtype.DateArrayOID:        pgtype.DateOID,
+	pgtype.TimeArrayOID:        pgtype.TimeOID,
+	pgtype.TimestampArrayOID:   pgtype.TimestampOID,
+	pgtype.TimestamptzArrayOID: pgtype.TimestamptzOID,
+	pgtype.IntervalArrayOID:    pgtype.IntervalOID,
+	pgtype.UUIDArrayOID:        pgtype.UUIDOID,
+}
+
+// Returns the binary format code if the client requested it in Bind and the column type has a binary encoder, otherwise the text format code
+func (responseHandler *ResponseHandler) ColumnFormatCode(col *sql.ColumnType, columnIndex int, resultFormatCodes []int16) int16 {
+	var formatCode int16
+	switch {
+	case len(resultFormatCodes) == 1:
+		formatCode = resultFormatCodes[0]
+	case columnIndex < len(resultFormatCodes):
+		formatCode = resultFormatCodes[columnIndex]
+	}
+	if formatCode != pgtype.BinaryFormatCode {
+		return pgtype.TextFormatCode
+	}
+
+	oid := responseHandler.ColumnDescriptionTypeOid(col)
+	switch oid {
+	case pgtype.BoolOID, pgtype.Int2OID, pgtype.Int4OID, pgtype.Int8OID, pgtype.OIDOID, pgtype.XIDOID, pgtype.Float4OID, pgtype.Float8OID, pgtype.NumericOID,
+		pgtype.DateOID, pgtype.TimeOID, pgtype.TimestampOID, pgtype.TimestamptzOID, pgtype.IntervalOID, pgtype.UUIDOID, pgtype.ByteaOID, pgtype.TextOID, pgtype.JSONOID:
+		return pgtype.BinaryFormatCode
+	}
+	if _, ok := PG_BINARY_ARRAY_ELEMENT_OIDS[oid]; ok {
+		return pgtype.BinaryFormatCode
+	}
+	return pgtype.TextFormatCode
+}
+
+// Encodes values of the column types supported by ColumnFormatCode in the Postgres binary format
+func (responseHandler *ResponseHandler) RowValueBinaryBytes(valuePtr interface{}, col *sql.ColumnType) ([]byte, error) {
+	var value interface{}
+	switch valuePtr := valuePtr.(type) {
+	case *sql.NullBool:
+		if valuePtr.Valid {
+			value = valuePtr.Bool
+		}
+	case *sql.NullInt16:
+		if valuePtr.Valid {
+			value = valuePtr.Int16
+		}
+	case *sql.NullInt32: // int4, xid
+		if valuePtr.Valid {
+			value = valuePtr.Int32
+		}
+	case *sql.NullInt64: // int8, oid, numeric from hugeint
+		if valuePtr.Valid {
+			value = valuePtr.Int64
+		}
+	case *sql.NullFloat64:
+		if valuePtr.Valid {
+			value = valuePtr.Float64
+		}
+	case *sql.NullString: // text, uuid (16 bytes), bytea
+		if valuePtr.Valid {
+			value = valuePtr.String
+		}
+	case *sql.NullTime:
+		if valuePtr.Valid {
+			value = valuePtr.Time
+		}
+	case *NullDecimal:
+		if valuePtr.Present {
+			value = valuePtr.Value
+		}
+	case *NullInterval:
+		if valuePtr.Present {
+			value = valuePtr.Value
+		}
+	case *NullJson:
+		if valuePtr.Present {
+			value = valuePtr.String()
+		}
+	case *NullArray:
+		if valuePtr.Present {
+			value = valuePtr.Value
+		}
+	default:
+		return nil, fmt.Errorf("unsupported binary row type: %s", col.DatabaseTypeName())
+	}
+
+	return binaryValueBytes(value, responseHandler.ColumnDescriptionTypeOid(col))
+}
+
+// Encodes a value scanned from DuckDB as the Postgres type, nil for NULL
+func binaryValueBytes(value interface{}, oid uint32) ([]byte, error) {
+	if value == nil {
+		return nil, nil
+	}
+	if elementOid, ok := PG_BINARY_ARRAY_ELEMENT_OIDS[oid]; ok {
+		elements, ok := value.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("unsupported binary array value: %T", value)
+		}
+		return binaryArrayBytes(elements, elementOid)
+	}
+
+	switch value := value.(type) {
+	case bool:
+		if value {
+			return []byte{1}, nil
+		}
+		return []byte{0}, nil
+	case int16:
+		return binary.BigEndian.AppendUint16(nil, uint16(value)), nil
+	case int32:
+		return binaryIntegerBytes(int64(value), oid)
+	case uint32:
+		return binaryIntegerBytes(int64(value), oid)
+	case int64:
+		return binaryIntegerBytes(value, oid)
+	case *big.Int:
+		return binaryNumericBytes(pgtype.Numeric{Int: value, Valid: true})
+	case float32:
+		return binaryFloatBytes(float64(value), oid), nil
+	case float64:
+		return binaryFloatBytes(value, oid), nil
+	case string:
+		return []byte(value), nil
+	case []byte:
+		return value, nil
+	case duckdb.UUID:
+		return value[:], nil
+	case time.Time:
+		return binaryTimeBytes(value, oid)
+	case duckdb.Decimal:
+		return binaryNumericBytes(pgtype.Numeric{Int: value.Value, Exp: -int32(value.Scale), Valid: true})
+	case duckdb.Interval: // Microseconds, days, months
+		intervalBytes := binary.BigEndian.AppendUint64(nil, uint64(value.Micros))
+		intervalBytes = binary.BigEndian.AppendUint32(intervalBytes, uint32(value.Days))
+		return binary.BigEndian.AppendUint32(intervalBytes, uint32(value.Months)), nil
+	}
+	return nil, fmt.Errorf("unsupported binary value %T for type OID %d", value, oid)
+}
+
+// One-dimensional array: dimensions, has nulls, element type, length, lower bound, then the length and bytes of each element (-1 for NULL)
+func binaryArrayBytes(elements []interface{}, elementOid uint32) ([]byte, error) {
+	hasNulls := uint32(0)
+	var elementsBytes []byte
+	for _, element := range elements {
+		elementBytes, err := binaryValueBytes(element, elementOid)
+		if err != nil {
+			return nil, err
+		}
+		if elementBytes == nil {
+			hasNulls = 1
+			elementsBytes = binary.BigEndian.AppendUint32(elementsBytes, math.MaxUint32)
+			continue
+		}
+		elementsBytes = binary.BigEndian.AppendUint32(elementsBytes, uint32(len(elementBytes)))
+		elementsBytes = append(elementsBytes, elementBytes...)
+	}
+
+	if len(elements) == 0 {
+		return binary.BigEndian.AppendUint32(binary.BigEndian.AppendUint32(binary.BigEndian.AppendUint32(nil, 0), 0), elementOid), nil
+	}
+	arrayBytes := binary.BigEndian.AppendUint32(nil, 1)
+	arrayBytes = binary.BigEndian.AppendUint32(arrayBytes, hasNulls)
+	arrayBytes = binary.BigEndian.AppendUint32(arrayBytes, elementOid)
+	arrayBytes = binary.BigEndian.AppendUint32(arrayBytes, uint32(len(elements)))
+	arrayBytes = binary.BigEndian.AppendUint32(arrayBytes, 1)
+	return append(arrayBytes, elementsBytes...), nil
+}
+
+func binaryIntegerBytes(value int64, oid uint32) ([]byte, error) {
+	switch oid {
+	case pgtype.Int2OID:
+		return binary.BigEndian.AppendUint16(nil, uint16(value)), nil
+	case pgtype.Int4OID, pgtype.OIDOID, pgtype.XIDOID:
+		return binary.BigEndian.AppendUint32(nil, uint32(value)), nil
+	case pgtype.NumericOID:
+		return binaryNumericBytes(pgtype.Numeric{Int: big.NewInt(value), Valid: true})
+	}
+	return binary.BigEndian.AppendUint64(nil, uint64(value)), nil
+}
+
+func binaryFloatBytes(value float64, oid uint32) []byte {
+	if oid == pgtype.Float4OID {
+		return binary.BigEndian.AppendUint32(nil, math.Float32bits(float32(value)))
+	}
+	return binary.BigEndian.AppendUint64(nil, math.Float64bits(value))
+}
+
+func binaryNumericBytes(numeric pgtype.Numeric) ([]byte, error) {
+	return pgtype.NumericCodec{}.PlanEncode(nil, pgtype.NumericOID, pgtype.BinaryFormatCode, numeric).Encode(numeric, nil)
+}
+
+func binaryTimeBytes(value time.Time, oid uint32) ([]byte, error) {
+	switch oid {
+	case pgtype.DateOID: // Days since 2000-01-01
+		days := (value.Unix() - PG_EPOCH_UNIX_SECONDS) / (24 * 60 * 60)
+		return binary.BigEndian.AppendUint32(nil, uint32(int32(days))), nil
+	case pgtype.TimeOID: // Microseconds since midnight
+		microseconds := int64(value.Hour())*time.Hour.Microseconds() + int64(value.Minute())*time.Minute.Microseconds() +
+			int64(value.Second())*time.Second.Microseconds() + int64(value.Nanosecond()/1000)
+		return binary.BigEndian.AppendUint64(nil, uint64(microseconds)), nil
+	case pgtype.TimestampOID, pgtype.TimestamptzOID: // Microseconds since 2000-01-01 00:00:00 UTC
+		microseconds := value.UnixMicro() - PG_EPOCH_UNIX_SECONDS*1_000_000
+		return binary.BigEndian.AppendUint64(nil, uint64(microseconds)), nil
+	}
+	return nil, fmt.Errorf("unsupported binary time type OID %d", oid)
+}
+
 func (responseHandler *ResponseHandler) isSystemTableOidColumn(colName string) bool {
 	oidColumns := map[string]bool{
 		"oid":          true,
@@ -242,6 +476,8 @@ func (responseHandler *ResponseHandler) isSystemTableOidColumn(colName string) b
 		"did":          true,
 		"objoid":       true,
 		"classoid":     true,
+		"grantor":      true,
+		"grantee":      true,
 	}
 
 	return oidColumns[colName]
@@ -367,3 +603,96 @@ func (nullArray NullArray) String() string {
 	}
 	return ""
 }
+
+////////////////////////////////////////////////////////////////////////////////////////////////////
+
+type NullRecord struct {
+	Present    bool
+	FieldNames []string
+	Value      map[string]interface{}
+}
+
+func (nullRecord *NullRecord) Scan(value interface{}) error {
+	if value == nil {
+		nullRecord.Present = false
+		return nil
+	}
+
+	nullRecord.Present = true
+	nullRecord.Value = value.(map[string]interface{})
+	return nil
+}
+
+// Serializes to the Postgres record text format: (value1,"value 2",,t)
+func (nullRecord NullRecord) String() string {
+	if !nullRecord.Present {
+		return ""
+	}
+
+	var stringVals []string
+	for _, fieldName := range nullRecord.FieldNames {
+		switch v := nullRecord.Value[fieldName].(type) {
+		case nil:
+			stringVals = append(stringVals, "")
+		case bool:
+			stringVals = append(stringVals, fmt.Sprintf("%v", v)[0:1])
+		case []uint8:
+			stringVals = append(stringVals, quoteRecordField(string(v)))
+		default:
+			stringVals = append(stringVals, quoteRecordField(fmt.Sprintf("%v", v)))
+		}
+	}
+	return "(" + strings.Join(stringVals, ",") + ")"
+}
+
+func quoteRecordField(value string) string {
+	if value != "" && !strings.ContainsAny(value, ",()\"\\ \t\n") {
+		return value
+	}
+	return `"` + strings.ReplaceAll(strings.ReplaceAll(value, `\`, `\\`), `"`, `\"`) + `"`
+}
+
+// STRUCT(grantor BIGINT, "privilege type" VARCHAR, ...) -> [grantor, privilege type, ...]
+func structFieldNames(databaseTypeName string) []string {
+	fieldsDefinition := strings.TrimSuffix(strings.TrimPrefix(databaseTypeName, "STRUCT("), ")")
+
+	var fieldNames []string
+	depth := 0
+	inQuotes := false
+	fieldStart := 0
+	for i := 0; i <= len(fieldsDefinition); i++ {
+		if i < len(fieldsDefinition) {
+			switch fieldsDefinition[i] {
+			case '"':
+				inQuotes = !inQuotes
+				continue
+			case '(':
+				if !inQuotes {
+					depth++
+				}
+				continue
+			case ')':
+				if !inQuotes {
+					depth--
+				}
+				continue
+			case ',':
+				if inQuotes || depth > 0 {
+					continue
+				}
+			default:
+				continue
+			}
+		}
+
+		fieldDefinition := strings.TrimSpace(fieldsDefinition[fieldStart:i])
+		fieldStart = i + 1
+		if strings.HasPrefix(fieldDefinition, `"`) {
+			closingQuoteIndex := strings.Index(fieldDefinition[1:], `"`) + 1
+			fieldNames = append(fieldNames, fieldDefinition[1:closingQuoteIndex])
+		} else {
+			fieldNames = append(fieldNames, strings.SplitN(fieldDefinition, " ", 2)[0])
+		}
+	}
+	return fieldNames
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"github.com/BemiHQ/BemiDB/src/common"
+)
+
+const COMPARE_MAX_REPORTED_ROWS = 3
+
+// bemidb compare queries.json <url> <url> -> runs the queries against both servers, e.g. the current and an upgraded version,
+// and reports the queries with different errors, columns, column types, or rows. Exits with 1 if any of them differ
+func CompareResults(config *Config, queriesFilePath string, url string, otherUrl string) {
+	if queriesFilePath == "" || url == "" || otherUrl == "" {
+		panic("Usage: " + COMMAND_COMPARE + " <queries file> <database URL> <other database URL>")
+	}
+
+	queriesJson, err := os.ReadFile(queriesFilePath)
+	common.PanicIfError(config.CommonConfig, err)
+
+	var queries []CanaryQuery // Only the names and queries are used
+	err = json.Unmarshal(queriesJson, &queries)
+	if err != nil {
+		panic("Invalid queries format. Expected a JSON array like the canary queries: " + err.Error())
+	}
+
+	ctx := context.Background()
+	conn, err := pgconn.Connect(ctx, url)
+	common.PanicIfError(config.CommonConfig, err)
+	defer conn.Close(ctx)
+	otherConn, err := pgconn.Connect(ctx, otherUrl)
+	common.PanicIfError(config.CommonConfig, err)
+	defer otherConn.Close(ctx)
+
+	differentCount := 0
+	for _, query := range queries {
+		results, err := conn.Exec(ctx, query.Query).ReadAll()
+		otherResults, otherErr := otherConn.Exec(ctx, query.Query).ReadAll()
+
+		differences := compareQueryResults(results, err, otherResults, otherErr)
+		if len(differences) == 0 {
+			common.LogInfo(config.CommonConfig, "Same results:", query.Name)
+			continue
+		}
+
+		differentCount++
+		common.LogWarn(config.CommonConfig, "Different results: "+query.Name+"\n  "+strings.Join(differences, "\n  "))
+	}
+
+	common.LogInfo(config.CommonConfig, "Compared", len(queries), "queries,", differentCount, "with different results")
+	if differentCount > 0 {
+		os.Exit(1)
+	}
+}
+
+// Compares the results of the statements in order, the rows are compared as text in the returned order
+func compareQueryResults(results []*pgconn.Result, err error, otherResults []*pgconn.Result, otherErr error) []string {
+	if err != nil || otherErr != nil {
+		if err == nil || otherErr == nil || err.Error() != otherErr.Error() {
+			return []string{fmt.Sprintf("error: %v vs %v", err, otherErr)}
+		}
+		return nil
+	}
+	if len(results) != len(otherResults) {
+		return []string{fmt.Sprintf("statements: %d vs %d", len(results), len(otherResults))}
+	}
+
+	var differences []string
+	for i, result := range results {
+		otherResult := otherResults[i]
+		prefix := ""
+		if len(results) > 1 {
+			prefix = "statement #" + common.IntToString(i+1) + " "
+		}
+
+		if result.Err != nil || otherResult.Err != nil {
+			if result.Err == nil || otherResult.Err == nil || result.Err.Error() != otherResult.Err.Error() {
+				differences = append(differences, fmt.Sprintf("%serror: %v vs %v", prefix, result.Err, otherResult.Err))
+			}
+			continue
+		}
+
+		columns, columnTypes := resultColumns(result)
+		otherColumns, otherColumnTypes := resultColumns(otherResult)
+		if !slices.Equal(columns, otherColumns) {
+			differences = append(differences, fmt.Sprintf("%scolumns: %v vs %v", prefix, columns, otherColumns))
+			continue
+		}
+		if !slices.Equal(columnTypes, otherColumnTypes) {
+			differences = append(differences, fmt.Sprintf("%scolumn type OIDs: %v vs %v", prefix, columnTypes, otherColumnTypes))
+		}
+
+		if len(result.Rows) != len(otherResult.Rows) {
+			differences = append(differences, fmt.Sprintf("%srows: %d vs %d", prefix, len(result.Rows), len(otherResult.Rows)))
+			continue
+		}
+		reportedRowCount := 0
+		for j, row := range result.Rows {
+			if slices.EqualFunc(row, otherResult.Rows[j], func(value []byte, otherValue []byte) bool {
+				return (value == nil) == (otherValue == nil) && string(value) == string(otherValue)
+			}) {
+				continue
+			}
+			if reportedRowCount == COMPARE_MAX_REPORTED_ROWS {
+				differences = append(differences, prefix+"more rows differ")
+				break
+			}
+			differences = append(differences, fmt.Sprintf("%srow #%d: %v vs %v", prefix, j+1, resultRowValues(row), resultRowValues(otherResult.Rows[j])))
+			reportedRowCount++
+		}
+	}
+	return differences
+}
+
+func resultColumns(result *pgconn.Result) ([]string, []uint32) {
+	columns := make([]string, len(result.FieldDescriptions))
+	columnTypes := make([]uint32, len(result.FieldDescriptions))
+	for i, field := range result.FieldDescriptions {
+		columns[i] = field.Name
+		columnTypes[i] = field.DataTypeOID
+	}
+	return columns, columnTypes
+}
+
+// NULL values are shown as NULL, other values as quoted text
+func resultRowValues(row [][]byte) []string {
+	values := make([]string, len(row))
+	for i, value := range row {
+		if value == nil {
+			values[i] = "NULL"
+		} else {
+			values[i] = fmt.Sprintf("%q", value)
+		}
+	}
+	return values
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func TestCompareQueryResults(t *testing.T) {
+	t.Run("Returns no differences for the same results", func(t *testing.T) {
+		results := []*pgconn.Result{testCompareResult([]string{"id", "name"}, [][][]byte{{[]byte("1"), nil}, {[]byte("2"), []byte("b")}})}
+		otherResults := []*pgconn.Result{testCompareResult([]string{"id", "name"}, [][][]byte{{[]byte("1"), nil}, {[]byte("2"), []byte("b")}})}
+
+		differences := compareQueryResults(results, nil, otherResults, nil)
+
+		if len(differences) != 0 {
+			t.Errorf("Expected no differences, got %v", differences)
+		}
+	})
+
+	t.Run("Returns no differences for the same errors", func(t *testing.T) {
+		differences := compareQueryResults(nil, errors.New("syntax error"), nil, errors.New("syntax error"))
+
+		if len(differences) != 0 {
+			t.Errorf("Expected no differences, got %v", differences)
+		}
+	})
+
+	t.Run("Returns different errors", func(t *testing.T) {
+		results := []*pgconn.Result{testCompareResult([]string{"id"}, [][][]byte{{[]byte("1")}})}
+
+		for _, testCase := range []struct {
+			differences         []string
+			expectedDifferences []string
+		}{
+			{
+				differences:         compareQueryResults(nil, errors.New("syntax error"), nil, errors.New("other error")),
+				expectedDifferences: []string{"error: syntax error vs other error"},
+			},
+			{
+				differences:         compareQueryResults(nil, errors.New("syntax error"), results, nil),
+				expectedDifferences: []string{"error: syntax error vs <nil>"},
+			},
+			{
+				differences:         compareQueryResults(results, nil, []*pgconn.Result{{Err: errors.New("statement error")}}, nil),
+				expectedDifferences: []string{"error: <nil> vs statement error"},
+			},
+		} {
+			if !slices.Equal(testCase.differences, testCase.expectedDifferences) {
+				t.Errorf("Expected %v, got %v", testCase.expectedDifferences, testCase.differences)
+			}
+		}
+	})
+
+	t.Run("Returns different statement counts, columns, and column types", func(t *testing.T) {
+		results := []*pgconn.Result{testCompareResult([]string{"id"}, nil)}
+		renamedColumnResults := []*pgconn.Result{testCompareResult([]string{"user_id"}, nil)}
+		retypedColumnResults := []*pgconn.Result{testCompareResult([]string{"id"}, nil)}
+		retypedColumnResults[0].FieldDescriptions[0].DataTypeOID = pgtype.Int8OID
+
+		for _, testCase := range []struct {
+			otherResults        []*pgconn.Result
+			expectedDifferences []string
+		}{
+			{otherResults: []*pgconn.Result{results[0], results[0]}, expectedDifferences: []string{"statements: 1 vs 2"}},
+			{otherResults: renamedColumnResults, expectedDifferences: []string{"columns: [id] vs [user_id]"}},
+			{otherResults: retypedColumnResults, expectedDifferences: []string{"column type OIDs: [25] vs [20]"}},
+		} {
+			differences := compareQueryResults(results, nil, testCase.otherResults, nil)
+
+			if !slices.Equal(differences, testCase.expectedDifferences) {
+				t.Errorf("Expected %v, got %v", testCase.expectedDifferences, differences)
+			}
+		}
+	})
+
+	t.Run("Returns different rows with NULL and empty values told apart", func(t *testing.T) {
+		results := []*pgconn.Result{testCompareResult([]string{"name"}, [][][]byte{{nil}, {[]byte("a")}})}
+		otherResults := []*pgconn.Result{testCompareResult([]string{"name"}, [][][]byte{{[]byte("")}, {[]byte("a")}})}
+		fewerRowsResults := []*pgconn.Result{testCompareResult([]string{"name"}, [][][]byte{{nil}})}
+
+		differences := compareQueryResults(results, nil, otherResults, nil)
+		fewerRowsDifferences := compareQueryResults(results, nil, fewerRowsResults, nil)
+
+		expectedDifferences := []string{`row #1: [NULL] vs [""]`}
+		if !slices.Equal(differences, expectedDifferences) {
+			t.Errorf("Expected %v, got %v", expectedDifferences, differences)
+		}
+		expectedDifferences = []string{"rows: 2 vs 1"}
+		if !slices.Equal(fewerRowsDifferences, expectedDifferences) {
+			t.Errorf("Expected %v, got %v", expectedDifferences, fewerRowsDifferences)
+		}
+	})
+
+	t.Run("Reports a limited number of different rows per statement", func(t *testing.T) {
+		var rows, otherRows [][][]byte
+		for i := 0; i < COMPARE_MAX_REPORTED_ROWS+2; i++ {
+			rows = append(rows, [][]byte{[]byte("a")})
+			otherRows = append(otherRows, [][]byte{[]byte("b")})
+		}
+		results := []*pgconn.Result{testCompareResult([]string{"id"}, nil), testCompareResult([]string{"name"}, rows)}
+		otherResults := []*pgconn.Result{testCompareResult([]string{"id"}, nil), testCompareResult([]string{"name"}, otherRows)}
+
+		differences := compareQueryResults(results, nil, otherResults, nil)
+
+		expectedDifferences := []string{
+			`statement #2 row #1: ["a"] vs ["b"]`,
+			`statement #2 row #2: ["a"] vs ["b"]`,
+			`statement #2 row #3: ["a"] vs ["b"]`,
+			"statement #2 more rows differ",
+		}
+		if !slices.Equal(differences, expectedDifferences) {
+			t.Errorf("Expected %v, got %v", expectedDifferences, differences)
+		}
+	})
+}
+
+func testCompareResult(columns []string, rows [][][]byte) *pgconn.Result {
+	fieldDescriptions := make([]pgconn.FieldDescription, len(columns))
+	for i, column := range columns {
+		fieldDescriptions[i] = pgconn.FieldDescription{Name: column, DataTypeOID: pgtype.TextOID}
+	}
+	return &pgconn.Result{FieldDescriptions: fieldDescriptions, Rows: rows}
+}
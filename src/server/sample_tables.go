@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/BemiHQ/BemiDB/src/common"
+)
+
+const (
+	SAMPLE_TABLES_DUCKDB_SCHEMA = "bemidb_samples"
+	SAMPLE_TABLES_QUEUE_SIZE    = 100
+	SAMPLE_TABLES_FUNCTION      = "bemidb_sample" // FROM bemidb_sample('schema.table')
+)
+
+type SampleTable struct {
+	MetadataPath string // Metadata file the table was checked or sampled from
+	Sampled      bool   // False if the table has no more rows than BEMIDB_SAMPLE_ROWS
+}
+
+// Keeps sampled copies of tables with more rows than BEMIDB_SAMPLE_ROWS in native DuckDB tables for sessions with SET bemidb.sample_tables = on and bemidb_sample('table').
+// Samples are created and refreshed one at a time by a single worker: every BEMIDB_SAMPLE_REFRESH_SECONDS for all changed tables,
+// and when a query reads a table whose Iceberg metadata file changed, queries read the previous sample until then.
+type SampleTables struct {
+	mutex          sync.Mutex
+	config         *Config
+	icebergReader  *IcebergReader
+	duckdbClient   *common.DuckdbClient
+	tableRowCounts *TableRowCounts
+	sampleTables   map[common.IcebergSchemaTable]SampleTable
+	loading        common.Set[common.IcebergSchemaTable] // Queued in loadQueue
+	loadQueue      chan sampleTableLoad
+}
+
+type sampleTableLoad struct {
+	icebergSchemaTable common.IcebergSchemaTable
+	metadataFileS3Path string
+}
+
+func NewSampleTables(config *Config, icebergReader *IcebergReader, duckdbClient *common.DuckdbClient, tableRowCounts *TableRowCounts) *SampleTables {
+	return &SampleTables{
+		config:         config,
+		icebergReader:  icebergReader,
+		duckdbClient:   duckdbClient,
+		tableRowCounts: tableRowCounts,
+		sampleTables:   make(map[common.IcebergSchemaTable]SampleTable),
+		loading:        common.NewSet[common.IcebergSchemaTable](),
+		loadQueue:      make(chan sampleTableLoad, SAMPLE_TABLES_QUEUE_SIZE),
+	}
+}
+
+// Runs the worker in the background: samples all tables on boot so that the first previews don't read the full tables,
+// then the tables queued by queries and the changed tables on schedule
+func (sampleTables *SampleTables) Run() {
+	if sampleTables.config.SampleRows == 0 {
+		return
+	}
+
+	sampleTables.LoadAll()
+
+	ticker := time.NewTicker(time.Duration(sampleTables.config.SampleRefreshIntervalSeconds) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case tableLoad := <-sampleTables.loadQueue:
+			sampleTables.load(tableLoad.icebergSchemaTable, tableLoad.metadataFileS3Path)
+
+			sampleTables.mutex.Lock()
+			sampleTables.loading.Remove(tableLoad.icebergSchemaTable)
+			sampleTables.mutex.Unlock()
+		case <-ticker.C:
+			sampleTables.LoadAll()
+		}
+	}
+}
+
+// Samples all tables that weren't sampled from their current metadata file yet
+func (sampleTables *SampleTables) LoadAll() {
+	if sampleTables.config.SampleRows == 0 {
+		return
+	}
+
+	icebergSchemaTables, err := sampleTables.icebergReader.SchemaTables()
+	if err != nil {
+		common.LogError(sampleTables.config.CommonConfig, "Couldn't read tables to sample:", err)
+		return
+	}
+
+	sortedSchemaTables := icebergSchemaTables.Values()
+	slices.SortFunc(sortedSchemaTables, common.CompareIcebergSchemaTables)
+	for _, icebergSchemaTable := range sortedSchemaTables {
+		metadataFileS3Path := sampleTables.icebergReader.MetadataFileS3Path(icebergSchemaTable)
+
+		sampleTables.mutex.Lock()
+		isCurrent := sampleTables.sampleTables[icebergSchemaTable].MetadataPath == metadataFileS3Path
+		sampleTables.mutex.Unlock()
+
+		if !isCurrent {
+			sampleTables.load(icebergSchemaTable, metadataFileS3Path)
+		}
+	}
+}
+
+// Returns the DuckDB table with the sample of the table, possibly from a previous metadata file while it's refreshed,
+// or an empty string if the table isn't sampled (yet)
+func (sampleTables *SampleTables) DuckdbTableName(icebergSchemaTable common.IcebergSchemaTable, metadataFileS3Path string) string {
+	if sampleTables.config.SampleRows == 0 {
+		return ""
+	}
+
+	sampleTables.mutex.Lock()
+	defer sampleTables.mutex.Unlock()
+
+	sampleTable, ok := sampleTables.sampleTables[icebergSchemaTable]
+	if (!ok || sampleTable.MetadataPath != metadataFileS3Path) && !sampleTables.loading.Contains(icebergSchemaTable) {
+		select {
+		case sampleTables.loadQueue <- sampleTableLoad{icebergSchemaTable: icebergSchemaTable, metadataFileS3Path: metadataFileS3Path}:
+			sampleTables.loading.Add(icebergSchemaTable)
+		default:
+			// The queue is full, the table is sampled by a later query or the next refresh
+		}
+	}
+
+	if !sampleTable.Sampled {
+		return ""
+	}
+	return sampleTables.duckdbTableName(icebergSchemaTable)
+}
+
+func (sampleTables *SampleTables) load(icebergSchemaTable common.IcebergSchemaTable, metadataFileS3Path string) {
+	rowCount, err := sampleTables.tableRowCounts.RowCount(metadataFileS3Path)
+	if err != nil {
+		common.LogError(sampleTables.config.CommonConfig, "Couldn't read the row count of "+icebergSchemaTable.ToArg()+" to sample it:", err)
+		return
+	}
+
+	sampled := rowCount > int64(sampleTables.config.SampleRows)
+	if sampled {
+		common.LogInfo(sampleTables.config.CommonConfig, "Sampling table:", icebergSchemaTable.ToArg())
+		err = sampleTables.duckdbClient.ExecTransactionContext(context.Background(), []string{
+			"CREATE SCHEMA IF NOT EXISTS " + SAMPLE_TABLES_DUCKDB_SCHEMA,
+			"CREATE OR REPLACE TABLE " + sampleTables.duckdbTableName(icebergSchemaTable) + " AS SELECT * FROM iceberg_scan('$path') USING SAMPLE reservoir(" + common.IntToString(sampleTables.config.SampleRows) + " ROWS) REPEATABLE (1)",
+		}, []map[string]string{nil, {"path": metadataFileS3Path}})
+		if err != nil {
+			common.LogError(sampleTables.config.CommonConfig, "Couldn't sample table "+icebergSchemaTable.ToArg()+":", err)
+			return
+		}
+	}
+
+	sampleTables.mutex.Lock()
+	defer sampleTables.mutex.Unlock()
+	sampleTables.sampleTables[icebergSchemaTable] = SampleTable{MetadataPath: metadataFileS3Path, Sampled: sampled}
+}
+
+// public.table -> bemidb_samples."public.table"
+func (sampleTables *SampleTables) duckdbTableName(icebergSchemaTable common.IcebergSchemaTable) string {
+	return SAMPLE_TABLES_DUCKDB_SCHEMA + `."` + icebergSchemaTable.ToArg() + `"`
+}
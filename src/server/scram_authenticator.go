@@ -0,0 +1,147 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+const (
+	SCRAM_SHA_256_MECHANISM = "SCRAM-SHA-256"
+
+	scramNonceLength = 18
+)
+
+// Server side of the SCRAM-SHA-256 exchange (RFC 5802, RFC 7677) against a password stored as
+// "SCRAM-SHA-256$<iterations>:<salt>$<StoredKey>:<ServerKey>", the same format as Postgres uses in pg_authid
+type ScramAuthenticator struct {
+	iterations int
+	salt       []byte
+	storedKey  []byte
+	serverKey  []byte
+
+	clientFirstMessageBare string
+	serverFirstMessage     string
+	gs2Header              string
+	nonce                  string
+}
+
+func NewScramAuthenticator(encryptedPassword string) (*ScramAuthenticator, error) {
+	mechanism, secrets, ok := strings.Cut(encryptedPassword, "$")
+	if !ok || mechanism != SCRAM_SHA_256_MECHANISM {
+		return nil, errors.New("invalid SCRAM-SHA-256 secret")
+	}
+	iterationsSalt, keys, ok := strings.Cut(secrets, "$")
+	if !ok {
+		return nil, errors.New("invalid SCRAM-SHA-256 secret")
+	}
+	iterations, salt, ok := strings.Cut(iterationsSalt, ":")
+	if !ok {
+		return nil, errors.New("invalid SCRAM-SHA-256 secret")
+	}
+	storedKey, serverKey, ok := strings.Cut(keys, ":")
+	if !ok {
+		return nil, errors.New("invalid SCRAM-SHA-256 secret")
+	}
+
+	authenticator := &ScramAuthenticator{}
+	var err error
+	if authenticator.iterations, err = strconv.Atoi(iterations); err != nil {
+		return nil, errors.New("invalid SCRAM-SHA-256 iterations")
+	}
+	if authenticator.salt, err = base64.StdEncoding.DecodeString(salt); err != nil {
+		return nil, errors.New("invalid SCRAM-SHA-256 salt")
+	}
+	if authenticator.storedKey, err = base64.StdEncoding.DecodeString(storedKey); err != nil {
+		return nil, errors.New("invalid SCRAM-SHA-256 stored key")
+	}
+	if authenticator.serverKey, err = base64.StdEncoding.DecodeString(serverKey); err != nil {
+		return nil, errors.New("invalid SCRAM-SHA-256 server key")
+	}
+	return authenticator, nil
+}
+
+// "n,,n=user,r=<client nonce>" -> "r=<client nonce><server nonce>,s=<salt>,i=<iterations>"
+func (authenticator *ScramAuthenticator) ServerFirstMessage(clientFirstMessage string) (string, error) {
+	// GS2 header: channel binding flag and an optional authzid
+	parts := strings.SplitN(clientFirstMessage, ",", 3)
+	if len(parts) != 3 {
+		return "", errors.New("malformed SCRAM message")
+	}
+	switch {
+	case parts[0] == "n" || parts[0] == "y":
+	case strings.HasPrefix(parts[0], "p="):
+		return "", errors.New("SCRAM channel binding is not supported")
+	default:
+		return "", errors.New("malformed SCRAM message")
+	}
+	authenticator.gs2Header = parts[0] + "," + parts[1] + ","
+	authenticator.clientFirstMessageBare = parts[2]
+
+	// The user name is ignored as in Postgres, the one from the startup message is used instead
+	clientNonce := scramAttribute(authenticator.clientFirstMessageBare, "r")
+	if clientNonce == "" {
+		return "", errors.New("malformed SCRAM message")
+	}
+
+	serverNonce := make([]byte, scramNonceLength)
+	_, err := rand.Read(serverNonce)
+	if err != nil {
+		return "", err
+	}
+	authenticator.nonce = clientNonce + base64.StdEncoding.EncodeToString(serverNonce)
+
+	authenticator.serverFirstMessage = "r=" + authenticator.nonce +
+		",s=" + base64.StdEncoding.EncodeToString(authenticator.salt) +
+		",i=" + strconv.Itoa(authenticator.iterations)
+	return authenticator.serverFirstMessage, nil
+}
+
+// "c=<channel binding>,r=<nonce>,p=<client proof>" -> "v=<server signature>"
+func (authenticator *ScramAuthenticator) ServerFinalMessage(clientFinalMessage string) (string, error) {
+	clientFinalMessageWithoutProof, proof, ok := strings.Cut(clientFinalMessage, ",p=")
+	if !ok {
+		return "", errors.New("malformed SCRAM message")
+	}
+
+	channelBinding := scramAttribute(clientFinalMessageWithoutProof, "c")
+	if channelBinding != base64.StdEncoding.EncodeToString([]byte(authenticator.gs2Header)) {
+		return "", errors.New("SCRAM channel binding check failed")
+	}
+	if scramAttribute(clientFinalMessageWithoutProof, "r") != authenticator.nonce {
+		return "", errors.New("SCRAM nonce mismatch")
+	}
+
+	clientProof, err := base64.StdEncoding.DecodeString(proof)
+	if err != nil || len(clientProof) != len(authenticator.storedKey) {
+		return "", errors.New("malformed SCRAM client proof")
+	}
+
+	authMessage := []byte(authenticator.clientFirstMessageBare + "," + authenticator.serverFirstMessage + "," + clientFinalMessageWithoutProof)
+
+	// ClientKey = ClientProof XOR HMAC(StoredKey, AuthMessage), and H(ClientKey) must match StoredKey
+	clientSignature := hmacSha256Hash(authenticator.storedKey, authMessage)
+	clientKey := make([]byte, len(clientProof))
+	for i := range clientProof {
+		clientKey[i] = clientProof[i] ^ clientSignature[i]
+	}
+	if !hmac.Equal(sha256Hash(clientKey), authenticator.storedKey) {
+		return "", errors.New("SCRAM client proof is invalid")
+	}
+
+	serverSignature := hmacSha256Hash(authenticator.serverKey, authMessage)
+	return "v=" + base64.StdEncoding.EncodeToString(serverSignature), nil
+}
+
+// "a=1,b=2", "b" -> "2"
+func scramAttribute(message string, name string) string {
+	for _, attribute := range strings.Split(message, ",") {
+		if value, ok := strings.CutPrefix(attribute, name+"="); ok {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+func TestScramAuthenticator(t *testing.T) {
+	verifier := StringToScramSha256("user", "password", "")
+
+	t.Run("Completes the exchange with the right password", func(t *testing.T) {
+		authenticator, err := NewScramAuthenticator(verifier)
+		testNoError(t, err)
+
+		serverFirstMessage, err := authenticator.ServerFirstMessage("n,,n=user,r=clientnonce")
+		testNoError(t, err)
+		clientFinalMessage, authMessage, saltedPassword := testScramClientFinalMessage(t, "password", "n,,", "n=user,r=clientnonce", serverFirstMessage)
+		serverFinalMessage, err := authenticator.ServerFinalMessage(clientFinalMessage)
+
+		testNoError(t, err)
+		if !strings.HasPrefix(scramAttribute(serverFirstMessage, "r"), "clientnonce") {
+			t.Errorf("Expected the nonce to start with the client nonce, got %s", serverFirstMessage)
+		}
+		serverKey := hmacSha256Hash(saltedPassword, []byte("Server Key"))
+		expectedServerFinalMessage := "v=" + base64.StdEncoding.EncodeToString(hmacSha256Hash(serverKey, []byte(authMessage)))
+		if serverFinalMessage != expectedServerFinalMessage {
+			t.Errorf("Expected the server signature %s, got %s", expectedServerFinalMessage, serverFinalMessage)
+		}
+	})
+
+	t.Run("Rejects a wrong password", func(t *testing.T) {
+		authenticator, err := NewScramAuthenticator(verifier)
+		testNoError(t, err)
+
+		serverFirstMessage, err := authenticator.ServerFirstMessage("n,,n=user,r=clientnonce")
+		testNoError(t, err)
+		clientFinalMessage, _, _ := testScramClientFinalMessage(t, "wrong password", "n,,", "n=user,r=clientnonce", serverFirstMessage)
+		_, err = authenticator.ServerFinalMessage(clientFinalMessage)
+
+		if err == nil || err.Error() != "SCRAM client proof is invalid" {
+			t.Errorf("Expected an invalid proof error, got %v", err)
+		}
+	})
+
+	t.Run("Rejects a changed nonce or channel binding", func(t *testing.T) {
+		for _, testCase := range []struct {
+			clientFinalMessageFunc func(string) string
+			expectedError          string
+		}{
+			{func(message string) string { return strings.Replace(message, ",r=clientnonce", ",r=othernonce", 1) }, "SCRAM nonce mismatch"},
+			{func(message string) string { return strings.Replace(message, "c=biws", "c=eSws", 1) }, "SCRAM channel binding check failed"},
+			{func(message string) string { return strings.Split(message, ",p=")[0] }, "malformed SCRAM message"},
+		} {
+			authenticator, err := NewScramAuthenticator(verifier)
+			testNoError(t, err)
+			serverFirstMessage, err := authenticator.ServerFirstMessage("n,,n=user,r=clientnonce")
+			testNoError(t, err)
+			clientFinalMessage, _, _ := testScramClientFinalMessage(t, "password", "n,,", "n=user,r=clientnonce", serverFirstMessage)
+
+			_, err = authenticator.ServerFinalMessage(testCase.clientFinalMessageFunc(clientFinalMessage))
+
+			if err == nil || err.Error() != testCase.expectedError {
+				t.Errorf("Expected '%s', got %v", testCase.expectedError, err)
+			}
+		}
+	})
+
+	t.Run("Rejects malformed client first messages and channel binding", func(t *testing.T) {
+		for clientFirstMessage, expectedError := range map[string]string{
+			"n,,n=user":                          "malformed SCRAM message",
+			"n=user,r=clientnonce":               "malformed SCRAM message",
+			"x,,n=user,r=clientnonce":            "malformed SCRAM message",
+			"p=tls-server-end-point,,n=user,r=a": "SCRAM channel binding is not supported",
+		} {
+			authenticator, err := NewScramAuthenticator(verifier)
+			testNoError(t, err)
+
+			_, err = authenticator.ServerFirstMessage(clientFirstMessage)
+
+			if err == nil || err.Error() != expectedError {
+				t.Errorf("Expected '%s' for %s, got %v", expectedError, clientFirstMessage, err)
+			}
+		}
+	})
+
+	t.Run("Rejects invalid verifiers", func(t *testing.T) {
+		for _, encryptedPassword := range []string{"", "md5abc", "SCRAM-SHA-256$4096:c2FsdA==", "SCRAM-SHA-256$x:c2FsdA==$a2V5:a2V5", "SCRAM-SHA-256$4096:!$a2V5:a2V5"} {
+			if _, err := NewScramAuthenticator(encryptedPassword); err == nil {
+				t.Errorf("Expected an error for %s", encryptedPassword)
+			}
+		}
+	})
+}
+
+// Computes the client proof like a client would and returns the client final message with the auth message and the salted password
+func testScramClientFinalMessage(t *testing.T, password string, gs2Header string, clientFirstMessageBare string, serverFirstMessage string) (string, string, []byte) {
+	salt, err := base64.StdEncoding.DecodeString(scramAttribute(serverFirstMessage, "s"))
+	testNoError(t, err)
+	iterations, err := strconv.Atoi(scramAttribute(serverFirstMessage, "i"))
+	testNoError(t, err)
+
+	clientFinalMessageWithoutProof := "c=" + base64.StdEncoding.EncodeToString([]byte(gs2Header)) + ",r=" + scramAttribute(serverFirstMessage, "r")
+	authMessage := clientFirstMessageBare + "," + serverFirstMessage + "," + clientFinalMessageWithoutProof
+
+	saltedPassword := pbkdf2.Key([]byte(password), salt, iterations, sha256.Size, sha256.New)
+	clientKey := hmacSha256Hash(saltedPassword, []byte("Client Key"))
+	clientSignature := hmacSha256Hash(sha256Hash(clientKey), []byte(authMessage))
+	clientProof := make([]byte, len(clientKey))
+	for i := range clientKey {
+		clientProof[i] = clientKey[i] ^ clientSignature[i]
+	}
+
+	return clientFinalMessageWithoutProof + ",p=" + base64.StdEncoding.EncodeToString(clientProof), authMessage, saltedPassword
+}
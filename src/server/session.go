@@ -0,0 +1,432 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/binary"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgproto3"
+	pgQuery "github.com/pganalyze/pg_query_go/v6"
+
+	"github.com/BemiHQ/BemiDB/src/common"
+)
+
+const (
+	BEMIDB_VAR_TRACE           = "bemidb.trace"
+	BEMIDB_VAR_QUERY_STATS     = "bemidb.query_stats"
+	BEMIDB_VAR_REPLAN_ON_BIND  = "bemidb.replan_on_bind"
+	BEMIDB_VAR_CATALOG         = "bemidb.catalog"
+	BEMIDB_VAR_METADATA_PROBES = "bemidb.metadata_probes"
+	BEMIDB_VAR_SAMPLE_TABLES   = "bemidb.sample_tables"
+
+	BEMIDB_VAR_JOIN_ORDER                 = "bemidb.join_order"
+	BEMIDB_VAR_PREFER_RANGE_JOINS         = "bemidb.prefer_range_joins"
+	BEMIDB_VAR_MERGE_JOIN_THRESHOLD       = "bemidb.merge_join_threshold"
+	BEMIDB_VAR_NESTED_LOOP_JOIN_THRESHOLD = "bemidb.nested_loop_join_threshold"
+
+	BEMIDB_VAR_MAX_PARALLEL_DOWNLOADS = "bemidb.max_parallel_downloads"
+	BEMIDB_VAR_HTTP_RETRIES           = "bemidb.http_retries"
+	BEMIDB_VAR_HTTP_RETRY_WAIT_MS     = "bemidb.http_retry_wait_ms"
+	BEMIDB_VAR_HTTP_TIMEOUT           = "bemidb.http_timeout"
+
+	BEMIDB_STARTUP_PARAM_SESSION_TOKEN = "bemidb.session_token"
+)
+
+const DUCKDB_SETTING_TIMEZONE = "TimeZone" // SET timezone = 'America/New_York'
+
+// DuckDB settings that can't be set per connection, queries of sessions with them run one at a time after other queries finish
+var DUCKDB_GLOBAL_SETTINGS = []string{"disabled_optimizers"}
+
+// Join planning session variables -> DuckDB settings applied to the session's queries
+var BEMIDB_JOIN_VARS_DUCKDB_SETTINGS = map[string]string{
+	BEMIDB_VAR_JOIN_ORDER:                 "disabled_optimizers",
+	BEMIDB_VAR_PREFER_RANGE_JOINS:         "prefer_range_joins",
+	BEMIDB_VAR_MERGE_JOIN_THRESHOLD:       "merge_join_threshold",
+	BEMIDB_VAR_NESTED_LOOP_JOIN_THRESHOLD: "nested_loop_join_threshold",
+}
+
+// S3 request session variables -> DuckDB httpfs settings applied to the session's queries
+var BEMIDB_HTTP_VARS_DUCKDB_SETTINGS = map[string]string{
+	BEMIDB_VAR_HTTP_RETRIES:       "http_retries",
+	BEMIDB_VAR_HTTP_RETRY_WAIT_MS: "http_retry_wait_ms",
+	BEMIDB_VAR_HTTP_TIMEOUT:       "http_timeout",
+}
+
+var lastSessionId int64 = 0
+
+// Sessions of connected clients by process ID sent in BackendKeyData, used to handle CancelRequest from other connections
+var (
+	activeSessions      = make(map[uint32]*Session)
+	activeSessionsMutex sync.Mutex
+)
+
+// Per-connection state changed with session-level SET statements
+type Session struct {
+	Id                 int64
+	QueryId            int64
+	Database           string                               // From the startup message
+	User               string                               // From the startup message
+	ApplicationName    string                               // From the startup message or SET application_name
+	ClientAddr         string                               // Client IP address, empty for Unix socket connections
+	SessionToken       string                               // From the startup message, restores prepared statements after reconnecting
+	TraceEnabled       bool                                 // SET bemidb.trace = on
+	QueryStatsEnabled  bool                                 // SET bemidb.query_stats = on
+	ReplanOnBind       bool                                 // SET bemidb.replan_on_bind = on
+	MetadataProbes     bool                                 // SET bemidb.metadata_probes = on
+	SampleTables       bool                                 // SET bemidb.sample_tables = on
+	Catalog            string                               // SET bemidb.catalog = candidate, empty for the active catalog of the server
+	DuckdbSettings     map[string]string                    // SET bemidb.join_order = off, SET bemidb.http_retries = 5, ... -> DuckDB setting name -> SQL value
+	StatementTimeout   *time.Duration                       // SET statement_timeout = '30s', nil uses the server default
+	TimeZone           *time.Location                       // SET timezone = 'America/New_York', nil for UTC
+	SearchPath         []string                             // SET search_path = analytics, public, nil for the default "$user", public
+	PreparedStatements map[string]*SessionPreparedStatement // PREPARE name AS ...
+	ExtendedStatements map[string]*PreparedStatement        // Parse messages by statement name, "" for the unnamed statement
+	Portals            map[string]*PreparedStatement        // Bind messages by portal name, "" for the unnamed portal
+	Cursors            map[string]*SessionCursor            // DECLARE name CURSOR FOR SELECT ...
+	TempTables         common.Set[string]                   // CREATE TEMP TABLE, stored in the session's DuckDB schema
+	PendingTempTables  common.Set[string]                   // Registered while remapping CREATE TEMP TABLE for the next statements, until it runs
+	Transaction        *SessionTransaction                  // BEGIN ... COMMIT/ROLLBACK, nil outside of a transaction block
+	SecretKey          uint32                               // Sent in BackendKeyData, required to cancel queries
+	Notices            []pgproto3.Message                   // Raised while remapping the current query, sent to the client before its results or error
+	ctx                context.Context
+	cancel             context.CancelFunc
+	queryCtx           context.Context
+	queryCancel        context.CancelFunc
+	queryMutex         sync.Mutex
+}
+
+// Created with PREPARE and run with EXECUTE until DEALLOCATE or DISCARD ALL
+type SessionPreparedStatement struct {
+	Name           string
+	Statement      *pgQuery.RawStmt // Remapped, with $n parameters
+	ParameterTypes []*pgQuery.TypeName
+}
+
+// Transaction block: the session's DuckDB statements run in a DuckDB transaction on a connection taken from the pool until COMMIT/ROLLBACK
+type SessionTransaction struct {
+	Conn                   *sql.Conn          // nil without a DuckDB client
+	Tx                     *sql.Tx            // nil without a DuckDB client
+	DuckdbSettings         map[string]string  // Of the session applied to the connection, reset before it goes back to the pool
+	Failed                 bool               // A statement failed, other statements are rejected until the end of the transaction block
+	CreatedTempTables      common.Set[string] // Forgotten on ROLLBACK
+	OnCommitDropTempTables common.Set[string] // CREATE TEMP TABLE ... ON COMMIT DROP
+	Savepoints             []TransactionSavepoint
+	ChangeCount            int // Statements that may have changed temp tables, they can't be rolled back to a savepoint
+}
+
+// Created with DECLARE and read with FETCH / MOVE until CLOSE, the end of the transaction block, or the end of the session WITH HOLD
+type SessionCursor struct {
+	Name        string
+	Rows        *sql.Rows // Suspended DuckDB result set, read forward only
+	Cols        []*sql.ColumnType
+	Hold        bool                // WITH HOLD, kept open after the transaction block
+	Transaction *SessionTransaction // The transaction block that declared the cursor, nil outside of a transaction block
+	Execution   *QueryExecution     // Meters the rows on a pooled connection and returns it to the pool after they are closed, nil in the transaction block
+}
+
+// SAVEPOINT name, emulated since DuckDB doesn't support savepoints
+type TransactionSavepoint struct {
+	Name        string
+	ChangeCount int // Of the transaction when the savepoint was created
+}
+
+func NewSession() *Session {
+	ctx, cancel := context.WithCancel(context.Background())
+	queryCtx, queryCancel := context.WithCancel(ctx)
+
+	secretKey := make([]byte, 4)
+	rand.Read(secretKey) // Never returns an error
+
+	return &Session{
+		Id:                 atomic.AddInt64(&lastSessionId, 1),
+		PreparedStatements: make(map[string]*SessionPreparedStatement),
+		ExtendedStatements: make(map[string]*PreparedStatement),
+		Portals:            make(map[string]*PreparedStatement),
+		Cursors:            make(map[string]*SessionCursor),
+		TempTables:         common.NewSet[string](),
+		PendingTempTables:  common.NewSet[string](),
+		DuckdbSettings:     make(map[string]string),
+		SecretKey:          binary.BigEndian.Uint32(secretKey),
+		ctx:                ctx,
+		cancel:             cancel,
+		queryCtx:           queryCtx,
+		queryCancel:        queryCancel,
+	}
+}
+
+// WARNING: unrecognized configuration parameter "x" is ignored -> sent to the client instead of only being logged
+func (session *Session) AddNotice(severity string, code string, message string) {
+	session.Notices = append(session.Notices, &pgproto3.NoticeResponse{
+		Severity:            severity,
+		SeverityUnlocalized: severity,
+		Code:                code,
+		Message:             message,
+	})
+}
+
+// Returns and clears the notices raised since the last call
+func (session *Session) TakeNotices() []pgproto3.Message {
+	notices := session.Notices
+	session.Notices = nil
+	return notices
+}
+
+// Canceled when the connection is closed or the client sends CancelRequest to stop its running DuckDB queries
+func (session *Session) Context() context.Context {
+	session.queryMutex.Lock()
+	defer session.queryMutex.Unlock()
+	return session.queryCtx
+}
+
+// Canceled only when the connection is closed, e.g. for the session's transaction
+func (session *Session) ConnectionContext() context.Context {
+	return session.ctx
+}
+
+func (session *Session) Cancel() {
+	session.Unregister()
+	session.cancel()
+}
+
+func (session *Session) ProcessId() uint32 {
+	return uint32(session.Id)
+}
+
+// Makes the session cancelable by CancelRequest with its process ID and secret key
+func (session *Session) Register() {
+	activeSessionsMutex.Lock()
+	defer activeSessionsMutex.Unlock()
+	activeSessions[session.ProcessId()] = session
+}
+
+func (session *Session) Unregister() {
+	activeSessionsMutex.Lock()
+	defer activeSessionsMutex.Unlock()
+	if activeSessions[session.ProcessId()] == session {
+		delete(activeSessions, session.ProcessId())
+	}
+}
+
+// Cancels the running query and starts a new context for the next queries
+func (session *Session) CancelQuery() {
+	session.queryMutex.Lock()
+	defer session.queryMutex.Unlock()
+	session.queryCancel()
+	session.queryCtx, session.queryCancel = context.WithCancel(session.ctx)
+}
+
+// Returns false if there is no session with the process ID or the secret key doesn't match
+func CancelSessionQuery(processId uint32, secretKey uint32) bool {
+	activeSessionsMutex.Lock()
+	session, ok := activeSessions[processId]
+	activeSessionsMutex.Unlock()
+
+	if !ok {
+		return false
+	}
+
+	// Compared in constant time to not leak the secret key through the response timing
+	expectedSecretKey := binary.BigEndian.AppendUint32(nil, session.SecretKey)
+	if subtle.ConstantTimeCompare(expectedSecretKey, binary.BigEndian.AppendUint32(nil, secretKey)) != 1 {
+		return false
+	}
+	session.CancelQuery()
+	return true
+}
+
+// Parse replaces the unnamed statement, a named statement is kept until Close, DEALLOCATE, or DISCARD ALL
+func (session *Session) AddExtendedStatement(preparedStatement *PreparedStatement) error {
+	if session.HasPreparedStatement(preparedStatement.Name) {
+		return &PgError{
+			Code:    PG_ERROR_CODE_DUPLICATE_PREPARED_STATEMENT,
+			Message: "prepared statement \"" + preparedStatement.Name + "\" already exists",
+		}
+	}
+	session.CloseExtendedStatement(preparedStatement.Name)
+	session.ExtendedStatements[preparedStatement.Name] = preparedStatement
+	return nil
+}
+
+// PREPARE and the Parse message share the statement names, the unnamed statement is replaced by each Parse message
+func (session *Session) HasPreparedStatement(name string) bool {
+	if name == "" {
+		return false
+	}
+	_, isExtended := session.ExtendedStatements[name]
+	_, isPrepared := session.PreparedStatements[name]
+	return isExtended || isPrepared
+}
+
+func (session *Session) ExtendedStatement(name string) (*PreparedStatement, error) {
+	preparedStatement, ok := session.ExtendedStatements[name]
+	if !ok {
+		return nil, &PgError{
+			Code:    PG_ERROR_CODE_INVALID_SQL_STATEMENT_NAME,
+			Message: "prepared statement \"" + name + "\" does not exist",
+		}
+	}
+	return preparedStatement, nil
+}
+
+// Closes the portals created from the statement too, returns false if there is no statement with the name
+func (session *Session) CloseExtendedStatement(name string) bool {
+	preparedStatement, ok := session.ExtendedStatements[name]
+	if !ok {
+		return false
+	}
+
+	for portalName, portal := range session.Portals {
+		if portal.Name == name {
+			session.ClosePortal(portalName)
+		}
+	}
+	if preparedStatement.Statement != nil {
+		preparedStatement.Statement.Close()
+	}
+	delete(session.ExtendedStatements, name)
+	return true
+}
+
+func (session *Session) CloseExtendedStatements() {
+	for name := range session.ExtendedStatements {
+		session.CloseExtendedStatement(name)
+	}
+}
+
+// Bind replaces the unnamed portal, a named portal is kept until Close or Sync
+func (session *Session) AddPortal(portal *PreparedStatement) error {
+	if _, ok := session.Portals[portal.Portal]; ok && portal.Portal != "" {
+		return &PgError{
+			Code:    PG_ERROR_CODE_DUPLICATE_CURSOR,
+			Message: "portal \"" + portal.Portal + "\" already exists",
+		}
+	}
+	session.ClosePortal(portal.Portal)
+	session.Portals[portal.Portal] = portal
+	return nil
+}
+
+func (session *Session) Portal(name string) (*PreparedStatement, error) {
+	portal, ok := session.Portals[name]
+	if !ok {
+		return nil, &PgError{
+			Code:    PG_ERROR_CODE_INVALID_CURSOR_NAME,
+			Message: "portal \"" + name + "\" does not exist",
+		}
+	}
+	return portal, nil
+}
+
+func (session *Session) ClosePortal(name string) {
+	portal, ok := session.Portals[name]
+	if !ok {
+		return
+	}
+
+	portal.CloseRows()
+	if portal.Replanned {
+		portal.Statement.Close()
+	}
+	portal.Suspended = false
+	delete(session.Portals, name)
+}
+
+// Sync ends the implicit transaction, only suspended portals can be resumed after it
+func (session *Session) CloseCompletedPortals() {
+	for name, portal := range session.Portals {
+		if !portal.Suspended {
+			session.ClosePortal(name)
+		}
+	}
+}
+
+func (session *Session) ClosePortals() {
+	for name := range session.Portals {
+		session.ClosePortal(name)
+	}
+}
+
+// user=name database=name application_name=psql session=1, attributes object storage reads in logs
+func (session *Session) Labels() string {
+	return "user=" + strconv.Quote(session.User) +
+		" database=" + strconv.Quote(session.Database) +
+		" application_name=" + strconv.Quote(session.ApplicationName) +
+		" session=" + common.Int64ToString(session.Id)
+}
+
+// Notices of the previous query were already sent with its results or error
+func (session *Session) NextQueryId() int64 {
+	session.Notices = nil
+	return atomic.AddInt64(&session.QueryId, 1) // Read by the connection log of other sessions
+}
+
+// Logs regardless of the global log level if tracing is enabled for the session
+func (session *Session) LogTrace(config *common.CommonConfig, message ...interface{}) {
+	if session.TraceEnabled {
+		traceConfig := *config
+		traceConfig.LogLevel = common.LOG_LEVEL_TRACE
+		config = &traceConfig
+		message = append([]interface{}{"[session " + common.Int64ToString(session.Id) + " query " + common.Int64ToString(session.QueryId) + "]"}, message...)
+	}
+	common.LogTrace(config, message...)
+}
+
+func (session *Session) AddCursor(cursor *SessionCursor) error {
+	if _, ok := session.Cursors[cursor.Name]; ok {
+		cursor.close()
+		return &PgError{
+			Code:    PG_ERROR_CODE_DUPLICATE_CURSOR,
+			Message: "cursor \"" + cursor.Name + "\" already exists",
+		}
+	}
+	session.Cursors[cursor.Name] = cursor
+	return nil
+}
+
+func (session *Session) Cursor(name string) (*SessionCursor, error) {
+	cursor, ok := session.Cursors[name]
+	if !ok {
+		return nil, &PgError{
+			Code:    PG_ERROR_CODE_INVALID_CURSOR_NAME,
+			Message: "cursor \"" + name + "\" does not exist",
+		}
+	}
+	return cursor, nil
+}
+
+func (session *Session) CloseCursor(name string) {
+	cursor, ok := session.Cursors[name]
+	if !ok {
+		return
+	}
+	cursor.close()
+	delete(session.Cursors, name)
+}
+
+func (session *Session) CloseCursors() {
+	for name := range session.Cursors {
+		session.CloseCursor(name)
+	}
+}
+
+func (cursor *SessionCursor) close() {
+	cursor.Rows.Close()
+	if cursor.Execution != nil {
+		cursor.Execution.Close()
+	}
+}
+
+// Closes the cursors of the transaction block before it ends, cursors WITH HOLD are kept only if it commits
+func (session *Session) CloseTransactionCursors(transaction *SessionTransaction, commit bool) {
+	for name, cursor := range session.Cursors {
+		if cursor.Transaction == transaction && (!cursor.Hold || !commit) {
+			session.CloseCursor(name)
+		}
+	}
+}
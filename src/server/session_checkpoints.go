@@ -0,0 +1,94 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgproto3"
+)
+
+// Prepared statement definitions of a disconnected session
+type SessionCheckpoint struct {
+	User               string                               // Restored only for the same user
+	ExtendedStatements []*pgproto3.Parse                    // Named statements created with Parse messages
+	PreparedStatements map[string]*SessionPreparedStatement // PREPARE name AS ...
+	SavedAt            time.Time
+}
+
+// Keeps prepared statements of disconnected sessions by a client-provided session token, so that a client reconnecting
+// after a network blip or a load balancer failover can use its named statements without preparing them again
+type SessionCheckpoints struct {
+	mutex       sync.Mutex
+	config      *Config
+	checkpoints map[string]SessionCheckpoint
+}
+
+func NewSessionCheckpoints(config *Config) *SessionCheckpoints {
+	return &SessionCheckpoints{config: config, checkpoints: make(map[string]SessionCheckpoint)}
+}
+
+func (checkpoints *SessionCheckpoints) Enabled() bool {
+	return checkpoints.config.SessionCheckpointTtlSeconds > 0
+}
+
+func (checkpoints *SessionCheckpoints) Save(session *Session) {
+	if !checkpoints.Enabled() || session.SessionToken == "" {
+		return
+	}
+
+	checkpoint := SessionCheckpoint{
+		User:               session.User,
+		PreparedStatements: make(map[string]*SessionPreparedStatement),
+		SavedAt:            time.Now(),
+	}
+	for name, preparedStatement := range session.ExtendedStatements {
+		if name == "" {
+			continue // The unnamed statement is replaced by the next Parse anyway
+		}
+		checkpoint.ExtendedStatements = append(checkpoint.ExtendedStatements, &pgproto3.Parse{
+			Name:          name,
+			Query:         preparedStatement.OriginalQuery,
+			ParameterOIDs: preparedStatement.ParameterOIDs,
+		})
+	}
+	for name, preparedStatement := range session.PreparedStatements {
+		checkpoint.PreparedStatements[name] = preparedStatement
+	}
+
+	checkpoints.mutex.Lock()
+	defer checkpoints.mutex.Unlock()
+
+	checkpoints.deleteExpired()
+	if len(checkpoint.ExtendedStatements) == 0 && len(checkpoint.PreparedStatements) == 0 {
+		delete(checkpoints.checkpoints, session.SessionToken)
+		return
+	}
+	checkpoints.checkpoints[session.SessionToken] = checkpoint
+}
+
+// Returns and removes the checkpoint saved with the session token, a checkpoint can be restored only once
+func (checkpoints *SessionCheckpoints) Take(session *Session) (SessionCheckpoint, bool) {
+	if !checkpoints.Enabled() || session.SessionToken == "" {
+		return SessionCheckpoint{}, false
+	}
+
+	checkpoints.mutex.Lock()
+	defer checkpoints.mutex.Unlock()
+
+	checkpoints.deleteExpired()
+	checkpoint, ok := checkpoints.checkpoints[session.SessionToken]
+	if !ok || checkpoint.User != session.User {
+		return SessionCheckpoint{}, false
+	}
+	delete(checkpoints.checkpoints, session.SessionToken)
+	return checkpoint, true
+}
+
+func (checkpoints *SessionCheckpoints) deleteExpired() {
+	ttl := time.Duration(checkpoints.config.SessionCheckpointTtlSeconds) * time.Second
+	for sessionToken, checkpoint := range checkpoints.checkpoints {
+		if time.Since(checkpoint.SavedAt) > ttl {
+			delete(checkpoints.checkpoints, sessionToken)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/BemiHQ/BemiDB/src/common"
+)
+
+type TrackedTableStats struct {
+	LiveTupleCount int64
+	LastAnalyzedAt *time.Time // nilable
+	AnalyzeCount   int64
+	LastVacuumedAt *time.Time // nilable
+	VacuumCount    int64
+}
+
+// Keeps track of ANALYZE and VACUUM runs on Iceberg tables to expose them in pg_stat_user_tables
+type StatsTracker struct {
+	mutex sync.Mutex
+	stats map[common.IcebergSchemaTable]TrackedTableStats
+}
+
+func NewStatsTracker() *StatsTracker {
+	return &StatsTracker{stats: make(map[common.IcebergSchemaTable]TrackedTableStats)}
+}
+
+func (tracker *StatsTracker) TrackAnalyze(icebergSchemaTable common.IcebergSchemaTable, liveTupleCount int64) {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+
+	now := time.Now()
+	stats := tracker.stats[icebergSchemaTable]
+	stats.LiveTupleCount = liveTupleCount
+	stats.LastAnalyzedAt = &now
+	stats.AnalyzeCount++
+	tracker.stats[icebergSchemaTable] = stats
+}
+
+func (tracker *StatsTracker) TrackVacuum(icebergSchemaTable common.IcebergSchemaTable) {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+
+	now := time.Now()
+	stats := tracker.stats[icebergSchemaTable]
+	stats.LastVacuumedAt = &now
+	stats.VacuumCount++
+	tracker.stats[icebergSchemaTable] = stats
+}
+
+// Returns false if the table hasn't been analyzed or vacuumed yet
+func (tracker *StatsTracker) Stats(icebergSchemaTable common.IcebergSchemaTable) (TrackedTableStats, bool) {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+
+	stats, ok := tracker.stats[icebergSchemaTable]
+	return stats, ok
+}
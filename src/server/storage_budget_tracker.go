@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/BemiHQ/BemiDB/src/common"
+)
+
+// Tracks bytes read from object storage per user and UTC day to warn users over the soft budget and reject queries over the hard budget.
+// Usage is kept in memory and starts from zero after a restart. Without BEMIDB_USER and additional users, any user name can
+// connect without a password, so all sessions share one budget.
+type StorageBudgetTracker struct {
+	mutex       sync.Mutex
+	config      *Config
+	day         string
+	bytesByUser map[string]int64
+}
+
+func NewStorageBudgetTracker(config *Config) *StorageBudgetTracker {
+	return &StorageBudgetTracker{config: config, bytesByUser: make(map[string]int64)}
+}
+
+func (tracker *StorageBudgetTracker) Enabled() bool {
+	return tracker.config.StorageSoftBudgetBytes > 0 || tracker.config.StorageHardBudgetBytes > 0
+}
+
+// Returns an error if the user has already reached the hard budget today
+func (tracker *StorageBudgetTracker) Check(user string) error {
+	if tracker.config.StorageHardBudgetBytes == 0 {
+		return nil
+	}
+
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+
+	tracker.resetOnNewDay()
+	budgetUser := tracker.budgetUser(user)
+	usedBytes := tracker.bytesByUser[budgetUser]
+	if usedBytes < tracker.config.StorageHardBudgetBytes {
+		return nil
+	}
+
+	message := fmt.Sprintf("daily storage budget exceeded: read %d of %d bytes", usedBytes, tracker.config.StorageHardBudgetBytes)
+	if budgetUser != "" {
+		message = fmt.Sprintf("daily storage budget exceeded for user \"%s\": read %d of %d bytes", budgetUser, usedBytes, tracker.config.StorageHardBudgetBytes)
+	}
+	return &PgError{
+		Code:    PG_ERROR_CODE_CONFIGURATION_LIMIT_EXCEEDED,
+		Message: message,
+		Hint:    "The budget resets at midnight UTC.",
+	}
+}
+
+// Adds the bytes read by a query and returns a warning if the user is over the soft budget today
+func (tracker *StorageBudgetTracker) Add(user string, bytes int64) string {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+
+	tracker.resetOnNewDay()
+	budgetUser := tracker.budgetUser(user)
+	tracker.bytesByUser[budgetUser] += bytes
+	usedBytes := tracker.bytesByUser[budgetUser]
+
+	if tracker.config.StorageSoftBudgetBytes == 0 || usedBytes < tracker.config.StorageSoftBudgetBytes {
+		return ""
+	}
+	if budgetUser == "" {
+		return fmt.Sprintf("queries read %d bytes from storage today, over the soft budget of %d bytes", usedBytes, tracker.config.StorageSoftBudgetBytes)
+	}
+	return fmt.Sprintf("user \"%s\" read %d bytes from storage today, over the soft budget of %d bytes", budgetUser, usedBytes, tracker.config.StorageSoftBudgetBytes)
+}
+
+// The authenticated user, the system user shares the budget of BEMIDB_USER since it connects with the same password
+func (tracker *StorageBudgetTracker) budgetUser(user string) string {
+	if tracker.config.User == "" && len(tracker.config.Users) == 0 {
+		return ""
+	}
+	if user == SYSTEM_AUTH_USER {
+		return tracker.config.User
+	}
+	return user
+}
+
+func (tracker *StorageBudgetTracker) resetOnNewDay() {
+	day := time.Now().UTC().Format(time.DateOnly)
+	if day != tracker.day {
+		if tracker.day != "" {
+			common.LogDebug(tracker.config.CommonConfig, "Resetting storage budgets for", day)
+		}
+		tracker.day = day
+		clear(tracker.bytesByUser)
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"sync"
+
+	"github.com/BemiHQ/BemiDB/src/common"
+)
+
+// Reads the row counts of Iceberg tables from the last snapshot summary of their metadata files, without reading Parquet files.
+// A metadata file doesn't change after it's written, so the row counts are cached by its path.
+type TableRowCounts struct {
+	mutex        sync.Mutex
+	config       *Config
+	duckdbClient *common.DuckdbClient
+	rowCounts    map[string]int64 // By metadata file path
+}
+
+func NewTableRowCounts(config *Config, duckdbClient *common.DuckdbClient) *TableRowCounts {
+	return &TableRowCounts{
+		config:       config,
+		duckdbClient: duckdbClient,
+		rowCounts:    make(map[string]int64),
+	}
+}
+
+func (tableRowCounts *TableRowCounts) RowCount(metadataFileS3Path string) (int64, error) {
+	tableRowCounts.mutex.Lock()
+	rowCount, ok := tableRowCounts.rowCounts[metadataFileS3Path]
+	tableRowCounts.mutex.Unlock()
+	if ok {
+		return rowCount, nil
+	}
+
+	row := tableRowCounts.duckdbClient.QueryRowContext(
+		context.Background(),
+		"SELECT CAST(json_extract_string(content, '$.snapshots[#-1].summary.\"total-records\"') AS BIGINT) FROM read_text('$path')",
+		map[string]string{"path": metadataFileS3Path},
+	)
+	err := row.Scan(&rowCount)
+	if err != nil {
+		return 0, err
+	}
+
+	tableRowCounts.mutex.Lock()
+	defer tableRowCounts.mutex.Unlock()
+	tableRowCounts.rowCounts[metadataFileS3Path] = rowCount
+	return rowCount, nil
+}
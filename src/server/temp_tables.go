@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	pgQuery "github.com/pganalyze/pg_query_go/v6"
+
+	"github.com/BemiHQ/BemiDB/src/common"
+)
+
+const (
+	TEMP_TABLES_DUCKDB_SCHEMA_PREFIX = "bemidb_temp_"
+
+	RELPERSISTENCE_PERMANENT = "p"
+	RELPERSISTENCE_TEMP      = "t"
+)
+
+// Keeps tables created with CREATE TEMP TABLE in a DuckDB schema of the session, since DuckDB's own temp tables are bound
+// to a single connection and the session's queries run on pooled connections. The schema is dropped on disconnect
+type TempTables struct {
+	config       *Config
+	duckdbClient *common.DuckdbClient // nilable
+}
+
+func NewTempTables(config *Config, duckdbClient *common.DuckdbClient) *TempTables {
+	return &TempTables{config: config, duckdbClient: duckdbClient}
+}
+
+// bemidb_temp_1 for the session with process ID 1
+func (tempTables *TempTables) DuckdbSchema(session *Session) string {
+	return TEMP_TABLES_DUCKDB_SCHEMA_PREFIX + common.Int64ToString(session.Id)
+}
+
+// table / pg_temp.table -> bemidb_temp_1.table, returns false if the session didn't create the temp table
+func (tempTables *TempTables) RemapTable(session *Session, rangeVar *pgQuery.RangeVar) bool {
+	if !tempTables.IsTempTable(session, rangeVar) {
+		return false
+	}
+	rangeVar.Catalogname = ""
+	rangeVar.Schemaname = tempTables.DuckdbSchema(session)
+	return true
+}
+
+// Temp tables take precedence over other tables with the same name like in Postgres with the default search_path
+func (tempTables *TempTables) IsTempTable(session *Session, rangeVar *pgQuery.RangeVar) bool {
+	if rangeVar.Schemaname != "" && rangeVar.Schemaname != PG_SCHEMA_PG_TEMP {
+		return false
+	}
+	return session.TempTables.Contains(rangeVar.Relname)
+}
+
+// CREATE TEMP TABLE table ... -> CREATE TABLE bemidb_temp_1.table ...
+func (tempTables *TempTables) Create(session *Session, rangeVar *pgQuery.RangeVar, onCommit pgQuery.OnCommitAction) error {
+	if tempTables.duckdbClient == nil {
+		return &PgError{Code: PG_ERROR_CODE_FEATURE_NOT_SUPPORTED, Message: "temp tables are not supported"}
+	}
+
+	_, err := tempTables.execContext(session, session.Context(), "CREATE SCHEMA IF NOT EXISTS "+tempTables.DuckdbSchema(session))
+	if err != nil {
+		return err
+	}
+
+	tableName := rangeVar.Relname
+	rangeVar.Catalogname = ""
+	rangeVar.Schemaname = tempTables.DuckdbSchema(session)
+	rangeVar.Relpersistence = RELPERSISTENCE_PERMANENT
+
+	// Registered before the statement runs so that the next statements of the query can use the table
+	if !session.TempTables.Contains(tableName) {
+		session.TempTables.Add(tableName)
+		session.PendingTempTables.Add(tableName)
+	}
+	return nil
+}
+
+// Called after CREATE TEMP TABLE table ... ran, a table created in a transaction block is forgotten on ROLLBACK
+func (tempTables *TempTables) TrackCreated(session *Session, tableName string, onCommit pgQuery.OnCommitAction) {
+	created := !session.TempTables.Contains(tableName) || session.PendingTempTables.Contains(tableName)
+	session.TempTables.Add(tableName)
+	session.PendingTempTables.Remove(tableName)
+
+	if created && session.Transaction != nil {
+		session.Transaction.CreatedTempTables.Add(tableName)
+	}
+	if onCommit == pgQuery.OnCommitAction_ONCOMMIT_DROP && session.Transaction != nil {
+		session.Transaction.OnCommitDropTempTables.Add(tableName)
+	}
+}
+
+// Unregisters the temp tables whose CREATE TEMP TABLE didn't run, e.g. because it or an earlier statement of the query failed
+func (tempTables *TempTables) RemoveUncreated(session *Session) {
+	for _, tableName := range session.PendingTempTables.Values() {
+		session.TempTables.Remove(tableName)
+	}
+	session.PendingTempTables.Reset()
+}
+
+func (tempTables *TempTables) Drop(session *Session, tableNames []string) error {
+	for _, tableName := range tableNames {
+		_, err := tempTables.execContext(session, session.Context(), "DROP TABLE IF EXISTS "+tempTables.DuckdbSchema(session)+`."`+strings.ReplaceAll(tableName, `"`, `""`)+`"`)
+		if err != nil {
+			return err
+		}
+		session.TempTables.Remove(tableName)
+	}
+	return nil
+}
+
+// Column names of the session's temp tables, not of temp tables with the same names of other sessions
+func (tempTables *TempTables) ColumnNames(session *Session, tableNames []string) ([]string, error) {
+	quotedTableNames := make([]string, len(tableNames))
+	for i, tableName := range tableNames {
+		quotedTableNames[i] = quoteSqlString(tableName)
+	}
+	query := "SELECT column_name FROM duckdb_columns() WHERE schema_name = " + quoteSqlString(tempTables.DuckdbSchema(session)) + " AND table_name IN (" + strings.Join(quotedTableNames, ", ") + ")"
+
+	var rows *sql.Rows
+	var err error
+	if session.Transaction != nil && session.Transaction.Tx != nil {
+		rows, err = session.Transaction.Tx.QueryContext(session.Context(), query)
+	} else {
+		rows, err = tempTables.duckdbClient.QueryContext(session.Context(), query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var columnNames []string
+	for rows.Next() {
+		var columnName string
+		err := rows.Scan(&columnName)
+		if err != nil {
+			return nil, err
+		}
+		columnNames = append(columnNames, columnName)
+	}
+	return columnNames, rows.Err()
+}
+
+// DISCARD ALL / DISCARD TEMP / disconnect
+func (tempTables *TempTables) DropAll(session *Session) {
+	if session.TempTables.IsEmpty() {
+		return
+	}
+
+	_, err := tempTables.execContext(session, context.Background(), "DROP SCHEMA IF EXISTS "+tempTables.DuckdbSchema(session)+" CASCADE")
+	if err != nil {
+		common.LogError(tempTables.config.CommonConfig, "Couldn't drop temp tables:", err)
+		return
+	}
+	session.TempTables.Reset()
+}
+
+// Changes in a transaction block must be visible to its statements, a schema created by another connection isn't
+func (tempTables *TempTables) execContext(session *Session, ctx context.Context, query string) (sql.Result, error) {
+	if session.Transaction != nil && session.Transaction.Tx != nil {
+		return session.Transaction.Tx.ExecContext(ctx, query)
+	}
+	return tempTables.duckdbClient.ExecContext(ctx, query)
+}
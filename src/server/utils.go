@@ -1,17 +1,28 @@
 package main
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/hmac"
 	"crypto/rand"
 	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/base64"
 	"fmt"
+	"math/big"
+	"net"
+	"strings"
+	"time"
 	"unicode"
 
 	"golang.org/x/crypto/pbkdf2"
 )
 
-func StringToScramSha256(password string) string {
+// The salt is random unless a salt secret is set. With the secret, the salt is derived from it and the user, so servers sharing
+// the secret expose the same verifier in pg_shadow (e.g., for PgBouncer's auth_query) and the verifier changes only when the password changes
+func StringToScramSha256(user string, password string, saltSecret string) string {
 	saltLength := 16
 	digestLength := 32
 	iterations := 4096
@@ -19,9 +30,13 @@ func StringToScramSha256(password string) string {
 	serverKey := []byte("Server Key")
 
 	salt := make([]byte, saltLength)
-	_, err := rand.Read(salt)
-	if err != nil {
-		return ""
+	if saltSecret != "" {
+		salt = hmacSha256Hash([]byte(saltSecret), []byte(user))[:saltLength]
+	} else {
+		_, err := rand.Read(salt)
+		if err != nil {
+			return ""
+		}
 	}
 
 	digestKey := pbkdf2.Key([]byte(password), salt, iterations, digestLength, sha256.New)
@@ -38,6 +53,40 @@ func StringToScramSha256(password string) string {
 	)
 }
 
+// Generates an in-memory certificate valid for localhost and the given host, which clients can't verify (sslmode=require only)
+func GenerateSelfSignedCertificate(host string) (tls.Certificate, error) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	template := x509.Certificate{
+		SerialNumber: serialNumber,
+		Subject:      pkix.Name{CommonName: "BemiDB"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().AddDate(1, 0, 0),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+	if ip := net.ParseIP(host); ip != nil && !ip.IsUnspecified() {
+		template.IPAddresses = append(template.IPAddresses, ip)
+	}
+
+	certificateDer, err := x509.CreateCertificate(rand.Reader, &template, &template, &privateKey.PublicKey, privateKey)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	return tls.Certificate{Certificate: [][]byte{certificateDer}, PrivateKey: privateKey}, nil
+}
+
 func StringContainsUpper(str string) bool {
 	for _, char := range str {
 		if unicode.IsUpper(char) {
@@ -47,6 +96,11 @@ func StringContainsUpper(str string) bool {
 	return false
 }
 
+// Single-quoted SQL string literal with escaped quotes
+func quoteSqlString(str string) string {
+	return "'" + strings.ReplaceAll(str, "'", "''") + "'"
+}
+
 func hmacSha256Hash(key []byte, message []byte) []byte {
 	hash := hmac.New(sha256.New, key)
 	hash.Write(message)
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStringToScramSha256(t *testing.T) {
+	t.Run("Returns a verifier with a random salt without a salt secret", func(t *testing.T) {
+		verifier := StringToScramSha256("user", "password", "")
+		otherVerifier := StringToScramSha256("user", "password", "")
+
+		if !strings.HasPrefix(verifier, "SCRAM-SHA-256$4096:") {
+			t.Errorf("Expected a SCRAM-SHA-256 verifier, got %s", verifier)
+		}
+		if verifier == otherVerifier {
+			t.Errorf("Expected verifiers with different salts, got %s twice", verifier)
+		}
+		if _, err := NewScramAuthenticator(verifier); err != nil {
+			t.Errorf("Expected a valid verifier, got %v", err)
+		}
+	})
+
+	t.Run("Returns the same verifier with the same salt secret", func(t *testing.T) {
+		verifier := StringToScramSha256("user", "password", "secret")
+
+		if verifier != StringToScramSha256("user", "password", "secret") {
+			t.Errorf("Expected the same verifier, got %s and %s", verifier, StringToScramSha256("user", "password", "secret"))
+		}
+		if scramSalt(verifier) == scramSalt(StringToScramSha256("user", "password", "other secret")) {
+			t.Errorf("Expected a different salt with a different secret")
+		}
+		if scramSalt(verifier) == scramSalt(StringToScramSha256("other_user", "password", "secret")) {
+			t.Errorf("Expected a different salt for a different user")
+		}
+	})
+
+	t.Run("Keeps the salt and rotates the verifier when the password changes", func(t *testing.T) {
+		verifier := StringToScramSha256("user", "password", "secret")
+		rotatedVerifier := StringToScramSha256("user", "new password", "secret")
+
+		if verifier == rotatedVerifier {
+			t.Errorf("Expected the verifier to change with the password")
+		}
+		if scramSalt(verifier) != scramSalt(rotatedVerifier) {
+			t.Errorf("Expected the same salt, got %s and %s", scramSalt(verifier), scramSalt(rotatedVerifier))
+		}
+	})
+}
+
+// SCRAM-SHA-256$<iterations>:<salt>$<StoredKey>:<ServerKey> -> <salt>
+func scramSalt(verifier string) string {
+	return strings.Split(strings.Split(verifier, "$")[1], ":")[1]
+}
@@ -45,6 +45,9 @@ func RegisterFlags() {
 	flag.StringVar(&_config.CommonConfig.Aws.S3Bucket, "aws-s3-bucket", os.Getenv(common.ENV_AWS_S3_BUCKET), "AWS S3 bucket name")
 	flag.StringVar(&_config.CommonConfig.Aws.AccessKeyId, "aws-access-key-id", os.Getenv(common.ENV_AWS_ACCESS_KEY_ID), "AWS access key ID")
 	flag.StringVar(&_config.CommonConfig.Aws.SecretAccessKey, "aws-secret-access-key", os.Getenv(common.ENV_AWS_SECRET_ACCESS_KEY), "AWS secret access key")
+	flag.StringVar(&_config.CommonConfig.Aws.ServerSideEncryption, "aws-s3-server-side-encryption", os.Getenv(common.ENV_AWS_S3_SERVER_SIDE_ENCRYPTION), `Server-side encryption of written S3 objects: "`+common.AWS_S3_SSE_S3+`" (SSE-S3) or "`+common.AWS_S3_SSE_KMS+`" (SSE-KMS). Default: none`)
+	flag.StringVar(&_config.CommonConfig.Aws.KmsKeyId, "aws-s3-kms-key-id", os.Getenv(common.ENV_AWS_S3_KMS_KEY_ID), "KMS key ID or ARN for SSE-KMS")
+	common.RegisterAwsS3MaxUploadFlag(&_config.CommonConfig.Aws)
 	flag.BoolVar(&_config.CommonConfig.DisableAnonymousAnalytics, "disable-anonymous-analytics", os.Getenv(common.ENV_DISABLE_ANONYMOUS_ANALYTICS) == "true", "Disable anonymous analytics collection")
 
 	flag.StringVar(&_config.DestinationSchemaName, "destination-schema-name", os.Getenv(ENV_DESTINATION_SCHEMA_NAME), "Destination schema name to store the synced data")
@@ -84,6 +87,13 @@ func parseFlags() {
 	if _config.CommonConfig.Aws.AccessKeyId == "" && _config.CommonConfig.Aws.SecretAccessKey != "" {
 		panic("AWS access key ID is required")
 	}
+	if _config.CommonConfig.Aws.ServerSideEncryption != "" && _config.CommonConfig.Aws.ServerSideEncryption != common.AWS_S3_SSE_S3 && _config.CommonConfig.Aws.ServerSideEncryption != common.AWS_S3_SSE_KMS {
+		panic("AWS S3 server-side encryption must be \"" + common.AWS_S3_SSE_S3 + "\" or \"" + common.AWS_S3_SSE_KMS + "\"")
+	}
+	if (_config.CommonConfig.Aws.KmsKeyId != "") != (_config.CommonConfig.Aws.ServerSideEncryption == common.AWS_S3_SSE_KMS) {
+		panic("AWS S3 KMS key ID is required for and only used with \"" + common.AWS_S3_SSE_KMS + "\" server-side encryption")
+	}
+	common.ValidateAwsS3MaxUpload(_config.CommonConfig.Aws)
 
 	if _config.DestinationSchemaName == "" {
 		panic("Destination schema name is required")
@@ -0,0 +1,119 @@
+package clickhouse
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/BemiHQ/BemiDB/src/common"
+)
+
+const (
+	CLICKHOUSE_FORMAT_JSON_EACH_ROW = "JSONEachRow"
+)
+
+type Clickhouse struct {
+	Config     *Config
+	HttpClient *http.Client
+}
+
+func NewClickhouse(config *Config) *Clickhouse {
+	return &Clickhouse{
+		Config:     config,
+		HttpClient: &http.Client{Timeout: 2 * time.Hour},
+	}
+}
+
+func (clickhouse *Clickhouse) SchemaColumns(query string) ([]ClickhouseSchemaColumn, error) {
+	resp, err := clickhouse.execute("DESCRIBE TABLE (" + clickhouse.trimQuery(query) + ")")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var clickhouseSchemaColumns []ClickhouseSchemaColumn
+	decoder := json.NewDecoder(resp.Body)
+	for position := 1; ; position++ {
+		clickhouseSchemaColumn := NewClickhouseSchemaColumn(clickhouse.Config)
+		err := decoder.Decode(clickhouseSchemaColumn)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		clickhouseSchemaColumn.Position = position
+		clickhouseSchemaColumns = append(clickhouseSchemaColumns, *clickhouseSchemaColumn)
+	}
+
+	return clickhouseSchemaColumns, nil
+}
+
+func (clickhouse *Clickhouse) Load(query string, jsonQueueWriter *common.JsonQueueWriter) error {
+	resp, err := clickhouse.execute(clickhouse.trimQuery(query))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	rowCount := 0
+	decoder := json.NewDecoder(bufio.NewReader(resp.Body))
+	for {
+		var row map[string]interface{}
+		err := decoder.Decode(&row)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		err = jsonQueueWriter.Write(row)
+		if err != nil {
+			return err
+		}
+		rowCount++
+	}
+
+	common.LogInfo(clickhouse.Config.CommonConfig, "Loaded", rowCount, "rows from ClickHouse")
+	return nil
+}
+
+func (clickhouse *Clickhouse) execute(query string) (*http.Response, error) {
+	req, err := http.NewRequest("POST", clickhouse.Config.Url, strings.NewReader(query+" FORMAT "+CLICKHOUSE_FORMAT_JSON_EACH_ROW))
+	if err != nil {
+		return nil, err
+	}
+	q := req.URL.Query()                                  // Keeps the settings from the URL, e.g. ?database=analytics
+	q.Set("output_format_json_quote_64bit_integers", "0") // Return Int64/UInt64 as JSON numbers
+	q.Set("output_format_json_quote_decimals", "0")       // Return decimals as JSON numbers
+	q.Set("output_format_json_quote_denormals", "0")      // Return nan/inf as null
+	q.Set("date_time_output_format", "simple")            // YYYY-MM-DD hh:mm:ss
+	req.URL.RawQuery = q.Encode()
+	req.Header.Set("X-ClickHouse-User", clickhouse.Config.User)
+	if clickhouse.Config.Password != "" {
+		req.Header.Set("X-ClickHouse-Key", clickhouse.Config.Password)
+	}
+
+	common.LogDebug(clickhouse.Config.CommonConfig, "Sending query to ClickHouse:", query)
+	resp, err := clickhouse.HttpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, fmt.Errorf("clickhouse returned status %d: %s", resp.StatusCode, string(body))
+	}
+
+	return resp, nil
+}
+
+func (clickhouse *Clickhouse) trimQuery(query string) string {
+	return strings.TrimRight(strings.TrimSpace(query), ";")
+}
@@ -0,0 +1,108 @@
+package clickhouse
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/BemiHQ/BemiDB/src/common"
+)
+
+var DECIMAL_TYPE_REGEX = regexp.MustCompile(`^Decimal(\d*)\((\d+)(?:,\s*(\d+))?\)$`)
+
+type ClickhouseSchemaColumn struct {
+	ColumnName string `json:"name"`
+	Type       string `json:"type"`
+	Position   int
+	Config     *Config
+}
+
+func NewClickhouseSchemaColumn(config *Config) *ClickhouseSchemaColumn {
+	return &ClickhouseSchemaColumn{
+		Config: config,
+	}
+}
+
+func (clickhouseSchemaColumn *ClickhouseSchemaColumn) ToIcebergSchemaColumn() *common.IcebergSchemaColumn {
+	icebergSchemaColumn := &common.IcebergSchemaColumn{
+		Config:     clickhouseSchemaColumn.Config.CommonConfig,
+		ColumnName: clickhouseSchemaColumn.ColumnName,
+		Position:   clickhouseSchemaColumn.Position,
+		IsRequired: true,
+	}
+
+	columnType := clickhouseSchemaColumn.Type
+	for {
+		if unwrappedType, found := clickhouseSchemaColumn.unwrapType(columnType, "LowCardinality"); found {
+			columnType = unwrappedType
+		} else if unwrappedType, found := clickhouseSchemaColumn.unwrapType(columnType, "Nullable"); found {
+			columnType = unwrappedType
+			icebergSchemaColumn.IsRequired = false
+		} else if unwrappedType, found := clickhouseSchemaColumn.unwrapType(columnType, "Array"); found && !icebergSchemaColumn.IsList {
+			columnType = unwrappedType
+			icebergSchemaColumn.IsList = true
+			icebergSchemaColumn.IsRequired = false
+		} else {
+			break
+		}
+	}
+
+	switch {
+	case columnType == "Bool":
+		icebergSchemaColumn.ColumnType = common.IcebergColumnTypeBoolean
+	case columnType == "Int8", columnType == "Int16", columnType == "Int32", columnType == "UInt8", columnType == "UInt16":
+		icebergSchemaColumn.ColumnType = common.IcebergColumnTypeInteger
+	case columnType == "Int64", columnType == "UInt32", columnType == "UInt64":
+		icebergSchemaColumn.ColumnType = common.IcebergColumnTypeLong
+	case columnType == "Float32":
+		icebergSchemaColumn.ColumnType = common.IcebergColumnTypeFloat
+	case columnType == "Float64":
+		icebergSchemaColumn.ColumnType = common.IcebergColumnTypeDouble
+	case DECIMAL_TYPE_REGEX.MatchString(columnType):
+		icebergSchemaColumn.ColumnType = common.IcebergColumnTypeDecimal
+		icebergSchemaColumn.NumericPrecision, icebergSchemaColumn.NumericScale = clickhouseSchemaColumn.decimalPrecisionAndScale(columnType)
+	case columnType == "Date", columnType == "Date32":
+		icebergSchemaColumn.ColumnType = common.IcebergColumnTypeDate
+	case columnType == "DateTime", strings.HasPrefix(columnType, "DateTime("), strings.HasPrefix(columnType, "DateTime64("):
+		icebergSchemaColumn.ColumnType = common.IcebergColumnTypeTimestamp
+	case columnType == "String", columnType == "UUID", columnType == "IPv4", columnType == "IPv6",
+		strings.HasPrefix(columnType, "FixedString("), strings.HasPrefix(columnType, "Enum8("), strings.HasPrefix(columnType, "Enum16("):
+		icebergSchemaColumn.ColumnType = common.IcebergColumnTypeString
+	case strings.HasPrefix(columnType, "Map("), columnType == "JSON":
+		icebergSchemaColumn.ColumnType = common.IcebergColumnTypeString
+		icebergSchemaColumn.LogicalColumnType = common.IcebergLogicalColumnTypeJson
+	default:
+		panic("Unsupported ClickHouse type: " + clickhouseSchemaColumn.Type)
+	}
+
+	return icebergSchemaColumn
+}
+
+// Nullable(String) -> String
+func (clickhouseSchemaColumn *ClickhouseSchemaColumn) unwrapType(columnType string, wrapper string) (string, bool) {
+	if strings.HasPrefix(columnType, wrapper+"(") && strings.HasSuffix(columnType, ")") {
+		return strings.TrimSuffix(strings.TrimPrefix(columnType, wrapper+"("), ")"), true
+	}
+	return columnType, false
+}
+
+// Decimal(P, S) -> P, S
+// Decimal64(S) -> 18, S
+func (clickhouseSchemaColumn *ClickhouseSchemaColumn) decimalPrecisionAndScale(columnType string) (int, int) {
+	matches := DECIMAL_TYPE_REGEX.FindStringSubmatch(columnType)
+
+	switch matches[1] {
+	case "32":
+		return 9, common.StringToInt(matches[2])
+	case "64":
+		return 18, common.StringToInt(matches[2])
+	case "128":
+		return 38, common.StringToInt(matches[2])
+	case "256":
+		return 76, common.StringToInt(matches[2])
+	}
+
+	if matches[3] == "" {
+		return common.StringToInt(matches[2]), 0
+	}
+	return common.StringToInt(matches[2]), common.StringToInt(matches[3])
+}
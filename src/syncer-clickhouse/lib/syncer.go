@@ -0,0 +1,86 @@
+package clickhouse
+
+import (
+	"net/url"
+	"sort"
+
+	"github.com/BemiHQ/BemiDB/src/common"
+)
+
+const (
+	COMPRESSION_FACTOR = 1
+)
+
+type Syncer struct {
+	Config       *Config
+	Clickhouse   *Clickhouse
+	StorageS3    *common.StorageS3
+	DuckdbClient *common.DuckdbClient
+}
+
+func NewSyncer(config *Config, storageS3 *common.StorageS3, duckdbClient *common.DuckdbClient) *Syncer {
+	return &Syncer{
+		Config:       config,
+		Clickhouse:   NewClickhouse(config),
+		StorageS3:    storageS3,
+		DuckdbClient: duckdbClient,
+	}
+}
+
+func (syncer *Syncer) Sync() {
+	common.SendAnonymousAnalytics(syncer.Config.CommonConfig, "syncer-clickhouse-start", syncer.name())
+
+	tableNames := make([]string, 0, len(syncer.Config.QueryByTableName))
+	for tableName := range syncer.Config.QueryByTableName {
+		tableNames = append(tableNames, tableName)
+	}
+	sort.Strings(tableNames)
+
+	for _, tableName := range tableNames {
+		query := syncer.Config.QueryByTableName[tableName]
+
+		common.LogInfo(syncer.Config.CommonConfig, "Syncing table:", tableName+"...")
+		clickhouseSchemaColumns, err := syncer.Clickhouse.SchemaColumns(query)
+		common.PanicIfError(syncer.Config.CommonConfig, err)
+
+		cappedBuffer := common.NewCappedBuffer(syncer.Config.CommonConfig, common.DEFAULT_CAPPED_BUFFER_SIZE)
+		jsonQueueWriter := common.NewJsonQueueWriter(cappedBuffer)
+
+		// Copy from ClickHouse to cappedBuffer in a separate goroutine in parallel
+		go func() {
+			err := syncer.Clickhouse.Load(query, jsonQueueWriter)
+			common.PanicIfError(syncer.Config.CommonConfig, err)
+
+			common.LogInfo(syncer.Config.CommonConfig, "Finished exporting data from ClickHouse.")
+			jsonQueueWriter.Close()
+		}()
+
+		syncer.WriteToIceberg(tableName, clickhouseSchemaColumns, cappedBuffer)
+	}
+
+	common.SendAnonymousAnalytics(syncer.Config.CommonConfig, "syncer-clickhouse-finish", syncer.name())
+}
+
+func (syncer *Syncer) WriteToIceberg(tableName string, clickhouseSchemaColumns []ClickhouseSchemaColumn, cappedBuffer *common.CappedBuffer) {
+	icebergSchemaTable := common.IcebergSchemaTable{Schema: syncer.Config.DestinationSchemaName, Table: tableName}
+	icebergTable := common.NewIcebergTable(syncer.Config.CommonConfig, syncer.StorageS3, syncer.DuckdbClient, icebergSchemaTable)
+	icebergTable.ReplaceWith(func(syncingIcebergTable *common.IcebergTable) {
+		icebergSchemaColumns := make([]*common.IcebergSchemaColumn, len(clickhouseSchemaColumns))
+		for i, clickhouseSchemaColumn := range clickhouseSchemaColumns {
+			icebergSchemaColumns[i] = clickhouseSchemaColumn.ToIcebergSchemaColumn()
+		}
+
+		// Read from cappedBuffer and write to Iceberg
+		icebergTableWriter := common.NewIcebergTableWriter(syncer.Config.CommonConfig, syncer.StorageS3, syncer.DuckdbClient, syncingIcebergTable, icebergSchemaColumns, COMPRESSION_FACTOR)
+		icebergTableWriter.InsertFromJsonCappedBuffer(cappedBuffer)
+	})
+}
+
+func (syncer *Syncer) name() string {
+	url, err := url.Parse(syncer.Config.Url)
+	if err != nil {
+		return ""
+	}
+
+	return url.Hostname()
+}
@@ -0,0 +1,118 @@
+package connector
+
+import (
+	"flag"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/BemiHQ/BemiDB/src/common"
+)
+
+const (
+	ENV_DESTINATION_SCHEMA_NAME = "DESTINATION_SCHEMA_NAME"
+
+	ENV_CONNECTOR_NAME                = "SOURCE_CONNECTOR_NAME"
+	ENV_STREAMS                       = "SOURCE_CONNECTOR_STREAMS"
+	ENV_STREAMING                     = "SOURCE_CONNECTOR_STREAMING"
+	ENV_STREAM_FLUSH_INTERVAL_SECONDS = "SOURCE_CONNECTOR_STREAM_FLUSH_INTERVAL_SECONDS"
+
+	DEFAULT_STREAM_FLUSH_INTERVAL_SECONDS = 60
+)
+
+type Config struct {
+	CommonConfig          *common.CommonConfig
+	DestinationSchemaName string
+	ConnectorName         string
+	Streams               common.Set[string]
+	Streaming             bool // Continuously stream incremental streams instead of reading them once
+	StreamFlushInterval   time.Duration
+}
+
+type configParseValues struct {
+	Streams                    string
+	StreamFlushIntervalSeconds int
+}
+
+var _config Config
+var _configParseValues configParseValues
+
+func RegisterFlags() {
+	_config.CommonConfig = &common.CommonConfig{}
+
+	flag.StringVar(&_config.CommonConfig.LogLevel, "log-level", os.Getenv(common.ENV_LOG_LEVEL), `Log level: "ERROR", "WARN", "INFO", "DEBUG", "TRACE". Default: "`+common.DEFAULT_LOG_LEVEL+`"`)
+	flag.StringVar(&_config.CommonConfig.CatalogDatabaseUrl, "catalog-database-url", os.Getenv(common.ENV_CATALOG_DATABASE_URL), "Catalog database URL")
+	flag.StringVar(&_config.CommonConfig.Aws.Region, "aws-region", os.Getenv(common.ENV_AWS_REGION), "AWS region")
+	flag.StringVar(&_config.CommonConfig.Aws.S3Endpoint, "aws-s3-endpoint", os.Getenv(common.ENV_AWS_S3_ENDPOINT), "AWS S3 endpoint. Default: \""+common.DEFAULT_AWS_S3_ENDPOINT+`"`)
+	flag.StringVar(&_config.CommonConfig.Aws.S3Bucket, "aws-s3-bucket", os.Getenv(common.ENV_AWS_S3_BUCKET), "AWS S3 bucket name")
+	flag.StringVar(&_config.CommonConfig.Aws.AccessKeyId, "aws-access-key-id", os.Getenv(common.ENV_AWS_ACCESS_KEY_ID), "AWS access key ID")
+	flag.StringVar(&_config.CommonConfig.Aws.SecretAccessKey, "aws-secret-access-key", os.Getenv(common.ENV_AWS_SECRET_ACCESS_KEY), "AWS secret access key")
+	flag.StringVar(&_config.CommonConfig.Aws.ServerSideEncryption, "aws-s3-server-side-encryption", os.Getenv(common.ENV_AWS_S3_SERVER_SIDE_ENCRYPTION), `Server-side encryption of written S3 objects: "`+common.AWS_S3_SSE_S3+`" (SSE-S3) or "`+common.AWS_S3_SSE_KMS+`" (SSE-KMS). Default: none`)
+	flag.StringVar(&_config.CommonConfig.Aws.KmsKeyId, "aws-s3-kms-key-id", os.Getenv(common.ENV_AWS_S3_KMS_KEY_ID), "KMS key ID or ARN for SSE-KMS")
+	common.RegisterAwsS3MaxUploadFlag(&_config.CommonConfig.Aws)
+	flag.BoolVar(&_config.CommonConfig.DisableAnonymousAnalytics, "disable-anonymous-analytics", os.Getenv(common.ENV_DISABLE_ANONYMOUS_ANALYTICS) == "true", "Disable anonymous analytics collection")
+
+	flag.StringVar(&_config.DestinationSchemaName, "destination-schema-name", os.Getenv(ENV_DESTINATION_SCHEMA_NAME), "Destination schema name to store the synced data")
+	flag.StringVar(&_config.ConnectorName, "connector-name", os.Getenv(ENV_CONNECTOR_NAME), "Connector name. Loads a registered connector or the \"bemidb-connector-[NAME]\" plugin executable from PATH")
+	flag.StringVar(&_configParseValues.Streams, "streams", os.Getenv(ENV_STREAMS), "Comma-separated list of streams to sync. Default: all discovered streams")
+	flag.BoolVar(&_config.Streaming, "streaming", os.Getenv(ENV_STREAMING) == "true", "Continuously stream records of incremental streams with a connector that supports streaming")
+	flag.IntVar(&_configParseValues.StreamFlushIntervalSeconds, "stream-flush-interval-seconds", DEFAULT_STREAM_FLUSH_INTERVAL_SECONDS, "Interval in seconds for writing streamed records. Default: "+common.IntToString(DEFAULT_STREAM_FLUSH_INTERVAL_SECONDS))
+	if streamFlushIntervalSeconds := os.Getenv(ENV_STREAM_FLUSH_INTERVAL_SECONDS); streamFlushIntervalSeconds != "" {
+		_configParseValues.StreamFlushIntervalSeconds = common.StringToInt(streamFlushIntervalSeconds)
+	}
+}
+
+func LoadConfig() *Config {
+	parseFlags()
+	return &_config
+}
+
+func parseFlags() {
+	flag.Parse()
+
+	if _config.CommonConfig.LogLevel == "" {
+		_config.CommonConfig.LogLevel = common.DEFAULT_LOG_LEVEL
+	} else if !slices.Contains(common.LOG_LEVELS, _config.CommonConfig.LogLevel) {
+		panic("Invalid log level " + _config.CommonConfig.LogLevel + ". Must be one of " + strings.Join(common.LOG_LEVELS, ", "))
+	}
+	if _config.CommonConfig.CatalogDatabaseUrl == "" {
+		panic("Catalog database URL is required")
+	}
+	if _config.CommonConfig.Aws.Region == "" {
+		panic("AWS region is required")
+	}
+	if _config.CommonConfig.Aws.S3Endpoint == "" {
+		_config.CommonConfig.Aws.S3Endpoint = common.DEFAULT_AWS_S3_ENDPOINT
+	}
+	if _config.CommonConfig.Aws.S3Bucket == "" {
+		panic("AWS S3 bucket name is required")
+	}
+	if _config.CommonConfig.Aws.AccessKeyId != "" && _config.CommonConfig.Aws.SecretAccessKey == "" {
+		panic("AWS secret access key is required")
+	}
+	if _config.CommonConfig.Aws.AccessKeyId == "" && _config.CommonConfig.Aws.SecretAccessKey != "" {
+		panic("AWS access key ID is required")
+	}
+	if _config.CommonConfig.Aws.ServerSideEncryption != "" && _config.CommonConfig.Aws.ServerSideEncryption != common.AWS_S3_SSE_S3 && _config.CommonConfig.Aws.ServerSideEncryption != common.AWS_S3_SSE_KMS {
+		panic("AWS S3 server-side encryption must be \"" + common.AWS_S3_SSE_S3 + "\" or \"" + common.AWS_S3_SSE_KMS + "\"")
+	}
+	if (_config.CommonConfig.Aws.KmsKeyId != "") != (_config.CommonConfig.Aws.ServerSideEncryption == common.AWS_S3_SSE_KMS) {
+		panic("AWS S3 KMS key ID is required for and only used with \"" + common.AWS_S3_SSE_KMS + "\" server-side encryption")
+	}
+	common.ValidateAwsS3MaxUpload(_config.CommonConfig.Aws)
+
+	if _config.DestinationSchemaName == "" {
+		panic("Destination schema name is required")
+	}
+	if _config.ConnectorName == "" {
+		panic("Connector name is required")
+	}
+	if _configParseValues.Streams != "" {
+		_config.Streams = common.NewSet[string]().AddAll(strings.Split(_configParseValues.Streams, ","))
+	}
+	if _configParseValues.StreamFlushIntervalSeconds <= 0 {
+		panic("Stream flush interval must be greater than 0")
+	}
+	_config.StreamFlushInterval = time.Duration(_configParseValues.StreamFlushIntervalSeconds) * time.Second
+}
@@ -0,0 +1,180 @@
+package connector
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/BemiHQ/BemiDB/src/common"
+)
+
+const (
+	COMPRESSION_FACTOR = 1
+)
+
+type Syncer struct {
+	Config       *Config
+	Connector    common.Connector
+	StorageS3    *common.StorageS3
+	DuckdbClient *common.DuckdbClient
+}
+
+func NewSyncer(config *Config, storageS3 *common.StorageS3, duckdbClient *common.DuckdbClient) *Syncer {
+	connector, err := common.LoadConnector(config.CommonConfig, config.ConnectorName)
+	common.PanicIfError(config.CommonConfig, err)
+	if _, ok := connector.(common.StreamingConnector); config.Streaming && !ok {
+		common.PanicIfError(config.CommonConfig, fmt.Errorf("connector %s doesn't support streaming", config.ConnectorName))
+	}
+
+	return &Syncer{
+		Config:       config,
+		Connector:    connector,
+		StorageS3:    storageS3,
+		DuckdbClient: duckdbClient,
+	}
+}
+
+func (syncer *Syncer) Sync() {
+	common.SendAnonymousAnalytics(syncer.Config.CommonConfig, "syncer-connector-start", syncer.Config.ConnectorName)
+
+	streams, err := syncer.Connector.Discover()
+	common.PanicIfError(syncer.Config.CommonConfig, err)
+
+	var streamingWaitGroup sync.WaitGroup
+	for _, stream := range streams {
+		if syncer.Config.Streams != nil && !syncer.Config.Streams.Contains(stream.Name) {
+			continue
+		}
+
+		if syncer.Config.Streaming && stream.CursorColumnName != "" {
+			common.LogInfo(syncer.Config.CommonConfig, "Streaming stream:", stream.Name+"...")
+			streamingWaitGroup.Add(1)
+			go func() {
+				defer streamingWaitGroup.Done()
+				syncer.streamStream(stream)
+			}()
+			continue
+		}
+
+		common.LogInfo(syncer.Config.CommonConfig, "Syncing stream:", stream.Name+"...")
+		syncer.syncStream(stream)
+	}
+	streamingWaitGroup.Wait()
+
+	common.SendAnonymousAnalytics(syncer.Config.CommonConfig, "syncer-connector-finish", syncer.Config.ConnectorName)
+}
+
+func (syncer *Syncer) syncStream(stream common.ConnectorStream) {
+	icebergSchemaTable := common.IcebergSchemaTable{Schema: syncer.Config.DestinationSchemaName, Table: stream.Name}
+	icebergTable := common.NewIcebergTable(syncer.Config.CommonConfig, syncer.StorageS3, syncer.DuckdbClient, icebergSchemaTable)
+	icebergSchemaColumns := stream.IcebergSchemaColumns(syncer.Config.CommonConfig)
+
+	if stream.CursorColumnName == "" {
+		// Full-refresh sync
+		icebergTable.ReplaceWith(func(syncingIcebergTable *common.IcebergTable) {
+			cappedBuffer := syncer.readToCappedBuffer(stream, common.CursorValue{})
+			icebergTableWriter := common.NewIcebergTableWriter(syncer.Config.CommonConfig, syncer.StorageS3, syncer.DuckdbClient, syncingIcebergTable, icebergSchemaColumns, COMPRESSION_FACTOR)
+			icebergTableWriter.InsertFromJsonCappedBuffer(cappedBuffer)
+		})
+		return
+	}
+
+	// Incremental sync
+	cursorValue := icebergTable.LastCursorValue(stream.CursorColumnName)
+	common.LogInfo(syncer.Config.CommonConfig, "Starting incremental sync from cursor value:", cursorValue.StringValue)
+	cappedBuffer := syncer.readToCappedBuffer(stream, cursorValue)
+	icebergTableWriter := common.NewIcebergTableWriter(syncer.Config.CommonConfig, syncer.StorageS3, syncer.DuckdbClient, icebergTable, icebergSchemaColumns, COMPRESSION_FACTOR)
+	icebergTableWriter.AppendFromJsonCappedBuffer(cursorValue, cappedBuffer)
+}
+
+func (syncer *Syncer) readToCappedBuffer(stream common.ConnectorStream, cursorValue common.CursorValue) *common.CappedBuffer {
+	cappedBuffer := common.NewCappedBuffer(syncer.Config.CommonConfig, common.DEFAULT_CAPPED_BUFFER_SIZE)
+	jsonQueueWriter := common.NewJsonQueueWriter(cappedBuffer)
+
+	// Copy from the connector to cappedBuffer in a separate goroutine in parallel
+	go func() {
+		err := syncer.Connector.Read(stream, cursorValue, jsonQueueWriter)
+		common.PanicIfError(syncer.Config.CommonConfig, err)
+
+		common.LogInfo(syncer.Config.CommonConfig, "Finished reading stream", stream.Name, "from connector", syncer.Config.ConnectorName)
+		jsonQueueWriter.Close()
+	}()
+
+	return cappedBuffer
+}
+
+// Continuously appends the records streamed after the last cursor value, writing them every flush interval until the connector stops streaming
+func (syncer *Syncer) streamStream(stream common.ConnectorStream) {
+	icebergSchemaTable := common.IcebergSchemaTable{Schema: syncer.Config.DestinationSchemaName, Table: stream.Name}
+	icebergTable := common.NewIcebergTable(syncer.Config.CommonConfig, syncer.StorageS3, syncer.DuckdbClient, icebergSchemaTable)
+	icebergSchemaColumns := stream.IcebergSchemaColumns(syncer.Config.CommonConfig)
+
+	cursorValue := icebergTable.LastCursorValue(stream.CursorColumnName)
+	common.LogInfo(syncer.Config.CommonConfig, "Starting streaming from cursor value:", cursorValue.StringValue)
+	records := syncer.streamRecords(stream, cursorValue)
+
+	for {
+		cappedBuffer := common.NewCappedBuffer(syncer.Config.CommonConfig, common.DEFAULT_CAPPED_BUFFER_SIZE)
+		streamEnded := make(chan bool, 1)
+
+		// Copy the records streamed during the flush interval to cappedBuffer in a separate goroutine in parallel
+		go func() {
+			jsonQueueWriter := common.NewJsonQueueWriter(cappedBuffer)
+			defer jsonQueueWriter.Close()
+
+			flushTimer := time.NewTimer(syncer.Config.StreamFlushInterval)
+			defer flushTimer.Stop()
+			for {
+				select {
+				case record, ok := <-records:
+					if !ok {
+						streamEnded <- true
+						return
+					}
+					err := jsonQueueWriter.Write(record)
+					common.PanicIfError(syncer.Config.CommonConfig, err)
+				case <-flushTimer.C:
+					streamEnded <- false
+					return
+				}
+			}
+		}()
+
+		icebergTableWriter := common.NewIcebergTableWriter(syncer.Config.CommonConfig, syncer.StorageS3, syncer.DuckdbClient, icebergTable, icebergSchemaColumns, COMPRESSION_FACTOR)
+		icebergTableWriter.AppendFromJsonCappedBuffer(cursorValue, cappedBuffer)
+		if <-streamEnded {
+			break
+		}
+		cursorValue = icebergTable.LastCursorValue(stream.CursorColumnName)
+	}
+
+	common.LogInfo(syncer.Config.CommonConfig, "Finished streaming stream", stream.Name, "from connector", syncer.Config.ConnectorName)
+}
+
+// Returns the records streamed by the connector in a channel closed when the connector stops streaming
+func (syncer *Syncer) streamRecords(stream common.ConnectorStream, cursorValue common.CursorValue) <-chan map[string]interface{} {
+	pipeReader, pipeWriter := io.Pipe()
+	go func() {
+		err := syncer.Connector.(common.StreamingConnector).Stream(stream, cursorValue, common.NewJsonQueueWriter(pipeWriter))
+		pipeWriter.CloseWithError(err) // Reads return io.EOF if err is nil
+	}()
+
+	records := make(chan map[string]interface{})
+	go func() {
+		defer close(records)
+
+		jsonQueueReader := common.NewJsonQueueReader(pipeReader)
+		for {
+			var record map[string]interface{}
+			_, err := jsonQueueReader.Read(&record)
+			if err == io.EOF {
+				return
+			}
+			common.PanicIfError(syncer.Config.CommonConfig, err)
+			records <- record
+		}
+	}()
+
+	return records
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"github.com/BemiHQ/BemiDB/src/common"
+	"github.com/BemiHQ/BemiDB/src/syncer-connector/lib"
+)
+
+func init() {
+	connector.RegisterFlags()
+}
+
+func main() {
+	config := connector.LoadConfig()
+	defer common.HandleUnexpectedPanic(config.CommonConfig)
+
+	storageS3 := common.NewStorageS3(config.CommonConfig)
+	duckdbClient := common.NewDuckdbClient(config.CommonConfig, common.SYNCER_DUCKDB_BOOT_QUERIES)
+	syncer := connector.NewSyncer(config, storageS3, duckdbClient)
+	syncer.Sync()
+}
@@ -1,6 +1,7 @@
 package postgres
 
 import (
+	"encoding/json"
 	"flag"
 	"os"
 	"slices"
@@ -22,9 +23,21 @@ const (
 	ENV_SYNC_MODE             = "SOURCE_POSTGRES_SYNC_MODE"
 	ENV_INCLUDE_TABLES        = "SOURCE_POSTGRES_INCLUDE_TABLES"
 	ENV_EXCLUDE_TABLES        = "SOURCE_POSTGRES_EXCLUDE_TABLES"
+	ENV_COLUMN_OVERRIDES      = "SOURCE_POSTGRES_COLUMN_OVERRIDES"
+	ENV_HISTORY_TABLES        = "SOURCE_POSTGRES_HISTORY_TABLES"        // Full-refresh sync
 	ENV_CURSOR_COLUMNS        = "SOURCE_POSTGRES_CURSOR_COLUMNS"        // Incremental sync
 	ENV_REPLICATION_SLOT      = "SOURCE_POSTGRES_REPLICATION_SLOT"      // CDC sync
 	ENV_IGNORE_UPDATE_COLUMNS = "SOURCE_POSTGRES_IGNORE_UPDATE_COLUMNS" // CDC sync
+	ENV_BACKFILL_CHUNK_COUNT  = "SOURCE_POSTGRES_BACKFILL_CHUNK_COUNT"  // Full-refresh sync
+	ENV_BACKFILL_PARALLELISM  = "SOURCE_POSTGRES_BACKFILL_PARALLELISM"  // Full-refresh sync
+	ENV_MAX_CONCURRENT_TABLES = "SOURCE_POSTGRES_MAX_CONCURRENT_TABLES" // Full-refresh sync
+	ENV_MAX_BYTES_PER_SECOND  = "SOURCE_POSTGRES_MAX_BYTES_PER_SECOND"
+
+	// Drift check
+	ENV_DRIFT_CHECK_INTERVAL_SECONDS = "SOURCE_POSTGRES_DRIFT_CHECK_INTERVAL_SECONDS"
+	ENV_DRIFT_THRESHOLD_PERCENT      = "SOURCE_POSTGRES_DRIFT_THRESHOLD_PERCENT"
+	ENV_DRIFT_TIMESTAMP_COLUMNS      = "SOURCE_POSTGRES_DRIFT_TIMESTAMP_COLUMNS"
+	ENV_DRIFT_MAX_LAG_SECONDS        = "SOURCE_POSTGRES_DRIFT_MAX_LAG_SECONDS"
 
 	// CDC sync
 	ENV_NATS_URL                   = "NATS_URL"
@@ -34,6 +47,11 @@ const (
 	ENV_NATS_FETCH_TIMEOUT_SECONDS = "NATS_FETCH_TIMEOUT_SECONDS"
 
 	DEFAULT_NATS_FETCH_TIMEOUT_SECONDS = 30
+	DEFAULT_BACKFILL_CHUNK_COUNT       = 1
+	DEFAULT_BACKFILL_PARALLELISM       = 4
+	DEFAULT_MAX_CONCURRENT_TABLES      = 1
+	DEFAULT_DRIFT_THRESHOLD_PERCENT    = 1.0
+	DEFAULT_DRIFT_MAX_LAG_SECONDS      = 3600
 )
 
 type NatsConfig struct {
@@ -52,17 +70,31 @@ type Config struct {
 	DatabaseUrl                 string
 	IncludeTables               common.Set[string]
 	ExcludeTables               common.Set[string]
+	ColumnOverridesByTableName  map[string]map[string]common.ColumnOverride
+	MaxBytesPerSecond           int64              // 0 means unlimited
 	CursorColumnNameByTableName map[string]string  // Incremental sync
 	ReplicationSlot             string             // CDC sync
 	IgnoreUpdateColumns         common.Set[string] // CDC sync
 	Nats                        NatsConfig         // CDC sync
+	BackfillChunkCount          int                // Full-refresh sync
+	BackfillParallelism         int                // Full-refresh sync
+	HistoryTables               common.Set[string] // Full-refresh sync
+	MaxConcurrentTables         int                // Full-refresh sync
+
+	DriftCheckIntervalSeconds           int               // Drift check instead of sync if > 0
+	DriftThresholdPercent               float64           // Drift check
+	DriftTimestampColumnNameByTableName map[string]string // Drift check
+	DriftMaxLagSeconds                  int               // Drift check
 }
 
 type configParseValues struct {
-	IncludeTables       string
-	ExcludeTables       string
-	IgnoreUpdateColumns string
-	CursorColumns       string
+	IncludeTables         string
+	ExcludeTables         string
+	ColumnOverrides       string
+	IgnoreUpdateColumns   string
+	CursorColumns         string
+	HistoryTables         string
+	DriftTimestampColumns string
 }
 
 var _config Config
@@ -78,6 +110,9 @@ func RegisterFlags() {
 	flag.StringVar(&_config.CommonConfig.Aws.S3Bucket, "aws-s3-bucket", os.Getenv(common.ENV_AWS_S3_BUCKET), "AWS S3 bucket name")
 	flag.StringVar(&_config.CommonConfig.Aws.AccessKeyId, "aws-access-key-id", os.Getenv(common.ENV_AWS_ACCESS_KEY_ID), "AWS access key ID")
 	flag.StringVar(&_config.CommonConfig.Aws.SecretAccessKey, "aws-secret-access-key", os.Getenv(common.ENV_AWS_SECRET_ACCESS_KEY), "AWS secret access key")
+	flag.StringVar(&_config.CommonConfig.Aws.ServerSideEncryption, "aws-s3-server-side-encryption", os.Getenv(common.ENV_AWS_S3_SERVER_SIDE_ENCRYPTION), `Server-side encryption of written S3 objects: "`+common.AWS_S3_SSE_S3+`" (SSE-S3) or "`+common.AWS_S3_SSE_KMS+`" (SSE-KMS). Default: none`)
+	flag.StringVar(&_config.CommonConfig.Aws.KmsKeyId, "aws-s3-kms-key-id", os.Getenv(common.ENV_AWS_S3_KMS_KEY_ID), "KMS key ID or ARN for SSE-KMS")
+	common.RegisterAwsS3MaxUploadFlag(&_config.CommonConfig.Aws)
 	flag.BoolVar(&_config.CommonConfig.DisableAnonymousAnalytics, "disable-anonymous-analytics", os.Getenv(common.ENV_DISABLE_ANONYMOUS_ANALYTICS) == "true", "Disable anonymous analytics collection")
 
 	flag.StringVar(&_config.DestinationSchemaName, "destination-schema-name", os.Getenv(ENV_DESTINATION_SCHEMA_NAME), "Destination schema name to store the synced data")
@@ -85,6 +120,11 @@ func RegisterFlags() {
 	flag.StringVar((*string)(&_config.SyncMode), "sync-mode", os.Getenv(ENV_SYNC_MODE), `Sync mode: "FULL_REFRESH", "CDC", or "INCREMENTAL"`)
 	flag.StringVar(&_configParseValues.IncludeTables, "include-tables", os.Getenv(ENV_INCLUDE_TABLES), "Comma-separated list of tables to include in the sync. Default: all tables included")
 	flag.StringVar(&_configParseValues.ExcludeTables, "exclude-tables", os.Getenv(ENV_EXCLUDE_TABLES), "Comma-separated list of tables to exclude from the sync. Default: no tables excluded")
+	flag.StringVar(&_configParseValues.ColumnOverrides, "column-overrides", os.Getenv(ENV_COLUMN_OVERRIDES), `Column overrides applied during load. Format: {"schema.table": {"column": {"rename": "...", "type": "...", "expression": "..."}}}. Default: no overrides`)
+	flag.Int64Var(&_config.MaxBytesPerSecond, "max-bytes-per-second", 0, "Maximum bandwidth in bytes per second for reading data from PostgreSQL across all tables. Default: 0 (unlimited)")
+	if maxBytesPerSecond := os.Getenv(ENV_MAX_BYTES_PER_SECOND); maxBytesPerSecond != "" {
+		_config.MaxBytesPerSecond = common.StringToInt64(maxBytesPerSecond)
+	}
 	flag.StringVar(&_configParseValues.CursorColumns, "cursor-columns", os.Getenv(ENV_CURSOR_COLUMNS), "Cursor columns to use for incremental sync. Format: schema.table=column,schema2.table2=column2. Default: no cursor columns specified")
 	flag.StringVar(&_config.ReplicationSlot, "replication-slot", os.Getenv(ENV_REPLICATION_SLOT), "Replication slot name for CDC sync")
 	flag.StringVar(&_configParseValues.IgnoreUpdateColumns, "ignore-update-columns", os.Getenv(ENV_IGNORE_UPDATE_COLUMNS), "Comma-separated list of columns to ignore for updates in CDC mode. Default: no columns ignored")
@@ -97,6 +137,32 @@ func RegisterFlags() {
 	if fetchTimeoutSeconds != "" {
 		_config.Nats.FetchTimeoutSeconds = common.StringToInt(fetchTimeoutSeconds)
 	}
+	flag.StringVar(&_configParseValues.HistoryTables, "history-tables", os.Getenv(ENV_HISTORY_TABLES), "Comma-separated list of tables to keep the history of row changes for in full-refresh sync. Default: no tables")
+	flag.IntVar(&_config.BackfillChunkCount, "backfill-chunk-count", DEFAULT_BACKFILL_CHUNK_COUNT, "Number of key ranges to split each table into for full-refresh sync. Default: 1 (no chunking)")
+	if backfillChunkCount := os.Getenv(ENV_BACKFILL_CHUNK_COUNT); backfillChunkCount != "" {
+		_config.BackfillChunkCount = common.StringToInt(backfillChunkCount)
+	}
+	flag.IntVar(&_config.BackfillParallelism, "backfill-parallelism", DEFAULT_BACKFILL_PARALLELISM, "Number of key ranges to extract in parallel when backfill-chunk-count > 1")
+	if backfillParallelism := os.Getenv(ENV_BACKFILL_PARALLELISM); backfillParallelism != "" {
+		_config.BackfillParallelism = common.StringToInt(backfillParallelism)
+	}
+	flag.IntVar(&_config.MaxConcurrentTables, "max-concurrent-tables", DEFAULT_MAX_CONCURRENT_TABLES, "Number of tables to sync in parallel in full-refresh sync. Default: 1")
+	if maxConcurrentTables := os.Getenv(ENV_MAX_CONCURRENT_TABLES); maxConcurrentTables != "" {
+		_config.MaxConcurrentTables = common.StringToInt(maxConcurrentTables)
+	}
+	flag.IntVar(&_config.DriftCheckIntervalSeconds, "drift-check-interval-seconds", 0, "Seconds between checks comparing the source tables with the synced tables instead of syncing. Default: 0 (sync)")
+	if driftCheckIntervalSeconds := os.Getenv(ENV_DRIFT_CHECK_INTERVAL_SECONDS); driftCheckIntervalSeconds != "" {
+		_config.DriftCheckIntervalSeconds = common.StringToInt(driftCheckIntervalSeconds)
+	}
+	flag.Float64Var(&_config.DriftThresholdPercent, "drift-threshold-percent", DEFAULT_DRIFT_THRESHOLD_PERCENT, "Difference between the source and synced row counts in percent above which a table is reported as drifted")
+	if driftThresholdPercent := os.Getenv(ENV_DRIFT_THRESHOLD_PERCENT); driftThresholdPercent != "" {
+		_config.DriftThresholdPercent = common.StringToFloat64(driftThresholdPercent)
+	}
+	flag.StringVar(&_configParseValues.DriftTimestampColumns, "drift-timestamp-columns", os.Getenv(ENV_DRIFT_TIMESTAMP_COLUMNS), "Timestamp columns (e.g., updated_at) to compare the max values of in drift checks. Format: schema.table=column,schema2.table2=column2. Default: row counts only")
+	flag.IntVar(&_config.DriftMaxLagSeconds, "drift-max-lag-seconds", DEFAULT_DRIFT_MAX_LAG_SECONDS, "Seconds the max timestamp column value of a synced table can be behind the source before it is reported as drifted")
+	if driftMaxLagSeconds := os.Getenv(ENV_DRIFT_MAX_LAG_SECONDS); driftMaxLagSeconds != "" {
+		_config.DriftMaxLagSeconds = common.StringToInt(driftMaxLagSeconds)
+	}
 }
 
 func LoadConfig() *Config {
@@ -130,6 +196,13 @@ func parseFlags() {
 	if _config.CommonConfig.Aws.AccessKeyId == "" && _config.CommonConfig.Aws.SecretAccessKey != "" {
 		panic("AWS access key ID is required")
 	}
+	if _config.CommonConfig.Aws.ServerSideEncryption != "" && _config.CommonConfig.Aws.ServerSideEncryption != common.AWS_S3_SSE_S3 && _config.CommonConfig.Aws.ServerSideEncryption != common.AWS_S3_SSE_KMS {
+		panic("AWS S3 server-side encryption must be \"" + common.AWS_S3_SSE_S3 + "\" or \"" + common.AWS_S3_SSE_KMS + "\"")
+	}
+	if (_config.CommonConfig.Aws.KmsKeyId != "") != (_config.CommonConfig.Aws.ServerSideEncryption == common.AWS_S3_SSE_KMS) {
+		panic("AWS S3 KMS key ID is required for and only used with \"" + common.AWS_S3_SSE_KMS + "\" server-side encryption")
+	}
+	common.ValidateAwsS3MaxUpload(_config.CommonConfig.Aws)
 
 	if _config.DestinationSchemaName == "" {
 		panic("Destination schema name is required")
@@ -143,9 +216,42 @@ func parseFlags() {
 	if _configParseValues.ExcludeTables != "" {
 		_config.ExcludeTables = common.NewSet[string]().AddAll(strings.Split(_configParseValues.ExcludeTables, ","))
 	}
+	if _configParseValues.ColumnOverrides != "" {
+		err := json.Unmarshal([]byte(_configParseValues.ColumnOverrides), &_config.ColumnOverridesByTableName)
+		if err != nil {
+			panic("Invalid column overrides format. Expected JSON object, got: " + _configParseValues.ColumnOverrides)
+		}
+	}
+	if _config.MaxBytesPerSecond < 0 {
+		panic("Max bytes per second must be greater than or equal to 0")
+	}
+
+	if _config.DriftCheckIntervalSeconds < 0 {
+		panic("Drift check interval seconds must be greater than or equal to 0")
+	}
+	if _config.DriftCheckIntervalSeconds > 0 {
+		if _config.DriftThresholdPercent < 0 {
+			panic("Drift threshold percent must be greater than or equal to 0")
+		}
+		if _config.DriftMaxLagSeconds < 0 {
+			panic("Drift max lag seconds must be greater than or equal to 0")
+		}
+		_config.DriftTimestampColumnNameByTableName = make(map[string]string)
+		if _configParseValues.DriftTimestampColumns != "" {
+			for _, timestampColumn := range strings.Split(_configParseValues.DriftTimestampColumns, ",") {
+				parts := strings.Split(timestampColumn, "=")
+				if len(parts) != 2 {
+					panic("Invalid drift timestamp column format. Expected schema.table=column, got: " + timestampColumn)
+				}
+				_config.DriftTimestampColumnNameByTableName[parts[0]] = parts[1]
+			}
+		}
+	}
 
 	if _config.SyncMode == "" {
-		panic("Sync mode is required")
+		if _config.DriftCheckIntervalSeconds == 0 {
+			panic("Sync mode is required")
+		}
 	} else if _config.SyncMode != SyncModeFullRefresh && _config.SyncMode != SyncModeCDC && _config.SyncMode != SyncModeIncremental {
 		panic("Invalid sync mode " + string(_config.SyncMode) + ". Must be one of FULL_REFRESH, CDC, or INCREMENTAL")
 	}
@@ -174,6 +280,20 @@ func parseFlags() {
 		if _config.Nats.FetchTimeoutSeconds <= 0 {
 			panic("NATS fetch timeout must be greater than 0")
 		}
+	case SyncModeFullRefresh:
+		if _config.BackfillChunkCount <= 0 {
+			panic("Backfill chunk count must be greater than 0")
+		}
+		if _config.BackfillParallelism <= 0 {
+			panic("Backfill parallelism must be greater than 0")
+		}
+		if _config.MaxConcurrentTables <= 0 {
+			panic("Max concurrent tables must be greater than 0")
+		}
+		_config.HistoryTables = common.NewSet[string]()
+		if _configParseValues.HistoryTables != "" {
+			_config.HistoryTables.AddAll(strings.Split(_configParseValues.HistoryTables, ","))
+		}
 	case SyncModeIncremental:
 		if _configParseValues.CursorColumns != "" {
 			_config.CursorColumnNameByTableName = make(map[string]string)
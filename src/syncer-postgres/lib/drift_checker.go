@@ -0,0 +1,145 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"time"
+
+	"github.com/BemiHQ/BemiDB/src/common"
+)
+
+const DRIFT_CHECK_SYNCER_STATE_NAME = "drift-check"
+
+// Source and synced row counts of a table, recorded in the catalog after each check
+type TableDrift struct {
+	Table          string    `json:"table"`
+	SourceRowCount int64     `json:"sourceRowCount"`
+	SyncedRowCount int64     `json:"syncedRowCount"`
+	LagSeconds     float64   `json:"lagSeconds,omitempty"` // How far the max timestamp column value is behind the source
+	Synced         bool      `json:"synced"`               // False if the table doesn't exist in BemiDB yet
+	Drifted        bool      `json:"drifted"`
+	Error          string    `json:"error,omitempty"` // Why the table couldn't be checked
+	CheckedAt      time.Time `json:"checkedAt"`
+}
+
+// Compares source tables with the synced tables to catch silently broken sync jobs
+type DriftChecker struct {
+	Config       *Config
+	StorageS3    *common.StorageS3
+	DuckdbClient *common.DuckdbClient
+}
+
+func NewDriftChecker(config *Config, storageS3 *common.StorageS3, duckdbClient *common.DuckdbClient) *DriftChecker {
+	return &DriftChecker{
+		Config:       config,
+		StorageS3:    storageS3,
+		DuckdbClient: duckdbClient,
+	}
+}
+
+func (checker *DriftChecker) Check(postgres *Postgres, pgSchemaTables []PgSchemaTable) []TableDrift {
+	tableDrifts := make([]TableDrift, 0, len(pgSchemaTables))
+	driftedCount := 0
+	failedCount := 0
+
+	for _, pgSchemaTable := range pgSchemaTables {
+		if checker.Config.HistoryTables.Contains(pgSchemaTable.ToConfigArg()) {
+			common.LogDebug(checker.Config.CommonConfig, "Skipping drift check for history table", pgSchemaTable.String())
+			continue
+		}
+
+		tableDrift, err := checker.checkTable(postgres, pgSchemaTable)
+		if err != nil {
+			// Keep checking the other tables, e.g. if the table was dropped since it was listed
+			failedCount++
+			tableDrift.Error = err.Error()
+			common.LogError(checker.Config.CommonConfig, "Couldn't check drift in table", pgSchemaTable.String()+":", err)
+		} else if tableDrift.Drifted {
+			driftedCount++
+			common.LogError(checker.Config.CommonConfig, "Drift detected in table", pgSchemaTable.String()+":", checker.describe(tableDrift))
+		} else {
+			common.LogDebug(checker.Config.CommonConfig, "No drift in table", pgSchemaTable.String()+":", checker.describe(tableDrift))
+		}
+		tableDrifts = append(tableDrifts, tableDrift)
+	}
+
+	state, err := json.Marshal(tableDrifts)
+	common.PanicIfError(checker.Config.CommonConfig, err)
+	common.NewIcebergCatalog(checker.Config.CommonConfig).UpsertSyncerState(checker.Config.DestinationSchemaName, DRIFT_CHECK_SYNCER_STATE_NAME, state)
+
+	common.LogInfo(checker.Config.CommonConfig, "Drift check finished:", driftedCount, "of", len(tableDrifts), "tables drifted,", failedCount, "failed")
+	return tableDrifts
+}
+
+// Compares row counts from statistics and metadata without scanning whole tables, so the threshold should allow for estimation errors
+func (checker *DriftChecker) checkTable(postgres *Postgres, pgSchemaTable PgSchemaTable) (tableDrift TableDrift, err error) {
+	tableDrift = TableDrift{Table: pgSchemaTable.ToConfigArg(), CheckedAt: time.Now()}
+
+	tableDrift.SourceRowCount, err = postgres.EstimatedRowCount(pgSchemaTable)
+	if err != nil {
+		return tableDrift, err
+	}
+
+	icebergSchemaTable := common.IcebergSchemaTable{Schema: checker.Config.DestinationSchemaName, Table: pgSchemaTable.IcebergTableName()}
+	icebergTable := common.NewIcebergTable(checker.Config.CommonConfig, checker.StorageS3, checker.DuckdbClient, icebergSchemaTable)
+	metadataFileS3Path := icebergTable.MetadataFileS3Path()
+	if metadataFileS3Path == "" {
+		tableDrift.Drifted = true
+		return tableDrift, nil
+	}
+	tableDrift.Synced = true
+
+	// The total-records of the last snapshot summary, without reading Parquet files
+	err = checker.DuckdbClient.QueryRowContext(
+		context.Background(),
+		"SELECT CAST(json_extract_string(content, '$.snapshots[#-1].summary.\"total-records\"') AS BIGINT) FROM read_text('$path')",
+		map[string]string{"path": metadataFileS3Path},
+	).Scan(&tableDrift.SyncedRowCount)
+	if err != nil {
+		return tableDrift, err
+	}
+
+	columnName := checker.Config.DriftTimestampColumnNameByTableName[pgSchemaTable.ToConfigArg()]
+	if columnName != "" {
+		var syncedMaxEpochSeconds float64
+		err = checker.DuckdbClient.QueryRowContext(
+			context.Background(),
+			`SELECT COALESCE(epoch(max("`+columnName+`")), 0)::DOUBLE FROM iceberg_scan('`+metadataFileS3Path+`')`,
+		).Scan(&syncedMaxEpochSeconds)
+		if err != nil {
+			return tableDrift, err
+		}
+
+		sourceMaxEpochSeconds, err := postgres.MaxEpochSeconds(pgSchemaTable, columnName)
+		if err != nil {
+			return tableDrift, err
+		}
+		tableDrift.LagSeconds = math.Max(sourceMaxEpochSeconds-syncedMaxEpochSeconds, 0)
+	}
+
+	tableDrift.Drifted = checker.drifted(tableDrift)
+	return tableDrift, nil
+}
+
+func (checker *DriftChecker) drifted(tableDrift TableDrift) bool {
+	return checker.exceedsThreshold(tableDrift.SourceRowCount, tableDrift.SyncedRowCount) || tableDrift.LagSeconds > float64(checker.Config.DriftMaxLagSeconds)
+}
+
+func (checker *DriftChecker) exceedsThreshold(sourceRowCount int64, syncedRowCount int64) bool {
+	difference := math.Abs(float64(sourceRowCount - syncedRowCount))
+	return difference*100 > float64(max(sourceRowCount, 1))*checker.Config.DriftThresholdPercent
+}
+
+// source rows: 100, synced rows: 90, lag: 3600s
+func (checker *DriftChecker) describe(tableDrift TableDrift) string {
+	if !tableDrift.Synced {
+		return "source rows: " + common.Int64ToString(tableDrift.SourceRowCount) + ", not synced"
+	}
+
+	description := "source rows: " + common.Int64ToString(tableDrift.SourceRowCount) + ", synced rows: " + common.Int64ToString(tableDrift.SyncedRowCount)
+	if tableDrift.LagSeconds > 0 {
+		description += ", lag: " + common.IntToString(int(tableDrift.LagSeconds)) + "s"
+	}
+	return description
+}
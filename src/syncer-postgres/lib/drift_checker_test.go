@@ -0,0 +1,50 @@
+package postgres
+
+import (
+	"testing"
+)
+
+func TestDriftCheckerDrifted(t *testing.T) {
+	checker := NewDriftChecker(&Config{DriftThresholdPercent: 1, DriftMaxLagSeconds: 3600}, nil, nil)
+
+	t.Run("Reports tables with row counts within the threshold as not drifted", func(t *testing.T) {
+		for _, tableDrift := range []TableDrift{
+			{SourceRowCount: 100, SyncedRowCount: 100},
+			{SourceRowCount: 100, SyncedRowCount: 99},
+			{SourceRowCount: 1000, SyncedRowCount: 1010},
+			{SourceRowCount: 0, SyncedRowCount: 0},
+			{SourceRowCount: 100, SyncedRowCount: 100, LagSeconds: 3600},
+		} {
+			if checker.drifted(tableDrift) {
+				t.Errorf("Expected no drift, got drift for %+v", tableDrift)
+			}
+		}
+	})
+
+	t.Run("Reports tables with row counts beyond the threshold or lagging behind as drifted", func(t *testing.T) {
+		for _, tableDrift := range []TableDrift{
+			{SourceRowCount: 100, SyncedRowCount: 98},
+			{SourceRowCount: 1000, SyncedRowCount: 1011},
+			{SourceRowCount: 0, SyncedRowCount: 1},
+			{SourceRowCount: 100, SyncedRowCount: 100, LagSeconds: 3601},
+		} {
+			if !checker.drifted(tableDrift) {
+				t.Errorf("Expected drift, got no drift for %+v", tableDrift)
+			}
+		}
+	})
+}
+
+func TestDriftCheckerDescribe(t *testing.T) {
+	checker := NewDriftChecker(&Config{}, nil, nil)
+
+	for expectedDescription, tableDrift := range map[string]TableDrift{
+		"source rows: 100, not synced":                  {SourceRowCount: 100},
+		"source rows: 100, synced rows: 90":             {SourceRowCount: 100, SyncedRowCount: 90, Synced: true},
+		"source rows: 100, synced rows: 90, lag: 3600s": {SourceRowCount: 100, SyncedRowCount: 90, LagSeconds: 3600.5, Synced: true},
+	} {
+		if description := checker.describe(tableDrift); description != expectedDescription {
+			t.Errorf("Expected %q, got %q", expectedDescription, description)
+		}
+	}
+}
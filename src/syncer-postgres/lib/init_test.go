@@ -31,16 +31,18 @@ var PG_SCHEMA_COLUMNS_TEST_TABLE = []PgSchemaColumn{
 		Namespace:  "pg_catalog",
 	},
 	{
-		ColumnName: "bpchar_column",
-		DataType:   "character",
-		UdtName:    "bpchar",
-		Namespace:  "pg_catalog",
+		ColumnName:             "bpchar_column",
+		DataType:               "character",
+		UdtName:                "bpchar",
+		CharacterMaximumLength: "10",
+		Namespace:              "pg_catalog",
 	},
 	{
-		ColumnName: "varchar_column",
-		DataType:   "character varying",
-		UdtName:    "varchar",
-		Namespace:  "pg_catalog",
+		ColumnName:             "varchar_column",
+		DataType:               "character varying",
+		UdtName:                "varchar",
+		CharacterMaximumLength: "255",
+		Namespace:              "pg_catalog",
 	},
 	{
 		ColumnName: "text_column",
@@ -405,6 +407,9 @@ func init() {
 		if PG_SCHEMA_COLUMNS_TEST_TABLE[i].IsNullable == "" {
 			PG_SCHEMA_COLUMNS_TEST_TABLE[i].IsNullable = "YES"
 		}
+		if PG_SCHEMA_COLUMNS_TEST_TABLE[i].CharacterMaximumLength == "" {
+			PG_SCHEMA_COLUMNS_TEST_TABLE[i].CharacterMaximumLength = "0"
+		}
 		if PG_SCHEMA_COLUMNS_TEST_TABLE[i].NumericPrecision == "" {
 			PG_SCHEMA_COLUMNS_TEST_TABLE[i].NumericPrecision = "0"
 		}
@@ -430,6 +435,11 @@ func init() {
 		createTestTableViaFullRefresh(syncer, PgSchemaTable{Schema: "public", Table: "partitioned_table1"}, PG_SCHEMA_COLUMNS_PARTITIONED_TABLE, CSV_ROWS_PARTITIONED_TABLE1)
 		createTestTableViaFullRefresh(syncer, PgSchemaTable{Schema: "public", Table: "partitioned_table2"}, PG_SCHEMA_COLUMNS_PARTITIONED_TABLE, CSV_ROWS_PARTITIONED_TABLE2)
 		createTestTableViaFullRefresh(syncer, PgSchemaTable{Schema: "public", Table: "partitioned_table3"}, PG_SCHEMA_COLUMNS_PARTITIONED_TABLE, CSV_ROWS_PARTITIONED_TABLE3)
+		utils.ReplaceTablePartitions([]PgSchemaTable{
+			{Schema: "public", Table: "partitioned_table1", ParentPartitionedTable: "partitioned_table"},
+			{Schema: "public", Table: "partitioned_table2", ParentPartitionedTable: "partitioned_table"},
+			{Schema: "public", Table: "partitioned_table3", ParentPartitionedTable: "partitioned_table"},
+		}, common.NewSet[string]())
 		createTestTableViaFullRefresh(syncer, PgSchemaTable{Schema: "test", Table: "empty_table"}, PG_SCHEMA_COLUMNS_EMPTY_TABLE, [][]string{})
 	default:
 		common.Panic(config.CommonConfig, "Unsupported sync mode: "+string(config.SyncMode))
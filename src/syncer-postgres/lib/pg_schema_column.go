@@ -9,20 +9,27 @@ import (
 const (
 	PG_TRUE            = "YES"
 	PG_DATA_TYPE_ARRAY = "ARRAY"
+	PG_VARHDRSZ        = 4
 )
 
 type PgSchemaColumn struct {
-	ColumnName          string
-	DataType            string
-	UdtName             string
-	IsNullable          string
-	OrdinalPosition     string
-	NumericPrecision    string
-	NumericScale        string
-	DatetimePrecision   string
-	Namespace           string
-	IsPartOfUniqueIndex bool
-	Config              *Config
+	ColumnName             string
+	DataType               string
+	UdtName                string
+	IsNullable             string
+	OrdinalPosition        string
+	CharacterMaximumLength string
+	NumericPrecision       string
+	NumericScale           string
+	DatetimePrecision      string
+	ColumnDefault          string
+	GenerationExpression   string
+	ReferencedSchema       string // Single-column foreign key
+	ReferencedTable        string
+	ReferencedColumn       string
+	Namespace              string
+	IsPartOfUniqueIndex    bool
+	Config                 *Config
 }
 
 func NewPgSchemaColumn(config *Config) *PgSchemaColumn {
@@ -35,15 +42,23 @@ func (pgSchemaColumn *PgSchemaColumn) ToIcebergSchemaColumn() *common.IcebergSch
 	pgPrimitiveColumnType := strings.TrimLeft(pgSchemaColumn.UdtName, "_")
 
 	icebergSchemaColumn := &common.IcebergSchemaColumn{
-		Config:              pgSchemaColumn.Config.CommonConfig,
-		ColumnName:          pgSchemaColumn.ColumnName,
-		Position:            common.StringToInt(pgSchemaColumn.OrdinalPosition),
-		NumericPrecision:    common.StringToInt(pgSchemaColumn.NumericPrecision),
-		NumericScale:        common.StringToInt(pgSchemaColumn.NumericScale),
-		IsList:              pgSchemaColumn.DataType == PG_DATA_TYPE_ARRAY,
-		IsRequired:          pgSchemaColumn.IsNullable != PG_TRUE,
-		IsPartOfUniqueIndex: pgSchemaColumn.IsPartOfUniqueIndex,
-		DatetimePrecision:   common.StringToInt(pgSchemaColumn.DatetimePrecision),
+		Config:               pgSchemaColumn.Config.CommonConfig,
+		ColumnName:           pgSchemaColumn.ColumnName,
+		Position:             common.StringToInt(pgSchemaColumn.OrdinalPosition),
+		NumericPrecision:     common.StringToInt(pgSchemaColumn.NumericPrecision),
+		NumericScale:         common.StringToInt(pgSchemaColumn.NumericScale),
+		IsList:               pgSchemaColumn.DataType == PG_DATA_TYPE_ARRAY,
+		IsRequired:           pgSchemaColumn.IsNullable != PG_TRUE,
+		IsPartOfUniqueIndex:  pgSchemaColumn.IsPartOfUniqueIndex,
+		DatetimePrecision:    common.StringToInt(pgSchemaColumn.DatetimePrecision),
+		DefaultValue:         pgSchemaColumn.ColumnDefault,
+		GenerationExpression: pgSchemaColumn.GenerationExpression,
+	}
+
+	if pgSchemaColumn.ReferencedTable != "" {
+		referencedPgSchemaTable := PgSchemaTable{Schema: pgSchemaColumn.ReferencedSchema, Table: pgSchemaColumn.ReferencedTable}
+		icebergSchemaColumn.ReferencedTable = referencedPgSchemaTable.IcebergTableName()
+		icebergSchemaColumn.ReferencedColumn = pgSchemaColumn.ReferencedColumn
 	}
 
 	switch pgPrimitiveColumnType {
@@ -64,6 +79,7 @@ func (pgSchemaColumn *PgSchemaColumn) ToIcebergSchemaColumn() *common.IcebergSch
 		icebergSchemaColumn.ColumnType = common.IcebergColumnTypeDouble
 	case "numeric":
 		icebergSchemaColumn.ColumnType = common.IcebergColumnTypeDecimal
+		icebergSchemaColumn.TypeModifier = pgSchemaColumn.numericTypeModifier()
 	case "date":
 		icebergSchemaColumn.ColumnType = common.IcebergColumnTypeDate
 	case "time":
@@ -78,10 +94,14 @@ func (pgSchemaColumn *PgSchemaColumn) ToIcebergSchemaColumn() *common.IcebergSch
 	case "bpchar":
 		icebergSchemaColumn.ColumnType = common.IcebergColumnTypeString
 		icebergSchemaColumn.LogicalColumnType = common.IcebergLogicalColumnTypeBpchar
+		icebergSchemaColumn.TypeModifier = pgSchemaColumn.characterTypeModifier()
+	case "varchar":
+		icebergSchemaColumn.ColumnType = common.IcebergColumnTypeString
+		icebergSchemaColumn.TypeModifier = pgSchemaColumn.characterTypeModifier()
 	case "point":
 		icebergSchemaColumn.ColumnType = common.IcebergColumnTypeString
 		icebergSchemaColumn.LogicalColumnType = common.IcebergLogicalColumnTypePoint
-	case "varchar", "char", "text", "uuid",
+	case "char", "text", "uuid",
 		"line", "lseg", "box", "path", "polygon", "circle",
 		"cidr", "inet", "macaddr", "macaddr8",
 		"ltree", "tsvector", "xml", "pg_snapshot":
@@ -100,3 +120,29 @@ func (pgSchemaColumn *PgSchemaColumn) ToIcebergSchemaColumn() *common.IcebergSch
 
 	return icebergSchemaColumn
 }
+
+// Encodes numeric(precision, scale) the same way as PostgreSQL's atttypmod
+func (pgSchemaColumn *PgSchemaColumn) numericTypeModifier() int {
+	if pgSchemaColumn.DataType == PG_DATA_TYPE_ARRAY {
+		return 0 // information_schema.columns doesn't return precision for arrays
+	}
+
+	precision := common.StringToInt(pgSchemaColumn.NumericPrecision)
+	if precision == 0 {
+		return -1
+	}
+	return (precision<<16 | common.StringToInt(pgSchemaColumn.NumericScale)) + PG_VARHDRSZ
+}
+
+// Encodes varchar(length) and char(length) the same way as PostgreSQL's atttypmod
+func (pgSchemaColumn *PgSchemaColumn) characterTypeModifier() int {
+	if pgSchemaColumn.DataType == PG_DATA_TYPE_ARRAY {
+		return 0 // information_schema.columns doesn't return length for arrays
+	}
+
+	length := common.StringToInt(pgSchemaColumn.CharacterMaximumLength)
+	if length == 0 {
+		return -1
+	}
+	return length + PG_VARHDRSZ
+}
@@ -114,13 +114,36 @@ func (postgres *Postgres) PgSchemaColumns(pgSchemaTable PgSchemaTable, retryCoun
 			columns.udt_name,
 			columns.is_nullable,
 			columns.ordinal_position,
+			COALESCE(columns.character_maximum_length, 0),
 			COALESCE(columns.numeric_precision, 0),
 			COALESCE(columns.numeric_scale, 0),
 			COALESCE(columns.datetime_precision, 0),
+			COALESCE(columns.column_default, ''),
+			COALESCE(columns.generation_expression, ''),
+			COALESCE(foreign_keys.referenced_schema, ''),
+			COALESCE(foreign_keys.referenced_table, ''),
+			COALESCE(foreign_keys.referenced_column, ''),
 			pg_namespace.nspname
 		FROM information_schema.columns
 		JOIN pg_type ON pg_type.typname = columns.udt_name
 		JOIN pg_namespace ON pg_namespace.oid = pg_type.typnamespace
+		LEFT JOIN LATERAL (
+			SELECT
+				referenced_namespace.nspname AS referenced_schema,
+				referenced_class.relname AS referenced_table,
+				referenced_attribute.attname AS referenced_column
+			FROM pg_constraint
+			JOIN pg_attribute ON pg_attribute.attrelid = pg_constraint.conrelid AND pg_attribute.attnum = pg_constraint.conkey[1]
+			JOIN pg_class referenced_class ON referenced_class.oid = pg_constraint.confrelid
+			JOIN pg_namespace referenced_namespace ON referenced_namespace.oid = referenced_class.relnamespace
+			JOIN pg_attribute referenced_attribute ON referenced_attribute.attrelid = pg_constraint.confrelid AND referenced_attribute.attnum = pg_constraint.confkey[1]
+			WHERE pg_constraint.contype = 'f' AND
+				array_length(pg_constraint.conkey, 1) = 1 AND
+				pg_constraint.conrelid = (quote_ident(columns.table_schema) || '.' || quote_ident(columns.table_name))::regclass AND
+				pg_attribute.attname = columns.column_name
+			ORDER BY pg_constraint.conname
+			LIMIT 1
+		) foreign_keys ON TRUE
 		WHERE columns.table_schema = $1 AND columns.table_name = $2
 		ORDER BY columns.ordinal_position`,
 		pgSchemaTable.Schema,
@@ -137,9 +160,15 @@ func (postgres *Postgres) PgSchemaColumns(pgSchemaTable PgSchemaTable, retryCoun
 			&pgSchemaColumn.UdtName,
 			&pgSchemaColumn.IsNullable,
 			&pgSchemaColumn.OrdinalPosition,
+			&pgSchemaColumn.CharacterMaximumLength,
 			&pgSchemaColumn.NumericPrecision,
 			&pgSchemaColumn.NumericScale,
 			&pgSchemaColumn.DatetimePrecision,
+			&pgSchemaColumn.ColumnDefault,
+			&pgSchemaColumn.GenerationExpression,
+			&pgSchemaColumn.ReferencedSchema,
+			&pgSchemaColumn.ReferencedTable,
+			&pgSchemaColumn.ReferencedColumn,
 			&pgSchemaColumn.Namespace,
 		)
 		common.PanicIfError(postgres.Config.CommonConfig, err)
@@ -200,6 +229,63 @@ func (postgres *Postgres) PgSchemaColumns(pgSchemaTable PgSchemaTable, retryCoun
 	return pgSchemaColumns
 }
 
+// Splits the [min, max] range of a column into chunkCount ranges and returns the inner boundaries.
+// Integer ranges are split with numeric math since max - min can overflow, e.g. for int8 keys with both signs
+func (postgres *Postgres) ChunkBoundaries(pgSchemaTable PgSchemaTable, pgSchemaColumn PgSchemaColumn, chunkCount int) []string {
+	boundaryExpression := "bounds.min_value + (bounds.max_value - bounds.min_value) / " + common.IntToString(chunkCount) + " * i"
+	switch pgSchemaColumn.UdtName {
+	case "int2", "int4", "int8":
+		boundaryExpression = "floor(bounds.min_value::numeric + (bounds.max_value::numeric - bounds.min_value::numeric) * i / " + common.IntToString(chunkCount) + ")"
+	}
+
+	rows, err := postgres.PostgresClient.Query(
+		context.Background(),
+		`SELECT (`+boundaryExpression+`)::text
+		FROM (SELECT min("`+pgSchemaColumn.ColumnName+`") AS min_value, max("`+pgSchemaColumn.ColumnName+`") AS max_value FROM `+pgSchemaTable.String()+`) bounds
+		CROSS JOIN generate_series(1, `+common.IntToString(chunkCount-1)+`) AS i
+		WHERE bounds.min_value IS NOT NULL
+		ORDER BY i`,
+	)
+	common.PanicIfError(postgres.Config.CommonConfig, err)
+	defer rows.Close()
+
+	var boundaries []string
+	for rows.Next() {
+		var boundary string
+		err = rows.Scan(&boundary)
+		common.PanicIfError(postgres.Config.CommonConfig, err)
+		boundaries = append(boundaries, boundary)
+	}
+
+	return boundaries
+}
+
+// Row count estimated by the last VACUUM or ANALYZE without scanning the table, or COUNT(*) if the table has never been analyzed
+func (postgres *Postgres) EstimatedRowCount(pgSchemaTable PgSchemaTable) (int64, error) {
+	var rowCount int64
+	err := postgres.PostgresClient.QueryRow(
+		context.Background(),
+		"SELECT reltuples::bigint FROM pg_class WHERE oid = $1::regclass",
+		pgSchemaTable.String(),
+	).Scan(&rowCount)
+	if err != nil || rowCount >= 0 {
+		return rowCount, err
+	}
+
+	err = postgres.PostgresClient.QueryRow(context.Background(), "SELECT COUNT(*) FROM "+pgSchemaTable.String()).Scan(&rowCount)
+	return rowCount, err
+}
+
+// Max value of a timestamp column in seconds since the Unix epoch, 0 if the table is empty
+func (postgres *Postgres) MaxEpochSeconds(pgSchemaTable PgSchemaTable, columnName string) (float64, error) {
+	var maxEpochSeconds float64
+	err := postgres.PostgresClient.QueryRow(
+		context.Background(),
+		`SELECT COALESCE(EXTRACT(EPOCH FROM max("`+columnName+`")), 0)::float8 FROM `+pgSchemaTable.String(),
+	).Scan(&maxEpochSeconds)
+	return maxEpochSeconds, err
+}
+
 func (postgres *Postgres) Reconnect() {
 	if postgres.PostgresClient != nil {
 		postgres.Close()
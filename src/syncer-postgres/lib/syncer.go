@@ -2,6 +2,7 @@ package postgres
 
 import (
 	"net/url"
+	"time"
 
 	"github.com/BemiHQ/BemiDB/src/common"
 )
@@ -50,6 +51,21 @@ func (syncer *Syncer) Sync() {
 	common.SendAnonymousAnalytics(syncer.Config.CommonConfig, "syncer-postgres-finish", syncer.name())
 }
 
+// Compares the source tables with the synced tables every interval until the process is stopped
+func (syncer *Syncer) CheckDrift() {
+	driftChecker := NewDriftChecker(syncer.Config, syncer.StorageS3, syncer.DuckdbClient)
+	interval := time.Duration(syncer.Config.DriftCheckIntervalSeconds) * time.Second
+
+	for {
+		common.LogInfo(syncer.Config.CommonConfig, "Starting drift check...")
+		postgres := NewPostgres(syncer.Config) // A new read-only transaction to see the latest data
+		driftChecker.Check(postgres, syncer.pgSchemaTables(postgres))
+		postgres.Close()
+
+		time.Sleep(interval)
+	}
+}
+
 func (syncer *Syncer) pgSchemaTables(postgres *Postgres) []PgSchemaTable {
 	pgSchemaTables := make([]PgSchemaTable, 0)
 	for _, schema := range postgres.Schemas() {
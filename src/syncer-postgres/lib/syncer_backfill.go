@@ -0,0 +1,212 @@
+package postgres
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+
+	"github.com/BemiHQ/BemiDB/src/common"
+)
+
+const (
+	BACKFILL_STATE_NAME_PREFIX = "backfill:"
+)
+
+var BACKFILL_CHUNK_COLUMN_TYPES = common.NewSet[string]().AddAll([]string{"int2", "int4", "int8", "date", "timestamp", "timestamptz"})
+
+// Progress of a chunked backfill saved in the catalog to resume after a failure
+type BackfillState struct {
+	TableS3Path         string                       `json:"table_s3_path"`
+	ColumnName          string                       `json:"column_name"`
+	Boundaries          []string                     `json:"boundaries"`
+	ParquetFilesByChunk map[int][]common.ParquetFile `json:"parquet_files_by_chunk"`
+}
+
+type SyncerBackfill struct {
+	Config        *Config
+	StorageS3     *common.StorageS3
+	DuckdbClient  *common.DuckdbClient
+	SourceLimiter *common.BandwidthLimiter // optional
+}
+
+func NewSyncerBackfill(config *Config, storageS3 *common.StorageS3, duckdbClient *common.DuckdbClient, sourceLimiter *common.BandwidthLimiter) *SyncerBackfill {
+	return &SyncerBackfill{
+		Config:        config,
+		StorageS3:     storageS3,
+		DuckdbClient:  duckdbClient,
+		SourceLimiter: sourceLimiter,
+	}
+}
+
+// Returns a single-column unique key that can be split into ranges or an empty string
+func (syncer *SyncerBackfill) ChunkColumnName(pgSchemaColumns []PgSchemaColumn) string {
+	var chunkColumn *PgSchemaColumn
+	for i, pgSchemaColumn := range pgSchemaColumns {
+		if !pgSchemaColumn.IsPartOfUniqueIndex {
+			continue
+		}
+		if chunkColumn != nil {
+			return "" // Composite unique key
+		}
+		chunkColumn = &pgSchemaColumns[i]
+	}
+
+	if chunkColumn == nil || chunkColumn.DataType == PG_DATA_TYPE_ARRAY || !BACKFILL_CHUNK_COLUMN_TYPES.Contains(chunkColumn.UdtName) {
+		return ""
+	}
+	return chunkColumn.ColumnName
+}
+
+func (syncer *SyncerBackfill) SyncTable(postgres *Postgres, pgSchemaTable PgSchemaTable, pgSchemaColumns []PgSchemaColumn, chunkColumnName string) {
+	icebergCatalog := common.NewIcebergCatalog(syncer.Config.CommonConfig)
+	stateName := BACKFILL_STATE_NAME_PREFIX + pgSchemaTable.ToConfigArg()
+
+	icebergSchemaTable := common.IcebergSchemaTable{Schema: syncer.Config.DestinationSchemaName, Table: pgSchemaTable.IcebergTableName()}
+	icebergTable := common.NewIcebergTable(syncer.Config.CommonConfig, syncer.StorageS3, syncer.DuckdbClient, icebergSchemaTable)
+	icebergSchemaColumns := make([]*common.IcebergSchemaColumn, len(pgSchemaColumns))
+	for i, pgSchemaColumn := range pgSchemaColumns {
+		icebergSchemaColumns[i] = pgSchemaColumn.ToIcebergSchemaColumn()
+	}
+
+	state := syncer.loadState(icebergCatalog, stateName, chunkColumnName)
+	if state == nil {
+		var chunkColumn PgSchemaColumn
+		for _, pgSchemaColumn := range pgSchemaColumns {
+			if pgSchemaColumn.ColumnName == chunkColumnName {
+				chunkColumn = pgSchemaColumn
+			}
+		}
+
+		syncingIcebergSchemaTable := common.IcebergSchemaTable{Schema: icebergSchemaTable.Schema, Table: icebergSchemaTable.Table + common.TEMP_TABLE_SUFFIX_SYNCING}
+		state = &BackfillState{
+			TableS3Path:         common.NewIcebergTable(syncer.Config.CommonConfig, syncer.StorageS3, syncer.DuckdbClient, syncingIcebergSchemaTable).GenerateTableS3Path(),
+			ColumnName:          chunkColumnName,
+			Boundaries:          postgres.ChunkBoundaries(pgSchemaTable, chunkColumn, syncer.Config.BackfillChunkCount),
+			ParquetFilesByChunk: make(map[int][]common.ParquetFile),
+		}
+		syncer.saveState(icebergCatalog, stateName, state)
+	} else {
+		common.LogInfo(syncer.Config.CommonConfig, "Resuming backfill with", len(state.ParquetFilesByChunk), "completed chunks")
+	}
+
+	// Extract chunks in parallel
+	chunkCount := len(state.Boundaries) + 1
+	var stateMutex sync.Mutex
+	var waitGroup sync.WaitGroup
+	semaphore := make(chan struct{}, syncer.Config.BackfillParallelism)
+	for chunkIndex := 0; chunkIndex < chunkCount; chunkIndex++ {
+		stateMutex.Lock()
+		_, completed := state.ParquetFilesByChunk[chunkIndex]
+		stateMutex.Unlock()
+		if completed {
+			continue
+		}
+
+		waitGroup.Add(1)
+		semaphore <- struct{}{}
+		go func() {
+			defer func() {
+				<-semaphore
+				waitGroup.Done()
+			}()
+
+			parquetFiles := syncer.syncChunk(pgSchemaTable, icebergTable, icebergSchemaColumns, state, chunkIndex)
+
+			stateMutex.Lock()
+			defer stateMutex.Unlock()
+			state.ParquetFilesByChunk[chunkIndex] = parquetFiles
+			syncer.saveState(icebergCatalog, stateName, state)
+		}()
+	}
+	waitGroup.Wait()
+
+	// Merge chunks into the table
+	parquetFiles := []common.ParquetFile{}
+	stateMutex.Lock()
+	for chunkIndex := 0; chunkIndex < chunkCount; chunkIndex++ {
+		parquetFiles = append(parquetFiles, state.ParquetFilesByChunk[chunkIndex]...)
+	}
+	stateMutex.Unlock()
+	icebergTable.ReplaceWith(func(syncingIcebergTable *common.IcebergTable) {
+		icebergTableWriter := common.NewIcebergTableWriter(syncer.Config.CommonConfig, syncer.StorageS3, syncer.DuckdbClient, syncingIcebergTable, icebergSchemaColumns, 1)
+		icebergTableWriter.ApplyColumnOverrides(syncer.Config.ColumnOverridesByTableName[pgSchemaTable.ToConfigArg()])
+		icebergTableWriter.CreateFromParquetFiles(state.TableS3Path, parquetFiles)
+	})
+
+	icebergCatalog.DeleteSyncerState(syncer.Config.DestinationSchemaName, stateName)
+}
+
+func (syncer *SyncerBackfill) syncChunk(pgSchemaTable PgSchemaTable, icebergTable *common.IcebergTable, icebergSchemaColumns []*common.IcebergSchemaColumn, state *BackfillState, chunkIndex int) []common.ParquetFile {
+	whereClause := syncer.chunkWhereClause(state, chunkIndex)
+	common.LogInfo(syncer.Config.CommonConfig, "Syncing chunk", common.IntToString(chunkIndex+1)+"/"+common.IntToString(len(state.Boundaries)+1), "of table", pgSchemaTable.String(), whereClause)
+
+	postgres := NewPostgres(syncer.Config)
+	defer postgres.Close()
+
+	cappedBuffer := common.NewCappedBuffer(syncer.Config.CommonConfig, common.DEFAULT_CAPPED_BUFFER_SIZE)
+
+	// Copy from PG to cappedBuffer in a separate goroutine in parallel
+	go func() {
+		copySql := "COPY (SELECT * FROM " + pgSchemaTable.String() + whereClause + ") TO STDOUT WITH CSV HEADER NULL '" + common.BEMIDB_NULL_STRING + "'"
+		result, err := postgres.PostgresClient.Copy(copyWriter(cappedBuffer, syncer.SourceLimiter), copySql)
+		common.PanicIfError(syncer.Config.CommonConfig, err)
+
+		common.LogInfo(syncer.Config.CommonConfig, "Copied", result.RowsAffected(), "rows from", pgSchemaTable.String(), whereClause)
+		cappedBuffer.Close()
+	}()
+
+	icebergTableWriter := common.NewIcebergTableWriter(syncer.Config.CommonConfig, syncer.StorageS3, syncer.DuckdbClient, icebergTable, icebergSchemaColumns, 1)
+	icebergTableWriter.ApplyColumnOverrides(syncer.Config.ColumnOverridesByTableName[pgSchemaTable.ToConfigArg()])
+	return icebergTableWriter.WriteParquetFilesFromCsvCappedBuffer(state.TableS3Path+"/data", cappedBuffer)
+}
+
+// [NULL, b1), [b1, b2), ..., [bN, +inf)
+func (syncer *SyncerBackfill) chunkWhereClause(state *BackfillState, chunkIndex int) string {
+	if len(state.Boundaries) == 0 {
+		return ""
+	}
+
+	quotedColumnName := `"` + state.ColumnName + `"`
+	conditions := []string{}
+	if chunkIndex > 0 {
+		conditions = append(conditions, quotedColumnName+" >= "+syncer.quoteLiteral(state.Boundaries[chunkIndex-1]))
+	}
+	if chunkIndex < len(state.Boundaries) {
+		conditions = append(conditions, quotedColumnName+" < "+syncer.quoteLiteral(state.Boundaries[chunkIndex]))
+	}
+
+	whereClause := strings.Join(conditions, " AND ")
+	if chunkIndex == 0 {
+		whereClause = "(" + whereClause + " OR " + quotedColumnName + " IS NULL)"
+	}
+	return " WHERE " + whereClause
+}
+
+func (syncer *SyncerBackfill) quoteLiteral(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
+
+func (syncer *SyncerBackfill) loadState(icebergCatalog *common.IcebergCatalog, stateName string, chunkColumnName string) *BackfillState {
+	stateJson := icebergCatalog.SyncerState(syncer.Config.DestinationSchemaName, stateName)
+	if stateJson == nil {
+		return nil
+	}
+
+	var state BackfillState
+	err := json.Unmarshal(stateJson, &state)
+	common.PanicIfError(syncer.Config.CommonConfig, err)
+
+	// An empty table has no boundaries and is a single chunk with any chunk count
+	if state.ColumnName != chunkColumnName || (len(state.Boundaries) > 0 && len(state.Boundaries)+1 != syncer.Config.BackfillChunkCount) {
+		common.LogWarn(syncer.Config.CommonConfig, "Discarding backfill progress created with different settings")
+		return nil
+	}
+	return &state
+}
+
+func (syncer *SyncerBackfill) saveState(icebergCatalog *common.IcebergCatalog, stateName string, state *BackfillState) {
+	stateJson, err := json.Marshal(state)
+	common.PanicIfError(syncer.Config.CommonConfig, err)
+
+	icebergCatalog.UpsertSyncerState(syncer.Config.DestinationSchemaName, stateName, stateJson)
+}
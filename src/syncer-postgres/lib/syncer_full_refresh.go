@@ -1,41 +1,91 @@
 package postgres
 
 import (
+	"io"
+	"sync"
+	"time"
+
 	"github.com/BemiHQ/BemiDB/src/common"
 )
 
 type SyncerFullRefresh struct {
-	Config       *Config
-	Utils        *SyncerUtils
-	StorageS3    *common.StorageS3
-	DuckdbClient *common.DuckdbClient
+	Config        *Config
+	Utils         *SyncerUtils
+	StorageS3     *common.StorageS3
+	DuckdbClient  *common.DuckdbClient
+	SourceLimiter *common.BandwidthLimiter // optional
 }
 
 func NewSyncerFullRefresh(config *Config, utils *SyncerUtils, storageS3 *common.StorageS3, duckdbClient *common.DuckdbClient) *SyncerFullRefresh {
-	return &SyncerFullRefresh{
+	syncer := &SyncerFullRefresh{
 		Config:       config,
 		Utils:        utils,
 		StorageS3:    storageS3,
 		DuckdbClient: duckdbClient,
 	}
+	if config.MaxBytesPerSecond > 0 {
+		syncer.SourceLimiter = common.NewBandwidthLimiter(config.MaxBytesPerSecond)
+	}
+	return syncer
 }
 
 func (syncer *SyncerFullRefresh) Sync(postgres *Postgres, pgSchemaTables []PgSchemaTable) {
 	icebergTableNames := common.NewSet[string]()
 
-	for _, pgSchemaTable := range pgSchemaTables {
-		pgSchemaColumns := postgres.PgSchemaColumns(pgSchemaTable)
+	if syncer.Config.MaxConcurrentTables <= 1 {
+		for _, pgSchemaTable := range pgSchemaTables {
+			syncer.syncTableWithColumns(postgres, pgSchemaTable)
+			icebergTableNames.Add(pgSchemaTable.IcebergTableName())
+		}
+	} else {
+		var waitGroup sync.WaitGroup
+		var mutex sync.Mutex
+		semaphore := make(chan struct{}, syncer.Config.MaxConcurrentTables)
+
+		for _, pgSchemaTable := range pgSchemaTables {
+			waitGroup.Add(1)
+			semaphore <- struct{}{}
+			go func() {
+				defer waitGroup.Done()
+				defer func() { <-semaphore }()
 
-		common.LogInfo(syncer.Config.CommonConfig, "Syncing table:", pgSchemaTable.String()+"...")
-		syncer.syncTable(postgres, pgSchemaTable, pgSchemaColumns)
+				// Each table uses its own connection since COPY occupies the connection until it's finished
+				tablePostgres := NewPostgres(syncer.Config)
+				defer tablePostgres.Close()
+				syncer.syncTableWithColumns(tablePostgres, pgSchemaTable)
 
-		icebergTableNames.Add(pgSchemaTable.IcebergTableName())
+				mutex.Lock()
+				icebergTableNames.Add(pgSchemaTable.IcebergTableName())
+				mutex.Unlock()
+			}()
+		}
+		waitGroup.Wait()
 	}
 
 	syncer.Utils.DeleteOldTables(icebergTableNames)
+	syncer.Utils.ReplaceTablePartitions(pgSchemaTables, icebergTableNames)
+}
+
+func (syncer *SyncerFullRefresh) syncTableWithColumns(postgres *Postgres, pgSchemaTable PgSchemaTable) {
+	pgSchemaColumns := postgres.PgSchemaColumns(pgSchemaTable)
+
+	common.LogInfo(syncer.Config.CommonConfig, "Syncing table:", pgSchemaTable.String()+"...")
+	syncer.syncTable(postgres, pgSchemaTable, pgSchemaColumns)
 }
 
 func (syncer *SyncerFullRefresh) syncTable(postgres *Postgres, pgSchemaTable PgSchemaTable, pgSchemaColumns []PgSchemaColumn) {
+	keepHistory := syncer.Config.HistoryTables.Contains(pgSchemaTable.ToConfigArg())
+
+	if syncer.Config.BackfillChunkCount > 1 && !keepHistory {
+		syncerBackfill := NewSyncerBackfill(syncer.Config, syncer.StorageS3, syncer.DuckdbClient, syncer.SourceLimiter)
+		chunkColumnName := syncerBackfill.ChunkColumnName(pgSchemaColumns)
+		if chunkColumnName != "" {
+			syncerBackfill.SyncTable(postgres, pgSchemaTable, pgSchemaColumns, chunkColumnName)
+			return
+		}
+		common.LogInfo(syncer.Config.CommonConfig, "No single-column integer or timestamp unique key found for chunking table", pgSchemaTable.String())
+	}
+
 	// Create a capped buffer read and written in parallel
 	cappedBuffer := common.NewCappedBuffer(syncer.Config.CommonConfig, common.DEFAULT_CAPPED_BUFFER_SIZE)
 
@@ -45,7 +95,11 @@ func (syncer *SyncerFullRefresh) syncTable(postgres *Postgres, pgSchemaTable PgS
 	}()
 
 	// Read from cappedBuffer and write to Iceberg
-	syncer.writeToIceberg(pgSchemaTable, pgSchemaColumns, cappedBuffer)
+	if keepHistory {
+		syncer.writeHistoryToIceberg(pgSchemaTable, pgSchemaColumns, cappedBuffer)
+	} else {
+		syncer.writeToIceberg(pgSchemaTable, pgSchemaColumns, cappedBuffer)
+	}
 }
 
 func (syncer *SyncerFullRefresh) writeToIceberg(pgSchemaTable PgSchemaTable, pgSchemaColumns []PgSchemaColumn, cappedBuffer *common.CappedBuffer) {
@@ -58,15 +112,53 @@ func (syncer *SyncerFullRefresh) writeToIceberg(pgSchemaTable PgSchemaTable, pgS
 			icebergSchemaColumns[i] = pgSchemaColumn.ToIcebergSchemaColumn()
 		}
 		icebergTableWriter := common.NewIcebergTableWriter(syncer.Config.CommonConfig, syncer.StorageS3, syncer.DuckdbClient, syncingIcebergTable, icebergSchemaColumns, 1)
+		icebergTableWriter.ApplyColumnOverrides(syncer.Config.ColumnOverridesByTableName[pgSchemaTable.ToConfigArg()])
 		icebergTableWriter.InsertFromCsvCappedBuffer(cappedBuffer)
 	})
 }
 
+// Closes changed and deleted rows with valid_to and inserts their new versions with valid_from (SCD Type 2).
+// The table is only recreated when history starts or columns change
+func (syncer *SyncerFullRefresh) writeHistoryToIceberg(pgSchemaTable PgSchemaTable, pgSchemaColumns []PgSchemaColumn, cappedBuffer *common.CappedBuffer) {
+	icebergSchemaTable := common.IcebergSchemaTable{Schema: syncer.Config.DestinationSchemaName, Table: pgSchemaTable.IcebergTableName()}
+	icebergTable := common.NewIcebergTable(syncer.Config.CommonConfig, syncer.StorageS3, syncer.DuckdbClient, icebergSchemaTable)
+	syncedAt := time.Now()
+
+	icebergTableWriter := syncer.newHistoryIcebergTableWriter(icebergTable, pgSchemaTable, pgSchemaColumns)
+	if icebergTableWriter.CanMergeHistory() {
+		icebergTableWriter.MergeHistoryFromCsvCappedBuffer(syncedAt, cappedBuffer)
+		return
+	}
+
+	icebergTable.ReplaceWith(func(syncingIcebergTable *common.IcebergTable) {
+		icebergTableWriter := syncer.newHistoryIcebergTableWriter(syncingIcebergTable, pgSchemaTable, pgSchemaColumns)
+		icebergTableWriter.InsertHistoryFromCsvCappedBuffer(icebergTable, syncedAt, cappedBuffer)
+	})
+}
+
+func (syncer *SyncerFullRefresh) newHistoryIcebergTableWriter(icebergTable *common.IcebergTable, pgSchemaTable PgSchemaTable, pgSchemaColumns []PgSchemaColumn) *common.IcebergTableWriter {
+	icebergSchemaColumns := make([]*common.IcebergSchemaColumn, len(pgSchemaColumns))
+	for i, pgSchemaColumn := range pgSchemaColumns {
+		icebergSchemaColumns[i] = pgSchemaColumn.ToIcebergSchemaColumn()
+	}
+	icebergTableWriter := common.NewIcebergTableWriter(syncer.Config.CommonConfig, syncer.StorageS3, syncer.DuckdbClient, icebergTable, icebergSchemaColumns, 1)
+	icebergTableWriter.ApplyColumnOverrides(syncer.Config.ColumnOverridesByTableName[pgSchemaTable.ToConfigArg()])
+	return icebergTableWriter
+}
+
 func (syncer *SyncerFullRefresh) copyFromPgTable(postgres *Postgres, pgSchemaTable PgSchemaTable, cappedBuffer *common.CappedBuffer) {
 	copySql := "COPY (SELECT * FROM " + pgSchemaTable.String() + ") TO STDOUT WITH CSV HEADER NULL '" + common.BEMIDB_NULL_STRING + "'"
-	result, err := postgres.PostgresClient.Copy(cappedBuffer, copySql)
+	result, err := postgres.PostgresClient.Copy(copyWriter(cappedBuffer, syncer.SourceLimiter), copySql)
 	common.PanicIfError(syncer.Config.CommonConfig, err)
 
 	common.LogInfo(syncer.Config.CommonConfig, "Copied", result.RowsAffected(), "rows from", pgSchemaTable.String())
 	cappedBuffer.Close()
 }
+
+// Throttles reading from PostgreSQL if the source limiter is configured
+func copyWriter(cappedBuffer *common.CappedBuffer, sourceLimiter *common.BandwidthLimiter) io.Writer {
+	if sourceLimiter == nil {
+		return cappedBuffer
+	}
+	return common.NewThrottledWriter(cappedBuffer, sourceLimiter)
+}
@@ -1,6 +1,8 @@
 package postgres
 
 import (
+	"strings"
+
 	"github.com/BemiHQ/BemiDB/src/common"
 )
 
@@ -38,6 +40,9 @@ func (utils *SyncerUtils) DeleteOldTables(keepIcebergTableNames common.Set[strin
 		if keepIcebergTableNames.Contains(icebergTableName) {
 			continue
 		}
+		if keepIcebergTableNames.Contains(strings.TrimSuffix(icebergTableName, common.REJECTS_TABLE_SUFFIX)) {
+			continue
+		}
 
 		common.LogInfo(utils.Config.CommonConfig, "Deleting old Iceberg table: "+icebergTableName)
 		icebergSchemaTable := common.IcebergSchemaTable{Schema: utils.Config.DestinationSchemaName, Table: icebergTableName}
@@ -45,3 +50,19 @@ func (utils *SyncerUtils) DeleteOldTables(keepIcebergTableNames common.Set[strin
 		icebergTable.DropIfExists()
 	}
 }
+
+// Registers the synced partitions of partitioned tables, so the server reads them as one table with the name of the partitioned table
+func (utils *SyncerUtils) ReplaceTablePartitions(pgSchemaTables []PgSchemaTable, syncedIcebergTableNames common.Set[string]) {
+	partitionedTableNames := make(map[string]string)
+	for _, pgSchemaTable := range pgSchemaTables {
+		// Skip tables that aren't partitions and children of synced tables with inheritance
+		if pgSchemaTable.ParentPartitionedTable == "" || syncedIcebergTableNames.Contains(pgSchemaTable.IcebergParentPartitionedTableName()) {
+			continue
+		}
+		partitionedTableNames[pgSchemaTable.IcebergTableName()] = pgSchemaTable.IcebergParentPartitionedTableName()
+	}
+
+	icebergCatalog := common.NewIcebergCatalog(utils.Config.CommonConfig)
+	err := icebergCatalog.ReplaceTablePartitions(utils.Config.DestinationSchemaName, partitionedTableNames)
+	common.PanicIfError(utils.Config.CommonConfig, err)
+}
@@ -14,5 +14,9 @@ func main() {
 	defer common.HandleUnexpectedPanic(config.CommonConfig)
 
 	syncer := postgres.NewSyncer(config)
+	if config.DriftCheckIntervalSeconds > 0 {
+		syncer.CheckDrift()
+		return
+	}
 	syncer.Sync()
 }
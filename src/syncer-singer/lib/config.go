@@ -0,0 +1,117 @@
+package singer
+
+import (
+	"flag"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/BemiHQ/BemiDB/src/common"
+)
+
+type Protocol string
+
+const (
+	ProtocolSinger  Protocol = "SINGER"
+	ProtocolAirbyte Protocol = "AIRBYTE"
+
+	ENV_DESTINATION_SCHEMA_NAME = "DESTINATION_SCHEMA_NAME"
+
+	ENV_COMMAND      = "SOURCE_SINGER_COMMAND"
+	ENV_PROTOCOL     = "SOURCE_SINGER_PROTOCOL"
+	ENV_CATALOG_PATH = "SOURCE_SINGER_CATALOG_PATH" // Airbyte configured catalog
+	ENV_STATE_NAME   = "SOURCE_SINGER_STATE_NAME"
+
+	DEFAULT_STATE_NAME = "singer"
+)
+
+type Config struct {
+	CommonConfig          *common.CommonConfig
+	DestinationSchemaName string
+	Command               string
+	Protocol              Protocol
+	CatalogPath           string // Airbyte configured catalog
+	StateName             string
+}
+
+var _config Config
+
+func RegisterFlags() {
+	_config.CommonConfig = &common.CommonConfig{}
+
+	flag.StringVar(&_config.CommonConfig.LogLevel, "log-level", os.Getenv(common.ENV_LOG_LEVEL), `Log level: "ERROR", "WARN", "INFO", "DEBUG", "TRACE". Default: "`+common.DEFAULT_LOG_LEVEL+`"`)
+	flag.StringVar(&_config.CommonConfig.CatalogDatabaseUrl, "catalog-database-url", os.Getenv(common.ENV_CATALOG_DATABASE_URL), "Catalog database URL")
+	flag.StringVar(&_config.CommonConfig.Aws.Region, "aws-region", os.Getenv(common.ENV_AWS_REGION), "AWS region")
+	flag.StringVar(&_config.CommonConfig.Aws.S3Endpoint, "aws-s3-endpoint", os.Getenv(common.ENV_AWS_S3_ENDPOINT), "AWS S3 endpoint. Default: \""+common.DEFAULT_AWS_S3_ENDPOINT+`"`)
+	flag.StringVar(&_config.CommonConfig.Aws.S3Bucket, "aws-s3-bucket", os.Getenv(common.ENV_AWS_S3_BUCKET), "AWS S3 bucket name")
+	flag.StringVar(&_config.CommonConfig.Aws.AccessKeyId, "aws-access-key-id", os.Getenv(common.ENV_AWS_ACCESS_KEY_ID), "AWS access key ID")
+	flag.StringVar(&_config.CommonConfig.Aws.SecretAccessKey, "aws-secret-access-key", os.Getenv(common.ENV_AWS_SECRET_ACCESS_KEY), "AWS secret access key")
+	flag.StringVar(&_config.CommonConfig.Aws.ServerSideEncryption, "aws-s3-server-side-encryption", os.Getenv(common.ENV_AWS_S3_SERVER_SIDE_ENCRYPTION), `Server-side encryption of written S3 objects: "`+common.AWS_S3_SSE_S3+`" (SSE-S3) or "`+common.AWS_S3_SSE_KMS+`" (SSE-KMS). Default: none`)
+	flag.StringVar(&_config.CommonConfig.Aws.KmsKeyId, "aws-s3-kms-key-id", os.Getenv(common.ENV_AWS_S3_KMS_KEY_ID), "KMS key ID or ARN for SSE-KMS")
+	common.RegisterAwsS3MaxUploadFlag(&_config.CommonConfig.Aws)
+	flag.BoolVar(&_config.CommonConfig.DisableAnonymousAnalytics, "disable-anonymous-analytics", os.Getenv(common.ENV_DISABLE_ANONYMOUS_ANALYTICS) == "true", "Disable anonymous analytics collection")
+
+	flag.StringVar(&_config.DestinationSchemaName, "destination-schema-name", os.Getenv(ENV_DESTINATION_SCHEMA_NAME), "Destination schema name to store the synced data")
+	flag.StringVar(&_config.Command, "command", os.Getenv(ENV_COMMAND), `Command that runs a Singer tap or an Airbyte source "read", e.g. "tap-github --config config.json". "{state}" is replaced with the state file path, otherwise "--state [PATH]" is appended`)
+	flag.StringVar((*string)(&_config.Protocol), "protocol", os.Getenv(ENV_PROTOCOL), `Protocol: "SINGER" or "AIRBYTE". Default: "SINGER"`)
+	flag.StringVar(&_config.CatalogPath, "catalog-path", os.Getenv(ENV_CATALOG_PATH), "Path to the Airbyte configured catalog JSON file used to read stream schemas")
+	flag.StringVar(&_config.StateName, "state-name", os.Getenv(ENV_STATE_NAME), `Name used to store the state in the catalog. Default: "`+DEFAULT_STATE_NAME+`"`)
+}
+
+func LoadConfig() *Config {
+	parseFlags()
+	return &_config
+}
+
+func parseFlags() {
+	flag.Parse()
+
+	if _config.CommonConfig.LogLevel == "" {
+		_config.CommonConfig.LogLevel = common.DEFAULT_LOG_LEVEL
+	} else if !slices.Contains(common.LOG_LEVELS, _config.CommonConfig.LogLevel) {
+		panic("Invalid log level " + _config.CommonConfig.LogLevel + ". Must be one of " + strings.Join(common.LOG_LEVELS, ", "))
+	}
+	if _config.CommonConfig.CatalogDatabaseUrl == "" {
+		panic("Catalog database URL is required")
+	}
+	if _config.CommonConfig.Aws.Region == "" {
+		panic("AWS region is required")
+	}
+	if _config.CommonConfig.Aws.S3Endpoint == "" {
+		_config.CommonConfig.Aws.S3Endpoint = common.DEFAULT_AWS_S3_ENDPOINT
+	}
+	if _config.CommonConfig.Aws.S3Bucket == "" {
+		panic("AWS S3 bucket name is required")
+	}
+	if _config.CommonConfig.Aws.AccessKeyId != "" && _config.CommonConfig.Aws.SecretAccessKey == "" {
+		panic("AWS secret access key is required")
+	}
+	if _config.CommonConfig.Aws.AccessKeyId == "" && _config.CommonConfig.Aws.SecretAccessKey != "" {
+		panic("AWS access key ID is required")
+	}
+	if _config.CommonConfig.Aws.ServerSideEncryption != "" && _config.CommonConfig.Aws.ServerSideEncryption != common.AWS_S3_SSE_S3 && _config.CommonConfig.Aws.ServerSideEncryption != common.AWS_S3_SSE_KMS {
+		panic("AWS S3 server-side encryption must be \"" + common.AWS_S3_SSE_S3 + "\" or \"" + common.AWS_S3_SSE_KMS + "\"")
+	}
+	if (_config.CommonConfig.Aws.KmsKeyId != "") != (_config.CommonConfig.Aws.ServerSideEncryption == common.AWS_S3_SSE_KMS) {
+		panic("AWS S3 KMS key ID is required for and only used with \"" + common.AWS_S3_SSE_KMS + "\" server-side encryption")
+	}
+	common.ValidateAwsS3MaxUpload(_config.CommonConfig.Aws)
+
+	if _config.DestinationSchemaName == "" {
+		panic("Destination schema name is required")
+	}
+	if _config.Command == "" {
+		panic("Singer tap or Airbyte source command is required")
+	}
+	if _config.Protocol == "" {
+		_config.Protocol = ProtocolSinger
+	} else if _config.Protocol != ProtocolSinger && _config.Protocol != ProtocolAirbyte {
+		panic("Invalid protocol " + string(_config.Protocol) + ". Must be one of SINGER or AIRBYTE")
+	}
+	if _config.Protocol == ProtocolAirbyte && _config.CatalogPath == "" {
+		panic("Airbyte configured catalog path is required")
+	}
+	if _config.StateName == "" {
+		_config.StateName = DEFAULT_STATE_NAME
+	}
+}
@@ -0,0 +1,131 @@
+package singer
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/BemiHQ/BemiDB/src/common"
+)
+
+const (
+	JSON_SCHEMA_TYPE_NULL = "null"
+)
+
+type JsonSchema struct {
+	Type       interface{}           `json:"type"` // "string" or ["null", "string"]
+	Format     string                `json:"format"`
+	AnyOf      []JsonSchema          `json:"anyOf"`
+	Properties map[string]JsonSchema `json:"properties"`
+}
+
+// Returns the first non-null type with its format and whether the value can be null
+func (schema JsonSchema) PrimitiveType() (primitiveType string, format string, nullable bool) {
+	switch schemaType := schema.Type.(type) {
+	case string:
+		return schemaType, schema.Format, schemaType == JSON_SCHEMA_TYPE_NULL
+	case []interface{}:
+		for _, item := range schemaType {
+			if item == JSON_SCHEMA_TYPE_NULL {
+				nullable = true
+			} else if primitiveType == "" {
+				primitiveType = item.(string)
+			}
+		}
+		return primitiveType, schema.Format, nullable
+	}
+
+	for _, anyOfSchema := range schema.AnyOf {
+		anyOfPrimitiveType, anyOfFormat, _ := anyOfSchema.PrimitiveType()
+		if anyOfPrimitiveType != "" && anyOfPrimitiveType != JSON_SCHEMA_TYPE_NULL {
+			return anyOfPrimitiveType, anyOfFormat, true
+		}
+	}
+	return "", "", true
+}
+
+// ---------------------------------------------------------------------------------------------------------------------
+
+type Stream struct {
+	Name          string
+	Schema        JsonSchema
+	KeyProperties []string
+	Incremental   bool
+}
+
+func (stream *Stream) IcebergSchemaColumns(config *common.CommonConfig) []*common.IcebergSchemaColumn {
+	columnNames := make([]string, 0, len(stream.Schema.Properties))
+	for columnName := range stream.Schema.Properties {
+		columnNames = append(columnNames, columnName)
+	}
+	sort.Strings(columnNames)
+
+	keyProperties := common.NewSet[string]().AddAll(stream.KeyProperties)
+	icebergSchemaColumns := make([]*common.IcebergSchemaColumn, len(columnNames))
+	for i, columnName := range columnNames {
+		columnSchema := stream.Schema.Properties[columnName]
+		primitiveType, format, nullable := columnSchema.PrimitiveType()
+
+		icebergSchemaColumn := &common.IcebergSchemaColumn{
+			Config:              config,
+			ColumnName:          columnName,
+			Position:            i + 1,
+			IsRequired:          !nullable && primitiveType != "",
+			IsPartOfUniqueIndex: keyProperties.Contains(columnName),
+		}
+
+		switch primitiveType {
+		case "boolean":
+			icebergSchemaColumn.ColumnType = common.IcebergColumnTypeBoolean
+		case "integer":
+			icebergSchemaColumn.ColumnType = common.IcebergColumnTypeLong
+		case "number":
+			icebergSchemaColumn.ColumnType = common.IcebergColumnTypeDouble
+		case "string":
+			switch format {
+			case "date-time":
+				icebergSchemaColumn.ColumnType = common.IcebergColumnTypeTimestamp
+				icebergSchemaColumn.DatetimePrecision = 6
+			case "date":
+				icebergSchemaColumn.ColumnType = common.IcebergColumnTypeDate
+			default:
+				icebergSchemaColumn.ColumnType = common.IcebergColumnTypeString
+			}
+		default: // object, array, or unknown
+			icebergSchemaColumn.ColumnType = common.IcebergColumnTypeString
+			icebergSchemaColumn.LogicalColumnType = common.IcebergLogicalColumnTypeJson
+		}
+
+		icebergSchemaColumns[i] = icebergSchemaColumn
+	}
+
+	return icebergSchemaColumns
+}
+
+// Returns the key properties' values of a record as a JSON array to identify its versions
+func (stream *Stream) RecordKey(record map[string]interface{}) string {
+	keyValues := make([]interface{}, len(stream.KeyProperties))
+	for i, keyProperty := range stream.KeyProperties {
+		keyValues[i] = record[keyProperty]
+	}
+	keyJson, _ := json.Marshal(keyValues) // Decoded JSON values can always be encoded
+	return string(keyJson)
+}
+
+// Keeps only the schema columns in a record and serializes nested JSON values
+func (stream *Stream) NormalizeRecord(record map[string]interface{}, icebergSchemaColumns []*common.IcebergSchemaColumn) (map[string]interface{}, error) {
+	normalizedRecord := make(map[string]interface{}, len(icebergSchemaColumns))
+	for _, icebergSchemaColumn := range icebergSchemaColumns {
+		value := record[icebergSchemaColumn.ColumnName]
+
+		if value != nil && icebergSchemaColumn.LogicalColumnType == common.IcebergLogicalColumnTypeJson {
+			jsonBytes, err := json.Marshal(value)
+			if err != nil {
+				return nil, err
+			}
+			value = string(jsonBytes)
+		}
+
+		normalizedRecord[icebergSchemaColumn.ColumnName] = value
+	}
+	return normalizedRecord, nil
+}
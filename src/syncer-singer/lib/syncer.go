@@ -0,0 +1,157 @@
+package singer
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/BemiHQ/BemiDB/src/common"
+)
+
+const (
+	COMPRESSION_FACTOR = 1
+)
+
+type Syncer struct {
+	Config       *Config
+	StorageS3    *common.StorageS3
+	DuckdbClient *common.DuckdbClient
+}
+
+func NewSyncer(config *Config, storageS3 *common.StorageS3, duckdbClient *common.DuckdbClient) *Syncer {
+	return &Syncer{
+		Config:       config,
+		StorageS3:    storageS3,
+		DuckdbClient: duckdbClient,
+	}
+}
+
+func (syncer *Syncer) Sync() {
+	common.SendAnonymousAnalytics(syncer.Config.CommonConfig, "syncer-singer-start", string(syncer.Config.Protocol))
+
+	icebergCatalog := common.NewIcebergCatalog(syncer.Config.CommonConfig)
+	state := icebergCatalog.SyncerState(syncer.Config.DestinationSchemaName, syncer.Config.StateName)
+	if state != nil {
+		common.LogInfo(syncer.Config.CommonConfig, "Resuming from the saved state:", string(state))
+	}
+
+	tap := NewTap(syncer.Config)
+	defer tap.Close()
+
+	err := tap.Run(state)
+	common.PanicIfError(syncer.Config.CommonConfig, err)
+
+	// Include the streams without records to create their tables
+	streamNames := make([]string, 0, len(tap.StreamByName))
+	for streamName := range tap.StreamByName {
+		streamNames = append(streamNames, streamName)
+	}
+	sort.Strings(streamNames)
+
+	for _, streamName := range streamNames {
+		stream := tap.StreamByName[streamName]
+		common.LogInfo(syncer.Config.CommonConfig, "Syncing stream:", streamName, "("+common.IntToString(tap.RecordCountByName[streamName])+" records)...")
+		syncer.syncStream(stream, tap.RecordsFileByName[streamName])
+	}
+
+	// Save the state only after all records have been written
+	newState, err := tap.State()
+	common.PanicIfError(syncer.Config.CommonConfig, err)
+	if newState != nil {
+		icebergCatalog.UpsertSyncerState(syncer.Config.DestinationSchemaName, syncer.Config.StateName, newState)
+	}
+
+	common.SendAnonymousAnalytics(syncer.Config.CommonConfig, "syncer-singer-finish", string(syncer.Config.Protocol))
+}
+
+// Replaces the table with all records or, for incremental streams, upserts records emitted after the saved state by key properties
+func (syncer *Syncer) syncStream(stream *Stream, recordsFile *os.File) {
+	icebergSchemaTable := common.IcebergSchemaTable{Schema: syncer.Config.DestinationSchemaName, Table: stream.Name}
+	icebergTable := common.NewIcebergTable(syncer.Config.CommonConfig, syncer.StorageS3, syncer.DuckdbClient, icebergSchemaTable)
+	icebergSchemaColumns := stream.IcebergSchemaColumns(syncer.Config.CommonConfig)
+
+	// Keep only the last record emitted for each key
+	var lastRecordIndexByKey map[string]int
+	if len(stream.KeyProperties) > 0 {
+		lastRecordIndexByKey = syncer.lastRecordIndexByKey(stream, recordsFile)
+	}
+
+	if stream.Incremental {
+		icebergTableWriter := common.NewIcebergTableWriter(syncer.Config.CommonConfig, syncer.StorageS3, syncer.DuckdbClient, icebergTable, icebergSchemaColumns, COMPRESSION_FACTOR)
+
+		// Delete the previously synced versions of the records before appending them
+		if lastRecordIndexByKey != nil && icebergTable.MetadataFileS3Path() != "" {
+			cappedBuffer := syncer.readToCappedBuffer(stream, icebergSchemaColumns, recordsFile, lastRecordIndexByKey)
+			icebergTableWriter.DeleteFromJsonCappedBuffer(cappedBuffer)
+		}
+
+		cappedBuffer := syncer.readToCappedBuffer(stream, icebergSchemaColumns, recordsFile, lastRecordIndexByKey)
+		icebergTableWriter.AppendFromJsonCappedBuffer(common.CursorValue{}, cappedBuffer)
+		return
+	}
+
+	icebergTable.ReplaceWith(func(syncingIcebergTable *common.IcebergTable) {
+		cappedBuffer := syncer.readToCappedBuffer(stream, icebergSchemaColumns, recordsFile, lastRecordIndexByKey)
+		icebergTableWriter := common.NewIcebergTableWriter(syncer.Config.CommonConfig, syncer.StorageS3, syncer.DuckdbClient, syncingIcebergTable, icebergSchemaColumns, COMPRESSION_FACTOR)
+		icebergTableWriter.InsertFromJsonCappedBuffer(cappedBuffer)
+	})
+}
+
+// Copies the spooled records from the start, skipping the records overridden by a later record with the same key if lastRecordIndexByKey is set
+func (syncer *Syncer) readToCappedBuffer(stream *Stream, icebergSchemaColumns []*common.IcebergSchemaColumn, recordsFile *os.File, lastRecordIndexByKey map[string]int) *common.CappedBuffer {
+	cappedBuffer := common.NewCappedBuffer(syncer.Config.CommonConfig, common.DEFAULT_CAPPED_BUFFER_SIZE)
+	jsonQueueWriter := common.NewJsonQueueWriter(cappedBuffer)
+	recordsReader := syncer.recordsReader(recordsFile)
+
+	// Copy from the spooled records to cappedBuffer in a separate goroutine in parallel
+	go func() {
+		decoder := json.NewDecoder(recordsReader)
+		for i := 0; decoder.More(); i++ {
+			var record map[string]interface{}
+			err := decoder.Decode(&record)
+			common.PanicIfError(syncer.Config.CommonConfig, err)
+
+			if lastRecordIndexByKey != nil && lastRecordIndexByKey[stream.RecordKey(record)] != i {
+				continue
+			}
+
+			normalizedRecord, err := stream.NormalizeRecord(record, icebergSchemaColumns)
+			common.PanicIfError(syncer.Config.CommonConfig, err)
+
+			err = jsonQueueWriter.Write(normalizedRecord)
+			common.PanicIfError(syncer.Config.CommonConfig, err)
+		}
+		jsonQueueWriter.Close()
+	}()
+
+	return cappedBuffer
+}
+
+func (syncer *Syncer) lastRecordIndexByKey(stream *Stream, recordsFile *os.File) map[string]int {
+	lastRecordIndexByKey := make(map[string]int)
+
+	decoder := json.NewDecoder(syncer.recordsReader(recordsFile))
+	for i := 0; decoder.More(); i++ {
+		var record map[string]interface{}
+		err := decoder.Decode(&record)
+		common.PanicIfError(syncer.Config.CommonConfig, err)
+
+		lastRecordIndexByKey[stream.RecordKey(record)] = i
+	}
+
+	return lastRecordIndexByKey
+}
+
+// Reads the spooled records from the start or nothing for a stream without records
+func (syncer *Syncer) recordsReader(recordsFile *os.File) io.Reader {
+	if recordsFile == nil {
+		return strings.NewReader("")
+	}
+
+	_, err := recordsFile.Seek(0, io.SeekStart)
+	common.PanicIfError(syncer.Config.CommonConfig, err)
+	return bufio.NewReader(recordsFile)
+}
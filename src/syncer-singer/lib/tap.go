@@ -0,0 +1,323 @@
+package singer
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/BemiHQ/BemiDB/src/common"
+)
+
+const (
+	MESSAGE_TYPE_SCHEMA = "SCHEMA"
+	MESSAGE_TYPE_RECORD = "RECORD"
+	MESSAGE_TYPE_STATE  = "STATE"
+	MESSAGE_TYPE_LOG    = "LOG"
+
+	AIRBYTE_STATE_TYPE_STREAM = "STREAM"
+	AIRBYTE_STATE_TYPE_GLOBAL = "GLOBAL"
+
+	STATE_PATH_PLACEHOLDER = "{state}"
+	MAX_MESSAGE_SIZE       = 64 * 1024 * 1024 // 64 MB
+)
+
+// https://hub.meltano.com/singer/spec and https://docs.airbyte.com/understanding-airbyte/airbyte-protocol
+type Message struct {
+	Type string `json:"type"`
+
+	// Singer
+	Stream             string                 `json:"stream"`
+	Schema             JsonSchema             `json:"schema"`
+	KeyProperties      []string               `json:"key_properties"`
+	BookmarkProperties []string               `json:"bookmark_properties"`
+	Record             json.RawMessage        `json:"record"` // Singer record values or Airbyte AirbyteRecordMessage
+	Value              map[string]interface{} `json:"value"`
+
+	// Airbyte
+	State json.RawMessage `json:"state"`
+	Log   struct {
+		Level   string `json:"level"`
+		Message string `json:"message"`
+	} `json:"log"`
+}
+
+type SingerState struct {
+	Bookmarks map[string]json.RawMessage `json:"bookmarks"`
+}
+
+type AirbyteRecord struct {
+	Stream string          `json:"stream"`
+	Data   json.RawMessage `json:"data"`
+}
+
+type AirbyteState struct {
+	Type   string `json:"type"`
+	Stream struct {
+		StreamDescriptor struct {
+			Name      string `json:"name"`
+			Namespace string `json:"namespace"`
+		} `json:"stream_descriptor"`
+	} `json:"stream"`
+	Data json.RawMessage `json:"data"` // Legacy state
+}
+
+type AirbyteConfiguredCatalog struct {
+	Streams []struct {
+		Stream struct {
+			Name       string     `json:"name"`
+			JsonSchema JsonSchema `json:"json_schema"`
+		} `json:"stream"`
+		SyncMode   string     `json:"sync_mode"`
+		PrimaryKey [][]string `json:"primary_key"`
+	} `json:"streams"`
+}
+
+// ---------------------------------------------------------------------------------------------------------------------
+
+type Tap struct {
+	Config *Config
+
+	// Parsed from the output
+	StreamByName       map[string]*Stream
+	RecordsFileByName  map[string]*os.File
+	RecordCountByName  map[string]int
+	hasSavedState      bool
+	bookmarkedStreams  common.Set[string] // Singer streams with a bookmark in the saved state
+	singerState        map[string]interface{}
+	airbyteStateByKey  map[string]json.RawMessage
+	airbyteLegacyState json.RawMessage
+}
+
+func NewTap(config *Config) *Tap {
+	return &Tap{
+		Config:            config,
+		StreamByName:      make(map[string]*Stream),
+		RecordsFileByName: make(map[string]*os.File),
+		RecordCountByName: make(map[string]int),
+		bookmarkedStreams: common.NewSet[string](),
+		airbyteStateByKey: make(map[string]json.RawMessage),
+	}
+}
+
+// Runs the tap and spools the records of each stream into temporary files
+func (tap *Tap) Run(state []byte) error {
+	tap.hasSavedState = state != nil
+	switch tap.Config.Protocol {
+	case ProtocolSinger:
+		if state != nil {
+			var singerState SingerState
+			err := json.Unmarshal(state, &singerState)
+			if err != nil {
+				return fmt.Errorf("invalid saved state: %w", err)
+			}
+			for streamName := range singerState.Bookmarks {
+				tap.bookmarkedStreams.Add(streamName)
+			}
+		}
+	case ProtocolAirbyte:
+		err := tap.loadAirbyteCatalog()
+		if err != nil {
+			return err
+		}
+	}
+
+	command := tap.Config.Command
+	if state != nil {
+		stateFile, err := os.CreateTemp("", "bemidb-state-*.json")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(stateFile.Name())
+		_, err = stateFile.Write(state)
+		stateFile.Close()
+		if err != nil {
+			return err
+		}
+
+		if strings.Contains(command, STATE_PATH_PLACEHOLDER) {
+			command = strings.ReplaceAll(command, STATE_PATH_PLACEHOLDER, stateFile.Name())
+		} else {
+			command += " --state " + stateFile.Name()
+		}
+	}
+
+	common.LogInfo(tap.Config.CommonConfig, "Running:", command)
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Stderr = os.Stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	err = cmd.Start()
+	if err != nil {
+		return err
+	}
+
+	readErr := tap.readMessages(stdout)
+	io.Copy(io.Discard, stdout) // Unblock the process before waiting for it
+	err = cmd.Wait()
+	if readErr != nil {
+		return readErr
+	}
+	if err != nil {
+		return fmt.Errorf("command failed: %w", err)
+	}
+	return nil
+}
+
+// Returns the final state to be passed to the next run or nil if the tap didn't emit any state
+func (tap *Tap) State() ([]byte, error) {
+	switch tap.Config.Protocol {
+	case ProtocolSinger:
+		if tap.singerState == nil {
+			return nil, nil
+		}
+		return json.Marshal(tap.singerState)
+	case ProtocolAirbyte:
+		if len(tap.airbyteStateByKey) > 0 {
+			states := make([]json.RawMessage, 0, len(tap.airbyteStateByKey))
+			for _, state := range tap.airbyteStateByKey {
+				states = append(states, state)
+			}
+			return json.Marshal(states)
+		}
+		return tap.airbyteLegacyState, nil
+	}
+	return nil, nil
+}
+
+func (tap *Tap) Close() {
+	for _, recordsFile := range tap.RecordsFileByName {
+		recordsFile.Close()
+		os.Remove(recordsFile.Name())
+	}
+}
+
+func (tap *Tap) readMessages(stdout io.Reader) error {
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 0, 1024*1024), MAX_MESSAGE_SIZE)
+
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 || line[0] != '{' {
+			common.LogDebug(tap.Config.CommonConfig, "Skipping non-JSON output:", string(line))
+			continue
+		}
+
+		var message Message
+		err := json.Unmarshal(line, &message)
+		if err != nil {
+			return fmt.Errorf("invalid message: %w", err)
+		}
+
+		err = tap.handleMessage(message)
+		if err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
+
+func (tap *Tap) handleMessage(message Message) error {
+	switch message.Type {
+	case MESSAGE_TYPE_SCHEMA:
+		tap.StreamByName[message.Stream] = &Stream{
+			Name:          message.Stream,
+			Schema:        message.Schema,
+			KeyProperties: message.KeyProperties,
+			// Singer taps resume incremental streams from their bookmarks in the saved state and emit only new records
+			Incremental: tap.hasSavedState && (len(message.BookmarkProperties) > 0 || tap.bookmarkedStreams.Contains(message.Stream)),
+		}
+	case MESSAGE_TYPE_RECORD:
+		streamName, data := message.Stream, message.Record
+		if tap.Config.Protocol == ProtocolAirbyte {
+			var airbyteRecord AirbyteRecord
+			err := json.Unmarshal(message.Record, &airbyteRecord)
+			if err != nil {
+				return err
+			}
+			streamName, data = airbyteRecord.Stream, airbyteRecord.Data
+		}
+		return tap.writeRecord(streamName, data)
+	case MESSAGE_TYPE_STATE:
+		if tap.Config.Protocol == ProtocolSinger {
+			tap.singerState = message.Value
+			return nil
+		}
+
+		var airbyteState AirbyteState
+		err := json.Unmarshal(message.State, &airbyteState)
+		if err != nil {
+			return err
+		}
+		switch airbyteState.Type {
+		case AIRBYTE_STATE_TYPE_STREAM:
+			descriptor := airbyteState.Stream.StreamDescriptor
+			tap.airbyteStateByKey[descriptor.Namespace+"."+descriptor.Name] = message.State
+		case AIRBYTE_STATE_TYPE_GLOBAL:
+			tap.airbyteStateByKey[AIRBYTE_STATE_TYPE_GLOBAL] = message.State
+		default:
+			tap.airbyteLegacyState = airbyteState.Data
+		}
+	case MESSAGE_TYPE_LOG:
+		common.LogInfo(tap.Config.CommonConfig, "["+message.Log.Level+"]", message.Log.Message)
+	}
+
+	return nil
+}
+
+func (tap *Tap) writeRecord(streamName string, data json.RawMessage) error {
+	if _, ok := tap.StreamByName[streamName]; !ok {
+		return fmt.Errorf("received a record for stream %s without a schema", streamName)
+	}
+
+	recordsFile, ok := tap.RecordsFileByName[streamName]
+	if !ok {
+		var err error
+		recordsFile, err = os.CreateTemp("", "bemidb-records-*.jsonl")
+		if err != nil {
+			return err
+		}
+		tap.RecordsFileByName[streamName] = recordsFile
+	}
+
+	_, err := recordsFile.Write(append(data, '\n'))
+	if err != nil {
+		return err
+	}
+	tap.RecordCountByName[streamName]++
+	return nil
+}
+
+func (tap *Tap) loadAirbyteCatalog() error {
+	catalogJson, err := os.ReadFile(tap.Config.CatalogPath)
+	if err != nil {
+		return err
+	}
+
+	var catalog AirbyteConfiguredCatalog
+	err = json.Unmarshal(catalogJson, &catalog)
+	if err != nil {
+		return err
+	}
+
+	for _, configuredStream := range catalog.Streams {
+		var keyProperties []string
+		for _, primaryKey := range configuredStream.PrimaryKey {
+			keyProperties = append(keyProperties, primaryKey...)
+		}
+
+		tap.StreamByName[configuredStream.Stream.Name] = &Stream{
+			Name:          configuredStream.Stream.Name,
+			Schema:        configuredStream.Stream.JsonSchema,
+			KeyProperties: keyProperties,
+			Incremental:   tap.hasSavedState && configuredStream.SyncMode == "incremental", // Without a saved state, the source emits all records
+		}
+	}
+	return nil
+}